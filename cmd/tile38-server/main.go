@@ -16,6 +16,7 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/tile38/core"
@@ -86,10 +87,12 @@ Advanced Options:
   --pidfile path          : file that contains the pid
   --appendonly yes/no     : AOF persistence (default: yes)
   --appendfilename path   : AOF path (default: data/appendonly.aof)
+  --appendcompress yes/no : Compress a new AOF (default: no)
   --queuefilename path    : Event queue path (default:data/queue.db)
   --http-transport yes/no : HTTP transport (default: yes)
   --protected-mode yes/no : protected mode (default: yes)
   --nohup                 : do not exit on SIGHUP
+  --drain-timeout dur     : wait for connections on shutdown (default: 10s)
 
 Developer Options:
   --dev                             : enable developer mode
@@ -164,6 +167,9 @@ Developer Options:
 		// AppendFileName allows for custom appendonly file path
 		appendFileName = ""
 
+		// AppendCompress stores a new appendonly file compressed.
+		appendCompress = false
+
 		// QueueFileName allows for custom queue.db file path
 		queueFileName = ""
 	)
@@ -213,6 +219,20 @@ Developer Options:
 			}
 			fmt.Fprintf(os.Stderr, "appendonly must be 'yes' or 'no'\n")
 			os.Exit(1)
+		case "--appendcompress", "-appendcompress":
+			i++
+			if i < len(os.Args) {
+				switch strings.ToLower(os.Args[i]) {
+				case "no":
+					appendCompress = false
+					continue
+				case "yes":
+					appendCompress = true
+					continue
+				}
+			}
+			fmt.Fprintf(os.Stderr, "appendcompress must be 'yes' or 'no'\n")
+			os.Exit(1)
 		case "--appendfilename", "-appendfilename":
 			i++
 			if i == len(os.Args) || os.Args[i] == "" {
@@ -273,18 +293,19 @@ Developer Options:
 	metricsAddr := flag.String("metrics-addr", "", "The listening addr for Prometheus metrics.")
 
 	var (
-		dir         string
-		port        int
-		host        string
-		unixSocket  string
-		verbose     bool
-		veryVerbose bool
-		logEncoding string
-		quiet       bool
-		pidfile     string
-		cpuprofile  string
-		memprofile  string
-		pprofport   int
+		dir          string
+		port         int
+		host         string
+		unixSocket   string
+		verbose      bool
+		veryVerbose  bool
+		logEncoding  string
+		quiet        bool
+		pidfile      string
+		cpuprofile   string
+		memprofile   string
+		pprofport    int
+		drainTimeout time.Duration
 	)
 
 	flag.IntVar(&port, "p", 9851, "The listening port")
@@ -297,6 +318,7 @@ Developer Options:
 	flag.BoolVar(&quiet, "q", false, "Quiet logging. Totally silent")
 	flag.BoolVar(&veryVerbose, "vv", false, "Enable very verbose logging")
 	flag.IntVar(&pprofport, "pprofport", 0, "pprofport http at port")
+	flag.DurationVar(&drainTimeout, "drain-timeout", 10*time.Second, "Wait for connections on shutdown")
 	flag.StringVar(&cpuprofile, "cpuprofile", "", "write cpu profile to `file`")
 	flag.StringVar(&memprofile, "memprofile", "", "write memory profile to `file`")
 	flag.Parse()
@@ -413,7 +435,7 @@ Developer Options:
 	}
 
 	c := make(chan os.Signal, 1)
-	shutdown := make (chan bool, 1)
+	shutdown := make(chan bool, 1)
 
 	signal.Notify(c, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	go func() {
@@ -481,8 +503,10 @@ Developer Options:
 		ProtectedMode:     protectedMode,
 		AppendOnly:        appendOnly,
 		AppendFileName:    appendFileName,
+		AppendCompress:    appendCompress,
 		QueueFileName:     queueFileName,
 		Shutdown:          shutdown,
+		DrainTimeout:      drainTimeout,
 	}
 	if err := server.Serve(opts); err != nil {
 		log.Fatal(err)
@@ -191,6 +191,13 @@ var commandsJSON = `{
         "optional": true,
         "multiple": false
       },
+      {
+        "command": "PX",
+        "name": ["milliseconds"],
+        "type": ["integer"],
+        "optional": true,
+        "multiple": false
+      },
       {
         "name": "type",
         "optional": true,
@@ -203,6 +210,38 @@ var commandsJSON = `{
           }
         ]
       },
+      {
+        "name": "condition",
+        "optional": true,
+        "enumargs": [
+          {
+            "name": "IFWITHIN",
+            "arguments": [
+              {
+                "name": "regionkey",
+                "type": "string"
+              },
+              {
+                "name": "regionid",
+                "type": "string"
+              }
+            ]
+          },
+          {
+            "name": "IFOUTSIDE",
+            "arguments": [
+              {
+                "name": "regionkey",
+                "type": "string"
+              },
+              {
+                "name": "regionid",
+                "type": "string"
+              }
+            ]
+          }
+        ]
+      },
       {
         "name": "value",
         "enumargs": [
@@ -314,6 +353,42 @@ var commandsJSON = `{
     "since": "1.0.0",
     "group": "keys"
   },
+  "PEXPIRE": {
+    "summary": "Set a timeout on an id in milliseconds",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": "id",
+        "type": "string"
+      },
+      {
+        "name": "milliseconds",
+        "type": "integer"
+      }
+    ],
+    "since": "1.34.0",
+    "group": "keys"
+  },
+  "PTTL": {
+    "summary": "Get a timeout on an id in milliseconds",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": "id",
+        "type": "string"
+      }
+    ],
+    "since": "1.34.0",
+    "group": "keys"
+  },
   "EXISTS": {
     "summary": "Checks to see if a id exists",
     "complexity": "O(1)",
@@ -366,40 +441,43 @@ var commandsJSON = `{
     "since": "1.0.0",
     "group": "keys"
   },
-  "FSET": {
-    "summary": "Set the value for one or more fields of an id",
-    "complexity": "O(1)",
+  "TRACK": {
+    "summary": "Tracks the value changes of fields for a key",
+    "complexity": "O(N) where N is the number of ids in the key",
     "arguments": [
       {
         "name": "key",
         "type": "string"
       },
       {
-        "name": "id",
-        "type": "string"
-      },
-      {
-        "command": "XX",
-        "name": [],
-        "type": [],
-        "optional": true
-      },
+        "name": "field",
+        "type": "string",
+        "multiple": true
+      }
+    ],
+    "since": "1.34.0",
+    "group": "keys"
+  },
+  "UNTRACK": {
+    "summary": "Stops tracking the value changes of fields for a key",
+    "complexity": "O(N) where N is the number of tracked ids in the key",
+    "arguments": [
       {
-        "name": ["field", "value"],
-        "type": ["string", "double"]
+        "name": "key",
+        "type": "string"
       },
       {
-        "name": ["field", "value"],
-        "type": ["string", "double"],
-        "multiple": true,
-        "optional": true
+        "name": "field",
+        "type": "string",
+        "optional": true,
+        "multiple": true
       }
     ],
-    "since": "1.0.0",
+    "since": "1.34.0",
     "group": "keys"
   },
-  "FGET": {
-    "summary": "Gets the value for the field of an id",
+  "KEEPPREV": {
+    "summary": "Keeps the previous geometry of each object for a key",
     "complexity": "O(1)",
     "arguments": [
       {
@@ -407,31 +485,45 @@ var commandsJSON = `{
         "type": "string"
       },
       {
-        "name": "id",
+        "enum": ["yes", "no"]
+      }
+    ],
+    "since": "1.34.0",
+    "group": "keys"
+  },
+  "DEDUP": {
+    "summary": "Stores identical geometries of a key once, shared by the objects that have them",
+    "complexity": "O(N) where N is the number of objects in the key",
+    "arguments": [
+      {
+        "name": "key",
         "type": "string"
       },
       {
-        "name": "field",
-        "type": "string"
+        "enum": ["yes", "no"]
       }
     ],
-    "since": "1.33.0",
+    "since": "1.34.0",
     "group": "keys"
   },
-  "BOUNDS": {
-    "summary": "Get the combined bounds of all the objects in a key",
+  "PREEXPIRE": {
+    "summary": "Notifies about the objects of a key some seconds before they expire",
     "complexity": "O(1)",
     "arguments": [
       {
         "name": "key",
         "type": "string"
+      },
+      {
+        "name": "seconds",
+        "type": "double"
       }
     ],
-    "since": "1.3.0",
+    "since": "1.34.0",
     "group": "keys"
   },
-  "GET": {
-    "summary": "Get the object of an id",
+  "MOVEMENT": {
+    "summary": "Returns the movement of an object between its last two positions",
     "complexity": "O(1)",
     "arguments": [
       {
@@ -441,25 +533,93 @@ var commandsJSON = `{
       {
         "name": "id",
         "type": "string"
+      }
+    ],
+    "since": "1.34.0",
+    "group": "keys"
+  },
+  "INTERSECTION": {
+    "summary": "Returns the geometry that two objects have in common",
+    "complexity": "O(N*M) where N and M are the number of vertices of the objects",
+    "arguments": [
+      {
+        "name": "keyA",
+        "type": "string"
       },
       {
-        "command": "WITHFIELDS",
-        "name": [],
-        "type": [],
-        "optional": true
+        "name": "idA",
+        "type": "string"
       },
       {
-        "name": "type",
-        "optional": true,
+        "name": "keyB",
+        "type": "string"
+      },
+      {
+        "name": "idB",
+        "type": "string"
+      }
+    ],
+    "since": "1.34.0",
+    "group": "keys"
+  },
+  "BUFFER": {
+    "summary": "Returns the geodesic buffer polygon around a geometry",
+    "complexity": "O(N) where N is the number of vertices of the geometry",
+    "arguments": [
+      {
+        "name": "geometry",
         "enumargs": [
           {
-            "name": "OBJECT"
+            "name": "key",
+            "arguments": [
+              {
+                "name": "id",
+                "type": "string"
+              }
+            ]
           },
           {
-            "name": "POINT"
+            "name": "POINT",
+            "arguments": [
+              {
+                "name": "lat",
+                "type": "double"
+              },
+              {
+                "name": "lon",
+                "type": "double"
+              }
+            ]
           },
           {
-            "name": "BOUNDS"
+            "name": "OBJECT",
+            "arguments": [
+              {
+                "name": "geojson",
+                "type": "geojson"
+              }
+            ]
+          },
+          {
+            "name": "BOUNDS",
+            "arguments": [
+              {
+                "name": "minlat",
+                "type": "double"
+              },
+              {
+                "name": "minlon",
+                "type": "double"
+              },
+              {
+                "name": "maxlat",
+                "type": "double"
+              },
+              {
+                "name": "maxlon",
+                "type": "double"
+              }
+            ]
           },
           {
             "name": "HASH",
@@ -471,47 +631,76 @@ var commandsJSON = `{
             ]
           }
         ]
+      },
+      {
+        "name": "meters",
+        "type": "double"
+      },
+      {
+        "command": "STEPS",
+        "name": "count",
+        "type": "integer",
+        "optional": true
       }
     ],
-    "since": "1.0.0",
+    "since": "1.34.0",
     "group": "keys"
   },
-  "DEL": {
-    "summary": "Delete an id from a key",
-    "complexity": "O(1)",
+  "LENGTHWITHIN": {
+    "summary": "Returns the length in meters of the part of a track that is within a region",
+    "complexity": "O(N*M) where N and M are the number of vertices of the track and the region",
     "arguments": [
       {
-        "name": "key",
+        "name": "trackkey",
         "type": "string"
       },
       {
-        "name": "id",
+        "name": "trackid",
         "type": "string"
       },
       {
-        "command": "ERRON404",
-        "name": [],
-        "type": [],
+        "name": "regionkey",
+        "type": "string"
+      },
+      {
+        "name": "regionid",
+        "type": "string"
+      },
+      {
+        "command": "METRIC",
+        "enum": ["HAVERSINE", "VINCENTY"],
         "optional": true
       }
     ],
-    "since": "1.0.0",
+    "since": "1.34.0",
     "group": "keys"
   },
-  "DROP": {
-    "summary": "Remove a key from the database",
-    "complexity": "O(1)",
+  "EXPORT": {
+    "summary": "Streams the objects of a collection with resumable checkpoints",
+    "complexity": "O(N) where N is the number of objects in the collection",
     "arguments": [
       {
         "name": "key",
         "type": "string"
+      },
+      {
+        "command": "CHECKPOINT",
+        "name": ["count"],
+        "type": ["integer"],
+        "optional": true
+      },
+      {
+        "command": "RESUME",
+        "name": ["token"],
+        "type": ["string"],
+        "optional": true
       }
     ],
-    "since": "1.0.0",
+    "since": "1.34.0",
     "group": "keys"
   },
-  "RENAME": {
-    "summary": "Rename a key to be stored under a different name.",
+  "SETDELTA": {
+    "summary": "Moves a point object by a compact latitude and longitude offset",
     "complexity": "O(1)",
     "arguments": [
       {
@@ -519,42 +708,420 @@ var commandsJSON = `{
         "type": "string"
       },
       {
-        "name": "newkey",
+        "name": "id",
+        "type": "string"
+      },
+      {
+        "name": "delta",
         "type": "string"
       }
     ],
-    "since": "1.14.5",
+    "since": "1.34.0",
     "group": "keys"
   },
-  "RENAMENX": {
-    "summary": "Rename a key to be stored under a different name, if a new key does not exist.",
-    "complexity": "O(1)",
+  "TRACKTRIM": {
+    "summary": "Removes the oldest vertices of a linestring object",
+    "complexity": "O(N) where N is the number of vertices",
     "arguments": [
       {
         "name": "key",
         "type": "string"
       },
       {
-        "name": "newkey",
+        "name": "id",
         "type": "string"
+      },
+      {
+        "command": "MAXPOINTS",
+        "name": ["count"],
+        "type": ["integer"],
+        "optional": true
+      },
+      {
+        "command": "MAXAGE",
+        "name": ["seconds"],
+        "type": ["double"],
+        "optional": true
       }
     ],
-    "since": "1.14.5",
+    "since": "1.34.0",
     "group": "keys"
   },
-  "KEYS": {
-    "summary": "Finds all keys matching the given pattern",
-    "complexity": "O(N) where N is the number of keys in the database",
+  "TRACKAPPEND": {
+    "summary": "Appends a vertex to a linestring object",
+    "complexity": "O(N) where N is the number of vertices",
     "arguments": [
       {
-        "name": "pattern",
-        "type": "pattern"
-      }
-    ],
-    "since": "1.0.0",
-    "group": "keys"
-  },
-  "STATS": {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": "id",
+        "type": "string"
+      },
+      {
+        "command": "POINT",
+        "name": ["lat", "lon"],
+        "type": ["double", "double"]
+      },
+      {
+        "name": "z",
+        "type": "double",
+        "optional": true
+      },
+      {
+        "name": "timestamp",
+        "type": "double",
+        "optional": true
+      }
+    ],
+    "since": "1.34.0",
+    "group": "keys"
+  },
+  "KEYDEFAULTS": {
+    "summary": "Sets the default fields for new objects in a key",
+    "complexity": "O(N) where N is the number of fields",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": ["field", "value"],
+        "type": ["string", "double"],
+        "optional": true,
+        "multiple": true
+      }
+    ],
+    "since": "1.34.0",
+    "group": "keys"
+  },
+  "GETKEYDEFAULTS": {
+    "summary": "Returns the default fields for new objects in a key",
+    "complexity": "O(N) where N is the number of fields",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      }
+    ],
+    "since": "1.34.0",
+    "group": "keys"
+  },
+  "SETINDEX": {
+    "summary": "Indexes the values of a field of the objects in a key",
+    "complexity": "O(N*log(N)) where N is the number of objects in the key",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": "field",
+        "type": "string"
+      }
+    ],
+    "since": "1.34.0",
+    "group": "keys"
+  },
+  "DELINDEX": {
+    "summary": "Removes the index on a field of the objects in a key",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": "field",
+        "type": "string"
+      }
+    ],
+    "since": "1.34.0",
+    "group": "keys"
+  },
+  "INDEXES": {
+    "summary": "Returns the indexed fields of a key",
+    "complexity": "O(N) where N is the number of indexed fields",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      }
+    ],
+    "since": "1.34.0",
+    "group": "keys"
+  },
+  "FSET": {
+    "summary": "Set the value for one or more fields of an id",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": "id",
+        "type": "string"
+      },
+      {
+        "command": "XX",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "name": ["field", "value"],
+        "type": ["string", "double"]
+      },
+      {
+        "name": ["field", "value"],
+        "type": ["string", "double"],
+        "multiple": true,
+        "optional": true
+      }
+    ],
+    "since": "1.0.0",
+    "group": "keys"
+  },
+  "FSETWHERE": {
+    "summary": "Set the value for a field of all objects in a key that match a filter",
+    "complexity": "O(N) where N is the number of objects in the key",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": ["field", "value"],
+        "type": ["string", "double"]
+      },
+      {
+        "command": "MATCH",
+        "name": "pattern",
+        "type": "pattern",
+        "optional": true,
+        "multiple": true
+      },
+      {
+        "command": "WHERE",
+        "name": ["field", "min", "max"],
+        "type": ["string", "double", "double"],
+        "optional": true,
+        "multiple": true
+      },
+      {
+        "command": "WHEREJSON",
+        "name": ["path", "op", "value"],
+        "type": ["string", "string", "string"],
+        "optional": true,
+        "multiple": true
+      },
+      {
+        "command": "WHEREIN",
+        "name": ["field", "count", "value"],
+        "type": ["string", "integer", "double"],
+        "optional": true,
+        "multiple": true,
+        "variadic": true
+      }
+    ],
+    "since": "1.34.0",
+    "group": "keys"
+  },
+  "FGET": {
+    "summary": "Gets the value for the field of an id",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": "id",
+        "type": "string"
+      },
+      {
+        "name": "field",
+        "type": "string"
+      }
+    ],
+    "since": "1.33.0",
+    "group": "keys"
+  },
+  "BOUNDS": {
+    "summary": "Get the combined bounds of all the objects in a key",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      }
+    ],
+    "since": "1.3.0",
+    "group": "keys"
+  },
+  "GET": {
+    "summary": "Get the object of an id",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": "id",
+        "type": "string"
+      },
+      {
+        "command": "WITHFIELDS",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "name": "type",
+        "optional": true,
+        "enumargs": [
+          {
+            "name": "OBJECT"
+          },
+          {
+            "name": "POINT"
+          },
+          {
+            "name": "BOUNDS"
+          },
+          {
+            "name": "HASH",
+            "arguments": [
+              {
+                "name": "geohash",
+                "type": "geohash"
+              }
+            ]
+          },
+          {
+            "name": "FORMAT",
+            "arguments": [
+              {
+                "enum": ["POLYLINE", "WKT", "WKB"]
+              },
+              {
+                "command": "PRECISION",
+                "name": ["precision"],
+                "type": ["integer"],
+                "optional": true
+              }
+            ]
+          }
+        ]
+      }
+    ],
+    "since": "1.0.0",
+    "group": "keys"
+  },
+  "DEL": {
+    "summary": "Delete an id from a key",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": "id",
+        "type": "string"
+      },
+      {
+        "command": "ERRON404",
+        "name": [],
+        "type": [],
+        "optional": true
+      }
+    ],
+    "since": "1.0.0",
+    "group": "keys"
+  },
+  "DROP": {
+    "summary": "Remove a key from the database",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      }
+    ],
+    "since": "1.0.0",
+    "group": "keys"
+  },
+  "COPY": {
+    "summary": "Copies all objects of a key to another key",
+    "complexity": "O(N) where N is the number of objects in the key",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": "newkey",
+        "type": "string"
+      },
+      {
+        "command": "REPLACE",
+        "name": [],
+        "type": [],
+        "optional": true
+      }
+    ],
+    "since": "1.34.0",
+    "group": "keys"
+  },
+  "RENAME": {
+    "summary": "Rename a key to be stored under a different name.",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": "newkey",
+        "type": "string"
+      }
+    ],
+    "since": "1.14.5",
+    "group": "keys"
+  },
+  "RENAMENX": {
+    "summary": "Rename a key to be stored under a different name, if a new key does not exist.",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": "newkey",
+        "type": "string"
+      }
+    ],
+    "since": "1.14.5",
+    "group": "keys"
+  },
+  "KEYS": {
+    "summary": "Finds all keys matching the given pattern",
+    "complexity": "O(N) where N is the number of keys in the database",
+    "arguments": [
+      {
+        "name": "pattern",
+        "type": "pattern"
+      }
+    ],
+    "since": "1.0.0",
+    "group": "keys"
+  },
+  "STATS": {
     "summary": "Show stats for one or more keys",
     "complexity": "O(N) where N is the number of keys being requested",
     "arguments": [
@@ -593,6 +1160,13 @@ var commandsJSON = `{
         "type": "pattern",
         "optional": true
       },
+      {
+        "command": "MATCH RE",
+        "name": "regexp",
+        "type": "string",
+        "optional": true,
+        "multiple": true
+      },
       {
         "name": "order",
         "optional": true,
@@ -612,6 +1186,13 @@ var commandsJSON = `{
         "optional": true,
         "multiple": true
       },
+      {
+        "command": "WHEREJSON",
+        "name": ["path", "op", "value"],
+        "type": ["string", "string", "string"],
+        "optional": true,
+        "multiple": true
+      },
       {
         "command": "WHEREIN",
         "name": ["field", "count", "value"],
@@ -620,6 +1201,12 @@ var commandsJSON = `{
         "multiple": true,
         "variadic": true
       },
+      {
+        "command": "JOIN",
+        "name": ["key", "ON", "field", "FIELDS", "names"],
+        "type": ["string", "string", "string", "string", "string"],
+        "optional": true
+      },
       {
         "command": "WHEREEVAL",
         "name": ["script", "numargs", "arg"],
@@ -636,12 +1223,36 @@ var commandsJSON = `{
         "multiple": true,
         "variadic": true
       },
+      {
+        "command": "TTLBETWEEN",
+        "name": ["min", "max"],
+        "type": ["double", "double"],
+        "optional": true
+      },
+      {
+        "command": "WITHETAG",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "IFNONEMATCH",
+        "name": "etag",
+        "type": "string",
+        "optional": true
+      },
       {
         "command": "NOFIELDS",
         "name": [],
         "type": [],
         "optional": true
       },
+      {
+        "command": "STRICT",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
       {
         "name": "type",
         "optional": true,
@@ -649,6 +1260,15 @@ var commandsJSON = `{
           {
             "name": "COUNT"
           },
+          {
+            "name": "NDISTINCT",
+            "arguments": [
+              {
+                "name": "field",
+                "type": "string"
+              }
+            ]
+          },
           {
             "name": "IDS"
           }
@@ -684,6 +1304,13 @@ var commandsJSON = `{
         "type": "pattern",
         "optional": true
       },
+      {
+        "command": "MATCH RE",
+        "name": "regexp",
+        "type": "string",
+        "optional": true,
+        "multiple": true
+      },
       {
         "name": "order",
         "optional": true,
@@ -696,6 +1323,25 @@ var commandsJSON = `{
           }
         ]
       },
+      {
+        "command": "SINCE",
+        "name": "timestamp",
+        "type": "double",
+        "optional": true
+      },
+      {
+        "command": "WHERECHANGED",
+        "name": "field",
+        "type": "string",
+        "optional": true,
+        "multiple": true
+      },
+      {
+        "command": "INCLUDE_DELETED",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
       {
         "command": "WHERE",
         "name": ["field", "min", "max"],
@@ -703,6 +1349,13 @@ var commandsJSON = `{
         "optional": true,
         "multiple": true
       },
+      {
+        "command": "WHEREJSON",
+        "name": ["path", "op", "value"],
+        "type": ["string", "string", "string"],
+        "optional": true,
+        "multiple": true
+      },
       {
         "command": "WHEREIN",
         "name": ["field", "count", "value"],
@@ -711,6 +1364,12 @@ var commandsJSON = `{
         "multiple": true,
         "variadic": true
       },
+      {
+        "command": "JOIN",
+        "name": ["key", "ON", "field", "FIELDS", "names"],
+        "type": ["string", "string", "string", "string", "string"],
+        "optional": true
+      },
       {
         "command": "WHEREEVAL",
         "name": ["script", "numargs", "arg"],
@@ -727,12 +1386,48 @@ var commandsJSON = `{
         "multiple": true,
         "variadic": true
       },
+      {
+        "command": "TTLBETWEEN",
+        "name": ["min", "max"],
+        "type": ["double", "double"],
+        "optional": true
+      },
+      {
+        "command": "SIMPLIFY",
+        "name": ["tolerance"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "command": "METERS",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "WITHETAG",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "IFNONEMATCH",
+        "name": "etag",
+        "type": "string",
+        "optional": true
+      },
       {
         "command": "NOFIELDS",
         "name": [],
         "type": [],
         "optional": true
       },
+      {
+        "command": "STRICT",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
       {
         "name": "type",
         "optional": true,
@@ -740,6 +1435,15 @@ var commandsJSON = `{
           {
             "name": "COUNT"
           },
+          {
+            "name": "NDISTINCT",
+            "arguments": [
+              {
+                "name": "field",
+                "type": "string"
+              }
+            ]
+          },
           {
             "name": "IDS"
           },
@@ -752,12 +1456,75 @@ var commandsJSON = `{
           {
             "name": "BOUNDS"
           },
+          {
+            "name": "WKT"
+          },
+          {
+            "name": "WKB"
+          },
           {
             "name": "HASHES",
             "arguments": [
               {
                 "name": "precision",
                 "type": "integer"
+              },
+              {
+                "command": "COVER",
+                "name": [],
+                "type": [],
+                "optional": true
+              }
+            ]
+          },
+          {
+            "name": "FEATURES",
+            "arguments": [
+              {
+                "command": "INDEX",
+                "name": "grid",
+                "type": "integer",
+                "optional": true
+              }
+            ]
+          },
+          {
+            "name": "MVT",
+            "arguments": [
+              {
+                "name": "z",
+                "type": "integer"
+              },
+              {
+                "name": "x",
+                "type": "integer"
+              },
+              {
+                "name": "y",
+                "type": "integer"
+              }
+            ]
+          },
+          {
+            "name": "CSV",
+            "arguments": [
+              {
+                "command": "FIELDS",
+                "name": "names",
+                "type": "string",
+                "optional": true
+              },
+              {
+                "command": "WKT",
+                "name": [],
+                "type": [],
+                "optional": true
+              },
+              {
+                "command": "NOHEADER",
+                "name": [],
+                "type": [],
+                "optional": true
               }
             ]
           }
@@ -793,12 +1560,42 @@ var commandsJSON = `{
         "type": "pattern",
         "optional": true
       },
+      {
+        "command": "MATCH RE",
+        "name": "regexp",
+        "type": "string",
+        "optional": true,
+        "multiple": true
+      },
       {
         "command": "DISTANCE",
         "name": [],
         "type": [],
         "optional": true
       },
+      {
+        "command": "METRIC",
+        "enum": ["HAVERSINE", "VINCENTY"],
+        "optional": true
+      },
+      {
+        "command": "HEADING",
+        "name": ["degrees"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "command": "MAXDIST",
+        "name": ["meters"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "command": "ALONG",
+        "name": ["linekey", "lineid"],
+        "type": ["string", "string"],
+        "optional": true
+      },
       {
         "command": "WHERE",
         "name": ["field", "min", "max"],
@@ -806,6 +1603,13 @@ var commandsJSON = `{
         "optional": true,
         "multiple": true
       },
+      {
+        "command": "WHEREJSON",
+        "name": ["path", "op", "value"],
+        "type": ["string", "string", "string"],
+        "optional": true,
+        "multiple": true
+      },
       {
         "command": "WHEREIN",
         "name": ["field", "count", "value"],
@@ -814,6 +1618,12 @@ var commandsJSON = `{
         "multiple": true,
         "variadic": true
       },
+      {
+        "command": "JOIN",
+        "name": ["key", "ON", "field", "FIELDS", "names"],
+        "type": ["string", "string", "string", "string", "string"],
+        "optional": true
+      },
       {
         "command": "WHEREEVAL",
         "name": ["script", "numargs", "arg"],
@@ -830,12 +1640,48 @@ var commandsJSON = `{
         "multiple": true,
         "variadic": true
       },
+      {
+        "command": "TTLBETWEEN",
+        "name": ["min", "max"],
+        "type": ["double", "double"],
+        "optional": true
+      },
+      {
+        "command": "SIMPLIFY",
+        "name": ["tolerance"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "command": "METERS",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "WITHETAG",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "IFNONEMATCH",
+        "name": "etag",
+        "type": "string",
+        "optional": true
+      },
       {
         "command": "NOFIELDS",
         "name": [],
         "type": [],
         "optional": true
       },
+      {
+        "command": "STRICT",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
       {
         "command": "FENCE",
         "name": [],
@@ -848,12 +1694,30 @@ var commandsJSON = `{
         "type": ["string"],
         "optional": true
       },
+      {
+        "command": "DWELL",
+        "name": ["seconds"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "command": "NODWELL",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
       {
         "command": "COMMANDS",
         "name": ["which"],
         "type": ["string"],
         "optional": true
       },
+      {
+        "command": "ARM",
+        "name": ["key", "id"],
+        "type": ["string", "string"],
+        "optional": true
+      },
       {
         "name": "type",
         "optional": true,
@@ -861,6 +1725,15 @@ var commandsJSON = `{
           {
             "name": "COUNT"
           },
+          {
+            "name": "NDISTINCT",
+            "arguments": [
+              {
+                "name": "field",
+                "type": "string"
+              }
+            ]
+          },
           {
             "name": "IDS"
           },
@@ -873,12 +1746,75 @@ var commandsJSON = `{
           {
             "name": "BOUNDS"
           },
+          {
+            "name": "WKT"
+          },
+          {
+            "name": "WKB"
+          },
           {
             "name": "HASHES",
             "arguments": [
               {
                 "name": "precision",
                 "type": "integer"
+              },
+              {
+                "command": "COVER",
+                "name": [],
+                "type": [],
+                "optional": true
+              }
+            ]
+          },
+          {
+            "name": "FEATURES",
+            "arguments": [
+              {
+                "command": "INDEX",
+                "name": "grid",
+                "type": "integer",
+                "optional": true
+              }
+            ]
+          },
+          {
+            "name": "MVT",
+            "arguments": [
+              {
+                "name": "z",
+                "type": "integer"
+              },
+              {
+                "name": "x",
+                "type": "integer"
+              },
+              {
+                "name": "y",
+                "type": "integer"
+              }
+            ]
+          },
+          {
+            "name": "CSV",
+            "arguments": [
+              {
+                "command": "FIELDS",
+                "name": "names",
+                "type": "string",
+                "optional": true
+              },
+              {
+                "command": "WKT",
+                "name": [],
+                "type": [],
+                "optional": true
+              },
+              {
+                "command": "NOHEADER",
+                "name": [],
+                "type": [],
+                "optional": true
               }
             ]
           }
@@ -927,6 +1863,56 @@ var commandsJSON = `{
     "since": "1.0.0",
     "group": "search"
   },
+  "DENSITY": {
+    "summary": "Counts the objects in each cell of a grid over an area",
+    "complexity": "O(log(N)) where N is the number of ids in the area",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "command": "BOUNDS",
+        "name": ["minlat", "minlon", "maxlat", "maxlon"],
+        "type": ["double", "double", "double", "double"]
+      },
+      {
+        "command": "GRID",
+        "name": ["cols", "rows"],
+        "type": ["integer", "integer"]
+      },
+      {
+        "command": "MATCH",
+        "name": "pattern",
+        "type": "pattern",
+        "optional": true
+      },
+      {
+        "command": "WHERE",
+        "name": ["field", "min", "max"],
+        "type": ["string", "double", "double"],
+        "optional": true,
+        "multiple": true
+      },
+      {
+        "command": "WHEREJSON",
+        "name": ["path", "op", "value"],
+        "type": ["string", "string", "string"],
+        "optional": true,
+        "multiple": true
+      },
+      {
+        "command": "WHEREIN",
+        "name": ["field", "count", "value"],
+        "type": ["string", "integer", "double"],
+        "optional": true,
+        "multiple": true,
+        "variadic": true
+      }
+    ],
+    "since": "1.34.0",
+    "group": "search"
+  },
   "WITHIN": {
     "summary": "Searches for ids that completely within the area",
     "complexity": "O(log(N)) where N is the number of ids in the area",
@@ -953,6 +1939,13 @@ var commandsJSON = `{
         "type": "pattern",
         "optional": true
       },
+      {
+        "command": "MATCH RE",
+        "name": "regexp",
+        "type": "string",
+        "optional": true,
+        "multiple": true
+      },
       {
         "command": "WHERE",
         "name": ["field", "min", "max"],
@@ -960,6 +1953,13 @@ var commandsJSON = `{
         "optional": true,
         "multiple": true
       },
+      {
+        "command": "WHEREJSON",
+        "name": ["path", "op", "value"],
+        "type": ["string", "string", "string"],
+        "optional": true,
+        "multiple": true
+      },
       {
         "command": "WHEREIN",
         "name": ["field", "count", "value"],
@@ -968,6 +1968,12 @@ var commandsJSON = `{
         "multiple": true,
         "variadic": true
       },
+      {
+        "command": "JOIN",
+        "name": ["key", "ON", "field", "FIELDS", "names"],
+        "type": ["string", "string", "string", "string", "string"],
+        "optional": true
+      },
       {
         "command": "WHEREEVAL",
         "name": ["script", "numargs", "arg"],
@@ -985,9 +1991,81 @@ var commandsJSON = `{
         "variadic": true
       },
       {
-        "command": "NOFIELDS",
-        "name": [],
-        "type": [],
+        "command": "TTLBETWEEN",
+        "name": ["min", "max"],
+        "type": ["double", "double"],
+        "optional": true
+      },
+      {
+        "command": "SIMPLIFY",
+        "name": ["tolerance"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "command": "METERS",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "WITHETAG",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "IFNONEMATCH",
+        "name": "etag",
+        "type": "string",
+        "optional": true
+      },
+      {
+        "command": "NOFIELDS",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "STRICT",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "BUFFER",
+        "name": "meters",
+        "type": "double",
+        "optional": true
+      },
+      {
+        "command": "WITHSCORE",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "WITHZONE",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "COMPONENTS",
+        "name": "distance",
+        "type": "double",
+        "optional": true
+      },
+      {
+        "command": "DELTA",
+        "name": "token",
+        "type": "string",
+        "optional": true
+      },
+      {
+        "command": "ASOF",
+        "name": "timestamp",
+        "type": "double",
         "optional": true
       },
       {
@@ -1002,12 +2080,30 @@ var commandsJSON = `{
         "type": ["string"],
         "optional": true
       },
+      {
+        "command": "DWELL",
+        "name": ["seconds"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "command": "NODWELL",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
       {
         "command": "COMMANDS",
         "name": ["which"],
         "type": ["string"],
         "optional": true
       },
+      {
+        "command": "ARM",
+        "name": ["key", "id"],
+        "type": ["string", "string"],
+        "optional": true
+      },
       {
         "name": "type",
         "optional": true,
@@ -1015,6 +2111,15 @@ var commandsJSON = `{
           {
             "name": "COUNT"
           },
+          {
+            "name": "NDISTINCT",
+            "arguments": [
+              {
+                "name": "field",
+                "type": "string"
+              }
+            ]
+          },
           {
             "name": "IDS"
           },
@@ -1027,12 +2132,75 @@ var commandsJSON = `{
           {
             "name": "BOUNDS"
           },
+          {
+            "name": "WKT"
+          },
+          {
+            "name": "WKB"
+          },
           {
             "name": "HASHES",
             "arguments": [
               {
                 "name": "precision",
                 "type": "integer"
+              },
+              {
+                "command": "COVER",
+                "name": [],
+                "type": [],
+                "optional": true
+              }
+            ]
+          },
+          {
+            "name": "FEATURES",
+            "arguments": [
+              {
+                "command": "INDEX",
+                "name": "grid",
+                "type": "integer",
+                "optional": true
+              }
+            ]
+          },
+          {
+            "name": "MVT",
+            "arguments": [
+              {
+                "name": "z",
+                "type": "integer"
+              },
+              {
+                "name": "x",
+                "type": "integer"
+              },
+              {
+                "name": "y",
+                "type": "integer"
+              }
+            ]
+          },
+          {
+            "name": "CSV",
+            "arguments": [
+              {
+                "command": "FIELDS",
+                "name": "names",
+                "type": "string",
+                "optional": true
+              },
+              {
+                "command": "WKT",
+                "name": [],
+                "type": [],
+                "optional": true
+              },
+              {
+                "command": "NOHEADER",
+                "name": [],
+                "type": [],
+                "optional": true
               }
             ]
           }
@@ -1135,6 +2303,16 @@ var commandsJSON = `{
                 "type": "geohash"
               }
             ]
+          },
+          {
+            "name": "GEOHASH",
+            "arguments": [
+              {
+                "name": "geohash",
+                "type": "geohash",
+                "multiple": true
+              }
+            ]
           },          
           {
             "name": "SECTOR",
@@ -1193,6 +2371,13 @@ var commandsJSON = `{
         "type": "pattern",
         "optional": true
       },
+      {
+        "command": "MATCH RE",
+        "name": "regexp",
+        "type": "string",
+        "optional": true,
+        "multiple": true
+      },
       {
         "command": "WHERE",
         "name": ["field", "min", "max"],
@@ -1200,6 +2385,13 @@ var commandsJSON = `{
         "optional": true,
         "multiple": true
       },
+      {
+        "command": "WHEREJSON",
+        "name": ["path", "op", "value"],
+        "type": ["string", "string", "string"],
+        "optional": true,
+        "multiple": true
+      },
       {
         "command": "WHEREIN",
         "name": ["field", "count", "value"],
@@ -1208,6 +2400,12 @@ var commandsJSON = `{
         "multiple": true,
         "variadic": true
       },
+      {
+        "command": "JOIN",
+        "name": ["key", "ON", "field", "FIELDS", "names"],
+        "type": ["string", "string", "string", "string", "string"],
+        "optional": true
+      },
       {
         "command": "WHEREEVAL",
         "name": ["script", "numargs", "arg"],
@@ -1224,18 +2422,72 @@ var commandsJSON = `{
         "multiple": true,
         "variadic": true
       },
+      {
+        "command": "DELTA",
+        "name": "token",
+        "type": "string",
+        "optional": true
+      },
+      {
+        "command": "ASOF",
+        "name": "timestamp",
+        "type": "double",
+        "optional": true
+      },
+      {
+        "command": "BUFFER",
+        "name": "meters",
+        "type": "double",
+        "optional": true
+      },
       {
         "command": "CLIP",
         "name": [],
         "type": [],
         "optional": true
       },
+      {
+        "command": "TTLBETWEEN",
+        "name": ["min", "max"],
+        "type": ["double", "double"],
+        "optional": true
+      },
+      {
+        "command": "SIMPLIFY",
+        "name": ["tolerance"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "command": "METERS",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "WITHETAG",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "IFNONEMATCH",
+        "name": "etag",
+        "type": "string",
+        "optional": true
+      },
       {
         "command": "NOFIELDS",
         "name": [],
         "type": [],
         "optional": true
       },
+      {
+        "command": "STRICT",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
       {
         "command": "FENCE",
         "name": [],
@@ -1248,12 +2500,30 @@ var commandsJSON = `{
         "type": ["string"],
         "optional": true
       },
+      {
+        "command": "DWELL",
+        "name": ["seconds"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "command": "NODWELL",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
       {
         "command": "COMMANDS",
         "name": ["which"],
         "type": ["string"],
         "optional": true
       },
+      {
+        "command": "ARM",
+        "name": ["key", "id"],
+        "type": ["string", "string"],
+        "optional": true
+      },
       {
         "name": "type",
         "optional": true,
@@ -1261,6 +2531,15 @@ var commandsJSON = `{
           {
             "name": "COUNT"
           },
+          {
+            "name": "NDISTINCT",
+            "arguments": [
+              {
+                "name": "field",
+                "type": "string"
+              }
+            ]
+          },
           {
             "name": "IDS"
           },
@@ -1273,12 +2552,75 @@ var commandsJSON = `{
           {
             "name": "BOUNDS"
           },
+          {
+            "name": "WKT"
+          },
+          {
+            "name": "WKB"
+          },
           {
             "name": "HASHES",
             "arguments": [
               {
                 "name": "precision",
                 "type": "integer"
+              },
+              {
+                "command": "COVER",
+                "name": [],
+                "type": [],
+                "optional": true
+              }
+            ]
+          },
+          {
+            "name": "FEATURES",
+            "arguments": [
+              {
+                "command": "INDEX",
+                "name": "grid",
+                "type": "integer",
+                "optional": true
+              }
+            ]
+          },
+          {
+            "name": "MVT",
+            "arguments": [
+              {
+                "name": "z",
+                "type": "integer"
+              },
+              {
+                "name": "x",
+                "type": "integer"
+              },
+              {
+                "name": "y",
+                "type": "integer"
+              }
+            ]
+          },
+          {
+            "name": "CSV",
+            "arguments": [
+              {
+                "command": "FIELDS",
+                "name": "names",
+                "type": "string",
+                "optional": true
+              },
+              {
+                "command": "WKT",
+                "name": [],
+                "type": [],
+                "optional": true
+              },
+              {
+                "command": "NOHEADER",
+                "name": [],
+                "type": [],
+                "optional": true
               }
             ]
           }
@@ -1382,6 +2724,16 @@ var commandsJSON = `{
               }
             ]
           },
+          {
+            "name": "GEOHASH",
+            "arguments": [
+              {
+                "name": "geohash",
+                "type": "geohash",
+                "multiple": true
+              }
+            ]
+          },
           {
             "name": "SECTOR",
             "arguments": [
@@ -1413,6 +2765,19 @@ var commandsJSON = `{
     "since": "1.0.0",
     "group": "search"
   },
+  "LOGSUBSCRIBE": {
+    "summary": "Streams the server log entries at or above a level",
+    "arguments": [
+      {
+        "name": "level",
+        "type": "string",
+        "enum": ["DEBUG", "INFO", "WARN", "ERROR"],
+        "optional": true
+      }
+    ],
+    "since": "1.34.0",
+    "group": "server"
+  },
   "CONFIG GET": {
     "summary": "Get the value of a configuration parameter",
     "arguments": [
@@ -1450,6 +2815,13 @@ var commandsJSON = `{
     "since": "1.0.0",
     "group": "server"
   },
+  "CAPABILITIES": {
+    "summary": "Lists the features that the server supports",
+    "complexity": "O(1)",
+    "arguments": [],
+    "since": "1.34.0",
+    "group": "server"
+  },
   "GC": {
     "summary": "Forces a garbage collection",
     "complexity": "O(1)",
@@ -1457,16 +2829,83 @@ var commandsJSON = `{
     "since": "1.0.0",
     "group": "server"
   },
-  "READONLY": {
-    "summary": "Turns on or off readonly mode",
-    "complexity": "O(1)",
+  "FENCETEST": {
+    "summary": "Returns the geofence notifications that a hypothetical move of an object would produce",
+    "complexity": "O(N) where N is the number of geofences for the key",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "name": "id",
+        "type": "string"
+      },
+      {
+        "command": "FROM",
+        "name": ["area"],
+        "type": ["string"]
+      },
+      {
+        "command": "TO",
+        "name": ["area"],
+        "type": ["string"]
+      }
+    ],
+    "since": "1.34.0",
+    "group": "tests"
+  },
+  "NODESTATUS": {
+    "summary": "Returns the role, replication lag, and load of the server",
+    "complexity": "O(1)",
+    "arguments": [],
+    "since": "1.34.0",
+    "group": "replication"
+  },
+  "READONLY": {
+    "summary": "Turns on or off readonly mode",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "enum": ["yes", "no"]
+      }
+    ],
+    "since": "1.0.0",
+    "group": "server"
+  },
+  "PROMOTE": {
+    "summary": "Stops following and promotes a follower to leader",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "command": "FORCE",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "KEEPID",
+        "name": [],
+        "type": [],
+        "optional": true
+      }
+    ],
+    "since": "1.34.0",
+    "group": "replication"
+  },
+  "RESYNC": {
+    "summary": "Discards the local dataset of a follower and replicates it again from the leader",
+    "complexity": "O(N) where N is the number of objects in the database",
     "arguments": [
       {
-        "enum": ["yes", "no"]
+        "command": "CONFIRM",
+        "name": [],
+        "type": [],
+        "optional": true
       }
     ],
-    "since": "1.0.0",
-    "group": "server"
+    "since": "1.34.0",
+    "group": "replication"
   },
   "FLUSHDB": {
     "summary": "Removes all keys",
@@ -1475,6 +2914,13 @@ var commandsJSON = `{
     "since": "1.0.0",
     "group": "server"
   },
+  "FOLLOWERS": {
+    "summary": "Lists the followers that are connected to the leader",
+    "complexity": "O(N) where N is the number of connected followers",
+    "arguments": [],
+    "since": "1.34.0",
+    "group": "replication"
+  },
   "FOLLOW": {
     "summary": "Follows a leader host",
     "complexity": "O(1)",
@@ -1486,6 +2932,24 @@ var commandsJSON = `{
       {
         "name": "port",
         "type": "integer"
+      },
+      {
+        "command": "PREFIX",
+        "name": ["prefix"],
+        "type": ["string"],
+        "optional": true
+      },
+      {
+        "name": ["host", "port", "PREFIX", "prefix"],
+        "type": ["string", "integer", "string", "string"],
+        "optional": true,
+        "multiple": true
+      },
+      {
+        "command": "TLS",
+        "name": [],
+        "type": [],
+        "optional": true
       }
     ],
     "since": "1.0.0",
@@ -1519,6 +2983,22 @@ var commandsJSON = `{
     "since": "1.0.0",
     "group": "replication"
   },
+  "AOFRANGE": {
+    "summary": "Returns the commands in a portion of the aof",
+    "complexity": "O(N) where N is the size of the range",
+    "arguments": [
+      {
+        "name": "start",
+        "type": "integer"
+      },
+      {
+        "name": "end",
+        "type": "integer"
+      }
+    ],
+    "since": "1.34.0",
+    "group": "replication"
+  },
   "AOFSHRINK": {
     "summary": "Shrinks the aof in the background",
     "group": "replication"
@@ -1541,6 +3021,30 @@ var commandsJSON = `{
     ],
     "group": "connection"
   },
+  "RESTRICT": {
+    "summary": "Limits the commands that the current connection may issue",
+    "complexity": "O(N) where N is the number of commands",
+    "arguments": [
+      {
+        "name": "command",
+        "type": "string",
+        "multiple": true
+      }
+    ],
+    "since": "1.34.0",
+    "group": "connection"
+  },
+  "WITHVERSION": {
+    "summary": "Adds the version of the data that a read saw to the read responses of the current connection",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "enum": ["yes", "no"]
+      }
+    ],
+    "since": "1.34.0",
+    "group": "connection"
+  },
   "OUTPUT": {
     "summary": "Gets or sets the output format for the current connection.",
     "arguments": [
@@ -1604,6 +3108,11 @@ var commandsJSON = `{
         "optional": true,
         "multiple": false
       },
+      {
+        "command": "FORMAT",
+        "enum": ["JSON", "DEBEZIUM"],
+        "optional": true
+      },
       {
         "enum": ["NEARBY", "WITHIN", "INTERSECTS"]
       },
@@ -1622,12 +3131,42 @@ var commandsJSON = `{
         "type": ["string"],
         "optional": true
       },
+      {
+        "command": "DWELL",
+        "name": ["seconds"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "command": "NODWELL",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
       {
         "command": "COMMANDS",
         "name": ["which"],
         "type": ["string"],
         "optional": true
       },
+      {
+        "command": "ARM",
+        "name": ["key", "id"],
+        "type": ["string", "string"],
+        "optional": true
+      },
+      {
+        "command": "POPULATION",
+        "name": ["seconds"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "command": "THRESHOLDS",
+        "name": ["counts"],
+        "type": ["string"],
+        "optional": true
+      },
       {
         "name": "param",
         "type": "string",
@@ -1656,6 +3195,99 @@ var commandsJSON = `{
     ],
     "group": "webhook"
   },
+  "HOOKVALIDATE": {
+    "summary": "Validates a webhook definition without creating it",
+    "arguments": [
+      {
+        "name": "name",
+        "type": "string"
+      },
+      {
+        "name": "endpoint",
+        "type": "string"
+      },
+      {
+        "command": "META",
+        "name": ["name", "value"],
+        "type": ["string", "string"],
+        "optional": true,
+        "multiple": true
+      },
+      {
+        "command": "EX",
+        "name": ["seconds"],
+        "type": ["double"],
+        "optional": true,
+        "multiple": false
+      },
+      {
+        "command": "FORMAT",
+        "enum": ["JSON", "DEBEZIUM"],
+        "optional": true
+      },
+      {
+        "enum": ["NEARBY", "WITHIN", "INTERSECTS"]
+      },
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "command": "FENCE",
+        "name": [],
+        "type": []
+      },
+      {
+        "command": "DETECT",
+        "name": ["what"],
+        "type": ["string"],
+        "optional": true
+      },
+      {
+        "command": "DWELL",
+        "name": ["seconds"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "command": "NODWELL",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "command": "COMMANDS",
+        "name": ["which"],
+        "type": ["string"],
+        "optional": true
+      },
+      {
+        "command": "ARM",
+        "name": ["key", "id"],
+        "type": ["string", "string"],
+        "optional": true
+      },
+      {
+        "command": "POPULATION",
+        "name": ["seconds"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "command": "THRESHOLDS",
+        "name": ["counts"],
+        "type": ["string"],
+        "optional": true
+      },
+      {
+        "name": "param",
+        "type": "string",
+        "variadic": true
+      }
+    ],
+    "since": "1.34.0",
+    "group": "webhook"
+  },
   "PDELHOOK": {
     "summary": "Removes all hooks matching a pattern",
     "arguments": [
@@ -1688,6 +3320,11 @@ var commandsJSON = `{
         "optional": true,
         "multiple": false
       },
+      {
+        "command": "FORMAT",
+        "enum": ["JSON", "DEBEZIUM"],
+        "optional": true
+      },
       {
         "enum": ["NEARBY", "WITHIN", "INTERSECTS"]
       },
@@ -1706,12 +3343,42 @@ var commandsJSON = `{
         "type": ["string"],
         "optional": true
       },
+      {
+        "command": "DWELL",
+        "name": ["seconds"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "command": "NODWELL",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
       {
         "command": "COMMANDS",
         "name": ["which"],
         "type": ["string"],
         "optional": true
       },
+      {
+        "command": "ARM",
+        "name": ["key", "id"],
+        "type": ["string", "string"],
+        "optional": true
+      },
+      {
+        "command": "POPULATION",
+        "name": ["seconds"],
+        "type": ["double"],
+        "optional": true
+      },
+      {
+        "command": "THRESHOLDS",
+        "name": ["counts"],
+        "type": ["string"],
+        "optional": true
+      },
       {
         "name": "param",
         "type": "string",
@@ -1772,6 +3439,68 @@ var commandsJSON = `{
     ],
     "group": "pubsub"
   },
+  "PUBSUB CHANNELS": {
+    "summary": "Lists the channels that have subscribers",
+    "complexity": "O(N) where N is the number of active channels",
+    "arguments": [
+      {
+        "name": "pattern",
+        "type": "pattern",
+        "optional": true
+      }
+    ],
+    "since": "1.34.0",
+    "group": "pubsub"
+  },
+  "PUBSUB NUMSUB": {
+    "summary": "Returns the number of subscribers for channels",
+    "complexity": "O(N) where N is the number of requested channels",
+    "arguments": [
+      {
+        "name": "channel",
+        "type": "string",
+        "optional": true,
+        "multiple": true
+      }
+    ],
+    "since": "1.34.0",
+    "group": "pubsub"
+  },
+  "PUBSUB NUMPAT": {
+    "summary": "Returns the number of subscribed patterns",
+    "complexity": "O(1)",
+    "arguments": [],
+    "since": "1.34.0",
+    "group": "pubsub"
+  },
+  "MSET": {
+    "summary": "Sets the value of many point objects of a key",
+    "complexity": "O(N) where N is the number of objects being set",
+    "arguments": [
+      {
+        "name": "key",
+        "type": "string"
+      },
+      {
+        "command": "SKIPINVALID",
+        "name": [],
+        "type": [],
+        "optional": true
+      },
+      {
+        "name": ["id", "POINT", "lat", "lon"],
+        "type": ["string", "string", "double", "double"]
+      },
+      {
+        "name": ["id", "POINT", "lat", "lon"],
+        "type": ["string", "string", "double", "double"],
+        "multiple": true,
+        "optional": true
+      }
+    ],
+    "since": "1.34.0",
+    "group": "keys"
+  },
   "PDEL": {
     "summary": "Removes all objects matching a pattern",
     "arguments": [
@@ -2064,6 +3793,40 @@ var commandsJSON = `{
     "since": "1.10.0",
     "group": "scripting"
   },
+  "COMMANDREGISTER": {
+    "summary": "Registers a Lua script as a named server command",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "name": "name",
+        "type": "string"
+      },
+      {
+        "name": "script",
+        "type": "string"
+      },
+      {
+        "command": "READONLY",
+        "name": [],
+        "type": [],
+        "optional": true
+      }
+    ],
+    "since": "1.34.0",
+    "group": "scripting"
+  },
+  "COMMANDUNREGISTER": {
+    "summary": "Removes a command that was registered with COMMANDREGISTER",
+    "complexity": "O(1)",
+    "arguments": [
+      {
+        "name": "name",
+        "type": "string"
+      }
+    ],
+    "since": "1.34.0",
+    "group": "scripting"
+  },
   "TEST": {
     "summary": "Performs spatial test",
     "complexity": "One test per command, complexity depends on the test",
@@ -0,0 +1,485 @@
+// Package aoffile provides the append-only file for storing commands.
+//
+// A file is either plain, where the commands are stored as is, or compressed,
+// where the commands are stored as a sequence of independently compressed
+// zstd blocks. Writes to a compressed file are buffered until there is enough
+// data for a block, or until they are flushed, see FlushStale. All sizes and positions are
+// logical, that is they are offsets into the uncompressed data, which allows
+// for a compressed file to be used for replication without any changes to the
+// followers.
+package aoffile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// magic is the first eight bytes of a compressed file. A plain file always
+// starts with a RESP array.
+var magic = []byte("T38AOFZ\x01")
+
+// headerSize is the size of the block header, which holds the uncompressed
+// size, compressed size, and the crc32 of the compressed data.
+const headerSize = 12
+
+// blockSize is the amount of buffered data that is written as a block
+// without waiting for a sync.
+const blockSize = 256 * 1024
+
+// minBlockSize is the amount of buffered data that FlushStale writes as a
+// block, no matter how long it has been waiting.
+const minBlockSize = 4 * 1024
+
+var errCorruptedBlock = errors.New("corrupted aof block")
+
+var (
+	encoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	decoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+)
+
+type block struct {
+	off   int64 // logical offset of the first byte
+	foff  int64 // file offset of the block header
+	size  int   // uncompressed size
+	csize int   // compressed size
+}
+
+// File is an append-only file.
+type File struct {
+	mu         sync.RWMutex
+	f          *os.File
+	compressed bool
+	size       int64     // logical size
+	fsize      int64     // file size
+	blocks     []block   // compressed blocks, ordered by offset
+	pending    []byte    // buffered data for the next block
+	pendingAt  time.Time // when the oldest buffered data was written
+	buf        []byte    // write buffer
+	cache      []byte    // last block read by ReadAt
+	cacheIdx   int       // index of the cached block, or -1
+}
+
+// Open opens the named file for appending, creating it if it does not exist.
+// A new file is compressed when compress is true, otherwise an existing file
+// keeps its format. Incomplete blocks at the end of a compressed file, left
+// behind by a crash, are discarded.
+func Open(name string, compress bool) (*File, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	file, err := open(f, compress)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// Create creates the named file, truncating it if it already exists.
+func Create(name string, compress bool) (*File, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := open(f, compress)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+func open(f *os.File, compress bool) (*File, error) {
+	file := &File{f: f, cacheIdx: -1}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	file.fsize = fi.Size()
+	if file.fsize == 0 {
+		if compress {
+			if _, err := f.Write(magic); err != nil {
+				return nil, err
+			}
+			file.compressed = true
+			file.fsize = int64(len(magic))
+		}
+		return file, nil
+	}
+	head := make([]byte, len(magic))
+	if n, _ := f.ReadAt(head, 0); n == len(head) && bytes.Equal(head, magic) {
+		file.compressed = true
+		if err := file.scan(); err != nil {
+			return nil, err
+		}
+	} else {
+		file.size = file.fsize
+	}
+	if _, err := f.Seek(file.fsize, 0); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// scan loads the block index of a compressed file.
+func (file *File) scan() error {
+	foff := int64(len(magic))
+	var off int64
+	var hdr [headerSize]byte
+	for foff < file.fsize {
+		var b block
+		if _, err := file.f.ReadAt(hdr[:], foff); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		b.off, b.foff = off, foff
+		b.size = int(binary.LittleEndian.Uint32(hdr[0:]))
+		b.csize = int(binary.LittleEndian.Uint32(hdr[4:]))
+		if foff+headerSize+int64(b.csize) > file.fsize {
+			break
+		}
+		data := make([]byte, b.csize)
+		if _, err := file.f.ReadAt(data, foff+headerSize); err != nil {
+			return err
+		}
+		if crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(hdr[8:]) {
+			break
+		}
+		file.blocks = append(file.blocks, b)
+		foff += headerSize + int64(b.csize)
+		off += int64(b.size)
+	}
+	if foff < file.fsize {
+		if err := file.f.Truncate(foff); err != nil {
+			return err
+		}
+		file.fsize = foff
+	}
+	file.size = off
+	return nil
+}
+
+// Name returns the name of the file.
+func (file *File) Name() string {
+	return file.f.Name()
+}
+
+// Compressed returns true if the file is compressed.
+func (file *File) Compressed() bool {
+	return file.compressed
+}
+
+// Size returns the logical size of the file, including buffered data.
+func (file *File) Size() int64 {
+	file.mu.RLock()
+	defer file.mu.RUnlock()
+	return file.size
+}
+
+// Buffered returns the number of bytes that have been written to a
+// compressed file, but are waiting for a block.
+func (file *File) Buffered() int {
+	file.mu.RLock()
+	defer file.mu.RUnlock()
+	return len(file.pending)
+}
+
+// Write appends data to the end of the file.
+func (file *File) Write(p []byte) (int, error) {
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	if !file.compressed {
+		n, err := file.f.Write(p)
+		file.size += int64(n)
+		file.fsize += int64(n)
+		return n, err
+	}
+	if len(file.pending) == 0 {
+		file.pendingAt = time.Now()
+	}
+	file.pending = append(file.pending, p...)
+	file.size += int64(len(p))
+	if len(file.pending) >= blockSize {
+		if err := file.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes the buffered data to the file.
+func (file *File) Flush() error {
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	return file.flush()
+}
+
+// FlushStale writes the buffered data of a compressed file as a block when
+// there is at least a small block of it, or when it has been waiting for the
+// age. Returns true when a block was written.
+func (file *File) FlushStale(age time.Duration) (bool, error) {
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	if len(file.pending) == 0 || (len(file.pending) < minBlockSize &&
+		time.Since(file.pendingAt) < age) {
+		return false, nil
+	}
+	return true, file.flush()
+}
+
+func (file *File) flush() error {
+	if len(file.pending) == 0 {
+		return nil
+	}
+	buf := append(file.buf[:0], make([]byte, headerSize)...)
+	buf = encoder.EncodeAll(file.pending, buf)
+	binary.LittleEndian.PutUint32(buf[0:], uint32(len(file.pending)))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(buf)-headerSize))
+	binary.LittleEndian.PutUint32(buf[8:],
+		crc32.ChecksumIEEE(buf[headerSize:]))
+	if _, err := file.f.Write(buf); err != nil {
+		return err
+	}
+	file.blocks = append(file.blocks, block{
+		off:   file.size - int64(len(file.pending)),
+		foff:  file.fsize,
+		size:  len(file.pending),
+		csize: len(buf) - headerSize,
+	})
+	file.fsize += int64(len(buf))
+	if cap(buf) <= blockSize*2 {
+		file.buf = buf
+	}
+	if cap(file.pending) <= blockSize*2 {
+		file.pending = file.pending[:0]
+	} else {
+		file.pending = nil
+	}
+	return nil
+}
+
+// Sync writes the buffered data and commits the contents of the file to
+// stable storage.
+func (file *File) Sync() error {
+	if err := file.Flush(); err != nil {
+		return err
+	}
+	return file.f.Sync()
+}
+
+// Close writes the buffered data and closes the file.
+func (file *File) Close() error {
+	if err := file.Flush(); err != nil {
+		file.f.Close()
+		return err
+	}
+	return file.f.Close()
+}
+
+// findBlock returns the index of the block that holds the byte at the
+// logical offset, or the number of blocks when the offset is at the end.
+func (file *File) findBlock(off int64) int {
+	return sort.Search(len(file.blocks), func(i int) bool {
+		return file.blocks[i].off+int64(file.blocks[i].size) > off
+	})
+}
+
+// Truncate changes the logical size of the file.
+func (file *File) Truncate(size int64) error {
+	file.mu.Lock()
+	if !file.compressed {
+		defer file.mu.Unlock()
+		if err := file.f.Truncate(size); err != nil {
+			return err
+		}
+		if _, err := file.f.Seek(size, 0); err != nil {
+			return err
+		}
+		file.size, file.fsize = size, size
+		return nil
+	}
+	if size >= file.size {
+		file.mu.Unlock()
+		return nil
+	}
+	if err := file.flush(); err != nil {
+		file.mu.Unlock()
+		return err
+	}
+	i := file.findBlock(size)
+	b := file.blocks[i]
+	var keep []byte
+	if size > b.off {
+		data, err := file.readBlock(b)
+		if err != nil {
+			file.mu.Unlock()
+			return err
+		}
+		keep = data[:size-b.off]
+	}
+	file.blocks = file.blocks[:i]
+	file.cacheIdx = -1
+	file.size, file.fsize = b.off, b.foff
+	err := file.f.Truncate(b.foff)
+	if err == nil {
+		_, err = file.f.Seek(b.foff, 0)
+	}
+	file.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	// rewrite the head of the partial block
+	_, err = file.Write(keep)
+	return err
+}
+
+// readBlock reads and decompresses a block.
+func (file *File) readBlock(b block) ([]byte, error) {
+	return readBlock(file.f, b.foff, b.size, b.csize)
+}
+
+func readBlock(f io.ReaderAt, foff int64, size, csize int) ([]byte, error) {
+	data := make([]byte, headerSize+csize)
+	if _, err := f.ReadAt(data, foff); err != nil {
+		return nil, err
+	}
+	crc := binary.LittleEndian.Uint32(data[8:])
+	data = data[headerSize:]
+	if crc32.ChecksumIEEE(data) != crc {
+		return nil, errCorruptedBlock
+	}
+	data, err := decoder.DecodeAll(data, make([]byte, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != size {
+		return nil, errCorruptedBlock
+	}
+	return data, nil
+}
+
+// ReadAt reads len(p) bytes from the logical offset. Buffered data is written
+// first.
+func (file *File) ReadAt(p []byte, off int64) (int, error) {
+	if !file.compressed {
+		return file.f.ReadAt(p, off)
+	}
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	if err := file.flush(); err != nil {
+		return 0, err
+	}
+	var n int
+	for n < len(p) {
+		if off >= file.size {
+			return n, io.EOF
+		}
+		i := file.findBlock(off)
+		if file.cacheIdx != i {
+			data, err := file.readBlock(file.blocks[i])
+			if err != nil {
+				return n, err
+			}
+			file.cache, file.cacheIdx = data, i
+		}
+		m := copy(p[n:], file.cache[off-file.blocks[i].off:])
+		n += m
+		off += int64(m)
+	}
+	return n, nil
+}
+
+// Reader reads a file from a logical position. The reader uses its own file
+// handle and sees data that is appended to the file after it was opened.
+type Reader struct {
+	f          *os.File
+	compressed bool
+	foff       int64  // file offset of the next block
+	skip       int64  // bytes to skip in the next block
+	buf        []byte // unread data from the last block
+}
+
+// NewReader returns a reader that starts at the logical position. Buffered
+// data is written first, so that the reader sees all of the data.
+func (file *File) NewReader(pos int64) (*Reader, error) {
+	f, err := os.Open(file.f.Name())
+	if err != nil {
+		return nil, err
+	}
+	rd := &Reader{f: f, compressed: file.compressed}
+	if !file.compressed {
+		if _, err := f.Seek(pos, 0); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return rd, nil
+	}
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	if err := file.flush(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if i := file.findBlock(pos); i < len(file.blocks) {
+		rd.foff = file.blocks[i].foff
+		rd.skip = pos - file.blocks[i].off
+	} else {
+		rd.foff = file.fsize
+		rd.skip = pos - file.size
+	}
+	return rd, nil
+}
+
+// Read reads the next data from the file. It returns io.EOF when there is no
+// more data, but data that is appended later can still be read.
+func (rd *Reader) Read(p []byte) (int, error) {
+	if !rd.compressed {
+		return rd.f.Read(p)
+	}
+	for len(rd.buf) == 0 {
+		var hdr [headerSize]byte
+		if n, err := rd.f.ReadAt(hdr[:], rd.foff); n < headerSize {
+			if err == nil || err == io.EOF {
+				err = io.EOF
+			}
+			return 0, err
+		}
+		size := int(binary.LittleEndian.Uint32(hdr[0:]))
+		csize := int(binary.LittleEndian.Uint32(hdr[4:]))
+		data, err := readBlock(rd.f, rd.foff, size, csize)
+		if err != nil {
+			if err == io.EOF {
+				// the block is still being written
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		rd.foff += headerSize + int64(csize)
+		if rd.skip >= int64(len(data)) {
+			rd.skip -= int64(len(data))
+			continue
+		}
+		rd.buf = data[rd.skip:]
+		rd.skip = 0
+	}
+	n := copy(p, rd.buf)
+	rd.buf = rd.buf[n:]
+	return n, nil
+}
+
+// Close closes the reader.
+func (rd *Reader) Close() error {
+	return rd.f.Close()
+}
@@ -0,0 +1,203 @@
+package aoffile
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func testData(n int) []byte {
+	var data []byte
+	for i := 0; i < n; i++ {
+		data = append(data, "*3\r\n$3\r\nset\r\n$5\r\nfleet\r\n$"...)
+		id := "truck" + strconv.Itoa(i)
+		data = append(data, strconv.Itoa(len(id))...)
+		data = append(data, "\r\n"+id+"\r\n"...)
+	}
+	return data
+}
+
+func readAll(t *testing.T, file *File, pos int64) []byte {
+	t.Helper()
+	rd, err := file.NewReader(pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestFile(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run("compress="+strconv.FormatBool(compress), func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "appendonly.aof")
+			file, err := Open(name, compress)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := testData(1000)
+			for i := 0; i < len(data); i += 1000 {
+				end := i + 1000
+				if end > len(data) {
+					end = len(data)
+				}
+				if _, err := file.Write(data[i:end]); err != nil {
+					t.Fatal(err)
+				}
+				if i%3000 == 0 {
+					// write a few smaller blocks
+					if err := file.Flush(); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if file.Compressed() != compress {
+				t.Fatalf("expected %t, got %t", compress, file.Compressed())
+			}
+			if file.Size() != int64(len(data)) {
+				t.Fatalf("expected %d, got %d", len(data), file.Size())
+			}
+			if got := readAll(t, file, 0); !bytes.Equal(got, data) {
+				t.Fatal("data mismatch")
+			}
+			if got := readAll(t, file, 12345); !bytes.Equal(got, data[12345:]) {
+				t.Fatal("data mismatch")
+			}
+			p := make([]byte, 100)
+			if _, err := file.ReadAt(p, 2990); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(p, data[2990:3090]) {
+				t.Fatal("data mismatch")
+			}
+			if err := file.Truncate(2500); err != nil {
+				t.Fatal(err)
+			}
+			data = data[:2500]
+			if file.Size() != 2500 {
+				t.Fatalf("expected 2500, got %d", file.Size())
+			}
+			if _, err := file.Write([]byte("*1\r\n$4\r\nping\r\n")); err != nil {
+				t.Fatal(err)
+			}
+			data = append(data, "*1\r\n$4\r\nping\r\n"...)
+			if err := file.Close(); err != nil {
+				t.Fatal(err)
+			}
+			fi, err := os.Stat(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if compress && fi.Size() >= int64(len(data)) {
+				t.Fatalf("expected compressed file, got %d bytes", fi.Size())
+			}
+
+			// the format of an existing file is kept
+			file, err = Open(name, !compress)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			if file.Compressed() != compress {
+				t.Fatalf("expected %t, got %t", compress, file.Compressed())
+			}
+			if got := readAll(t, file, 0); !bytes.Equal(got, data) {
+				t.Fatal("data mismatch")
+			}
+		})
+	}
+}
+
+func TestReaderFollowsWrites(t *testing.T) {
+	file, err := Open(filepath.Join(t.TempDir(), "appendonly.aof"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rd, err := file.NewReader(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+	buf := make([]byte, 64)
+	if _, err := rd.Read(buf); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+	if _, err := file.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rd.Read(buf); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	n, err := rd.Read(buf)
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Fatalf("expected 'hello', got '%s' %v", buf[:n], err)
+	}
+}
+
+func TestFlushStale(t *testing.T) {
+	file, err := Open(filepath.Join(t.TempDir(), "appendonly.aof"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	// a small write waits for the age
+	if flushed, err := file.FlushStale(time.Hour); err != nil || flushed {
+		t.Fatalf("expected no flush, got %v %v", flushed, err)
+	}
+	time.Sleep(time.Millisecond * 10)
+	if flushed, err := file.FlushStale(time.Millisecond); err != nil || !flushed {
+		t.Fatalf("expected a flush, got %v %v", flushed, err)
+	}
+	if file.Buffered() != 0 {
+		t.Fatalf("expected nothing buffered, got %d", file.Buffered())
+	}
+	// a small block is written right away
+	if _, err := file.Write(testData(200)); err != nil {
+		t.Fatal(err)
+	}
+	if flushed, err := file.FlushStale(time.Hour); err != nil || !flushed {
+		t.Fatalf("expected a flush, got %v %v", flushed, err)
+	}
+	if data := readAll(t, file, 5); !bytes.Equal(data, testData(200)) {
+		t.Fatal("data mismatch")
+	}
+}
+
+func TestTornBlock(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "appendonly.aof")
+	file, err := Open(name, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("hello"))
+	file.Flush()
+	file.Write([]byte("world"))
+	file.Close()
+	fi, _ := os.Stat(name)
+	if err := os.Truncate(name, fi.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+	file, err = Open(name, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if got := readAll(t, file, 0); string(got) != "hello" {
+		t.Fatalf("expected 'hello', got '%s'", got)
+	}
+}
@@ -13,41 +13,52 @@ import (
 // TODO: detect of pole and antimeridian crossing and generate
 // valid multigeometries
 
-const bufferSteps = 15
+// DefaultSteps is the number of segments of the circle around a point.
+const DefaultSteps = 15
 
 // Simple performs a very simple buffer operation on a geojson object.
 func Simple(g geojson.Object, meters float64) (geojson.Object, error) {
+	return SimpleSteps(g, meters, DefaultSteps)
+}
+
+// SimpleSteps is like Simple, but the circle around each point is
+// approximated with the provided number of segments.
+func SimpleSteps(g geojson.Object, meters float64, steps int,
+) (geojson.Object, error) {
 	if meters <= 0 {
 		return g, nil
 	}
 	if math.IsInf(meters, 0) || math.IsNaN(meters) {
 		return g, errors.New("invalid meters")
 	}
+	if steps < 3 {
+		return g, errors.New("invalid steps")
+	}
 	switch g := g.(type) {
 	case *geojson.Point:
-		return bufferSimplePoint(g.Base(), meters), nil
+		return bufferSimplePoint(g.Base(), meters, steps), nil
 	case *geojson.SimplePoint:
-		return bufferSimplePoint(g.Base(), meters), nil
+		return bufferSimplePoint(g.Base(), meters, steps), nil
 	case *geojson.MultiPoint:
-		return bufferSimpleGeometries(g.Base(), meters)
+		return bufferSimpleGeometries(g.Base(), meters, steps)
 	case *geojson.LineString:
-		return bufferSimpleLineString(g, meters)
+		return bufferSimpleLineString(g, meters, steps)
 	case *geojson.MultiLineString:
-		return bufferSimpleGeometries(g.Base(), meters)
+		return bufferSimpleGeometries(g.Base(), meters, steps)
 	case *geojson.Polygon:
-		return bufferSimplePolygon(g, meters)
+		return bufferSimplePolygon(g, meters, steps)
 	case *geojson.MultiPolygon:
-		return bufferSimpleGeometries(g.Base(), meters)
+		return bufferSimpleGeometries(g.Base(), meters, steps)
 	case *geojson.FeatureCollection:
-		return bufferSimpleFeatures(g.Base(), meters)
+		return bufferSimpleFeatures(g.Base(), meters, steps)
 	case *geojson.Feature:
-		bg, err := Simple(g.Base(), meters)
+		bg, err := SimpleSteps(g.Base(), meters, steps)
 		if err != nil {
 			return nil, err
 		}
 		return geojson.NewFeature(bg, g.Members()), nil
 	case *geojson.Circle:
-		return Simple(g.Polygon(), meters)
+		return SimpleSteps(g.Polygon(), meters, steps)
 	case nil:
 		return nil, errors.New("cannot buffer nil object")
 	default:
@@ -56,9 +67,10 @@ func Simple(g geojson.Object, meters float64) (geojson.Object, error) {
 	}
 }
 
-func bufferSimplePoint(p geometry.Point, meters float64) *geojson.Polygon {
+func bufferSimplePoint(p geometry.Point, meters float64, steps int,
+) *geojson.Polygon {
 	meters = geo.NormalizeDistance(meters)
-	points := make([]geometry.Point, 0, bufferSteps+1)
+	points := make([]geometry.Point, 0, steps+1)
 
 	// calc the four corners
 	maxY, _ := geo.DestinationPoint(p.Y, p.X, meters, 0)
@@ -71,7 +83,7 @@ func bufferSimplePoint(p geometry.Point, meters float64) *geojson.Polygon {
 	lats := (maxY - minY) / 2
 
 	// generate the circle polygon
-	for th := 0.0; th <= 360.0; th += 360.0 / float64(bufferSteps) {
+	for th := 0.0; th <= 360.0; th += 360.0 / float64(steps) {
 		radians := (math.Pi / 180) * th
 		x := p.X + lons*math.Cos(radians)
 		y := p.Y + lats*math.Sin(radians)
@@ -88,10 +100,11 @@ func bufferSimplePoint(p geometry.Point, meters float64) *geojson.Polygon {
 }
 
 func bufferSimpleGeometries(objs []geojson.Object, meters float64,
+	steps int,
 ) (*geojson.GeometryCollection, error) {
 	geoms := make([]geojson.Object, len(objs))
 	for i := 0; i < len(objs); i++ {
-		g, err := Simple(objs[i], meters)
+		g, err := SimpleSteps(objs[i], meters, steps)
 		if err != nil {
 			return nil, err
 		}
@@ -101,10 +114,11 @@ func bufferSimpleGeometries(objs []geojson.Object, meters float64,
 }
 
 func bufferSimpleFeatures(objs []geojson.Object, meters float64,
+	steps int,
 ) (*geojson.FeatureCollection, error) {
 	geoms := make([]geojson.Object, len(objs))
 	for i := 0; i < len(objs); i++ {
-		g, err := Simple(objs[i], meters)
+		g, err := SimpleSteps(objs[i], meters, steps)
 		if err != nil {
 			return nil, err
 		}
@@ -114,21 +128,21 @@ func bufferSimpleFeatures(objs []geojson.Object, meters float64,
 }
 
 // appendBufferSimpleSeries buffers a series and appends its parts to dst
-func appendBufferSimpleSeries(dst []geojson.Object, s geometry.Series, meters float64) []geojson.Object {
+func appendBufferSimpleSeries(dst []geojson.Object, s geometry.Series, meters float64, steps int) []geojson.Object {
 	nsegs := s.NumSegments()
 	for i := 0; i < nsegs; i++ {
-		dst = appendSimpleBufferSegment(dst, s.SegmentAt(i), meters, i == 0)
+		dst = appendSimpleBufferSegment(dst, s.SegmentAt(i), meters, steps, i == 0)
 	}
 	return dst
 }
 
 // appendSimpleBufferSegment buffers a segment and appends its parts to dst
 func appendSimpleBufferSegment(dst []geojson.Object, seg geometry.Segment,
-	meters float64, first bool,
+	meters float64, steps int, first bool,
 ) []geojson.Object {
 	if first {
 		// endcap A
-		dst = append(dst, bufferSimplePoint(seg.A, meters))
+		dst = append(dst, bufferSimplePoint(seg.A, meters, steps))
 	}
 	// line polygon
 	bear1 := geo.BearingTo(seg.A.Y, seg.A.X, seg.B.Y, seg.B.X)
@@ -146,24 +160,25 @@ func appendSimpleBufferSegment(dst []geojson.Object, seg geometry.Segment,
 			{X: lon1, Y: lat1},
 		}, nil, nil)))
 	// endcap B
-	dst = append(dst, bufferSimplePoint(seg.B, meters))
+	dst = append(dst, bufferSimplePoint(seg.B, meters, steps))
 	return dst
 }
 
-func bufferSimplePolygon(p *geojson.Polygon, meters float64,
+func bufferSimplePolygon(p *geojson.Polygon, meters float64, steps int,
 ) (*geojson.GeometryCollection, error) {
 	var geoms []geojson.Object
 	b := p.Base()
-	geoms = appendBufferSimpleSeries(geoms, b.Exterior, meters)
+	geoms = appendBufferSimpleSeries(geoms, b.Exterior, meters, steps)
 	for _, hole := range b.Holes {
-		geoms = appendBufferSimpleSeries(geoms, hole, meters)
+		geoms = appendBufferSimpleSeries(geoms, hole, meters, steps)
 	}
 	geoms = append(geoms, p)
 	return geojson.NewGeometryCollection(geoms), nil
 }
 
 func bufferSimpleLineString(l *geojson.LineString, meters float64,
+	steps int,
 ) (*geojson.GeometryCollection, error) {
-	geoms := appendBufferSimpleSeries(nil, l.Base(), meters)
+	geoms := appendBufferSimpleSeries(nil, l.Base(), meters, steps)
 	return geojson.NewGeometryCollection(geoms), nil
 }
@@ -111,3 +111,27 @@ func TestBufferPolygon(t *testing.T) {
 		}
 	}
 }
+
+func TestBufferPointSteps(t *testing.T) {
+	pt := geojson.NewPoint(geometry.Point{X: -115, Y: 33})
+	if _, err := SimpleSteps(pt, 1000, 2); err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, steps := range []int{4, DefaultSteps, 64} {
+		g, err := SimpleSteps(pt, 1000, steps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		poly, ok := g.(*geojson.Polygon)
+		if !ok {
+			t.Fatalf("expected a polygon, got %T", g)
+		}
+		if n := poly.Base().Exterior.NumPoints(); n < steps+1 {
+			t.Fatalf("steps=%d: expected at least %d points, got %d",
+				steps, steps+1, n)
+		}
+		if !poly.Contains(pt) {
+			t.Fatalf("steps=%d: expected the point inside", steps)
+		}
+	}
+}
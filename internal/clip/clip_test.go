@@ -121,3 +121,59 @@ func TestClipPolygon2(t *testing.T) {
 // 	println(clipped.String())
 
 // }
+
+func TestIntersection(t *testing.T) {
+	square := PPO([]geometry.Point{
+		{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}, {X: 0, Y: 10}, {X: 0, Y: 0},
+	}, [][]geometry.Point{{
+		{X: 4, Y: 4}, {X: 6, Y: 4}, {X: 6, Y: 6}, {X: 4, Y: 6}, {X: 4, Y: 4},
+	}})
+	tests := []struct {
+		a, b geojson.Object
+		want string
+	}{
+		// overlapping rect
+		{square, RO(5, -5, 15, 15), `{"type":"Polygon","coordinates":` +
+			`[[[5,0],[10,0],` +
+			`[10,10],[5,10],[5,6],[6,6],[6,4],[5,4],[5,0]]]}`},
+		// rect around the hole keeps the hole
+		{square, RO(2, 2, 8, 8), `{"type":"Polygon","coordinates":` +
+			`[[[2,2],[8,2],` +
+			`[8,8],[2,8],[2,2]],[[4,6],[6,6],[6,4],[4,4],[4,6]]]}`},
+		// the same polygon
+		{square, square, `{"type":"Polygon","coordinates":[[[0,0],[10,0],` +
+			`[10,10],[0,10],[0,0]],[[4,6],[6,6],[6,4],[4,4],[4,6]]]}`},
+		// inside of the hole
+		{square, RO(4.5, 4.5, 5.5, 5.5), ``},
+		// disjoint
+		{square, RO(20, 20, 30, 30), ``},
+		// a line through the hole
+		{square, LO([]geometry.Point{{X: -5, Y: 5}, {X: 15, Y: 5}}),
+			`{"type":"MultiLineString","coordinates":[[[0,5],[4,5]],` +
+				`[[6,5],[10,5]]]}`},
+		// crossing lines
+		{LO([]geometry.Point{{X: 5, Y: 0}, {X: 5, Y: 10}}),
+			LO([]geometry.Point{{X: -5, Y: 5}, {X: 15, Y: 5}}),
+			`{"type":"Point","coordinates":[5,5]}`},
+		// a point in the polygon
+		{square, geojson.NewPoint(geometry.Point{X: 1, Y: 1}),
+			`{"type":"Point","coordinates":[1,1]}`},
+	}
+	for i, tt := range tests {
+		res, err := Intersection(tt.a, tt.b, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		if res != nil {
+			got = res.JSON()
+		}
+		if got != tt.want {
+			t.Fatalf("test %d: expected '%s', got '%s'", i, tt.want, got)
+		}
+	}
+	_, err := Intersection(square, geojson.NewGeometryCollection(nil), nil)
+	if err != ErrUnsupportedGeometry {
+		t.Fatalf("expected '%v', got '%v'", ErrUnsupportedGeometry, err)
+	}
+}
@@ -0,0 +1,586 @@
+package clip
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/geojson/geometry"
+)
+
+// ErrUnsupportedGeometry is returned by Intersection for objects that are not
+// points, lines, polygons, or features of them.
+var ErrUnsupportedGeometry = errors.New("unsupported geometry type")
+
+// Intersection returns the geometry that two objects have in common. The
+// result has the lowest dimension of the two: polygons with polygons give
+// polygons, lines with polygons give lines, lines with lines give the points
+// where they cross, and points with anything give points. A nil object is
+// returned when the two have nothing in common.
+func Intersection(a, b geojson.Object, opts *geometry.IndexOptions,
+) (geojson.Object, error) {
+	pa, ok := splitParts(a)
+	if !ok {
+		return nil, ErrUnsupportedGeometry
+	}
+	pb, ok := splitParts(b)
+	if !ok {
+		return nil, ErrUnsupportedGeometry
+	}
+	if pb.dims() < pa.dims() {
+		pa, pb = pb, pa
+	}
+	switch {
+	case pa.empty() || pb.empty():
+		return nil, nil
+	case len(pa.points) > 0:
+		var points []geometry.Point
+		for _, p := range pa.points {
+			if pb.intersectsPoint(p) {
+				points = appendPoint(points, p)
+			}
+		}
+		return pointsObject(points), nil
+	case len(pa.lines) > 0 && len(pb.lines) > 0:
+		var points []geometry.Point
+		for _, la := range pa.lines {
+			for _, lb := range pb.lines {
+				for _, sa := range lineSegments(la) {
+					for _, sb := range lineSegments(lb) {
+						for _, p := range segmentIntersections(sa, sb) {
+							points = appendPoint(points, p)
+						}
+					}
+				}
+			}
+		}
+		return pointsObject(points), nil
+	case len(pa.lines) > 0:
+		var lines [][]geometry.Point
+		for _, line := range pa.lines {
+			for _, poly := range pb.polys {
+				lines = append(lines, clipLine(line, poly)...)
+			}
+		}
+		return linesObject(lines, opts), nil
+	}
+	var polys []*geometry.Poly
+	for _, ra := range pa.polys {
+		for _, rb := range pb.polys {
+			polys = append(polys, intersectPolys(ra, rb, opts)...)
+		}
+	}
+	switch len(polys) {
+	case 0:
+		return nil, nil
+	case 1:
+		return geojson.NewPolygon(polys[0]), nil
+	}
+	return geojson.NewMultiPolygon(polys), nil
+}
+
+// parts are the points, lines, and polygons of an object. Polygons are kept
+// as rings, with the exterior first. Exteriors are counter-clockwise and
+// holes are clockwise, so that the inside is always on the left.
+type parts struct {
+	points []geometry.Point
+	lines  [][]geometry.Point
+	polys  [][][]geometry.Point
+}
+
+func (p *parts) dims() int {
+	switch {
+	case len(p.points) > 0:
+		return 0
+	case len(p.lines) > 0:
+		return 1
+	}
+	return 2
+}
+
+func (p *parts) empty() bool {
+	return len(p.points) == 0 && len(p.lines) == 0 && len(p.polys) == 0
+}
+
+func (p *parts) intersectsPoint(point geometry.Point) bool {
+	for _, pp := range p.points {
+		if pp == point {
+			return true
+		}
+	}
+	for _, line := range p.lines {
+		for _, seg := range lineSegments(line) {
+			if onSegment(point, seg) {
+				return true
+			}
+		}
+	}
+	for _, rings := range p.polys {
+		if locate(point, rings) != outside {
+			return true
+		}
+	}
+	return false
+}
+
+// splitParts breaks an object into its parts. Objects that mix dimensions,
+// like a GeometryCollection, are not supported.
+func splitParts(obj geojson.Object) (p parts, ok bool) {
+	switch obj := obj.(type) {
+	case *geojson.Point:
+		p.points = append(p.points, obj.Base())
+	case *geojson.SimplePoint:
+		p.points = append(p.points, obj.Base())
+	case *geojson.LineString:
+		if line := seriesPoints(obj.Base(), false); len(line) > 1 {
+			p.lines = append(p.lines, line)
+		}
+	case *geojson.Polygon:
+		if rings := polyRings(obj.Base()); rings != nil {
+			p.polys = append(p.polys, rings)
+		}
+	case *geojson.Rect:
+		rect := obj.Base()
+		if rings := polyRings(&geometry.Poly{Exterior: rect}); rings != nil {
+			p.polys = append(p.polys, rings)
+		}
+	case *geojson.Feature:
+		return splitParts(obj.Base())
+	case *geojson.MultiPoint, *geojson.MultiLineString,
+		*geojson.MultiPolygon:
+		for _, child := range obj.(geojson.Collection).Children() {
+			cp, ok := splitParts(child)
+			if !ok {
+				return p, false
+			}
+			p.points = append(p.points, cp.points...)
+			p.lines = append(p.lines, cp.lines...)
+			p.polys = append(p.polys, cp.polys...)
+		}
+	default:
+		return p, false
+	}
+	return p, true
+}
+
+// seriesPoints returns the points of a line or ring, without repeats. For
+// rings the closing point is left off.
+func seriesPoints(series geometry.Series, ring bool) []geometry.Point {
+	var points []geometry.Point
+	n := series.NumPoints()
+	for i := 0; i < n; i++ {
+		point := series.PointAt(i)
+		if len(points) == 0 || points[len(points)-1] != point {
+			points = append(points, point)
+		}
+	}
+	if ring && len(points) > 1 && points[0] == points[len(points)-1] {
+		points = points[:len(points)-1]
+	}
+	return points
+}
+
+// polyRings returns the rings of a polygon, wound so the inside is on the
+// left, or nil for a polygon without an area.
+func polyRings(poly *geometry.Poly) [][]geometry.Point {
+	exterior := seriesPoints(poly.Exterior, true)
+	if len(exterior) < 3 || ringArea(exterior) == 0 {
+		return nil
+	}
+	rings := [][]geometry.Point{windRing(exterior, true)}
+	for _, hole := range poly.Holes {
+		if points := seriesPoints(hole, true); len(points) >= 3 {
+			rings = append(rings, windRing(points, false))
+		}
+	}
+	return rings
+}
+
+// ringArea returns the signed area of a ring, which is positive for
+// counter-clockwise rings.
+func ringArea(ring []geometry.Point) float64 {
+	var area float64
+	for i, a := range ring {
+		b := ring[(i+1)%len(ring)]
+		area += a.X*b.Y - b.X*a.Y
+	}
+	return area / 2
+}
+
+func windRing(ring []geometry.Point, ccw bool) []geometry.Point {
+	if (ringArea(ring) > 0) != ccw {
+		for i, j := 0, len(ring)-1; i < j; i, j = i+1, j-1 {
+			ring[i], ring[j] = ring[j], ring[i]
+		}
+	}
+	return ring
+}
+
+func lineSegments(line []geometry.Point) []geometry.Segment {
+	segs := make([]geometry.Segment, 0, len(line)-1)
+	for i := 1; i < len(line); i++ {
+		segs = append(segs, geometry.Segment{A: line[i-1], B: line[i]})
+	}
+	return segs
+}
+
+func ringSegments(ring []geometry.Point) []geometry.Segment {
+	segs := make([]geometry.Segment, len(ring))
+	for i := range ring {
+		segs[i] = geometry.Segment{A: ring[i], B: ring[(i+1)%len(ring)]}
+	}
+	return segs
+}
+
+func cross(o, a, b geometry.Point) float64 {
+	return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+}
+
+// onSegment returns true when the point is on the segment, allowing for a
+// little floating point error.
+func onSegment(p geometry.Point, seg geometry.Segment) bool {
+	if p.X < math.Min(seg.A.X, seg.B.X) || p.X > math.Max(seg.A.X, seg.B.X) ||
+		p.Y < math.Min(seg.A.Y, seg.B.Y) || p.Y > math.Max(seg.A.Y, seg.B.Y) {
+		return false
+	}
+	dx, dy := seg.B.X-seg.A.X, seg.B.Y-seg.A.Y
+	return math.Abs(cross(seg.A, seg.B, p)) <= 1e-12*(dx*dx+dy*dy+1)
+}
+
+// segmentIntersections returns the points where two segments meet. That's
+// one point for crossing segments, and the ends of the overlap for collinear
+// segments.
+func segmentIntersections(a, b geometry.Segment) []geometry.Point {
+	if math.Max(a.A.X, a.B.X) < math.Min(b.A.X, b.B.X) ||
+		math.Min(a.A.X, a.B.X) > math.Max(b.A.X, b.B.X) ||
+		math.Max(a.A.Y, a.B.Y) < math.Min(b.A.Y, b.B.Y) ||
+		math.Min(a.A.Y, a.B.Y) > math.Max(b.A.Y, b.B.Y) {
+		return nil
+	}
+	d1, d2 := cross(a.A, a.B, b.A), cross(a.A, a.B, b.B)
+	d3, d4 := cross(b.A, b.B, a.A), cross(b.A, b.B, a.B)
+	if d1 == 0 && d2 == 0 {
+		// collinear, so the overlap is made of the ends inside the other
+		var points []geometry.Point
+		for _, p := range []geometry.Point{a.A, a.B} {
+			if onSegment(p, b) {
+				points = appendPoint(points, p)
+			}
+		}
+		for _, p := range []geometry.Point{b.A, b.B} {
+			if onSegment(p, a) {
+				points = appendPoint(points, p)
+			}
+		}
+		return points
+	}
+	if (d1 > 0 && d2 > 0) || (d1 < 0 && d2 < 0) ||
+		(d3 > 0 && d4 > 0) || (d3 < 0 && d4 < 0) {
+		return nil
+	}
+	// ends that touch the other segment are used as is
+	switch {
+	case d3 == 0:
+		return []geometry.Point{a.A}
+	case d4 == 0:
+		return []geometry.Point{a.B}
+	case d1 == 0:
+		return []geometry.Point{b.A}
+	case d2 == 0:
+		return []geometry.Point{b.B}
+	}
+	t := d3 / (d3 - d4)
+	return []geometry.Point{{
+		X: a.A.X + t*(a.B.X-a.A.X),
+		Y: a.A.Y + t*(a.B.Y-a.A.Y),
+	}}
+}
+
+func appendPoint(points []geometry.Point, p geometry.Point) []geometry.Point {
+	for _, pp := range points {
+		if pp == p {
+			return points
+		}
+	}
+	return append(points, p)
+}
+
+// splitSegment breaks a segment at points along it.
+func splitSegment(seg geometry.Segment, at []geometry.Point,
+) []geometry.Segment {
+	dx, dy := seg.B.X-seg.A.X, seg.B.Y-seg.A.Y
+	param := func(p geometry.Point) float64 {
+		return (p.X-seg.A.X)*dx + (p.Y-seg.A.Y)*dy
+	}
+	sort.Slice(at, func(i, j int) bool { return param(at[i]) < param(at[j]) })
+	var segs []geometry.Segment
+	prev := seg.A
+	for _, p := range at {
+		if p != prev && p != seg.B {
+			segs = append(segs, geometry.Segment{A: prev, B: p})
+			prev = p
+		}
+	}
+	return append(segs, geometry.Segment{A: prev, B: seg.B})
+}
+
+const (
+	outside = iota
+	boundary
+	inside
+)
+
+// locate returns whether a point is inside, outside, or on the boundary of a
+// polygon.
+func locate(p geometry.Point, rings [][]geometry.Point) int {
+	var in bool
+	for _, ring := range rings {
+		for i, a := range ring {
+			b := ring[(i+1)%len(ring)]
+			if onSegment(p, geometry.Segment{A: a, B: b}) {
+				return boundary
+			}
+			if (a.Y > p.Y) != (b.Y > p.Y) &&
+				p.X < (b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y)+a.X {
+				in = !in
+			}
+		}
+	}
+	if in {
+		return inside
+	}
+	return outside
+}
+
+func midpoint(seg geometry.Segment) geometry.Point {
+	return geometry.Point{X: (seg.A.X + seg.B.X) / 2, Y: (seg.A.Y + seg.B.Y) / 2}
+}
+
+// clipLine returns the pieces of a line that are inside of a polygon,
+// including its boundary.
+func clipLine(line []geometry.Point, rings [][]geometry.Point,
+) [][]geometry.Point {
+	var edges []geometry.Segment
+	for _, ring := range rings {
+		edges = append(edges, ringSegments(ring)...)
+	}
+	var lines [][]geometry.Point
+	var cur []geometry.Point
+	for _, seg := range lineSegments(line) {
+		var at []geometry.Point
+		for _, edge := range edges {
+			at = append(at, segmentIntersections(seg, edge)...)
+		}
+		for _, piece := range splitSegment(seg, at) {
+			if locate(midpoint(piece), rings) == outside {
+				if len(cur) > 0 {
+					lines = append(lines, cur)
+					cur = nil
+				}
+				continue
+			}
+			if len(cur) == 0 {
+				cur = append(cur, piece.A)
+			}
+			cur = append(cur, piece.B)
+		}
+	}
+	if len(cur) > 0 {
+		lines = append(lines, cur)
+	}
+	return lines
+}
+
+// intersectPolys returns the polygons that two polygons have in common. The
+// edges of each polygon are split where they meet the other, and the pieces
+// that are inside of the other are joined back into rings. Pieces shared by
+// both are kept once when both polygons are on the same side of them.
+func intersectPolys(a, b [][]geometry.Point, opts *geometry.IndexOptions,
+) []*geometry.Poly {
+	var ea, eb []geometry.Segment
+	for _, ring := range a {
+		ea = append(ea, ringSegments(ring)...)
+	}
+	for _, ring := range b {
+		eb = append(eb, ringSegments(ring)...)
+	}
+	splitsA := make([][]geometry.Point, len(ea))
+	splitsB := make([][]geometry.Point, len(eb))
+	for i, sa := range ea {
+		for j, sb := range eb {
+			for _, p := range segmentIntersections(sa, sb) {
+				splitsA[i] = append(splitsA[i], p)
+				splitsB[j] = append(splitsB[j], p)
+			}
+		}
+	}
+	var piecesB []geometry.Segment
+	for j, sb := range eb {
+		piecesB = append(piecesB, splitSegment(sb, splitsB[j])...)
+	}
+	var edges []geometry.Segment
+	for i, sa := range ea {
+		for _, piece := range splitSegment(sa, splitsA[i]) {
+			switch locate(midpoint(piece), b) {
+			case inside:
+				edges = append(edges, piece)
+			case boundary:
+				if sameDirection(piece, piecesB) {
+					edges = append(edges, piece)
+				}
+			}
+		}
+	}
+	for _, piece := range piecesB {
+		if locate(midpoint(piece), a) == inside {
+			edges = append(edges, piece)
+		}
+	}
+	return buildPolys(joinRings(edges), opts)
+}
+
+// sameDirection returns true when a collinear piece of the other polygon runs
+// the same way as the piece.
+func sameDirection(piece geometry.Segment, others []geometry.Segment) bool {
+	mid := midpoint(piece)
+	for _, other := range others {
+		if onSegment(mid, other) {
+			return (piece.B.X-piece.A.X)*(other.B.X-other.A.X)+
+				(piece.B.Y-piece.A.Y)*(other.B.Y-other.A.Y) > 0
+		}
+	}
+	return false
+}
+
+// joinRings follows the edges into closed rings. Where more than one edge
+// leaves a point, the one turning furthest left is taken, which keeps to the
+// smallest ring. Edges that don't close are dropped.
+func joinRings(edges []geometry.Segment) [][]geometry.Point {
+	from := make(map[geometry.Point][]int)
+	for i, edge := range edges {
+		from[edge.A] = append(from[edge.A], i)
+	}
+	used := make([]bool, len(edges))
+	var rings [][]geometry.Point
+	for i := range edges {
+		if used[i] {
+			continue
+		}
+		start := edges[i].A
+		cur := i
+		var ring []geometry.Point
+		for {
+			used[cur] = true
+			ring = append(ring, edges[cur].A)
+			end := edges[cur].B
+			if end == start {
+				break
+			}
+			next := -1
+			var best float64
+			dx, dy := end.X-edges[cur].A.X, end.Y-edges[cur].A.Y
+			for _, j := range from[end] {
+				if used[j] {
+					continue
+				}
+				ex, ey := edges[j].B.X-end.X, edges[j].B.Y-end.Y
+				turn := math.Atan2(dx*ey-dy*ex, dx*ex+dy*ey)
+				if next == -1 || turn > best {
+					next, best = j, turn
+				}
+			}
+			if next == -1 {
+				ring = nil
+				break
+			}
+			cur = next
+		}
+		if len(ring) >= 3 && ringArea(ring) != 0 {
+			rings = append(rings, ring)
+		}
+	}
+	return rings
+}
+
+// buildPolys puts the holes of joined rings into the smallest exterior that
+// holds them.
+func buildPolys(rings [][]geometry.Point, opts *geometry.IndexOptions,
+) []*geometry.Poly {
+	var exteriors, holes [][]geometry.Point
+	for _, ring := range rings {
+		if ringArea(ring) > 0 {
+			exteriors = append(exteriors, ring)
+		} else {
+			holes = append(holes, ring)
+		}
+	}
+	sort.Slice(exteriors, func(i, j int) bool {
+		return ringArea(exteriors[i]) < ringArea(exteriors[j])
+	})
+	polyHoles := make([][][]geometry.Point, len(exteriors))
+	for _, hole := range holes {
+		for i, exterior := range exteriors {
+			if ringHolds(exterior, hole) {
+				polyHoles[i] = append(polyHoles[i], closeRing(hole))
+				break
+			}
+		}
+	}
+	polys := make([]*geometry.Poly, len(exteriors))
+	for i, exterior := range exteriors {
+		polys[i] = geometry.NewPoly(closeRing(exterior), polyHoles[i], opts)
+	}
+	return polys
+}
+
+func ringHolds(exterior, hole []geometry.Point) bool {
+	rings := [][]geometry.Point{exterior}
+	var in bool
+	for _, p := range hole {
+		switch locate(p, rings) {
+		case outside:
+			return false
+		case inside:
+			in = true
+		}
+	}
+	if !in {
+		// every point of the hole is on the exterior, so look between them
+		for _, seg := range ringSegments(hole) {
+			if locate(midpoint(seg), rings) == outside {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func closeRing(ring []geometry.Point) []geometry.Point {
+	return append(ring[:len(ring):len(ring)], ring[0])
+}
+
+func pointsObject(points []geometry.Point) geojson.Object {
+	switch len(points) {
+	case 0:
+		return nil
+	case 1:
+		return geojson.NewPoint(points[0])
+	}
+	return geojson.NewMultiPoint(points)
+}
+
+func linesObject(lines [][]geometry.Point, opts *geometry.IndexOptions,
+) geojson.Object {
+	children := make([]*geometry.Line, len(lines))
+	for i, points := range lines {
+		children[i] = geometry.NewLine(points, opts)
+	}
+	switch len(children) {
+	case 0:
+		return nil
+	case 1:
+		return geojson.NewLineString(children[0])
+	}
+	return geojson.NewMultiLineString(children)
+}
@@ -57,8 +57,9 @@ type Collection struct {
 	expires  *btree.BTreeG[*object.Object]          // sorted by ex+id
 	weight   int
 	points   int
-	objects  int // geometry count
-	nobjects int // non-geometry count
+	objects  int                    // geometry count
+	nobjects int                    // non-geometry count
+	indexes  map[string]*fieldIndex // field indexes, by field name
 }
 
 var optsNoLock = btree.Options{NoLocks: true}
@@ -178,6 +179,7 @@ func (c *Collection) setFill(prev, obj *object.Object) {
 		if prev.Expires() != 0 {
 			c.expires.Delete(prev)
 		}
+		c.indexFieldsDelete(prev)
 		c.points -= prev.Geo().NumPoints()
 		c.weight -= prev.Weight()
 	}
@@ -191,6 +193,7 @@ func (c *Collection) setFill(prev, obj *object.Object) {
 	if obj.Expires() != 0 {
 		c.expires.Set(obj)
 	}
+	c.indexFieldsInsert(obj)
 	c.points += obj.Geo().NumPoints()
 	c.weight += obj.Weight()
 }
@@ -214,6 +217,7 @@ func (c *Collection) Delete(id string) (prev *object.Object) {
 	if prev.Expires() != 0 {
 		c.expires.Delete(prev)
 	}
+	c.indexFieldsDelete(prev)
 	c.points -= prev.Geo().NumPoints()
 	c.weight -= prev.Weight()
 	return prev
@@ -417,6 +421,48 @@ func (c *Collection) geoSearch(
 	return alive
 }
 
+// maxSearchParts is the most parts of a multipolygon that geoSearchObj
+// searches one at a time.
+const maxSearchParts = 8
+
+// geoSearchObj searches the objects that overlap the rect of an object. The
+// parts of a multipolygon are searched one at a time, which skips the space
+// between them, like for bounds that are split at the antimeridian. An object
+// that overlaps more than one part is only visited once.
+func (c *Collection) geoSearchObj(
+	obj geojson.Object,
+	iter func(o *object.Object) bool,
+) bool {
+	mp, ok := obj.(*geojson.MultiPolygon)
+	if !ok || len(mp.Children()) < 2 || len(mp.Children()) > maxSearchParts {
+		return c.geoSearch(obj.Rect(), iter)
+	}
+	var searched [][2][2]float32
+	alive := true
+	for _, part := range mp.Children() {
+		min, max := rtreeRect(part.Rect())
+		c.spatial.Search(
+			min, max,
+			func(omin, omax [2]float32, o *object.Object) bool {
+				for _, r := range searched {
+					if omin[0] <= r[1][0] && omax[0] >= r[0][0] &&
+						omin[1] <= r[1][1] && omax[1] >= r[0][1] {
+						// visited by the search of a prior part
+						return true
+					}
+				}
+				alive = iter(o)
+				return alive
+			},
+		)
+		if !alive {
+			break
+		}
+		searched = append(searched, [2][2]float32{min, max})
+	}
+	return alive
+}
+
 func (c *Collection) geoSparse(
 	obj geojson.Object, sparse uint8,
 	iter func(o *object.Object) (match, ok bool),
@@ -507,7 +553,7 @@ func (c *Collection) Within(
 			return match, ok
 		})
 	}
-	return c.geoSearch(obj.Rect(), func(o *object.Object) bool {
+	return c.geoSearchObj(obj, func(o *object.Object) bool {
 		count++
 		if count <= offset {
 			return true
@@ -548,7 +594,7 @@ func (c *Collection) Intersects(
 			return match, ok
 		})
 	}
-	return c.geoSearch(gobj.Rect(), func(o *object.Object) bool {
+	return c.geoSearchObj(gobj, func(o *object.Object) bool {
 		count++
 		if count <= offset {
 			return true
@@ -613,3 +659,43 @@ func nextStep(step uint64, cursor Cursor, deadline *deadline.Deadline) {
 func (c *Collection) ScanExpires(iter func(o *object.Object) bool) {
 	c.expires.Scan(iter)
 }
+
+// ScanExpiresAfter iterates the objects that expire after the provided time,
+// in order of their expiration.
+func (c *Collection) ScanExpiresAfter(at int64,
+	iter func(o *object.Object) bool,
+) {
+	c.expires.Ascend(object.New("", String(""), at+1, field.List{}), iter)
+}
+
+// ScanExpiresFrom iterates the objects that come after the provided
+// expiration and id, in order of their expiration.
+func (c *Collection) ScanExpiresFrom(at int64, id string,
+	iter func(o *object.Object) bool,
+) {
+	c.expires.Ascend(object.New(id, String(""), at, field.List{}),
+		func(o *object.Object) bool {
+			if o.Expires() == at && o.ID() == id {
+				return true
+			}
+			return iter(o)
+		},
+	)
+}
+
+// CountExpired returns the number of objects that expire at or before the
+// provided time.
+func (c *Collection) CountExpired(at int64) int {
+	// the expirations are in order, so this is the index of the first object
+	// that expires after the time
+	lo, hi := 0, c.expires.Len()
+	for lo < hi {
+		i := (lo + hi) / 2
+		if o, _ := c.expires.GetAt(i); o.Expires() <= at {
+			lo = i + 1
+		} else {
+			hi = i
+		}
+	}
+	return lo
+}
@@ -349,6 +349,108 @@ func TestCollectionSearch(t *testing.T) {
 	expect(t, n == 10)
 }
 
+func TestCollectionIndex(t *testing.T) {
+	c := New()
+	ids := func(value string, desc bool) []string {
+		var ids []string
+		v := field.ValueOf(value)
+		r := IndexRange{Min: &v, Max: &v}
+		c.ScanIndex("status", r, desc, nil, nil,
+			func(o *object.Object) bool {
+				ids = append(ids, o.ID())
+				return true
+			},
+		)
+		return ids
+	}
+	set := func(id, status string) {
+		var fields field.List
+		if status != "" {
+			fields = fields.Set(field.Make("status", status))
+		}
+		c.Set(object.New(id, PO(1, 2), 0, fields))
+	}
+	set("1", "active")
+	set("2", "parked")
+	set("3", "active")
+	set("4", "")
+	expect(t, c.AddIndex("status"))
+	expect(t, !c.AddIndex("status"))
+	expect(t, c.HasIndex("status"))
+	expect(t, reflect.DeepEqual(c.Indexes(), []string{"status"}))
+	expect(t, reflect.DeepEqual(ids("active", false), []string{"1", "3"}))
+	expect(t, reflect.DeepEqual(ids("active", true), []string{"3", "1"}))
+	expect(t, reflect.DeepEqual(ids("0", false), []string{"4"}))
+	expect(t, ids("idle", false) == nil)
+	set("2", "active")
+	set("3", "parked")
+	c.Delete("1")
+	set("5", "active")
+	expect(t, reflect.DeepEqual(ids("active", false), []string{"2", "5"}))
+	expect(t, reflect.DeepEqual(ids("parked", true), []string{"3"}))
+	expect(t, c.DeleteIndex("status"))
+	expect(t, !c.DeleteIndex("status"))
+	expect(t, ids("active", false) == nil)
+}
+
+func TestCollectionIndexRange(t *testing.T) {
+	c := New()
+	for i := 0; i < 100; i++ {
+		fields := field.List{}.Set(field.Make("speed", strconv.Itoa(i)))
+		c.Set(object.New(strconv.Itoa(i), PO(1, 2), 0, fields))
+	}
+	c.Set(object.New("str", PO(1, 2), 0,
+		field.List{}.Set(field.Make("speed", "fast"))))
+	expect(t, c.AddIndex("speed"))
+	speeds := func(r IndexRange, desc bool) []string {
+		var ids []string
+		c.ScanIndex("speed", r, desc, nil, nil, func(o *object.Object) bool {
+			ids = append(ids, o.ID())
+			return true
+		})
+		return ids
+	}
+	v := func(data string) *field.Value {
+		v := field.ValueOf(data)
+		return &v
+	}
+	r := IndexRange{Min: v("95"), Max: v("98"), MaxExclusive: true}
+	expect(t, reflect.DeepEqual(speeds(r, false), []string{"95", "96", "97"}))
+	expect(t, reflect.DeepEqual(speeds(r, true), []string{"97", "96", "95"}))
+	r = IndexRange{Min: v("97"), MinExclusive: true}
+	expect(t, reflect.DeepEqual(speeds(r, false), []string{"98", "99", "str"}))
+	expect(t, reflect.DeepEqual(speeds(r, true), []string{"str", "99", "98"}))
+	r = IndexRange{Max: v("1")}
+	expect(t, reflect.DeepEqual(speeds(r, false), []string{"0", "1"}))
+	expect(t, c.IndexCount("speed", IndexRange{}, 1000) == 101)
+	expect(t, c.IndexCount("speed", IndexRange{}, 10) == 10)
+	expect(t, c.IndexCount("other", IndexRange{}, 10) == 0)
+}
+
+func TestCollectionExpires(t *testing.T) {
+	c := New()
+	for i := 0; i < 100; i++ {
+		c.Set(object.New(strconv.Itoa(i), PO(1, 2), int64(i/10+1), field.List{}))
+	}
+	c.Set(object.New("never", PO(1, 2), 0, field.List{}))
+	expect(t, c.CountExpired(0) == 0)
+	expect(t, c.CountExpired(1) == 10)
+	expect(t, c.CountExpired(5) == 50)
+	expect(t, c.CountExpired(100) == 100)
+	var ids []string
+	c.ScanExpiresAfter(9, func(o *object.Object) bool {
+		ids = append(ids, o.ID())
+		return true
+	})
+	expect(t, len(ids) == 10 && ids[0] == "90")
+	ids = nil
+	c.ScanExpiresFrom(10, "93", func(o *object.Object) bool {
+		ids = append(ids, o.ID())
+		return true
+	})
+	expect(t, len(ids) == 6 && ids[0] == "94")
+}
+
 func TestCollectionWeight(t *testing.T) {
 	c := New()
 	c.Set(object.New("1", String("1"), 0, field.List{}))
@@ -494,6 +596,37 @@ func TestSpatialSearch(t *testing.T) {
 	expect(t, reflect.DeepEqual(items, exitems))
 }
 
+func TestSpatialSearchParts(t *testing.T) {
+	c := New()
+	c.Set(object.New("east", PO(179.5, 10), 0, field.List{}))
+	c.Set(object.New("west", PO(-179.5, 10), 0, field.List{}))
+	c.Set(object.New("middle", PO(0, 10), 0, field.List{}))
+	line, _ := geojson.Parse(
+		`{"type":"LineString","coordinates":[[179.5,10],[-179.5,10]]}`, nil)
+	c.Set(object.New("line", line, 0, field.List{}))
+	parts, _ := geojson.Parse(`{"type":"MultiPolygon","coordinates":[
+		[[[179,0],[180,0],[180,20],[179,20],[179,0]]],
+		[[[-180,0],[-179,0],[-179,20],[-180,20],[-180,0]]]
+	]}`, nil)
+	var ids []string
+	c.Intersects(parts, 0, nil, nil, func(o *object.Object) bool {
+		ids = append(ids, o.ID())
+		return true
+	})
+	expect(t, len(ids) == 3)
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		expect(t, !seen[id] && id != "middle")
+		seen[id] = true
+	}
+	ids = nil
+	c.Within(parts, 0, nil, nil, func(o *object.Object) bool {
+		ids = append(ids, o.ID())
+		return true
+	})
+	expect(t, len(ids) == 2)
+}
+
 func TestCollectionSparse(t *testing.T) {
 	rect := geojson.NewRect(geometry.Rect{
 		Min: geometry.Point{X: -71.598930, Y: 42.4586739},
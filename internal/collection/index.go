@@ -0,0 +1,214 @@
+package collection
+
+import (
+	"sort"
+
+	"github.com/tidwall/btree"
+	"github.com/tidwall/tile38/internal/deadline"
+	"github.com/tidwall/tile38/internal/field"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+// indexItem is an object in a field index. The obj is nil for the pivots of
+// a search, which are ordered before or, with last, after the objects that
+// have their value.
+type indexItem struct {
+	value field.Value
+	obj   *object.Object
+	last  bool
+}
+
+func (item indexItem) id() string {
+	if item.obj == nil {
+		return ""
+	}
+	return item.obj.ID()
+}
+
+func byIndexValue(a, b indexItem) bool {
+	if a.value.Less(b.value) {
+		return true
+	}
+	if b.value.Less(a.value) {
+		return false
+	}
+	if a.last != b.last {
+		return b.last
+	}
+	// the values match so we'll compare IDs, which are always unique.
+	return a.id() < b.id()
+}
+
+// fieldIndex orders all objects of a collection by the value of one field.
+// An object without the field is ordered by the zero value, which is what
+// WHERE compares with too.
+type fieldIndex struct {
+	name  string
+	items *btree.BTreeG[indexItem] // sorted by value+id
+}
+
+func (idx *fieldIndex) item(o *object.Object) indexItem {
+	return indexItem{value: o.Fields().Get(idx.name).Value(), obj: o}
+}
+
+func (c *Collection) indexFieldsDelete(o *object.Object) {
+	for _, idx := range c.indexes {
+		idx.items.Delete(idx.item(o))
+	}
+}
+
+func (c *Collection) indexFieldsInsert(o *object.Object) {
+	for _, idx := range c.indexes {
+		idx.items.Set(idx.item(o))
+	}
+}
+
+// AddIndex adds an index on a field, which is built from the objects that
+// are in the collection. Returns false when the field is already indexed.
+func (c *Collection) AddIndex(name string) bool {
+	if c.indexes[name] != nil {
+		return false
+	}
+	idx := &fieldIndex{
+		name:  name,
+		items: btree.NewBTreeGOptions(byIndexValue, optsNoLock),
+	}
+	c.objs.Scan(func(_ string, o *object.Object) bool {
+		idx.items.Load(idx.item(o))
+		return true
+	})
+	if c.indexes == nil {
+		c.indexes = make(map[string]*fieldIndex)
+	}
+	c.indexes[name] = idx
+	return true
+}
+
+// DeleteIndex removes the index on a field. Returns false when the field is
+// not indexed.
+func (c *Collection) DeleteIndex(name string) bool {
+	if c.indexes[name] == nil {
+		return false
+	}
+	delete(c.indexes, name)
+	return true
+}
+
+// HasIndex returns true when a field is indexed.
+func (c *Collection) HasIndex(name string) bool {
+	return c.indexes[name] != nil
+}
+
+// Indexes returns the names of the indexed fields, in order.
+func (c *Collection) Indexes() []string {
+	names := make([]string, 0, len(c.indexes))
+	for name := range c.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IndexRange is a range of the values of an indexed field. A nil Min or Max
+// leaves that side of the range open.
+type IndexRange struct {
+	Min          *field.Value
+	Max          *field.Value
+	MinExclusive bool
+	MaxExclusive bool
+}
+
+// aboveMin returns true when a value is not below the start of the range.
+func (r IndexRange) aboveMin(v field.Value) bool {
+	if r.Min == nil {
+		return true
+	}
+	if r.MinExclusive {
+		return r.Min.Less(v)
+	}
+	return !v.Less(*r.Min)
+}
+
+// belowMax returns true when a value is not past the end of the range.
+func (r IndexRange) belowMax(v field.Value) bool {
+	if r.Max == nil {
+		return true
+	}
+	if r.MaxExclusive {
+		return v.Less(*r.Max)
+	}
+	return !r.Max.Less(v)
+}
+
+// ScanIndex iterates though the objects that have a value in a range of an
+// indexed field, ordered by value and then id. Nothing is iterated when the
+// field is not indexed.
+func (c *Collection) ScanIndex(
+	name string,
+	r IndexRange,
+	desc bool,
+	cursor Cursor,
+	deadline *deadline.Deadline,
+	iterator func(o *object.Object) bool,
+) bool {
+	idx := c.indexes[name]
+	if idx == nil {
+		return true
+	}
+	var keepon = true
+	var count uint64
+	var offset uint64
+	if cursor != nil {
+		offset = cursor.Offset()
+		cursor.Step(offset)
+	}
+	iter := func(item indexItem) bool {
+		if desc {
+			if !r.aboveMin(item.value) {
+				return false
+			}
+			if !r.belowMax(item.value) {
+				return true
+			}
+		} else {
+			if !r.belowMax(item.value) {
+				return false
+			}
+			if !r.aboveMin(item.value) {
+				return true
+			}
+		}
+		count++
+		if count <= offset {
+			return true
+		}
+		nextStep(count, cursor, deadline)
+		keepon = iterator(item.obj)
+		return keepon
+	}
+	if desc {
+		if r.Max != nil {
+			idx.items.Descend(indexItem{value: *r.Max, last: true}, iter)
+		} else {
+			idx.items.Reverse(iter)
+		}
+	} else {
+		if r.Min != nil {
+			idx.items.Ascend(indexItem{value: *r.Min}, iter)
+		} else {
+			idx.items.Scan(iter)
+		}
+	}
+	return keepon
+}
+
+// IndexCount returns the number of objects that have a value in a range of
+// an indexed field, counting no further than limit.
+func (c *Collection) IndexCount(name string, r IndexRange, limit int) int {
+	var count int
+	c.ScanIndex(name, r, false, nil, nil, func(_ *object.Object) bool {
+		count++
+		return count < limit
+	})
+	return count
+}
@@ -78,6 +78,7 @@ func (conn *AMQPConn) Send(msg string) error {
 
 		channel, err := c.Channel()
 		if err != nil {
+			c.Close()
 			return err
 		}
 
@@ -91,6 +92,7 @@ func (conn *AMQPConn) Send(msg string) error {
 			conn.ep.AMQP.NoWait,
 			nil,
 		); err != nil {
+			c.Close()
 			return err
 		}
 		if conn.ep.AMQP.Type != "topic" {
@@ -103,6 +105,7 @@ func (conn *AMQPConn) Send(msg string) error {
 				conn.ep.AMQP.NoWait,
 				nil,
 			); err != nil {
+				c.Close()
 				return err
 			}
 
@@ -114,6 +117,7 @@ func (conn *AMQPConn) Send(msg string) error {
 				conn.ep.AMQP.NoWait,
 				nil,
 			); err != nil {
+				c.Close()
 				return err
 			}
 		}
@@ -121,7 +125,7 @@ func (conn *AMQPConn) Send(msg string) error {
 		conn.channel = channel
 	}
 
-	return conn.channel.Publish(
+	err := conn.channel.Publish(
 		conn.ep.AMQP.QueueName,
 		conn.ep.AMQP.RouteKey,
 		conn.ep.AMQP.Mandatory,
@@ -135,6 +139,12 @@ func (conn *AMQPConn) Send(msg string) error {
 			Priority:        conn.ep.AMQP.Priority,
 		},
 	)
+	if err != nil {
+		// the broker went away, so reconnect on the next send
+		conn.close()
+		return err
+	}
+	return nil
 }
 
 func newAMQPConn(ep Endpoint) *AMQPConn {
@@ -1,6 +1,7 @@
 package endpoint
 
 import (
+	"crypto/tls"
 	"errors"
 	"net/url"
 	"strconv"
@@ -40,15 +41,32 @@ const (
 	PubSub = Protocol("pubsub")
 	// NATS protocol
 	NATS = Protocol("nats")
+	// NATS JetStream protocol
+	JetStream = Protocol("jetstream")
 	// EventHub protocol
 	EventHub = Protocol("sb")
+	// Unix domain socket protocol
+	Unix = Protocol("unix")
+	// File protocol
+	File = Protocol("file")
 )
 
+// Schemes are the url schemes of the endpoints that can be used for hooks.
+var Schemes = []string{
+	"amqp", "amqps", "disque", "file", "gpubsub", "grpc", "http", "https",
+	"jetstream", "kafka", "local", "mqtt", "nats", "pubsub", "redis", "sb",
+	"sqs", "unix",
+}
+
 // Endpoint represents an endpoint.
 type Endpoint struct {
 	Protocol Protocol
 	Original string
-	GRPC     struct {
+	HTTP     struct {
+		URL  string // the url without the cert param
+		Cert string // name of the client certificate
+	}
+	GRPC struct {
 		Host string
 		Port int
 	}
@@ -106,6 +124,7 @@ type Endpoint struct {
 		Project  string
 		Topic    string
 		CredPath string
+		Ordered  bool // messages use the object id as their ordering key
 	}
 	SQS struct {
 		PlainURL    string
@@ -127,12 +146,26 @@ type Endpoint struct {
 		TLSCert string
 		TLSKey  string
 	}
+	JetStream struct {
+		Stream     string        // expected stream of the subject
+		Ack        bool          // wait for the stream to acknowledge
+		AckWait    time.Duration // how long to wait for an acknowledgement
+		MaxPending int           // unacknowledged messages, when not waiting
+	}
 	EventHub struct {
 		ConnectionString string
 	}
 	Local struct {
 		Channel string
 	}
+	Unix struct {
+		Path string
+	}
+	File struct {
+		Path     string
+		MaxSize  int64 // rotate when the file would grow past, zero is never
+		MaxFiles int   // number of rotated files to keep
+	}
 }
 
 // Conn is an endpoint connection
@@ -149,6 +182,8 @@ type Manager struct {
 	publisher LocalPublisher
 	shutdown  atomic.Bool    // atomic bool
 	wg        sync.WaitGroup // run wait group
+	pool      pool           // delivery workers
+	certs     atomic.Pointer[map[string]*tls.Certificate]
 }
 
 // NewManager returns a new manager
@@ -157,6 +192,7 @@ func NewManager(publisher LocalPublisher) *Manager {
 		conns:     make(map[string]Conn),
 		publisher: publisher,
 	}
+	epc.pool.init()
 	epc.wg.Add(1)
 	go epc.run()
 	return epc
@@ -165,6 +201,7 @@ func NewManager(publisher LocalPublisher) *Manager {
 func (epc *Manager) Shutdown() {
 	defer epc.wg.Wait()
 	epc.shutdown.Store(true)
+	epc.pool.close()
 	// expire the connections
 	epc.mu.Lock()
 	defer epc.mu.Unlock()
@@ -195,12 +232,54 @@ func (epc *Manager) run() {
 
 // Validate an endpoint url
 func (epc *Manager) Validate(url string) error {
+	ep, err := parseEndpoint(url)
+	if err != nil {
+		return err
+	}
+	if ep.HTTP.Cert != "" && epc.clientCert(ep.HTTP.Cert) == nil {
+		return errors.New("unknown client certificate")
+	}
+	return nil
+}
+
+// SetClientCerts sets the client certificates that https endpoints may
+// present, by name.
+func (epc *Manager) SetClientCerts(certs map[string]*tls.Certificate) {
+	epc.certs.Store(&certs)
+}
+
+// clientCert returns the client certificate with a name, or nil.
+func (epc *Manager) clientCert(name string) *tls.Certificate {
+	certs := epc.certs.Load()
+	if certs == nil {
+		return nil
+	}
+	return (*certs)[name]
+}
+
+// Validate an endpoint url
+func Validate(url string) error {
 	_, err := parseEndpoint(url)
 	return err
 }
 
+// SetPoolSize sets the number of messages that may be sent at the same time,
+// and how many of those may go to a single endpoint. Zero means unlimited.
+func (epc *Manager) SetPoolSize(workers, maxInFlight int) {
+	epc.pool.setSize(workers, maxInFlight)
+}
+
+// PoolStats returns the statistics of the delivery pool.
+func (epc *Manager) PoolStats() PoolStats {
+	return epc.pool.stats()
+}
+
 // Send send a message to an endpoint
 func (epc *Manager) Send(endpoint, msg string) error {
+	if err := epc.pool.acquire(endpoint); err != nil {
+		return err
+	}
+	defer epc.pool.release(endpoint)
 	for {
 		epc.mu.Lock()
 		conn, exists := epc.conns[endpoint]
@@ -214,7 +293,7 @@ func (epc *Manager) Send(endpoint, msg string) error {
 			default:
 				return errors.New("invalid protocol")
 			case HTTP:
-				conn = newHTTPConn(ep)
+				conn = newHTTPConn(ep, epc.clientCert)
 			case Disque:
 				conn = newDisqueConn(ep)
 			case GRPC:
@@ -233,10 +312,16 @@ func (epc *Manager) Send(endpoint, msg string) error {
 				conn = newSQSConn(ep)
 			case NATS:
 				conn = newNATSConn(ep)
+			case JetStream:
+				conn = newJetStreamConn(ep)
 			case Local:
 				conn = newLocalConn(ep, epc.publisher)
 			case EventHub:
 				conn = newEventHubConn(ep)
+			case Unix:
+				conn = newUnixConn(ep)
+			case File:
+				conn = newFileConn(ep)
 			}
 			epc.conns[endpoint] = conn
 		}
@@ -265,12 +350,20 @@ func parseEndpoint(s string) (Endpoint, error) {
 		endpoint.Protocol = Local
 	case strings.HasPrefix(s, "http:"):
 		endpoint.Protocol = HTTP
+		endpoint.HTTP.URL = s
 	case strings.HasPrefix(s, "https:"):
 		if probeSQS(s) {
 			endpoint.SQS.PlainURL = s
 			endpoint.Protocol = SQS
 		} else {
 			endpoint.Protocol = HTTP
+			// https://<host>/<path>?cert=<name> presents the client
+			// certificate that was registered with that name.
+			var err error
+			endpoint.HTTP.URL, endpoint.HTTP.Cert, err = splitCertParam(s)
+			if err != nil {
+				return endpoint, err
+			}
 		}
 	case strings.HasPrefix(s, "disque:"):
 		endpoint.Protocol = Disque
@@ -286,14 +379,20 @@ func parseEndpoint(s string) (Endpoint, error) {
 		endpoint.Protocol = AMQP
 	case strings.HasPrefix(s, "mqtt:"):
 		endpoint.Protocol = MQTT
-	case strings.HasPrefix(s, "pubsub:"):
+	case strings.HasPrefix(s, "pubsub:"), strings.HasPrefix(s, "gpubsub:"):
 		endpoint.Protocol = PubSub
 	case strings.HasPrefix(s, "sqs:"):
 		endpoint.Protocol = SQS
 	case strings.HasPrefix(s, "nats:"):
 		endpoint.Protocol = NATS
+	case strings.HasPrefix(s, "jetstream:"):
+		endpoint.Protocol = JetStream
 	case strings.HasPrefix(s, "Endpoint="):
 		endpoint.Protocol = EventHub
+	case strings.HasPrefix(s, "unix:"):
+		endpoint.Protocol = Unix
+	case strings.HasPrefix(s, "file:"):
+		endpoint.Protocol = File
 	}
 
 	s = s[strings.Index(s, ":")+1:]
@@ -301,6 +400,47 @@ func parseEndpoint(s string) (Endpoint, error) {
 		return endpoint, errors.New("missing the two slashes")
 	}
 
+	// Unix domain socket or local file, with an absolute path
+	// unix:///<path>
+	// file:///<path>[?maxsize=<bytes>&maxfiles=<count>]
+	if endpoint.Protocol == Unix || endpoint.Protocol == File {
+		path, query, _ := strings.Cut(s[2:], "?")
+		path, err := url.PathUnescape(path)
+		if err != nil || !strings.HasPrefix(path, "/") || len(path) == 1 {
+			return endpoint, errors.New("missing path")
+		}
+		if endpoint.Protocol == Unix {
+			endpoint.Unix.Path = path
+			return endpoint, nil
+		}
+		endpoint.File.Path = path
+		endpoint.File.MaxFiles = 1
+		m, err := url.ParseQuery(query)
+		if err != nil {
+			return endpoint, errors.New("invalid file url")
+		}
+		for key, val := range m {
+			if len(val) == 0 {
+				continue
+			}
+			switch key {
+			case "maxsize":
+				n, err := strconv.ParseInt(val[0], 10, 64)
+				if err != nil || n < 0 {
+					return endpoint, errors.New("invalid file maxsize value")
+				}
+				endpoint.File.MaxSize = n
+			case "maxfiles":
+				n, err := strconv.ParseUint(val[0], 10, 16)
+				if err != nil {
+					return endpoint, errors.New("invalid file maxfiles value")
+				}
+				endpoint.File.MaxFiles = int(n)
+			}
+		}
+		return endpoint, nil
+	}
+
 	sqp := strings.Split(s[2:], "?")
 	sp := strings.Split(sqp[0], "/")
 	s = sp[0]
@@ -612,9 +752,21 @@ func parseEndpoint(s string) (Endpoint, error) {
 	//  params are:
 	//
 	// credpath - path where gcp credentials are located
+	// Google Cloud PubSub connection strings in HOOKS interface
+	// pubsub://<project>:<topic>/?params=value
+	// gpubsub://<project>/<topic>/?params=value
+	//
+	//  params are:
+	//
+	// credpath - service account key file, otherwise the application
+	//            default credentials are used
+	// ordering - order the messages of an object by its id
 	if endpoint.Protocol == PubSub {
 		split := strings.Split(s, ":")
-		if len(split) != 2 {
+		if len(split) == 1 && len(sp) > 1 && sp[1] != "" {
+			split = append(split, sp[1])
+		}
+		if len(split) != 2 || split[1] == "" {
 			return endpoint, errors.New("invalid PubSub format should be project/topic")
 		}
 		endpoint.PubSub.Project = split[0]
@@ -632,6 +784,8 @@ func parseEndpoint(s string) (Endpoint, error) {
 				switch key {
 				case "credpath":
 					endpoint.PubSub.CredPath = val[0]
+				case "ordering":
+					endpoint.PubSub.Ordered = queryBool(val[0])
 				}
 			}
 		}
@@ -650,6 +804,8 @@ func parseEndpoint(s string) (Endpoint, error) {
 	// Routing-Key - tile38
 	//
 	// - "route" - [string] routing key
+	// - "type" - [string] exchange type: direct, fanout, topic or headers
+	// - "delivery_mode" - [string] persistent, transient, or 1 or 2
 	//
 	if endpoint.Protocol == AMQP {
 		// Bind connection information
@@ -702,7 +858,14 @@ func parseEndpoint(s string) (Endpoint, error) {
 				case "mandatory":
 					endpoint.AMQP.Mandatory = queryBool(val[0])
 				case "delivery_mode":
-					endpoint.AMQP.DeliveryMode = uint8(queryInt(val[0]))
+					switch strings.ToLower(val[0]) {
+					case "persistent":
+						endpoint.AMQP.DeliveryMode = amqp.Persistent
+					case "transient":
+						endpoint.AMQP.DeliveryMode = amqp.Transient
+					default:
+						endpoint.AMQP.DeliveryMode = uint8(queryInt(val[0]))
+					}
 				case "priority":
 					endpoint.AMQP.Priority = uint8(queryInt(val[0]))
 				}
@@ -717,6 +880,13 @@ func parseEndpoint(s string) (Endpoint, error) {
 			return endpoint, errors.New("missing AMQP queue name")
 		}
 
+		switch endpoint.AMQP.Type {
+		case amqp.ExchangeDirect, amqp.ExchangeFanout, amqp.ExchangeTopic,
+			amqp.ExchangeHeaders:
+		default:
+			return endpoint, errors.New("invalid AMQP exchange type")
+		}
+
 		if endpoint.AMQP.RouteKey == "" {
 			endpoint.AMQP.RouteKey = "tile38"
 		}
@@ -730,12 +900,26 @@ func parseEndpoint(s string) (Endpoint, error) {
 	// user - username
 	// pass - password
 	// when user or pass is not set then login without password is used
-	if endpoint.Protocol == NATS {
+	//
+	// NATS JetStream connection strings in HOOKS interface
+	// jetstream://<host>:<port>/<subject>/?params=value
+	//
+	//  takes the NATS params, and also:
+	//
+	// stream      - the stream that must store the subject
+	// ack         - wait for the stream to acknowledge (default: yes)
+	// ack_wait    - how long to wait for an acknowledgement, like 5s
+	// max_pending - unacknowledged messages when ack is no
+	if endpoint.Protocol == NATS || endpoint.Protocol == JetStream {
+		endpoint.JetStream.Ack = true
 		// Parsing connection from URL string
 		hp := strings.Split(s, ":")
 		switch len(hp) {
 		default:
-			return endpoint, errors.New("invalid SQS url")
+			return endpoint, errors.New("invalid NATS url")
+		case 1:
+			endpoint.NATS.Host = hp[0]
+			endpoint.NATS.Port = 4222 // default nats port
 		case 2:
 			endpoint.NATS.Host = hp[0]
 			port, err := strconv.Atoi(hp[1])
@@ -778,9 +962,29 @@ func parseEndpoint(s string) (Endpoint, error) {
 					endpoint.NATS.TLSCert = val[0]
 				case "tlskey":
 					endpoint.NATS.TLSKey = val[0]
+				case "stream":
+					endpoint.JetStream.Stream = val[0]
+				case "ack":
+					endpoint.JetStream.Ack = queryBool(val[0])
+				case "ack_wait":
+					d, err := time.ParseDuration(val[0])
+					if err != nil || d < 0 {
+						return endpoint, errors.New("invalid JetStream ack_wait value")
+					}
+					endpoint.JetStream.AckWait = d
+				case "max_pending":
+					n, err := strconv.ParseUint(val[0], 10, 31)
+					if err != nil {
+						return endpoint, errors.New("invalid JetStream max_pending value")
+					}
+					endpoint.JetStream.MaxPending = int(n)
 				}
 			}
 		}
+
+		if endpoint.Protocol == JetStream && endpoint.NATS.Topic == "" {
+			return endpoint, errors.New("missing JetStream subject")
+		}
 	}
 
 	if endpoint.Protocol == EventHub {
@@ -810,6 +1014,32 @@ func parseEndpoint(s string) (Endpoint, error) {
 	return endpoint, nil
 }
 
+// splitCertParam takes the cert param out of the query of a url.
+func splitCertParam(s string) (string, string, error) {
+	base, query, ok := strings.Cut(s, "?")
+	if !ok {
+		return s, "", nil
+	}
+	var cert string
+	var params []string
+	for _, param := range strings.Split(query, "&") {
+		key, val, _ := strings.Cut(param, "=")
+		if key != "cert" {
+			params = append(params, param)
+			continue
+		}
+		val, err := url.QueryUnescape(val)
+		if err != nil || val == "" {
+			return s, "", errors.New("invalid cert value")
+		}
+		cert = val
+	}
+	if len(params) > 0 {
+		base += "?" + strings.Join(params, "&")
+	}
+	return base, cert, nil
+}
+
 func queryInt(s string) int {
 	x, _ := strconv.ParseInt(s, 10, 64)
 	return int(x)
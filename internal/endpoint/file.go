@@ -0,0 +1,131 @@
+package endpoint
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const fileExpiresAfter = time.Second * 30
+
+// FileConn is an endpoint that appends messages to a local file, each on its
+// own line. When the file would grow past the max size it's rotated, the
+// current file is renamed to "<path>.1", the older ones are shifted up, and
+// the ones past the max files are removed.
+type FileConn struct {
+	mu   sync.Mutex
+	ep   Endpoint
+	ex   bool
+	t    time.Time
+	f    *os.File
+	size int64
+}
+
+func newFileConn(ep Endpoint) *FileConn {
+	return &FileConn{
+		ep: ep,
+		t:  time.Now(),
+	}
+}
+
+// Expired returns true if the connection has expired
+func (conn *FileConn) Expired() bool {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if !conn.ex {
+		if time.Since(conn.t) > fileExpiresAfter {
+			conn.close()
+			conn.ex = true
+		}
+	}
+	return conn.ex
+}
+
+// ExpireNow forces the connection to expire
+func (conn *FileConn) ExpireNow() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.close()
+	conn.ex = true
+}
+
+func (conn *FileConn) close() {
+	if conn.f != nil {
+		conn.f.Close()
+		conn.f = nil
+	}
+}
+
+func (conn *FileConn) open() error {
+	f, err := os.OpenFile(conn.ep.File.Path,
+		os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	conn.f = f
+	conn.size = fi.Size()
+	return nil
+}
+
+func (conn *FileConn) rotate() error {
+	conn.close()
+	path := conn.ep.File.Path
+	for i := conn.ep.File.MaxFiles; i > 0; i-- {
+		name := path + "." + strconv.Itoa(i)
+		if i == conn.ep.File.MaxFiles {
+			if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		} else {
+			err := os.Rename(name, path+"."+strconv.Itoa(i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	if conn.ep.File.MaxFiles > 0 {
+		if err := os.Rename(path, path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(path); err != nil {
+		return err
+	}
+	return conn.open()
+}
+
+// Send sends a message
+func (conn *FileConn) Send(msg string) error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if conn.ex {
+		return errExpired
+	}
+	conn.t = time.Now()
+	if conn.f == nil {
+		if err := conn.open(); err != nil {
+			return err
+		}
+	}
+	line := []byte(msg + "\n")
+	max := conn.ep.File.MaxSize
+	if max > 0 && conn.size > 0 && conn.size+int64(len(line)) > max {
+		if err := conn.rotate(); err != nil {
+			conn.close()
+			return err
+		}
+	}
+	n, err := conn.f.Write(line)
+	conn.size += int64(n)
+	if err != nil {
+		conn.close()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package endpoint
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hooks.log")
+	ep, err := parseEndpoint("file://" + path + "?maxsize=25&maxfiles=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ep.File.Path != path || ep.File.MaxSize != 25 || ep.File.MaxFiles != 2 {
+		t.Fatalf("unexpected endpoint %+v", ep.File)
+	}
+	conn := newFileConn(ep)
+	defer conn.ExpireNow()
+	if err := os.WriteFile(path+".2", []byte("removed\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"message 1", "message 2", "message 3",
+		"message 4", "message 5", "message 6"} {
+		if err := conn.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, expect := range map[string]string{
+		path:        "message 5\nmessage 6\n",
+		path + ".1": "message 3\nmessage 4\n",
+		path + ".2": "message 1\nmessage 2\n",
+	} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expect {
+			t.Fatalf("%s: expected %q, got %q", name, expect, data)
+		}
+	}
+	for _, url := range []string{"file://", "file:///", "file://hooks.log",
+		"file:///hooks.log?maxsize=big", "unix://"} {
+		if _, err := parseEndpoint(url); err == nil {
+			t.Fatalf("%s: expected an error", url)
+		}
+	}
+}
+
+func TestUnixEndpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	ep, err := parseEndpoint("unix://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := newUnixConn(ep)
+	defer conn.ExpireNow()
+	if err := conn.Send(`{"id":"truck1"}`); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	line, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "{\"id\":\"truck1\"}\n" {
+		t.Fatalf("expected message, got %q", line)
+	}
+}
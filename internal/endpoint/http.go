@@ -2,6 +2,8 @@ package endpoint
 
 import (
 	"bytes"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -20,15 +22,33 @@ type HTTPConn struct {
 	client *http.Client
 }
 
-func newHTTPConn(ep Endpoint) *HTTPConn {
+func newHTTPConn(ep Endpoint,
+	clientCert func(name string) *tls.Certificate,
+) *HTTPConn {
+	transport := &http.Transport{
+		MaxIdleConnsPerHost: httpMaxIdleConnections,
+		IdleConnTimeout:     httpExpiresAfter,
+	}
+	if ep.HTTP.Cert != "" {
+		// the certificate is looked up for each handshake, which picks up
+		// a certificate that was replaced in the config.
+		transport.TLSClientConfig = &tls.Config{
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (
+				*tls.Certificate, error,
+			) {
+				cert := clientCert(ep.HTTP.Cert)
+				if cert == nil {
+					return nil, errors.New("unknown client certificate")
+				}
+				return cert, nil
+			},
+		}
+	}
 	return &HTTPConn{
 		ep: ep,
 		client: &http.Client{
-			Transport: &http.Transport{
-				MaxIdleConnsPerHost: httpMaxIdleConnections,
-				IdleConnTimeout:     httpExpiresAfter,
-			},
-			Timeout: httpRequestTimeout,
+			Transport: transport,
+			Timeout:   httpRequestTimeout,
 		},
 	}
 }
@@ -44,7 +64,7 @@ func (conn *HTTPConn) ExpireNow() {
 
 // Send sends a message
 func (conn *HTTPConn) Send(msg string) error {
-	req, err := http.NewRequest("POST", conn.ep.Original, bytes.NewBufferString(msg))
+	req, err := http.NewRequest("POST", conn.ep.HTTP.URL, bytes.NewBufferString(msg))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,89 @@
+package endpoint
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testCert(t *testing.T, usage x509.ExtKeyUsage) (*tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		DNSNames:              []string{"localhost"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, x
+}
+
+func TestHTTPClientCert(t *testing.T) {
+	client, clientX := testCert(t, x509.ExtKeyUsageClientAuth)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientX)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {},
+	))
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(srv.Certificate())
+
+	epc := NewManager(nil)
+	defer epc.Shutdown()
+	url := srv.URL + "/hook?a=1&cert=client"
+	if err := epc.Validate(url); err == nil {
+		t.Fatal("expected an unknown certificate error")
+	}
+	epc.SetClientCerts(map[string]*tls.Certificate{"client": client})
+	if err := epc.Validate(url); err != nil {
+		t.Fatal(err)
+	}
+	ep, err := parseEndpoint(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ep.HTTP.URL != srv.URL+"/hook?a=1" || ep.HTTP.Cert != "client" {
+		t.Fatalf("unexpected endpoint %+v", ep.HTTP)
+	}
+	conn := newHTTPConn(ep, epc.clientCert)
+	conn.client.Transport.(*http.Transport).TLSClientConfig.RootCAs = rootCAs
+	if err := conn.Send(`{"id":"truck1"}`); err != nil {
+		t.Fatal(err)
+	}
+	// without the client certificate the server refuses the handshake
+	ep.HTTP.Cert = ""
+	conn = newHTTPConn(ep, epc.clientCert)
+	conn.client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{
+		RootCAs: rootCAs,
+	}
+	if err := conn.Send(`{"id":"truck1"}`); err == nil {
+		t.Fatal("expected a handshake error")
+	}
+}
@@ -0,0 +1,105 @@
+package endpoint
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const jetStreamExpiresAfter = time.Second * 30
+
+// JetStreamConn is an endpoint connection
+type JetStreamConn struct {
+	mu   sync.Mutex
+	ep   Endpoint
+	ex   bool
+	t    time.Time
+	conn *nats.Conn
+	js   nats.JetStreamContext
+}
+
+func newJetStreamConn(ep Endpoint) *JetStreamConn {
+	return &JetStreamConn{
+		ep: ep,
+		t:  time.Now(),
+	}
+}
+
+// Expired returns true if the connection has expired
+func (conn *JetStreamConn) Expired() bool {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if !conn.ex {
+		if time.Since(conn.t) > jetStreamExpiresAfter {
+			conn.close()
+			conn.ex = true
+		}
+	}
+	return conn.ex
+}
+
+// ExpireNow forces the connection to expire
+func (conn *JetStreamConn) ExpireNow() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.close()
+	conn.ex = true
+}
+
+func (conn *JetStreamConn) close() {
+	if conn.conn != nil {
+		conn.conn.Close()
+		conn.conn = nil
+		conn.js = nil
+	}
+}
+
+// Send sends a message
+func (conn *JetStreamConn) Send(msg string) error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.ex {
+		return errExpired
+	}
+	conn.t = time.Now()
+	if conn.conn == nil {
+		var err error
+		conn.conn, err = natsConnect(conn.ep)
+		if err != nil {
+			return err
+		}
+		var opts []nats.JSOpt
+		if conn.ep.JetStream.MaxPending > 0 {
+			opts = append(opts,
+				nats.PublishAsyncMaxPending(conn.ep.JetStream.MaxPending))
+		}
+		conn.js, err = conn.conn.JetStream(opts...)
+		if err != nil {
+			conn.close()
+			return err
+		}
+	}
+	var opts []nats.PubOpt
+	if conn.ep.JetStream.Stream != "" {
+		opts = append(opts, nats.ExpectStream(conn.ep.JetStream.Stream))
+	}
+	var err error
+	if conn.ep.JetStream.Ack {
+		// wait for the stream to acknowledge that it stored the message. An
+		// error here is retried like any other failed send.
+		if conn.ep.JetStream.AckWait > 0 {
+			opts = append(opts, nats.AckWait(conn.ep.JetStream.AckWait))
+		}
+		_, err = conn.js.Publish(conn.ep.NATS.Topic, []byte(msg), opts...)
+	} else {
+		// only fails when there are already max-pending unacknowledged
+		// messages for too long.
+		_, err = conn.js.PublishAsync(conn.ep.NATS.Topic, []byte(msg), opts...)
+	}
+	if err != nil {
+		conn.close()
+		return err
+	}
+	return nil
+}
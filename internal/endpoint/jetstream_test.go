@@ -0,0 +1,37 @@
+package endpoint
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJetStreamEndpoint(t *testing.T) {
+	ep, err := parseEndpoint("jetstream://localhost:4223/geo.events" +
+		"?stream=GEO&ack_wait=2s&user=u&pass=p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ep.Protocol != JetStream || ep.NATS.Host != "localhost" ||
+		ep.NATS.Port != 4223 || ep.NATS.Topic != "geo.events" ||
+		ep.NATS.User != "u" || ep.NATS.Pass != "p" {
+		t.Fatalf("unexpected endpoint %+v", ep.NATS)
+	}
+	if ep.JetStream.Stream != "GEO" || !ep.JetStream.Ack ||
+		ep.JetStream.AckWait != 2*time.Second || ep.JetStream.MaxPending != 0 {
+		t.Fatalf("unexpected endpoint %+v", ep.JetStream)
+	}
+	ep, err = parseEndpoint("jetstream://localhost/geo?ack=no&max_pending=64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ep.NATS.Port != 4222 || ep.JetStream.Ack || ep.JetStream.MaxPending != 64 {
+		t.Fatalf("unexpected endpoint %+v %+v", ep.NATS, ep.JetStream)
+	}
+	for _, url := range []string{"jetstream://", "jetstream://localhost:4222",
+		"jetstream://localhost/geo?ack_wait=soon",
+		"jetstream://localhost/geo?max_pending=-1"} {
+		if _, err := parseEndpoint(url); err == nil {
+			t.Fatalf("%s: expected an error", url)
+		}
+	}
+}
@@ -63,23 +63,9 @@ func (conn *NATSConn) Send(msg string) error {
 	}
 	conn.t = time.Now()
 	if conn.conn == nil {
-		addr := fmt.Sprintf("%s:%d", conn.ep.NATS.Host, conn.ep.NATS.Port)
 		var err error
-		var opts []nats.Option
-		if conn.ep.NATS.User != "" && conn.ep.NATS.Pass != "" {
-			opts = append(opts, nats.UserInfo(conn.ep.NATS.User, conn.ep.NATS.Pass))
-		}
-		if conn.ep.NATS.TLS {
-			opts = append(opts, nats.ClientCert(
-				conn.ep.NATS.TLSCert, conn.ep.NATS.TLSKey,
-			))
-		}
-		if conn.ep.NATS.Token != "" {
-			opts = append(opts, nats.Token(conn.ep.NATS.Token))
-		}
-		conn.conn, err = nats.Connect(addr, opts...)
+		conn.conn, err = natsConnect(conn.ep)
 		if err != nil {
-			conn.close()
 			return err
 		}
 	}
@@ -91,3 +77,19 @@ func (conn *NATSConn) Send(msg string) error {
 
 	return nil
 }
+
+// natsConnect opens a connection to the NATS server of an endpoint.
+func natsConnect(ep Endpoint) (*nats.Conn, error) {
+	addr := fmt.Sprintf("%s:%d", ep.NATS.Host, ep.NATS.Port)
+	var opts []nats.Option
+	if ep.NATS.User != "" && ep.NATS.Pass != "" {
+		opts = append(opts, nats.UserInfo(ep.NATS.User, ep.NATS.Pass))
+	}
+	if ep.NATS.TLS {
+		opts = append(opts, nats.ClientCert(ep.NATS.TLSCert, ep.NATS.TLSKey))
+	}
+	if ep.NATS.Token != "" {
+		opts = append(opts, nats.Token(ep.NATS.Token))
+	}
+	return nats.Connect(addr, opts...)
+}
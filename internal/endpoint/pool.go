@@ -0,0 +1,102 @@
+package endpoint
+
+import (
+	"errors"
+	"sync"
+)
+
+var errShutdown = errors.New("endpoint manager shutdown")
+
+// PoolStats are the statistics of the delivery pool.
+type PoolStats struct {
+	Workers     int    // number of messages that may be sent at the same time
+	MaxInFlight int    // number of messages an endpoint may send at a time
+	InFlight    int    // number of messages being sent right now
+	Waiting     int    // number of messages waiting on a free worker
+	Saturated   uint64 // number of times a message had to wait
+}
+
+// pool limits the number of messages that are sent at the same time. Each
+// endpoint may only use part of the pool, which keeps a slow endpoint from
+// holding up the deliveries to all other endpoints.
+type pool struct {
+	mu          sync.Mutex
+	cond        *sync.Cond
+	workers     int
+	maxInFlight int
+	inFlight    int
+	waiting     int
+	saturated   uint64
+	endpoints   map[string]int
+	closed      bool
+}
+
+func (p *pool) init() {
+	p.cond = sync.NewCond(&p.mu)
+	p.endpoints = make(map[string]int)
+}
+
+// setSize sets the number of workers and the number of workers that a single
+// endpoint may use. Zero means unlimited.
+func (p *pool) setSize(workers, maxInFlight int) {
+	p.mu.Lock()
+	p.workers = workers
+	p.maxInFlight = maxInFlight
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+func (p *pool) full(endpoint string) bool {
+	return (p.workers > 0 && p.inFlight >= p.workers) ||
+		(p.maxInFlight > 0 && p.endpoints[endpoint] >= p.maxInFlight)
+}
+
+// acquire waits for a free worker for the endpoint.
+func (p *pool) acquire(endpoint string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.full(endpoint) {
+		p.saturated++
+		p.waiting++
+		for !p.closed && p.full(endpoint) {
+			p.cond.Wait()
+		}
+		p.waiting--
+	}
+	if p.closed {
+		return errShutdown
+	}
+	p.inFlight++
+	p.endpoints[endpoint]++
+	return nil
+}
+
+// release returns a worker that was acquired for the endpoint.
+func (p *pool) release(endpoint string) {
+	p.mu.Lock()
+	p.inFlight--
+	if p.endpoints[endpoint]--; p.endpoints[endpoint] == 0 {
+		delete(p.endpoints, endpoint)
+	}
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+func (p *pool) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+func (p *pool) stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PoolStats{
+		Workers:     p.workers,
+		MaxInFlight: p.maxInFlight,
+		InFlight:    p.inFlight,
+		Waiting:     p.waiting,
+		Saturated:   p.saturated,
+	}
+}
@@ -0,0 +1,53 @@
+package endpoint
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	var p pool
+	p.init()
+	p.setSize(3, 2)
+
+	// a slow endpoint can only take two of the three workers
+	for i := 0; i < 2; i++ {
+		if err := p.acquire("slow"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blocked := make(chan error)
+	go func() { blocked <- p.acquire("slow") }()
+	select {
+	case <-blocked:
+		t.Fatal("expected the slow endpoint to wait")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	// other endpoints still have a worker
+	if err := p.acquire("fast"); err != nil {
+		t.Fatal(err)
+	}
+	stats := p.stats()
+	if stats.InFlight != 3 || stats.Waiting != 1 || stats.Saturated != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	p.release("fast")
+	select {
+	case <-blocked:
+		t.Fatal("expected the slow endpoint to wait")
+	case <-time.After(time.Millisecond * 50):
+	}
+	p.release("slow")
+	if err := <-blocked; err != nil {
+		t.Fatal(err)
+	}
+
+	// waiters are released on close
+	go func() { blocked <- p.acquire("slow") }()
+	time.Sleep(time.Millisecond * 10)
+	p.close()
+	if err := <-blocked; err != errShutdown {
+		t.Fatalf("expected '%v', got '%v'", errShutdown, err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"cloud.google.com/go/pubsub"
+	"github.com/tidwall/gjson"
 	"google.golang.org/api/option"
 )
 
@@ -61,17 +62,41 @@ func (conn *PubSubConn) Send(msg string) error {
 		}
 
 		topic := svc.Topic(conn.ep.PubSub.Topic)
+		topic.EnableMessageOrdering = conn.ep.PubSub.Ordered
 
 		conn.svc = svc
 		conn.topic = topic
 	}
 
+	// The object id and detect type are attributes so that subscriptions
+	// can filter on them.
+	attrs := make(map[string]string)
+	id := gjson.Get(msg, "id").String()
+	if id != "" {
+		attrs["id"] = id
+	}
+	if detect := gjson.Get(msg, "detect").String(); detect != "" {
+		attrs["detect"] = detect
+	}
+	var orderingKey string
+	if conn.ep.PubSub.Ordered {
+		// messages of the same object are delivered in order
+		orderingKey = id
+	}
+
 	// Send message
 	res := conn.topic.Publish(ctx, &pubsub.Message{
-		Data: []byte(msg),
+		Data:        []byte(msg),
+		Attributes:  attrs,
+		OrderingKey: orderingKey,
 	})
 	_, err := res.Get(ctx)
 	if err != nil {
+		if orderingKey != "" {
+			// publishing for the key is paused after an error, and the
+			// message is retried.
+			conn.topic.ResumePublish(orderingKey)
+		}
 		fmt.Println(err)
 		return err
 	}
@@ -0,0 +1,26 @@
+package endpoint
+
+import "testing"
+
+func TestPubSubEndpoint(t *testing.T) {
+	for _, url := range []string{
+		"pubsub://geo-project:fences?credpath=/etc/key.json&ordering=yes",
+		"gpubsub://geo-project/fences?credpath=/etc/key.json&ordering=yes",
+	} {
+		ep, err := parseEndpoint(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ep.Protocol != PubSub || ep.PubSub.Project != "geo-project" ||
+			ep.PubSub.Topic != "fences" ||
+			ep.PubSub.CredPath != "/etc/key.json" || !ep.PubSub.Ordered {
+			t.Fatalf("%s: unexpected endpoint %+v", url, ep.PubSub)
+		}
+	}
+	for _, url := range []string{"gpubsub://", "gpubsub://geo-project",
+		"gpubsub://geo-project/", "pubsub://geo-project:"} {
+		if _, err := parseEndpoint(url); err == nil {
+			t.Fatalf("%s: expected an error", url)
+		}
+	}
+}
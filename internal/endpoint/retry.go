@@ -0,0 +1,103 @@
+package endpoint
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy is how a hook retries the messages that it fails to send to an
+// endpoint. The wait between the attempts doubles, from Backoff up to
+// MaxBackoff.
+type RetryPolicy struct {
+	Retries    int // attempts after the first one, negative is forever
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy retries forever, every half second.
+var DefaultRetryPolicy = RetryPolicy{
+	Retries:    -1,
+	Backoff:    time.Second / 2,
+	MaxBackoff: time.Second / 2,
+}
+
+// Allows returns true when an endpoint may be tried again after it failed a
+// number of times.
+func (p RetryPolicy) Allows(failures int) bool {
+	return p.Retries < 0 || failures <= p.Retries
+}
+
+// Wait returns how long to wait before trying again after a number of
+// failures.
+func (p RetryPolicy) Wait(failures int) time.Duration {
+	wait := p.Backoff
+	for i := 1; i < failures && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	return wait
+}
+
+// SplitRetryPolicy takes the retries, backoff and maxbackoff params out of
+// the query of an endpoint url, and returns the url without them.
+//
+//	http://<host>/<path>?retries=5&backoff=2s&maxbackoff=30s
+func SplitRetryPolicy(s string) (string, RetryPolicy, error) {
+	policy := DefaultRetryPolicy
+	base, query, ok := strings.Cut(s, "?")
+	if !ok {
+		return s, policy, nil
+	}
+	var backoffSet, maxBackoffSet bool
+	var params []string
+	for _, param := range strings.Split(query, "&") {
+		key, val, _ := strings.Cut(param, "=")
+		val, err := url.QueryUnescape(val)
+		if err != nil {
+			return s, policy, errors.New("invalid endpoint query")
+		}
+		switch key {
+		default:
+			params = append(params, param)
+			continue
+		case "retries":
+			n, err := strconv.ParseUint(val, 10, 31)
+			if err != nil {
+				return s, policy, errors.New("invalid retries value")
+			}
+			policy.Retries = int(n)
+		case "backoff", "maxbackoff":
+			d, err := time.ParseDuration(val)
+			if err != nil || d <= 0 {
+				return s, policy, errors.New("invalid " + key + " value")
+			}
+			if key == "backoff" {
+				policy.Backoff, backoffSet = d, true
+			} else {
+				policy.MaxBackoff, maxBackoffSet = d, true
+			}
+		}
+	}
+	if maxBackoffSet && !backoffSet && policy.MaxBackoff < policy.Backoff {
+		policy.Backoff = policy.MaxBackoff
+	}
+	if backoffSet && !maxBackoffSet {
+		// a backoff alone doubles up to a minute
+		policy.MaxBackoff = time.Minute
+		if policy.Backoff > policy.MaxBackoff {
+			policy.MaxBackoff = policy.Backoff
+		}
+	}
+	if policy.MaxBackoff < policy.Backoff {
+		return s, policy, errors.New("maxbackoff is less than backoff")
+	}
+	if len(params) > 0 {
+		base += "?" + strings.Join(params, "&")
+	}
+	return base, policy, nil
+}
@@ -0,0 +1,50 @@
+package endpoint
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	url, policy, err := SplitRetryPolicy(
+		"http://localhost:9999/hook?a=1&retries=3&backoff=2s&maxbackoff=5s&b=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "http://localhost:9999/hook?a=1&b=2" {
+		t.Fatalf("unexpected url %q", url)
+	}
+	if policy.Retries != 3 || policy.Backoff != 2*time.Second ||
+		policy.MaxBackoff != 5*time.Second {
+		t.Fatalf("unexpected policy %+v", policy)
+	}
+	for failures, expect := range map[int]time.Duration{
+		1: 2 * time.Second, 2: 4 * time.Second, 3: 5 * time.Second,
+	} {
+		if wait := policy.Wait(failures); wait != expect {
+			t.Fatalf("%d: expected %v, got %v", failures, expect, wait)
+		}
+	}
+	if !policy.Allows(3) || policy.Allows(4) {
+		t.Fatal("expected three retries")
+	}
+	url, policy, err = SplitRetryPolicy("http://localhost:9999/hook?retries=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "http://localhost:9999/hook" || policy.Allows(1) ||
+		policy.Backoff != DefaultRetryPolicy.Backoff {
+		t.Fatalf("unexpected %q %+v", url, policy)
+	}
+	url, policy, err = SplitRetryPolicy("http://localhost:9999/hook")
+	if err != nil || url != "http://localhost:9999/hook" ||
+		policy != DefaultRetryPolicy || !policy.Allows(1000) {
+		t.Fatalf("unexpected %q %+v %v", url, policy, err)
+	}
+	for _, url := range []string{"http://a?retries=-1", "http://a?backoff=0s",
+		"http://a?backoff=5s&maxbackoff=1s", "http://a?maxbackoff=soon"} {
+		if _, _, err := SplitRetryPolicy(url); err == nil {
+			t.Fatalf("%s: expected an error", url)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package endpoint
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	unixExpiresAfter = time.Second * 30
+	unixTimeout      = time.Second * 5
+)
+
+// UnixConn is an endpoint connection to a Unix domain socket. Each message is
+// written on its own line.
+type UnixConn struct {
+	mu   sync.Mutex
+	ep   Endpoint
+	ex   bool
+	t    time.Time
+	conn net.Conn
+}
+
+func newUnixConn(ep Endpoint) *UnixConn {
+	return &UnixConn{
+		ep: ep,
+		t:  time.Now(),
+	}
+}
+
+// Expired returns true if the connection has expired
+func (conn *UnixConn) Expired() bool {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if !conn.ex {
+		if time.Since(conn.t) > unixExpiresAfter {
+			conn.close()
+			conn.ex = true
+		}
+	}
+	return conn.ex
+}
+
+// ExpireNow forces the connection to expire
+func (conn *UnixConn) ExpireNow() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.close()
+	conn.ex = true
+}
+
+func (conn *UnixConn) close() {
+	if conn.conn != nil {
+		conn.conn.Close()
+		conn.conn = nil
+	}
+}
+
+// Send sends a message. A consumer that doesn't keep up fills the socket
+// buffer, and the send fails when the message can't be written in time.
+func (conn *UnixConn) Send(msg string) error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if conn.ex {
+		return errExpired
+	}
+	conn.t = time.Now()
+	if conn.conn == nil {
+		var err error
+		conn.conn, err = net.DialTimeout("unix", conn.ep.Unix.Path, unixTimeout)
+		if err != nil {
+			return err
+		}
+	}
+	conn.conn.SetWriteDeadline(time.Now().Add(unixTimeout))
+	if _, err := conn.conn.Write([]byte(msg + "\n")); err != nil {
+		// a partly written message would corrupt the next one
+		conn.close()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package geodesic
+
+import (
+	"math"
+	"strings"
+
+	"github.com/tidwall/geojson/geo"
+)
+
+// Metric is an algorithm used for measuring the distance and the bearing
+// between two points on the Earth. It's used for every distance and bearing
+// that a server reports: NEARBY with its HEADING and ALONG, the distances of
+// fences, LENGTHWITHIN and MOVEMENT.
+type Metric int
+
+const (
+	// Haversine measures distances on a sphere. This is the default.
+	Haversine Metric = iota
+	// Vincenty measures distances on the WGS-84 ellipsoid.
+	Vincenty
+)
+
+// MaxSphericalError is the largest relative difference between a Haversine
+// and a Vincenty distance for the same pair of points.
+const MaxSphericalError = 0.0056
+
+// WGS-84 ellipsoid
+const (
+	wgs84A = 6378137.0
+	wgs84F = 1 / 298.257223563
+	wgs84B = wgs84A * (1 - wgs84F)
+)
+
+// ParseMetric returns the metric for the provided name.
+func ParseMetric(name string) (Metric, bool) {
+	switch strings.ToLower(name) {
+	case "haversine":
+		return Haversine, true
+	case "vincenty":
+		return Vincenty, true
+	}
+	return 0, false
+}
+
+// String returns the name of the metric.
+func (m Metric) String() string {
+	switch m {
+	case Vincenty:
+		return "vincenty"
+	default:
+		return "haversine"
+	}
+}
+
+// Distance returns the distance in meters between two points.
+func (m Metric) Distance(latA, lonA, latB, lonB float64) float64 {
+	if m == Vincenty {
+		if meters, _, ok := vincenty(latA, lonA, latB, lonB); ok {
+			return meters
+		}
+	}
+	return geo.DistanceTo(latA, lonA, latB, lonB)
+}
+
+// Bearing returns the initial bearing in degrees, in the range [0, 360), from
+// the first point to the second.
+func (m Metric) Bearing(latA, lonA, latB, lonB float64) float64 {
+	if m == Vincenty {
+		if _, bearing, ok := vincenty(latA, lonA, latB, lonB); ok {
+			return bearing
+		}
+	}
+	return geo.BearingTo(latA, lonA, latB, lonB)
+}
+
+// vincenty uses the inverse Vincenty formula to calculate the distance and
+// the initial bearing between two points. Returns false when the formula
+// fails to converge, which may happen for nearly antipodal points.
+func vincenty(latA, lonA, latB, lonB float64) (meters, bearing float64,
+	ok bool,
+) {
+	const (
+		maxIters = 200
+		epsilon  = 1e-12
+	)
+	if latA == latB && lonA == lonB {
+		return 0, 0, true
+	}
+	L := (lonB - lonA) * math.Pi / 180
+	U1 := math.Atan((1 - wgs84F) * math.Tan(latA*math.Pi/180))
+	U2 := math.Atan((1 - wgs84F) * math.Tan(latB*math.Pi/180))
+	sinU1, cosU1 := math.Sincos(U1)
+	sinU2, cosU2 := math.Sincos(U2)
+
+	var sinσ, cosσ, σ, cos2α, cos2σm, sinλ, cosλ float64
+	λ := L
+	for i := 0; ; i++ {
+		if i == maxIters {
+			return 0, 0, false
+		}
+		sinλ, cosλ = math.Sincos(λ)
+		sinσ = math.Sqrt((cosU2*sinλ)*(cosU2*sinλ) +
+			(cosU1*sinU2-sinU1*cosU2*cosλ)*(cosU1*sinU2-sinU1*cosU2*cosλ))
+		if sinσ == 0 {
+			return 0, 0, true
+		}
+		cosσ = sinU1*sinU2 + cosU1*cosU2*cosλ
+		σ = math.Atan2(sinσ, cosσ)
+		sinα := cosU1 * cosU2 * sinλ / sinσ
+		cos2α = 1 - sinα*sinα
+		if cos2α != 0 {
+			cos2σm = cosσ - 2*sinU1*sinU2/cos2α
+		} else {
+			// equatorial line
+			cos2σm = 0
+		}
+		C := wgs84F / 16 * cos2α * (4 + wgs84F*(4-3*cos2α))
+		λp := λ
+		λ = L + (1-C)*wgs84F*sinα*
+			(σ+C*sinσ*(cos2σm+C*cosσ*(-1+2*cos2σm*cos2σm)))
+		if math.Abs(λ-λp) < epsilon {
+			break
+		}
+	}
+	u2 := cos2α * (wgs84A*wgs84A - wgs84B*wgs84B) / (wgs84B * wgs84B)
+	A := 1 + u2/16384*(4096+u2*(-768+u2*(320-175*u2)))
+	B := u2 / 1024 * (256 + u2*(-128+u2*(74-47*u2)))
+	Δσ := B * sinσ * (cos2σm + B/4*(cosσ*(-1+2*cos2σm*cos2σm)-
+		B/6*cos2σm*(-3+4*sinσ*sinσ)*(-3+4*cos2σm*cos2σm)))
+	α1 := math.Atan2(cosU2*sinλ, cosU1*sinU2-sinU1*cosU2*cosλ)
+	return wgs84B * A * (σ - Δσ), math.Mod(α1*180/math.Pi+360, 360), true
+}
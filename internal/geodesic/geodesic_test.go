@@ -0,0 +1,62 @@
+package geodesic
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseMetric(t *testing.T) {
+	for _, name := range []string{"haversine", "HAVERSINE", "vincenty"} {
+		m, ok := ParseMetric(name)
+		if !ok {
+			t.Fatalf("expected ok for %s", name)
+		}
+		if m.String() != "haversine" && m.String() != "vincenty" {
+			t.Fatalf("unexpected name %s", m)
+		}
+	}
+	if _, ok := ParseMetric("euclid"); ok {
+		t.Fatal("expected false")
+	}
+}
+
+func TestVincenty(t *testing.T) {
+	// Flinders Peak to Buninyong, from Vincenty's original paper.
+	meters := Vincenty.Distance(
+		-(37 + 57/60.0 + 3.72030/3600), 144+25/60.0+29.52440/3600,
+		-(37 + 39/60.0 + 10.15610/3600), 143+55/60.0+35.38390/3600,
+	)
+	if math.Abs(meters-54972.271) > 0.001 {
+		t.Fatalf("expected 54972.271, got %f", meters)
+	}
+	bearing := Vincenty.Bearing(
+		-(37 + 57/60.0 + 3.72030/3600), 144+25/60.0+29.52440/3600,
+		-(37 + 39/60.0 + 10.15610/3600), 143+55/60.0+35.38390/3600,
+	)
+	if math.Abs(bearing-(306+52/60.0+5.37/3600)) > 1e-5 {
+		t.Fatalf("expected 306.868158, got %f", bearing)
+	}
+	if meters := Vincenty.Distance(33, -115, 33, -115); meters != 0 {
+		t.Fatalf("expected 0, got %f", meters)
+	}
+	// nearly antipodal points fall back to haversine
+	meters = Vincenty.Distance(0, 0, 0.5, 179.7)
+	if meters != Haversine.Distance(0, 0, 0.5, 179.7) {
+		t.Fatalf("expected haversine fallback, got %f", meters)
+	}
+}
+
+func TestMaxSphericalError(t *testing.T) {
+	for lat := -80.0; lat <= 80; lat += 10 {
+		for lon := -170.0; lon <= 170; lon += 10 {
+			h := Haversine.Distance(0, 0, lat, lon)
+			v := Vincenty.Distance(0, 0, lat, lon)
+			if h == 0 {
+				continue
+			}
+			if math.Abs(h-v)/v > MaxSphericalError {
+				t.Fatalf("%f,%f: haversine %f, vincenty %f", lat, lon, h, v)
+			}
+		}
+	}
+}
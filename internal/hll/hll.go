@@ -0,0 +1,68 @@
+// Package hll estimates the number of distinct values in a stream with a
+// HyperLogLog.
+package hll
+
+import (
+	"math"
+	"math/bits"
+)
+
+// precision is the number of hash bits that select a register. There are
+// 2^precision registers, and the standard error of an estimate is about
+// 1.04/sqrt(2^precision), which is 0.81%.
+const precision = 14
+
+const numRegisters = 1 << precision
+
+// Sketch is a HyperLogLog. The zero value is an empty sketch.
+type Sketch struct {
+	regs [numRegisters]uint8
+}
+
+// Add adds a value to the sketch.
+func (s *Sketch) Add(value string) {
+	h := hash(value)
+	i := h >> (64 - precision)
+	w := h<<precision | 1<<(precision-1)
+	rho := uint8(bits.LeadingZeros64(w)) + 1
+	if rho > s.regs[i] {
+		s.regs[i] = rho
+	}
+}
+
+// Count returns the estimated number of distinct values that were added.
+func (s *Sketch) Count() uint64 {
+	const m = float64(numRegisters)
+	const alpha = 0.7213 / (1 + 1.079/m)
+	var sum float64
+	var zeros int
+	for _, r := range s.regs {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	est := alpha * m * m / sum
+	if est <= 2.5*m && zeros > 0 {
+		// small range correction
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(est + 0.5)
+}
+
+// hash is the 64-bit FNV-1a of a value, followed by the finalizer of
+// splitmix64, which spreads the bits of short values that FNV leaves close
+// together.
+func hash(value string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(value); i++ {
+		h ^= uint64(value[i])
+		h *= 1099511628211
+	}
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
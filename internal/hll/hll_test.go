@@ -0,0 +1,27 @@
+package hll
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestSketch(t *testing.T) {
+	var s Sketch
+	if s.Count() != 0 {
+		t.Fatalf("expected 0, got %d", s.Count())
+	}
+	for _, n := range []int{1, 10, 100, 1000, 10000, 100000, 1000000} {
+		var s Sketch
+		for i := 0; i < n; i++ {
+			s.Add("route" + strconv.Itoa(i))
+			// duplicates do not count
+			s.Add("route" + strconv.Itoa(i/2))
+		}
+		count := float64(s.Count())
+		if err := math.Abs(count-float64(n)) / float64(n); err > 0.03 {
+			t.Fatalf("n=%d: expected %d, got %.0f (error %.4f)", n, n,
+				count, err)
+		}
+	}
+}
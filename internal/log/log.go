@@ -23,6 +23,23 @@ var tty atomic.Bool
 var ljson atomic.Bool
 var llevel atomic.Int32
 
+var smu sync.RWMutex
+var subs map[int]func(Entry)
+var nextSub int
+var nsubs atomic.Int32
+
+// Entry is a logged message, which is sent to the subscribers.
+type Entry struct {
+	Time    time.Time
+	Level   string // debug, info, http, warn, error, or fatal
+	Message string
+}
+
+var entryLevels = map[string]string{
+	"DEBU": "debug", "INFO": "info", "HTTP": "info", "WARN": "warn",
+	"ERRO": "error", "FATA": "fatal",
+}
+
 func init() {
 	SetOutput(os.Stderr)
 	SetLevel(1)
@@ -118,8 +135,45 @@ func Output() io.Writer {
 	return wr
 }
 
+// Subscribe calls fn with every message that is logged, no matter the log
+// level, until the returned function is called. The fn is called while
+// logging, so it must not block or log.
+func Subscribe(fn func(e Entry)) (unsubscribe func()) {
+	smu.Lock()
+	if subs == nil {
+		subs = make(map[int]func(Entry))
+	}
+	id := nextSub
+	nextSub++
+	subs[id] = fn
+	nsubs.Store(int32(len(subs)))
+	smu.Unlock()
+	return func() {
+		smu.Lock()
+		delete(subs, id)
+		nsubs.Store(int32(len(subs)))
+		smu.Unlock()
+	}
+}
+
+// enabled returns true when a message of the level is written to the output,
+// or when there are subscribers.
+func enabled(level int) bool {
+	return llevel.Load() >= int32(level) || nsubs.Load() > 0
+}
+
+func publish(tag, msg string) {
+	e := Entry{Time: time.Now(), Level: entryLevels[tag], Message: msg}
+	smu.RLock()
+	for _, fn := range subs {
+		fn(e)
+	}
+	smu.RUnlock()
+}
+
 func log(level int, tag, color string, formatted bool, format string, args ...interface{}) {
-	if llevel.Load() < int32(level) {
+	write := llevel.Load() >= int32(level)
+	if !write && nsubs.Load() == 0 {
 		return
 	}
 	var msg string
@@ -128,6 +182,12 @@ func log(level int, tag, color string, formatted bool, format string, args ...in
 	} else {
 		msg = fmt.Sprint(args...)
 	}
+	if nsubs.Load() > 0 {
+		publish(tag, msg)
+	}
+	if !write {
+		return
+	}
 	if ljson.Load() {
 		zmu.Lock()
 		defer zmu.Unlock()
@@ -170,70 +230,70 @@ var emptyFormat string
 
 // Infof ...
 func Infof(format string, args ...interface{}) {
-	if llevel.Load() >= 1 {
+	if enabled(1) {
 		log(1, "INFO", "\x1b[36m", true, format, args...)
 	}
 }
 
 // Info ...
 func Info(args ...interface{}) {
-	if llevel.Load() >= 1 {
+	if enabled(1) {
 		log(1, "INFO", "\x1b[36m", false, emptyFormat, args...)
 	}
 }
 
 // HTTPf ...
 func HTTPf(format string, args ...interface{}) {
-	if llevel.Load() >= 1 {
+	if enabled(1) {
 		log(1, "HTTP", "\x1b[1m\x1b[30m", true, format, args...)
 	}
 }
 
 // HTTP ...
 func HTTP(args ...interface{}) {
-	if llevel.Load() >= 1 {
+	if enabled(1) {
 		log(1, "HTTP", "\x1b[1m\x1b[30m", false, emptyFormat, args...)
 	}
 }
 
 // Errorf ...
 func Errorf(format string, args ...interface{}) {
-	if llevel.Load() >= 1 {
+	if enabled(1) {
 		log(1, "ERRO", "\x1b[1m\x1b[31m", true, format, args...)
 	}
 }
 
 // Error ..
 func Error(args ...interface{}) {
-	if llevel.Load() >= 1 {
+	if enabled(1) {
 		log(1, "ERRO", "\x1b[1m\x1b[31m", false, emptyFormat, args...)
 	}
 }
 
 // Warnf ...
 func Warnf(format string, args ...interface{}) {
-	if llevel.Load() >= 1 {
+	if enabled(1) {
 		log(2, "WARN", "\x1b[33m", true, format, args...)
 	}
 }
 
 // Warn ...
 func Warn(args ...interface{}) {
-	if llevel.Load() >= 1 {
+	if enabled(1) {
 		log(2, "WARN", "\x1b[33m", false, emptyFormat, args...)
 	}
 }
 
 // Debugf ...
 func Debugf(format string, args ...interface{}) {
-	if llevel.Load() >= 3 {
+	if enabled(3) {
 		log(3, "DEBU", "\x1b[35m", true, format, args...)
 	}
 }
 
 // Debug ...
 func Debug(args ...interface{}) {
-	if llevel.Load() >= 3 {
+	if enabled(3) {
 		log(3, "DEBU", "\x1b[35m", false, emptyFormat, args...)
 	}
 }
@@ -186,6 +186,41 @@ func TestLogJSON(t *testing.T) {
 	}
 }
 
+func TestSubscribe(t *testing.T) {
+	f := &bytes.Buffer{}
+	SetLogJSON(false)
+	SetOutput(f)
+	SetLevel(1)
+	var entries []Entry
+	unsubscribe := Subscribe(func(e Entry) {
+		entries = append(entries, e)
+	})
+	Infof("hello %v", "everyone")
+	Debug("not written")
+	Warnf("careful")
+	unsubscribe()
+	Error("not subscribed")
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	for i, expect := range []Entry{
+		{Level: "info", Message: "hello everyone"},
+		{Level: "debug", Message: "not written"},
+		{Level: "warn", Message: "careful"},
+	} {
+		if entries[i].Level != expect.Level ||
+			entries[i].Message != expect.Message {
+			t.Fatalf("expected %v, got %v", expect, entries[i])
+		}
+	}
+	// the output keeps its own level
+	if strings.Contains(f.String(), "not written") ||
+		strings.Contains(f.String(), "careful") ||
+		!strings.Contains(f.String(), "not subscribed") {
+		t.Fatalf("unexpected output '%s'", f.String())
+	}
+}
+
 func BenchmarkLogPrintf(t *testing.B) {
 	SetLogJSON(false)
 	SetLevel(1)
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var errServerBusy = errors.New("server busy")
+
+// heavyReadCommands are the read commands that may scan many objects. These
+// are limited by the heavy-read-limit config, while all other commands are
+// not.
+var heavyReadCommands = map[string]bool{
+	"nearby": true, "within": true, "intersects": true, "search": true,
+	"scan": true, "density": true, "intersection": true, "lengthwithin": true,
+}
+
+// readLimiter caps the number of heavy reads that run at the same time.
+// Reads that are over the cap wait in line for a slot.
+type readLimiter struct {
+	mu      sync.Mutex
+	running int
+	waiters []chan struct{}
+}
+
+// acquire takes a slot, waiting up to the provided duration for one to free
+// up. Returns false when no slot was taken.
+func (rl *readLimiter) acquire(limit int, wait time.Duration) bool {
+	rl.mu.Lock()
+	if rl.running < limit {
+		rl.running++
+		rl.mu.Unlock()
+		return true
+	}
+	if wait <= 0 {
+		rl.mu.Unlock()
+		return false
+	}
+	ch := make(chan struct{})
+	rl.waiters = append(rl.waiters, ch)
+	rl.mu.Unlock()
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ch:
+		return true
+	case <-t.C:
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for i, w := range rl.waiters {
+		if w == ch {
+			rl.waiters = append(rl.waiters[:i], rl.waiters[i+1:]...)
+			return false
+		}
+	}
+	// the slot was handed over right as the wait ran out
+	return true
+}
+
+// release frees a slot, handing it to the read that has waited the longest.
+func (rl *readLimiter) release() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if len(rl.waiters) > 0 {
+		close(rl.waiters[0])
+		rl.waiters = rl.waiters[1:]
+		return
+	}
+	rl.running--
+}
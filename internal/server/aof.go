@@ -20,6 +20,18 @@ import (
 	"github.com/tidwall/tile38/internal/log"
 )
 
+// followerLagInterval is how often the backlog of a follower is checked.
+const followerLagInterval = time.Second / 10
+
+// replHeartbeatInterval is how long the aof stream to a follower may be idle
+// before a heartbeat is sent, which lets the follower tell an idle leader
+// from one that it can no longer reach. The waiting streams are woken up
+// often enough by the server loop to keep to it.
+const replHeartbeatInterval = time.Second
+
+// replHeartbeat is the heartbeat, a PING that the follower ignores.
+var replHeartbeat = []byte("*1\r\n$4\r\nPING\r\n")
+
 type errAOFHook struct {
 	err error
 }
@@ -29,17 +41,21 @@ func (err errAOFHook) Error() string {
 }
 
 func (s *Server) loadAOF() (err error) {
-	fi, err := s.aof.Stat()
+	rd, err := s.aof.NewReader(0)
 	if err != nil {
 		return err
 	}
+	defer rd.Close()
+	size := s.aof.Size()
 	start := time.Now()
 	var count int
+	// loaded commands do not record field changes
+	defer s.seedTracks()
 	defer func() {
 		d := time.Since(start)
 		ps := float64(count) / (float64(d) / float64(time.Second))
 		suf := []string{"bytes/s", "KB/s", "MB/s", "GB/s", "TB/s"}
-		bps := float64(fi.Size()) / (float64(d) / float64(time.Second))
+		bps := float64(size) / (float64(d) / float64(time.Second))
 		for i := 0; bps > 1024 && len(suf) > 1; i++ {
 			bps /= 1024
 			suf = suf[1:]
@@ -52,7 +68,7 @@ func (s *Server) loadAOF() (err error) {
 	var args [][]byte
 	var packet [0xFFFF]byte
 	for {
-		n, err := s.aof.Read(packet[:])
+		n, err := rd.Read(packet[:])
 		if err != nil {
 			if err != io.EOF {
 				return err
@@ -67,9 +83,6 @@ func (s *Server) loadAOF() (err error) {
 				if err := s.aof.Truncate(int64(s.aofsz)); err != nil {
 					return err
 				}
-				if _, err := s.aof.Seek(int64(s.aofsz), 0); err != nil {
-					return err
-				}
 			}
 			return nil
 		}
@@ -99,10 +112,19 @@ func (s *Server) loadAOF() (err error) {
 				for _, arg := range args {
 					msg.Args = append(msg.Args, string(arg))
 				}
-				if _, _, err := s.command(&msg, nil); err != nil {
+				if msg.Command() == "publish" {
+					// relayed messages are not published again
+					count++
+					continue
+				}
+				_, d, err := s.command(&msg, nil)
+				if err != nil {
 					if commandErrIsFatal(err) {
 						return err
 					}
+				} else if d.updated {
+					// later writes still clear or move the tombstones
+					s.recordTombstones(&d)
 				}
 				count++
 			}
@@ -122,6 +144,11 @@ func commandErrIsFatal(err error) bool {
 	return !(err == errKeyNotFound || err == errIDNotFound)
 }
 
+// aofFlushDelay is the longest that writes to a compressed aof wait for more
+// data, before they are written as a block that followers can read. Writes
+// that are not yet in a block are lost when the process crashes.
+const aofFlushDelay = 50 * time.Millisecond
+
 // flushAOF flushes all aof buffer data to disk. Set sync to true to sync the
 // fsync the file.
 func (s *Server) flushAOF(sync bool) {
@@ -130,18 +157,27 @@ func (s *Server) flushAOF(sync bool) {
 		if err != nil {
 			panic(err)
 		}
-		// send a broadcast to all sleeping followers
-		s.fcond.Broadcast()
+		if _, err := s.aof.FlushStale(aofFlushDelay); err != nil {
+			panic(err)
+		}
 		if sync {
 			if err := s.aof.Sync(); err != nil {
 				panic(err)
 			}
 		}
+		// send a broadcast to all sleeping followers
+		s.fcond.Broadcast()
 		if cap(s.aofbuf) > 1024*1024*32 {
 			s.aofbuf = make([]byte, 0, 1024*1024*32)
 		} else {
 			s.aofbuf = s.aofbuf[:0]
 		}
+	} else if sync && s.aof != nil && s.aof.Buffered() > 0 {
+		// a compressed aof holds on to data until there's enough for a block
+		if err := s.aof.Sync(); err != nil {
+			panic(err)
+		}
+		s.fcond.Broadcast()
 	}
 }
 
@@ -167,40 +203,64 @@ func (s *Server) writeAOF(args []string, d *commandDetails) error {
 		s.aofsz += len(s.aofbuf) - n
 	}
 
+	if d != nil {
+		// notifications carry the sequence of the write that triggered them
+		s.wseq++
+		d.seq = s.wseq
+		for _, child := range d.children {
+			child.seq = d.seq
+		}
+		s.trackChanges(d)
+		s.recordMovements(d)
+		s.recordTombstones(d)
+		s.recordHistory(d)
+		s.renameKeyDefaults(d)
+		s.recordPreExpire(d)
+	}
+
 	// process geofences
 	if d != nil {
-		// webhook geofences
-		if s.config.followHost() == "" {
-			// for leader only
-			if d.parent {
-				// queue children
-				for _, d := range d.children {
-					if err := s.queueHooks(d); err != nil {
-						return err
-					}
-				}
-			} else {
-				// queue parent
+		if err := s.notifyFences(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyFences sends a change to the hooks, which is only done by a leader,
+// and to the live geofences.
+func (s *Server) notifyFences(d *commandDetails) error {
+	// webhook geofences
+	if s.config.followHost() == "" {
+		// for leader only
+		if d.parent {
+			// queue children
+			for _, d := range d.children {
 				if err := s.queueHooks(d); err != nil {
 					return err
 				}
 			}
+		} else {
+			// queue parent
+			if err := s.queueHooks(d); err != nil {
+				return err
+			}
 		}
+	}
 
-		// live geofences
-		s.lcond.L.Lock()
-		if len(s.lives) > 0 {
-			if d.parent {
-				// queue children
-				s.lstack = append(s.lstack, d.children...)
-			} else {
-				// queue parent
-				s.lstack = append(s.lstack, d)
-			}
-			s.lcond.Broadcast()
+	// live geofences
+	s.lcond.L.Lock()
+	if len(s.lives) > 0 {
+		if d.parent {
+			// queue children
+			s.lstack = append(s.lstack, d.children...)
+		} else {
+			// queue parent
+			s.lstack = append(s.lstack, d)
 		}
-		s.lcond.L.Unlock()
+		s.lcond.Broadcast()
 	}
+	s.lcond.L.Unlock()
 	return nil
 }
 
@@ -270,9 +330,33 @@ func (s *Server) getQueueCandidates(d *commandDetails) []*Hook {
 	for hook := range candidates {
 		ret = append(ret, hook)
 	}
+	s.sortHooks(ret)
 	return ret
 }
 
+// sortHooks orders hooks by their registration when the notify-order is
+// "created", and by name otherwise.
+func (s *Server) sortHooks(hooks []*Hook) {
+	if s.config.notifyOrder() == "created" {
+		sort.Slice(hooks, func(i, j int) bool {
+			return hooks[i].created < hooks[j].created
+		})
+	} else {
+		sort.Slice(hooks, func(i, j int) bool {
+			return hooks[i].Name < hooks[j].Name
+		})
+	}
+}
+
+// sortHookMsgs sorts notification messages by their detect and hook fields
+// when the notify-order is "detect". Otherwise the messages are left in the
+// order of their hooks.
+func (s *Server) sortHookMsgs(msgs []string) {
+	if len(msgs) > 1 && s.config.notifyOrder() == "detect" {
+		sortMsgs(msgs)
+	}
+}
+
 func (s *Server) queueHooks(d *commandDetails) error {
 	// Create the slices that will store all messages and hooks
 	var cmsgs, wmsgs []string
@@ -281,9 +365,13 @@ func (s *Server) queueHooks(d *commandDetails) error {
 	// Compile a slice of potential hook recipients
 	candidates := s.getQueueCandidates(d)
 	for _, hook := range candidates {
+		if hook.Fence.population > 0 {
+			// Population hooks only send periodic counts.
+			continue
+		}
 		// Calculate all matching fence messages for all candidates and append
 		// them to the appropriate message slice
-		msgs := FenceMatch(hook.Name, hook.ScanWriter, hook.Fence, hook.Metas, d)
+		msgs := hookMatch(hook, hook.ScanWriter, d)
 		if len(msgs) > 0 {
 			if hook.channel {
 				cmsgs = append(cmsgs, msgs...)
@@ -294,23 +382,29 @@ func (s *Server) queueHooks(d *commandDetails) error {
 		}
 	}
 
+	return s.sendHookMsgs(cmsgs, wmsgs, whooks)
+}
+
+// sendHookMsgs publishes the channel messages and queues the webhook messages
+// for delivery.
+func (s *Server) sendHookMsgs(cmsgs, wmsgs []string, whooks []*Hook) error {
 	// Return nil if there are no messages to be sent
 	if len(cmsgs)+len(wmsgs) == 0 {
 		return nil
 	}
 
 	// Sort both message channel and webhook message slices
-	if len(cmsgs) > 1 {
-		sortMsgs(cmsgs)
-	}
-	if len(wmsgs) > 1 {
-		sortMsgs(wmsgs)
-	}
+	s.sortHookMsgs(cmsgs)
+	s.sortHookMsgs(wmsgs)
 
 	// Publish all channel messages if any exist
 	if len(cmsgs) > 0 {
 		for _, m := range cmsgs {
-			s.Publish(gjson.Get(m, "hook").String(), m)
+			channel := gjson.Get(m, "hook").String()
+			s.Publish(channel, m)
+			if err := s.relayPublish(channel, m); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -431,6 +525,130 @@ func (s *Server) cmdAOFMD5(msg *Message) (resp.Value, error) {
 	return resp.SimpleStringValue(sum), nil
 }
 
+// maxAOFRange is the largest range of the aof, in bytes, that AOFRANGE
+// returns. Larger ranges are read with more than one call.
+const maxAOFRange = 16 * 1024 * 1024
+
+// AOFRANGE start end
+func (s *Server) cmdAOFRANGE(msg *Message) (resp.Value, error) {
+	start := time.Now()
+	if s.aof == nil {
+		return retrerr(errors.New("aof disabled"))
+	}
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 3 {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	from, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || from < 0 {
+		return retrerr(errInvalidArgument(args[1]))
+	}
+	to, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil || to < from {
+		return retrerr(errInvalidArgument(args[2]))
+	}
+	if to-from > maxAOFRange {
+		return retrerr(fmt.Errorf("range is too big, the limit is %d bytes",
+			maxAOFRange))
+	}
+
+	// >> Operation
+
+	if s.shrinking {
+		// the positions change when the shrunk aof replaces the current one
+		return retrerr(errors.New("aof shrink in progress"))
+	}
+	if size := s.aof.Size(); to > size {
+		return retrerr(fmt.Errorf(
+			"range is outside of the aof, the aof_size is %d", size))
+	}
+
+	// The commands are read a packet at a time and go straight into the
+	// response, so that the range isn't held in memory twice.
+	var buf []byte
+	var vals []resp.Value
+	var ncmds int
+	if msg.OutputType == JSON {
+		buf = append(buf, `{"ok":true,"commands":[`...)
+	}
+	if to > from {
+		rd, err := s.aof.NewReader(from)
+		if err != nil {
+			return retrerr(err)
+		}
+		defer rd.Close()
+		lr := io.LimitReader(rd, to-from)
+		var left []byte
+		var cargs [][]byte
+		var packet [0xFFFF]byte
+		for {
+			n, err := lr.Read(packet[:])
+			if err != nil {
+				if err != io.EOF {
+					return retrerr(err)
+				}
+				break
+			}
+			data := packet[:n]
+			if len(left) > 0 {
+				data = append(left, data...)
+			} else if ncmds == 0 && data[0] != '*' {
+				return retrerr(errors.New(
+					"start is not at the beginning of a command"))
+			}
+			for {
+				var complete bool
+				complete, cargs, _, data, err = redcon.ReadNextCommand(data,
+					cargs[:0])
+				if err != nil {
+					return retrerr(err)
+				}
+				if !complete {
+					break
+				}
+				if msg.OutputType == JSON {
+					if ncmds > 0 {
+						buf = append(buf, ',')
+					}
+					buf = append(buf, '[')
+					for i, arg := range cargs {
+						if i > 0 {
+							buf = append(buf, ',')
+						}
+						buf = appendJSONString(buf, string(arg))
+					}
+					buf = append(buf, ']')
+				} else {
+					cvals := make([]resp.Value, len(cargs))
+					for i, arg := range cargs {
+						cvals[i] = resp.StringValue(string(arg))
+					}
+					vals = append(vals, resp.ArrayValue(cvals))
+				}
+				ncmds++
+			}
+			left = append(left[:0], data...)
+		}
+		if len(left) > 0 {
+			return retrerr(errors.New("end is not at the end of a command"))
+		}
+	}
+
+	// >> Response
+
+	switch msg.OutputType {
+	case JSON:
+		buf = append(buf, `],"elapsed":"`+time.Since(start).String()+`"}`...)
+		return resp.StringValue(string(buf)), nil
+	case RESP:
+		return resp.ArrayValue(vals), nil
+	}
+	return NOMessage, nil
+}
+
 // AOF pos
 func (s *Server) cmdAOF(msg *Message) (resp.Value, error) {
 	if s.aof == nil {
@@ -451,18 +669,7 @@ func (s *Server) cmdAOF(msg *Message) (resp.Value, error) {
 
 	// >> Operation
 
-	f, err := os.Open(s.aof.Name())
-	if err != nil {
-		return retrerr(err)
-	}
-	defer f.Close()
-
-	n, err := f.Seek(0, 2)
-	if err != nil {
-		return retrerr(err)
-	}
-
-	if n < pos {
+	if s.aof.Size() < pos {
 		return retrerr(errors.New(
 			"pos is too big, must be less that the aof_size of leader"))
 	}
@@ -476,13 +683,16 @@ func (s *Server) cmdAOF(msg *Message) (resp.Value, error) {
 
 func (s *Server) liveAOF(pos int64, conn net.Conn, rd *PipelineReader, msg *Message) error {
 	s.mu.RLock()
-	f, err := os.Open(s.aof.Name())
+	aof := s.aof
+	f, err := aof.NewReader(pos)
 	s.mu.RUnlock()
 	if err != nil {
 		return err
 	}
+	ac := &aofConn{rd: f, aof: aof, opened: time.Now()}
+	ac.sent.Store(pos)
 	s.mu.Lock()
-	s.aofconnM[conn] = f
+	s.aofconnM[conn] = ac
 	s.mu.Unlock()
 	defer func() {
 		s.mu.Lock()
@@ -495,9 +705,6 @@ func (s *Server) liveAOF(pos int64, conn net.Conn, rd *PipelineReader, msg *Mess
 	if _, err := conn.Write([]byte("+OK\r\n")); err != nil {
 		return err
 	}
-	if _, err := f.Seek(pos, 0); err != nil {
-		return err
-	}
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
@@ -509,20 +716,56 @@ func (s *Server) liveAOF(pos int64, conn net.Conn, rd *PipelineReader, msg *Mess
 		// Any incoming message should end the connection
 		rd.ReadMessages()
 	}()
-	_, err = io.Copy(conn, f)
-	if err != nil {
+	// The bytes sent are counted before compression, because the backlog
+	// is measured in aof bytes.
+	var w io.Writer = conn
+	var zw replCompressWriter
+	if codec := s.replCompression(conn); codec != "" {
+		zw = newReplCompressWriter(codec, conn)
+		w = zw
+	}
+	flush := func() error {
+		if zw == nil {
+			return nil
+		}
+		return zw.Flush()
+	}
+	wr := &sentWriter{w, &ac.sent}
+	if _, err := io.Copy(wr, f); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
 		return err
 	}
 
+	// The follower has caught up, from here on its backlog is watched.
+	ac.online.Store(true)
+	done := make(chan struct{})
+	defer close(done)
+	go s.watchFollowerLag(ac, conn, done)
+
 	b := make([]byte, 4096*2)
+	lastSent := time.Now()
 	for {
 		n, err := f.Read(b)
 		if n > 0 {
-			if _, err := conn.Write(b[:n]); err != nil {
+			if _, err := wr.Write(b[:n]); err != nil {
 				return err
 			}
+			lastSent = time.Now()
 		}
 		if err == io.EOF {
+			if time.Since(lastSent) >= replHeartbeatInterval {
+				// The heartbeat isn't part of the aof, so it's not counted
+				// as sent.
+				if _, err := w.Write(replHeartbeat); err != nil {
+					return err
+				}
+				lastSent = time.Now()
+			}
+			if err := flush(); err != nil {
+				return err
+			}
 			s.fcond.L.Lock()
 			s.fcond.Wait()
 			s.fcond.L.Unlock()
@@ -536,3 +779,46 @@ func (s *Server) liveAOF(pos int64, conn net.Conn, rd *PipelineReader, msg *Mess
 		}
 	}
 }
+
+// watchFollowerLag checks the backlog of a follower, which is the number of
+// bytes that the aof has grown past what was sent to it. A follower that goes
+// over the follower-max-lag is disconnected, and it will reconnect and catch
+// up again. With the "warn" action the lag is only logged.
+// The check runs apart from the sending, because a follower that stops
+// reading blocks the writes to its connection.
+func (s *Server) watchFollowerLag(ac *aofConn, conn net.Conn,
+	done chan struct{},
+) {
+	var lagging bool
+	t := time.NewTicker(followerLagInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+		max := s.config.followerMaxLag()
+		if max <= 0 {
+			lagging = false
+			continue
+		}
+		lag := ac.backlog()
+		if lag <= max {
+			lagging = false
+			continue
+		}
+		if s.config.followerLagAction() == "warn" {
+			if !lagging {
+				log.Warnf("follower %s is %d bytes behind", conn.RemoteAddr(), lag)
+				lagging = true
+			}
+			continue
+		}
+		log.Warnf("disconnecting follower %s, %d bytes behind",
+			conn.RemoteAddr(), lag)
+		s.statsSlowFollowers.Add(1)
+		conn.Close()
+		return
+	}
+}
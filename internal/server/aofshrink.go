@@ -1,13 +1,14 @@
 package server
 
 import (
-	"math"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/tidwall/btree"
+	"github.com/tidwall/tile38/internal/aoffile"
 	"github.com/tidwall/tile38/internal/collection"
 	"github.com/tidwall/tile38/internal/field"
 	"github.com/tidwall/tile38/internal/log"
@@ -18,6 +19,21 @@ const maxkeys = 8
 const maxids = 32
 const maxchunk = 4 * 1024 * 1024
 
+// appendAOFCommand appends a command to an aof buffer.
+func appendAOFCommand(buf []byte, args ...string) []byte {
+	buf = append(buf, '*')
+	buf = append(buf, strconv.FormatInt(int64(len(args)), 10)...)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = append(buf, strconv.FormatInt(int64(len(arg)), 10)...)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	return buf
+}
+
 func (s *Server) aofshrink() {
 	start := time.Now()
 	s.mu.Lock()
@@ -38,7 +54,8 @@ func (s *Server) aofshrink() {
 	}()
 
 	err := func() error {
-		f, err := os.Create(s.opts.AppendFileName + "-shrink")
+		f, err := aoffile.Create(s.opts.AppendFileName+"-shrink",
+			s.opts.AppendCompress)
 		if err != nil {
 			return err
 		}
@@ -114,13 +131,13 @@ func (s *Server) aofshrink() {
 								return true
 							})
 							if o.Expires() != 0 {
-								ttl := math.Floor(float64(o.Expires()-now)/float64(time.Second)*10) / 10
-								if ttl < 0.1 {
+								ttl := (o.Expires() - now) / int64(time.Millisecond)
+								if ttl < 1 {
 									// always leave a little bit of ttl.
-									ttl = 0.1
+									ttl = 1
 								}
-								values = append(values, "ex")
-								values = append(values, strconv.FormatFloat(ttl, 'f', -1, 64))
+								values = append(values, "px")
+								values = append(values, strconv.FormatInt(ttl, 10))
 							}
 							if objIsSpatial(o.Geo()) {
 								values = append(values, "object")
@@ -130,17 +147,7 @@ func (s *Server) aofshrink() {
 								values = append(values, o.Geo().String())
 							}
 
-							// append the values to the aof buffer
-							aofbuf = append(aofbuf, '*')
-							aofbuf = append(aofbuf, strconv.FormatInt(int64(len(values)), 10)...)
-							aofbuf = append(aofbuf, '\r', '\n')
-							for _, value := range values {
-								aofbuf = append(aofbuf, '$')
-								aofbuf = append(aofbuf, strconv.FormatInt(int64(len(value)), 10)...)
-								aofbuf = append(aofbuf, '\r', '\n')
-								aofbuf = append(aofbuf, value...)
-								aofbuf = append(aofbuf, '\r', '\n')
-							}
+							aofbuf = appendAOFCommand(aofbuf, values...)
 
 							// increment the object count
 							count++
@@ -164,12 +171,20 @@ func (s *Server) aofshrink() {
 		func() {
 			s.mu.Lock()
 			defer s.mu.Unlock()
-			hnames = make([]string, 0, s.hooks.Len())
+			hooks := make([]*Hook, 0, s.hooks.Len())
 			s.hooks.Walk(func(v []interface{}) {
 				for _, v := range v {
-					hnames = append(hnames, v.(*Hook).Name)
+					hooks = append(hooks, v.(*Hook))
 				}
 			})
+			// in registration order, so it's kept when the aof is loaded
+			sort.Slice(hooks, func(i, j int) bool {
+				return hooks[i].created < hooks[j].created
+			})
+			hnames = make([]string, len(hooks))
+			for i, hook := range hooks {
+				hnames[i] = hook.Name
+			}
 		}()
 		var hookHint btree.PathHint
 		for _, name := range hnames {
@@ -193,25 +208,73 @@ func (s *Server) aofshrink() {
 				for _, meta := range hook.Metas {
 					values = append(values, "meta", meta.Name, meta.Value)
 				}
+				if hook.format != "" {
+					values = append(values, "format", hook.format)
+				}
 				if !hook.expires.IsZero() {
 					ex := float64(time.Until(hook.expires)) / float64(time.Second)
 					values = append(values, "ex",
 						strconv.FormatFloat(ex, 'f', 1, 64))
 				}
 				values = append(values, hook.Message.Args...)
-				// append the values to the aof buffer
-				aofbuf = append(aofbuf, '*')
-				aofbuf = append(aofbuf, strconv.FormatInt(int64(len(values)), 10)...)
-				aofbuf = append(aofbuf, '\r', '\n')
-				for _, value := range values {
-					aofbuf = append(aofbuf, '$')
-					aofbuf = append(aofbuf, strconv.FormatInt(int64(len(value)), 10)...)
-					aofbuf = append(aofbuf, '\r', '\n')
-					aofbuf = append(aofbuf, value...)
-					aofbuf = append(aofbuf, '\r', '\n')
-				}
+				aofbuf = appendAOFCommand(aofbuf, values...)
 			}()
 		}
+
+		// load tracked fields, kept geometries, default fields, indexed
+		// fields, deduped keys, pre-expire lead times, tombstones, and
+		// registered commands
+		func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			for key, tk := range s.tracks {
+				values := append([]string{"track", key}, tk.fields...)
+				aofbuf = appendAOFCommand(aofbuf, values...)
+			}
+			// keys that keep previous geometries
+			for key := range s.moves {
+				aofbuf = appendAOFCommand(aofbuf, "keepprev", key, "yes")
+			}
+			// default fields of keys
+			for key, defaults := range s.defaults {
+				values := []string{"keydefaults", key}
+				defaults.Scan(func(f field.Field) bool {
+					values = append(values, f.Name(), f.Value().Data())
+					return true
+				})
+				aofbuf = appendAOFCommand(aofbuf, values...)
+			}
+			// indexed fields of keys
+			for key, names := range s.indexes {
+				for name := range names {
+					aofbuf = appendAOFCommand(aofbuf, "setindex", key, name)
+				}
+			}
+			// keys that dedupe their geometries
+			for key := range s.dedups {
+				aofbuf = appendAOFCommand(aofbuf, "dedup", key, "yes")
+			}
+			// keys with a pre-expire lead time
+			for key, lead := range s.preexps {
+				aofbuf = appendAOFCommand(aofbuf, "preexpire", key,
+					strconv.FormatFloat(lead.Seconds(), 'f', -1, 64))
+			}
+			// deleted ids that are still retained
+			for key, tombs := range s.tombs {
+				for id, ts := range tombs {
+					aofbuf = appendAOFCommand(aofbuf, "tombstone", key, id,
+						strconv.FormatInt(ts, 10))
+				}
+			}
+			// commands that were added with COMMANDREGISTER
+			for name, uc := range s.userCommands() {
+				values := []string{"commandregister", name, uc.script}
+				if uc.readonly {
+					values = append(values, "readonly")
+				}
+				aofbuf = appendAOFCommand(aofbuf, values...)
+			}
+		}()
 		if len(aofbuf) > 0 {
 			if _, err := f.Write(aofbuf); err != nil {
 				return err
@@ -245,17 +308,7 @@ func (s *Server) aofshrink() {
 
 			aofbuf = aofbuf[:0]
 			for _, values := range s.shrinklog {
-				// append the values to the aof buffer
-				aofbuf = append(aofbuf, '*')
-				aofbuf = append(aofbuf, strconv.FormatInt(int64(len(values)), 10)...)
-				aofbuf = append(aofbuf, '\r', '\n')
-				for _, value := range values {
-					aofbuf = append(aofbuf, '$')
-					aofbuf = append(aofbuf, strconv.FormatInt(int64(len(value)), 10)...)
-					aofbuf = append(aofbuf, '\r', '\n')
-					aofbuf = append(aofbuf, value...)
-					aofbuf = append(aofbuf, '\r', '\n')
-				}
+				aofbuf = appendAOFCommand(aofbuf, values...)
 			}
 			if _, err := f.Write(aofbuf); err != nil {
 				return err
@@ -281,16 +334,11 @@ func (s *Server) aofshrink() {
 			if err := os.Rename(s.opts.AppendFileName+"-shrink", s.opts.AppendFileName); err != nil {
 				log.Fatalf("shrink rename fatal operation: %v", err)
 			}
-			s.aof, err = os.OpenFile(s.opts.AppendFileName, os.O_CREATE|os.O_RDWR, 0600)
+			s.aof, err = aoffile.Open(s.opts.AppendFileName, s.opts.AppendCompress)
 			if err != nil {
 				log.Fatalf("shrink openfile fatal operation: %v", err)
 			}
-			var n int64
-			n, err = s.aof.Seek(0, 2)
-			if err != nil {
-				log.Fatalf("shrink seek end fatal operation: %v", err)
-			}
-			s.aofsz = int(n)
+			s.aofsz = int(s.aof.Size())
 
 			os.Remove(s.opts.AppendFileName + "-bak") // ignore error
 
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/buffer"
+)
+
+// maxBufferSteps is the most segments that the circle around a point may
+// have.
+const maxBufferSteps = 1024
+
+// BUFFER key id meters [STEPS count]
+// BUFFER (POINT lat lon)|(OBJECT geojson)|(BOUNDS ...)|(HASH ...)|... meters
+// [STEPS count]
+func (s *Server) cmdBUFFER(msg *Message) (resp.Value, error) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) < 4 {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	var g geojson.Object
+	var vs []string
+	switch strings.ToLower(args[1]) {
+	case "point", "object", "bounds", "hash", "circle", "sector", "quadkey",
+		"tile":
+		// a raw geometry, which is parsed like the area of a search
+		var err error
+		vs, g, err = s.parseArea(args[1:], false)
+		if err != nil {
+			return retrerr(err)
+		}
+	default:
+		col, _ := s.cols.Get(args[1])
+		if col == nil {
+			return retrerr(errKeyNotFound)
+		}
+		o := col.Get(args[2])
+		if o == nil {
+			return retrerr(errIDNotFound)
+		}
+		g = o.Geo()
+		vs = args[3:]
+	}
+	if len(vs) == 0 {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	meters, err := strconv.ParseFloat(vs[0], 64)
+	if err != nil || meters < 0 {
+		return retrerr(errInvalidArgument(vs[0]))
+	}
+	vs = vs[1:]
+	steps := buffer.DefaultSteps
+	if len(vs) > 0 {
+		if len(vs) != 2 || strings.ToLower(vs[0]) != "steps" {
+			return retrerr(errInvalidArgument(vs[0]))
+		}
+		steps, err = strconv.Atoi(vs[1])
+		if err != nil || steps < 3 || steps > maxBufferSteps {
+			return retrerr(errInvalidArgument(vs[1]))
+		}
+	}
+
+	// >> Operation
+
+	// the same buffer that the BUFFER option of the searches uses
+	g, err = buffer.SimpleSteps(g, meters, steps)
+	if err != nil {
+		return retrerr(err)
+	}
+
+	// >> Response
+
+	switch msg.OutputType {
+	case JSON:
+		var b []byte
+		b = append(b, `{"ok":true,"object":`...)
+		b = g.AppendJSON(b)
+		b = append(b, `,"elapsed":"`+time.Since(start).String()+`"}`...)
+		return resp.BytesValue(b), nil
+	case RESP:
+		return resp.StringValue(g.String()), nil
+	}
+	return NOMessage, nil
+}
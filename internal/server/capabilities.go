@@ -0,0 +1,93 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/core"
+	"github.com/tidwall/tile38/internal/endpoint"
+)
+
+// capabilitiesProtocol is the version of the client protocol. It's bumped
+// when a response changes in a way that clients need to know about.
+const capabilitiesProtocol = 1
+
+// outputCapabilities are the output types that can be used with OUTPUT.
+var outputCapabilities = []string{"json", "resp"}
+
+// searchCapabilities are the search commands.
+var searchCapabilities = []string{
+	"intersects", "nearby", "scan", "search", "within",
+}
+
+// modifierCapabilities are the optional tokens of the search commands.
+// Update this list when adding a new search token.
+var modifierCapabilities = []string{
+	"along", "arm", "asc", "asof", "bounds", "buffer", "clip", "commands",
+	"components", "count", "csv", "cursor", "delta", "desc", "detect",
+	"distance", "dwell", "features", "fence", "hashes", "heading", "ids",
+	"ifnonematch", "include_deleted", "join", "limit", "match", "maxdist",
+	"mvt", "ndistinct", "nodwell", "nofields", "objects", "points",
+	"population", "simplify", "since", "sparse", "strict", "ttlbetween",
+	"where", "wherechanged", "whereeval", "whereevalsha", "wherein",
+	"wherejson", "withetag", "withscore", "withzone", "wkb", "wkt",
+}
+
+// capabilityCommands returns the names of the commands that the server
+// supports.
+func capabilityCommands() []string {
+	cmds := make([]string, 0, len(core.Commands))
+	for name := range core.Commands {
+		cmds = append(cmds, name)
+	}
+	sort.Strings(cmds)
+	return cmds
+}
+
+// CAPABILITIES
+func (s *Server) cmdCAPABILITIES(msg *Message) (resp.Value, error) {
+	start := time.Now()
+
+	// >> Args
+
+	if len(msg.Args) != 1 {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+
+	// >> Operation
+
+	cmds := capabilityCommands()
+
+	// >> Response
+
+	if msg.OutputType == JSON {
+		var b []byte
+		b = append(b, `{"ok":true,"capabilities":{"version":`...)
+		b = appendJSONString(b, core.Version)
+		b = append(b, `,"protocol":`...)
+		b = strconv.AppendInt(b, capabilitiesProtocol, 10)
+		b = append(b, `,"outputs":`...)
+		b = appendJSONStrings(b, outputCapabilities)
+		b = append(b, `,"endpoints":`...)
+		b = appendJSONStrings(b, endpoint.Schemes)
+		b = append(b, `,"searches":`...)
+		b = appendJSONStrings(b, searchCapabilities)
+		b = append(b, `,"modifiers":`...)
+		b = appendJSONStrings(b, modifierCapabilities)
+		b = append(b, `,"commands":`...)
+		b = appendJSONStrings(b, cmds)
+		b = append(b, `},"elapsed":"`+time.Since(start).String()+`"}`...)
+		return resp.StringValue(string(b)), nil
+	}
+	return resp.ArrayValue([]resp.Value{
+		resp.StringValue("version"), resp.StringValue(core.Version),
+		resp.StringValue("protocol"), resp.IntegerValue(capabilitiesProtocol),
+		resp.StringValue("outputs"), respStrings(outputCapabilities),
+		resp.StringValue("endpoints"), respStrings(endpoint.Schemes),
+		resp.StringValue("searches"), respStrings(searchCapabilities),
+		resp.StringValue("modifiers"), respStrings(modifierCapabilities),
+		resp.StringValue("commands"), respStrings(cmds),
+	}), nil
+}
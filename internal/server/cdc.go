@@ -0,0 +1,88 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/tile38/core"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+// hookMatch returns the messages that a change sends to a hook, in the format
+// of the hook.
+func hookMatch(hook *Hook, sw *scanWriter, d *commandDetails) []string {
+	msgs := FenceMatch(hook.Name, sw, hook.Fence, hook.Metas, d)
+	if hook.format != "debezium" || len(msgs) == 0 {
+		return msgs
+	}
+	if d.command == "preexpire" {
+		// not a change, so there's no event for it
+		return nil
+	}
+	// one change event is sent for the change, however many fence
+	// detections it made
+	return []string{string(appendDebeziumEvent(nil, sw.s, hook, d))}
+}
+
+// appendDebeziumEvent appends a change event for a write, using the envelope
+// of Debezium. The op is "c" for new objects, "u" for updated objects, "d"
+// for deleted objects, and "t" for a dropped collection. The hook name and
+// meta are kept in the event, like for other hook messages.
+func appendDebeziumEvent(b []byte, s *Server, hook *Hook, d *commandDetails,
+) []byte {
+	var op string
+	var before, after *object.Object
+	switch d.command {
+	case "drop":
+		op = "t"
+	case "del":
+		op, before = "d", d.obj
+	default:
+		op, before, after = "u", d.old, d.obj
+		if d.old == nil && d.command == "set" {
+			op = "c"
+		}
+	}
+	b = append(b, `{"op":"`+op+`"`...)
+	b = appendHookDetails(b, hook.Name, hook.Metas)
+	b = append(b, `,"before":`...)
+	if before != nil {
+		b = appendExportObject(b, before)
+	} else {
+		b = append(b, "null"...)
+	}
+	b = append(b, `,"after":`...)
+	if after != nil {
+		b = appendExportObject(b, after)
+	} else {
+		b = append(b, "null"...)
+	}
+	b = append(b, `,"source":{"version":`...)
+	b = appendJSONString(b, core.Version)
+	b = append(b, `,"connector":"tile38","name":`...)
+	b = appendJSONString(b, hook.Name)
+	b = append(b, `,"ts_ms":`...)
+	b = strconv.AppendInt(b, d.timestamp.UnixMilli(), 10)
+	b = append(b, `,"collection":`...)
+	b = appendJSONString(b, d.key)
+	if s != nil && s.config.notifySequence() {
+		b = append(b, `,"seq":`...)
+		b = strconv.AppendUint(b, d.seq, 10)
+	}
+	b = append(b, `},"ts_ms":`...)
+	b = strconv.AppendInt(b, time.Now().UnixMilli(), 10)
+	return append(b, '}')
+}
+
+// parseHookFormat returns the format for a FORMAT argument. The default
+// format, which is the usual fence message, is empty.
+func parseHookFormat(name string) (string, bool) {
+	switch strings.ToLower(name) {
+	case "json":
+		return "", true
+	case "debezium":
+		return "debezium", true
+	}
+	return "", false
+}
@@ -5,8 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
-	"time"
+	"math"
 
 	"github.com/tidwall/resp"
 	"github.com/tidwall/tile38/internal/log"
@@ -17,29 +16,20 @@ func (s *Server) checksum(pos, size int64) (sum string, err error) {
 	if pos+size > int64(s.aofsz) {
 		return "", io.EOF
 	}
-	var f *os.File
-	f, err = os.Open(s.aof.Name())
-	if err != nil {
-		return
-	}
-	defer f.Close()
 	sumr := md5.New()
 	err = func() error {
 		if size == 0 {
-			n, err := f.Seek(int64(s.aofsz), 0)
-			if err != nil {
-				return err
-			}
-			if pos >= n {
+			if pos >= s.aof.Size() {
 				return io.EOF
 			}
 			return nil
 		}
-		_, err = f.Seek(pos, 0)
+		rd, err := s.aof.NewReader(pos)
 		if err != nil {
 			return err
 		}
-		_, err = io.CopyN(sumr, f, size)
+		defer rd.Close()
+		_, err = io.CopyN(sumr, rd, size)
 		if err != nil {
 			return err
 		}
@@ -91,25 +81,17 @@ func (s *Server) matchChecksums(conn *RESPConn, pos, size int64) (match bool, er
 	return csum == sum, nil
 }
 
-// getEndOfLastValuePositionInFile is a very slow operation because it reads the file
-// backwards on byte at a time. Eek. It seek+read, seek+read, etc.
-func getEndOfLastValuePositionInFile(fname string, startPos int64) (int64, error) {
+// getEndOfLastValuePosition is a very slow operation because it reads the
+// file backwards one byte at a time. Eek.
+func getEndOfLastValuePosition(f io.ReaderAt, startPos int64) (int64, error) {
 	pos := startPos
-	f, err := os.Open(fname)
-	if err != nil {
-		return 0, err
-	}
-	defer f.Close()
 	readByte := func() (byte, error) {
 		if pos <= 0 {
 			return 0, io.EOF
 		}
 		pos--
-		if _, err := f.Seek(pos, 0); err != nil {
-			return 0, err
-		}
 		b := make([]byte, 1)
-		if n, err := f.Read(b); err != nil {
+		if n, err := f.ReadAt(b, pos); err != nil {
 			return 0, err
 		} else if n != 1 {
 			return 0, errors.New("invalid read")
@@ -122,10 +104,7 @@ func getEndOfLastValuePositionInFile(fname string, startPos int64) (int64, error
 			return 0, err
 		}
 		if c == '*' {
-			if _, err := f.Seek(pos, 0); err != nil {
-				return 0, err
-			}
-			rd := resp.NewReader(f)
+			rd := resp.NewReader(io.NewSectionReader(f, pos, math.MaxInt64-pos))
 			_, telnet, n, err := rd.ReadMultiBulk()
 			if err != nil || telnet {
 				continue // keep reading backwards
@@ -151,7 +130,7 @@ func (s *Server) followCheckSome(addr string, followc int, auth string,
 		return 0, nil
 	}
 
-	conn, err := DialTimeout(addr, time.Second*2)
+	conn, err := s.dialLeader(addr, s.followUseTLS())
 	if err != nil {
 		return 0, err
 	}
@@ -192,11 +171,8 @@ func (s *Server) followCheckSome(addr string, followc int, auth string,
 		}
 	}
 	fullpos := pos
-	fname := s.aof.Name()
 	if pos == 0 {
-		s.aof.Close()
-		s.aof, err = os.Create(fname)
-		if err != nil {
+		if err := s.aof.Truncate(0); err != nil {
 			log.Fatalf("could not recreate aof, possible data loss. %s", err.Error())
 			return 0, err
 		}
@@ -205,7 +181,7 @@ func (s *Server) followCheckSome(addr string, followc int, auth string,
 
 	// we want to truncate at a command location
 	// search for nearest command
-	pos, err = getEndOfLastValuePositionInFile(s.aof.Name(), fullpos)
+	pos, err = getEndOfLastValuePosition(s.aof, fullpos)
 	if err != nil {
 		return 0, err
 	}
@@ -217,16 +193,10 @@ func (s *Server) followCheckSome(addr string, followc int, auth string,
 	}
 	log.Warnf("truncating aof to %d", pos)
 	// any error below are fatal.
-	s.aof.Close()
-	if err := os.Truncate(fname, pos); err != nil {
+	if err := s.aof.Truncate(pos); err != nil {
 		log.Fatalf("could not truncate aof, possible data loss. %s", err.Error())
 		return 0, err
 	}
-	s.aof, err = os.OpenFile(fname, os.O_CREATE|os.O_RDWR, 0600)
-	if err != nil {
-		log.Fatalf("could not create aof, possible data loss. %s", err.Error())
-		return 0, err
-	}
 	// reset the entire system.
 	log.Infof("reloading aof commands")
 	s.reset()
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -17,7 +18,9 @@ type Client struct {
 	id         int            // unique id
 	replPort   int            // the known replication port for follower connections
 	replAddr   string         // the known replication addr for follower connections
+	replCodec  string         // the compression of the aof stream for follower connections
 	authd      bool           // client has been authenticated
+	replToken  string         // the replication token the client authenticated with
 	outputType Type           // Null, JSON, or RESP
 	remoteAddr string         // original remote address
 	in         InputStream    // input stream
@@ -34,6 +37,10 @@ type Client struct {
 	last   time.Time          // last client request/response, unix nano
 
 	closer io.Closer // used to close the connection
+
+	allowed map[string]bool // RESTRICT commands, nil allows all commands
+
+	withVersion bool // WITHVERSION reads
 }
 
 // Write ...
@@ -210,3 +217,78 @@ func (s *Server) cmdCLIENT(msg *Message, client *Client) (resp.Value, error) {
 		))
 	}
 }
+
+// RESTRICT command [command ...]
+func (s *Server) cmdRESTRICT(msg *Message, client *Client) (resp.Value, error) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) < 2 {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+
+	// >> Operation
+
+	// A connection may only narrow its commands, never widen them.
+	allowed := make(map[string]bool)
+	for _, name := range args[1:] {
+		name = strings.ToLower(name)
+		if client.allowed == nil || client.allowed[name] {
+			allowed[name] = true
+		}
+	}
+	client.allowed = allowed
+
+	// >> Response
+
+	return OKMessage(msg, start), nil
+}
+
+// WITHVERSION yes|no
+func (s *Server) cmdWITHVERSION(msg *Message, client *Client) (resp.Value,
+	error,
+) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 2 {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	var withVersion bool
+	switch strings.ToLower(args[1]) {
+	case "yes":
+		withVersion = true
+	case "no":
+	default:
+		return retrerr(errInvalidArgument(args[1]))
+	}
+
+	// >> Operation
+
+	client.withVersion = withVersion
+
+	// >> Response
+
+	return OKMessage(msg, start), nil
+}
+
+// appendVersion adds the version that a read was evaluated at to its
+// response. The version is the size of the aof, which is the same on the
+// leader and its followers once they've applied the same writes. For JSON
+// it's the "version" member, and for RESP the response becomes an array of
+// the response and the version.
+func appendVersion(res resp.Value, outputType Type, version int) resp.Value {
+	if outputType == JSON {
+		js := res.String()
+		if !strings.HasSuffix(js, "}") {
+			return res
+		}
+		return resp.StringValue(js[:len(js)-1] + `,"version":` +
+			strconv.Itoa(version) + `}`)
+	}
+	return resp.ArrayValue([]resp.Value{res, resp.IntegerValue(version)})
+}
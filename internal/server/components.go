@@ -0,0 +1,163 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/geojson/geo"
+	"github.com/tidwall/geojson/geometry"
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+// component is a group of objects that are connected to each other.
+type component struct {
+	ids  []string
+	rect geometry.Rect
+}
+
+// findComponents returns the connected components of the objects that are
+// within the search area. Two objects are linked when they are no more than
+// dist meters apart, and the links are transitive (single-linkage).
+func (s *Server) findComponents(sw *scanWriter, area geojson.Object,
+	dist float64, msg *Message,
+) ([]component, error) {
+	var objs []*object.Object
+	index := make(map[string]int)
+	var ierr error
+	sw.col.Within(area, 0, nil, msg.Deadline, func(o *object.Object) bool {
+		ok, keepGoing, err := sw.testObject(o)
+		if err != nil {
+			ierr = err
+			return false
+		}
+		if ok {
+			index[o.ID()] = len(objs)
+			objs = append(objs, o)
+		}
+		return keepGoing
+	})
+	if ierr != nil {
+		return nil, ierr
+	}
+
+	// union-find over the matching objects
+	parent := make([]int, len(objs))
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	for i, o := range objs {
+		near := geojson.NewRect(expandRect(o.Rect(), dist))
+		sw.col.Intersects(near, 0, nil, msg.Deadline,
+			func(n *object.Object) bool {
+				j, ok := index[n.ID()]
+				if ok && j > i && o.Geo().Distance(n.Geo()) <= dist {
+					parent[find(j)] = find(i)
+				}
+				return true
+			},
+		)
+	}
+
+	groups := make(map[int]int)
+	var comps []component
+	for i, o := range objs {
+		root := find(i)
+		c, ok := groups[root]
+		if !ok {
+			c = len(comps)
+			groups[root] = c
+			comps = append(comps, component{rect: o.Rect()})
+		}
+		comps[c].ids = append(comps[c].ids, o.ID())
+		comps[c].rect = unionRect(comps[c].rect, o.Rect())
+	}
+	for _, c := range comps {
+		sort.Strings(c.ids)
+	}
+	sort.Slice(comps, func(i, j int) bool {
+		if len(comps[i].ids) != len(comps[j].ids) {
+			return len(comps[i].ids) > len(comps[j].ids)
+		}
+		return comps[i].ids[0] < comps[j].ids[0]
+	})
+	return comps, nil
+}
+
+// expandRect grows a rectangle by a number of meters on all sides.
+func expandRect(rect geometry.Rect, meters float64) geometry.Rect {
+	minLat, minLon, _, _ := geo.RectFromCenter(rect.Min.Y, rect.Min.X, meters)
+	_, _, maxLat, maxLon := geo.RectFromCenter(rect.Max.Y, rect.Max.X, meters)
+	return geometry.Rect{
+		Min: geometry.Point{X: minLon, Y: minLat},
+		Max: geometry.Point{X: maxLon, Y: maxLat},
+	}
+}
+
+func unionRect(a, b geometry.Rect) geometry.Rect {
+	if b.Min.X < a.Min.X {
+		a.Min.X = b.Min.X
+	}
+	if b.Min.Y < a.Min.Y {
+		a.Min.Y = b.Min.Y
+	}
+	if b.Max.X > a.Max.X {
+		a.Max.X = b.Max.X
+	}
+	if b.Max.Y > a.Max.Y {
+		a.Max.Y = b.Max.Y
+	}
+	return a
+}
+
+// writeComponents writes the response for WITHIN ... COMPONENTS.
+func writeComponents(comps []component, msg *Message, start time.Time,
+) (resp.Value, error) {
+	switch msg.OutputType {
+	case JSON:
+		var b []byte
+		b = append(b, `{"ok":true,"components":[`...)
+		for i, c := range comps {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = append(b, `{"ids":`...)
+			b = appendJSONStrings(b, c.ids)
+			b = append(b, `,"bounds":`...)
+			b = appendJSONSimpleBounds(b, geojson.NewRect(c.rect))
+			b = append(b, '}')
+		}
+		b = append(b, `],"count":`...)
+		b = strconv.AppendInt(b, int64(len(comps)), 10)
+		b = append(b, `,"elapsed":"`+time.Since(start).String()+`"}`...)
+		return resp.BytesValue(b), nil
+	case RESP:
+		vals := make([]resp.Value, len(comps))
+		for i, c := range comps {
+			vals[i] = resp.ArrayValue([]resp.Value{
+				respStrings(c.ids),
+				resp.ArrayValue([]resp.Value{
+					resp.ArrayValue([]resp.Value{
+						resp.FloatValue(c.rect.Min.Y),
+						resp.FloatValue(c.rect.Min.X),
+					}),
+					resp.ArrayValue([]resp.Value{
+						resp.FloatValue(c.rect.Max.Y),
+						resp.FloatValue(c.rect.Max.X),
+					}),
+				}),
+			})
+		}
+		return resp.ArrayValue(vals), nil
+	}
+	return NOMessage, nil
+}
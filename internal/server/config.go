@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"os"
 	"strconv"
@@ -10,12 +11,25 @@ import (
 
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/endpoint"
+	"github.com/tidwall/tile38/internal/geodesic"
 	"github.com/tidwall/tile38/internal/glob"
 )
 
 const (
-	defaultKeepAlive     = 300 // seconds
-	defaultProtectedMode = "yes"
+	defaultKeepAlive          = 300 // seconds
+	defaultProtectedMode      = "yes"
+	defaultWebhookWorkers     = 0 // unlimited
+	defaultWebhookMaxInFlight = 0 // unlimited
+	defaultExpireEffort       = 1
+	maxExpireEffort           = 10
+	defaultMaxGeomDepth       = 128
+	defaultNotifyOrder        = "detect"
+	defaultFollowerLagAction  = "disconnect"
+	defaultLeaderTimeout      = 30 // seconds
+	defaultFollowerApplyBuf   = 32 * 1024 * 1024
+	defaultDistinctExact      = 10000
+	defaultLeaderIDChange     = "abort"
 )
 
 // Config keys
@@ -24,6 +38,8 @@ const (
 	FollowPort      = "follow_port"
 	FollowID        = "follow_id"
 	FollowPos       = "follow_pos"
+	FollowUpstreams = "follow_upstreams"
+	FollowTLS       = "follow_tls"
 	ReplicaPriority = "replica-priority"
 	ServerID        = "server_id"
 	ReadOnly        = "read_only"
@@ -36,9 +52,37 @@ const (
 	LogConfig       = "logconfig"
 	AnnounceIP      = "replica_announce_ip"
 	AnnouncePort    = "replica_announce_port"
+	WebhookWorkers  = "webhook-workers"
+	WebhookInFlight = "webhook-max-inflight"
+	TombstoneTTL    = "tombstone-retention"
+	ReplPublish     = "replicate-publish"
+	WriteInterval   = "object-write-interval"
+	ExpireEffort    = "active-expire-effort"
+	MaxGeomDepth    = "max-geometry-depth"
+	StrictKeys      = "strict-keys"
+	NotifySequence  = "notify-sequence"
+	NotifyOrder     = "notify-order"
+	FollowerMaxLag  = "follower-max-lag"
+	FollowerLagAct  = "follower-lag-action"
+	HeavyReadLimit  = "heavy-read-limit"
+	HeavyReadWait   = "heavy-read-wait"
+	LeaderTLS       = "leader-tls"
+	LeaderCACert    = "leader-ca-cert"
+	LeaderCompress  = "leader-compress"
+	LeaderTimeout   = "leader-timeout"
+	FollowerRO      = "follower-read-only"
+	HistoryTTL      = "history-retention"
+	FollowerApply   = "follower-apply-buffer"
+	DistinctExact   = "distinct-exact-limit"
+	ReplTokens      = "replication-tokens"
+	LeaderIDChange  = "leader-id-change"
+	HTTPMetrics     = "http-metrics"
+	HookDeadLetter  = "hook-dead-letter"
+	HookClientCerts = "hook-client-certs"
+	DistanceMetric  = "distance-metric"
 )
 
-var validProperties = []string{RequirePass, LeaderAuth, ProtectedMode, MaxMemory, AutoGC, KeepAlive, LogConfig, ReplicaPriority, AnnouncePort, AnnounceIP}
+var validProperties = []string{RequirePass, LeaderAuth, ProtectedMode, MaxMemory, AutoGC, KeepAlive, LogConfig, ReplicaPriority, AnnouncePort, AnnounceIP, WebhookWorkers, WebhookInFlight, TombstoneTTL, ReplPublish, WriteInterval, ExpireEffort, MaxGeomDepth, StrictKeys, NotifySequence, NotifyOrder, FollowerMaxLag, FollowerLagAct, HeavyReadLimit, HeavyReadWait, LeaderTLS, LeaderCACert, LeaderCompress, LeaderTimeout, FollowerRO, HistoryTTL, FollowerApply, DistinctExact, ReplTokens, LeaderIDChange, HTTPMetrics, HookDeadLetter, HookClientCerts, DistanceMetric}
 
 // Config is a tile38 config
 type Config struct {
@@ -50,6 +94,8 @@ type Config struct {
 	_followPort      int64
 	_followID        string
 	_followPos       int64
+	_followUps       []followUpstream
+	_followTLS       bool
 	_replicaPriority int64
 	_serverID        string
 	_readOnly        bool
@@ -72,6 +118,60 @@ type Config struct {
 	_announceIP     string
 	_announcePortP  string
 	_announcePort   int64
+	_whWorkersP     string
+	_whWorkers      int64
+	_whInFlightP    string
+	_whInFlight     int64
+	_tombstoneTTLP  string
+	_tombstoneTTL   int64
+	_replPublishP   string
+	_replPublish    bool
+	_writeIvalP     string
+	_writeIval      int64
+	_expireEffortP  string
+	_expireEffort   int64
+	_maxGeomDepthP  string
+	_maxGeomDepth   int64
+	_strictKeysP    string
+	_strictKeys     bool
+	_notifySeqP     string
+	_notifySeq      bool
+	_notifyOrderP   string
+	_notifyOrder    string
+	_fMaxLagP       string
+	_fMaxLag        int64
+	_fLagActP       string
+	_fLagAct        string
+	_hReadLimitP    string
+	_hReadLimit     int64
+	_hReadWaitP     string
+	_hReadWait      int64
+	_leaderTLSP     string
+	_leaderTLS      bool
+	_leaderCACert   string
+	_leaderCompP    string
+	_leaderComp     string
+	_leaderTimeP    string
+	_leaderTime     int64
+	_fReadOnlyP     string
+	_fReadOnly      bool
+	_historyTTLP    string
+	_historyTTL     int64
+	_fApplyBufP     string
+	_fApplyBuf      int64
+	_distinctP      string
+	_distinct       int64
+	_replTokensP    string
+	_replTokens     map[string]string // token -> name
+	_leaderIDChP    string
+	_leaderIDCh     string
+	_httpMetricsP   string
+	_httpMetrics    bool
+	_deadLetter     string
+	_hookCertsP     string
+	_hookCerts      map[string]*tls.Certificate
+	_metricP        string
+	_metric         geodesic.Metric
 }
 
 func loadConfig(path string) (*Config, error) {
@@ -89,6 +189,7 @@ func loadConfig(path string) (*Config, error) {
 		path:            path,
 		_followHost:     gjson.Get(json, FollowHost).String(),
 		_followPort:     gjson.Get(json, FollowPort).Int(),
+		_followTLS:      gjson.Get(json, FollowTLS).Bool(),
 		_followID:       gjson.Get(json, FollowID).String(),
 		_followPos:      gjson.Get(json, FollowPos).Int(),
 		_serverID:       gjson.Get(json, ServerID).String(),
@@ -102,11 +203,47 @@ func loadConfig(path string) (*Config, error) {
 		_logConfig:      gjson.Get(json, LogConfig).String(),
 		_announceIPP:    gjson.Get(json, AnnounceIP).String(),
 		_announcePortP:  gjson.Get(json, AnnouncePort).String(),
+		_whWorkersP:     gjson.Get(json, WebhookWorkers).String(),
+		_whInFlightP:    gjson.Get(json, WebhookInFlight).String(),
+		_tombstoneTTLP:  gjson.Get(json, TombstoneTTL).String(),
+		_replPublishP:   gjson.Get(json, ReplPublish).String(),
+		_writeIvalP:     gjson.Get(json, WriteInterval).String(),
+		_expireEffortP:  gjson.Get(json, ExpireEffort).String(),
+		_maxGeomDepthP:  gjson.Get(json, MaxGeomDepth).String(),
+		_strictKeysP:    gjson.Get(json, StrictKeys).String(),
+		_notifySeqP:     gjson.Get(json, NotifySequence).String(),
+		_notifyOrderP:   gjson.Get(json, NotifyOrder).String(),
+		_fMaxLagP:       gjson.Get(json, FollowerMaxLag).String(),
+		_fLagActP:       gjson.Get(json, FollowerLagAct).String(),
+		_hReadLimitP:    gjson.Get(json, HeavyReadLimit).String(),
+		_hReadWaitP:     gjson.Get(json, HeavyReadWait).String(),
+		_leaderTLSP:     gjson.Get(json, LeaderTLS).String(),
+		_leaderCACert:   gjson.Get(json, LeaderCACert).String(),
+		_leaderCompP:    gjson.Get(json, LeaderCompress).String(),
+		_leaderTimeP:    gjson.Get(json, LeaderTimeout).String(),
+		_fReadOnlyP:     gjson.Get(json, FollowerRO).String(),
+		_historyTTLP:    gjson.Get(json, HistoryTTL).String(),
+		_fApplyBufP:     gjson.Get(json, FollowerApply).String(),
+		_distinctP:      gjson.Get(json, DistinctExact).String(),
+		_replTokensP:    gjson.Get(json, ReplTokens).String(),
+		_leaderIDChP:    gjson.Get(json, LeaderIDChange).String(),
+		_httpMetricsP:   gjson.Get(json, HTTPMetrics).String(),
+		_deadLetter:     gjson.Get(json, HookDeadLetter).String(),
+		_hookCertsP:     gjson.Get(json, HookClientCerts).String(),
+		_metricP:        gjson.Get(json, DistanceMetric).String(),
 	}
 
 	if config._serverID == "" {
 		config._serverID = randomKey(16)
 	}
+	gjson.Get(json, FollowUpstreams).ForEach(func(_, v gjson.Result) bool {
+		config._followUps = append(config._followUps, followUpstream{
+			Host:   v.Get("host").String(),
+			Port:   int(v.Get("port").Int()),
+			Prefix: v.Get("prefix").String(),
+		})
+		return true
+	})
 
 	// Need to be sure we look for existence vs not zero because zero is an intentional setting
 	// anything less than zero will be considered default and will result in no slave_priority
@@ -145,6 +282,84 @@ func loadConfig(path string) (*Config, error) {
 	if err := config.setProperty(AnnouncePort, config._announcePortP, true); err != nil {
 		return nil, err
 	}
+	if err := config.setProperty(WebhookWorkers, config._whWorkersP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(WebhookInFlight, config._whInFlightP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(TombstoneTTL, config._tombstoneTTLP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(ReplPublish, config._replPublishP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(WriteInterval, config._writeIvalP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(ExpireEffort, config._expireEffortP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(MaxGeomDepth, config._maxGeomDepthP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(StrictKeys, config._strictKeysP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(NotifySequence, config._notifySeqP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(NotifyOrder, config._notifyOrderP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(DistanceMetric, config._metricP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(FollowerMaxLag, config._fMaxLagP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(FollowerLagAct, config._fLagActP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(HeavyReadLimit, config._hReadLimitP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(HeavyReadWait, config._hReadWaitP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(LeaderTLS, config._leaderTLSP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(LeaderCompress, config._leaderCompP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(LeaderTimeout, config._leaderTimeP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(FollowerRO, config._fReadOnlyP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(HistoryTTL, config._historyTTLP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(FollowerApply, config._fApplyBufP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(DistinctExact, config._distinctP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(ReplTokens, config._replTokensP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(LeaderIDChange, config._leaderIDChP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(HTTPMetrics, config._httpMetricsP, true); err != nil {
+		return nil, err
+	}
+	if err := config.setProperty(HookClientCerts, config._hookCertsP, true); err != nil {
+		return nil, err
+	}
 	config.write(false)
 	return config, nil
 }
@@ -184,6 +399,119 @@ func (config *Config) write(writeProperties bool) {
 		} else {
 			config._announcePortP = strconv.FormatUint(uint64(config._announcePort), 10)
 		}
+		if config._whWorkers == defaultWebhookWorkers {
+			config._whWorkersP = ""
+		} else {
+			config._whWorkersP = strconv.FormatUint(uint64(config._whWorkers), 10)
+		}
+		if config._whInFlight == defaultWebhookMaxInFlight {
+			config._whInFlightP = ""
+		} else {
+			config._whInFlightP = strconv.FormatUint(uint64(config._whInFlight), 10)
+		}
+		if config._tombstoneTTL == 0 {
+			config._tombstoneTTLP = ""
+		} else {
+			config._tombstoneTTLP = strconv.FormatUint(uint64(config._tombstoneTTL), 10)
+		}
+		if config._replPublish {
+			config._replPublishP = "yes"
+		} else {
+			config._replPublishP = ""
+		}
+		if config._writeIval == 0 {
+			config._writeIvalP = ""
+		} else {
+			config._writeIvalP = strconv.FormatUint(uint64(config._writeIval), 10)
+		}
+		if config._expireEffort == defaultExpireEffort {
+			config._expireEffortP = ""
+		} else {
+			config._expireEffortP = strconv.FormatUint(uint64(config._expireEffort), 10)
+		}
+		if config._maxGeomDepth == defaultMaxGeomDepth {
+			config._maxGeomDepthP = ""
+		} else {
+			config._maxGeomDepthP = strconv.FormatUint(uint64(config._maxGeomDepth), 10)
+		}
+		if config._strictKeys {
+			config._strictKeysP = "yes"
+		} else {
+			config._strictKeysP = ""
+		}
+		if config._notifySeq {
+			config._notifySeqP = "yes"
+		} else {
+			config._notifySeqP = ""
+		}
+		if config._notifyOrder == defaultNotifyOrder {
+			config._notifyOrderP = ""
+		} else {
+			config._notifyOrderP = config._notifyOrder
+		}
+		if config._metric == geodesic.Haversine {
+			config._metricP = ""
+		} else {
+			config._metricP = config._metric.String()
+		}
+		config._fMaxLagP = formatMemSize(config._fMaxLag)
+		if config._fLagAct == defaultFollowerLagAction {
+			config._fLagActP = ""
+		} else {
+			config._fLagActP = config._fLagAct
+		}
+		if config._hReadLimit == 0 {
+			config._hReadLimitP = ""
+		} else {
+			config._hReadLimitP = strconv.FormatUint(uint64(config._hReadLimit), 10)
+		}
+		if config._hReadWait == 0 {
+			config._hReadWaitP = ""
+		} else {
+			config._hReadWaitP = strconv.FormatUint(uint64(config._hReadWait), 10)
+		}
+		if config._leaderTLS {
+			config._leaderTLSP = "yes"
+		} else {
+			config._leaderTLSP = ""
+		}
+		config._leaderCompP = config._leaderComp
+		if config._leaderTime == defaultLeaderTimeout {
+			config._leaderTimeP = ""
+		} else {
+			config._leaderTimeP = strconv.FormatUint(uint64(config._leaderTime), 10)
+		}
+		if config._fReadOnly {
+			config._fReadOnlyP = ""
+		} else {
+			config._fReadOnlyP = "no"
+		}
+		if config._historyTTL == 0 {
+			config._historyTTLP = ""
+		} else {
+			config._historyTTLP = strconv.FormatUint(uint64(config._historyTTL), 10)
+		}
+		if config._fApplyBuf == defaultFollowerApplyBuf {
+			config._fApplyBufP = ""
+		} else {
+			config._fApplyBufP = formatMemSize(config._fApplyBuf)
+		}
+		if config._distinct == defaultDistinctExact {
+			config._distinctP = ""
+		} else {
+			config._distinctP = strconv.FormatUint(uint64(config._distinct), 10)
+		}
+		config._replTokensP = formatReplTokens(config._replTokens)
+		if config._leaderIDCh == defaultLeaderIDChange {
+			config._leaderIDChP = ""
+		} else {
+			config._leaderIDChP = config._leaderIDCh
+		}
+		if config._httpMetrics {
+			config._httpMetricsP = "yes"
+		} else {
+			config._httpMetricsP = ""
+		}
 	}
 
 	m := make(map[string]interface{})
@@ -199,6 +527,12 @@ func (config *Config) write(writeProperties bool) {
 	if config._followPos != 0 {
 		m[FollowPos] = config._followPos
 	}
+	if len(config._followUps) > 0 {
+		m[FollowUpstreams] = config._followUps
+	}
+	if config._followTLS {
+		m[FollowTLS] = true
+	}
 	if config._replicaPriority >= 0 {
 		m[ReplicaPriority] = config._replicaPriority
 	}
@@ -239,6 +573,90 @@ func (config *Config) write(writeProperties bool) {
 	if config._announcePortP != "" {
 		m[AnnouncePort] = config._announcePortP
 	}
+	if config._whWorkersP != "" {
+		m[WebhookWorkers] = config._whWorkersP
+	}
+	if config._whInFlightP != "" {
+		m[WebhookInFlight] = config._whInFlightP
+	}
+	if config._tombstoneTTLP != "" {
+		m[TombstoneTTL] = config._tombstoneTTLP
+	}
+	if config._replPublishP != "" {
+		m[ReplPublish] = config._replPublishP
+	}
+	if config._writeIvalP != "" {
+		m[WriteInterval] = config._writeIvalP
+	}
+	if config._expireEffortP != "" {
+		m[ExpireEffort] = config._expireEffortP
+	}
+	if config._maxGeomDepthP != "" {
+		m[MaxGeomDepth] = config._maxGeomDepthP
+	}
+	if config._strictKeysP != "" {
+		m[StrictKeys] = config._strictKeysP
+	}
+	if config._notifySeqP != "" {
+		m[NotifySequence] = config._notifySeqP
+	}
+	if config._notifyOrderP != "" {
+		m[NotifyOrder] = config._notifyOrderP
+	}
+	if config._metricP != "" {
+		m[DistanceMetric] = config._metricP
+	}
+	if config._fMaxLagP != "" {
+		m[FollowerMaxLag] = config._fMaxLagP
+	}
+	if config._fLagActP != "" {
+		m[FollowerLagAct] = config._fLagActP
+	}
+	if config._hReadLimitP != "" {
+		m[HeavyReadLimit] = config._hReadLimitP
+	}
+	if config._hReadWaitP != "" {
+		m[HeavyReadWait] = config._hReadWaitP
+	}
+	if config._leaderTLSP != "" {
+		m[LeaderTLS] = config._leaderTLSP
+	}
+	if config._leaderCACert != "" {
+		m[LeaderCACert] = config._leaderCACert
+	}
+	if config._leaderCompP != "" {
+		m[LeaderCompress] = config._leaderCompP
+	}
+	if config._leaderTimeP != "" {
+		m[LeaderTimeout] = config._leaderTimeP
+	}
+	if config._fReadOnlyP != "" {
+		m[FollowerRO] = config._fReadOnlyP
+	}
+	if config._historyTTLP != "" {
+		m[HistoryTTL] = config._historyTTLP
+	}
+	if config._fApplyBufP != "" {
+		m[FollowerApply] = config._fApplyBufP
+	}
+	if config._distinctP != "" {
+		m[DistinctExact] = config._distinctP
+	}
+	if config._replTokensP != "" {
+		m[ReplTokens] = config._replTokensP
+	}
+	if config._leaderIDChP != "" {
+		m[LeaderIDChange] = config._leaderIDChP
+	}
+	if config._httpMetricsP != "" {
+		m[HTTPMetrics] = config._httpMetricsP
+	}
+	if config._deadLetter != "" {
+		m[HookDeadLetter] = config._deadLetter
+	}
+	if config._hookCertsP != "" {
+		m[HookClientCerts] = config._hookCertsP
+	}
 	data, err := json.MarshalIndent(m, "", "\t")
 	if err != nil {
 		panic(err)
@@ -323,6 +741,70 @@ func (config *Config) setProperty(name, value string, fromLoad bool) error {
 			return clientErrorf("Invalid argument '%s' for CONFIG SET '%s'", value, name)
 		}
 		config._maxMemory = sz
+	case FollowerMaxLag:
+		sz, ok := parseMemSize(value)
+		if !ok {
+			invalid = true
+		} else {
+			config._fMaxLag = sz
+		}
+	case FollowerApply:
+		if value == "" {
+			config._fApplyBuf = defaultFollowerApplyBuf
+		} else if sz, ok := parseMemSize(value); !ok || sz <= 0 {
+			invalid = true
+		} else {
+			config._fApplyBuf = sz
+		}
+	case DistinctExact:
+		if value == "" {
+			config._distinct = defaultDistinctExact
+		} else {
+			limit, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				invalid = true
+			} else {
+				config._distinct = int64(limit)
+			}
+		}
+	case LeaderIDChange:
+		switch strings.ToLower(value) {
+		case "":
+			config._leaderIDCh = defaultLeaderIDChange
+		case "abort", "resync":
+			config._leaderIDCh = strings.ToLower(value)
+		default:
+			invalid = true
+		}
+	case HTTPMetrics:
+		switch strings.ToLower(value) {
+		case "":
+			if fromLoad {
+				config._httpMetrics = false
+			} else {
+				invalid = true
+			}
+		case "yes", "no":
+			config._httpMetrics = strings.ToLower(value) == "yes"
+		default:
+			invalid = true
+		}
+	case ReplTokens:
+		tokens, ok := parseReplTokens(value)
+		if !ok {
+			invalid = true
+		} else {
+			config._replTokens = tokens
+		}
+	case FollowerLagAct:
+		switch strings.ToLower(value) {
+		case "":
+			config._fLagAct = defaultFollowerLagAction
+		case "disconnect", "warn":
+			config._fLagAct = strings.ToLower(value)
+		default:
+			invalid = true
+		}
 	case ProtectedMode:
 		switch strings.ToLower(value) {
 		case "":
@@ -373,6 +855,225 @@ func (config *Config) setProperty(name, value string, fromLoad bool) error {
 				config._announcePort = int64(announcePort)
 			}
 		}
+	case WebhookWorkers, WebhookInFlight:
+		n := int64(defaultWebhookWorkers)
+		if name == WebhookInFlight {
+			n = defaultWebhookMaxInFlight
+		}
+		if value != "" {
+			v, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				invalid = true
+				break
+			}
+			n = int64(v)
+		}
+		if name == WebhookWorkers {
+			config._whWorkers = n
+		} else {
+			config._whInFlight = n
+		}
+	case ReplPublish:
+		switch strings.ToLower(value) {
+		case "":
+			if fromLoad {
+				config._replPublish = false
+			} else {
+				invalid = true
+			}
+		case "yes", "no":
+			config._replPublish = strings.ToLower(value) == "yes"
+		default:
+			invalid = true
+		}
+	case LeaderTLS:
+		switch strings.ToLower(value) {
+		case "":
+			if fromLoad {
+				config._leaderTLS = false
+			} else {
+				invalid = true
+			}
+		case "yes", "no":
+			config._leaderTLS = strings.ToLower(value) == "yes"
+		default:
+			invalid = true
+		}
+	case LeaderCACert:
+		if value != "" {
+			if _, err := loadCertPool(value); err != nil {
+				invalid = true
+				break
+			}
+		}
+		config._leaderCACert = value
+	case HookClientCerts:
+		certs, entries, ok := parseHookCerts(value)
+		if !ok {
+			invalid = true
+		} else {
+			config._hookCerts = certs
+			config._hookCertsP = entries
+		}
+	case HookDeadLetter:
+		if value != "" && endpoint.Validate(value) != nil {
+			invalid = true
+		} else {
+			config._deadLetter = value
+		}
+	case LeaderCompress:
+		switch strings.ToLower(value) {
+		case "", "none":
+			config._leaderComp = ""
+		case "gzip", "snappy":
+			config._leaderComp = strings.ToLower(value)
+		default:
+			invalid = true
+		}
+	case FollowerRO:
+		switch strings.ToLower(value) {
+		case "":
+			if fromLoad {
+				config._fReadOnly = true
+			} else {
+				invalid = true
+			}
+		case "yes", "no":
+			config._fReadOnly = strings.ToLower(value) == "yes"
+		default:
+			invalid = true
+		}
+	case HistoryTTL:
+		if value == "" {
+			config._historyTTL = 0
+		} else {
+			ttl, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				invalid = true
+			} else {
+				config._historyTTL = int64(ttl)
+			}
+		}
+	case LeaderTimeout:
+		if value == "" {
+			config._leaderTime = defaultLeaderTimeout
+		} else {
+			timeout, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				invalid = true
+			} else {
+				config._leaderTime = int64(timeout)
+			}
+		}
+	case StrictKeys:
+		switch strings.ToLower(value) {
+		case "":
+			if fromLoad {
+				config._strictKeys = false
+			} else {
+				invalid = true
+			}
+		case "yes", "no":
+			config._strictKeys = strings.ToLower(value) == "yes"
+		default:
+			invalid = true
+		}
+	case NotifySequence:
+		switch strings.ToLower(value) {
+		case "":
+			if fromLoad {
+				config._notifySeq = false
+			} else {
+				invalid = true
+			}
+		case "yes", "no":
+			config._notifySeq = strings.ToLower(value) == "yes"
+		default:
+			invalid = true
+		}
+	case NotifyOrder:
+		switch strings.ToLower(value) {
+		case "":
+			config._notifyOrder = defaultNotifyOrder
+		case "detect", "name", "created":
+			config._notifyOrder = strings.ToLower(value)
+		default:
+			invalid = true
+		}
+	case DistanceMetric:
+		if value == "" {
+			config._metric = geodesic.Haversine
+		} else if metric, ok := geodesic.ParseMetric(value); ok {
+			config._metric = metric
+		} else {
+			invalid = true
+		}
+	case TombstoneTTL:
+		if value == "" {
+			config._tombstoneTTL = 0
+		} else {
+			ttl, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				invalid = true
+			} else {
+				config._tombstoneTTL = int64(ttl)
+			}
+		}
+	case HeavyReadLimit:
+		if value == "" {
+			config._hReadLimit = 0
+		} else {
+			limit, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				invalid = true
+			} else {
+				config._hReadLimit = int64(limit)
+			}
+		}
+	case HeavyReadWait:
+		if value == "" {
+			config._hReadWait = 0
+		} else {
+			wait, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				invalid = true
+			} else {
+				config._hReadWait = int64(wait)
+			}
+		}
+	case WriteInterval:
+		if value == "" {
+			config._writeIval = 0
+		} else {
+			ival, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				invalid = true
+			} else {
+				config._writeIval = int64(ival)
+			}
+		}
+	case ExpireEffort:
+		if value == "" {
+			config._expireEffort = defaultExpireEffort
+		} else {
+			effort, err := strconv.ParseUint(value, 10, 64)
+			if err != nil || effort == 0 || effort > maxExpireEffort {
+				invalid = true
+			} else {
+				config._expireEffort = int64(effort)
+			}
+		}
+	case MaxGeomDepth:
+		if value == "" {
+			config._maxGeomDepth = defaultMaxGeomDepth
+		} else {
+			depth, err := strconv.ParseUint(value, 10, 32)
+			if err != nil || depth == 0 {
+				invalid = true
+			} else {
+				config._maxGeomDepth = int64(depth)
+			}
+		}
 	}
 
 	if invalid {
@@ -422,6 +1123,83 @@ func (config *Config) getProperty(name string) string {
 		return config._announceIP
 	case AnnouncePort:
 		return strconv.FormatUint(uint64(config._announcePort), 10)
+	case WebhookWorkers:
+		return strconv.FormatUint(uint64(config._whWorkers), 10)
+	case WebhookInFlight:
+		return strconv.FormatUint(uint64(config._whInFlight), 10)
+	case TombstoneTTL:
+		return strconv.FormatUint(uint64(config._tombstoneTTL), 10)
+	case ReplPublish:
+		if config._replPublish {
+			return "yes"
+		}
+		return "no"
+	case WriteInterval:
+		return strconv.FormatUint(uint64(config._writeIval), 10)
+	case ExpireEffort:
+		return strconv.FormatUint(uint64(config._expireEffort), 10)
+	case MaxGeomDepth:
+		return strconv.FormatUint(uint64(config._maxGeomDepth), 10)
+	case StrictKeys:
+		if config._strictKeys {
+			return "yes"
+		}
+		return "no"
+	case NotifySequence:
+		if config._notifySeq {
+			return "yes"
+		}
+		return "no"
+	case NotifyOrder:
+		return config._notifyOrder
+	case DistanceMetric:
+		return config._metric.String()
+	case FollowerMaxLag:
+		return formatMemSize(config._fMaxLag)
+	case FollowerLagAct:
+		return config._fLagAct
+	case HeavyReadLimit:
+		return strconv.FormatUint(uint64(config._hReadLimit), 10)
+	case HeavyReadWait:
+		return strconv.FormatUint(uint64(config._hReadWait), 10)
+	case LeaderTLS:
+		if config._leaderTLS {
+			return "yes"
+		}
+		return "no"
+	case LeaderCACert:
+		return config._leaderCACert
+	case LeaderCompress:
+		if config._leaderComp == "" {
+			return "none"
+		}
+		return config._leaderComp
+	case LeaderTimeout:
+		return strconv.FormatUint(uint64(config._leaderTime), 10)
+	case FollowerRO:
+		if config._fReadOnly {
+			return "yes"
+		}
+		return "no"
+	case HistoryTTL:
+		return strconv.FormatUint(uint64(config._historyTTL), 10)
+	case FollowerApply:
+		return formatMemSize(config._fApplyBuf)
+	case DistinctExact:
+		return strconv.FormatUint(uint64(config._distinct), 10)
+	case ReplTokens:
+		return formatReplTokens(config._replTokens)
+	case LeaderIDChange:
+		return config._leaderIDCh
+	case HTTPMetrics:
+		if config._httpMetrics {
+			return "yes"
+		}
+		return "no"
+	case HookDeadLetter:
+		return config._deadLetter
+	case HookClientCerts:
+		return config._hookCertsP
 	}
 }
 
@@ -472,8 +1250,22 @@ func (s *Server) cmdConfigSet(msg *Message) (res resp.Value, err error) {
 	if err := s.config.setProperty(name, value, false); err != nil {
 		return NOMessage, err
 	}
-	if name == MaxMemory {
+	switch name {
+	case MaxMemory:
 		s.checkOutOfMemory()
+	case WebhookWorkers, WebhookInFlight:
+		s.epc.SetPoolSize(s.config.webhookWorkers(), s.config.webhookMaxInFlight())
+	case ReplPublish:
+		// followers reconnect to pick up the new setting
+		for conn, f := range s.aofconnM {
+			conn.Close()
+			f.Close()
+		}
+		s.fcond.Broadcast()
+	case ReplTokens:
+		s.closeRevokedReplTokens()
+	case HookClientCerts:
+		s.epc.SetClientCerts(s.config.hookClientCerts())
 	}
 	return OKMessage(msg, start), nil
 }
@@ -500,6 +1292,12 @@ func (config *Config) followPort() int {
 	config.mu.RUnlock()
 	return int(v)
 }
+func (config *Config) followTLS() bool {
+	config.mu.RLock()
+	v := config._followTLS
+	config.mu.RUnlock()
+	return v
+}
 func (config *Config) replicaPriority() int {
 	config.mu.RLock()
 	v := config._replicaPriority
@@ -571,13 +1369,213 @@ func (config *Config) setFollowHost(v string) {
 	config._followHost = v
 	config.mu.Unlock()
 }
+func (config *Config) followID() string {
+	config.mu.RLock()
+	v := config._followID
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) setFollowID(v string) {
+	config.mu.Lock()
+	config._followID = v
+	config.mu.Unlock()
+}
+func (config *Config) followUpstreams() []followUpstream {
+	config.mu.RLock()
+	v := config._followUps
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) setFollowUpstreams(v []followUpstream) {
+	config.mu.Lock()
+	config._followUps = v
+	config.mu.Unlock()
+}
 func (config *Config) setFollowPort(v int) {
 	config.mu.Lock()
 	config._followPort = int64(v)
 	config.mu.Unlock()
 }
+func (config *Config) setFollowTLS(v bool) {
+	config.mu.Lock()
+	config._followTLS = v
+	config.mu.Unlock()
+}
 func (config *Config) setReadOnly(v bool) {
 	config.mu.Lock()
 	config._readOnly = v
 	config.mu.Unlock()
 }
+func (config *Config) webhookWorkers() int {
+	config.mu.RLock()
+	v := config._whWorkers
+	config.mu.RUnlock()
+	return int(v)
+}
+func (config *Config) webhookMaxInFlight() int {
+	config.mu.RLock()
+	v := config._whInFlight
+	config.mu.RUnlock()
+	return int(v)
+}
+func (config *Config) setServerID(v string) {
+	config.mu.Lock()
+	config._serverID = v
+	config.mu.Unlock()
+}
+func (config *Config) tombstoneTTL() time.Duration {
+	config.mu.RLock()
+	v := config._tombstoneTTL
+	config.mu.RUnlock()
+	return time.Duration(v) * time.Second
+}
+func (config *Config) replicatePublish() bool {
+	config.mu.RLock()
+	v := config._replPublish
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) objectWriteInterval() time.Duration {
+	config.mu.RLock()
+	v := config._writeIval
+	config.mu.RUnlock()
+	return time.Duration(v) * time.Millisecond
+}
+func (config *Config) expireEffort() int {
+	config.mu.RLock()
+	v := config._expireEffort
+	config.mu.RUnlock()
+	return int(v)
+}
+func (config *Config) maxGeometryDepth() int {
+	config.mu.RLock()
+	v := config._maxGeomDepth
+	config.mu.RUnlock()
+	return int(v)
+}
+func (config *Config) strictKeys() bool {
+	config.mu.RLock()
+	v := config._strictKeys
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) notifySequence() bool {
+	config.mu.RLock()
+	v := config._notifySeq
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) notifyOrder() string {
+	config.mu.RLock()
+	v := config._notifyOrder
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) distanceMetric() geodesic.Metric {
+	config.mu.RLock()
+	v := config._metric
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) followerMaxLag() int64 {
+	config.mu.RLock()
+	v := config._fMaxLag
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) followerApplyBuffer() int64 {
+	config.mu.RLock()
+	v := config._fApplyBuf
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) distinctExactLimit() int {
+	config.mu.RLock()
+	v := config._distinct
+	config.mu.RUnlock()
+	return int(v)
+}
+func (config *Config) replicationToken(token string) (name string, ok bool) {
+	config.mu.RLock()
+	name, ok = config._replTokens[token]
+	config.mu.RUnlock()
+	return name, ok
+}
+func (config *Config) leaderIDChange() string {
+	config.mu.RLock()
+	v := config._leaderIDCh
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) httpMetrics() bool {
+	config.mu.RLock()
+	v := config._httpMetrics
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) hookClientCerts() map[string]*tls.Certificate {
+	config.mu.RLock()
+	v := config._hookCerts
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) hookDeadLetter() string {
+	config.mu.RLock()
+	v := config._deadLetter
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) followerLagAction() string {
+	config.mu.RLock()
+	v := config._fLagAct
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) heavyReadLimit() int {
+	config.mu.RLock()
+	v := config._hReadLimit
+	config.mu.RUnlock()
+	return int(v)
+}
+func (config *Config) heavyReadWait() time.Duration {
+	config.mu.RLock()
+	v := config._hReadWait
+	config.mu.RUnlock()
+	return time.Duration(v) * time.Millisecond
+}
+func (config *Config) leaderTLS() bool {
+	config.mu.RLock()
+	v := config._leaderTLS
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) leaderCACert() string {
+	config.mu.RLock()
+	v := config._leaderCACert
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) leaderCompress() string {
+	config.mu.RLock()
+	v := config._leaderComp
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) followerReadOnly() bool {
+	config.mu.RLock()
+	v := config._fReadOnly
+	config.mu.RUnlock()
+	return v
+}
+func (config *Config) historyTTL() time.Duration {
+	config.mu.RLock()
+	v := config._historyTTL
+	config.mu.RUnlock()
+	return time.Duration(v) * time.Second
+}
+func (config *Config) leaderTimeout() time.Duration {
+	config.mu.RLock()
+	v := config._leaderTime
+	config.mu.RUnlock()
+	return time.Duration(v) * time.Second
+}
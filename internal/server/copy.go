@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+var errKeyAlreadyExists = errors.New("key already exists")
+
+// COPY srckey dstkey [REPLACE]
+func (s *Server) cmdCOPY(msg *Message) (resp.Value, commandDetails, error) {
+	start := time.Now()
+	if s.config.maxMemory() > 0 && s.outOfMemory.Load() {
+		return retwerr(errOOM)
+	}
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 3 && len(args) != 4 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	key, dstKey := args[1], args[2]
+	var replace bool
+	if len(args) == 4 {
+		if strings.ToLower(args[3]) != "replace" {
+			return retwerr(errInvalidArgument(args[3]))
+		}
+		replace = true
+	}
+	if key == dstKey {
+		return retwerr(errInvalidArgument(dstKey))
+	}
+
+	// >> Operation
+
+	col, _ := s.cols.Get(key)
+	if col == nil {
+		return retwerr(errKeyNotFound)
+	}
+	now := time.Now()
+	var d commandDetails
+	if dst, _ := s.cols.Get(dstKey); dst != nil {
+		if !replace {
+			if msg.OutputType == JSON {
+				return retwerr(errKeyAlreadyExists)
+			}
+			return resp.IntegerValue(0), commandDetails{}, nil
+		}
+		s.cmdDROPop(dstKey)
+		d.children = append(d.children, &commandDetails{
+			command:   "drop",
+			updated:   true,
+			timestamp: now,
+			key:       dstKey,
+		})
+	}
+	// The objects keep their expiration time, which is when they would have
+	// expired in the source key.
+	dst := s.newCollection(dstKey)
+	col.Scan(false, nil, nil, func(o *object.Object) bool {
+		obj := object.New(o.ID(), o.Geo(), o.Expires(), o.Fields())
+		dst.Set(obj)
+		d.children = append(d.children, &commandDetails{
+			command:   "set",
+			updated:   true,
+			timestamp: now,
+			key:       dstKey,
+			obj:       obj,
+		})
+		return true
+	})
+	s.cols.Set(dstKey, dst)
+	d.command = "copy"
+	d.key = key
+	d.newKey = dstKey
+	d.updated = true
+	d.timestamp = now
+	d.parent = true
+
+	// >> Response
+
+	var res resp.Value
+	switch msg.OutputType {
+	case JSON:
+		res = resp.StringValue(`{"ok":true,"elapsed":"` +
+			time.Since(start).String() + "\"}")
+	case RESP:
+		res = resp.IntegerValue(1)
+	}
+	return res, d, nil
+}
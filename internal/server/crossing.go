@@ -0,0 +1,106 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/geojson/geometry"
+)
+
+// fenceCrossing is a boundary edge of a fence that a path crossed.
+type fenceCrossing struct {
+	seg geometry.Segment
+	pt  geometry.Point
+	at  float64 // how far along the path, from 0 to 1
+}
+
+// fenceCrossings returns the edges of the polygons and lines of a fence that
+// the path from a to b crosses, in the order that they are crossed.
+func fenceCrossings(area geojson.Object, a, b geometry.Point) []fenceCrossing {
+	var crossings []fenceCrossing
+	path := geometry.Segment{A: a, B: b}
+	appendSeries := func(series geometry.Series) {
+		if series == nil {
+			return
+		}
+		for i := 0; i < series.NumSegments(); i++ {
+			seg := series.SegmentAt(i)
+			if pt, at, ok := segmentIntersection(path, seg); ok {
+				crossings = append(crossings, fenceCrossing{seg, pt, at})
+			}
+		}
+	}
+	var walk func(obj geojson.Object)
+	walk = func(obj geojson.Object) {
+		switch obj := obj.(type) {
+		case *geojson.Polygon:
+			poly := obj.Base()
+			appendSeries(poly.Exterior)
+			for _, hole := range poly.Holes {
+				appendSeries(hole)
+			}
+		case *geojson.LineString:
+			appendSeries(obj.Base())
+		case *geojson.Rect:
+			appendSeries(obj.Base())
+		case *geojson.Circle:
+			walk(obj.Polygon())
+		case *geojson.Feature:
+			walk(obj.Base())
+		case geojson.Collection:
+			for _, child := range obj.Children() {
+				walk(child)
+			}
+		}
+	}
+	walk(area)
+	sort.SliceStable(crossings, func(i, j int) bool {
+		return crossings[i].at < crossings[j].at
+	})
+	return crossings
+}
+
+// segmentIntersection returns the point where two segments intersect, and
+// how far along the first one it is. Parallel segments don't intersect.
+func segmentIntersection(p, q geometry.Segment) (geometry.Point, float64, bool) {
+	rx, ry := p.B.X-p.A.X, p.B.Y-p.A.Y
+	sx, sy := q.B.X-q.A.X, q.B.Y-q.A.Y
+	denom := rx*sy - ry*sx
+	if denom == 0 {
+		return geometry.Point{}, 0, false
+	}
+	qpx, qpy := q.A.X-p.A.X, q.A.Y-p.A.Y
+	t := (qpx*sy - qpy*sx) / denom
+	u := (qpx*ry - qpy*rx) / denom
+	if t < 0 || t > 1 || u < 0 || u > 1 {
+		return geometry.Point{}, 0, false
+	}
+	return geometry.Point{X: p.A.X + t*rx, Y: p.A.Y + t*ry}, t, true
+}
+
+// appendCrossingsJSON appends the crossed edges of a fence as the "crossed"
+// member of a message, followed by a comma.
+func appendCrossingsJSON(dst []byte, crossings []fenceCrossing) []byte {
+	appendPoint := func(dst []byte, pt geometry.Point) []byte {
+		dst = append(dst, '[')
+		dst = strconv.AppendFloat(dst, pt.X, 'f', -1, 64)
+		dst = append(dst, ',')
+		dst = strconv.AppendFloat(dst, pt.Y, 'f', -1, 64)
+		return append(dst, ']')
+	}
+	dst = append(dst, `"crossed":[`...)
+	for i, c := range crossings {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, `{"segment":[`...)
+		dst = appendPoint(dst, c.seg.A)
+		dst = append(dst, ',')
+		dst = appendPoint(dst, c.seg.B)
+		dst = append(dst, `],"point":`...)
+		dst = appendPoint(dst, c.pt)
+		dst = append(dst, '}')
+	}
+	return append(dst, "],"...)
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"encoding/hex"
 	"math"
 	"strconv"
 	"strings"
@@ -14,6 +15,7 @@ import (
 	"github.com/tidwall/tile38/internal/collection"
 	"github.com/tidwall/tile38/internal/field"
 	"github.com/tidwall/tile38/internal/glob"
+	"github.com/tidwall/tile38/internal/log"
 	"github.com/tidwall/tile38/internal/object"
 )
 
@@ -144,6 +146,32 @@ func (s *Server) cmdGET(msg *Message) (resp.Value, error) {
 			if err != nil || precision < 1 || precision > 12 {
 				return retrerr(errInvalidArgument(args[i]))
 			}
+		case "format":
+			i++
+			if i == len(args) {
+				return retrerr(errInvalidNumberOfArguments)
+			}
+			switch strings.ToLower(args[i]) {
+			case "wkt", "wkb":
+				kind = strings.ToLower(args[i])
+				continue
+			case "polyline":
+			default:
+				return retrerr(errInvalidArgument(args[i]))
+			}
+			kind = "polyline"
+			precision = 5
+			if i+1 < len(args) && strings.ToLower(args[i+1]) == "precision" {
+				i += 2
+				if i == len(args) {
+					return retrerr(errInvalidNumberOfArguments)
+				}
+				var err error
+				precision, err = strconv.ParseInt(args[i], 10, 64)
+				if err != nil || precision < 1 || precision > 10 {
+					return retrerr(errInvalidArgument(args[i]))
+				}
+			}
 		default:
 			return retrerr(errInvalidNumberOfArguments)
 		}
@@ -159,13 +187,21 @@ func (s *Server) cmdGET(msg *Message) (resp.Value, error) {
 		return retrerr(errKeyNotFound)
 	}
 	o := col.Get(id)
-	if o == nil {
+	if o == nil || expired(o, start.UnixNano()) {
 		if msg.OutputType == RESP {
 			return resp.NullValue(), nil
 		}
 		return retrerr(errIDNotFound)
 	}
 
+	var line *geojson.LineString
+	if kind == "polyline" {
+		var ok bool
+		if line, ok = o.Geo().(*geojson.LineString); !ok {
+			return retrerr(errNotLineString)
+		}
+	}
+
 	// >> Response
 
 	vals := make([]resp.Value, 0, 2)
@@ -174,6 +210,27 @@ func (s *Server) cmdGET(msg *Message) (resp.Value, error) {
 		buf.WriteString(`{"ok":true`)
 	}
 	switch kind {
+	case "polyline":
+		p := string(appendPolyline(nil, line.Base(), int(precision)))
+		if msg.OutputType == JSON {
+			buf.WriteString(`,"polyline":` + jsonString(p))
+		} else {
+			vals = append(vals, resp.StringValue(p))
+		}
+	case "wkt":
+		wkt := string(appendWKT(nil, o.Geo()))
+		if msg.OutputType == JSON {
+			buf.WriteString(`,"wkt":` + jsonString(wkt))
+		} else {
+			vals = append(vals, resp.StringValue(wkt))
+		}
+	case "wkb":
+		wkb := appendWKB(nil, o.Geo())
+		if msg.OutputType == JSON {
+			buf.WriteString(`,"wkb":"` + hex.EncodeToString(wkb) + `"`)
+		} else {
+			vals = append(vals, resp.BytesValue(wkb))
+		}
 	case "object":
 		if msg.OutputType == JSON {
 			buf.WriteString(`,"object":`)
@@ -415,8 +472,12 @@ func (s *Server) cmdPDEL(msg *Message) (resp.Value, commandDetails, error) {
 func (s *Server) cmdDROPop(key string) *collection.Collection {
 	col, _ := s.cols.Get(key)
 	if col != nil {
+		s.recordDroppedHistory(key, col)
 		s.cols.Delete(key)
 	}
+	if dd := s.dedups[key]; dd != nil {
+		dd.reset()
+	}
 	s.groupDisconnectCollection(key)
 	return col
 }
@@ -479,18 +540,6 @@ func (s *Server) cmdRENAME(msg *Message) (resp.Value, commandDetails, error) {
 	if col == nil {
 		return retwerr(errKeyNotFound)
 	}
-	var ierr error
-	s.hooks.Ascend(nil, func(v interface{}) bool {
-		h := v.(*Hook)
-		if h.Key == key || h.Key == newKey {
-			ierr = errKeyHasHooksSet
-			return false
-		}
-		return true
-	})
-	if ierr != nil {
-		return retwerr(ierr)
-	}
 	var updated bool
 	newCol, _ := s.cols.Get(newKey)
 	if newCol == nil {
@@ -502,6 +551,31 @@ func (s *Server) cmdRENAME(msg *Message) (resp.Value, commandDetails, error) {
 	if updated {
 		s.cols.Delete(key)
 		s.cols.Set(newKey, col)
+		if dd := s.dedups[key]; dd != nil {
+			delete(s.dedups, key)
+			s.dedups[newKey] = dd
+		} else {
+			delete(s.dedups, newKey)
+		}
+		if names, ok := s.indexes[key]; ok {
+			delete(s.indexes, key)
+			s.indexes[newKey] = names
+		} else {
+			delete(s.indexes, newKey)
+		}
+		if lead, ok := s.preexps[key]; ok {
+			delete(s.preexps, key)
+			s.preexps[newKey] = lead
+		} else {
+			delete(s.preexps, newKey)
+		}
+		if cur, ok := s.preexpd[key]; ok {
+			delete(s.preexpd, key)
+			s.preexpd[newKey] = cur
+		} else {
+			delete(s.preexpd, newKey)
+		}
+		s.renameKeyHooks(key, newKey)
 	}
 
 	// >> Response
@@ -531,6 +605,49 @@ func (s *Server) cmdRENAME(msg *Message) (resp.Value, commandDetails, error) {
 	return res, d, nil
 }
 
+// renameKeyHooks moves the hooks of a key to its new name. Each hook is set
+// again with the new key, and keeps its expiration and registration order.
+func (s *Server) renameKeyHooks(key, newKey string) {
+	var hooks []*Hook
+	s.hooks.Ascend(nil, func(v interface{}) bool {
+		if h := v.(*Hook); h.Key == key {
+			hooks = append(hooks, h)
+		}
+		return true
+	})
+	for _, h := range hooks {
+		var args []string
+		if h.channel {
+			args = append(args, "setchan", h.Name)
+		} else {
+			args = append(args, "sethook", h.Name,
+				strings.Join(h.Endpoints, ","))
+		}
+		for _, meta := range h.Metas {
+			args = append(args, "meta", meta.Name, meta.Value)
+		}
+		if h.format != "" {
+			args = append(args, "format", h.format)
+		}
+		if !h.expires.IsZero() {
+			args = append(args, "ex", strconv.FormatFloat(h.ex, 'f', -1, 64))
+		}
+		// the key always follows the search command
+		args = append(args, h.Message.Args[0], newKey)
+		args = append(args, h.Message.Args[2:]...)
+		if _, _, err := s.cmdSetHook(&Message{Args: args}); err != nil {
+			log.Errorf("rename hook %s: %v", h.Name, err)
+			continue
+		}
+		nh, _ := s.hooks.Get(&Hook{Name: h.Name}).(*Hook)
+		if nh != nil && !h.expires.IsZero() {
+			s.hookExpires.Delete(nh)
+			nh.expires = h.expires
+			s.hookExpires.Set(nh)
+		}
+	}
+}
+
 // FLUSHDB
 func (s *Server) cmdFLUSHDB(msg *Message) (resp.Value, commandDetails, error) {
 	start := time.Now()
@@ -545,8 +662,27 @@ func (s *Server) cmdFLUSHDB(msg *Message) (resp.Value, commandDetails, error) {
 
 	// >> Operation
 
-	// clear the entire database
+	s.flushAll()
 
+	// >> Response
+
+	var d commandDetails
+	d.command = "flushdb"
+	d.updated = true
+	d.timestamp = time.Now()
+
+	var res resp.Value
+	if msg.OutputType == JSON {
+		res = resp.StringValue(`{"ok":true,"elapsed":"` +
+			time.Since(start).String() + "\"}")
+	} else {
+		res = resp.SimpleStringValue("OK")
+	}
+	return res, d, nil
+}
+
+// flushAll clears the entire database, including all hooks and channels.
+func (s *Server) flushAll() {
 	// drop each collection
 	keys := s.cols.Keys()
 	for _, key := range keys {
@@ -585,96 +721,98 @@ func (s *Server) cmdFLUSHDB(msg *Message) (resp.Value, commandDetails, error) {
 	s.hookExpires.Clear()
 	s.hooks.Clear()
 	s.hooksOut.Clear()
+	s.hooksPop.Clear()
 	s.hookTree.Clear()
 	s.hookCross.Clear()
-
-	// >> Response
-
-	var d commandDetails
-	d.command = "flushdb"
-	d.updated = true
-	d.timestamp = time.Now()
-
-	var res resp.Value
-	if msg.OutputType == JSON {
-		res = resp.StringValue(`{"ok":true,"elapsed":"` +
-			time.Since(start).String() + "\"}")
-	} else {
-		res = resp.SimpleStringValue("OK")
-	}
-	return res, d, nil
 }
 
-// SET key id [FIELD name value ...] [EX seconds] [NX|XX]
-// (OBJECT geojson)|(POINT lat lon z)|(BOUNDS minlat minlon maxlat maxlon)|
-// (HASH geohash)|(STRING value)
-func (s *Server) cmdSET(msg *Message) (resp.Value, commandDetails, error) {
-	start := time.Now()
-	if s.config.maxMemory() > 0 && s.outOfMemory.Load() {
-		return retwerr(errOOM)
-	}
-
-	// >> Args
-
-	var key string
-	var id string
-	var fields []field.Field
-	var ex int64
-	var xx bool
-	var nx bool
-	var oobj geojson.Object
+// setParams are the parsed arguments of a SET command.
+type setParams struct {
+	key, id   string
+	fields    []field.Field
+	ex        int64
+	exArg     int // index of the EX or PX argument, zero when not set
+	xx, nx    bool
+	obj       geojson.Object
+	ifregion  string // "ifwithin" or "ifoutside"
+	regionKey string
+	regionID  string
+}
 
-	args := msg.Args
+// parseSetArgs parses the arguments of a SET command.
+func (s *Server) parseSetArgs(args []string) (a setParams, err error) {
 	if len(args) < 3 {
-		return retwerr(errInvalidNumberOfArguments)
+		return a, errInvalidNumberOfArguments
 	}
-
-	key, id = args[1], args[2]
+	a.key, a.id = args[1], args[2]
 
 	for i := 3; i < len(args); i++ {
 		switch strings.ToLower(args[i]) {
 		case "field":
 			if i+2 >= len(args) {
-				return retwerr(errInvalidNumberOfArguments)
+				return a, errInvalidNumberOfArguments
 			}
 			fkey := args[i+1]
 			fval := args[i+2]
 			i += 2
 			if isReservedFieldName(fkey) {
-				return retwerr(errInvalidArgument(fkey))
+				return a, errInvalidArgument(fkey)
 			}
-			fields = append(fields, field.Make(fkey, fval))
+			a.fields = append(a.fields, field.Make(fkey, fval))
 		case "ex":
 			if i+1 >= len(args) {
-				return retwerr(errInvalidNumberOfArguments)
+				return a, errInvalidNumberOfArguments
 			}
 			exval := args[i+1]
 			i += 1
 			x, err := strconv.ParseFloat(exval, 64)
 			if err != nil {
-				return retwerr(errInvalidArgument(exval))
+				return a, errInvalidArgument(exval)
+			}
+			a.ex = time.Now().UnixNano() + int64(float64(time.Second)*x)
+			a.exArg = i - 1
+		case "px":
+			if i+1 >= len(args) {
+				return a, errInvalidNumberOfArguments
+			}
+			pxval := args[i+1]
+			i += 1
+			x, err := strconv.ParseInt(pxval, 10, 64)
+			if err != nil {
+				return a, errInvalidArgument(pxval)
 			}
-			ex = time.Now().UnixNano() + int64(float64(time.Second)*x)
+			a.ex = time.Now().UnixNano() + x*int64(time.Millisecond)
+			a.exArg = i - 1
 		case "nx":
-			if xx {
-				return retwerr(errInvalidArgument(args[i]))
+			if a.xx {
+				return a, errInvalidArgument(args[i])
 			}
-			nx = true
+			a.nx = true
 		case "xx":
-			if nx {
-				return retwerr(errInvalidArgument(args[i]))
+			if a.nx {
+				return a, errInvalidArgument(args[i])
 			}
-			xx = true
+			a.xx = true
+		case "ifwithin", "ifoutside":
+			if a.ifregion != "" {
+				return a, errInvalidArgument(args[i])
+			}
+			if i+2 >= len(args) {
+				return a, errInvalidNumberOfArguments
+			}
+			a.ifregion = strings.ToLower(args[i])
+			a.regionKey, a.regionID = args[i+1], args[i+2]
+			i += 2
 		case "string":
 			if i+1 >= len(args) {
-				return retwerr(errInvalidNumberOfArguments)
+				return a, errInvalidNumberOfArguments
 			}
 			str := args[i+1]
 			i += 1
-			oobj = collection.String(str)
+			a.obj = collection.String(str)
 		case "point":
 			if i+2 >= len(args) {
-				return retwerr(errInvalidNumberOfArguments)
+				return a, errInvalidNumberOfArguments
 			}
 			slat := args[i+1]
 			slon := args[i+2]
@@ -692,60 +830,81 @@ func (s *Server) cmdSET(msg *Message) (resp.Value, commandDetails, error) {
 			}
 			y, err := strconv.ParseFloat(slat, 64)
 			if err != nil {
-				return retwerr(errInvalidArgument(slat))
+				return a, errInvalidArgument(slat)
 			}
 			x, err := strconv.ParseFloat(slon, 64)
 			if err != nil {
-				return retwerr(errInvalidArgument(slon))
+				return a, errInvalidArgument(slon)
 			}
 			if !hasZ {
-				oobj = geojson.NewPoint(geometry.Point{X: x, Y: y})
+				a.obj = geojson.NewPoint(geometry.Point{X: x, Y: y})
 			} else {
-				oobj = geojson.NewPointZ(geometry.Point{X: x, Y: y}, z)
+				a.obj = geojson.NewPointZ(geometry.Point{X: x, Y: y}, z)
 			}
 		case "bounds":
 			if i+4 >= len(args) {
-				return retwerr(errInvalidNumberOfArguments)
+				return a, errInvalidNumberOfArguments
 			}
 			var vals [4]float64
 			for j := 0; j < 4; j++ {
 				var err error
 				vals[j], err = strconv.ParseFloat(args[i+1+j], 64)
 				if err != nil {
-					return retwerr(errInvalidArgument(args[i+1+j]))
+					return a, errInvalidArgument(args[i+1+j])
 				}
 			}
 			i += 4
-			oobj = geojson.NewRect(geometry.Rect{
+			a.obj = geojson.NewRect(geometry.Rect{
 				Min: geometry.Point{X: vals[1], Y: vals[0]},
 				Max: geometry.Point{X: vals[3], Y: vals[2]},
 			})
 		case "hash":
 			if i+1 >= len(args) {
-				return retwerr(errInvalidNumberOfArguments)
+				return a, errInvalidNumberOfArguments
 			}
 			shash := args[i+1]
 			i += 1
 			lat, lon := geohash.Decode(shash)
-			oobj = geojson.NewPoint(geometry.Point{X: lon, Y: lat})
+			a.obj = geojson.NewPoint(geometry.Point{X: lon, Y: lat})
 		case "object":
 			if i+1 >= len(args) {
-				return retwerr(errInvalidNumberOfArguments)
+				return a, errInvalidNumberOfArguments
 			}
-			json := args[i+1]
 			i += 1
 			var err error
-			oobj, err = geojson.Parse(json, &s.geomParseOpts)
+			a.obj, err = s.parseObject(args[i])
 			if err != nil {
-				return retwerr(err)
+				return a, err
 			}
 		default:
-			return retwerr(errInvalidArgument(args[i]))
+			return a, errInvalidArgument(args[i])
 		}
 	}
-	if oobj == nil {
-		return retwerr(errInvalidNumberOfArguments)
+	if a.obj == nil {
+		return a, errInvalidNumberOfArguments
+	}
+	return a, nil
+}
+
+// SET key id [FIELD name value ...] [EX seconds] [NX|XX]
+// [IFWITHIN|IFOUTSIDE regionkey regionid]
+// (OBJECT geojson)|(POINT lat lon z)|(BOUNDS minlat minlon maxlat maxlon)|
+// (HASH geohash)|(STRING value)
+func (s *Server) cmdSET(msg *Message) (resp.Value, commandDetails, error) {
+	start := time.Now()
+	if s.config.maxMemory() > 0 && s.outOfMemory.Load() {
+		return retwerr(errOOM)
+	}
+
+	// >> Args
+
+	a, err := s.parseSetArgs(msg.Args)
+	if err != nil {
+		return retwerr(err)
 	}
+	key, id, fields, ex := a.key, a.id, a.fields, a.ex
+	xx, nx, oobj := a.xx, a.nx, a.obj
+	ifregion, regionKey, regionID := a.ifregion, a.regionKey, a.regionID
 
 	// >> Operation
 
@@ -761,12 +920,35 @@ func (s *Server) cmdSET(msg *Message) (resp.Value, commandDetails, error) {
 		return resp.NullValue(), commandDetails{}, nil
 	}
 
+	if ifregion != "" {
+		// the region must exist, and the new object is only stored when it's
+		// on the correct side of the region.
+		rcol, _ := s.cols.Get(regionKey)
+		if rcol == nil {
+			return retwerr(errKeyNotFound)
+		}
+		region := rcol.Get(regionID)
+		if region == nil {
+			return retwerr(errIDNotFound)
+		}
+		within := oobj.Within(region.Geo())
+		if within != (ifregion == "ifwithin") {
+			if msg.OutputType == JSON {
+				if within {
+					return retwerr(errInsideRegion)
+				}
+				return retwerr(errOutsideRegion)
+			}
+			return resp.NullValue(), commandDetails{}, nil
+		}
+	}
+
 	col, ok := s.cols.Get(key)
 	if !ok {
 		if xx {
 			return nada()
 		}
-		col = collection.New()
+		col = s.newCollection(key)
 		s.cols.Set(key, col)
 	}
 
@@ -785,11 +967,14 @@ func (s *Server) cmdSET(msg *Message) (resp.Value, commandDetails, error) {
 	var flist field.List
 	if old := col.Get(id); old != nil {
 		flist = old.Fields()
+	} else {
+		// only new objects get the default fields of the key
+		flist = s.defaults[key]
 	}
 	for _, f := range fields {
 		flist = flist.Set(f)
 	}
-	obj := object.New(id, oobj, ex, flist)
+	obj := object.New(id, s.dedupGeometry(key, oobj), ex, flist)
 	old := col.Set(obj)
 
 	// >> Response
@@ -948,6 +1133,7 @@ func (s *Server) cmdFGET(msg *Message) (resp.Value, error) {
 }
 
 // EXPIRE key id seconds
+// PEXPIRE key id milliseconds
 func (s *Server) cmdEXPIRE(msg *Message) (resp.Value, commandDetails, error) {
 	start := time.Now()
 
@@ -958,9 +1144,19 @@ func (s *Server) cmdEXPIRE(msg *Message) (resp.Value, commandDetails, error) {
 		return retwerr(errInvalidNumberOfArguments)
 	}
 	key, id, svalue := args[1], args[2], args[3]
-	value, err := strconv.ParseFloat(svalue, 64)
-	if err != nil {
-		return retwerr(errInvalidArgument(svalue))
+	var value float64
+	if msg.Command() == "pexpire" {
+		ms, err := strconv.ParseInt(svalue, 10, 64)
+		if err != nil {
+			return retwerr(errInvalidArgument(svalue))
+		}
+		value = float64(ms) / 1000
+	} else {
+		var err error
+		value, err = strconv.ParseFloat(svalue, 64)
+		if err != nil {
+			return retwerr(errInvalidArgument(svalue))
+		}
 	}
 
 	// >> Operation
@@ -1027,16 +1223,10 @@ func (s *Server) cmdPERSIST(msg *Message) (resp.Value, commandDetails, error) {
 
 	col, _ := s.cols.Get(key)
 	if col == nil {
-		if msg.OutputType == RESP {
-			return resp.IntegerValue(0), commandDetails{}, nil
-		}
 		return retwerr(errKeyNotFound)
 	}
 	o := col.Get(id)
 	if o == nil {
-		if msg.OutputType == RESP {
-			return resp.IntegerValue(0), commandDetails{}, nil
-		}
 		return retwerr(errIDNotFound)
 	}
 
@@ -1074,6 +1264,7 @@ func (s *Server) cmdPERSIST(msg *Message) (resp.Value, commandDetails, error) {
 }
 
 // TTL key id
+// PTTL key id
 func (s *Server) cmdTTL(msg *Message) (resp.Value, error) {
 	start := time.Now()
 
@@ -1103,20 +1294,24 @@ func (s *Server) cmdTTL(msg *Message) (resp.Value, error) {
 		return resp.IntegerValue(-2), nil
 	}
 
+	unit, name := time.Second, "ttl"
+	if msg.Command() == "pttl" {
+		unit, name = time.Millisecond, "pttl"
+	}
 	var ttl float64
 	if o.Expires() == 0 {
 		ttl = -1
 	} else {
 		now := start.UnixNano()
-		ttl = math.Max(float64(o.Expires()-now)/float64(time.Second), 0)
+		ttl = math.Max(float64(o.Expires()-now)/float64(unit), 0)
 	}
 
 	// >> Response
 
 	if msg.OutputType == JSON {
 		return resp.SimpleStringValue(
-			`{"ok":true,"ttl":` + strconv.Itoa(int(ttl)) + `,"elapsed":"` +
-				time.Since(start).String() + "\"}"), nil
+			`{"ok":true,"` + name + `":` + strconv.Itoa(int(ttl)) +
+				`,"elapsed":"` + time.Since(start).String() + "\"}"), nil
 	}
 	return resp.IntegerValue(int(ttl)), nil
 }
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+
+	"github.com/tidwall/btree"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+// csvContentType is the content type of the CSV output over HTTP.
+const csvContentType = "text/csv; charset=utf-8"
+
+// csvWriter writes the objects of a CSV output as rows, following RFC 4180.
+// The columns are the id, the lon and lat, or the WKT of the geometry, the
+// distance when requested, and then the fields.
+type csvWriter struct {
+	fields   []string // nil is the fields of the objects
+	wkt      bool
+	distance bool
+	noheader bool
+	buf      bytes.Buffer
+	w        *csv.Writer
+	row      []string
+}
+
+// newCSVWriter returns the writer for the CSV output, or nil if there's none.
+func newCSVWriter(t searchScanBaseTokens) *csvWriter {
+	if t.output != outputCSV {
+		return nil
+	}
+	cw := &csvWriter{
+		fields:   t.csvfields,
+		wkt:      t.csvwkt,
+		distance: t.distance,
+		noheader: t.csvnoheader,
+	}
+	cw.w = csv.NewWriter(&cw.buf)
+	cw.w.UseCRLF = true
+	return cw
+}
+
+// writeHeader picks the field columns and writes the header row. Without
+// FIELDS the columns are every field of the objects, in order by name.
+func (cw *csvWriter) writeHeader(fkeys *btree.Set[string], nofields bool) {
+	if cw.fields == nil && !nofields {
+		fkeys.Scan(func(name string) bool {
+			cw.fields = append(cw.fields, name)
+			return true
+		})
+	}
+	if cw.noheader {
+		return
+	}
+	row := []string{"id"}
+	if cw.wkt {
+		row = append(row, "wkt")
+	} else {
+		row = append(row, "lon", "lat")
+	}
+	if cw.distance {
+		row = append(row, "distance")
+	}
+	cw.w.Write(append(row, cw.fields...))
+}
+
+func (cw *csvWriter) writeRow(o *object.Object, dist float64) {
+	row := append(cw.row[:0], o.ID())
+	g := o.Geo()
+	if cw.wkt {
+		row = append(row, string(appendWKT(nil, g)))
+	} else if objIsSpatial(g) {
+		center := g.Center()
+		row = append(row, strconv.FormatFloat(center.X, 'f', -1, 64),
+			strconv.FormatFloat(center.Y, 'f', -1, 64))
+	} else {
+		row = append(row, "", "")
+	}
+	if cw.distance {
+		row = append(row, strconv.FormatFloat(dist, 'f', -1, 64))
+	}
+	for _, name := range cw.fields {
+		row = append(row, o.Fields().Get(name).Value().Data())
+	}
+	cw.w.Write(row)
+	cw.row = row
+}
+
+// bytes returns the rows that were written.
+func (cw *csvWriter) bytes() []byte {
+	cw.w.Flush()
+	return cw.buf.Bytes()
+}
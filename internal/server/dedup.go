@@ -0,0 +1,136 @@
+package server
+
+import (
+	"strings"
+	"time"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/collection"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+// dedupSlack is the number of unused geometries that a key that dedupes its
+// geometries may hold on to, on top of one per object, before they're
+// cleared out.
+const dedupSlack = 1024
+
+// geomDedup holds the distinct geometries of a key that dedupes its
+// geometries. Objects with the same geometry share one copy of it. Geometries
+// are never changed in place, so when an object gets another geometry the
+// shared one is left as is for the other objects.
+type geomDedup struct {
+	geoms map[uint64][]geojson.Object // by the hash of their json
+	count int
+}
+
+func newGeomDedup() *geomDedup {
+	return &geomDedup{geoms: make(map[uint64][]geojson.Object)}
+}
+
+// hashString is the 64-bit FNV-1a hash of a string.
+func hashString(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// intern returns the shared copy of a geometry, which is the geometry itself
+// when it's the first of its kind.
+func (dd *geomDedup) intern(g geojson.Object) geojson.Object {
+	json := g.JSON()
+	h := hashString(json)
+	for _, sg := range dd.geoms[h] {
+		if sg.JSON() == json {
+			return sg
+		}
+	}
+	dd.geoms[h] = append(dd.geoms[h], g)
+	dd.count++
+	return g
+}
+
+func (dd *geomDedup) reset() {
+	dd.geoms = make(map[uint64][]geojson.Object)
+	dd.count = 0
+}
+
+// rebuild keeps only the geometries that the objects of a collection have,
+// and has the objects with the same geometry share it.
+func (dd *geomDedup) rebuild(col *collection.Collection) {
+	dd.reset()
+	if col == nil {
+		return
+	}
+	var objs []*object.Object
+	col.Scan(false, nil, nil, func(o *object.Object) bool {
+		objs = append(objs, o)
+		return true
+	})
+	for _, o := range objs {
+		if g := dd.intern(o.Geo()); g != o.Geo() {
+			col.Set(object.New(o.ID(), g, o.Expires(), o.Fields()))
+		}
+	}
+}
+
+// dedupGeometry returns the geometry to store for an object of a key. That's
+// the shared copy for keys that dedupe their geometries.
+func (s *Server) dedupGeometry(key string, g geojson.Object) geojson.Object {
+	dd := s.dedups[key]
+	if dd == nil {
+		return g
+	}
+	// geometries that objects no longer have are cleared out once they
+	// outnumber the objects
+	col, _ := s.cols.Get(key)
+	if col == nil || dd.count > col.Count()*2+dedupSlack {
+		dd.rebuild(col)
+	}
+	return dd.intern(g)
+}
+
+// DEDUP key yes|no
+func (s *Server) cmdDEDUP(msg *Message) (resp.Value, commandDetails, error) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 3 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	key := args[1]
+	var dedup bool
+	switch strings.ToLower(args[2]) {
+	case "yes":
+		dedup = true
+	case "no":
+	default:
+		return retwerr(errInvalidArgument(args[2]))
+	}
+
+	// >> Operation
+
+	var d commandDetails
+	if _, ok := s.dedups[key]; ok != dedup {
+		if dedup {
+			// the objects that are already in the key are deduped too
+			dd := newGeomDedup()
+			col, _ := s.cols.Get(key)
+			dd.rebuild(col)
+			s.dedups[key] = dd
+		} else {
+			delete(s.dedups, key)
+		}
+		d.updated = true
+	}
+	d.timestamp = time.Now()
+
+	// >> Response
+
+	return OKMessage(msg, start), d, nil
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+// deltaTokenTTL is how long a DELTA token can be used after it was issued.
+const deltaTokenTTL = time.Minute * 5
+
+const (
+	maxDeltaTokens   = 1024    // live tokens, the oldest are evicted
+	maxDeltaIDs      = 1000000 // ids of all live tokens, the oldest are evicted
+	maxDeltaSnapshot = 100000  // ids of a single token
+)
+
+var errDeltaToken = errors.New("invalid or expired delta token")
+var errDeltaQuery = errors.New("delta token does not match the query")
+var errDeltaTooMany = errors.New("too many objects for DELTA, the limit is " +
+	strconv.Itoa(maxDeltaSnapshot))
+
+// deltaSnapshot holds the ids that a polling client received for a query.
+type deltaSnapshot struct {
+	query   string
+	ids     map[string]bool
+	expires time.Time
+}
+
+// deltaIssued is a token in the order that the tokens were issued, which is
+// also the order that they expire in.
+type deltaIssued struct {
+	token   string
+	expires time.Time
+}
+
+// deltaQuery returns the query that a delta token is bound to.
+func deltaQuery(cmd string, sargs *liveFenceSwitches) string {
+	return cmd + " " + sargs.key + " " + sargs.obj.String()
+}
+
+// takeDeltaSnapshot removes and returns the snapshot for a token. The token
+// "0" starts with an empty snapshot.
+func (s *Server) takeDeltaSnapshot(token, query string, now time.Time,
+) (map[string]bool, error) {
+	s.deltamu.Lock()
+	defer s.deltamu.Unlock()
+	s.evictDeltaSnapshots(now, -1)
+	if token == "0" {
+		return nil, nil
+	}
+	snap := s.deltas[token]
+	if snap == nil {
+		return nil, errDeltaToken
+	}
+	if snap.query != query {
+		return nil, errDeltaQuery
+	}
+	s.deleteDeltaSnapshot(token, snap)
+	return snap.ids, nil
+}
+
+// putDeltaSnapshot stores the snapshot for a new token, making room for it by
+// evicting the oldest tokens.
+func (s *Server) putDeltaSnapshot(token string, snap *deltaSnapshot,
+	now time.Time,
+) {
+	s.deltamu.Lock()
+	defer s.deltamu.Unlock()
+	s.evictDeltaSnapshots(now, len(snap.ids))
+	s.deltas[token] = snap
+	s.deltaIDs += len(snap.ids)
+	s.deltaq = append(s.deltaq, deltaIssued{token, snap.expires})
+	if len(s.deltaq) > len(s.deltas)*2+64 {
+		// forget the tokens that were already taken
+		q := s.deltaq[:0]
+		for _, issued := range s.deltaq {
+			if s.deltas[issued.token] != nil {
+				q = append(q, issued)
+			}
+		}
+		s.deltaq = q
+	}
+}
+
+// evictDeltaSnapshots removes the expired tokens, and the oldest tokens until
+// there's room for a snapshot with n ids, unless n is negative. Must hold the
+// delta lock.
+func (s *Server) evictDeltaSnapshots(now time.Time, n int) {
+	for len(s.deltaq) > 0 {
+		issued := s.deltaq[0]
+		snap := s.deltas[issued.token]
+		if snap != nil && !now.After(issued.expires) &&
+			(n < 0 || (len(s.deltas) < maxDeltaTokens &&
+				s.deltaIDs+n <= maxDeltaIDs)) {
+			break
+		}
+		s.deltaq = s.deltaq[1:]
+		if snap != nil {
+			s.deleteDeltaSnapshot(issued.token, snap)
+		}
+	}
+}
+
+func (s *Server) deleteDeltaSnapshot(token string, snap *deltaSnapshot) {
+	delete(s.deltas, token)
+	s.deltaIDs -= len(snap.ids)
+}
+
+// writeDelta returns the ids that entered and exited the search area since
+// the snapshot of the DELTA token was taken, along with a new token.
+func (s *Server) writeDelta(cmd string, sw *scanWriter,
+	sargs *liveFenceSwitches, msg *Message, start time.Time,
+) (resp.Value, error) {
+	query := deltaQuery(cmd, sargs)
+	prev, err := s.takeDeltaSnapshot(sargs.delta, query, start)
+	if err != nil {
+		return retrerr(err)
+	}
+	ids := make(map[string]bool)
+	if sw.col != nil {
+		var ierr error
+		iter := func(o *object.Object) bool {
+			ok, keepGoing, err := sw.testObject(o)
+			if err != nil {
+				ierr = err
+				return false
+			}
+			if ok {
+				if len(ids) == maxDeltaSnapshot {
+					ierr = errDeltaTooMany
+					return false
+				}
+				ids[o.ID()] = true
+			}
+			return keepGoing
+		}
+		if cmd == "within" {
+			sw.col.Within(sargs.obj, 0, nil, msg.Deadline, iter)
+		} else {
+			sw.col.Intersects(sargs.obj, 0, nil, msg.Deadline, iter)
+		}
+		if ierr != nil {
+			return retrerr(ierr)
+		}
+	}
+	entered := []string{}
+	exited := []string{}
+	for id := range ids {
+		if !prev[id] {
+			entered = append(entered, id)
+		}
+	}
+	for id := range prev {
+		if !ids[id] {
+			exited = append(exited, id)
+		}
+	}
+	sort.Strings(entered)
+	sort.Strings(exited)
+
+	token := randomKey(16)
+	s.putDeltaSnapshot(token, &deltaSnapshot{
+		query:   query,
+		ids:     ids,
+		expires: start.Add(deltaTokenTTL),
+	}, start)
+
+	switch msg.OutputType {
+	case JSON:
+		var b []byte
+		b = append(b, `{"ok":true,"token":`...)
+		b = appendJSONString(b, token)
+		b = append(b, `,"entered":`...)
+		b = appendJSONStrings(b, entered)
+		b = append(b, `,"exited":`...)
+		b = appendJSONStrings(b, exited)
+		b = append(b, `,"elapsed":"`+time.Since(start).String()+`"}`...)
+		return resp.BytesValue(b), nil
+	case RESP:
+		return resp.ArrayValue([]resp.Value{
+			resp.StringValue(token),
+			respStrings(entered),
+			respStrings(exited),
+		}), nil
+	}
+	return NOMessage, nil
+}
+
+func respStrings(strs []string) resp.Value {
+	vals := make([]resp.Value, len(strs))
+	for i, str := range strs {
+		vals[i] = resp.StringValue(str)
+	}
+	return resp.ArrayValue(vals)
+}
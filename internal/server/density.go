@@ -0,0 +1,185 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+// maxDensityGrid is the most columns or rows that DENSITY accepts.
+const maxDensityGrid = 1024
+
+// densityCell returns the index of the cell along one axis of the grid for a
+// value, or -1 when the value is outside of the range.
+func densityCell(v, min, max float64, n int) int {
+	if v < min || v > max || max <= min {
+		return -1
+	}
+	i := int((v - min) / (max - min) * float64(n))
+	if i >= n {
+		i = n - 1
+	}
+	return i
+}
+
+// DENSITY key BOUNDS minlat minlon maxlat maxlon GRID cols rows [WHERE ...]
+func (s *Server) cmdDENSITY(msg *Message) (res resp.Value, err error) {
+	start := time.Now()
+
+	// >> Args
+
+	vs := msg.Args[1:]
+	var key, tok string
+	var ok bool
+	if vs, key, ok = tokenval(vs); !ok || key == "" {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	if vs, tok, ok = tokenval(vs); !ok || tok == "" {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	if strings.ToLower(tok) != "bounds" {
+		return retrerr(errInvalidArgument(tok))
+	}
+	var rect *geojson.Rect
+	if vs, rect, err = parseRectArea("bounds", vs); err != nil {
+		return retrerr(err)
+	}
+	if vs, tok, ok = tokenval(vs); !ok || tok == "" {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	if strings.ToLower(tok) != "grid" {
+		return retrerr(errInvalidArgument(tok))
+	}
+	var dims [2]int
+	for i := range dims {
+		var sdim string
+		if vs, sdim, ok = tokenval(vs); !ok || sdim == "" {
+			return retrerr(errInvalidNumberOfArguments)
+		}
+		n, err := strconv.ParseUint(sdim, 10, 64)
+		if err != nil || n == 0 || n > maxDensityGrid {
+			return retrerr(errInvalidArgument(sdim))
+		}
+		dims[i] = int(n)
+	}
+	cols, rows := dims[0], dims[1]
+	// the remaining arguments filter the objects, like for a search
+	var lfs liveFenceSwitches
+	vs, lfs.searchScanBaseTokens, err = s.parseSearchScanBaseTokens("density",
+		lfs.searchScanBaseTokens, append([]string{key}, vs...))
+	if lfs.usingLua() {
+		defer lfs.Close()
+		defer func() {
+			if r := recover(); r != nil {
+				res = NOMessage
+				err = errors.New(r.(string))
+				return
+			}
+		}()
+	}
+	if err != nil {
+		return retrerr(err)
+	}
+	if len(vs) != 0 {
+		return retrerr(errInvalidArgument(vs[0]))
+	}
+	if lfs.output != defaultSearchOutput {
+		return retrerr(errors.New("an output type is not allowed for DENSITY"))
+	}
+
+	// >> Operation
+
+	sw, err := s.newScanWriter(
+		&bytes.Buffer{}, msg, key, outputCount, lfs.precision, lfs.globs, false,
+		0, 0, lfs.wheres, lfs.whereins, lfs.whereevals, lfs.nofields)
+	if err != nil {
+		return retrerr(err)
+	}
+	if err := s.checkStrictKey(sw, lfs.strict); err != nil {
+		return retrerr(err)
+	}
+	sw.ttls = newTTLFilter(lfs.searchScanBaseTokens)
+	// Bounds that cross the antimeridian are measured from the min longitude
+	// eastward, so the grid continues past 180.
+	r := rect.Rect()
+	minX, maxX := r.Min.X, r.Max.X
+	if minX > maxX {
+		maxX += 360
+	}
+	cells := make([]int, cols*rows)
+	var ierr error
+	if sw.col != nil {
+		sw.col.Intersects(s.antimeridianArea(rect), 0, nil, msg.Deadline,
+			func(o *object.Object) bool {
+				match, keepGoing, err := sw.testObject(o)
+				if err != nil {
+					ierr = err
+					return false
+				}
+				if !match {
+					return keepGoing
+				}
+				// each object is counted once, in the cell of its center
+				center := o.Geo().Center()
+				if center.X < minX {
+					center.X += 360
+				}
+				x := densityCell(center.X, minX, maxX, cols)
+				y := densityCell(r.Max.Y-center.Y, 0, r.Max.Y-r.Min.Y, rows)
+				if x >= 0 && y >= 0 {
+					cells[y*cols+x]++
+				}
+				return keepGoing
+			},
+		)
+	}
+	if ierr != nil {
+		return retrerr(ierr)
+	}
+
+	// >> Response
+
+	// The rows are ordered from north to south, and the columns from west to
+	// east.
+	switch msg.OutputType {
+	case JSON:
+		var b []byte
+		b = append(b, `{"ok":true,"cols":`...)
+		b = strconv.AppendInt(b, int64(cols), 10)
+		b = append(b, `,"rows":`...)
+		b = strconv.AppendInt(b, int64(rows), 10)
+		b = append(b, `,"cells":[`...)
+		for y := 0; y < rows; y++ {
+			if y > 0 {
+				b = append(b, ',')
+			}
+			b = append(b, '[')
+			for x := 0; x < cols; x++ {
+				if x > 0 {
+					b = append(b, ',')
+				}
+				b = strconv.AppendInt(b, int64(cells[y*cols+x]), 10)
+			}
+			b = append(b, ']')
+		}
+		b = append(b, `],"elapsed":"`+time.Since(start).String()+`"}`...)
+		return resp.BytesValue(b), nil
+	case RESP:
+		vals := make([]resp.Value, rows)
+		for y := range vals {
+			row := make([]resp.Value, cols)
+			for x := range row {
+				row[x] = resp.IntegerValue(cells[y*cols+x])
+			}
+			vals[y] = resp.ArrayValue(row)
+		}
+		return resp.ArrayValue(vals), nil
+	}
+	return NOMessage, nil
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"github.com/tidwall/tile38/internal/hll"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+// distinctCounter counts the distinct values of a field for NDISTINCT. The
+// values are kept in a set until there are more than the
+// distinct-exact-limit, after which the count is estimated with a
+// HyperLogLog. Objects that don't have the field are not counted.
+type distinctCounter struct {
+	field  string
+	limit  int
+	values map[string]struct{}
+	sketch *hll.Sketch
+}
+
+// newDistinctCounter returns the counter for NDISTINCT, or nil if there's
+// none.
+func (s *Server) newDistinctCounter(t searchScanBaseTokens) *distinctCounter {
+	if t.output != outputDistinct {
+		return nil
+	}
+	return &distinctCounter{
+		field:  t.distinct,
+		limit:  s.config.distinctExactLimit(),
+		values: make(map[string]struct{}),
+	}
+}
+
+func (dc *distinctCounter) add(o *object.Object) {
+	value := o.Fields().Get(dc.field).Value()
+	if value.IsZero() {
+		return
+	}
+	// the json of a value tells strings and numbers apart
+	data := value.JSON()
+	if dc.sketch != nil {
+		dc.sketch.Add(data)
+		return
+	}
+	dc.values[data] = struct{}{}
+	if len(dc.values) > dc.limit {
+		dc.sketch = new(hll.Sketch)
+		for data := range dc.values {
+			dc.sketch.Add(data)
+		}
+		dc.values = nil
+	}
+}
+
+// count returns the number of distinct values, and whether it's an estimate.
+func (dc *distinctCounter) count() (n uint64, approximate bool) {
+	if dc.sketch != nil {
+		return dc.sketch.Count(), true
+	}
+	return uint64(len(dc.values)), false
+}
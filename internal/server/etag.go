@@ -0,0 +1,59 @@
+package server
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/tidwall/resp"
+)
+
+// resultETag returns the ETag of a search or scan result, which is the hash
+// of the result itself. The same result always has the same ETag, for a
+// given output type.
+func resultETag(msg *Message, wr *bytes.Buffer, respOut resp.Value) string {
+	var data []byte
+	if msg.OutputType == JSON {
+		data = wr.Bytes()
+	} else {
+		data, _ = respOut.MarshalRESP()
+	}
+	return strconv.FormatUint(hashString(string(data)), 16)
+}
+
+// writeResult returns the result of a search or scan. With WITHETAG or
+// IFNONEMATCH the ETag of the result is included, and with IFNONEMATCH a
+// result that has the ETag that the client already has is replaced by a not
+// modified reply.
+func writeResult(msg *Message, t *searchScanBaseTokens, wr *bytes.Buffer,
+	respOut resp.Value, start time.Time,
+) (resp.Value, error) {
+	var etag string
+	if t.withetag || t.hasetag {
+		etag = resultETag(msg, wr, respOut)
+	}
+	notModified := t.hasetag && t.etag == etag
+	switch msg.OutputType {
+	case JSON:
+		if notModified {
+			msg.body = nil
+			wr.Reset()
+			wr.WriteString(`{"ok":true,"notmodified":true`)
+		}
+		if etag != "" {
+			wr.WriteString(`,"etag":"` + etag + `"`)
+		}
+		wr.WriteString(`,"elapsed":"` + time.Since(start).String() + "\"}")
+		return resp.BytesValue(wr.Bytes()), nil
+	case RESP:
+		if notModified {
+			return resp.SimpleStringValue("NOTMODIFIED"), nil
+		}
+		if etag != "" {
+			return resp.ArrayValue([]resp.Value{
+				resp.StringValue(etag), respOut,
+			}), nil
+		}
+	}
+	return respOut, nil
+}
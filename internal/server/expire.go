@@ -11,33 +11,125 @@ import (
 
 const bgExpireDelay = time.Second / 10
 
+// minExpireDelay is the shortest wait between two ticks, which keeps objects
+// with millisecond expirations from spinning the loop.
+const minExpireDelay = time.Millisecond * 5
+
+// expireBatch is the number of objects that are expired per tick for each
+// level of active-expire-effort.
+const expireBatch = 1000
+
+// maxExpireGrowth is the number of batches that a tick may grow to while
+// there's a backlog of expired objects.
+const maxExpireGrowth = 4
+
+// expired returns true when the object has expired at the time in unix
+// nanoseconds. Reads must skip expired objects, because they are only deleted
+// from the database by the next ticks when there's a backlog.
+func expired(o *object.Object, now int64) bool {
+	return o.Expires() != 0 && o.Expires() <= now
+}
+
 // backgroundExpiring deletes expired items from the database.
-// It's executes every 1/10 of a second.
+// It's executes every 1/10 of a second, or sooner when an object expires
+// before then.
 func (s *Server) backgroundExpiring(wg *sync.WaitGroup) {
 	defer wg.Done()
-	s.loopUntilServerStops(bgExpireDelay, func() {
+	for !s.stopServer.Load() {
 		s.mu.Lock()
-		defer s.mu.Unlock()
 		now := time.Now()
-		s.backgroundExpireObjects(now)
+		next := s.backgroundExpireObjects(now)
 		s.backgroundExpireHooks(now)
-	})
+		s.mu.Unlock()
+		delay := bgExpireDelay
+		if next != 0 && time.Duration(next-now.UnixNano()) < delay {
+			delay = time.Duration(next - now.UnixNano())
+		}
+		if delay < minExpireDelay {
+			delay = minExpireDelay
+		}
+		time.Sleep(delay)
+	}
 }
 
-func (s *Server) backgroundExpireObjects(now time.Time) {
+// backgroundExpireObjects deletes expired objects. Only a bounded number of
+// objects are deleted per tick, so that a large number of objects expiring
+// together does not stall the server. The bound starts at a batch for each
+// level of active-expire-effort, and doubles for every tick that leaves a
+// backlog of expired objects behind, up to maxExpireGrowth batches. Each
+// tick continues with the collection where the previous tick stopped.
+// The objects of keys with a PREEXPIRE lead time that are about to expire
+// are notified about too, continuing from the cursor of the key, and bound
+// by the same limit. It returns when the next object expires, or zero when
+// that's not known.
+func (s *Server) backgroundExpireObjects(now time.Time) (next int64) {
 	nano := now.UnixNano()
+	batch := s.config.expireEffort() * expireBatch
+	limit := batch
+	if s.expireLimit > limit {
+		limit = s.expireLimit
+	}
 	var msgs []*Message
-	s.cols.Scan(func(key string, col *collection.Collection) bool {
+	var pre []preExpiring
+	var preFull bool
+	var nextKey string
+	due := func(at int64) {
+		if next == 0 || at < next {
+			next = at
+		}
+	}
+	scan := func(key string, col *collection.Collection) bool {
 		col.ScanExpires(func(o *object.Object) bool {
 			if nano < o.Expires() {
 				return false
 			}
-			s.statsExpired.Add(1)
+			if len(msgs) == limit {
+				// the tick is full, the next one starts here
+				if nextKey == "" {
+					nextKey = key
+				}
+				return false
+			}
 			msgs = append(msgs, &Message{Args: []string{"del", key, o.ID()}})
 			return true
 		})
+		col.ScanExpiresAfter(nano, func(o *object.Object) bool {
+			due(o.Expires())
+			return false
+		})
+		lead := int64(s.preexps[key])
+		if lead == 0 {
+			return true
+		}
+		cur := s.preexpd[key]
+		if cur.expires < nano {
+			cur = preExpireCursor{expires: nano}
+		}
+		col.ScanExpiresFrom(cur.expires, cur.id, func(o *object.Object) bool {
+			if o.Expires() <= nano {
+				// already expired
+				return true
+			}
+			if nano < o.Expires()-lead {
+				due(o.Expires() - lead)
+				return false
+			}
+			if len(pre) == limit {
+				preFull = true
+				return false
+			}
+			pre = append(pre, preExpiring{key, o})
+			return true
+		})
 		return true
-	})
+	}
+	start := s.expireNext
+	s.cols.Ascend(start, scan)
+	if start != "" {
+		s.cols.Scan(func(key string, col *collection.Collection) bool {
+			return key < start && scan(key, col)
+		})
+	}
 	for _, msg := range msgs {
 		_, d, err := s.cmdDEL(msg)
 		if err != nil {
@@ -47,9 +139,33 @@ func (s *Server) backgroundExpireObjects(now time.Time) {
 			log.Fatal(err)
 		}
 	}
+	var backlog int
+	if nextKey != "" {
+		// the expired objects that are left are counted, without scanning
+		s.cols.Scan(func(key string, col *collection.Collection) bool {
+			backlog += col.CountExpired(nano)
+			return true
+		})
+	}
+	s.expireNext = nextKey
+	s.expireBacklog = backlog
+	s.expireLimit = 0
+	if backlog > 0 {
+		s.expireLimit = limit * 2
+		if s.expireLimit > batch*maxExpireGrowth {
+			s.expireLimit = batch * maxExpireGrowth
+		}
+	}
+	s.notifyPreExpiring(pre, now)
+	s.statsExpired.Add(int64(len(msgs)))
 	if len(msgs) > 0 {
-		log.Debugf("Expired %d objects\n", len(msgs))
+		log.Debugf("Expired %d objects, %d pending\n", len(msgs), backlog)
+	}
+	if backlog > 0 || preFull {
+		// the backlog is worked off at the regular pace
+		next = 0
 	}
+	return next
 }
 
 func (s *Server) backgroundExpireHooks(now time.Time) {
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/redcon"
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/field"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+// defaultExportCheckpoint is the number of objects between the checkpoints of
+// an EXPORT.
+const defaultExportCheckpoint = 1000
+
+type liveExportSwitches struct {
+	key        string
+	after      string // the last id of the checkpoint to resume from
+	resume     bool
+	checkpoint int
+}
+
+func (s liveExportSwitches) Error() string {
+	return goingLive
+}
+
+// exportToken returns the checkpoint token for the last exported id.
+func exportToken(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+// EXPORT key [CHECKPOINT count] [RESUME token]
+func (s *Server) cmdEXPORT(msg *Message) (resp.Value, error) {
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) < 2 || len(args)%2 == 1 {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	ls := liveExportSwitches{
+		key:        args[1],
+		checkpoint: defaultExportCheckpoint,
+	}
+	for i := 2; i < len(args); i += 2 {
+		switch strings.ToLower(args[i]) {
+		case "checkpoint":
+			n, err := strconv.ParseUint(args[i+1], 10, 31)
+			if err != nil || n == 0 {
+				return retrerr(errInvalidArgument(args[i+1]))
+			}
+			ls.checkpoint = int(n)
+		case "resume":
+			after, err := base64.RawURLEncoding.DecodeString(args[i+1])
+			if err != nil {
+				return retrerr(errInvalidArgument(args[i+1]))
+			}
+			ls.after, ls.resume = string(after), true
+		default:
+			return retrerr(errInvalidArgument(args[i]))
+		}
+	}
+
+	// >> Response
+
+	return NOMessage, ls
+}
+
+// appendExportObject appends the json message for an exported object.
+func appendExportObject(b []byte, o *object.Object) []byte {
+	b = append(b, `{"id":`...)
+	b = appendJSONString(b, o.ID())
+	b = append(b, `,"object":`...)
+	b = o.Geo().AppendJSON(b)
+	if o.Fields().Len() > 0 {
+		b = append(b, `,"fields":{`...)
+		var i int
+		o.Fields().Scan(func(f field.Field) bool {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSONString(b, f.Name())
+			b = append(b, ':')
+			b = append(b, f.Value().JSON()...)
+			i++
+			return true
+		})
+		b = append(b, '}')
+	}
+	return append(b, '}')
+}
+
+// liveExport streams the objects of a collection in id order. A checkpoint
+// token follows every batch of objects, and passing it to RESUME continues
+// with the objects after that batch. The lock is only held for one batch at a
+// time, so writes are not held up by a long export. Objects that change
+// during the export are sent as they are when their batch is read, and ids
+// that sort before the current position are not revisited.
+func (s *Server) liveExport(ls liveExportSwitches, conn net.Conn,
+	rd *PipelineReader, msg *Message, websocket bool,
+) error {
+	defer conn.Close()
+	go func() {
+		// Any incoming message should end the export
+		rd.ReadMessages()
+		conn.Close()
+	}()
+	connType := msg.ConnType
+	var livemsg []byte
+	switch msg.OutputType {
+	case JSON:
+		livemsg = redcon.AppendBulkString(nil, `{"ok":true,"live":true}`)
+	case RESP:
+		livemsg = redcon.AppendOK(nil)
+	}
+	if err := writeLiveMessage(conn, livemsg, false, connType, websocket); err != nil {
+		return nil // nil return is fine here
+	}
+	after, resume := ls.after, ls.resume
+	var count int
+	for {
+		var msgs [][]byte
+		s.mu.RLock()
+		if col, _ := s.cols.Get(ls.key); col != nil {
+			col.ScanGreaterOrEqual(after, false, nil, nil,
+				func(o *object.Object) bool {
+					if resume && o.ID() == after {
+						return true
+					}
+					msgs = append(msgs, appendExportObject(nil, o))
+					after = o.ID()
+					return len(msgs) < ls.checkpoint
+				},
+			)
+		}
+		s.mu.RUnlock()
+		resume = true
+		for _, m := range msgs {
+			if err := writeLiveMessage(conn, m, true, connType, websocket); err != nil {
+				return nil
+			}
+		}
+		count += len(msgs)
+		if len(msgs) < ls.checkpoint {
+			break
+		}
+		m := []byte(`{"checkpoint":"` + exportToken(after) + `"}`)
+		if err := writeLiveMessage(conn, m, true, connType, websocket); err != nil {
+			return nil
+		}
+	}
+	m := []byte(`{"done":true,"count":` + strconv.Itoa(count) + `}`)
+	writeLiveMessage(conn, m, true, connType, websocket)
+	return nil
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/geojson/geometry"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/tile38/internal/field"
+)
+
+// maxFeatureGrid is the largest grid that FEATURES INDEX accepts.
+const maxFeatureGrid = 64
+
+// writeFeature writes an object as a GeoJSON Feature for the FEATURES output.
+func (sw *scanWriter) writeFeature(opts ScanWriterParams) {
+	var b []byte
+	if sw.once {
+		b = append(b, ',')
+	} else {
+		sw.once = true
+	}
+	b = appendFeature(b, opts, !sw.nofields)
+	if objIsSpatial(opts.obj.Geo()) {
+		sw.frects = append(sw.frects, opts.obj.Rect())
+	}
+	switch sw.msg.OutputType {
+	case JSON:
+		sw.wr.Write(b)
+	case RESP:
+		sw.fbuf = append(sw.fbuf, b...)
+	}
+}
+
+// appendFeature appends an object as a GeoJSON Feature. The fields of the
+// object are added to the properties, unless the object already has a
+// property with the same name.
+func appendFeature(b []byte, opts ScanWriterParams, withFields bool) []byte {
+	o := opts.obj
+	props := "{}"
+	b = append(b, `{"type":"Feature","id":`...)
+	b = appendJSONString(b, o.ID())
+	b = append(b, `,"geometry":`...)
+	switch g := o.Geo().(type) {
+	case *geojson.Feature:
+		b = g.Base().AppendJSON(b)
+		if res := gjson.Get(g.Members(), "properties"); res.IsObject() {
+			props = res.Raw
+		}
+	default:
+		if objIsSpatial(g) {
+			b = g.AppendJSON(b)
+		} else {
+			b = append(b, "null"...)
+			props = `{"value":` + jsonString(g.String()) + `}`
+		}
+	}
+	b = append(b, `,"properties":`...)
+	if withFields && o.Fields().Len() > 0 {
+		taken := make(map[string]bool)
+		gjson.Parse(props).ForEach(func(key, _ gjson.Result) bool {
+			taken[key.String()] = true
+			return true
+		})
+		b = append(b, props[:len(props)-1]...)
+		n := len(taken)
+		o.Fields().Scan(func(f field.Field) bool {
+			if !f.Value().IsZero() && !taken[f.Name()] {
+				if n > 0 {
+					b = append(b, ',')
+				}
+				b = appendJSONString(b, f.Name())
+				b = append(b, ':')
+				b = append(b, f.Value().JSON()...)
+				n++
+			}
+			return true
+		})
+		b = append(b, '}')
+	} else {
+		b = append(b, props...)
+	}
+	if opts.distOutput || opts.dist > 0 {
+		b = append(b, `,"distance":`...)
+		b = strconv.AppendFloat(b, opts.dist, 'f', -1, 64)
+	}
+	if opts.bearingOutput {
+		b = append(b, `,"bearing":`...)
+		b = strconv.AppendFloat(b, opts.bearing, 'f', -1, 64)
+	}
+	if opts.alongOutput {
+		b = append(b, `,"along":`...)
+		b = strconv.AppendFloat(b, opts.along, 'f', -1, 64)
+	}
+	if opts.scoreOutput {
+		b = append(b, `,"score":`...)
+		b = strconv.AppendFloat(b, opts.score, 'f', -1, 64)
+	}
+	if opts.zone != "" {
+		b = append(b, `,"zone":"`+opts.zone+`"`...)
+	}
+	return append(b, '}')
+}
+
+// appendFeatureIndex appends the spatial summary of FEATURES INDEX. It holds
+// the bounding box of all features, and the number of features that touch
+// each cell of an evenly spaced grid over that box. The cells are ordered by
+// row from south to north, and by column from west to east.
+func appendFeatureIndex(b []byte, rects []geometry.Rect, grid int) []byte {
+	b = append(b, `{"bbox":`...)
+	if len(rects) == 0 {
+		b = append(b, `null,"grid":`...)
+		b = strconv.AppendInt(b, int64(grid), 10)
+		return append(b, `,"cells":[]}`...)
+	}
+	bbox := rects[0]
+	for _, rect := range rects[1:] {
+		bbox = unionRect(bbox, rect)
+	}
+	cells := make([]int, grid*grid)
+	cell := func(v, min, max float64) int {
+		if max <= min {
+			return 0
+		}
+		i := int((v - min) / (max - min) * float64(grid))
+		if i >= grid {
+			i = grid - 1
+		}
+		return i
+	}
+	for _, rect := range rects {
+		x0 := cell(rect.Min.X, bbox.Min.X, bbox.Max.X)
+		x1 := cell(rect.Max.X, bbox.Min.X, bbox.Max.X)
+		y0 := cell(rect.Min.Y, bbox.Min.Y, bbox.Max.Y)
+		y1 := cell(rect.Max.Y, bbox.Min.Y, bbox.Max.Y)
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				cells[y*grid+x]++
+			}
+		}
+	}
+	b = append(b, '[')
+	for i, v := range []float64{
+		bbox.Min.X, bbox.Min.Y, bbox.Max.X, bbox.Max.Y,
+	} {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = strconv.AppendFloat(b, v, 'f', -1, 64)
+	}
+	b = append(b, `],"grid":`...)
+	b = strconv.AppendInt(b, int64(grid), 10)
+	b = append(b, `,"cells":[`...)
+	for i, n := range cells {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = strconv.AppendInt(b, int64(n), 10)
+	}
+	return append(b, "]}"...)
+}
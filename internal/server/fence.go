@@ -75,11 +75,15 @@ func fenceMatch(
 	hookName string, sw *scanWriter, fence *liveFenceSwitches,
 	metas []FenceMeta, details *commandDetails,
 ) []string {
+	if !fenceArmed(sw.s, fence) {
+		return nil
+	}
+	receipt := string(appendReceipt(nil, sw.s, details))
 	if details.command == "drop" {
 		return []string{
 			`{"command":"drop"` + hookJSONString(hookName, metas) +
 				`,"key":` + jsonString(details.key) +
-				`,"time":` + jsonTimeFormat(details.timestamp) + `}`,
+				`,"time":` + jsonTimeFormat(details.timestamp) + receipt + `}`,
 		}
 	}
 	if details.obj == nil {
@@ -97,21 +101,38 @@ func fenceMatch(
 			return nil
 		}
 	}
+	if details.command == "preexpire" {
+		return []string{
+			`{"command":"preexpire"` + hookJSONString(hookName, metas) +
+				`,"key":` + jsonString(details.key) +
+				`,` + jsonID(details.obj.ID()) +
+				`,"time":` + jsonTimeFormat(details.timestamp) +
+				`,"expires":` +
+				jsonTimeFormat(time.Unix(0, details.obj.Expires())) +
+				receipt + `}`,
+		}
+	}
 	if details.command == "del" {
 		return []string{
 			`{"command":"del"` + hookJSONString(hookName, metas) +
 				`,"key":` + jsonString(details.key) +
-				`,"id":` + jsonString(details.obj.ID()) +
-				`,"time":` + jsonTimeFormat(details.timestamp) + `}`,
+				`,` + jsonID(details.obj.ID()) +
+				`,"time":` + jsonTimeFormat(details.timestamp) + receipt + `}`,
 		}
 	}
-	var roamNearbys, roamFaraways []roamMatch
+	var roamNearbys, roamFaraways, roamDwells []roamMatch
 	var detect = "outside"
 	if fence != nil {
 		if fence.roam.on {
 			if details.command == "set" {
 				roamNearbys, roamFaraways =
 					fenceMatchRoam(sw.s, fence, details.obj, details.old)
+				if dwell := fence.dwellTime(); dwell > 0 {
+					// each pair dwells on its own
+					roamDwells = sw.s.groupRoamDwell(hookName, details.key,
+						details.obj.ID(), roamNearbys, details.timestamp,
+						dwell, sw.dryRun)
+				}
 				if len(roamNearbys) == 0 && len(roamFaraways) == 0 {
 					return nil
 				}
@@ -173,6 +194,7 @@ func fenceMatch(
 	// if details.fmap == nil {
 	// 	return nil
 	// }
+	entered := detect == "enter"
 	for {
 		if fence.detect != nil && !fence.detect[detect] {
 			if detect == "enter" {
@@ -183,13 +205,18 @@ func fenceMatch(
 				detect = "outside"
 				continue
 			}
+			if (detect == "inside" || detect == "roam") &&
+				fence.dwellTime() > 0 {
+				// not reported, but it may dwell
+				break
+			}
 			return nil
 		}
 		break
 	}
 	var distance float64
 	if fence.distance && fence.obj != nil {
-		distance = details.obj.Geo().Distance(fence.obj)
+		distance = objectDistance(fence.metric, details.obj.Geo(), fence.obj)
 	}
 
 	sw.fullFields = true
@@ -210,12 +237,21 @@ func fenceMatch(
 	if len(res) > 0 && res[0] == ',' {
 		res = res[1:]
 	}
-	if sw.output == outputIDs {
+	// binary ids are already written as an object
+	if sw.output == outputIDs &&
+		(fence.distance || !binaryID(details.obj.ID())) {
 		res = `{"id":` + string(res) + `}`
 	}
 
 	var group string
-	if detect == "enter" {
+	if sw.dryRun {
+		group = sw.s.groupGet(hookName, details.key, details.obj.ID())
+		if group == "" || detect == "enter" || detect == "cross" {
+			group = bsonID()
+		}
+	} else if detect == "enter" || (entered && fence.dwellTime() > 0) {
+		// an object that entered starts to dwell, even when only its
+		// inside was reported.
 		group = sw.s.groupConnect(hookName, details.key, details.obj.ID())
 	} else if detect == "cross" {
 		sw.s.groupDisconnect(hookName, details.key, details.obj.ID())
@@ -226,27 +262,51 @@ func fenceMatch(
 			group = sw.s.groupConnect(hookName, details.key, details.obj.ID())
 		}
 	}
+	var dwelled bool
+	if detect == "inside" {
+		if dwell := fence.dwellTime(); dwell > 0 {
+			dwelled = sw.s.groupDwell(hookName, details.key,
+				details.obj.ID(), details.timestamp, dwell, sw.dryRun)
+		}
+		if !dwelled && fence.detect != nil && !fence.detect[detect] {
+			return nil
+		}
+	}
 	var msgs []string
 	if fence.detect == nil || fence.detect[detect] {
 		if len(res) > 0 && res[0] == '{' {
+			tail := res[1:]
+			if detect == "cross" && fence.obj != nil {
+				// the edges of the fence that were crossed
+				crossings := fenceCrossings(fence.obj,
+					details.old.Geo().Center(), details.obj.Geo().Center())
+				if len(crossings) > 0 {
+					tail = string(appendCrossingsJSON(nil, crossings)) + tail
+				}
+			}
 			msgs = append(msgs, makemsg(details.command, group, detect,
-				hookName, metas, details.key, details.timestamp, res[1:]))
+				hookName, metas, details.key, details.timestamp, receipt,
+				tail))
 		} else {
 			msgs = append(msgs, string(res))
 		}
 	}
 	switch detect {
+	case "inside":
+		if dwelled {
+			msgs = append(msgs, makemsg(details.command, group, "dwell", hookName, metas, details.key, details.timestamp, receipt, res[1:]))
+		}
 	case "enter":
 		if fence.detect == nil || fence.detect["inside"] {
-			msgs = append(msgs, makemsg(details.command, group, "inside", hookName, metas, details.key, details.timestamp, res[1:]))
+			msgs = append(msgs, makemsg(details.command, group, "inside", hookName, metas, details.key, details.timestamp, receipt, res[1:]))
 		}
 	case "exit", "cross":
 		if fence.detect == nil || fence.detect["outside"] {
-			msgs = append(msgs, makemsg(details.command, group, "outside", hookName, metas, details.key, details.timestamp, res[1:]))
+			msgs = append(msgs, makemsg(details.command, group, "outside", hookName, metas, details.key, details.timestamp, receipt, res[1:]))
 		}
 	case "roam":
+		var nmsgs []string
 		if len(msgs) > 0 {
-			var nmsgs []string
 			for _, msg := range msgs {
 				cmd := gjson.Get(msg, "command")
 				if cmd.Exists() && cmd.String() != "set" {
@@ -254,44 +314,80 @@ func fenceMatch(
 				}
 			}
 			for i := range roamNearbys {
-				nmsg := extendRoamMessage(sw, fence,
+				nmsg := extendRoamMessage(sw, fence, details.obj,
 					"nearby", msgs[0], roamNearbys[i])
 				nmsgs = append(nmsgs, string(nmsg))
 			}
 			for i := range roamFaraways {
-				nmsg := extendRoamMessage(sw, fence,
+				nmsg := extendRoamMessage(sw, fence, details.obj,
 					"faraway", msgs[0], roamFaraways[i])
 				nmsgs = append(nmsgs, string(nmsg))
 			}
-			msgs = nmsgs
 		}
+		if len(roamDwells) > 0 {
+			dmsg := makemsg(details.command, group, "dwell", hookName, metas,
+				details.key, details.timestamp, receipt, res[1:])
+			for i := range roamDwells {
+				nmsgs = append(nmsgs, extendRoamMessage(sw, fence,
+					details.obj, "nearby", dmsg, roamDwells[i]))
+			}
+		}
+		msgs = nmsgs
 	}
 	return msgs
 }
 
+// defaultDwell is how long an object must be inside of a fence for a dwell,
+// when DETECT has dwell without a DWELL.
+const defaultDwell = time.Minute
+
+// dwellTime returns how long an object must stay inside of a fence for a
+// dwell to be detected, or zero when dwells are not detected.
+func (fence *liveFenceSwitches) dwellTime() time.Duration {
+	if fence.nodwell {
+		return 0
+	}
+	if fence.detect != nil && !fence.detect["dwell"] {
+		return 0
+	}
+	if fence.dwell > 0 {
+		return fence.dwell
+	}
+	if fence.detect["dwell"] {
+		return defaultDwell
+	}
+	return 0
+}
+
 func extendRoamMessage(
-	sw *scanWriter, fence *liveFenceSwitches,
+	sw *scanWriter, fence *liveFenceSwitches, obj *object.Object,
 	kind string, baseMsg string, match roamMatch,
 ) string {
 	// hack off the last '}'
 	nmsg := []byte(baseMsg[:len(baseMsg)-1])
 	nmsg = append(nmsg, `,"`+kind+`":{"key":`...)
 	nmsg = appendJSONString(nmsg, fence.roam.key)
-	nmsg = append(nmsg, `,"id":`...)
-	nmsg = appendJSONString(nmsg, match.id)
+	nmsg = append(nmsg, ',')
+	nmsg = appendJSONID(nmsg, match.id)
 	nmsg = append(nmsg, `,"object":`...)
 	nmsg = match.obj.AppendJSON(nmsg)
 	nmsg = append(nmsg, `,"meters":`...)
 	nmsg = strconv.AppendFloat(nmsg,
 		math.Floor(match.meters*1000)/1000, 'f', -1, 64)
+	if fence.distance && obj != nil {
+		// the separation of the pair, using the METRIC of the fence
+		nmsg = append(nmsg, `,"distance":`...)
+		nmsg = strconv.AppendFloat(nmsg,
+			objectDistance(fence.metric, obj.Geo(), match.obj), 'f', -1, 64)
+	}
 	if fence.roam.scan != "" {
 		nmsg = append(nmsg, `,"scan":[`...)
 		col, _ := sw.s.cols.Get(fence.roam.key)
 		if col != nil {
 			o := col.Get(match.id)
 			if o != nil {
-				nmsg = append(nmsg, `{"id":`...)
-				nmsg = appendJSONString(nmsg, match.id)
+				nmsg = append(nmsg, '{')
+				nmsg = appendJSONID(nmsg, match.id)
 				nmsg = append(nmsg, `,"self":true,"object":`...)
 				nmsg = o.Geo().AppendJSON(nmsg)
 				nmsg = append(nmsg, '}')
@@ -302,8 +398,8 @@ func extendRoamMessage(
 					return true
 				}
 				if matched, _ := glob.Match(pattern, o.ID()); matched {
-					nmsg = append(nmsg, `,{"id":`...)
-					nmsg = appendJSONString(nmsg, o.ID())
+					nmsg = append(nmsg, ",{"...)
+					nmsg = appendJSONID(nmsg, o.ID())
 					nmsg = append(nmsg, `,"object":`...)
 					nmsg = o.Geo().AppendJSON(nmsg)
 					nmsg = append(nmsg, '}')
@@ -328,9 +424,22 @@ func extendRoamMessage(
 	return string(nmsg)
 }
 
+// appendReceipt appends the time that the server received the triggering
+// command, in unix nanoseconds, and the sequence of its write. Nothing is
+// appended unless notify-sequence is enabled.
+func appendReceipt(b []byte, s *Server, details *commandDetails) []byte {
+	if s == nil || !s.config.notifySequence() {
+		return b
+	}
+	b = append(b, `,"received":`...)
+	b = strconv.AppendInt(b, details.timestamp.UnixNano(), 10)
+	b = append(b, `,"seq":`...)
+	return strconv.AppendUint(b, details.seq, 10)
+}
+
 func makemsg(
 	command, group, detect, hookName string,
-	metas []FenceMeta, key string, t time.Time, tail string,
+	metas []FenceMeta, key string, t time.Time, receipt, tail string,
 ) string {
 	var buf []byte
 	buf = append(append(buf, `{"command":"`...), command...)
@@ -340,6 +449,7 @@ func makemsg(
 	buf = appendHookDetails(buf, hookName, metas)
 	buf = appendJSONString(append(buf, `,"key":`...), key)
 	buf = appendJSONTimeFormat(append(buf, `,"time":`...), t)
+	buf = append(buf, receipt...)
 	buf = append(append(buf, ','), tail...)
 	return string(buf)
 }
@@ -364,6 +474,19 @@ func fenceMatchObject(fence *liveFenceSwitches, o *object.Object) bool {
 	return false
 }
 
+// fenceArmed returns true when the fence is armed. A fence with an ARM object
+// is only armed while that object is inside of the fence.
+func fenceArmed(s *Server, fence *liveFenceSwitches) bool {
+	if fence.armkey == "" {
+		return true
+	}
+	col, _ := s.cols.Get(fence.armkey)
+	if col == nil {
+		return false
+	}
+	return fenceMatchObject(fence, col.Get(fence.armid))
+}
+
 func fenceMatchNearbys(
 	s *Server, fence *liveFenceSwitches,
 	obj *object.Object,
@@ -388,7 +511,7 @@ func fenceMatchNearbys(
 			if o.ID() == obj.ID() {
 				return true // skip self
 			}
-			meters := o.Geo().Distance(o.Geo())
+			meters := obj.Geo().Distance(o.Geo())
 			if meters > fence.roam.meters {
 				return true // skip outside radius
 			}
@@ -403,7 +526,7 @@ func fenceMatchNearbys(
 			match := roamMatch{
 				id:     o.ID(),
 				obj:    o.Geo(),
-				meters: obj.Geo().Distance(o.Geo()),
+				meters: meters,
 			}
 			nearbys = append(nearbys, match)
 			return true
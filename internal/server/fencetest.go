@@ -0,0 +1,132 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/field"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+// FENCETEST key id FROM area TO area
+func (s *Server) cmdFENCETEST(msg *Message) (resp.Value, error) {
+	start := time.Now()
+
+	// >> Args
+
+	vs := msg.Args[1:]
+	var key, id, tok string
+	var ok bool
+	var err error
+	if vs, key, ok = tokenval(vs); !ok || key == "" {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	if vs, id, ok = tokenval(vs); !ok || id == "" {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	var from, to geojson.Object
+	if vs, tok, ok = tokenval(vs); !ok || tok == "" {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	if strings.ToLower(tok) != "from" {
+		return retrerr(errInvalidArgument(tok))
+	}
+	if vs, from, err = s.parseArea(vs, false); err != nil {
+		return retrerr(err)
+	}
+	if vs, tok, ok = tokenval(vs); !ok || tok == "" {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	if strings.ToLower(tok) != "to" {
+		return retrerr(errInvalidArgument(tok))
+	}
+	if vs, to, err = s.parseArea(vs, false); err != nil {
+		return retrerr(err)
+	}
+	if len(vs) != 0 {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+
+	// >> Operation
+
+	// The hypothetical move keeps the fields of the existing object.
+	var fields field.List
+	if col, _ := s.cols.Get(key); col != nil {
+		if o := col.Get(id); o != nil {
+			fields = o.Fields()
+		}
+	}
+	d := &commandDetails{
+		command:   "set",
+		key:       key,
+		old:       object.New(id, from, 0, fields),
+		obj:       object.New(id, to, 0, fields),
+		updated:   true,
+		timestamp: time.Now(),
+	}
+	var msgs []string
+	for _, hook := range s.getQueueCandidates(d) {
+		if hook.Fence.population > 0 {
+			continue
+		}
+		cmsg := *hook.Message
+		sw, err := s.newFenceTestWriter(&cmsg, hook.Fence)
+		if err != nil {
+			return retrerr(err)
+		}
+		msgs = append(msgs, hookMatch(hook, sw, d)...)
+	}
+	var fences []*liveFenceSwitches
+	s.lcond.L.Lock()
+	for lb := range s.lives {
+		if lb.key == key {
+			fences = append(fences, lb.fence)
+		}
+	}
+	s.lcond.L.Unlock()
+	for _, fence := range fences {
+		sw, err := s.newFenceTestWriter(&Message{}, fence)
+		if err != nil {
+			return retrerr(err)
+		}
+		msgs = append(msgs, FenceMatch("", sw, fence, nil, d)...)
+	}
+	s.sortHookMsgs(msgs)
+
+	// >> Response
+
+	switch msg.OutputType {
+	case JSON:
+		var buf bytes.Buffer
+		buf.WriteString(`{"ok":true,"notifications":[`)
+		buf.WriteString(strings.Join(msgs, ","))
+		buf.WriteString(`],"elapsed":"` + time.Since(start).String() + "\"}")
+		return resp.StringValue(buf.String()), nil
+	case RESP:
+		vals := make([]resp.Value, len(msgs))
+		for i, msg := range msgs {
+			vals[i] = resp.StringValue(msg)
+		}
+		return resp.ArrayValue(vals), nil
+	}
+	return NOMessage, nil
+}
+
+// newFenceTestWriter returns a scan writer for evaluating a fence without
+// connecting any groups.
+func (s *Server) newFenceTestWriter(msg *Message, fence *liveFenceSwitches,
+) (*scanWriter, error) {
+	var wr bytes.Buffer
+	sw, err := s.newScanWriter(
+		&wr, msg, fence.key, fence.output, fence.precision, fence.globs, false,
+		fence.cursor, fence.limit, fence.wheres, fence.whereins,
+		fence.whereevals, fence.nofields)
+	if err != nil {
+		return nil, err
+	}
+	sw.dryRun = true
+	return sw, nil
+}
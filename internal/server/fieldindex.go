@@ -0,0 +1,240 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/collection"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+// indexedFieldName returns true when a field may be indexed. The values of
+// the reserved fields and the properties of features don't come from the
+// fields of an object.
+func indexedFieldName(name string) bool {
+	return name != "" && !isReservedFieldName(name) &&
+		!isPathKey(name, "properties")
+}
+
+// newCollection returns a new empty collection for the provided key, with
+// the indexes of the key.
+func (s *Server) newCollection(key string) *collection.Collection {
+	col := collection.New()
+	s.addFieldIndexes(key, col)
+	return col
+}
+
+// addFieldIndexes adds the indexes of a key to a new collection.
+func (s *Server) addFieldIndexes(key string, col *collection.Collection) {
+	for name := range s.indexes[key] {
+		col.AddIndex(name)
+	}
+}
+
+// indexSelectivity is how much of a key a WHERE on an indexed field may
+// match for a search to scan the index, instead of the spatial index. A
+// search that scans the index tests the geometry of each object in range.
+const indexSelectivity = 8
+
+// whereIndexRange returns the range of values that a WHERE matches, or false
+// when it's not a comparison that an index can be used for.
+func whereIndexRange(where whereT) (collection.IndexRange, bool) {
+	var r collection.IndexRange
+	if where.expr || where.json {
+		return r, false
+	}
+	switch where.min.Data() {
+	case "==":
+		r.Min, r.Max = &where.max, &where.max
+	case "<", "<=":
+		r.Max, r.MaxExclusive = &where.max, where.min.Data() == "<"
+	case ">", ">=":
+		r.Min, r.MinExclusive = &where.max, where.min.Data() == ">"
+	case "!=":
+		return r, false
+	default:
+		r.Min, r.MinExclusive = &where.min, where.minx
+		r.Max, r.MaxExclusive = &where.max, where.maxx
+	}
+	return r, true
+}
+
+// indexedWhere returns the field and range of the first WHERE of a scan or
+// search that can use a field index, or false when there's none.
+func (sw *scanWriter) indexedWhere() (string, collection.IndexRange, bool) {
+	if sw.col == nil {
+		return "", collection.IndexRange{}, false
+	}
+	for _, where := range sw.wheres {
+		if !sw.col.HasIndex(where.name) {
+			continue
+		}
+		if r, ok := whereIndexRange(where); ok {
+			return where.name, r, true
+		}
+	}
+	return "", collection.IndexRange{}, false
+}
+
+// searchIndex searches the objects of a key that are within or intersect an
+// area through a field index. That's done when a WHERE on an indexed field
+// matches few enough of the objects, and their geometries are tested instead
+// of searching the spatial index. Returns false when nothing was searched.
+func (sw *scanWriter) searchIndex(cmd string, area geojson.Object,
+	msg *Message, iter func(o *object.Object) bool,
+) bool {
+	name, r, ok := sw.indexedWhere()
+	if !ok {
+		return false
+	}
+	limit := sw.col.Count()/indexSelectivity + 1
+	if sw.col.IndexCount(name, r, limit) >= limit {
+		return false
+	}
+	sw.col.ScanIndex(name, r, false, sw, msg.Deadline,
+		func(o *object.Object) bool {
+			g := o.Geo()
+			if g.Empty() {
+				return true
+			}
+			switch cmd {
+			case "within":
+				if !g.Within(area) {
+					return true
+				}
+			case "intersects":
+				if !g.Intersects(area) {
+					return true
+				}
+			}
+			return iter(o)
+		},
+	)
+	return true
+}
+
+// SETINDEX key field
+func (s *Server) cmdSETINDEX(msg *Message) (resp.Value, commandDetails, error) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 3 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	key, name := args[1], args[2]
+	if !indexedFieldName(name) {
+		return retwerr(errInvalidArgument(name))
+	}
+
+	// >> Operation
+
+	var d commandDetails
+	if !s.indexes[key][name] {
+		if s.indexes[key] == nil {
+			s.indexes[key] = make(map[string]bool)
+		}
+		s.indexes[key][name] = true
+		// the objects that are already in the key are indexed too
+		if col, _ := s.cols.Get(key); col != nil {
+			col.AddIndex(name)
+		}
+		d.updated = true
+	}
+	d.timestamp = time.Now()
+
+	// >> Response
+
+	return OKMessage(msg, start), d, nil
+}
+
+// DELINDEX key field
+func (s *Server) cmdDELINDEX(msg *Message) (resp.Value, commandDetails, error) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 3 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	key, name := args[1], args[2]
+
+	// >> Operation
+
+	var d commandDetails
+	if s.indexes[key][name] {
+		delete(s.indexes[key], name)
+		if len(s.indexes[key]) == 0 {
+			delete(s.indexes, key)
+		}
+		if col, _ := s.cols.Get(key); col != nil {
+			col.DeleteIndex(name)
+		}
+		d.updated = true
+	}
+	d.timestamp = time.Now()
+
+	// >> Response
+
+	var res resp.Value
+	switch msg.OutputType {
+	case JSON:
+		res = OKMessage(msg, start)
+	case RESP:
+		if d.updated {
+			res = resp.IntegerValue(1)
+		} else {
+			res = resp.IntegerValue(0)
+		}
+	}
+	return res, d, nil
+}
+
+// INDEXES key
+func (s *Server) cmdINDEXES(msg *Message) (resp.Value, error) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 2 {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	key := args[1]
+
+	// >> Operation
+
+	names := make([]string, 0, len(s.indexes[key]))
+	for name := range s.indexes[key] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// >> Response
+
+	switch msg.OutputType {
+	case JSON:
+		var buf strings.Builder
+		buf.WriteString(`{"ok":true,"indexes":[`)
+		for i, name := range names {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(jsonString(name))
+		}
+		buf.WriteString(`],"elapsed":"` + time.Since(start).String() + `"}`)
+		return resp.StringValue(buf.String()), nil
+	case RESP:
+		vals := make([]resp.Value, len(names))
+		for i, name := range names {
+			vals[i] = resp.StringValue(name)
+		}
+		return resp.ArrayValue(vals), nil
+	}
+	return NOMessage, nil
+}
@@ -1,9 +1,13 @@
 package server
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -13,9 +17,29 @@ import (
 )
 
 var errNoLongerFollowing = errors.New("no longer following")
+var errLeaderTimeout = errors.New("timed out waiting for the leader")
+var errLeaderIDChanged = errors.New("leader id changed")
 
 const checksumsz = 512 * 1024
 
+// followNoOneMessage is the response to FOLLOW NO ONE. The updated field
+// tells whether the server was following a leader before the command.
+func followNoOneMessage(msg *Message, start time.Time, updated bool) resp.Value {
+	switch msg.OutputType {
+	case JSON:
+		return resp.StringValue(`{"ok":true,"updated":` +
+			strconv.FormatBool(updated) + `,"elapsed":"` +
+			time.Since(start).String() + "\"}")
+	case RESP:
+		if !updated {
+			return resp.SimpleStringValue("OK Already following no one")
+		}
+		return resp.SimpleStringValue("OK")
+	}
+	return NOMessage
+}
+
+// FOLLOW host port [PREFIX prefix [host port PREFIX prefix ...]] [TLS]
 func (s *Server) cmdFollow(msg *Message) (res resp.Value, err error) {
 	start := time.Now()
 	vs := msg.Args[1:]
@@ -28,69 +52,107 @@ func (s *Server) cmdFollow(msg *Message) (res resp.Value, err error) {
 	if vs, sport, ok = tokenval(vs); !ok || sport == "" {
 		return NOMessage, errInvalidNumberOfArguments
 	}
-	if len(vs) != 0 {
-		return NOMessage, errInvalidNumberOfArguments
-	}
 	host = strings.ToLower(host)
 	sport = strings.ToLower(sport)
-	var update bool
 	if host == "no" && sport == "one" {
-		update = s.config.followHost() != "" || s.config.followPort() != 0
+		if len(vs) != 0 {
+			return NOMessage, errInvalidArgument(vs[0])
+		}
+		update := s.config.followHost() != "" || s.config.followPort() != 0
 		s.config.setFollowHost("")
 		s.config.setFollowPort(0)
-	} else {
-		n, err := strconv.ParseUint(sport, 10, 64)
-		if err != nil {
-			return NOMessage, errInvalidArgument(sport)
-		}
-		port := int(n)
-		update = s.config.followHost() != host || s.config.followPort() != port
-		auth := s.config.leaderAuth()
+		s.config.setFollowUpstreams(nil)
+		s.config.setFollowTLS(false)
+		s.config.setFollowID("")
+		s.config.write(false)
 		if update {
-			s.mu.Unlock()
-			conn, err := DialTimeout(fmt.Sprintf("%s:%d", host, port), time.Second*2)
-			if err != nil {
-				s.mu.Lock()
-				return NOMessage, fmt.Errorf("cannot follow: %v", err)
+			s.followc.Add(1)
+			s.fups = nil
+			log.Infof("following no one")
+		}
+		return followNoOneMessage(msg, start, update), nil
+	}
+	port, err := strconv.ParseUint(sport, 10, 64)
+	if err != nil {
+		return NOMessage, errInvalidArgument(sport)
+	}
+	ups := []followUpstream{{Host: host, Port: int(port)}}
+	var useTLS bool
+	for len(vs) > 0 {
+		switch strings.ToLower(vs[0]) {
+		case "tls":
+			useTLS = true
+			vs = vs[1:]
+		case "prefix":
+			if len(vs) < 2 || vs[1] == "" {
+				return NOMessage, errInvalidNumberOfArguments
 			}
-			defer conn.Close()
-			if auth != "" {
-				if err := s.followDoLeaderAuth(conn, auth); err != nil {
-					return NOMessage, fmt.Errorf("cannot follow: %v", err)
-				}
+			if ups[len(ups)-1].Prefix != "" {
+				return NOMessage, errDuplicateArgument(strings.ToUpper(vs[0]))
 			}
-			m, err := doServer(conn)
-			if err != nil {
-				s.mu.Lock()
-				return NOMessage, fmt.Errorf("cannot follow: %v", err)
+			ups[len(ups)-1].Prefix = vs[1]
+			vs = vs[2:]
+		default:
+			// another leader, which may only follow a leader with a prefix
+			if ups[len(ups)-1].Prefix == "" {
+				return NOMessage, errInvalidArgument(vs[0])
 			}
-			if m["id"] == "" {
-				s.mu.Lock()
-				return NOMessage, fmt.Errorf("cannot follow: invalid id")
+			if len(vs) < 2 {
+				return NOMessage, errInvalidNumberOfArguments
 			}
-			if m["id"] == s.config.serverID() {
-				s.mu.Lock()
-				return NOMessage, fmt.Errorf("cannot follow self")
+			port, err := strconv.ParseUint(vs[1], 10, 64)
+			if err != nil {
+				return NOMessage, errInvalidArgument(vs[1])
 			}
-			if m["following"] != "" {
+			ups = append(ups, followUpstream{
+				Host: strings.ToLower(vs[0]), Port: int(port),
+			})
+			vs = vs[2:]
+		}
+	}
+	if len(ups) > 1 && ups[len(ups)-1].Prefix == "" {
+		return NOMessage, errors.New(
+			"PREFIX is required for each leader when following more than one")
+	}
+	if ups[0].Prefix == "" {
+		// a single leader without a prefix is followed as a whole
+		ups = nil
+	}
+	update := s.config.followHost() != host ||
+		s.config.followPort() != int(port) ||
+		!sameUpstreams(s.config.followUpstreams(), ups) ||
+		s.config.followTLS() != useTLS
+	auth := s.config.leaderAuth()
+	if update {
+		addrs := []string{fmt.Sprintf("%s:%d", host, port)}
+		for i := 1; i < len(ups); i++ {
+			addrs = append(addrs, fmt.Sprintf("%s:%d", ups[i].Host, ups[i].Port))
+		}
+		s.mu.Unlock()
+		for _, addr := range addrs {
+			conn, _, err := s.leaderConn(addr,
+				useTLS || s.config.leaderTLS(), auth)
+			if err != nil {
 				s.mu.Lock()
-				return NOMessage, fmt.Errorf("cannot follow a follower")
+				return NOMessage, err
 			}
-			s.mu.Lock()
+			conn.Close()
 		}
-		s.config.setFollowHost(host)
-		s.config.setFollowPort(port)
+		s.mu.Lock()
+	}
+	s.config.setFollowHost(host)
+	s.config.setFollowPort(int(port))
+	s.config.setFollowUpstreams(ups)
+	if update {
+		s.config.setFollowID("")
 	}
+	s.config.setFollowTLS(useTLS)
 	s.config.write(false)
 	if update {
 		s.followc.Add(1)
-		if s.config.followHost() != "" {
-			log.Infof("following new host '%s' '%s'.", host, sport)
-			go s.follow(s.config.followHost(), s.config.followPort(),
-				int(s.followc.Load()))
-		} else {
-			log.Infof("following no one")
-		}
+		s.fups = nil
+		log.Infof("following new host '%s' '%s'.", host, sport)
+		go s.followAll(int(s.followc.Load()))
 	}
 	return OKMessage(msg, start), nil
 }
@@ -142,6 +204,22 @@ func (s *Server) cmdReplConf(msg *Message, client *Client) (res resp.Value, err
 				return OKMessage(msg, start), nil
 			}
 		}
+	case "compress":
+		// Compress the aof stream that is sent to the follower
+		val = strings.ToLower(val)
+		if !validReplCompression(val) {
+			return NOMessage, errUnsupportedCompression
+		}
+		s.connsmu.RLock()
+		defer s.connsmu.RUnlock()
+		for _, c := range s.conns {
+			if c.remoteAddr == client.remoteAddr {
+				c.mu.Lock()
+				c.replCodec = val
+				c.mu.Unlock()
+				return OKMessage(msg, start), nil
+			}
+		}
 	}
 	return NOMessage, fmt.Errorf("cannot find follower")
 }
@@ -169,7 +247,23 @@ func (s *Server) followHandleCommand(args []string, followc int, w io.Writer) (i
 		return s.aofsz, errNoLongerFollowing
 	}
 	msg := &Message{Args: args}
+	if msg.Command() == "ping" {
+		// A heartbeat from the leader, which isn't part of the aof
+		return s.aofsz, nil
+	}
+	if s.frelaypub && msg.Command() == "publish" {
+		// The leader relays PUBLISH through the follow stream when
+		// replicate-publish is on. The messages are written to the AOF so
+		// that it stays identical to the leader's, but only go out to the
+		// subscribers once caught up.
+		if s.fcup && len(args) == 3 {
+			s.publishLocal(args[1], args[2])
+		}
+		return s.aofsz, s.writeAOF(args, nil)
+	}
+	s.freplay = true
 	_, d, err := s.command(msg, nil)
+	s.freplay = false
 	if err != nil {
 		if commandErrIsFatal(err) {
 			return s.aofsz, err
@@ -189,98 +283,267 @@ func (s *Server) followHandleCommand(args []string, followc int, w io.Writer) (i
 	return s.aofsz, nil
 }
 
+// followUseTLS returns true when the leader is followed over tls, which is
+// when FOLLOW asked for TLS or when leader-tls is set.
+func (s *Server) followUseTLS() bool {
+	return s.config.followTLS() || s.config.leaderTLS()
+}
+
+// loadCertPool reads the PEM certificates of a file into a pool.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in '%s'", path)
+	}
+	return pool, nil
+}
+
+// dialLeader connects to the leader. Over tls, the certificate of the leader
+// is verified with the leader-ca-cert, or with the system roots when none is
+// set.
+func (s *Server) dialLeader(addr string, useTLS bool) (*RESPConn, error) {
+	if !useTLS {
+		return DialTimeout(addr, time.Second*2)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{ServerName: host}
+	if path := s.config.leaderCACert(); path != "" {
+		if config.RootCAs, err = loadCertPool(path); err != nil {
+			return nil, err
+		}
+	}
+	return DialTLSTimeout(addr, time.Second*2, config)
+}
+
 func (s *Server) followDoLeaderAuth(conn *RESPConn, auth string) error {
 	v, err := conn.Do("auth", auth)
 	if err != nil {
 		return err
 	}
-	if v.Error() != nil {
-		return v.Error()
-	}
-	if v.String() != "OK" {
-		return errors.New("cannot follow: auth no ok")
+	if v.Error() != nil || v.String() != "OK" {
+		// the password was wrong, or the replication token was revoked
+		return errors.New("auth no ok")
 	}
 	return nil
 }
 
-func (s *Server) followStep(host string, port int, followc int) error {
-	if int(s.followc.Load()) != followc {
-		return errNoLongerFollowing
+// replLagProbeInterval is how often a follower asks its leader for the size
+// of the leader's aof, which the replication lag is measured against.
+const replLagProbeInterval = time.Second
+
+// probeLeaderSize asks the leader for the size of its aof every
+// replLagProbeInterval, over a connection of its own, and passes the size to
+// update until done is closed. The aof stream can't carry the size, because
+// a leader that waits on a slow follower doesn't send it heartbeats.
+func (s *Server) probeLeaderSize(addr, auth string, done <-chan struct{},
+	update func(size int64),
+) {
+	var conn *RESPConn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	tick := time.NewTicker(replLagProbeInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-tick.C:
+		}
+		if conn == nil {
+			c, err := s.dialLeader(addr, s.followUseTLS())
+			if err != nil {
+				continue
+			}
+			if auth != "" {
+				if err := s.followDoLeaderAuth(c, auth); err != nil {
+					c.Close()
+					continue
+				}
+			}
+			conn = c
+		}
+		conn.conn.SetDeadline(time.Now().Add(replLagProbeInterval * 2))
+		m, err := doServer(conn)
+		if err != nil {
+			conn.Close()
+			conn = nil
+			continue
+		}
+		if size, err := strconv.ParseInt(m["aof_size"], 10, 64); err == nil {
+			update(size)
+		}
 	}
-	s.mu.Lock()
-	s.faofsz = 0
-	s.fcup = false
-	auth := s.config.leaderAuth()
-	s.mu.Unlock()
-	addr := fmt.Sprintf("%s:%d", host, port)
+}
 
-	// check if we are following self
-	conn, err := DialTimeout(addr, time.Second*2)
+// leaderConn connects to a leader, and checks that it can be followed.
+func (s *Server) leaderConn(addr string, useTLS bool, auth string,
+) (*RESPConn, map[string]string, error) {
+	conn, err := s.dialLeader(addr, useTLS)
 	if err != nil {
-		return fmt.Errorf("cannot follow: %v", err)
+		return nil, nil, fmt.Errorf("cannot follow: %v", err)
 	}
-	defer conn.Close()
 	if auth != "" {
 		if err := s.followDoLeaderAuth(conn, auth); err != nil {
-			return fmt.Errorf("cannot follow: %v", err)
+			conn.Close()
+			return nil, nil, fmt.Errorf("cannot follow: %v", err)
 		}
 	}
 	m, err := doServer(conn)
 	if err != nil {
-		return fmt.Errorf("cannot follow: %v", err)
-	}
-
-	if m["id"] == "" {
-		return fmt.Errorf("cannot follow: invalid id")
+		err = fmt.Errorf("cannot follow: %v", err)
+	} else if m["id"] == "" {
+		err = errors.New("cannot follow: invalid id")
+	} else if m["id"] == s.config.serverID() {
+		err = errors.New("cannot follow self")
+	} else if m["following"] != "" {
+		err = errors.New("cannot follow a follower")
 	}
-	if m["id"] == s.config.serverID() {
-		return fmt.Errorf("cannot follow self")
-	}
-	if m["following"] != "" {
-		return fmt.Errorf("cannot follow a follower")
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
 	}
+	return conn, m, nil
+}
 
-	// verify checksum
-	pos, err := s.followCheckSome(addr, followc, auth)
-	if err != nil {
-		return err
+// followCheckLeaderID compares the id of the leader with the id that it had
+// when the follower started following it. A changed id means that the leader
+// was replaced, for example by a restore from a backup, and that the aof of
+// the follower may not be a prefix of the aof of the leader anymore. The
+// leader-id-change config chooses to stop following, or to read the whole aof
+// of the new leader again.
+func (s *Server) followCheckLeaderID(addr, id string, followc int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if int(s.followc.Load()) != followc {
+		return errNoLongerFollowing
 	}
+	prev := s.config.followID()
+	if prev == id {
+		return nil
+	}
+	if prev != "" {
+		log.Warnf("LEADER ID CHANGED: the leader %s had the id '%s' and now "+
+			"has the id '%s'", addr, prev, id)
+		if s.config.leaderIDChange() != "resync" {
+			log.Errorf("stopped following %s, use RESYNC CONFIRM to follow "+
+				"the new leader", addr)
+			return errLeaderIDChanged
+		}
+		log.Warnf("resyncing from the new leader %s", addr)
+		if err := s.discardFollowData(); err != nil {
+			return err
+		}
+	}
+	s.config.setFollowID(id)
+	s.config.write(false)
+	return nil
+}
 
-	// Send the replication port to the leader
+// followReplConf sends the replication address of the follower to the
+// leader, and asks for the aof stream to be compressed when leader-compress
+// is set. Returns the compression that the leader agreed to, which is empty
+// when the leader can't compress the stream.
+func (s *Server) followReplConf(conn *RESPConn) (string, error) {
 	p := s.config.announcePort()
 	if p == 0 {
 		p = s.port
 	}
 	v, err := conn.Do("replconf", "listening-port", p)
 	if err != nil {
-		return err
+		return "", err
 	}
 	if v.Error() != nil {
-		return v.Error()
+		return "", v.Error()
 	}
 	if v.String() != "OK" {
-		return errors.New("invalid response to replconf request")
+		return "", errors.New("invalid response to replconf request")
 	}
-
-	// Send the replication ip to the leader
 	ip := s.config.announceIP()
 	if ip != "" {
 		v, err := conn.Do("replconf", "ip-address", ip)
 		if err != nil {
-			return err
+			return "", err
 		}
 		if v.Error() != nil {
-			return v.Error()
+			return "", v.Error()
 		}
 		if v.String() != "OK" {
-			return errors.New("invalid response to replconf request")
+			return "", errors.New("invalid response to replconf request")
 		}
 	}
+	codec := s.config.leaderCompress()
+	if codec == "" {
+		return "", nil
+	}
+	v, err = conn.Do("replconf", "compress", codec)
+	if err != nil {
+		return "", err
+	}
+	if v.Error() != nil || v.String() != "OK" {
+		log.Warnf("follow: leader can't use %s compression, "+
+			"the aof stream is not compressed", codec)
+		return "", nil
+	}
+	return codec, nil
+}
+
+func (s *Server) followStep(host string, port int, followc int) error {
+	if int(s.followc.Load()) != followc {
+		return errNoLongerFollowing
+	}
+	s.mu.Lock()
+	s.faofsz = 0
+	s.fleadsz = 0
+	s.fcup = false
+	auth := s.config.leaderAuth()
+	s.mu.Unlock()
+	addr := fmt.Sprintf("%s:%d", host, port)
+
+	// check if we are following self
+	conn, m, err := s.leaderConn(addr, s.followUseTLS(), auth)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// check if the leader is the one that we started following
+	if err := s.followCheckLeaderID(addr, m["id"], followc); err != nil {
+		return err
+	}
+
+	// check if the leader relays PUBLISH through the follow stream
+	relaypub := false
+	if v, err := conn.Do("config", "get", ReplPublish); err == nil &&
+		v.Error() == nil {
+		arr := v.Array()
+		relaypub = len(arr) == 2 && arr[1].String() == "yes"
+	}
+
+	// verify checksum
+	pos, err := s.followCheckSome(addr, followc, auth)
+	if err != nil {
+		return err
+	}
+
+	codec, err := s.followReplConf(conn)
+	if err != nil {
+		return err
+	}
 	if s.opts.ShowDebugMessages {
 		log.Debug("follow:", addr, ":replconf")
 	}
 
-	v, err = conn.Do("aof", pos)
+	v, err := conn.Do("aof", pos)
 	if err != nil {
 		return err
 	}
@@ -290,6 +553,11 @@ func (s *Server) followStep(host string, port int, followc int) error {
 	if v.String() != "OK" {
 		return errors.New("invalid response to aof live request")
 	}
+	if codec != "" {
+		if err := conn.decompress(codec); err != nil {
+			return err
+		}
+	}
 	if s.opts.ShowDebugMessages {
 		log.Debug("follow:", addr, ":read aof")
 	}
@@ -300,7 +568,9 @@ func (s *Server) followStep(host string, port int, followc int) error {
 	}
 
 	s.mu.Lock()
-	s.faofsz = int(aofSize)
+	s.faofsz = int(pos)
+	s.fleadsz = int(aofSize)
+	s.frelaypub = relaypub
 	s.mu.Unlock()
 
 	caughtUp := pos >= aofSize
@@ -312,27 +582,31 @@ func (s *Server) followStep(host string, port int, followc int) error {
 		log.Info("caught up")
 	}
 
-	nullw := io.Discard
-	for {
-		v, telnet, _, err := conn.rd.ReadMultiBulk()
-		if err != nil {
-			return err
-		}
-		vals := v.Array()
-		if telnet || v.Type() != resp.Array {
-			return errors.New("invalid multibulk")
-		}
-		svals := make([]string, len(vals))
-		for i := 0; i < len(vals); i++ {
-			svals[i] = vals[i].String()
+	done := make(chan struct{})
+	defer close(done)
+	go s.probeLeaderSize(addr, auth, done, func(size int64) {
+		s.mu.Lock()
+		if int(s.followc.Load()) == followc && int(size) > s.fleadsz {
+			s.fleadsz = int(size)
 		}
+		s.mu.Unlock()
+	})
 
+	nullw := io.Discard
+	return s.applyLeaderStream(conn, func(svals []string) error {
 		aofsz, err := s.followHandleCommand(svals, followc, nullw)
 		if err != nil {
 			return err
 		}
 		s.mu.Lock()
-		s.faofsz = aofsz
+		if strings.ToLower(svals[0]) != "ping" {
+			// a heartbeat isn't part of the leader's aof
+			s.faofsz += int(multiBulkSize(svals))
+		}
+		if s.faofsz > s.fleadsz {
+			// the leader's aof is at least as large as what was read of it
+			s.fleadsz = s.faofsz
+		}
 		s.mu.Unlock()
 		if !caughtUp {
 			if aofsz >= int(aofSize) {
@@ -345,19 +619,51 @@ func (s *Server) followStep(host string, port int, followc int) error {
 				log.Info("caught up")
 			}
 		}
+		return nil
+	})
+}
 
+// readLeaderCommand reads the next command of the aof stream from a leader.
+// A leader that sends nothing, not even a heartbeat, for the leader-timeout
+// is taken to be gone, so that the follower can reconnect.
+func (s *Server) readLeaderCommand(conn *RESPConn) ([]string, error) {
+	if timeout := s.config.leaderTimeout(); timeout > 0 {
+		conn.conn.SetReadDeadline(time.Now().Add(timeout))
+	} else {
+		conn.conn.SetReadDeadline(time.Time{})
 	}
+	v, telnet, _, err := conn.rd.ReadMultiBulk()
+	if err != nil {
+		var nerr net.Error
+		if errors.As(err, &nerr) && nerr.Timeout() {
+			return nil, errLeaderTimeout
+		}
+		return nil, err
+	}
+	vals := v.Array()
+	if telnet || v.Type() != resp.Array || len(vals) == 0 {
+		return nil, errors.New("invalid multibulk")
+	}
+	args := make([]string, len(vals))
+	for i := 0; i < len(vals); i++ {
+		args[i] = vals[i].String()
+	}
+	return args, nil
 }
 
 func (s *Server) follow(host string, port int, followc int) {
 	for {
 		err := s.followStep(host, port, followc)
-		if err == errNoLongerFollowing {
+		if err == errNoLongerFollowing || err == errLeaderIDChanged {
 			return
 		}
 		if err != nil && err != io.EOF {
 			log.Error("follow: " + err.Error())
 		}
+		// not caught up while the leader is gone
+		s.mu.Lock()
+		s.fcup = false
+		s.mu.Unlock()
 		time.Sleep(time.Second)
 	}
 }
@@ -0,0 +1,104 @@
+package server
+
+import "sync"
+
+// followApply is the buffer of commands that were read from the aof stream of
+// a leader, but are not applied yet.
+type followApply struct {
+	mu      sync.Mutex
+	cond    sync.Cond
+	cmds    [][]string
+	pending int64 // size of the commands in the buffer
+	closed  bool  // no more commands will be added
+	err     error // the error that stopped applying
+}
+
+// applyLeaderStream reads the commands of the aof stream of a leader and
+// applies them in the background. Reading pauses while the commands that are
+// waiting to be applied reach the follower-apply-buffer, which slows down the
+// leader through tcp backpressure instead of buffering without a bound when
+// the follower can't keep up. All of the commands that were read are applied
+// before it returns.
+func (s *Server) applyLeaderStream(conn *RESPConn,
+	apply func(args []string) error,
+) error {
+	fa := &followApply{}
+	fa.cond.L = &fa.mu
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.applyFollowCommands(fa, apply)
+	}()
+	var err error
+	for {
+		var args []string
+		args, err = s.readLeaderCommand(conn)
+		if err != nil {
+			break
+		}
+		sz := multiBulkSize(args)
+		max := s.config.followerApplyBuffer()
+		fa.mu.Lock()
+		for fa.err == nil && fa.pending > 0 && fa.pending+sz > max {
+			fa.cond.Wait()
+		}
+		if fa.err != nil {
+			fa.mu.Unlock()
+			break
+		}
+		fa.cmds = append(fa.cmds, args)
+		fa.pending += sz
+		s.fapply.Add(sz)
+		fa.cond.Broadcast()
+		fa.mu.Unlock()
+	}
+	fa.mu.Lock()
+	fa.closed = true
+	fa.cond.Broadcast()
+	fa.mu.Unlock()
+	<-done
+	if fa.err != nil {
+		return fa.err
+	}
+	return err
+}
+
+// applyFollowCommands applies the commands in the buffer, until it's closed
+// and empty, or until a command fails.
+func (s *Server) applyFollowCommands(fa *followApply,
+	apply func(args []string) error,
+) {
+	for {
+		fa.mu.Lock()
+		for len(fa.cmds) == 0 && !fa.closed {
+			fa.cond.Wait()
+		}
+		if len(fa.cmds) == 0 {
+			fa.mu.Unlock()
+			return
+		}
+		args := fa.cmds[0]
+		fa.cmds[0] = nil
+		fa.cmds = fa.cmds[1:]
+		fa.mu.Unlock()
+
+		err := apply(args)
+
+		sz := multiBulkSize(args)
+		fa.mu.Lock()
+		fa.pending -= sz
+		s.fapply.Add(-sz)
+		if err != nil {
+			// drop the rest, they can't be applied in order anymore
+			fa.err = err
+			s.fapply.Add(-fa.pending)
+			fa.cmds = nil
+			fa.pending = 0
+		}
+		fa.cond.Broadcast()
+		fa.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
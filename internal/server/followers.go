@@ -0,0 +1,154 @@
+package server
+
+import (
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/aoffile"
+)
+
+// aofConn is a follower connection that is receiving the live aof.
+type aofConn struct {
+	rd     io.Closer     // reader of the aof
+	aof    *aoffile.File // the aof that is being sent
+	opened time.Time     // when the follower connected
+	sent   atomic.Int64  // aof position that has been sent to the follower
+	online atomic.Bool   // follower has caught up with the aof
+}
+
+// Close closes the aof reader of the follower.
+func (ac *aofConn) Close() error {
+	return ac.rd.Close()
+}
+
+// backlog returns the number of bytes of the aof that have yet to be sent.
+func (ac *aofConn) backlog() int64 {
+	return ac.aof.Size() - ac.sent.Load()
+}
+
+// sentWriter counts the bytes that are written to a follower.
+type sentWriter struct {
+	w    io.Writer
+	sent *atomic.Int64
+}
+
+func (wr *sentWriter) Write(p []byte) (int, error) {
+	n, err := wr.w.Write(p)
+	wr.sent.Add(int64(n))
+	return n, err
+}
+
+type followerInfo struct {
+	addr    string
+	ip      string
+	port    int
+	state   string
+	offset  int64
+	backlog int64
+	age     time.Duration
+}
+
+// followerInfos returns the followers that are connected to the leader,
+// ordered by their connection address.
+func (s *Server) followerInfos() []followerInfo {
+	var infos []followerInfo
+	for conn, ac := range s.aofconnM {
+		info := followerInfo{
+			addr:    conn.RemoteAddr().String(),
+			state:   "sync",
+			offset:  ac.sent.Load(),
+			backlog: ac.backlog(),
+			age:     time.Since(ac.opened),
+		}
+		if ac.online.Load() {
+			info.state = "online"
+		}
+		info.ip, info.port = s.followerReplAddr(conn)
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].addr < infos[j].addr
+	})
+	return infos
+}
+
+// followerReplAddr returns the address that a follower reported with
+// REPLCONF, or the address of its connection when it reported none.
+func (s *Server) followerReplAddr(conn net.Conn) (ip string, port int) {
+	addr := conn.RemoteAddr().String()
+	s.connsmu.RLock()
+	defer s.connsmu.RUnlock()
+	for _, cc := range s.conns {
+		if cc.remoteAddr == addr {
+			cc.mu.Lock()
+			ip, port = replicaIPAndPort(cc)
+			cc.mu.Unlock()
+			return ip, port
+		}
+	}
+	ip, _, _ = net.SplitHostPort(addr)
+	return ip, 0
+}
+
+// FOLLOWERS
+func (s *Server) cmdFOLLOWERS(msg *Message) (resp.Value, error) {
+	start := time.Now()
+
+	// >> Args
+
+	if len(msg.Args) != 1 {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+
+	// >> Operation
+
+	infos := s.followerInfos()
+
+	// >> Response
+
+	switch msg.OutputType {
+	case JSON:
+		var b []byte
+		b = append(b, `{"ok":true,"followers":[`...)
+		for i, info := range infos {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = append(b, `{"addr":`...)
+			b = appendJSONString(b, info.addr)
+			b = append(b, `,"ip":`...)
+			b = appendJSONString(b, info.ip)
+			b = append(b, `,"port":`...)
+			b = strconv.AppendInt(b, int64(info.port), 10)
+			b = append(b, `,"state":"`+info.state+`","offset":`...)
+			b = strconv.AppendInt(b, info.offset, 10)
+			b = append(b, `,"backlog":`...)
+			b = strconv.AppendInt(b, info.backlog, 10)
+			b = append(b, `,"age":`...)
+			b = strconv.AppendFloat(b, info.age.Seconds(), 'f', -1, 64)
+			b = append(b, '}')
+		}
+		b = append(b, `],"elapsed":"`+time.Since(start).String()+`"}`...)
+		return resp.BytesValue(b), nil
+	case RESP:
+		vals := make([]resp.Value, len(infos))
+		for i, info := range infos {
+			vals[i] = resp.ArrayValue([]resp.Value{
+				resp.StringValue("addr"), resp.StringValue(info.addr),
+				resp.StringValue("ip"), resp.StringValue(info.ip),
+				resp.StringValue("port"), resp.IntegerValue(info.port),
+				resp.StringValue("state"), resp.StringValue(info.state),
+				resp.StringValue("offset"), resp.IntegerValue(int(info.offset)),
+				resp.StringValue("backlog"), resp.IntegerValue(int(info.backlog)),
+				resp.StringValue("age"), resp.IntegerValue(int(info.age.Seconds())),
+			})
+		}
+		return resp.ArrayValue(vals), nil
+	}
+	return NOMessage, nil
+}
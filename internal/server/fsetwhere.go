@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/field"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+// FSETWHERE key field value [MATCH pattern] [WHERE ...] [WHEREIN ...]
+func (s *Server) cmdFSETWHERE(msg *Message) (resp.Value, commandDetails,
+	error,
+) {
+	start := time.Now()
+	if s.config.maxMemory() > 0 && s.outOfMemory.Load() {
+		return retwerr(errOOM)
+	}
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) < 4 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	key, fname := args[1], args[2]
+	if isReservedFieldName(fname) {
+		return retwerr(errInvalidArgument(fname))
+	}
+	f := field.Make(fname, args[3])
+	// the remaining arguments select the objects, like for a scan
+	vs, t, err := s.parseSearchScanBaseTokens("fsetwhere",
+		searchScanBaseTokens{}, append([]string{key}, args[4:]...))
+	if err != nil {
+		return retwerr(err)
+	}
+	if len(vs) != 0 {
+		return retwerr(errInvalidArgument(vs[0]))
+	}
+	// The command is replayed from the aof, so the selection must not
+	// depend on scripts or time.
+	if len(t.whereevals) > 0 {
+		for _, whereeval := range t.whereevals {
+			whereeval.Close()
+		}
+		return retwerr(errors.New("WHEREEVAL is not allowed for FSETWHERE"))
+	}
+	if t.output != defaultSearchOutput || t.fence || t.hasttl {
+		return retwerr(errors.New("only MATCH, WHERE, and WHEREIN are " +
+			"allowed for FSETWHERE"))
+	}
+
+	// >> Operation
+
+	sw, err := s.newScanWriter(&bytes.Buffer{}, msg, key, outputCount, 0,
+		t.globs, false, 0, 0, t.wheres, t.whereins, nil, false)
+	if err != nil {
+		return retwerr(err)
+	}
+	if sw.col == nil {
+		return retwerr(errKeyNotFound)
+	}
+	// All matching objects are found before any are changed, so the update
+	// is all or nothing.
+	var objs []*object.Object
+	sw.col.Scan(false, nil, msg.Deadline, func(o *object.Object) bool {
+		if match, _, _ := sw.testObject(o); match &&
+			!o.Fields().Get(fname).Value().Equals(f.Value()) {
+			objs = append(objs, o)
+		}
+		return true
+	})
+	now := time.Now()
+	var d commandDetails
+	for _, o := range objs {
+		obj := object.New(o.ID(), o.Geo(), o.Expires(), o.Fields().Set(f))
+		sw.col.Set(obj)
+		d.children = append(d.children, &commandDetails{
+			command:   "fset",
+			updated:   true,
+			timestamp: now,
+			key:       key,
+			obj:       obj,
+		})
+	}
+	d.command = "fsetwhere"
+	d.key = key
+	d.updated = len(d.children) > 0
+	d.timestamp = now
+	d.parent = true
+
+	// >> Response
+
+	var res resp.Value
+	switch msg.OutputType {
+	case JSON:
+		res = resp.StringValue(`{"ok":true,"count":` +
+			strconv.Itoa(len(d.children)) + `,"elapsed":"` +
+			time.Since(start).String() + "\"}")
+	case RESP:
+		res = resp.IntegerValue(len(d.children))
+	}
+	return res, d, nil
+}
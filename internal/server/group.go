@@ -1,6 +1,8 @@
 package server
 
 import (
+	"time"
+
 	"github.com/tidwall/btree"
 )
 
@@ -43,11 +45,21 @@ type groupItem struct {
 	colKey   string
 	objID    string
 	groupID  string
+	entered  time.Time            // when the object entered the fence
+	dwelled  bool                 // a dwell was detected since it entered
+	pairs    map[string]*roamPair // nearby objects of a roaming fence
+}
+
+// roamPair is an object that is nearby the object of a group, for a roaming
+// fence.
+type roamPair struct {
+	nearby  time.Time // when the object came nearby
+	dwelled bool      // a dwell was detected since it came nearby
 }
 
 func newGroupItem(hookName, colKey, objID string) *groupItem {
 	groupID := bsonID()
-	g := &groupItem{}
+	g := &groupItem{entered: time.Now()}
 	// create a single string allocation
 	ustr := hookName + colKey + objID + groupID
 	var pos int
@@ -91,6 +103,73 @@ func (s *Server) groupGet(hookName, colKey, objID string) (groupID string) {
 	return ""
 }
 
+// groupDwell returns true when an object has been in the group of a fence
+// for a while, which is only true once for each time that it entered. The
+// group is left as is for a dry run.
+func (s *Server) groupDwell(hookName, colKey, objID string, now time.Time,
+	dwell time.Duration, dryRun bool,
+) bool {
+	v := s.groupHooks.Get(&groupItem{
+		hookName: hookName,
+		colKey:   colKey,
+		objID:    objID,
+	})
+	if v == nil {
+		return false
+	}
+	g := v.(*groupItem)
+	if g.dwelled || now.Sub(g.entered) < dwell {
+		return false
+	}
+	if !dryRun {
+		g.dwelled = true
+	}
+	return true
+}
+
+// groupRoamDwell returns the nearby objects of a roaming fence that have been
+// nearby for a while, which is only true once for each time that they came
+// nearby. The objects that are no longer nearby are forgotten, and the group
+// is left as is for a dry run.
+func (s *Server) groupRoamDwell(hookName, colKey, objID string,
+	nearbys []roamMatch, now time.Time, dwell time.Duration, dryRun bool,
+) []roamMatch {
+	var g *groupItem
+	if v := s.groupHooks.Get(&groupItem{
+		hookName: hookName,
+		colKey:   colKey,
+		objID:    objID,
+	}); v != nil {
+		g = v.(*groupItem)
+	} else if dryRun {
+		return nil
+	} else {
+		g = newGroupItem(hookName, colKey, objID)
+		s.groupHooks.Set(g)
+		s.groupObjects.Set(g)
+	}
+	var dwelled []roamMatch
+	pairs := make(map[string]*roamPair, len(nearbys))
+	for _, match := range nearbys {
+		p := g.pairs[match.id]
+		if p == nil {
+			p = &roamPair{nearby: now}
+		} else if dryRun {
+			cp := *p
+			p = &cp
+		}
+		if !p.dwelled && now.Sub(p.nearby) >= dwell {
+			p.dwelled = true
+			dwelled = append(dwelled, match)
+		}
+		pairs[match.id] = p
+	}
+	if !dryRun {
+		g.pairs = pairs
+	}
+	return dwelled
+}
+
 func deleteGroups(s *Server, groups []*groupItem) {
 	var hhint btree.PathHint
 	var ohint btree.PathHint
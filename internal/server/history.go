@@ -0,0 +1,216 @@
+package server
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/tile38/internal/collection"
+	"github.com/tidwall/tile38/internal/deadline"
+	"github.com/tidwall/tile38/internal/log"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+var errHistoryDisabled = errors.New(
+	"history is disabled, set history-retention to enable it")
+var errOutsideHistory = errors.New(
+	"timestamp is outside the history retention window")
+
+// historyEntry is the state of an object from a point in time onwards. A nil
+// object means that the object did not exist.
+type historyEntry struct {
+	ts  int64
+	obj *object.Object
+}
+
+// objectHistory holds the retained states of the objects of a collection,
+// ordered by time. Objects that have no history did not change within the
+// retention window.
+type objectHistory map[string][]historyEntry
+
+// recordHistory remembers the states of changed objects, for as long as the
+// history-retention config allows, so that WITHIN and INTERSECTS can query a
+// collection as of a past time.
+func (s *Server) recordHistory(d *commandDetails) {
+	if s.config.historyTTL() == 0 {
+		return
+	}
+	if d.parent {
+		for _, d := range d.children {
+			s.recordHistory(d)
+		}
+		return
+	}
+	switch d.command {
+	case "rename":
+		if hist := s.hist[d.key]; hist != nil {
+			delete(s.hist, d.key)
+			s.hist[d.newKey] = hist
+		} else {
+			delete(s.hist, d.newKey)
+		}
+	case "del":
+		if d.obj != nil {
+			s.appendHistory(d.key, d.obj.ID(), d.obj, d.timestamp.UnixNano(), nil)
+		}
+	case "set", "fset", "expire", "persist":
+		if d.obj != nil {
+			s.appendHistory(d.key, d.obj.ID(), d.old, d.timestamp.UnixNano(),
+				d.obj)
+		}
+	}
+}
+
+// recordDroppedHistory remembers that all objects of a collection were
+// removed by DROP or FLUSHDB.
+func (s *Server) recordDroppedHistory(key string, col *collection.Collection) {
+	if s.config.historyTTL() == 0 || !s.loadedAndReady.Load() {
+		return
+	}
+	ts := time.Now().UnixNano()
+	col.Scan(false, nil, nil, func(o *object.Object) bool {
+		s.appendHistory(key, o.ID(), o, ts, nil)
+		return true
+	})
+}
+
+// appendHistory adds a new state of an object. The previous state is kept as
+// the starting point of the history, when the object has none yet.
+func (s *Server) appendHistory(key, id string, prev *object.Object, ts int64,
+	obj *object.Object,
+) {
+	if s.hstart == 0 {
+		s.hstart = ts
+	}
+	hist := s.hist[key]
+	if hist == nil {
+		hist = make(objectHistory)
+		s.hist[key] = hist
+	}
+	entries := hist[id]
+	if len(entries) == 0 && prev != nil {
+		entries = append(entries, historyEntry{obj: prev})
+	}
+	hist[id] = append(entries, historyEntry{ts: ts, obj: obj})
+}
+
+// backgroundHistory removes object states that are older than the retention.
+func (s *Server) backgroundHistory(wg *sync.WaitGroup) {
+	defer wg.Done()
+	s.loopUntilServerStops(time.Second, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		n := s.pruneHistory(time.Now())
+		if n > 0 {
+			log.Debugf("removed %d object states", n)
+		}
+	})
+}
+
+func (s *Server) pruneHistory(now time.Time) int {
+	ttl := s.config.historyTTL()
+	if ttl == 0 {
+		var n int
+		for _, hist := range s.hist {
+			for _, entries := range hist {
+				n += len(entries)
+			}
+		}
+		s.hist = make(map[string]objectHistory)
+		s.hstart = 0
+		return n
+	}
+	if s.hstart == 0 {
+		s.hstart = now.UnixNano()
+	}
+	min := now.Add(-ttl).UnixNano()
+	var n int
+	for key, hist := range s.hist {
+		for id, entries := range hist {
+			// keep the last state before the window, it's the state of the
+			// object at the start of the window.
+			i := sort.Search(len(entries), func(i int) bool {
+				return entries[i].ts > min
+			}) - 1
+			if i == len(entries)-1 {
+				// no changes within the window
+				delete(hist, id)
+				n += len(entries)
+			} else if i > 0 {
+				hist[id] = append(entries[:0:0], entries[i:]...)
+				n += i
+			}
+		}
+		if len(hist) == 0 {
+			delete(s.hist, key)
+		}
+	}
+	return n
+}
+
+// historyAt returns the objects of a collection as they were at a point in
+// time, ordered by id.
+func (s *Server) historyAt(key string, ts int64) ([]*object.Object, error) {
+	ttl := s.config.historyTTL()
+	if ttl == 0 {
+		return nil, errHistoryDisabled
+	}
+	now := time.Now().UnixNano()
+	min := now - int64(ttl)
+	if s.hstart > min {
+		min = s.hstart
+	}
+	if s.hstart == 0 || ts < min || ts > now {
+		return nil, errOutsideHistory
+	}
+	hist := s.hist[key]
+	var objs []*object.Object
+	if col, _ := s.cols.Get(key); col != nil {
+		col.Scan(false, nil, nil, func(o *object.Object) bool {
+			if _, ok := hist[o.ID()]; !ok {
+				objs = append(objs, o)
+			}
+			return true
+		})
+	}
+	for _, entries := range hist {
+		i := sort.Search(len(entries), func(i int) bool {
+			return entries[i].ts > ts
+		}) - 1
+		if i >= 0 && entries[i].obj != nil {
+			objs = append(objs, entries[i].obj)
+		}
+	}
+	sort.Slice(objs, func(i, j int) bool {
+		return objs[i].ID() < objs[j].ID()
+	})
+	return objs, nil
+}
+
+// searchHistory iterates over the objects of a past state of a collection
+// that are within or intersect an area.
+func searchHistory(cmd string, objs []*object.Object, area geojson.Object,
+	cursor collection.Cursor, deadline *deadline.Deadline,
+	iter func(o *object.Object) bool,
+) {
+	offset := cursor.Offset()
+	cursor.Step(offset)
+	for i := offset; i < uint64(len(objs)); i++ {
+		cursor.Step(1)
+		if i&1023 == 1023 {
+			deadline.Check()
+		}
+		o := objs[i]
+		var match bool
+		if cmd == "within" {
+			match = o.Geo().Within(area)
+		} else {
+			match = o.Geo().Intersects(area)
+		}
+		if match && !iter(o) {
+			return
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"crypto/tls"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/tile38/internal/log"
+)
+
+// parseHookCerts parses the hook-client-certs config, which is a comma
+// separated list of name:certfile:keyfile entries. Each pair is loaded, so
+// that a bad certificate is reported when it's configured.
+func parseHookCerts(value string) (map[string]*tls.Certificate, string, bool) {
+	if strings.TrimSpace(value) == "" {
+		return nil, "", true
+	}
+	certs := make(map[string]*tls.Certificate)
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" || certs[parts[0]] != nil {
+			return nil, "", false
+		}
+		cert, err := tls.LoadX509KeyPair(parts[1], parts[2])
+		if err != nil {
+			log.Errorf("hook-client-certs: %s: %v", parts[0], err)
+			return nil, "", false
+		}
+		certs[parts[0]] = &cert
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	return certs, strings.Join(entries, ","), true
+}
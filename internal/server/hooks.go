@@ -27,32 +27,36 @@ func byHookName(a, b interface{}) bool {
 	return a.(*Hook).Name < b.(*Hook).Name
 }
 
-func (s *Server) cmdSetHook(msg *Message) (
-	res resp.Value, d commandDetails, err error,
-) {
-	channel := msg.Command() == "setchan"
-	start := time.Now()
+// parseHook parses the arguments of SETHOOK or SETCHAN into a hook, without
+// registering it.
+func (s *Server) parseHook(msg *Message, channel bool) (*Hook, error) {
 	vs := msg.Args[1:]
 	var name, urls, cmd string
 	var ok bool
 	if vs, name, ok = tokenval(vs); !ok || name == "" {
-		return NOMessage, d, errInvalidNumberOfArguments
+		return nil, errInvalidNumberOfArguments
 	}
 	var endpoints []string
+	var targets []hookTarget
 	if channel {
 		endpoints = []string{"local://" + name}
+		targets = []hookTarget{{endpoints[0], endpoint.DefaultRetryPolicy}}
 	} else {
 		if vs, urls, ok = tokenval(vs); !ok || urls == "" {
-			return NOMessage, d, errInvalidNumberOfArguments
+			return nil, errInvalidNumberOfArguments
 		}
 		for _, url := range strings.Split(urls, ",") {
 			url = strings.TrimSpace(url)
-			err := s.epc.Validate(url)
+			target, retry, err := endpoint.SplitRetryPolicy(url)
+			if err == nil {
+				err = s.epc.Validate(target)
+			}
 			if err != nil {
 				log.Errorf("sethook: %v", err)
-				return resp.SimpleStringValue(""), d, errInvalidArgument(url)
+				return nil, errInvalidArgument(url)
 			}
 			endpoints = append(endpoints, url)
+			targets = append(targets, hookTarget{target, retry})
 		}
 	}
 	var commandvs []string
@@ -60,35 +64,45 @@ func (s *Server) cmdSetHook(msg *Message) (
 	var types map[string]bool
 	var expires float64
 	var expiresSet bool
+	var format string
 	metaMap := make(map[string]string)
 	for {
 		commandvs = vs
 		if vs, cmd, ok = tokenval(vs); !ok || cmd == "" {
-			return NOMessage, d, errInvalidNumberOfArguments
+			return nil, errInvalidNumberOfArguments
 		}
 		cmdlc = strings.ToLower(cmd)
 		switch cmdlc {
 		default:
-			return NOMessage, d, errInvalidArgument(cmd)
+			return nil, errInvalidArgument(cmd)
 		case "meta":
 			var metakey string
 			var metaval string
 			if vs, metakey, ok = tokenval(vs); !ok || metakey == "" {
-				return NOMessage, d, errInvalidNumberOfArguments
+				return nil, errInvalidNumberOfArguments
 			}
 			if vs, metaval, ok = tokenval(vs); !ok || metaval == "" {
-				return NOMessage, d, errInvalidNumberOfArguments
+				return nil, errInvalidNumberOfArguments
 			}
 			metaMap[metakey] = metaval
 			continue
+		case "format":
+			var sformat string
+			if vs, sformat, ok = tokenval(vs); !ok || sformat == "" {
+				return nil, errInvalidNumberOfArguments
+			}
+			if format, ok = parseHookFormat(sformat); !ok {
+				return nil, errInvalidArgument(sformat)
+			}
+			continue
 		case "ex":
 			var s string
 			if vs, s, ok = tokenval(vs); !ok || s == "" {
-				return NOMessage, d, errInvalidNumberOfArguments
+				return nil, errInvalidNumberOfArguments
 			}
 			v, err := strconv.ParseFloat(s, 64)
 			if err != nil {
-				return NOMessage, d, errInvalidArgument(s)
+				return nil, errInvalidArgument(s)
 			}
 			expires = v
 			expiresSet = true
@@ -101,14 +115,17 @@ func (s *Server) cmdSetHook(msg *Message) (
 		break
 	}
 	args, err := s.cmdSearchArgs(true, cmdlc, vs, types)
-	if args.usingLua() {
-		defer args.Close()
+	if err == nil && !args.fence {
+		err = errors.New("missing FENCE argument")
 	}
-	if err != nil {
-		return NOMessage, d, err
+	if err == nil && args.population > 0 && args.roam.on {
+		err = errors.New("POPULATION is not allowed for ROAM")
 	}
-	if !args.fence {
-		return NOMessage, d, errors.New("missing FENCE argument")
+	if err != nil {
+		if args.usingLua() {
+			args.Close()
+		}
+		return nil, err
 	}
 	args.cmd = cmdlc
 	cmsg := &Message{}
@@ -122,18 +139,23 @@ func (s *Server) cmdSetHook(msg *Message) (
 	sort.Sort(hookMetaByName(metas))
 
 	hook := &Hook{
-		Key:       args.key,
-		Name:      name,
-		Endpoints: endpoints,
-		Fence:     &args,
-		Message:   cmsg,
-		epm:       s.epc,
-		Metas:     metas,
-		channel:   channel,
-		cond:      sync.NewCond(&sync.Mutex{}),
-		counter:   &s.statsTotalMsgsSent,
+		Key:        args.key,
+		Name:       name,
+		Endpoints:  endpoints,
+		targets:    targets,
+		Fence:      &args,
+		Message:    cmsg,
+		epm:        s.epc,
+		Metas:      metas,
+		format:     format,
+		channel:    channel,
+		cond:       sync.NewCond(&sync.Mutex{}),
+		counter:    &s.statsTotalMsgsSent,
+		dropped:    &s.statsTotalMsgsDrop,
+		deadLetter: s.config.hookDeadLetter,
 	}
 	if expiresSet {
+		hook.ex = expires
 		hook.expires =
 			time.Now().Add(time.Duration(expires * float64(time.Second)))
 	}
@@ -146,9 +168,27 @@ func (s *Server) cmdSetHook(msg *Message) (
 		args.cursor, args.limit, args.wheres, args.whereins, args.whereevals,
 		args.nofields)
 	if err != nil {
+		if args.usingLua() {
+			args.Close()
+		}
+		return nil, err
+	}
+	return hook, nil
+}
 
+func (s *Server) cmdSetHook(msg *Message) (
+	res resp.Value, d commandDetails, err error,
+) {
+	channel := msg.Command() == "setchan"
+	start := time.Now()
+	hook, err := s.parseHook(msg, channel)
+	if err != nil {
 		return NOMessage, d, err
 	}
+	if hook.Fence.usingLua() {
+		defer hook.Fence.Close()
+	}
+	name := hook.Name
 	prevHook, _ := s.hooks.Get(&Hook{Name: name}).(*Hook)
 	if prevHook != nil {
 		if prevHook.channel != channel {
@@ -172,6 +212,7 @@ func (s *Server) cmdSetHook(msg *Message) (
 		prevHook.Close()
 		s.hooks.Delete(prevHook)
 		s.hooksOut.Delete(prevHook)
+		s.hooksPop.Delete(prevHook)
 		if !prevHook.expires.IsZero() {
 			s.hookExpires.Delete(prevHook)
 		}
@@ -181,10 +222,19 @@ func (s *Server) cmdSetHook(msg *Message) (
 	d.updated = true
 	d.timestamp = time.Now()
 
+	if prevHook != nil {
+		hook.created = prevHook.created
+	} else {
+		s.hseq++
+		hook.created = s.hseq
+	}
 	s.hooks.Set(hook)
 	if hook.Fence.detect == nil || hook.Fence.detect["outside"] {
 		s.hooksOut.Set(hook)
 	}
+	if hook.Fence.population > 0 {
+		s.hooksPop.Set(hook)
+	}
 
 	// remove previous hook from spatial index
 	if prevHook != nil && prevHook.Fence != nil && prevHook.Fence.obj != nil {
@@ -249,6 +299,7 @@ func (s *Server) cmdDELHOOKop(name string, channel bool) (updated bool) {
 	// remove hook from maps
 	s.hooks.Delete(hook)
 	s.hooksOut.Delete(hook)
+	s.hooksPop.Delete(hook)
 	if !hook.expires.IsZero() {
 		s.hookExpires.Delete(hook)
 	}
@@ -415,6 +466,13 @@ func (s *Server) cmdHooks(msg *Message) (
 					buf.WriteString(jsonString(endpoint))
 				}
 				buf.WriteString(`]`)
+				healthy, err := hook.healthy()
+				buf.WriteString(`,"healthy":` + strconv.FormatBool(healthy))
+				if err != nil {
+					buf.WriteString(`,"error":` + jsonString(err.Error()))
+				}
+				buf.WriteString(`,"sent":` + strconv.FormatInt(hook.sent.Load(), 10))
+				buf.WriteString(`,"failed":` + strconv.FormatInt(hook.failed.Load(), 10))
 			}
 			buf.WriteString(`,"command":[`)
 			for i, v := range hook.Message.Args {
@@ -432,7 +490,11 @@ func (s *Server) cmdHooks(msg *Message) (
 				buf.WriteString(`:`)
 				buf.WriteString(jsonString(meta.Value))
 			}
-			buf.WriteString(`}}`)
+			buf.WriteString(`}`)
+			if hook.format != "" {
+				buf.WriteString(`,"format":` + jsonString(hook.format))
+			}
+			buf.WriteString(`}`)
 			i++
 			return true
 		})
@@ -469,6 +531,57 @@ func (s *Server) cmdHooks(msg *Message) (
 	return resp.SimpleStringValue(""), nil
 }
 
+// cmdHookValidate parses a SETHOOK definition without registering it, and
+// returns the hook in its normalized form.
+func (s *Server) cmdHookValidate(msg *Message) (resp.Value, error) {
+	start := time.Now()
+	hook, err := s.parseHook(msg, false)
+	if err != nil {
+		return NOMessage, err
+	}
+	if hook.Fence.usingLua() {
+		defer hook.Fence.Close()
+	}
+	args := hook.normalizedArgs()
+	switch msg.OutputType {
+	case JSON:
+		var buf []byte
+		buf = append(buf, `{"ok":true,"command":`...)
+		buf = appendJSONStrings(buf, args)
+		buf = append(buf, `,"elapsed":"`+time.Since(start).String()+`"}`...)
+		return resp.StringValue(string(buf)), nil
+	case RESP:
+		vals := make([]resp.Value, len(args))
+		for i, arg := range args {
+			vals[i] = resp.StringValue(arg)
+		}
+		return resp.ArrayValue(vals), nil
+	}
+	return NOMessage, nil
+}
+
+// normalizedArgs returns the SETHOOK command that defines the hook, with the
+// endpoints joined, the metas sorted and the keywords uppercased.
+func (h *Hook) normalizedArgs() []string {
+	args := []string{"SETHOOK", h.Name, strings.Join(h.Endpoints, ",")}
+	for _, meta := range h.Metas {
+		args = append(args, "META", meta.Name, meta.Value)
+	}
+	if !h.expires.IsZero() {
+		args = append(args, "EX", strconv.FormatFloat(h.ex, 'f', -1, 64))
+	}
+	if h.format != "" {
+		args = append(args, "FORMAT", strings.ToUpper(h.format))
+	}
+	for i, arg := range h.Message.Args {
+		if i == 0 {
+			arg = strings.ToUpper(arg)
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
 // Hook represents a hook.
 type Hook struct {
 	cond       *sync.Cond
@@ -486,8 +599,35 @@ type Hook struct {
 	query      string
 	epm        *endpoint.Manager
 	expires    time.Time
+	ex         float64
 	counter    *atomic.Int64 // counter that grows when a message was sent
 	sig        int
+	population populationState
+	format     string                // message format, empty for fence messages
+	created    uint64                // registration order, kept when the hook is replaced
+	sendErr    atomic.Pointer[error] // why the last send failed, nil when ok
+	targets    []hookTarget          // the endpoints without their retry params
+	sent       atomic.Int64          // messages that were sent
+	failed     atomic.Int64          // messages dropped after all retries
+	dropped    *atomic.Int64         // counter that grows when a message was dropped
+	failKey    string                // queued message that is being retried
+	failures   int                   // number of times that message failed
+	deadLetter func() string         // endpoint for the messages that are given up on
+}
+
+// hookTarget is an endpoint of a hook and how it's retried.
+type hookTarget struct {
+	url   string
+	retry endpoint.RetryPolicy
+}
+
+// healthy returns true when the last message of the hook was sent, and
+// otherwise the error of its last endpoint.
+func (h *Hook) healthy() (bool, error) {
+	if perr := h.sendErr.Load(); perr != nil {
+		return false, *perr
+	}
+	return true, nil
 }
 
 // Expires returns when the hook expires. Required by the expire.Item interface.
@@ -500,7 +640,8 @@ func (h *Hook) Equals(hook *Hook) bool {
 	if h.Key != hook.Key ||
 		h.Name != hook.Name ||
 		len(h.Endpoints) != len(hook.Endpoints) ||
-		len(h.Metas) != len(hook.Metas) {
+		len(h.Metas) != len(hook.Metas) ||
+		h.format != hook.format {
 		return false
 	}
 	if !h.expires.Equal(hook.expires) {
@@ -606,13 +747,16 @@ func (h *Hook) manager() {
 		}
 		sig = h.sig
 		// unlock/logk the hook and send outgoing messages
+		var wait time.Duration
 		if !func() bool {
 			h.cond.L.Unlock()
 			defer h.cond.L.Lock()
-			return h.proc()
+			var ok bool
+			ok, wait = h.proc()
+			return ok
 		}() {
-			// a send failed, try again in a moment
-			time.Sleep(time.Second / 2)
+			// a send failed, try again after the backoff
+			h.waitRetry(wait)
 			continue
 		}
 		if sig != h.sig {
@@ -624,10 +768,51 @@ func (h *Hook) manager() {
 	}
 }
 
+// sendDeadLetter writes a message that could not be delivered to the
+// dead-letter endpoint, when there is one. That's done in the background and
+// a failure is only logged.
+func (h *Hook) sendDeadLetter(url, msg, reason string) {
+	dl := h.deadLetter()
+	if dl == "" {
+		return
+	}
+	payload := msg
+	if !gjson.Valid(payload) {
+		payload = jsonString(payload)
+	}
+	letter := `{"hook":` + jsonString(h.Name) +
+		`,"endpoint":` + jsonString(url) +
+		`,"reason":` + jsonString(reason) +
+		`,"time":` + jsonString(time.Now().Format(time.RFC3339Nano)) +
+		`,"message":` + payload + `}`
+	go func() {
+		if err := h.epm.Send(dl, letter); err != nil {
+			log.Warnf("hook %s: dead-letter: %v", h.Name, err)
+		}
+	}()
+}
+
+// waitRetry waits until it's time to retry a failed send, or the hook has
+// closed. It must be called with the hook locked.
+func (h *Hook) waitRetry(wait time.Duration) {
+	var retry bool
+	timer := time.AfterFunc(wait, func() {
+		h.cond.L.Lock()
+		retry = true
+		h.cond.Broadcast()
+		h.cond.L.Unlock()
+	})
+	defer timer.Stop()
+	for !retry && !h.closed {
+		h.cond.Wait()
+	}
+}
+
 // proc processes queued hook logs.
 // returning true will indicate that all log entries have been
-// successfully handled.
-func (h *Hook) proc() (ok bool) {
+// successfully handled, otherwise it returns how long to wait before
+// trying again.
+func (h *Hook) proc() (ok bool, wait time.Duration) {
 	var keys, vals []string
 	var ttls []time.Duration
 	start := time.Now()
@@ -669,51 +854,89 @@ func (h *Hook) proc() (ok bool) {
 	})
 	if err != nil {
 		log.Error(err)
-		return false
+		return false, endpoint.DefaultRetryPolicy.Backoff
 	}
 
 	// send each val. on failure reinsert that one and all of the following
 	for i, key := range keys {
 		val := vals[i]
 		idx := stringToUint64(key[len(hookLogPrefix):])
+		if key != h.failKey {
+			h.failKey, h.failures = key, 0
+		}
 		var sent bool
-		for _, endpoint := range h.Endpoints {
-			err := h.epm.Send(endpoint, val)
+		var lastURL string
+		var lastErr error
+		for i, target := range h.targets {
+			if !target.retry.Allows(h.failures) {
+				// out of retries for this endpoint
+				continue
+			}
+			err := h.epm.Send(target.url, val)
 			if err != nil {
 				log.Debugf("Endpoint connect/send error: %v: %v: %v",
-					idx, endpoint, err)
+					idx, target.url, err)
+				h.sendErr.Store(&err)
+				lastURL, lastErr = h.Endpoints[i], err
 				continue
 			}
-			log.Debugf("Endpoint send ok: %v: %v: %v", idx, endpoint, err)
+			log.Debugf("Endpoint send ok: %v: %v: %v", idx, target.url, err)
 			sent = true
+			h.sendErr.Store(nil)
 			h.counter.Add(1)
+			h.sent.Add(1)
 			break
 		}
-		if !sent {
-			// failed to send. try to reinsert the remaining.
-			// if this fails we lose log entries.
-			keys = keys[i:]
-			vals = vals[i:]
-			ttls = ttls[i:]
-			h.db.Update(func(tx *buntdb.Tx) error {
-				for i, key := range keys {
-					val := vals[i]
-					ttl := ttls[i] - time.Since(start)
-					if ttl > 0 {
-						opts := &buntdb.SetOptions{
-							Expires: true,
-							TTL:     ttl,
-						}
-						_, _, err := tx.Set(key, val, opts)
-						if err != nil {
-							return err
-						}
-					}
+		if sent {
+			h.failKey = ""
+			continue
+		}
+		h.failures++
+		var retry bool
+		for _, target := range h.targets {
+			if target.retry.Allows(h.failures) {
+				if w := target.retry.Wait(h.failures); !retry || w < wait {
+					wait = w
 				}
-				return nil
-			})
-			return false
+				retry = true
+			}
+		}
+		if !retry {
+			// every endpoint is out of retries, so give up on the message
+			// instead of holding up the ones that follow it.
+			log.Warnf("hook %s: dropped message %v after %d attempts",
+				h.Name, idx, h.failures)
+			h.failKey = ""
+			h.failed.Add(1)
+			h.dropped.Add(1)
+			h.sendDeadLetter(lastURL, val, lastErr.Error())
+			continue
 		}
+		// failed to send. try to reinsert the remaining.
+		// if this fails we lose log entries.
+		keys = keys[i:]
+		vals = vals[i:]
+		ttls = ttls[i:]
+		h.db.Update(func(tx *buntdb.Tx) error {
+			for i, key := range keys {
+				val := vals[i]
+				ttl := ttls[i] - time.Since(start)
+				if ttl <= 0 {
+					h.sendDeadLetter(lastURL, val, "expired")
+					continue
+				}
+				opts := &buntdb.SetOptions{
+					Expires: true,
+					TTL:     ttl,
+				}
+				_, _, err := tx.Set(key, val, opts)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return false, wait
 	}
-	return true
+	return true, 0
 }
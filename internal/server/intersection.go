@@ -0,0 +1,63 @@
+package server
+
+import (
+	"time"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/clip"
+)
+
+// INTERSECTION keyA idA keyB idB
+func (s *Server) cmdINTERSECTION(msg *Message) (resp.Value, error) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 5 {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+
+	// >> Operation
+
+	var geoms [2]geojson.Object
+	for i := range geoms {
+		key, id := args[1+i*2], args[2+i*2]
+		col, _ := s.cols.Get(key)
+		if col == nil {
+			return retrerr(errKeyNotFound)
+		}
+		o := col.Get(id)
+		if o == nil {
+			return retrerr(errIDNotFound)
+		}
+		geoms[i] = o.Geo()
+	}
+	g, err := clip.Intersection(geoms[0], geoms[1], &s.geomIndexOpts)
+	if err != nil {
+		return retrerr(err)
+	}
+
+	// >> Response
+
+	// Objects that have nothing in common give a null object.
+	switch msg.OutputType {
+	case JSON:
+		var b []byte
+		b = append(b, `{"ok":true,"object":`...)
+		if g != nil {
+			b = g.AppendJSON(b)
+		} else {
+			b = append(b, "null"...)
+		}
+		b = append(b, `,"elapsed":"`+time.Since(start).String()+`"}`...)
+		return resp.BytesValue(b), nil
+	case RESP:
+		if g == nil {
+			return resp.NullValue(), nil
+		}
+		return resp.StringValue(g.String()), nil
+	}
+	return NOMessage, nil
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"github.com/tidwall/tile38/internal/collection"
+	"github.com/tidwall/tile38/internal/field"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+// objectJoin adds the fields of the objects of another collection to the
+// results of a search, for JOIN. Each result references an object of the
+// other collection by the id in one of its fields, and the fields of that
+// object are added with the key of the collection as a prefix, such as
+// "drivers.name". Results that reference nothing are left as is.
+type objectJoin struct {
+	col    *collection.Collection
+	on     string
+	fields []string // nil adds all of the fields
+	prefix string
+}
+
+// newObjectJoin returns the join for JOIN, or nil if there's none.
+func (s *Server) newObjectJoin(t searchScanBaseTokens) *objectJoin {
+	if t.joinkey == "" {
+		return nil
+	}
+	col, _ := s.cols.Get(t.joinkey)
+	return &objectJoin{
+		col:    col,
+		on:     t.joinon,
+		fields: t.joinfields,
+		prefix: t.joinkey + ".",
+	}
+}
+
+// merge returns the object with the fields of the object that it references.
+func (j *objectJoin) merge(o *object.Object) *object.Object {
+	if j.col == nil {
+		return o
+	}
+	ref := o.Fields().Get(j.on).Value()
+	if ref.IsZero() {
+		return o
+	}
+	jo := j.col.Get(ref.Data())
+	if jo == nil {
+		return o
+	}
+	fields := o.Fields()
+	add := func(name string, value field.Value) {
+		if !value.IsZero() {
+			fields = fields.Set(field.Make(j.prefix+name, value.JSON()))
+		}
+	}
+	if j.fields == nil {
+		jo.Fields().Scan(func(f field.Field) bool {
+			add(f.Name(), f.Value())
+			return true
+		})
+	} else {
+		for _, name := range j.fields {
+			add(name, jo.Fields().Get(name).Value())
+		}
+	}
+	return object.New(o.ID(), o.Geo(), o.Expires(), fields)
+}
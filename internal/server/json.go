@@ -2,10 +2,14 @@ package server
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/tidwall/geojson"
 	"github.com/tidwall/gjson"
@@ -16,6 +20,62 @@ import (
 	"github.com/tidwall/tile38/internal/object"
 )
 
+// jsonTooDeep returns true when the objects and arrays of a json document are
+// nested deeper than max. It does not recurse, so it's safe to call before
+// handing untrusted input to a recursive parser.
+func jsonTooDeep(json string, max int) bool {
+	var depth int
+	for i := 0; i < len(json); i++ {
+		switch json[i] {
+		case '{', '[':
+			depth++
+			if depth > max {
+				return true
+			}
+		case '}', ']':
+			depth--
+		case '"':
+			for i++; i < len(json); i++ {
+				if json[i] == '\\' {
+					i++
+				} else if json[i] == '"' {
+					break
+				}
+			}
+		}
+	}
+	return false
+}
+
+// checkGeometryDepth returns an error when a GeoJSON geometry is nested deeper
+// than the max-geometry-depth config allows. Only commands from clients are
+// checked. The aof and a leader's stream hold geometries that were already
+// accepted, which may have been under a higher limit.
+func (s *Server) checkGeometryDepth(json string) error {
+	if !s.loadedAndReady.Load() || s.freplay {
+		return nil
+	}
+	if max := s.config.maxGeometryDepth(); jsonTooDeep(json, max) {
+		return fmt.Errorf("geometry exceeds the max-geometry-depth of %d", max)
+	}
+	return nil
+}
+
+// parseObject parses the geometry of an OBJECT, which is GeoJSON or WKT.
+func (s *Server) parseObject(obj string) (geojson.Object, error) {
+	if isWKT(obj) {
+		json, err := wktToGeoJSON(obj)
+		if err != nil {
+			return nil, err
+		}
+		obj = json
+	}
+	if err := s.checkGeometryDepth(obj); err != nil {
+		return nil, err
+	}
+	return geojson.Parse(obj, &s.geomParseOpts)
+}
+
 func appendJSONString(b []byte, s string) []byte {
 	for i := 0; i < len(s); i++ {
 		if s[i] < ' ' || s[i] == '\\' || s[i] == '"' || s[i] > 126 {
@@ -29,6 +89,17 @@ func appendJSONString(b []byte, s string) []byte {
 	return b
 }
 
+func appendJSONStrings(b []byte, strs []string) []byte {
+	b = append(b, '[')
+	for i, str := range strs {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, str)
+	}
+	return append(b, ']')
+}
+
 func jsonString(s string) string {
 	for i := 0; i < len(s); i++ {
 		if s[i] < ' ' || s[i] == '\\' || s[i] == '"' || s[i] > 126 {
@@ -43,6 +114,35 @@ func jsonString(s string) string {
 	return string(b)
 }
 
+// binaryID returns true when an id is not printable UTF-8 text.
+func binaryID(id string) bool {
+	if !utf8.ValidString(id) {
+		return true
+	}
+	for _, r := range id {
+		if !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendJSONID appends an "id" member. Binary ids are base64 encoded and
+// flagged with an "id_encoding" member.
+func appendJSONID(b []byte, id string) []byte {
+	b = append(b, `"id":`...)
+	if binaryID(id) {
+		b = append(b, '"')
+		b = append(b, base64.StdEncoding.EncodeToString([]byte(id))...)
+		return append(b, `","id_encoding":"base64"`...)
+	}
+	return appendJSONString(b, id)
+}
+
+func jsonID(id string) string {
+	return string(appendJSONID(nil, id))
+}
+
 func isJSONNumber(data string) bool {
 	// Returns true if the given string can be encoded as a JSON number value.
 	// See:
@@ -267,7 +367,7 @@ func (s *Server) cmdJset(msg *Message) (res resp.Value, d commandDetails, err er
 	col, _ := s.cols.Get(key)
 	var createcol bool
 	if col == nil {
-		col = collection.New()
+		col = s.newCollection(key)
 		createcol = true
 	}
 	var json string
@@ -44,3 +44,32 @@ func TestIsJsonNumber(t *testing.T) {
 	test(true, "1E+5")
 	test(true, "1E-10")
 }
+
+func TestJSONID(t *testing.T) {
+	test := func(id, expect string) {
+		t.Helper()
+		if actual := jsonID(id); actual != expect {
+			t.Fatalf("expected '%s', got '%s'", expect, actual)
+		}
+	}
+	test("truck1", `"id":"truck1"`)
+	test("héllo", `"id":"héllo"`)
+	test("a\tb", `"id":"YQli","id_encoding":"base64"`)
+	test("\xff\x00\x9e", `"id":"/wCe","id_encoding":"base64"`)
+}
+
+func TestJSONTooDeep(t *testing.T) {
+	test := func(expected bool, json string, max int) {
+		t.Helper()
+		if actual := jsonTooDeep(json, max); actual != expected {
+			t.Fatalf("Expected %t == jsonTooDeep(%q, %d) but was %t",
+				expected, json, max, actual)
+		}
+	}
+	test(false, `{"type":"Point","coordinates":[1,2]}`, 2)
+	test(true, `{"type":"Point","coordinates":[1,2]}`, 1)
+	test(false, `{"a":"[[[[\"{{{"}`, 1)
+	test(true, `[[[[[]]]]]`, 4)
+	test(false, `[[[[[]]]]]`, 5)
+	test(false, `"\\"`, 1)
+}
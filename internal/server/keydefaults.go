@@ -0,0 +1,115 @@
+package server
+
+import (
+	"strings"
+	"time"
+
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/field"
+)
+
+// renameKeyDefaults moves the default fields of a key when it's renamed.
+func (s *Server) renameKeyDefaults(d *commandDetails) {
+	if len(s.defaults) == 0 {
+		return
+	}
+	if d.parent {
+		for _, d := range d.children {
+			s.renameKeyDefaults(d)
+		}
+		return
+	}
+	if d.command != "rename" {
+		return
+	}
+	if defaults, ok := s.defaults[d.key]; ok {
+		delete(s.defaults, d.key)
+		s.defaults[d.newKey] = defaults
+	} else {
+		delete(s.defaults, d.newKey)
+	}
+}
+
+// KEYDEFAULTS key [field value ...]
+func (s *Server) cmdKEYDEFAULTS(msg *Message) (resp.Value, commandDetails,
+	error,
+) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) < 2 || len(args)%2 == 1 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	key := args[1]
+	var defaults field.List
+	for i := 2; i < len(args); i += 2 {
+		if isReservedFieldName(args[i]) {
+			return retwerr(errInvalidArgument(args[i]))
+		}
+		defaults = defaults.Set(field.Make(args[i], args[i+1]))
+	}
+
+	// >> Operation
+
+	// The defaults are replaced as a whole, and no pairs clears them.
+	var d commandDetails
+	if defaults.Len() > 0 {
+		s.defaults[key] = defaults
+		d.updated = true
+	} else if _, ok := s.defaults[key]; ok {
+		delete(s.defaults, key)
+		d.updated = true
+	}
+	d.timestamp = time.Now()
+
+	// >> Response
+
+	return OKMessage(msg, start), d, nil
+}
+
+// GETKEYDEFAULTS key
+func (s *Server) cmdGETKEYDEFAULTS(msg *Message) (resp.Value, error) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 2 {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	key := args[1]
+
+	// >> Operation
+
+	defaults := s.defaults[key]
+
+	// >> Response
+
+	switch msg.OutputType {
+	case JSON:
+		var buf strings.Builder
+		buf.WriteString(`{"ok":true,"defaults":{`)
+		var i int
+		defaults.Scan(func(f field.Field) bool {
+			if i > 0 {
+				buf.WriteString(`,`)
+			}
+			buf.WriteString(jsonString(f.Name()) + ":" + f.Value().JSON())
+			i++
+			return true
+		})
+		buf.WriteString(`},"elapsed":"` + time.Since(start).String() + `"}`)
+		return resp.StringValue(buf.String()), nil
+	case RESP:
+		vals := make([]resp.Value, 0, defaults.Len()*2)
+		defaults.Scan(func(f field.Field) bool {
+			vals = append(vals, resp.StringValue(f.Name()),
+				resp.StringValue(f.Value().Data()))
+			return true
+		})
+		return resp.ArrayValue(vals), nil
+	}
+	return NOMessage, nil
+}
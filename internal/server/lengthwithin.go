@@ -0,0 +1,113 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/geojson/geometry"
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/clip"
+	"github.com/tidwall/tile38/internal/geodesic"
+)
+
+var errNotPolygon = errors.New("object is not a polygon")
+
+// isPolygonal returns true for objects that have an area.
+func isPolygonal(g geojson.Object) bool {
+	switch g := g.(type) {
+	case *geojson.Polygon, *geojson.MultiPolygon, *geojson.Rect:
+		return true
+	case *geojson.Feature:
+		return isPolygonal(g.Base())
+	}
+	return false
+}
+
+// lineLength returns the length in meters of a line.
+func lineLength(metric geodesic.Metric, line *geometry.Line) float64 {
+	var meters float64
+	for i := 0; i < line.NumSegments(); i++ {
+		seg := line.SegmentAt(i)
+		meters += metric.Distance(seg.A.Y, seg.A.X, seg.B.Y, seg.B.X)
+	}
+	return meters
+}
+
+// LENGTHWITHIN trackkey trackid regionkey regionid [METRIC name]
+func (s *Server) cmdLENGTHWITHIN(msg *Message) (resp.Value, error) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 5 && len(args) != 7 {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	metric := s.config.distanceMetric()
+	if len(args) == 7 {
+		if strings.ToLower(args[5]) != "metric" {
+			return retrerr(errInvalidArgument(args[5]))
+		}
+		var ok bool
+		if metric, ok = geodesic.ParseMetric(args[6]); !ok {
+			return retrerr(errInvalidArgument(args[6]))
+		}
+	}
+
+	// >> Operation
+
+	var geoms [2]geojson.Object
+	for i := range geoms {
+		key, id := args[1+i*2], args[2+i*2]
+		col, _ := s.cols.Get(key)
+		if col == nil {
+			return retrerr(errKeyNotFound)
+		}
+		o := col.Get(id)
+		if o == nil {
+			return retrerr(errIDNotFound)
+		}
+		geoms[i] = o.Geo()
+	}
+	track, region := geoms[0], geoms[1]
+	switch track.(type) {
+	case *geojson.LineString, *geojson.MultiLineString:
+	default:
+		return retrerr(errNotLineString)
+	}
+	if !isPolygonal(region) {
+		return retrerr(errNotPolygon)
+	}
+	// The track is clipped to the region, which leaves one line for each
+	// time that the track passes through it.
+	g, err := clip.Intersection(track, region, &s.geomIndexOpts)
+	if err != nil {
+		return retrerr(err)
+	}
+	var meters float64
+	switch g := g.(type) {
+	case *geojson.LineString:
+		meters = lineLength(metric, g.Base())
+	case *geojson.MultiLineString:
+		for _, child := range g.Children() {
+			meters += lineLength(metric, child.(*geojson.LineString).Base())
+		}
+	}
+
+	// >> Response
+
+	switch msg.OutputType {
+	case JSON:
+		var b []byte
+		b = append(b, `{"ok":true,"meters":`...)
+		b = strconv.AppendFloat(b, meters, 'f', -1, 64)
+		b = append(b, `,"elapsed":"`+time.Since(start).String()+`"}`...)
+		return resp.BytesValue(b), nil
+	case RESP:
+		return resp.FloatValue(meters), nil
+	}
+	return NOMessage, nil
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/resp"
+	"github.com/tidwall/sjson"
+	"github.com/tidwall/tile38/internal/field"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+var errNotLineString = errors.New("object is not a linestring")
+var errNoVertexTime = errors.New(
+	"MAXAGE requires a unix timestamp as the fourth value of each vertex")
+
+// trackVertices returns the vertices of a linestring object. Each vertex is
+// the raw json array, so that any extra values, like an elevation and a
+// timestamp, are kept.
+func trackVertices(g geojson.Object) ([]string, error) {
+	if _, ok := g.(*geojson.LineString); !ok {
+		return nil, errNotLineString
+	}
+	var vertices []string
+	gjson.Get(g.JSON(), "coordinates").ForEach(
+		func(_, v gjson.Result) bool {
+			vertices = append(vertices, v.Raw)
+			return true
+		},
+	)
+	return vertices, nil
+}
+
+// vertexTime returns the unix timestamp of a vertex, which is its fourth
+// value.
+func vertexTime(vertex string) (float64, bool) {
+	ts := gjson.Get(vertex, "3")
+	return ts.Float(), ts.Type == gjson.Number
+}
+
+// trackGeometry returns the json for an object with new vertices. A single
+// vertex becomes a Point, because a LineString needs at least two.
+func trackGeometry(g geojson.Object, vertices []string) (string, error) {
+	json, err := sjson.Delete(g.JSON(), "bbox")
+	if err != nil {
+		return "", err
+	}
+	if len(vertices) == 1 {
+		json, _ = sjson.Set(json, "type", "Point")
+		return sjson.SetRaw(json, "coordinates", vertices[0])
+	}
+	json, _ = sjson.Set(json, "type", "LineString")
+	return sjson.SetRaw(json, "coordinates",
+		"["+strings.Join(vertices, ",")+"]")
+}
+
+// setTrack replaces the geometry of an object, keeping the fields and
+// expiration of the old object, if any.
+func (s *Server) setTrack(key, id string, old *object.Object, json string,
+) (commandDetails, error) {
+	var d commandDetails
+	g, err := geojson.Parse(json, &s.geomParseOpts)
+	if err != nil {
+		return d, err
+	}
+	col, _ := s.cols.Get(key)
+	if col == nil {
+		col = s.newCollection(key)
+		s.cols.Set(key, col)
+	}
+	var expires int64
+	var fields field.List
+	if old != nil {
+		expires, fields = old.Expires(), old.Fields()
+	}
+	obj := object.New(id, s.dedupGeometry(key, g), expires, fields)
+	d.command = "set"
+	d.key = key
+	d.obj = obj
+	d.old = col.Set(obj)
+	d.updated = true
+	d.timestamp = time.Now()
+	return d, nil
+}
+
+// setArgs returns a SET command for the object of a write.
+func setArgs(d *commandDetails) []string {
+	args := []string{"SET", d.key, d.obj.ID()}
+	if expires := d.obj.Expires(); expires > 0 {
+		ex := float64(expires-d.timestamp.UnixNano()) / float64(time.Second)
+		args = append(args, "EX", strconv.FormatFloat(ex, 'f', -1, 64))
+	}
+	return append(args, "OBJECT", d.obj.Geo().JSON())
+}
+
+// TRACKTRIM key id [MAXPOINTS n] [MAXAGE seconds]
+func (s *Server) cmdTRACKTRIM(msg *Message) (resp.Value, commandDetails, error) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) < 5 || len(args)%2 == 0 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	key, id := args[1], args[2]
+	var maxPoints int
+	var maxAge float64
+	var hasMaxAge bool
+	for i := 3; i < len(args); i += 2 {
+		switch strings.ToLower(args[i]) {
+		case "maxpoints":
+			n, err := strconv.ParseUint(args[i+1], 10, 31)
+			if err != nil || n == 0 {
+				return retwerr(errInvalidArgument(args[i+1]))
+			}
+			maxPoints = int(n)
+		case "maxage":
+			secs, err := strconv.ParseFloat(args[i+1], 64)
+			if err != nil || secs < 0 {
+				return retwerr(errInvalidArgument(args[i+1]))
+			}
+			maxAge, hasMaxAge = secs, true
+		default:
+			return retwerr(errInvalidArgument(args[i]))
+		}
+	}
+
+	// >> Operation
+
+	col, _ := s.cols.Get(key)
+	if col == nil {
+		return retwerr(errKeyNotFound)
+	}
+	o := col.Get(id)
+	if o == nil {
+		return retwerr(errIDNotFound)
+	}
+	vertices, err := trackVertices(o.Geo())
+	if err != nil {
+		return retwerr(err)
+	}
+	var trim int
+	if maxPoints > 0 && len(vertices) > maxPoints {
+		trim = len(vertices) - maxPoints
+	}
+	if hasMaxAge {
+		// vertices are in append order, and the latest is always kept
+		min := float64(start.UnixNano())/float64(time.Second) - maxAge
+		for i, vertex := range vertices {
+			ts, ok := vertexTime(vertex)
+			if !ok {
+				return retwerr(errNoVertexTime)
+			}
+			if ts < min && i+1 > trim && i < len(vertices)-1 {
+				trim = i + 1
+			}
+		}
+	}
+	var d commandDetails
+	if trim > 0 {
+		json, err := trackGeometry(o.Geo(), vertices[trim:])
+		if err != nil {
+			return retwerr(err)
+		}
+		if d, err = s.setTrack(key, id, o, json); err != nil {
+			return retwerr(err)
+		}
+		// The trim depends on the current time, so the AOF and the
+		// followers get the resulting geometry instead.
+		msg.Args = setArgs(&d)
+	}
+
+	// >> Response
+
+	var res resp.Value
+	switch msg.OutputType {
+	case JSON:
+		res = resp.StringValue(`{"ok":true,"removed":` +
+			strconv.FormatInt(int64(trim), 10) +
+			`,"elapsed":"` + time.Since(start).String() + "\"}")
+	case RESP:
+		res = resp.IntegerValue(trim)
+	}
+	return res, d, nil
+}
+
+// TRACKAPPEND key id POINT lat lon [z [timestamp]]
+func (s *Server) cmdTRACKAPPEND(msg *Message) (resp.Value, commandDetails,
+	error,
+) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) < 6 || len(args) > 8 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	key, id := args[1], args[2]
+	if strings.ToLower(args[3]) != "point" {
+		return retwerr(errInvalidArgument(args[3]))
+	}
+	// the vertex is [lon,lat,z,timestamp]
+	nums := make([]float64, len(args)-4)
+	for i, arg := range args[4:] {
+		n, err := strconv.ParseFloat(arg, 64)
+		if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+			return retwerr(errInvalidArgument(arg))
+		}
+		nums[i] = n
+	}
+	nums[0], nums[1] = nums[1], nums[0]
+	vertex := []byte{'['}
+	for i, n := range nums {
+		if i > 0 {
+			vertex = append(vertex, ',')
+		}
+		vertex = strconv.AppendFloat(vertex, n, 'f', -1, 64)
+	}
+	vertex = append(vertex, ']')
+
+	// >> Operation
+
+	var o *object.Object
+	if col, _ := s.cols.Get(key); col != nil {
+		o = col.Get(id)
+	}
+	var vertices []string
+	var json string
+	var err error
+	if o == nil {
+		// A LineString needs two vertices, so a new track starts as a Point.
+		vertices = []string{string(vertex)}
+		json = `{"type":"Point","coordinates":` + string(vertex) + `}`
+	} else {
+		switch g := o.Geo().(type) {
+		case *geojson.Point, *geojson.SimplePoint:
+			vertices = []string{gjson.Get(g.JSON(), "coordinates").Raw}
+		default:
+			if vertices, err = trackVertices(g); err != nil {
+				return retwerr(err)
+			}
+		}
+		vertices = append(vertices, string(vertex))
+		if json, err = trackGeometry(o.Geo(), vertices); err != nil {
+			return retwerr(err)
+		}
+	}
+	d, err := s.setTrack(key, id, o, json)
+	if err != nil {
+		return retwerr(err)
+	}
+
+	// >> Response
+
+	var res resp.Value
+	switch msg.OutputType {
+	case JSON:
+		res = resp.StringValue(`{"ok":true,"points":` +
+			strconv.FormatInt(int64(len(vertices)), 10) +
+			`,"elapsed":"` + time.Since(start).String() + "\"}")
+	case RESP:
+		res = resp.IntegerValue(len(vertices))
+	}
+	return res, d, nil
+}
@@ -105,6 +105,10 @@ func (s *Server) goLive(
 		return s.liveSubscription(conn, rd, msg, websocket)
 	case liveMonitorSwitches:
 		return s.liveMonitor(conn, rd, msg)
+	case liveExportSwitches:
+		return s.liveExport(lfs, conn, rd, msg, websocket)
+	case liveLogSwitches:
+		return s.liveLog(lfs, conn, rd, msg, websocket)
 	case liveFenceSwitches:
 		// fallthrough
 	}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/redcon"
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/log"
+)
+
+// logSubscribeBuffer is the number of log entries that may wait to be sent to
+// a subscriber. Entries are dropped when a subscriber can't keep up, because
+// logging must never wait on a connection.
+const logSubscribeBuffer = 1024
+
+// logLevels ranks the levels of the log entries.
+var logLevels = map[string]int{
+	"debug": 0, "info": 1, "warn": 2, "error": 3, "fatal": 4,
+}
+
+type liveLogSwitches struct {
+	level int // the lowest level that is sent
+}
+
+func (s liveLogSwitches) Error() string {
+	return goingLive
+}
+
+// LOGSUBSCRIBE [debug|info|warn|error]
+func (s *Server) cmdLOGSUBSCRIBE(msg *Message) (resp.Value, error) {
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) > 2 {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	ls := liveLogSwitches{level: logLevels["info"]}
+	if len(args) == 2 {
+		level, ok := logLevels[strings.ToLower(args[1])]
+		if !ok || level == logLevels["fatal"] {
+			return retrerr(errInvalidArgument(args[1]))
+		}
+		ls.level = level
+	}
+
+	// >> Response
+
+	return NOMessage, ls
+}
+
+// appendLogEntry appends the json message for a log entry.
+func appendLogEntry(b []byte, e log.Entry) []byte {
+	b = append(b, `{"time":"`...)
+	b = e.Time.AppendFormat(b, time.RFC3339Nano)
+	b = append(b, `","level":"`...)
+	b = append(b, e.Level...)
+	b = append(b, `","message":`...)
+	b = appendJSONString(b, strings.TrimRight(e.Message, "\n"))
+	b = append(b, '}')
+	return b
+}
+
+func (s *Server) liveLog(ls liveLogSwitches, conn net.Conn,
+	rd *PipelineReader, msg *Message, websocket bool,
+) error {
+	defer conn.Close()
+	entries := make(chan log.Entry, logSubscribeBuffer)
+	var dropped atomic.Int64
+	unsubscribe := log.Subscribe(func(e log.Entry) {
+		if logLevels[e.Level] < ls.level {
+			return
+		}
+		select {
+		case entries <- e:
+		default:
+			dropped.Add(1)
+		}
+	})
+	defer unsubscribe()
+	done := make(chan struct{})
+	go func() {
+		// Any incoming message ends the subscription
+		rd.ReadMessages()
+		close(done)
+	}()
+	connType := msg.ConnType
+	var livemsg []byte
+	switch msg.OutputType {
+	case JSON:
+		livemsg = redcon.AppendBulkString(nil, `{"ok":true,"live":true}`)
+	case RESP:
+		livemsg = redcon.AppendOK(nil)
+	}
+	if err := writeLiveMessage(conn, livemsg, false, connType, websocket); err != nil {
+		return nil // nil return is fine here
+	}
+	for {
+		select {
+		case <-done:
+			return nil
+		case e := <-entries:
+			var m []byte
+			if n := dropped.Swap(0); n > 0 {
+				m = []byte(`{"dropped":` + strconv.FormatInt(n, 10) + `}`)
+				if err := writeLiveMessage(conn, m, true, connType, websocket); err != nil {
+					return nil
+				}
+			}
+			m = appendLogEntry(nil, e)
+			if err := writeLiveMessage(conn, m, true, connType, websocket); err != nil {
+				return nil
+			}
+		}
+	}
+}
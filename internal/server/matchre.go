@@ -0,0 +1,28 @@
+package server
+
+import (
+	"regexp"
+)
+
+// maxMatchRegexps is the number of compiled MATCH RE patterns that are kept.
+const maxMatchRegexps = 256
+
+// compileMatchRegexp compiles the pattern of a MATCH RE. The compiled
+// regexps are kept, so the pages of a query that continue with a cursor
+// don't compile the pattern again.
+func (s *Server) compileMatchRegexp(pattern string) (*regexp.Regexp, error) {
+	s.rxmu.Lock()
+	defer s.rxmu.Unlock()
+	if rx, ok := s.rxcache[pattern]; ok {
+		return rx, nil
+	}
+	rx, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if s.rxcache == nil || len(s.rxcache) >= maxMatchRegexps {
+		s.rxcache = make(map[string]*regexp.Regexp)
+	}
+	s.rxcache[pattern] = rx
+	return rx, nil
+}
@@ -1,7 +1,9 @@
 package server
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/tidwall/tile38/core"
@@ -10,6 +12,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
 )
 
 var (
@@ -30,10 +33,14 @@ var (
 		"pointer_size":             prometheus.NewDesc("tile38_pointer_size_bytes", "", nil, nil),
 		"cpus":                     prometheus.NewDesc("tile38_num_cpus", "", nil, nil),
 		"tile38_connected_clients": prometheus.NewDesc("tile38_connected_clients", "", nil, nil),
+		"repl_lag_bytes":           prometheus.NewDesc("tile38_replication_lag_bytes", "Bytes of the leader's AOF that the follower has yet to apply", nil, nil),
 
 		"tile38_total_connections_received": prometheus.NewDesc("tile38_connections_received_total", "", nil, nil),
 		"tile38_total_messages_sent":        prometheus.NewDesc("tile38_messages_sent_total", "", nil, nil),
+		"tile38_total_messages_dropped":     prometheus.NewDesc("tile38_messages_dropped_total", "Webhook messages dropped after running out of retries", nil, nil),
 		"tile38_expired_keys":               prometheus.NewDesc("tile38_expired_keys_total", "", nil, nil),
+		"tile38_expire_backlog":             prometheus.NewDesc("tile38_expire_backlog", "Expired keys waiting to be deleted", nil, nil),
+		"tile38_expire_rate":                prometheus.NewDesc("tile38_expire_rate", "Recent key expirations per second", nil, nil),
 
 		/*
 			these metrics are NOT taken from basicStats() / extStats()
@@ -53,8 +60,29 @@ var (
 		Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.95: 0.005, 0.99: 0.001},
 	}, []string{"cmd"},
 	)
+
+	// the buckets go from 10us to about 2.6s
+	cmdLatencies = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tile38_cmd_latency_seconds",
+		Help:    "Latency of the commands",
+		Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+	}, []string{"cmd"},
+	)
+
+	cmdProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tile38_commands_processed_total",
+		Help: "Number of commands processed",
+	}, []string{"cmd"},
+	)
 )
 
+// observeCommand records the latency of a command.
+func observeCommand(cmd string, took float64) {
+	cmdDurations.With(prometheus.Labels{"cmd": cmd}).Observe(took)
+	cmdLatencies.With(prometheus.Labels{"cmd": cmd}).Observe(took)
+	cmdProcessed.With(prometheus.Labels{"cmd": cmd}).Inc()
+}
+
 func (s *Server) MetricsIndexHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`<html><head>
 <title>Tile38 ` + core.Version + `</title></head>
@@ -63,7 +91,7 @@ func (s *Server) MetricsIndexHandler(w http.ResponseWriter, r *http.Request) {
 </body></html>`))
 }
 
-func (s *Server) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) metricsRegistry() *prometheus.Registry {
 	reg := prometheus.NewRegistry()
 
 	reg.MustRegister(
@@ -71,10 +99,40 @@ func (s *Server) MetricsHandler(w http.ResponseWriter, r *http.Request) {
 		collectors.NewGoCollector(),
 		collectors.NewBuildInfoCollector(),
 		cmdDurations,
+		cmdLatencies,
+		cmdProcessed,
 		s,
 	)
+	return reg
+}
+
+func (s *Server) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	promhttp.HandlerFor(s.metricsRegistry(), promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
 
-	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+// writeHTTPMetrics writes the metrics in the Prometheus text format, as the
+// response to a GET /metrics on the main port when http-metrics is on.
+func (s *Server) writeHTTPMetrics(w io.Writer) error {
+	mfs, err := s.metricsRegistry().Gather()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(&buf, mf); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "HTTP/1.1 200 OK\r\n"+
+		"Connection: close\r\n"+
+		"Content-Length: %d\r\n"+
+		"Content-Type: %s\r\n"+
+		"\r\n", buf.Len(), expfmt.FmtText)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
 }
 
 func (s *Server) Describe(ch chan<- *prometheus.Desc) {
@@ -74,9 +74,9 @@ func (s *Server) sendMonitor(err error, msg *Message, c *Client, lua bool) {
 	// accept all commands except for these:
 	switch strings.ToLower(msg.Command()) {
 	case "config", "config set", "config get", "config rewrite",
-		"auth", "follow", "slaveof", "replconf",
-		"aof", "aofmd5", "client",
-		"monitor":
+		"auth", "follow", "slaveof", "replicaof", "replconf",
+		"aof", "aofmd5", "aofrange", "client",
+		"monitor", "logsubscribe":
 		return
 	}
 
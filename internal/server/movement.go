@@ -0,0 +1,188 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/resp"
+)
+
+// movement holds the previous geometry of an object in a key that keeps
+// previous geometries.
+type movement struct {
+	prev   geojson.Object // geometry prior to the last SET, nil if none
+	prevTs int64          // unix nanoseconds of the previous observation
+	ts     int64          // unix nanoseconds of the current observation
+}
+
+// recordMovements updates the previous geometries for a write. Only SET counts
+// as an observation of an object.
+func (s *Server) recordMovements(d *commandDetails) {
+	if len(s.moves) == 0 {
+		return
+	}
+	if d.parent {
+		for _, d := range d.children {
+			s.recordMovements(d)
+		}
+		return
+	}
+	switch d.command {
+	case "flushdb":
+		for key := range s.moves {
+			s.moves[key] = make(map[string]*movement)
+		}
+		return
+	case "rename":
+		if moves := s.moves[d.key]; moves != nil {
+			delete(s.moves, d.key)
+			s.moves[d.newKey] = moves
+		} else {
+			delete(s.moves, d.newKey)
+		}
+		return
+	}
+	moves := s.moves[d.key]
+	if moves == nil {
+		return
+	}
+	switch d.command {
+	case "drop":
+		s.moves[d.key] = make(map[string]*movement)
+	case "del":
+		if d.obj != nil {
+			delete(moves, d.obj.ID())
+		}
+	case "set":
+		ts := d.timestamp.UnixNano()
+		m := moves[d.obj.ID()]
+		if m == nil {
+			moves[d.obj.ID()] = &movement{ts: ts}
+		} else if d.old != nil {
+			m.prev, m.prevTs, m.ts = d.old.Geo(), m.ts, ts
+		} else {
+			*m = movement{ts: ts}
+		}
+	}
+}
+
+// KEEPPREV key yes|no
+func (s *Server) cmdKEEPPREV(msg *Message) (resp.Value, commandDetails, error) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 3 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	key := args[1]
+	var keep bool
+	switch strings.ToLower(args[2]) {
+	case "yes":
+		keep = true
+	case "no":
+	default:
+		return retwerr(errInvalidArgument(args[2]))
+	}
+
+	// >> Operation
+
+	var d commandDetails
+	if _, ok := s.moves[key]; ok != keep {
+		if keep {
+			s.moves[key] = make(map[string]*movement)
+		} else {
+			delete(s.moves, key)
+		}
+		d.updated = true
+	}
+	d.timestamp = time.Now()
+
+	// >> Response
+
+	return OKMessage(msg, start), d, nil
+}
+
+// MOVEMENT key id
+func (s *Server) cmdMOVEMENT(msg *Message) (resp.Value, error) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 3 {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	key, id := args[1], args[2]
+
+	// >> Operation
+
+	moves, ok := s.moves[key]
+	if !ok {
+		return retrerr(errors.New("previous geometries are not kept for key '" +
+			key + "'"))
+	}
+	col, _ := s.cols.Get(key)
+	if col == nil {
+		return retrerr(errKeyNotFound)
+	}
+	o := col.Get(id)
+	if o == nil {
+		return retrerr(errIDNotFound)
+	}
+	m := moves[id]
+	var meters, bearing, secs float64
+	if m != nil && m.prev != nil {
+		a, b := m.prev.Center(), o.Geo().Center()
+		metric := s.config.distanceMetric()
+		meters = metric.Distance(a.Y, a.X, b.Y, b.X)
+		bearing = metric.Bearing(a.Y, a.X, b.Y, b.X)
+		secs = float64(m.ts-m.prevTs) / float64(time.Second)
+	}
+
+	// >> Response
+
+	switch msg.OutputType {
+	case JSON:
+		var b []byte
+		b = append(b, `{"ok":true,"id":`...)
+		b = appendJSONString(b, id)
+		b = append(b, `,"previous":`...)
+		if m != nil && m.prev != nil {
+			b = m.prev.AppendJSON(b)
+		} else {
+			b = append(b, "null"...)
+		}
+		b = append(b, `,"current":`...)
+		b = o.Geo().AppendJSON(b)
+		if m != nil && m.prev != nil {
+			b = append(b, `,"distance":`...)
+			b = strconv.AppendFloat(b, meters, 'f', -1, 64)
+			b = append(b, `,"bearing":`...)
+			b = strconv.AppendFloat(b, bearing, 'f', -1, 64)
+			b = append(b, `,"seconds":`...)
+			b = strconv.AppendFloat(b, secs, 'f', -1, 64)
+		}
+		b = append(b, `,"elapsed":"`+time.Since(start).String()+`"}`...)
+		return resp.BytesValue(b), nil
+	case RESP:
+		if m == nil || m.prev == nil {
+			return resp.ArrayValue([]resp.Value{
+				resp.NullValue(),
+				resp.StringValue(o.Geo().String()),
+			}), nil
+		}
+		return resp.ArrayValue([]resp.Value{
+			resp.StringValue(m.prev.String()),
+			resp.StringValue(o.Geo().String()),
+			resp.FloatValue(meters),
+			resp.FloatValue(bearing),
+			resp.FloatValue(secs),
+		}), nil
+	}
+	return NOMessage, nil
+}
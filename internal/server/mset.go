@@ -0,0 +1,130 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/geojson/geometry"
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/field"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+// MSET key [SKIPINVALID] id POINT lat lon [id POINT lat lon ...]
+func (s *Server) cmdMSET(msg *Message) (resp.Value, commandDetails, error) {
+	start := time.Now()
+	if s.config.maxMemory() > 0 && s.outOfMemory.Load() {
+		return retwerr(errOOM)
+	}
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) < 2 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	key := args[1]
+	args = args[2:]
+	var skipInvalid bool
+	if len(args)%4 == 1 && strings.ToLower(args[0]) == "skipinvalid" {
+		skipInvalid = true
+		args = args[1:]
+	}
+	if len(args) == 0 || len(args)%4 != 0 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	type msetPoint struct {
+		id  string
+		geo geojson.Object
+	}
+	// All points are parsed before any are stored, so an invalid point
+	// aborts the whole batch.
+	var points []msetPoint
+	var skipped []int
+	for i := 0; i < len(args); i += 4 {
+		var ok bool
+		var lat, lon float64
+		if strings.ToLower(args[i+1]) == "point" {
+			var err1, err2 error
+			lat, err1 = strconv.ParseFloat(args[i+2], 64)
+			lon, err2 = strconv.ParseFloat(args[i+3], 64)
+			ok = err1 == nil && err2 == nil
+		}
+		if !ok {
+			if !skipInvalid {
+				return retwerr(errors.New("invalid point at index " +
+					strconv.Itoa(i/4)))
+			}
+			skipped = append(skipped, i/4)
+			continue
+		}
+		points = append(points, msetPoint{
+			id:  args[i],
+			geo: geojson.NewPoint(geometry.Point{X: lon, Y: lat}),
+		})
+	}
+
+	// >> Operation
+
+	now := time.Now()
+	var d commandDetails
+	if len(points) > 0 {
+		col, ok := s.cols.Get(key)
+		if !ok {
+			col = s.newCollection(key)
+			s.cols.Set(key, col)
+		}
+		for _, p := range points {
+			var flist field.List
+			if old := col.Get(p.id); old != nil {
+				flist = old.Fields()
+			} else {
+				// only new objects get the default fields of the key
+				flist = s.defaults[key]
+			}
+			obj := object.New(p.id, s.dedupGeometry(key, p.geo), 0, flist)
+			old := col.Set(obj)
+			d.children = append(d.children, &commandDetails{
+				command:   "set",
+				updated:   true,
+				timestamp: now,
+				key:       key,
+				obj:       obj,
+				old:       old,
+			})
+		}
+	}
+	d.command = "mset"
+	d.key = key
+	d.updated = len(d.children) > 0
+	d.timestamp = now
+	d.parent = true
+
+	// >> Response
+
+	var res resp.Value
+	switch msg.OutputType {
+	case JSON:
+		var buf strings.Builder
+		buf.WriteString(`{"ok":true,"count":`)
+		buf.WriteString(strconv.Itoa(len(d.children)))
+		if len(skipped) > 0 {
+			buf.WriteString(`,"skipped":[`)
+			for i, idx := range skipped {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				buf.WriteString(strconv.Itoa(idx))
+			}
+			buf.WriteByte(']')
+		}
+		buf.WriteString(`,"elapsed":"` + time.Since(start).String() + "\"}")
+		res = resp.StringValue(buf.String())
+	case RESP:
+		res = resp.IntegerValue(len(d.children))
+	}
+	return res, d, nil
+}
@@ -0,0 +1,425 @@
+package server
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/geojson/geometry"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/tile38/internal/clip"
+	"github.com/tidwall/tile38/internal/field"
+)
+
+const (
+	// maxMVTZoom is the deepest zoom level that MVT accepts.
+	maxMVTZoom = 30
+	// mvtExtent is the width and height of a tile in tile coordinates.
+	mvtExtent = 4096
+	// mvtBuffer is how far past the edges of a tile, in tile coordinates,
+	// the geometries are kept. Lines and polygons of neighbouring tiles then
+	// join without seams.
+	mvtBuffer = 64
+	// mvtContentType is the content type of a tile over HTTP.
+	mvtContentType = "application/vnd.mapbox-vector-tile"
+)
+
+// mvtTile is a tile coordinate for the MVT output.
+type mvtTile struct {
+	z, x, y int
+}
+
+// parseMVTTile parses the z, x, and y of a tile coordinate.
+func parseMVTTile(sz, sx, sy string) (mvtTile, error) {
+	var t mvtTile
+	z, err := strconv.ParseUint(sz, 10, 64)
+	if err != nil || z > maxMVTZoom {
+		return t, errInvalidArgument(sz)
+	}
+	x, err := strconv.ParseUint(sx, 10, 64)
+	if err != nil || x >= 1<<z {
+		return t, errInvalidArgument(sx)
+	}
+	y, err := strconv.ParseUint(sy, 10, 64)
+	if err != nil || y >= 1<<z {
+		return t, errInvalidArgument(sy)
+	}
+	return mvtTile{z: int(z), x: int(x), y: int(y)}, nil
+}
+
+// rect returns the area of the tile in longitude and latitude, grown by a
+// number of tile coordinates on each side.
+func (t mvtTile) rect(buffer float64) geometry.Rect {
+	n := float64(uint64(1) << t.z)
+	b := buffer / mvtExtent
+	lon := func(x float64) float64 {
+		return math.Max(-180, math.Min(180, x/n*360-180))
+	}
+	lat := func(y float64) float64 {
+		y = math.Max(0, math.Min(n, y))
+		return math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180 / math.Pi
+	}
+	return geometry.Rect{
+		Min: geometry.Point{
+			X: lon(float64(t.x) - b), Y: lat(float64(t.y+1) + b),
+		},
+		Max: geometry.Point{
+			X: lon(float64(t.x+1) + b), Y: lat(float64(t.y) - b),
+		},
+	}
+}
+
+// project returns the tile coordinates of a web mercator point.
+func (t mvtTile) project(p geometry.Point) (int64, int64) {
+	n := float64(uint64(1) << t.z)
+	lat := math.Max(-85.0511287798, math.Min(85.0511287798, p.Y))
+	sin := math.Sin(lat * math.Pi / 180)
+	x := ((p.X+180)/360*n - float64(t.x)) * mvtExtent
+	y := ((0.5-math.Log((1+sin)/(1-sin))/(4*math.Pi))*n - float64(t.y)) *
+		mvtExtent
+	return int64(math.Round(x)), int64(math.Round(y))
+}
+
+// mvtLayer collects the objects of a MVT output into a single layer, which
+// is named after the key.
+type mvtLayer struct {
+	tile     mvtTile
+	area     *geojson.Rect // the tile and its buffer
+	name     string
+	keys     []string
+	keyIdx   map[string]uint32
+	values   []string // encoded Value messages
+	valIdx   map[string]uint32
+	features [][]byte
+}
+
+// newMVTLayer returns the layer for the MVT output, or nil if there's none.
+func newMVTLayer(t searchScanBaseTokens) *mvtLayer {
+	if t.output != outputMVT {
+		return nil
+	}
+	return &mvtLayer{
+		tile:   t.tile,
+		area:   geojson.NewRect(t.tile.rect(mvtBuffer)),
+		name:   t.key,
+		keyIdx: make(map[string]uint32),
+		valIdx: make(map[string]uint32),
+	}
+}
+
+// touches returns true when an object has something to draw on the tile.
+func (l *mvtLayer) touches(g geojson.Object) bool {
+	return objIsSpatial(g) && g.Intersects(l.area)
+}
+
+// add adds an object to the layer. Each kind of geometry in the object,
+// after it's clipped to the tile, is a feature with the id and the fields of
+// the object as the properties.
+func (l *mvtLayer) add(opts ScanWriterParams, withFields bool,
+	iopts *geometry.IndexOptions,
+) {
+	var points []geometry.Point
+	var lines [][]geometry.Point
+	var polys [][][]geometry.Point
+	seriesPoints := func(series geometry.Series) []geometry.Point {
+		pts := make([]geometry.Point, series.NumPoints())
+		for i := range pts {
+			pts[i] = series.PointAt(i)
+		}
+		return pts
+	}
+	var walk func(g geojson.Object)
+	walk = func(g geojson.Object) {
+		switch g := g.(type) {
+		case *geojson.Point, *geojson.SimplePoint:
+			if g.Intersects(l.area) {
+				points = append(points, g.Center())
+			}
+		case *geojson.LineString:
+			lines = append(lines, seriesPoints(g.Base()))
+		case *geojson.Polygon:
+			if g.Empty() {
+				return
+			}
+			poly := g.Base()
+			rings := [][]geometry.Point{seriesPoints(poly.Exterior)}
+			for _, hole := range poly.Holes {
+				rings = append(rings, seriesPoints(hole))
+			}
+			polys = append(polys, rings)
+		case *geojson.Rect:
+			walk(clip.Clip(geojson.NewPolygon(&geometry.Poly{
+				Exterior: g.Base(),
+			}), l.area, iopts))
+		case *geojson.Circle:
+			walk(clip.Clip(g.Polygon(), l.area, iopts))
+		case *geojson.Feature:
+			walk(g.Base())
+		case geojson.Collection:
+			for _, child := range g.Children() {
+				walk(child)
+			}
+		}
+	}
+	walk(clip.Clip(opts.obj.Geo(), l.area, iopts))
+
+	var tags []uint32
+	if len(points) > 0 || len(lines) > 0 || len(polys) > 0 {
+		tags = l.appendTag(tags, "id", mvtStringValue(opts.obj.ID()))
+		if f, ok := opts.obj.Geo().(*geojson.Feature); ok {
+			gjson.Get(f.Members(), "properties").ForEach(
+				func(key, val gjson.Result) bool {
+					if v, ok := mvtJSONValue(val); ok && key.String() != "id" {
+						tags = l.appendTag(tags, key.String(), v)
+					}
+					return true
+				},
+			)
+		}
+		if withFields {
+			opts.obj.Fields().Scan(func(f field.Field) bool {
+				if !f.Value().IsZero() && f.Name() != "id" {
+					tags = l.appendTag(tags, f.Name(), mvtFieldValue(f.Value()))
+				}
+				return true
+			})
+		}
+	}
+	if len(points) > 0 {
+		var g mvtGeometry
+		g.appendPoints(l.tile, points)
+		l.appendFeature(1, tags, g.cmds)
+	}
+	if len(lines) > 0 {
+		var g mvtGeometry
+		for _, line := range lines {
+			g.appendLine(l.tile, line)
+		}
+		if len(g.cmds) > 0 {
+			l.appendFeature(2, tags, g.cmds)
+		}
+	}
+	if len(polys) > 0 {
+		var g mvtGeometry
+		for _, rings := range polys {
+			g.appendPolygon(l.tile, rings)
+		}
+		if len(g.cmds) > 0 {
+			l.appendFeature(3, tags, g.cmds)
+		}
+	}
+}
+
+// appendTag appends the key and value indexes of a property to the tags of
+// a feature. The keys and the values are shared by all features.
+func (l *mvtLayer) appendTag(tags []uint32, key, value string) []uint32 {
+	ki, ok := l.keyIdx[key]
+	if !ok {
+		ki = uint32(len(l.keys))
+		l.keyIdx[key] = ki
+		l.keys = append(l.keys, key)
+	}
+	vi, ok := l.valIdx[value]
+	if !ok {
+		vi = uint32(len(l.values))
+		l.valIdx[value] = vi
+		l.values = append(l.values, value)
+	}
+	return append(tags, ki, vi)
+}
+
+func (l *mvtLayer) appendFeature(gtype uint64, tags, cmds []uint32) {
+	var b []byte
+	b = pbAppendPacked(b, 2, tags)
+	b = pbAppendVarint(pbAppendKey(b, 3, 0), gtype)
+	b = pbAppendPacked(b, 4, cmds)
+	l.features = append(l.features, b)
+}
+
+// appendTile appends the protobuf encoded tile, with the layer as the only
+// layer.
+func (l *mvtLayer) appendTile(dst []byte) []byte {
+	var b []byte
+	b = pbAppendVarint(pbAppendKey(b, 15, 0), 2) // version
+	b = pbAppendBytes(b, 1, []byte(l.name))
+	for _, f := range l.features {
+		b = pbAppendBytes(b, 2, f)
+	}
+	for _, k := range l.keys {
+		b = pbAppendBytes(b, 3, []byte(k))
+	}
+	for _, v := range l.values {
+		b = pbAppendBytes(b, 4, []byte(v))
+	}
+	b = pbAppendVarint(pbAppendKey(b, 5, 0), mvtExtent)
+	return pbAppendBytes(dst, 3, b)
+}
+
+// mvtGeometry is the command stream of a feature geometry. The positions are
+// relative to the cursor, which is the last position.
+type mvtGeometry struct {
+	cmds   []uint32
+	cx, cy int64
+}
+
+func (g *mvtGeometry) appendCommand(id, count int) {
+	g.cmds = append(g.cmds, uint32(id&7|count<<3))
+}
+
+func (g *mvtGeometry) appendPosition(x, y int64) {
+	g.cmds = append(g.cmds, pbZigZag(x-g.cx), pbZigZag(y-g.cy))
+	g.cx, g.cy = x, y
+}
+
+// positions projects points onto the tile and drops the repeated positions.
+func (g *mvtGeometry) positions(tile mvtTile, pts []geometry.Point) [][2]int64 {
+	var ps [][2]int64
+	for _, pt := range pts {
+		x, y := tile.project(pt)
+		if len(ps) == 0 || ps[len(ps)-1] != [2]int64{x, y} {
+			ps = append(ps, [2]int64{x, y})
+		}
+	}
+	return ps
+}
+
+func (g *mvtGeometry) appendPoints(tile mvtTile, pts []geometry.Point) {
+	g.appendCommand(1, len(pts)) // MoveTo
+	for _, pt := range pts {
+		g.appendPosition(tile.project(pt))
+	}
+}
+
+func (g *mvtGeometry) appendLine(tile mvtTile, pts []geometry.Point) {
+	ps := g.positions(tile, pts)
+	if len(ps) < 2 {
+		return
+	}
+	g.appendCommand(1, 1) // MoveTo
+	g.appendPosition(ps[0][0], ps[0][1])
+	g.appendCommand(2, len(ps)-1) // LineTo
+	for _, p := range ps[1:] {
+		g.appendPosition(p[0], p[1])
+	}
+}
+
+// appendPolygon appends the rings of a polygon. The exterior ring winds
+// clockwise on the tile, which is a positive area with the y axis pointing
+// down, and the holes wind the other way.
+func (g *mvtGeometry) appendPolygon(tile mvtTile, rings [][]geometry.Point) {
+	for i, ring := range rings {
+		ps := g.positions(tile, ring)
+		if len(ps) > 1 && ps[0] == ps[len(ps)-1] {
+			ps = ps[:len(ps)-1]
+		}
+		var area int64
+		for j := range ps {
+			a, b := ps[j], ps[(j+1)%len(ps)]
+			area += a[0]*b[1] - b[0]*a[1]
+		}
+		if len(ps) < 3 || area == 0 {
+			if i == 0 {
+				return // nothing is left of the exterior
+			}
+			continue
+		}
+		if (i == 0) != (area > 0) {
+			for j, k := 0, len(ps)-1; j < k; j, k = j+1, k-1 {
+				ps[j], ps[k] = ps[k], ps[j]
+			}
+		}
+		g.appendCommand(1, 1) // MoveTo
+		g.appendPosition(ps[0][0], ps[0][1])
+		g.appendCommand(2, len(ps)-1) // LineTo
+		for _, p := range ps[1:] {
+			g.appendPosition(p[0], p[1])
+		}
+		g.appendCommand(7, 1) // ClosePath
+	}
+}
+
+// mvtStringValue returns an encoded Value message of a string.
+func mvtStringValue(s string) string {
+	return string(pbAppendBytes(nil, 1, []byte(s)))
+}
+
+// mvtNumberValue returns an encoded Value message of a number, which is a
+// sint_value for whole numbers and a double_value otherwise.
+func mvtNumberValue(n float64) string {
+	if n == math.Trunc(n) && math.Abs(n) < 1<<53 {
+		return string(pbAppendVarint(pbAppendKey(nil, 6, 0),
+			uint64(int64(n)<<1^int64(n)>>63)))
+	}
+	b := pbAppendKey(nil, 3, 1)
+	bits := math.Float64bits(n)
+	for i := 0; i < 8; i++ {
+		b = append(b, byte(bits>>(8*i)))
+	}
+	return string(b)
+}
+
+// mvtBoolValue returns an encoded Value message of a boolean.
+func mvtBoolValue(t bool) string {
+	var v uint64
+	if t {
+		v = 1
+	}
+	return string(pbAppendVarint(pbAppendKey(nil, 7, 0), v))
+}
+
+func mvtFieldValue(v field.Value) string {
+	switch v.Kind() {
+	case field.Number:
+		return mvtNumberValue(v.Num())
+	case field.True, field.False:
+		return mvtBoolValue(v.Kind() == field.True)
+	default:
+		return mvtStringValue(v.Data())
+	}
+}
+
+// mvtJSONValue returns the encoded Value message of a GeoJSON property. Null
+// properties are left out.
+func mvtJSONValue(v gjson.Result) (string, bool) {
+	switch v.Type {
+	case gjson.Null:
+		return "", false
+	case gjson.Number:
+		return mvtNumberValue(v.Num), true
+	case gjson.True, gjson.False:
+		return mvtBoolValue(v.Bool()), true
+	case gjson.String:
+		return mvtStringValue(v.Str), true
+	default:
+		return mvtStringValue(v.Raw), true
+	}
+}
+
+func pbZigZag(n int64) uint32 {
+	return uint32((n << 1) ^ (n >> 63))
+}
+
+func pbAppendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func pbAppendKey(b []byte, num int, wire uint64) []byte {
+	return pbAppendVarint(b, uint64(num)<<3|wire)
+}
+
+func pbAppendBytes(b []byte, num int, data []byte) []byte {
+	b = pbAppendVarint(pbAppendKey(b, num, 2), uint64(len(data)))
+	return append(b, data...)
+}
+
+func pbAppendPacked(b []byte, num int, vals []uint32) []byte {
+	var data []byte
+	for _, v := range vals {
+		data = pbAppendVarint(data, uint64(v))
+	}
+	return pbAppendBytes(b, num, data)
+}
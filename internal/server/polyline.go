@@ -0,0 +1,36 @@
+package server
+
+import (
+	"math"
+
+	"github.com/tidwall/geojson/geometry"
+)
+
+// appendPolyline appends a line using the encoded polyline algorithm, where
+// each latitude and longitude is rounded to precision decimal places and
+// written as the difference from the previous point.
+func appendPolyline(dst []byte, line *geometry.Line, precision int) []byte {
+	factor := math.Pow10(precision)
+	var plat, plng int64
+	for i := 0; i < line.NumPoints(); i++ {
+		pt := line.PointAt(i)
+		lat := int64(math.Round(pt.Y * factor))
+		lng := int64(math.Round(pt.X * factor))
+		dst = appendPolylineValue(dst, lat-plat)
+		dst = appendPolylineValue(dst, lng-plng)
+		plat, plng = lat, lng
+	}
+	return dst
+}
+
+func appendPolylineValue(dst []byte, v int64) []byte {
+	u := uint64(v) << 1
+	if v < 0 {
+		u = ^u
+	}
+	for u >= 0x20 {
+		dst = append(dst, byte(0x20|u&0x1f)+63)
+		u >>= 5
+	}
+	return append(dst, byte(u)+63)
+}
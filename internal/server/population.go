@@ -0,0 +1,133 @@
+package server
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tidwall/tile38/internal/log"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+// populationState holds the last count for a hook that was created with the
+// POPULATION option.
+type populationState struct {
+	next    time.Time // when the fence is counted next
+	count   int       // last count
+	counted bool      // the fence has been counted at least once
+}
+
+// backgroundPopulations counts the objects inside of population fences and
+// sends the counts to the hooks. The write lock is only taken when there are
+// population hooks.
+func (s *Server) backgroundPopulations(wg *sync.WaitGroup) {
+	defer wg.Done()
+	s.loopUntilServerStops(bgExpireDelay, func() {
+		s.mu.RLock()
+		n := s.hooksPop.Len()
+		s.mu.RUnlock()
+		if n == 0 {
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.sendPopulations(time.Now()); err != nil {
+			log.Errorf("population: %v", err)
+		}
+	})
+}
+
+func (s *Server) sendPopulations(now time.Time) error {
+	var cmsgs, wmsgs []string
+	var whooks, hooks []*Hook
+	s.hooksPop.Ascend(nil, func(v interface{}) bool {
+		hook := v.(*Hook)
+		if !now.Before(hook.population.next) {
+			hooks = append(hooks, hook)
+		}
+		return true
+	})
+	s.sortHooks(hooks)
+	for _, hook := range hooks {
+		hook.population.next = now.Add(hook.Fence.population)
+		msgs := s.populationMsgs(hook, s.fenceCount(hook), now)
+		if len(msgs) > 0 {
+			if hook.channel {
+				cmsgs = append(cmsgs, msgs...)
+			} else {
+				wmsgs = append(wmsgs, msgs...)
+				whooks = append(whooks, hook)
+			}
+		}
+	}
+	return s.sendHookMsgs(cmsgs, wmsgs, whooks)
+}
+
+// fenceCount returns the number of objects that match a hook's fence.
+func (s *Server) fenceCount(hook *Hook) int {
+	col, _ := s.cols.Get(hook.Key)
+	if col == nil {
+		return 0
+	}
+	var count int
+	col.Intersects(hook.Fence.obj, 0, nil, nil, func(o *object.Object) bool {
+		if !fenceMatchObject(hook.Fence, o) {
+			return true
+		}
+		ok, _, err := hook.ScanWriter.testObject(o)
+		if err == nil && ok {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// populationMsgs returns the messages for a new count. Without thresholds
+// every count is sent, otherwise a message is sent for each threshold that
+// the count crossed since the last time the fence was counted.
+func (s *Server) populationMsgs(hook *Hook, count int, now time.Time,
+) []string {
+	prev, counted := hook.population.count, hook.population.counted
+	hook.population.count = count
+	hook.population.counted = true
+	if hook.Fence.thresholds == nil {
+		return []string{populationMsg(hook, count, now, -1, "")}
+	}
+	if !counted {
+		return nil
+	}
+	var msgs []string
+	for _, threshold := range hook.Fence.thresholds {
+		if prev < threshold && count >= threshold {
+			msgs = append(msgs,
+				populationMsg(hook, count, now, threshold, "above"))
+		} else if prev >= threshold && count < threshold {
+			msgs = append(msgs,
+				populationMsg(hook, count, now, threshold, "below"))
+		}
+	}
+	return msgs
+}
+
+func populationMsg(hook *Hook, count int, now time.Time, threshold int,
+	crossed string,
+) string {
+	var b []byte
+	b = append(b, `{"command":"population"`...)
+	b = appendHookDetails(b, hook.Name, hook.Metas)
+	b = append(b, `,"key":`...)
+	b = appendJSONString(b, hook.Key)
+	b = append(b, `,"time":`...)
+	b = appendJSONTimeFormat(b, now)
+	b = append(b, `,"count":`...)
+	b = strconv.AppendInt(b, int64(count), 10)
+	if crossed != "" {
+		b = append(b, `,"threshold":`...)
+		b = strconv.AppendInt(b, int64(threshold), 10)
+		b = append(b, `,"crossed":`...)
+		b = appendJSONString(b, crossed)
+	}
+	b = append(b, '}')
+	return string(b)
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/log"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+// preExpiring is an object that is within the pre-expire lead time of its
+// expiration.
+type preExpiring struct {
+	key string
+	obj *object.Object
+}
+
+// preExpireCursor is the position, in order of expiration, of the last object
+// of a key that a "preexpire" notification was sent for.
+type preExpireCursor struct {
+	expires int64
+	id      string
+}
+
+// before returns true when the object comes at or before the cursor.
+func (cur preExpireCursor) before(o *object.Object) bool {
+	return o.Expires() < cur.expires ||
+		(o.Expires() == cur.expires && o.ID() <= cur.id)
+}
+
+// notifyPreExpiring sends a "preexpire" notification for each object, and
+// moves the cursor of its key past it. The objects are in order of their
+// expiration.
+func (s *Server) notifyPreExpiring(objs []preExpiring, now time.Time) {
+	for _, pe := range objs {
+		s.preexpd[pe.key] = preExpireCursor{pe.obj.Expires(), pe.obj.ID()}
+		s.sendPreExpire(pe.key, pe.obj, now)
+	}
+}
+
+func (s *Server) sendPreExpire(key string, obj *object.Object, now time.Time) {
+	d := &commandDetails{
+		command:   "preexpire",
+		key:       key,
+		obj:       obj,
+		timestamp: now,
+	}
+	if err := s.notifyFences(d); err != nil {
+		log.Error(err)
+	}
+}
+
+// recordPreExpire sends the "preexpire" notification for an object that is
+// given an expiration that the cursor of its key has already passed, because
+// the expire ticks only look at the objects that come after the cursor.
+func (s *Server) recordPreExpire(d *commandDetails) {
+	if len(s.preexpd) == 0 {
+		return
+	}
+	if d.parent {
+		for _, d := range d.children {
+			s.recordPreExpire(d)
+		}
+		return
+	}
+	switch d.command {
+	case "set", "expire":
+	default:
+		return
+	}
+	cur, ok := s.preexpd[d.key]
+	if !ok || d.obj == nil || d.obj.Expires() == 0 || !cur.before(d.obj) {
+		return
+	}
+	if d.obj.Expires() > d.timestamp.UnixNano() {
+		s.sendPreExpire(d.key, d.obj, d.timestamp)
+	}
+}
+
+// PREEXPIRE key seconds
+func (s *Server) cmdPREEXPIRE(msg *Message) (resp.Value, commandDetails,
+	error,
+) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 3 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	key := args[1]
+	secs, err := strconv.ParseFloat(args[2], 64)
+	if err != nil || secs < 0 {
+		return retwerr(errInvalidArgument(args[2]))
+	}
+	lead := time.Duration(secs * float64(time.Second))
+
+	// >> Operation
+
+	// A lead time of zero turns the notifications off.
+	var d commandDetails
+	if old, ok := s.preexps[key]; lead > 0 && (!ok || old != lead) {
+		s.preexps[key] = lead
+		d.updated = true
+	} else if lead == 0 && ok {
+		delete(s.preexps, key)
+		delete(s.preexpd, key)
+		d.updated = true
+	}
+	d.timestamp = time.Now()
+
+	// >> Response
+
+	return OKMessage(msg, start), d, nil
+}
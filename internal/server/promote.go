@@ -0,0 +1,78 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/log"
+)
+
+var errNotFollower = errors.New("not a follower")
+var errNeverCaughtUp = errors.New("follower was never caught up, use FORCE to promote anyway")
+
+// PROMOTE [FORCE] [KEEPID]
+func (s *Server) cmdPROMOTE(msg *Message) (resp.Value, error) {
+	start := time.Now()
+
+	// >> Args
+
+	var force, keepID bool
+	for _, arg := range msg.Args[1:] {
+		switch strings.ToLower(arg) {
+		case "force":
+			force = true
+		case "keepid":
+			keepID = true
+		default:
+			return retrerr(errInvalidArgument(arg))
+		}
+	}
+
+	// >> Operation
+
+	if s.config.followHost() == "" {
+		return retrerr(errNotFollower)
+	}
+	if !s.fcuponce && !force {
+		return retrerr(errNeverCaughtUp)
+	}
+
+	// Stop following. The follow routine checks the counter while holding
+	// the server lock, so no more leader commands are applied after this.
+	s.config.setFollowHost("")
+	s.config.setFollowPort(0)
+	s.config.setFollowUpstreams(nil)
+	s.config.setFollowTLS(false)
+	s.config.setFollowID("")
+	s.followc.Add(1)
+	s.fups = nil
+
+	if s.aof != nil {
+		s.flushAOF(false)
+		if err := s.aof.Sync(); err != nil {
+			return retrerr(err)
+		}
+	}
+	if !keepID {
+		s.config.setServerID(randomKey(16))
+	}
+	s.config.setReadOnly(false)
+	s.config.write(false)
+	log.Infof("promoted to leader at aof offset %d", s.aofsz)
+
+	// >> Response
+
+	switch msg.OutputType {
+	case JSON:
+		return resp.StringValue(`{"ok":true,"id":` +
+			jsonString(s.config.serverID()) + `,"aof_size":` +
+			strconv.Itoa(s.aofsz) + `,"elapsed":"` +
+			time.Since(start).String() + "\"}"), nil
+	case RESP:
+		return resp.IntegerValue(s.aofsz), nil
+	}
+	return NOMessage, nil
+}
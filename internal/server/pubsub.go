@@ -3,7 +3,9 @@ package server
 import (
 	"io"
 	"net"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -35,6 +37,19 @@ func newPubsub() *pubsub {
 
 // Publish a message to subscribers
 func (s *Server) Publish(channel string, message ...string) int {
+	n := s.publishLocal(channel, message...)
+
+	// Broadcast to followers
+	if s.config.replicatePublish() && s.config.followHost() == "" {
+		// Relayed through the follow stream by the caller
+		return n
+	}
+	s.sendPublishQueue(channel, message...)
+	return n
+}
+
+// publishLocal publishes a message to the subscribers of this server only.
+func (s *Server) publishLocal(channel string, message ...string) int {
 	var msgs []submsg
 	s.pubsub.mu.RLock()
 	if hub := s.pubsub.hubs[pubsubChannel][channel]; hub != nil {
@@ -73,13 +88,25 @@ func (s *Server) Publish(channel string, message ...string) int {
 		msg.target.cond.Broadcast()
 		msg.target.cond.L.Unlock()
 	}
-
-	// Broadcast to followers
-	s.sendPublishQueue(channel, message...)
-
 	return len(msgs)
 }
 
+// relayPublish writes PUBLISH commands to the AOF, which sends the messages
+// to the followers through the follow stream. Used when replicate-publish
+// is on. The caller must hold the server lock.
+func (s *Server) relayPublish(channel string, message ...string) error {
+	if !s.config.replicatePublish() || s.config.followHost() != "" {
+		return nil
+	}
+	for _, message := range message {
+		err := s.writeAOF([]string{"PUBLISH", channel, message}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (ps *pubsub) register(kind int, channel string, target *subtarget) {
 	ps.mu.Lock()
 	hub, ok := ps.hubs[kind][channel]
@@ -165,6 +192,12 @@ func (s *Server) cmdPublish(msg *Message) (resp.Value, error) {
 	message := msg.Args[2]
 	//geofence := gjson.Valid(message) && gjson.Get(message, "fence").Bool()
 	n := s.Publish(channel, message) //, geofence)
+	s.mu.Lock()
+	err := s.relayPublish(channel, message)
+	s.mu.Unlock()
+	if err != nil {
+		return resp.Value{}, err
+	}
 	var res resp.Value
 	switch msg.OutputType {
 	case JSON:
@@ -177,6 +210,110 @@ func (s *Server) cmdPublish(msg *Message) (resp.Value, error) {
 	return res, nil
 }
 
+// PUBSUB CHANNELS [pattern]
+// PUBSUB NUMSUB [channel ...]
+// PUBSUB NUMPAT
+func (s *Server) cmdPubsub(msg *Message) (resp.Value, error) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) < 2 {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+	sub := strings.ToLower(args[1])
+	switch sub {
+	case "channels":
+		if len(args) > 3 {
+			return retrerr(errInvalidNumberOfArguments)
+		}
+	case "numsub":
+	case "numpat":
+		if len(args) != 2 {
+			return retrerr(errInvalidNumberOfArguments)
+		}
+	default:
+		return retrerr(errInvalidArgument(args[1]))
+	}
+
+	// >> Operation
+
+	var channels []string
+	var counts []int
+	var numpat int
+	s.pubsub.mu.RLock()
+	switch sub {
+	case "channels":
+		pattern := "*"
+		if len(args) == 3 {
+			pattern = args[2]
+		}
+		for channel := range s.pubsub.hubs[pubsubChannel] {
+			if match.Match(channel, pattern) {
+				channels = append(channels, channel)
+			}
+		}
+		sort.Strings(channels)
+	case "numsub":
+		channels = args[2:]
+		for _, channel := range channels {
+			var n int
+			if hub := s.pubsub.hubs[pubsubChannel][channel]; hub != nil {
+				n = len(hub.targets)
+			}
+			counts = append(counts, n)
+		}
+	case "numpat":
+		numpat = len(s.pubsub.hubs[pubsubPattern])
+	}
+	s.pubsub.mu.RUnlock()
+
+	// >> Response
+
+	switch msg.OutputType {
+	case JSON:
+		var b []byte
+		b = append(b, `{"ok":true`...)
+		switch sub {
+		case "channels":
+			b = append(b, `,"channels":`...)
+			b = appendJSONStrings(b, channels)
+		case "numsub":
+			b = append(b, `,"numsub":{`...)
+			for i, channel := range channels {
+				if i > 0 {
+					b = append(b, ',')
+				}
+				b = appendJSONString(b, channel)
+				b = append(b, ':')
+				b = strconv.AppendInt(b, int64(counts[i]), 10)
+			}
+			b = append(b, '}')
+		case "numpat":
+			b = append(b, `,"numpat":`...)
+			b = strconv.AppendInt(b, int64(numpat), 10)
+		}
+		b = append(b, `,"elapsed":"`+time.Since(start).String()+`"}`...)
+		return resp.BytesValue(b), nil
+	case RESP:
+		switch sub {
+		case "channels":
+			return respStrings(channels), nil
+		case "numsub":
+			vals := make([]resp.Value, 0, len(channels)*2)
+			for i, channel := range channels {
+				vals = append(vals, resp.StringValue(channel),
+					resp.IntegerValue(counts[i]))
+			}
+			return resp.ArrayValue(vals), nil
+		case "numpat":
+			return resp.IntegerValue(numpat), nil
+		}
+	}
+	return NOMessage, nil
+}
+
 func (s *Server) liveSubscription(
 	conn net.Conn,
 	rd *PipelineReader,
@@ -7,6 +7,13 @@ import (
 	"github.com/tidwall/tile38/internal/log"
 )
 
+// readOnlyFollower returns true when the server follows a leader and does not
+// take writes from clients, which is the default. Writes from the leader come
+// through followHandleCommand instead.
+func (s *Server) readOnlyFollower() bool {
+	return s.config.followHost() != "" && s.config.followerReadOnly()
+}
+
 // READONLY yes|no
 func (s *Server) cmdREADONLY(msg *Message) (resp.Value, error) {
 	start := time.Now()
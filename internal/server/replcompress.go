@@ -0,0 +1,57 @@
+package server
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/klauspost/compress/s2"
+)
+
+var errUnsupportedCompression = errors.New("unsupported compression")
+
+// replCompressWriter compresses the aof stream to a follower. Flush is called
+// whenever the leader has nothing more to send, so that the follower isn't
+// kept waiting for a full block.
+type replCompressWriter interface {
+	io.Writer
+	Flush() error
+}
+
+// validReplCompression returns true for the compressions of the aof stream
+// that a leader supports.
+func validReplCompression(codec string) bool {
+	return codec == "gzip" || codec == "snappy"
+}
+
+func newReplCompressWriter(codec string, w io.Writer) replCompressWriter {
+	if codec == "snappy" {
+		return s2.NewWriter(w, s2.WriterSnappyCompat())
+	}
+	return gzip.NewWriter(w)
+}
+
+func newReplCompressReader(codec string, r io.Reader) (io.Reader, error) {
+	if codec == "snappy" {
+		return s2.NewReader(r), nil
+	}
+	return gzip.NewReader(r)
+}
+
+// replCompression returns the compression that a follower asked for, with
+// REPLCONF, on the connection. Empty for none.
+func (s *Server) replCompression(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	s.connsmu.RLock()
+	defer s.connsmu.RUnlock()
+	for _, c := range s.conns {
+		if c.remoteAddr == addr {
+			c.mu.Lock()
+			codec := c.replCodec
+			c.mu.Unlock()
+			return codec
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/tile38/internal/log"
+)
+
+// parseReplTokens parses the replication-tokens config, which is a comma
+// separated list of name:token pairs. The names and tokens must be unique.
+func parseReplTokens(value string) (map[string]string, bool) {
+	if strings.TrimSpace(value) == "" {
+		return nil, true
+	}
+	tokens := make(map[string]string)
+	names := make(map[string]bool)
+	for _, pair := range strings.Split(value, ",") {
+		name, token, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || name == "" || token == "" || names[name] {
+			return nil, false
+		}
+		if _, ok := tokens[token]; ok {
+			return nil, false
+		}
+		tokens[token] = name
+		names[name] = true
+	}
+	return tokens, true
+}
+
+// formatReplTokens returns the replication-tokens config, ordered by name.
+func formatReplTokens(tokens map[string]string) string {
+	pairs := make([]string, 0, len(tokens))
+	for token, name := range tokens {
+		pairs = append(pairs, name+":"+token)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// authReplToken authenticates a client with one of the replication-tokens,
+// which lets each follower have its own password that can be revoked without
+// changing the password of the others.
+func (s *Server) authReplToken(client *Client, token string) bool {
+	name, ok := s.config.replicationToken(token)
+	if !ok {
+		return false
+	}
+	client.mu.Lock()
+	client.replToken = token
+	client.mu.Unlock()
+	log.Infof("follower %s authenticated with replication token '%s'",
+		client.remoteAddr, name)
+	return true
+}
+
+// closeRevokedReplTokens closes the connections that authenticated with a
+// token that was removed from the replication-tokens. The followers can't
+// authenticate when they reconnect.
+func (s *Server) closeRevokedReplTokens() {
+	var closing []io.Closer
+	s.connsmu.RLock()
+	for _, cc := range s.conns {
+		cc.mu.Lock()
+		token := cc.replToken
+		cc.mu.Unlock()
+		if token == "" || cc.closer == nil {
+			continue
+		}
+		if _, ok := s.config.replicationToken(token); !ok {
+			closing = append(closing, cc.closer)
+		}
+	}
+	s.connsmu.RUnlock()
+	for _, closer := range closing {
+		closer.Close()
+	}
+}
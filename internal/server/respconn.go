@@ -1,6 +1,9 @@
 package server
 
 import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
 	"net"
 	"time"
 
@@ -10,6 +13,7 @@ import (
 // RESPConn represents a simple resp connection.
 type RESPConn struct {
 	conn net.Conn
+	br   *bufio.Reader
 	rd   *resp.Reader
 	wr   *resp.Writer
 }
@@ -20,12 +24,47 @@ func DialTimeout(address string, timeout time.Duration) (*RESPConn, error) {
 	if err != nil {
 		return nil, err
 	}
-	conn := &RESPConn{
-		conn: tcpconn,
-		rd:   resp.NewReader(tcpconn),
-		wr:   resp.NewWriter(tcpconn),
+	return newRESPConn(tcpconn), nil
+}
+
+// DialTLSTimeout dials a resp over tls. The handshake must finish within the
+// timeout.
+func DialTLSTimeout(address string, timeout time.Duration, config *tls.Config,
+) (*RESPConn, error) {
+	tcpconn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	tlsconn := tls.Client(tcpconn, config)
+	tlsconn.SetDeadline(time.Now().Add(timeout))
+	if err := tlsconn.Handshake(); err != nil {
+		tcpconn.Close()
+		return nil, fmt.Errorf("tls handshake failed: %v", err)
+	}
+	tlsconn.SetDeadline(time.Time{})
+	return newRESPConn(tlsconn), nil
+}
+
+func newRESPConn(conn net.Conn) *RESPConn {
+	// The resp reader reads through br, which is kept so that a compressed
+	// stream can pick up from where the reader left off.
+	br := bufio.NewReader(conn)
+	return &RESPConn{
+		conn: conn,
+		br:   br,
+		rd:   resp.NewReader(br),
+		wr:   resp.NewWriter(conn),
+	}
+}
+
+// decompress reads the rest of the connection as a compressed stream.
+func (conn *RESPConn) decompress(codec string) error {
+	zr, err := newReplCompressReader(codec, conn.br)
+	if err != nil {
+		return err
 	}
-	return conn, nil
+	conn.rd = resp.NewReader(zr)
+	return nil
 }
 
 // Close closes the connection.
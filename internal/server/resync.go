@@ -0,0 +1,80 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/log"
+)
+
+var errResyncNotConfirmed = errors.New(
+	"resync discards the local dataset, use CONFIRM to proceed")
+
+// RESYNC CONFIRM
+func (s *Server) cmdRESYNC(msg *Message) (resp.Value, error) {
+	start := time.Now()
+
+	// >> Args
+
+	var confirm bool
+	for _, arg := range msg.Args[1:] {
+		switch strings.ToLower(arg) {
+		case "confirm":
+			confirm = true
+		default:
+			return retrerr(errInvalidArgument(arg))
+		}
+	}
+
+	// >> Operation
+
+	if s.config.followHost() == "" {
+		return retrerr(errNotFollower)
+	}
+	if !confirm {
+		return retrerr(errResyncNotConfirmed)
+	}
+
+	// Stop the running follow loop. It checks the counter while holding the
+	// server lock, so no more leader commands are applied after this.
+	s.followc.Add(1)
+	s.fups = nil
+
+	if err := s.discardFollowData(); err != nil {
+		return retrerr(err)
+	}
+	// the leader is followed as if for the first time
+	s.config.setFollowID("")
+	s.config.write(false)
+
+	log.Infof("resyncing from leader '%s' '%d'", s.config.followHost(),
+		s.config.followPort())
+	go s.followAll(int(s.followc.Load()))
+
+	// >> Response
+
+	return OKMessage(msg, start), nil
+}
+
+// discardFollowData discards the local dataset and aof, so that they can be
+// read again from the start of the aof of the leader. Must hold the server
+// lock.
+func (s *Server) discardFollowData() error {
+	s.flushAll()
+	if s.aof != nil {
+		s.aofbuf = s.aofbuf[:0]
+		if err := s.aof.Truncate(0); err != nil {
+			log.Fatalf("could not truncate aof, possible data loss. %s",
+				err.Error())
+			return err
+		}
+	}
+	s.reset()
+	s.faofsz = 0
+	s.fleadsz = 0
+	s.fcup = false
+	s.fcuponce = false
+	return nil
+}
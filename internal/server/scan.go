@@ -51,6 +51,27 @@ func (s *Server) cmdScan(msg *Message) (res resp.Value, err error) {
 	if err != nil {
 		return NOMessage, err
 	}
+	if err := s.checkStrictKey(sw, args.strict); err != nil {
+		return NOMessage, err
+	}
+	sw.grid = args.grid
+	sw.hashCover = args.hashCover
+	sw.mvt = newMVTLayer(args.searchScanBaseTokens)
+	sw.csv = newCSVWriter(args.searchScanBaseTokens)
+	sw.simplify = s.newSimplifier(args.searchScanBaseTokens)
+	sw.ttls = newTTLFilter(args.searchScanBaseTokens)
+	sw.distinct = s.newDistinctCounter(args.searchScanBaseTokens)
+	sw.join = s.newObjectJoin(args.searchScanBaseTokens)
+	sw.setRegexps(args.regexps)
+	if args.deleted && sw.output == outputCount {
+		return NOMessage, errors.New("INCLUDE_DELETED is not allowed for COUNT")
+	}
+	if len(args.changed) > 0 {
+		sw.changed, err = s.newChangedFilter(args.key, args.since, args.changed)
+		if err != nil {
+			return NOMessage, err
+		}
+	}
 	if msg.OutputType == JSON {
 		wr.WriteString(`{"ok":true`)
 	}
@@ -58,15 +79,33 @@ func (s *Server) cmdScan(msg *Message) (res resp.Value, err error) {
 	if sw.col != nil {
 		if sw.output == outputCount && len(sw.wheres) == 0 &&
 			len(sw.whereins) == 0 && len(sw.whereevals) == 0 &&
-			sw.globEverything {
-			count := sw.col.Count() - int(args.cursor)
+			sw.globEverything && sw.changed == nil && sw.ttls == nil {
+			count := sw.col.Count() - sw.col.CountExpired(sw.now) -
+				int(args.cursor)
 			if count < 0 {
 				count = 0
 			}
 			sw.count = uint64(count)
 		} else {
-			limits := multiGlobParse(sw.globs, args.desc)
-			if limits[0] == "" && limits[1] == "" {
+			limits := sw.globLimits(args.desc)
+			name, r, indexed := sw.indexedWhere()
+			if indexed && sw.globEverything {
+				// only the objects with a value in range are scanned, by
+				// the order of the field
+				sw.col.ScanIndex(name, r, args.desc, sw,
+					msg.Deadline,
+					func(o *object.Object) bool {
+						keepGoing, err := sw.pushObject(ScanWriterParams{
+							obj: o,
+						})
+						if err != nil {
+							ierr = err
+							return false
+						}
+						return keepGoing
+					},
+				)
+			} else if limits[0] == "" && limits[1] == "" {
 				sw.col.Scan(args.desc, sw,
 					msg.Deadline,
 					func(o *object.Object) bool {
@@ -101,9 +140,8 @@ func (s *Server) cmdScan(msg *Message) (res resp.Value, err error) {
 		return retrerr(ierr)
 	}
 	sw.writeFoot()
-	if msg.OutputType == JSON {
-		wr.WriteString(`,"elapsed":"` + time.Since(start).String() + "\"}")
-		return resp.BytesValue(wr.Bytes()), nil
+	if args.deleted && !sw.hitLimit {
+		s.writeTombstones(sw, args.key, args.since)
 	}
-	return sw.respOut, nil
+	return writeResult(msg, &args.searchScanBaseTokens, wr, sw.respOut, start)
 }
@@ -2,14 +2,19 @@ package server
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"math"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mmcloughlin/geohash"
 	"github.com/tidwall/btree"
 	"github.com/tidwall/geojson"
+	"github.com/tidwall/geojson/geometry"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/resp"
 	"github.com/tidwall/tile38/internal/clip"
@@ -31,6 +36,12 @@ const (
 	outputPoints
 	outputHashes
 	outputBounds
+	outputFeatures
+	outputDistinct
+	outputMVT
+	outputCSV
+	outputWKT
+	outputWKB
 )
 
 type scanWriter struct {
@@ -54,22 +65,44 @@ type scanWriter struct {
 	count          uint64
 	precision      uint64
 	globs          []string
+	regexps        []*regexp.Regexp
 	globEverything bool
 	fullFields     bool
 	values         []resp.Value
 	matchValues    bool
 	respOut        resp.Value
 	filled         []ScanWriterParams
+	changed        *changedFilter
+	ttls           *ttlFilter
+	distinct       *distinctCounter
+	join           *objectJoin
+	dryRun         bool // fence matches must not connect groups
+	grid           int  // FEATURES INDEX grid size
+	hashCover      bool // HASHES COVER the bounds of each object
+	fbuf           []byte
+	frects         []geometry.Rect
+	mvt            *mvtLayer  // MVT tile layer
+	csv            *csvWriter // CSV rows
+	simplify       *simplifier
+	now            int64 // unix nanoseconds, for skipping expired objects
 }
 
 type ScanWriterParams struct {
 	obj             *object.Object
 	dist            float64
 	distOutput      bool // query or fence requested distance output
+	bearing         float64
+	bearingOutput   bool // query requested a HEADING relative bearing
+	along           float64
+	alongOutput     bool // query requested an ALONG line distance
+	score           float64
+	scoreOutput     bool   // query requested score output
+	zone            string // WITHZONE zone, "core" or "buffer"
 	noTest          bool
 	ignoreGlobMatch bool
 	clip            geojson.Object
 	skipTesting     bool
+	hashes          []string // HASHES COVER geohashes covering the object
 }
 
 func (s *Server) newScanWriter(
@@ -83,10 +116,13 @@ func (s *Server) newScanWriter(
 	switch output {
 	default:
 		return nil, errors.New("invalid output type")
-	case outputIDs, outputObjects, outputCount, outputBounds, outputPoints, outputHashes:
+	case outputIDs, outputObjects, outputCount, outputBounds, outputPoints,
+		outputHashes, outputFeatures, outputDistinct, outputMVT, outputCSV,
+		outputWKT, outputWKB:
 	}
 	if limit == 0 {
-		if output == outputCount {
+		if output == outputCount || output == outputDistinct ||
+			output == outputMVT {
 			limit = math.MaxUint64
 		} else {
 			limit = limitItems
@@ -105,6 +141,7 @@ func (s *Server) newScanWriter(
 		precision:   precision,
 		whereevals:  whereevals,
 		matchValues: matchValues,
+		now:         time.Now().UnixNano(),
 	}
 
 	if len(globs) == 0 || (len(globs) == 1 && globs[0] == "*") {
@@ -116,11 +153,48 @@ func (s *Server) newScanWriter(
 	return sw, nil
 }
 
+// ttlFilter matches the objects with a remaining time to live in a range.
+// Objects without an expiration never match.
+type ttlFilter struct {
+	now, min, max int64 // unix nanoseconds, and the range in nanoseconds
+}
+
+// newTTLFilter returns the filter for TTLBETWEEN, or nil if there's none.
+func newTTLFilter(t searchScanBaseTokens) *ttlFilter {
+	if !t.hasttl {
+		return nil
+	}
+	return &ttlFilter{
+		now: time.Now().UnixNano(),
+		min: int64(t.ttlmin * float64(time.Second)),
+		max: int64(t.ttlmax * float64(time.Second)),
+	}
+}
+
+func (f *ttlFilter) match(o *object.Object) bool {
+	if o.Expires() == 0 {
+		return false
+	}
+	ttl := o.Expires() - f.now
+	return ttl >= f.min && ttl <= f.max
+}
+
+// checkStrictKey returns an error when a query is on a key that does not
+// exist, and either the query has STRICT or the strict-keys config is on.
+// Otherwise a missing key is an empty result.
+func (s *Server) checkStrictKey(sw *scanWriter, strict bool) error {
+	if sw.col == nil && (strict || s.config.strictKeys()) {
+		return errKeyNotFound
+	}
+	return nil
+}
+
 func (sw *scanWriter) hasFieldsOutput() bool {
 	switch sw.output {
 	default:
 		return false
-	case outputObjects, outputPoints, outputHashes, outputBounds:
+	case outputObjects, outputPoints, outputHashes, outputBounds, outputWKT,
+		outputWKB:
 		return !sw.nofields
 	}
 }
@@ -152,11 +226,20 @@ func (sw *scanWriter) writeFoot() {
 			sw.wr.WriteString(`,"bounds":[`)
 		case outputHashes:
 			sw.wr.WriteString(`,"hashes":[`)
-		case outputCount:
+		case outputWKT:
+			sw.wr.WriteString(`,"wkt":[`)
+		case outputWKB:
+			sw.wr.WriteString(`,"wkb":[`)
+		case outputFeatures:
+			sw.wr.WriteString(`,"features":{"type":"FeatureCollection","features":[`)
+		case outputCount, outputDistinct, outputMVT, outputCSV:
 
 		}
 	case RESP:
 	}
+	if sw.csv != nil {
+		sw.csv.writeHeader(&sw.fkeys, sw.nofields)
+	}
 
 	for _, opts := range sw.filled {
 		sw.writeFilled(opts)
@@ -171,14 +254,66 @@ func (sw *scanWriter) writeFoot() {
 		switch sw.output {
 		default:
 			sw.wr.WriteByte(']')
+		case outputFeatures:
+			sw.wr.WriteString(`]}`)
+			if sw.grid > 0 {
+				sw.wr.WriteString(`,"index":`)
+				sw.wr.Write(appendFeatureIndex(nil, sw.frects, sw.grid))
+			}
 		case outputCount:
 
+		case outputMVT:
+			tile := sw.mvt.appendTile(nil)
+			sw.wr.WriteString(`,"mvt":"` +
+				base64.StdEncoding.EncodeToString(tile) + `"`)
+			if sw.msg.ConnType == HTTP {
+				// the tile itself is the body of the response
+				sw.msg.body = tile
+				sw.msg.bodyType = mvtContentType
+			}
+		case outputCSV:
+			rows := sw.csv.bytes()
+			sw.wr.WriteString(`,"csv":` + jsonString(string(rows)))
+			if sw.msg.ConnType == HTTP {
+				// the rows themselves are the body of the response
+				sw.msg.body = rows
+				sw.msg.bodyType = csvContentType
+			}
+		case outputDistinct:
+			n, approximate := sw.distinct.count()
+			sw.wr.WriteString(`,"ndistinct":` + strconv.FormatUint(n, 10))
+			sw.wr.WriteString(`,"approximate":` + strconv.FormatBool(approximate))
 		}
 		sw.wr.WriteString(`,"count":` + strconv.FormatUint(sw.count, 10))
 		sw.wr.WriteString(`,"cursor":` + strconv.FormatUint(cursor, 10))
 	case RESP:
 		if sw.output == outputCount {
 			sw.respOut = resp.IntegerValue(int(sw.count))
+		} else if sw.output == outputDistinct {
+			n, _ := sw.distinct.count()
+			sw.respOut = resp.IntegerValue(int(n))
+		} else if sw.output == outputCSV {
+			sw.respOut = resp.ArrayValue([]resp.Value{
+				resp.IntegerValue(int(cursor)),
+				resp.StringValue(string(sw.csv.bytes())),
+			})
+		} else if sw.output == outputMVT {
+			sw.respOut = resp.ArrayValue([]resp.Value{
+				resp.IntegerValue(int(cursor)),
+				resp.BytesValue(sw.mvt.appendTile(nil)),
+			})
+		} else if sw.output == outputFeatures {
+			fc := `{"type":"FeatureCollection","features":[` +
+				string(sw.fbuf) + `]}`
+			values := []resp.Value{
+				resp.IntegerValue(int(cursor)),
+				resp.StringValue(fc),
+			}
+			if sw.grid > 0 {
+				values = append(values, resp.StringValue(string(
+					appendFeatureIndex(nil, sw.frects, sw.grid))))
+			}
+			sw.respOut = resp.ArrayValue(values)
 		} else {
 			values := []resp.Value{
 				resp.IntegerValue(int(cursor)),
@@ -227,12 +362,26 @@ func getFieldValue(o *object.Object, name string) field.Value {
 	return o.Fields().Get(name).Value()
 }
 
+// matchJSON matches the value at the path in the JSON of the object. Objects
+// that have no value at the path don't match.
+func (where whereT) matchJSON(o *object.Object) bool {
+	res := gjson.Get(o.Geo().JSON(), where.name)
+	if !res.Exists() {
+		return false
+	}
+	return where.matchField(field.ValueOf(res.Raw))
+}
+
 func (sw *scanWriter) fieldMatch(o *object.Object) (bool, error) {
 	for _, where := range sw.wheres {
 		if where.expr {
 			if !where.matchExpr(sw.s, o) {
 				return false, nil
 			}
+		} else if where.json {
+			if !where.matchJSON(o) {
+				return false, nil
+			}
 		} else {
 			if !where.matchField(getFieldValue(o, where.name)) {
 				return false, nil
@@ -277,13 +426,44 @@ func (sw *scanWriter) globMatch(o *object.Object) (ok, keepGoing bool) {
 	} else {
 		val = o.ID()
 	}
+	return sw.matchString(val), true
+}
+
+// matchString returns true when a value matches one of the MATCH patterns.
+func (sw *scanWriter) matchString(val string) bool {
 	for _, pattern := range sw.globs {
 		ok, _ := glob.Match(pattern, val)
 		if ok {
-			return true, true
+			return true
+		}
+	}
+	for _, rx := range sw.regexps {
+		if rx.MatchString(val) {
+			return true
 		}
 	}
-	return false, true
+	return false
+}
+
+// setRegexps adds the MATCH RE patterns of a query. Without a MATCH glob,
+// only the values that match a regexp are written.
+func (sw *scanWriter) setRegexps(regexps []*regexp.Regexp) {
+	if len(regexps) == 0 {
+		return
+	}
+	sw.regexps = regexps
+	if len(sw.globs) == 0 {
+		sw.globEverything = false
+	}
+}
+
+// globLimits returns the range of the values that may match the MATCH
+// patterns. Any value may match a regexp.
+func (sw *scanWriter) globLimits(desc bool) [2]string {
+	if len(sw.regexps) > 0 {
+		return [2]string{}
+	}
+	return multiGlobParse(sw.globs, desc)
 }
 
 // Increment cursor
@@ -299,6 +479,9 @@ func (sw *scanWriter) Step(n uint64) {
 // keepGoing is whether there could be more objects to test
 func (sw *scanWriter) testObject(o *object.Object,
 ) (ok, keepGoing bool, err error) {
+	if expired(o, sw.now) {
+		return false, true, nil
+	}
 	match, kg := sw.globMatch(o)
 	if !match {
 		return false, kg, nil
@@ -307,6 +490,12 @@ func (sw *scanWriter) testObject(o *object.Object,
 	if err != nil {
 		return false, false, err
 	}
+	if ok && sw.changed != nil {
+		ok = sw.changed.match(o)
+	}
+	if ok && sw.ttls != nil {
+		ok = sw.ttls.match(o)
+	}
 	return ok, true, nil
 }
 
@@ -323,10 +512,20 @@ func (sw *scanWriter) pushObject(opts ScanWriterParams) (keepGoing bool, err err
 			return keepGoing, nil
 		}
 	}
+	if sw.mvt != nil && !sw.mvt.touches(opts.obj.Geo()) {
+		return keepGoing, nil
+	}
 	sw.count++
 	if sw.output == outputCount {
 		return sw.count < sw.limit, nil
 	}
+	if sw.output == outputDistinct {
+		sw.distinct.add(opts.obj)
+		return sw.count < sw.limit, nil
+	}
+	if sw.join != nil {
+		opts.obj = sw.join.merge(opts.obj)
+	}
 	if opts.clip != nil {
 		// create a newly clipped object
 		opts.obj = object.New(
@@ -336,6 +535,22 @@ func (sw *scanWriter) pushObject(opts ScanWriterParams) (keepGoing bool, err err
 			opts.obj.Fields(),
 		)
 	}
+	if sw.simplify != nil {
+		if g := sw.simplify.simplify(opts.obj.Geo()); g != opts.obj.Geo() {
+			opts.obj = object.New(opts.obj.ID(), g, opts.obj.Expires(),
+				opts.obj.Fields())
+		}
+	}
+	if sw.output == outputHashes && sw.hashCover {
+		var ok bool
+		opts.hashes, ok = geohashCover(opts.obj.Rect(), uint(sw.precision))
+		if !ok {
+			return false, errors.New("too many geohashes to cover '" +
+				opts.obj.ID() + "' at precision " +
+				strconv.FormatUint(sw.precision, 10) + ", the limit is " +
+				strconv.Itoa(maxHashCover))
+		}
+	}
 
 	if !sw.fullFields {
 		opts.obj.Fields().Scan(func(f field.Field) bool {
@@ -362,6 +577,18 @@ func (sw *scanWriter) writeObject(opts ScanWriterParams) {
 }
 
 func (sw *scanWriter) writeFilled(opts ScanWriterParams) {
+	if sw.output == outputFeatures {
+		sw.writeFeature(opts)
+		return
+	}
+	if sw.output == outputMVT {
+		sw.mvt.add(opts, !sw.nofields, &sw.s.geomIndexOpts)
+		return
+	}
+	if sw.output == outputCSV {
+		sw.csv.writeRow(opts.obj, opts.dist)
+		return
+	}
 	switch sw.msg.OutputType {
 	case JSON:
 		var wr bytes.Buffer
@@ -403,30 +630,75 @@ func (sw *scanWriter) writeFilled(opts ScanWriterParams) {
 			jsfields += `]`
 		}
 		if sw.output == outputIDs {
-			if opts.distOutput || opts.dist > 0 {
-				wr.WriteString(`{"id":` + jsonString(opts.obj.ID()) +
-					`,"distance":` + strconv.FormatFloat(opts.dist, 'f', -1, 64) + "}")
+			if opts.distOutput || opts.dist > 0 || opts.scoreOutput ||
+				opts.zone != "" {
+				wr.WriteString(`{` + jsonID(opts.obj.ID()))
+				if opts.distOutput || opts.dist > 0 {
+					wr.WriteString(`,"distance":` + strconv.FormatFloat(opts.dist, 'f', -1, 64))
+				}
+				if opts.bearingOutput {
+					wr.WriteString(`,"bearing":` + strconv.FormatFloat(opts.bearing, 'f', -1, 64))
+				}
+				if opts.alongOutput {
+					wr.WriteString(`,"along":` + strconv.FormatFloat(opts.along, 'f', -1, 64))
+				}
+				if opts.scoreOutput {
+					wr.WriteString(`,"score":` + strconv.FormatFloat(opts.score, 'f', -1, 64))
+				}
+				if opts.zone != "" {
+					wr.WriteString(`,"zone":"` + opts.zone + `"`)
+				}
+				wr.WriteString(`}`)
+			} else if binaryID(opts.obj.ID()) {
+				wr.WriteString(`{` + jsonID(opts.obj.ID()) + `}`)
 			} else {
 				wr.WriteString(jsonString(opts.obj.ID()))
 			}
 		} else {
-			wr.WriteString(`{"id":` + jsonString(opts.obj.ID()))
+			wr.WriteString(`{` + jsonID(opts.obj.ID()))
 			switch sw.output {
 			case outputObjects:
 				wr.WriteString(`,"object":` + string(opts.obj.Geo().AppendJSON(nil)))
 			case outputPoints:
 				wr.WriteString(`,"point":` + string(appendJSONSimplePoint(nil, opts.obj.Geo())))
 			case outputHashes:
-				center := opts.obj.Geo().Center()
-				p := geohash.EncodeWithPrecision(center.Y, center.X, uint(sw.precision))
-				wr.WriteString(`,"hash":"` + p + `"`)
+				if !sw.hashCover {
+					center := opts.obj.Geo().Center()
+					p := geohash.EncodeWithPrecision(center.Y, center.X, uint(sw.precision))
+					wr.WriteString(`,"hash":"` + p + `"`)
+					break
+				}
+				wr.WriteString(`,"hashes":[`)
+				for i, hash := range opts.hashes {
+					if i > 0 {
+						wr.WriteByte(',')
+					}
+					wr.WriteString(`"` + hash + `"`)
+				}
+				wr.WriteByte(']')
 			case outputBounds:
 				wr.WriteString(`,"bounds":` + string(appendJSONSimpleBounds(nil, opts.obj.Geo())))
+			case outputWKT:
+				wr.WriteString(`,"wkt":` + jsonString(string(appendWKT(nil, opts.obj.Geo()))))
+			case outputWKB:
+				wr.WriteString(`,"wkb":"` + hex.EncodeToString(appendWKB(nil, opts.obj.Geo())) + `"`)
 			}
 			wr.WriteString(jsfields)
 			if opts.distOutput || opts.dist > 0 {
 				wr.WriteString(`,"distance":` + strconv.FormatFloat(opts.dist, 'f', -1, 64))
 			}
+			if opts.bearingOutput {
+				wr.WriteString(`,"bearing":` + strconv.FormatFloat(opts.bearing, 'f', -1, 64))
+			}
+			if opts.alongOutput {
+				wr.WriteString(`,"along":` + strconv.FormatFloat(opts.along, 'f', -1, 64))
+			}
+			if opts.scoreOutput {
+				wr.WriteString(`,"score":` + strconv.FormatFloat(opts.score, 'f', -1, 64))
+			}
+			if opts.zone != "" {
+				wr.WriteString(`,"zone":"` + opts.zone + `"`)
+			}
 
 			wr.WriteString(`}`)
 		}
@@ -435,8 +707,23 @@ func (sw *scanWriter) writeFilled(opts ScanWriterParams) {
 		vals := make([]resp.Value, 1, 3)
 		vals[0] = resp.StringValue(opts.obj.ID())
 		if sw.output == outputIDs {
-			if opts.distOutput || opts.dist > 0 {
-				vals = append(vals, resp.FloatValue(opts.dist))
+			if opts.distOutput || opts.dist > 0 || opts.scoreOutput ||
+				opts.zone != "" {
+				if opts.distOutput || opts.dist > 0 {
+					vals = append(vals, resp.FloatValue(opts.dist))
+				}
+				if opts.bearingOutput {
+					vals = append(vals, resp.FloatValue(opts.bearing))
+				}
+				if opts.alongOutput {
+					vals = append(vals, resp.FloatValue(opts.along))
+				}
+				if opts.scoreOutput {
+					vals = append(vals, resp.FloatValue(opts.score))
+				}
+				if opts.zone != "" {
+					vals = append(vals, resp.StringValue(opts.zone))
+				}
 				sw.values = append(sw.values, resp.ArrayValue(vals))
 			} else {
 				sw.values = append(sw.values, vals[0])
@@ -461,9 +748,17 @@ func (sw *scanWriter) writeFilled(opts ScanWriterParams) {
 					}))
 				}
 			case outputHashes:
-				center := opts.obj.Geo().Center()
-				p := geohash.EncodeWithPrecision(center.Y, center.X, uint(sw.precision))
-				vals = append(vals, resp.StringValue(p))
+				if !sw.hashCover {
+					center := opts.obj.Geo().Center()
+					p := geohash.EncodeWithPrecision(center.Y, center.X, uint(sw.precision))
+					vals = append(vals, resp.StringValue(p))
+					break
+				}
+				hvals := make([]resp.Value, len(opts.hashes))
+				for i, hash := range opts.hashes {
+					hvals[i] = resp.StringValue(hash)
+				}
+				vals = append(vals, resp.ArrayValue(hvals))
 			case outputBounds:
 				bbox := opts.obj.Rect()
 				vals = append(vals, resp.ArrayValue([]resp.Value{
@@ -476,6 +771,10 @@ func (sw *scanWriter) writeFilled(opts ScanWriterParams) {
 						resp.FloatValue(bbox.Max.X),
 					}),
 				}))
+			case outputWKT:
+				vals = append(vals, resp.StringValue(string(appendWKT(nil, opts.obj.Geo()))))
+			case outputWKB:
+				vals = append(vals, resp.BytesValue(appendWKB(nil, opts.obj.Geo())))
 			}
 			if sw.hasFieldsOutput() {
 				var fvals []resp.Value
@@ -494,7 +793,73 @@ func (sw *scanWriter) writeFilled(opts ScanWriterParams) {
 			if opts.distOutput || opts.dist > 0 {
 				vals = append(vals, resp.FloatValue(opts.dist))
 			}
+			if opts.bearingOutput {
+				vals = append(vals, resp.FloatValue(opts.bearing))
+			}
+			if opts.alongOutput {
+				vals = append(vals, resp.FloatValue(opts.along))
+			}
+			if opts.scoreOutput {
+				vals = append(vals, resp.FloatValue(opts.score))
+			}
+			if opts.zone != "" {
+				vals = append(vals, resp.StringValue(opts.zone))
+			}
 			sw.values = append(sw.values, resp.ArrayValue(vals))
 		}
 	}
 }
+
+// maxHashCover is the maximum number of geohashes that are used to cover the
+// bounds of a single object. All of the hashes have the requested precision,
+// so an object that needs more than this at the precision is an error.
+const maxHashCover = 16
+
+// geohashCover returns the geohashes that cover the provided rectangle, or
+// false when more than maxHashCover are needed at the precision. A point will
+// always return a single geohash.
+func geohashCover(rect geometry.Rect, precision uint) ([]string, bool) {
+	// The maximum edges of the world wrap around to the first cell, so keep
+	// the rectangle just inside of them.
+	rect = geometry.Rect{
+		Min: geometry.Point{
+			X: math.Max(rect.Min.X, -180), Y: math.Max(rect.Min.Y, -90),
+		},
+		Max: geometry.Point{
+			X: math.Min(rect.Max.X, 180-1e-9),
+			Y: math.Min(rect.Max.Y, 90-1e-9),
+		},
+	}
+	box, nx, ny := geohashCoverCells(rect, precision)
+	if nx*ny > maxHashCover {
+		return nil, false
+	}
+	w := box.MaxLng - box.MinLng
+	h := box.MaxLat - box.MinLat
+	hashes := make([]string, 0, nx*ny)
+	for y := 0; y < ny; y++ {
+		for x := 0; x < nx; x++ {
+			hashes = append(hashes, geohash.EncodeWithPrecision(
+				box.MinLat+h*(float64(y)+0.5),
+				box.MinLng+w*(float64(x)+0.5),
+				precision,
+			))
+		}
+	}
+	return hashes, true
+}
+
+// geohashCoverCells returns the bounding box of the geohash cell containing
+// the minimum corner of the rectangle, and the number of cells along each
+// axis that are needed to reach the maximum corner.
+func geohashCoverCells(rect geometry.Rect, precision uint) (
+	box geohash.Box, nx, ny int,
+) {
+	box = geohash.BoundingBox(
+		geohash.EncodeWithPrecision(rect.Min.Y, rect.Min.X, precision))
+	max := geohash.BoundingBox(
+		geohash.EncodeWithPrecision(rect.Max.Y, rect.Max.X, precision))
+	nx = int(math.Round((max.MinLng-box.MinLng)/(box.MaxLng-box.MinLng))) + 1
+	ny = int(math.Round((max.MinLat-box.MinLat)/(box.MaxLat-box.MinLat))) + 1
+	return box, nx, ny
+}
@@ -36,8 +36,8 @@ func BenchmarkFieldMatch(t *testing.B) {
 	}
 	sw := &scanWriter{
 		wheres: []whereT{
-			{false, "foo", false, field.ValueOf("1"), false, field.ValueOf("3")},
-			{false, "bar", false, field.ValueOf("10"), false, field.ValueOf("30")},
+			{false, false, "foo", false, field.ValueOf("1"), false, field.ValueOf("3")},
+			{false, false, "bar", false, field.ValueOf("10"), false, field.ValueOf("30")},
 		},
 		whereins: []whereinT{
 			{"foo", []field.Value{field.ValueOf("1"), field.ValueOf("2")}},
@@ -52,3 +52,33 @@ func BenchmarkFieldMatch(t *testing.B) {
 		}
 	}
 }
+
+func TestGeohashCover(t *testing.T) {
+	rect := func(minX, minY, maxX, maxY float64) geometry.Rect {
+		return geometry.Rect{
+			Min: geometry.Point{X: minX, Y: minY},
+			Max: geometry.Point{X: maxX, Y: maxY},
+		}
+	}
+	tests := []struct {
+		rect      geometry.Rect
+		precision uint
+		expect    string
+	}{
+		{rect(-115.5, 33.5, -115.5, 33.5), 5, "[9mvye]"},
+		{rect(-115.51, 33.49, -115.45, 33.52), 5, "[9mvye 9mvys]"},
+		{rect(-120, 30, -110, 40), 2, "[9m 9t 9q 9w 9r 9x]"},
+		{rect(-120, 30, -110, 40), 5, "[]"},
+		{rect(-180, -90, 180, 90), 2, "[]"},
+		{rect(-200, -100, 200, 100), 1, "[]"},
+	}
+	for _, tt := range tests {
+		hashes, ok := geohashCover(tt.rect, tt.precision)
+		if ok != (len(hashes) > 0) || len(hashes) > maxHashCover {
+			t.Fatalf("expected at most %d hashes, got %d", maxHashCover, len(hashes))
+		}
+		if got := fmt.Sprint(hashes); got != tt.expect {
+			t.Fatalf("expected %s, got %s", tt.expect, got)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"math"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/geojson/geo"
+	"github.com/tidwall/geojson/geometry"
+)
+
+const earthRadius = 6371e3
+
+// withinScore returns a score between 0 and 1 for how deep the center of an
+// object lies inside of an area. Zero is on the edge of the area and one is
+// as far from the edge as the area allows.
+func withinScore(area, obj geojson.Object) float64 {
+	p := obj.Center()
+	var depth, maxDepth float64
+	if circle, ok := area.(*geojson.Circle); ok {
+		maxDepth = circle.Meters()
+		c := circle.Center()
+		depth = maxDepth - geo.DistanceTo(c.Y, c.X, p.Y, p.X)
+	} else {
+		depth = math.Inf(+1)
+		edgeDepth(area, p, &depth)
+		// No area can be deeper than half of the shortest side of its bounds.
+		r := area.Rect()
+		c := r.Center()
+		maxDepth = math.Min(
+			geo.DistanceTo(c.Y, r.Min.X, c.Y, r.Max.X),
+			geo.DistanceTo(r.Min.Y, c.X, r.Max.Y, c.X),
+		) / 2
+	}
+	if maxDepth <= 0 || depth <= 0 || math.IsInf(depth, 0) {
+		return 0
+	}
+	return math.Min(depth/maxDepth, 1)
+}
+
+// edgeDepth lowers depth to the distance in meters from the point to the
+// nearest edge of the area.
+func edgeDepth(area geojson.Object, p geometry.Point, depth *float64) {
+	switch area := area.(type) {
+	case *geojson.Feature:
+		edgeDepth(area.Base(), p, depth)
+	case *geojson.Polygon:
+		poly := area.Base()
+		ringDepth(poly.Exterior, p, depth)
+		for _, hole := range poly.Holes {
+			ringDepth(hole, p, depth)
+		}
+	case interface{ Children() []geojson.Object }:
+		for _, child := range area.Children() {
+			edgeDepth(child, p, depth)
+		}
+	default:
+		ringDepth(area.Rect(), p, depth)
+	}
+}
+
+func ringDepth(ring interface {
+	NumSegments() int
+	SegmentAt(index int) geometry.Segment
+}, p geometry.Point, depth *float64) {
+	// Project onto a plane that is centered on the point, in meters.
+	kx := earthRadius * math.Pi / 180 * math.Cos(p.Y*math.Pi/180)
+	ky := earthRadius * math.Pi / 180
+	for i := 0; i < ring.NumSegments(); i++ {
+		seg := ring.SegmentAt(i)
+		ax, ay := (seg.A.X-p.X)*kx, (seg.A.Y-p.Y)*ky
+		bx, by := (seg.B.X-p.X)*kx, (seg.B.Y-p.Y)*ky
+		dx, dy := bx-ax, by-ay
+		var t float64
+		if l := dx*dx + dy*dy; l > 0 {
+			t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l))
+		}
+		x, y := ax+t*dx, ay+t*dy
+		*depth = math.Min(*depth, math.Sqrt(x*x+y*y))
+	}
+}
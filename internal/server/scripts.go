@@ -637,17 +637,21 @@ func (s *Server) commandInScript(msg *Message) (
 		res, d, err = s.cmdDEL(msg)
 	case "pdel":
 		res, d, err = s.cmdPDEL(msg)
+	case "mset":
+		res, d, err = s.cmdMSET(msg)
 	case "drop":
 		res, d, err = s.cmdDROP(msg)
-	case "expire":
+	case "expire", "pexpire":
 		res, d, err = s.cmdEXPIRE(msg)
 	case "rename":
 		res, d, err = s.cmdRENAME(msg)
 	case "renamenx":
 		res, d, err = s.cmdRENAME(msg)
+	case "copy":
+		res, d, err = s.cmdCOPY(msg)
 	case "persist":
 		res, d, err = s.cmdPERSIST(msg)
-	case "ttl":
+	case "ttl", "pttl":
 		res, err = s.cmdTTL(msg)
 	case "stats":
 		res, err = s.cmdSTATS(msg)
@@ -730,18 +734,18 @@ func (s *Server) luaTile38AtomicRW(msg *Message) (resp.Value, error) {
 	switch msg.Command() {
 	default:
 		return resp.NullValue(), errCmdNotSupported
-	case "set", "del", "drop", "fset", "flushdb", "expire", "persist", "jset", "pdel",
-		"rename", "renamenx":
+	case "set", "del", "drop", "fset", "flushdb", "expire", "pexpire", "persist", "jset", "pdel", "mset",
+		"rename", "renamenx", "copy":
 		// write operations
 		write = true
-		if s.config.followHost() != "" {
+		if s.readOnlyFollower() {
 			return resp.NullValue(), errNotLeader
 		}
 		if s.config.readOnly() {
 			return resp.NullValue(), errReadOnly
 		}
 	case "get", "keys", "scan", "nearby", "within", "intersects", "hooks", "search",
-		"ttl", "bounds", "server", "info", "type", "jget", "fget", "exists", "fexists", "test":
+		"ttl", "pttl", "bounds", "server", "info", "type", "jget", "fget", "exists", "fexists", "test":
 		// read operations
 		if s.config.followHost() != "" && !s.fcuponce {
 			return resp.NullValue(), errCatchingUp
@@ -788,13 +792,13 @@ func (s *Server) luaTile38AtomicRO(msg *Message) (resp.Value, error) {
 	default:
 		return resp.NullValue(), errCmdNotSupported
 
-	case "set", "del", "drop", "fset", "flushdb", "expire", "persist", "jset", "pdel",
-		"rename", "renamenx":
+	case "set", "del", "drop", "fset", "flushdb", "expire", "pexpire", "persist", "jset", "pdel", "mset",
+		"rename", "renamenx", "copy":
 		// write operations
 		return resp.NullValue(), errReadOnly
 
 	case "get", "keys", "scan", "nearby", "within", "intersects", "hooks", "search",
-		"ttl", "bounds", "server", "info", "type", "jget", "fget", "exists", "fexists", "test":
+		"ttl", "pttl", "bounds", "server", "info", "type", "jget", "fget", "exists", "fexists", "test":
 		// read operations
 		if s.config.followHost() != "" && !s.fcuponce {
 			return resp.NullValue(), errCatchingUp
@@ -832,20 +836,20 @@ func (s *Server) luaTile38NonAtomic(msg *Message) (resp.Value, error) {
 	switch msg.Command() {
 	default:
 		return resp.NullValue(), errCmdNotSupported
-	case "set", "del", "drop", "fset", "flushdb", "expire", "persist", "jset", "pdel",
-		"rename", "renamenx":
+	case "set", "del", "drop", "fset", "flushdb", "expire", "pexpire", "persist", "jset", "pdel", "mset",
+		"rename", "renamenx", "copy":
 		// write operations
 		write = true
 		s.mu.Lock()
 		defer s.mu.Unlock()
-		if s.config.followHost() != "" {
+		if s.readOnlyFollower() {
 			return resp.NullValue(), errNotLeader
 		}
 		if s.config.readOnly() {
 			return resp.NullValue(), errReadOnly
 		}
 	case "get", "keys", "scan", "nearby", "within", "intersects", "hooks", "search",
-		"ttl", "bounds", "server", "info", "type", "jget", "fget", "exists", "fexists", "test":
+		"ttl", "pttl", "bounds", "server", "info", "type", "jget", "fget", "exists", "fexists", "test":
 		// read operations
 		s.mu.RLock()
 		defer s.mu.RUnlock()
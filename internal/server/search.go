@@ -2,8 +2,10 @@ package server
 
 import (
 	"bytes"
+	"container/heap"
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +18,8 @@ import (
 	"github.com/tidwall/tile38/internal/bing"
 	"github.com/tidwall/tile38/internal/buffer"
 	"github.com/tidwall/tile38/internal/clip"
+	"github.com/tidwall/tile38/internal/deadline"
+	"github.com/tidwall/tile38/internal/geodesic"
 	"github.com/tidwall/tile38/internal/glob"
 	"github.com/tidwall/tile38/internal/object"
 )
@@ -25,6 +29,7 @@ const defaultCircleSteps = 64
 type liveFenceSwitches struct {
 	searchScanBaseTokens
 	obj  geojson.Object
+	core geojson.Object // the area before the BUFFER, for WITHZONE
 	cmd  string
 	roam roamSwitches
 }
@@ -171,6 +176,64 @@ func parseRectArea(ltyp string, vs []string) (nvs []string, rect *geojson.Rect,
 	return
 }
 
+// parseGeohashArea parses the geohashes that follow GEOHASH, up to the end of
+// the arguments or a CLIPBY. One geohash is the bounds of its cell, and many
+// are a union of cells, in which an object must be within any one cell to be
+// within the area.
+func (s *Server) parseGeohashArea(vs []string) (nvs []string,
+	obj geojson.Object, err error,
+) {
+	var rects []geometry.Rect
+	for len(vs) > 0 && strings.ToLower(vs[0]) != "clipby" {
+		hash := vs[0]
+		vs = vs[1:]
+		if hash == "" || geohash.Validate(hash) != nil {
+			err = errInvalidArgument(hash)
+			return
+		}
+		box := geohash.BoundingBox(hash)
+		rects = append(rects, geometry.Rect{
+			Min: geometry.Point{X: box.MinLng, Y: box.MinLat},
+			Max: geometry.Point{X: box.MaxLng, Y: box.MaxLat},
+		})
+	}
+	if len(rects) == 0 {
+		err = errInvalidNumberOfArguments
+		return
+	}
+	return vs, s.rectsArea(rects), nil
+}
+
+// rectsArea returns the area covered by one or more rects. A single rect is
+// kept as is, and more become a multipolygon.
+func (s *Server) rectsArea(rects []geometry.Rect) geojson.Object {
+	if len(rects) == 1 {
+		return geojson.NewRect(rects[0])
+	}
+	polys := make([]*geometry.Poly, len(rects))
+	for i, rect := range rects {
+		polys[i] = geometry.NewPoly([]geometry.Point{
+			rect.Min, {X: rect.Max.X, Y: rect.Min.Y}, rect.Max,
+			{X: rect.Min.X, Y: rect.Max.Y}, rect.Min,
+		}, nil, &s.geomIndexOpts)
+	}
+	return geojson.NewMultiPolygon(polys)
+}
+
+// antimeridianArea returns the area for bounds. Bounds with a min longitude
+// that is greater than the max longitude cross the antimeridian, and are split
+// into a rect on each side of it.
+func (s *Server) antimeridianArea(rect *geojson.Rect) geojson.Object {
+	r := rect.Rect()
+	if r.Min.X <= r.Max.X {
+		return rect
+	}
+	return s.rectsArea([]geometry.Rect{
+		{Min: r.Min, Max: geometry.Point{X: 180, Y: r.Max.Y}},
+		{Min: geometry.Point{X: -180, Y: r.Min.Y}, Max: r.Max},
+	})
+}
+
 func (s *Server) cmdSearchArgs(
 	fromFenceCmd bool, cmd string, vs []string, types map[string]bool,
 ) (lfs liveFenceSwitches, err error) {
@@ -182,6 +245,9 @@ func (s *Server) cmdSearchArgs(
 	if err != nil {
 		return
 	}
+	if !t.hasmetric {
+		t.metric = s.config.distanceMetric()
+	}
 	lfs.searchScanBaseTokens = t
 	var typ string
 	var ok bool
@@ -240,6 +306,11 @@ func (s *Server) cmdSearchArgs(
 			} else {
 				meters = -1
 			}
+			if lfs.hasmaxdist && (meters < 0 || lfs.maxdist < meters) {
+				// The radius is where the search stops, so the closer
+				// cutoff wins.
+				meters = lfs.maxdist
+			}
 			// Nearby used the Circle type
 			lfs.obj = geojson.NewCircle(geometry.Point{X: lon, Y: lat}, meters, defaultCircleSteps)
 		} else {
@@ -289,7 +360,7 @@ func (s *Server) cmdSearchArgs(
 			err = errInvalidNumberOfArguments
 			return
 		}
-		lfs.obj, err = geojson.Parse(obj, &s.geomParseOpts)
+		lfs.obj, err = s.parseObject(obj)
 		if err != nil {
 			return
 		}
@@ -354,7 +425,14 @@ func (s *Server) cmdSearchArgs(
 			return
 		}
 	case "bounds", "hash", "tile", "quadkey":
-		vs, lfs.obj, err = parseRectArea(ltyp, vs)
+		var rect *geojson.Rect
+		vs, rect, err = parseRectArea(ltyp, vs)
+		if err != nil {
+			return
+		}
+		lfs.obj = s.antimeridianArea(rect)
+	case "geohash":
+		vs, lfs.obj, err = s.parseGeohashArea(vs)
 		if err != nil {
 			return
 		}
@@ -416,6 +494,11 @@ func (s *Server) cmdSearchArgs(
 		}
 	}
 
+	if lfs.armkey != "" && lfs.roam.on {
+		err = errors.New("ARM is not allowed for ROAM")
+		return
+	}
+
 	var clip_rect *geojson.Rect
 	var tok, ltok string
 	for len(vs) > 0 {
@@ -450,21 +533,49 @@ func (s *Server) cmdSearchArgs(
 	}
 
 	if lfs.hasbuffer {
-		lfs.obj, err = buffer.Simple(lfs.obj, lfs.buffer)
+		if lfs.withzone {
+			lfs.core = lfs.obj
+		}
+		if lfs.buffer < 0 {
+			lfs.obj, lfs.eroded, err = erodeArea(lfs.obj, -lfs.buffer)
+			if err == nil && lfs.eroded && lfs.fence {
+				err = errors.New("BUFFER erodes the whole area of the FENCE")
+			}
+		} else {
+			lfs.obj, err = buffer.Simple(lfs.obj, lfs.buffer)
+		}
 		if err != nil {
 			return
 		}
-
 	}
 	return
 }
 
+// erodeArea shrinks an area by meters, which is what a negative BUFFER does.
+// Only circles can be eroded, by shrinking the radius. The eroded result is
+// true when nothing is left of the area.
+func erodeArea(obj geojson.Object, meters float64) (
+	geojson.Object, bool, error,
+) {
+	circle, ok := obj.(*geojson.Circle)
+	if !ok {
+		return nil, false, errors.New("negative BUFFER is only supported " +
+			"for CIRCLE areas")
+	}
+	radius := circle.Meters() - meters
+	if radius < 0 {
+		return obj, true, nil
+	}
+	return geojson.NewCircle(circle.Center(), radius, defaultCircleSteps),
+		false, nil
+}
+
 var nearbyTypes = map[string]bool{
 	"point": true,
 }
 var withinOrIntersectsTypes = map[string]bool{
-	"geo": true, "bounds": true, "hash": true, "tile": true, "quadkey": true,
-	"get": true, "object": true, "circle": true, "point": true, "sector": true,
+	"geo": true, "bounds": true, "hash": true, "geohash": true, "tile": true,
+	"quadkey": true, "get": true, "object": true, "circle": true, "point": true, "sector": true,
 }
 
 func (s *Server) cmdNearby(msg *Message) (res resp.Value, err error) {
@@ -489,22 +600,57 @@ func (s *Server) cmdNearby(msg *Message) (res resp.Value, err error) {
 	if sargs.fence {
 		return NOMessage, sargs
 	}
+	if sargs.hasheading || sargs.alongkey != "" {
+		// the relative bearing and the along distance are reported with the
+		// distance
+		sargs.distance = true
+	}
+	var line *geometry.Line
+	if sargs.alongkey != "" {
+		if line, err = s.referenceLine(sargs.alongkey, sargs.alongid); err != nil {
+			return NOMessage, err
+		}
+	}
 	sw, err := s.newScanWriter(
 		wr, msg, sargs.key, sargs.output, sargs.precision, sargs.globs, false,
 		sargs.cursor, sargs.limit, sargs.wheres, sargs.whereins, sargs.whereevals, sargs.nofields)
 	if err != nil {
 		return NOMessage, err
 	}
+	if err := s.checkStrictKey(sw, sargs.strict); err != nil {
+		return NOMessage, err
+	}
+	sw.grid = sargs.grid
+	sw.hashCover = sargs.hashCover
+	sw.mvt = newMVTLayer(sargs.searchScanBaseTokens)
+	sw.csv = newCSVWriter(sargs.searchScanBaseTokens)
+	sw.simplify = s.newSimplifier(sargs.searchScanBaseTokens)
+	sw.ttls = newTTLFilter(sargs.searchScanBaseTokens)
+	sw.distinct = s.newDistinctCounter(sargs.searchScanBaseTokens)
+	sw.join = s.newObjectJoin(sargs.searchScanBaseTokens)
+	sw.setRegexps(sargs.regexps)
 	if msg.OutputType == JSON {
 		wr.WriteString(`{"ok":true`)
 	}
 	var ierr error
 	if sw.col != nil {
 		iterStep := func(o *object.Object, dist float64) bool {
+			var bearing, along float64
+			if sargs.hasheading {
+				bearing = relativeBearing(sargs.metric, sargs.obj, o.Geo(),
+					sargs.heading)
+			}
+			if line != nil {
+				along = alongDistance(sargs.metric, line, o.Geo())
+			}
 			keepGoing, err := sw.pushObject(ScanWriterParams{
 				obj:             o,
 				dist:            dist,
 				distOutput:      sargs.distance,
+				bearing:         bearing,
+				bearingOutput:   sargs.hasheading,
+				along:           along,
+				alongOutput:     line != nil,
 				ignoreGlobMatch: true,
 				skipTesting:     true,
 			})
@@ -525,12 +671,12 @@ func (s *Server) cmdNearby(msg *Message) (res resp.Value, err error) {
 			iter := func(o *object.Object) bool {
 				var dist float64
 				if sargs.distance {
-					dist = o.Geo().Distance(sargs.obj)
+					dist = objectDistance(sargs.metric, o.Geo(), sargs.obj)
 				}
 				return iterStep(o, dist)
 			}
 			sw.col.Intersects(sargs.obj, sargs.sparse, sw, msg.Deadline, iter)
-		} else {
+		} else if sargs.metric == geodesic.Haversine {
 			iter := func(o *object.Object, dist float64) bool {
 				if maxDist > 0 && dist > maxDist {
 					return false
@@ -542,17 +688,175 @@ func (s *Server) cmdNearby(msg *Message) (res resp.Value, err error) {
 				return iterStep(o, meters)
 			}
 			sw.col.Nearby(sargs.obj, sw, msg.Deadline, iter)
+		} else {
+			iter := func(o *object.Object, dist float64) bool {
+				var meters float64
+				if sargs.distance {
+					meters = dist
+				}
+				return iterStep(o, meters)
+			}
+			nearbyMetric(sw, sargs.obj, sargs.metric, maxDist, msg.Deadline,
+				iter)
 		}
 	}
 	if ierr != nil {
 		return retrerr(ierr)
 	}
 	sw.writeFoot()
-	if msg.OutputType == JSON {
-		wr.WriteString(`,"elapsed":"` + time.Since(start).String() + "\"}")
-		return resp.BytesValue(wr.Bytes()), nil
+	return writeResult(msg, &sargs.searchScanBaseTokens, wr, sw.respOut, start)
+}
+
+// objectDistance returns the distance in meters between the centers of two
+// objects using the provided metric.
+func objectDistance(metric geodesic.Metric, a, b geojson.Object) float64 {
+	ca, cb := a.Center(), b.Center()
+	return metric.Distance(ca.Y, ca.X, cb.Y, cb.X)
+}
+
+// relativeBearing returns the bearing in degrees from the center of the
+// target to the center of the object, relative to a heading, using the
+// provided metric. The result is in the range (-180, 180], where 0 is
+// straight ahead, negative values are to the left, positive values are to
+// the right, and 180 is directly behind.
+func relativeBearing(metric geodesic.Metric, target, obj geojson.Object,
+	heading float64,
+) float64 {
+	a, b := target.Center(), obj.Center()
+	bearing := math.Mod(metric.Bearing(a.Y, a.X, b.Y, b.X)-heading, 360)
+	if bearing <= -180 {
+		bearing += 360
+	} else if bearing > 180 {
+		bearing -= 360
+	}
+	return bearing
+}
+
+// referenceLine returns the line of a linestring object, for ALONG.
+func (s *Server) referenceLine(key, id string) (*geometry.Line, error) {
+	col, _ := s.cols.Get(key)
+	if col == nil {
+		return nil, errKeyNotFound
+	}
+	o := col.Get(id)
+	if o == nil {
+		return nil, errIDNotFound
+	}
+	ls, ok := o.Geo().(*geojson.LineString)
+	if !ok {
+		return nil, errNotLineString
+	}
+	return ls.Base(), nil
+}
+
+// alongDistance returns the distance in meters along a line, from its first
+// point to the point of the line that is nearest to the center of an object.
+// The nearest point of each segment is found on a flat projection around the
+// object, and all distances are measured with the metric.
+func alongDistance(metric geodesic.Metric, line *geometry.Line,
+	obj geojson.Object,
+) float64 {
+	c := obj.Center()
+	scale := math.Cos(c.Y * math.Pi / 180)
+	var along, best float64
+	nearest := math.Inf(1)
+	for i := 0; i < line.NumSegments(); i++ {
+		seg := line.SegmentAt(i)
+		dx, dy := (seg.B.X-seg.A.X)*scale, seg.B.Y-seg.A.Y
+		var t float64
+		if l2 := dx*dx + dy*dy; l2 > 0 {
+			t = ((c.X-seg.A.X)*scale*dx + (c.Y-seg.A.Y)*dy) / l2
+			t = math.Max(0, math.Min(1, t))
+		}
+		p := geometry.Point{
+			X: seg.A.X + (seg.B.X-seg.A.X)*t,
+			Y: seg.A.Y + (seg.B.Y-seg.A.Y)*t,
+		}
+		if d := metric.Distance(c.Y, c.X, p.Y, p.X); d < nearest {
+			nearest = d
+			best = along + metric.Distance(seg.A.Y, seg.A.X, p.Y, p.X)
+		}
+		along += metric.Distance(seg.A.Y, seg.A.X, seg.B.Y, seg.B.X)
+	}
+	return best
+}
+
+// nearbyMetric runs a NEARBY search for a metric other than Haversine. The
+// index is ordered by spherical distances, which may differ from the metric
+// by up to MaxSphericalError. The candidates are held back until no later
+// one can be nearer, so they are passed to iter in order of the metric, and
+// the cursor is applied in that order too.
+func nearbyMetric(sw *scanWriter, target geojson.Object,
+	metric geodesic.Metric, maxDist float64, dl *deadline.Deadline,
+	iter func(o *object.Object, dist float64) bool,
+) {
+	offset := sw.Offset()
+	sw.Step(offset)
+	var count uint64
+	var pending nearbyQueue
+	alive := true
+	emit := func(c nearbyCandidate) {
+		count++
+		if count <= offset {
+			return
+		}
+		sw.Step(1)
+		alive = iter(c.obj, c.dist)
+	}
+	sw.col.Nearby(target, nil, dl,
+		func(o *object.Object, dist float64) bool {
+			if maxDist > 0 && dist > maxDist/(1-geodesic.MaxSphericalError) {
+				return false
+			}
+			// a later candidate is no nearer than this under the metric
+			for alive && pending.Len() > 0 &&
+				pending[0].dist <= dist*(1-geodesic.MaxSphericalError) {
+				emit(heap.Pop(&pending).(nearbyCandidate))
+			}
+			if !alive {
+				return false
+			}
+			mdist := nearbyDistance(metric, o, target)
+			if maxDist <= 0 || mdist <= maxDist {
+				heap.Push(&pending, nearbyCandidate{o, mdist})
+			}
+			return true
+		},
+	)
+	for alive && pending.Len() > 0 {
+		emit(heap.Pop(&pending).(nearbyCandidate))
 	}
-	return sw.respOut, nil
+}
+
+type nearbyCandidate struct {
+	obj  *object.Object
+	dist float64
+}
+
+// nearbyQueue is a min-heap of candidates, by distance.
+type nearbyQueue []nearbyCandidate
+
+func (q nearbyQueue) Len() int           { return len(q) }
+func (q nearbyQueue) Less(i, j int) bool { return q[i].dist < q[j].dist }
+func (q nearbyQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *nearbyQueue) Push(x any)        { *q = append(*q, x.(nearbyCandidate)) }
+func (q *nearbyQueue) Pop() any {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
+
+// nearbyDistance returns the distance in meters from the center of the
+// target to the nearest point on the bounds of the object.
+func nearbyDistance(metric geodesic.Metric, o *object.Object,
+	target geojson.Object,
+) float64 {
+	center := target.Center()
+	rect := o.Rect()
+	lat := math.Max(rect.Min.Y, math.Min(rect.Max.Y, center.Y))
+	lon := math.Max(rect.Min.X, math.Min(rect.Max.X, center.X))
+	return metric.Distance(center.Y, center.X, lat, lon)
 }
 
 func (s *Server) cmdWITHIN(msg *Message) (res resp.Value, err error) {
@@ -592,48 +896,86 @@ func (s *Server) cmdWITHINorINTERSECTS(cmd string, msg *Message) (res resp.Value
 	if err != nil {
 		return NOMessage, err
 	}
+	if err := s.checkStrictKey(sw, sargs.strict); err != nil {
+		return NOMessage, err
+	}
+	sw.grid = sargs.grid
+	sw.hashCover = sargs.hashCover
+	sw.mvt = newMVTLayer(sargs.searchScanBaseTokens)
+	sw.csv = newCSVWriter(sargs.searchScanBaseTokens)
+	sw.simplify = s.newSimplifier(sargs.searchScanBaseTokens)
+	sw.ttls = newTTLFilter(sargs.searchScanBaseTokens)
+	sw.distinct = s.newDistinctCounter(sargs.searchScanBaseTokens)
+	sw.join = s.newObjectJoin(sargs.searchScanBaseTokens)
+	sw.setRegexps(sargs.regexps)
+	if sargs.hasdelta {
+		return s.writeDelta(cmd, sw, &sargs, msg, start)
+	}
+	if sargs.hascomps {
+		var comps []component
+		if sw.col != nil {
+			comps, err = s.findComponents(sw, sargs.obj, sargs.components, msg)
+			if err != nil {
+				return retrerr(err)
+			}
+		}
+		return writeComponents(comps, msg, start)
+	}
+	var history []*object.Object
+	if sargs.hasasof {
+		history, err = s.historyAt(sargs.key, sargs.asof)
+		if err != nil {
+			return retrerr(err)
+		}
+	}
 	if msg.OutputType == JSON {
 		wr.WriteString(`{"ok":true`)
 	}
 	var ierr error
-	if sw.col != nil {
+	iter := func(o *object.Object) bool {
+		params := ScanWriterParams{obj: o}
+		if cmd == "within" {
+			if sargs.withscore {
+				params.score = withinScore(sargs.obj, o.Geo())
+				params.scoreOutput = true
+			}
+			if sargs.withzone {
+				// objects that are only caught by the buffer are in the
+				// buffer zone
+				params.zone = "buffer"
+				if o.Geo().Within(sargs.core) {
+					params.zone = "core"
+				}
+			}
+		} else if sargs.clip {
+			params.clip = sargs.obj
+		}
+		keepGoing, err := sw.pushObject(params)
+		if err != nil {
+			ierr = err
+			return false
+		}
+		return keepGoing
+	}
+	if sargs.eroded {
+		// nothing is left of the area to search
+	} else if sargs.hasasof {
+		searchHistory(cmd, history, sargs.obj, sw, msg.Deadline, iter)
+	} else if sargs.sparse == 0 &&
+		sw.searchIndex(cmd, sargs.obj, msg, iter) {
+		// searched through a field index
+	} else if sw.col != nil {
 		if cmd == "within" {
-			sw.col.Within(sargs.obj, sargs.sparse, sw, msg.Deadline,
-				func(o *object.Object) bool {
-					keepGoing, err := sw.pushObject(ScanWriterParams{obj: o})
-					if err != nil {
-						ierr = err
-						return false
-					}
-					return keepGoing
-				},
-			)
+			sw.col.Within(sargs.obj, sargs.sparse, sw, msg.Deadline, iter)
 		} else if cmd == "intersects" {
-			sw.col.Intersects(sargs.obj, sargs.sparse, sw, msg.Deadline,
-				func(o *object.Object) bool {
-					params := ScanWriterParams{obj: o}
-					if sargs.clip {
-						params.clip = sargs.obj
-					}
-					keepGoing, err := sw.pushObject(params)
-					if err != nil {
-						ierr = err
-						return false
-					}
-					return keepGoing
-				},
-			)
+			sw.col.Intersects(sargs.obj, sargs.sparse, sw, msg.Deadline, iter)
 		}
 	}
 	if ierr != nil {
 		return retrerr(ierr)
 	}
 	sw.writeFoot()
-	if msg.OutputType == JSON {
-		wr.WriteString(`,"elapsed":"` + time.Since(start).String() + "\"}")
-		return resp.BytesValue(wr.Bytes()), nil
-	}
-	return sw.respOut, nil
+	return writeResult(msg, &sargs.searchScanBaseTokens, wr, sw.respOut, start)
 }
 
 func (s *Server) cmdSeachValuesArgs(vs []string) (
@@ -706,19 +1048,27 @@ func (s *Server) cmdSearch(msg *Message) (res resp.Value, err error) {
 	if err != nil {
 		return NOMessage, err
 	}
+	if err := s.checkStrictKey(sw, sargs.strict); err != nil {
+		return NOMessage, err
+	}
+	sw.ttls = newTTLFilter(sargs.searchScanBaseTokens)
+	sw.distinct = s.newDistinctCounter(sargs.searchScanBaseTokens)
+	sw.join = s.newObjectJoin(sargs.searchScanBaseTokens)
+	sw.setRegexps(sargs.regexps)
 	if msg.OutputType == JSON {
 		wr.WriteString(`{"ok":true`)
 	}
 	var ierr error
 	if sw.col != nil {
 		if sw.output == outputCount && len(sw.wheres) == 0 && sw.globEverything {
-			count := sw.col.Count() - int(sargs.cursor)
+			count := sw.col.Count() - sw.col.CountExpired(sw.now) -
+				int(sargs.cursor)
 			if count < 0 {
 				count = 0
 			}
 			sw.count = uint64(count)
 		} else {
-			limits := multiGlobParse(sw.globs, sargs.desc)
+			limits := sw.globLimits(sargs.desc)
 			if limits[0] == "" && limits[1] == "" {
 				sw.col.SearchValues(sargs.desc, sw, msg.Deadline,
 					func(o *object.Object) bool {
@@ -755,9 +1105,5 @@ func (s *Server) cmdSearch(msg *Message) (res resp.Value, err error) {
 		return retrerr(ierr)
 	}
 	sw.writeFoot()
-	if msg.OutputType == JSON {
-		wr.WriteString(`,"elapsed":"` + time.Since(start).String() + "\"}")
-		return resp.BytesValue(wr.Bytes()), nil
-	}
-	return sw.respOut, nil
+	return writeResult(msg, &sargs.searchScanBaseTokens, wr, sw.respOut, start)
 }
@@ -9,12 +9,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"runtime/debug"
 	"strconv"
@@ -23,7 +25,6 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tidwall/btree"
 	"github.com/tidwall/buntdb"
 	"github.com/tidwall/geojson"
@@ -33,9 +34,11 @@ import (
 	"github.com/tidwall/resp"
 	"github.com/tidwall/rtree"
 	"github.com/tidwall/tile38/core"
+	"github.com/tidwall/tile38/internal/aoffile"
 	"github.com/tidwall/tile38/internal/collection"
 	"github.com/tidwall/tile38/internal/deadline"
 	"github.com/tidwall/tile38/internal/endpoint"
+	"github.com/tidwall/tile38/internal/field"
 	"github.com/tidwall/tile38/internal/log"
 	"github.com/tidwall/tile38/internal/object"
 )
@@ -63,6 +66,7 @@ type commandDetails struct {
 
 	updated   bool              // object was updated
 	timestamp time.Time         // timestamp when the update occurred
+	seq       uint64            // write sequence, assigned by writeAOF
 	parent    bool              // when true, only children are forwarded
 	pattern   string            // PDEL key pattern
 	children  []*commandDetails // for multi actions such as "PDEL"
@@ -93,54 +97,87 @@ type Server struct {
 	http500Errors bool
 
 	// atomics
-	followc            atomic.Int64 // counter when follow property changes
-	statsTotalConns    atomic.Int64 // counter for total connections
-	statsTotalCommands atomic.Int64 // counter for total commands
-	statsTotalMsgsSent atomic.Int64 // counter for total sent webhook messages
-	statsExpired       atomic.Int64 // item expiration counter
+	followc            atomic.Int64  // counter when follow property changes
+	statsTotalConns    atomic.Int64  // counter for total connections
+	statsTotalCommands atomic.Int64  // counter for total commands
+	statsTotalMsgsSent atomic.Int64  // counter for total sent webhook messages
+	statsTotalMsgsDrop atomic.Int64  // counter for webhook messages given up on
+	statsExpired       atomic.Int64  // item expiration counter
+	statsCoalesced     atomic.Int64  // throttled writes that were replaced
+	statsSlowFollowers atomic.Int64  // followers disconnected for lagging
+	statsCommandRate   atomic.Uint64 // recent commands per second, float64 bits
+	statsExpireRate    atomic.Uint64 // recent expirations per second, float64 bits
 	lastShrinkDuration atomic.Int64
 	stopServer         atomic.Bool
 	outOfMemory        atomic.Bool
 	loadedAndReady     atomic.Bool // server is loaded and ready for commands
 
+	ucmds atomic.Pointer[map[string]*userCommand] // COMMANDREGISTER commands
+
 	connsmu sync.RWMutex
 	conns   map[int]*Client
 
+	heavyReads readLimiter // heavy-read-limit slots
+
 	mu sync.RWMutex
 
 	// aof
-	aof       *os.File    // active aof file
-	aofdirty  atomic.Bool // mark the aofbuf as having data
-	aofbuf    []byte      // prewrite buffer
-	aofsz     int         // active size of the aof file
-	shrinking bool        // aof shrinking flag
-	shrinklog [][]string  // aof shrinking log
+	aof       *aoffile.File // active aof file
+	aofdirty  atomic.Bool   // mark the aofbuf as having data
+	aofbuf    []byte        // prewrite buffer
+	aofsz     int           // active size of the aof file
+	shrinking bool          // aof shrinking flag
+	shrinklog [][]string    // aof shrinking log
 
 	// database
 	qdb  *buntdb.DB // hook queue log
 	qidx uint64     // hook queue log last idx
-
-	cols *btree.Map[string, *collection.Collection] // data collections
+	hseq uint64     // registration order of the last new hook
+
+	cols     *btree.Map[string, *collection.Collection] // data collections
+	tracks   map[string]*keyTracker                     // TRACK field histories
+	moves    map[string]map[string]*movement            // KEEPPREV previous geometries
+	defaults map[string]field.List                      // KEYDEFAULTS default fields
+	dedups   map[string]*geomDedup                      // DEDUP shared geometries
+	indexes  map[string]map[string]bool                 // SETINDEX indexed fields
+	preexps  map[string]time.Duration                   // PREEXPIRE lead times
+	preexpd  map[string]preExpireCursor                 // pre-expire sent -- key -> cursor
+	tombs    map[string]map[string]int64                // deleted ids -- key -> id -> time
+	hist     map[string]objectHistory                   // retained object states
+	hstart   int64                                      // when history retention started
+	owrites  map[string]map[string]*objectWrite         // throttled writes -- key -> id -> write
+	opending int                                        // number of pending throttled writes
+	wseq     uint64                                     // sequence of the last write
+
+	expireNext    string // collection where the next expiration tick starts
+	expireBacklog int    // expired objects that are waiting to be deleted
+	expireLimit   int    // number of objects the next tick may expire
 
 	hooks        *btree.BTree // hook name -- [string]*Hook
 	hookCross    *rtree.RTree // hook spatial tree for "cross" geofences
 	hookTree     *rtree.RTree // hook spatial tree for all
 	hooksOut     *btree.BTree // hooks with "outside" detection -- [string]*Hook
+	hooksPop     *btree.BTree // hooks with a POPULATION count -- [string]*Hook
 	groupHooks   *btree.BTree // hooks that are connected to objects
 	groupObjects *btree.BTree // objects that are connected to hooks
 	hookExpires  *btree.BTree // queue of all hooks marked for expiration
 
 	// followers (external aof readers)
-	follows  map[*bytes.Buffer]bool
-	fcond    *sync.Cond
-	lstack   []*commandDetails
-	lives    map[*liveBuffer]bool
-	lcond    *sync.Cond // live geofence signal
-	faofsz   int        // last reported aofsize
-	fcup     bool       // follow caught up
-	fcuponce bool       // follow caught up once
-	aofconnM map[net.Conn]io.Closer
-	pubq     pubQueue
+	follows   map[*bytes.Buffer]bool
+	fcond     *sync.Cond
+	lstack    []*commandDetails
+	lives     map[*liveBuffer]bool
+	lcond     *sync.Cond  // live geofence signal
+	faofsz    int         // bytes of the leader's aof that have been read
+	fleadsz   int         // last known leader aofsize
+	fcup      bool        // follow caught up
+	fcuponce  bool        // follow caught up once
+	freplay   bool        // applying a command from a leader
+	frelaypub bool        // leader relays PUBLISH through the follow stream
+	fups      []*upstream // leaders, when following more than one
+	aofconnM  map[net.Conn]*aofConn
+	pubq      pubQueue
+	fapply    atomic.Int64 // bytes read from leaders, but not applied yet
 
 	// lua scripts
 	luascripts *lScriptMap
@@ -152,6 +189,16 @@ type Server struct {
 	// monitor connections (using the MONITOR command)
 	monconnsMu sync.RWMutex
 	monconns   map[net.Conn]bool
+
+	// snapshots for polling clients (WITHIN/INTERSECTS DELTA)
+	deltamu  sync.Mutex
+	deltas   map[string]*deltaSnapshot
+	deltaq   []deltaIssued // tokens in the order that they were issued
+	deltaIDs int           // ids of all of the snapshots
+
+	// compiled MATCH RE patterns
+	rxmu    sync.Mutex
+	rxcache map[string]*regexp.Regexp
 }
 
 // Options for Serve()
@@ -178,11 +225,19 @@ type Options struct {
 	// AppendFileName allows for custom appendonly file path
 	AppendFileName string
 
+	// AppendCompress stores a new appendonly file compressed.
+	AppendCompress bool
+
 	// QueueFileName allows for custom queue.db file path
 	QueueFileName string
 
 	// Shutdown allows for shutting down the server.
 	Shutdown <-chan bool
+
+	// DrainTimeout is how long a shutdown waits for the client connections
+	// to finish their in-flight commands before they are force-closed. Zero
+	// closes them right away.
+	DrainTimeout time.Duration
 }
 
 // Serve starts a new tile38 server
@@ -220,15 +275,27 @@ func Serve(opts Options) error {
 		lcond:     sync.NewCond(&sync.Mutex{}),
 		hooks:     btree.NewNonConcurrent(byHookName),
 		hooksOut:  btree.NewNonConcurrent(byHookName),
+		hooksPop:  btree.NewNonConcurrent(byHookName),
 		hookCross: &rtree.RTree{},
 		hookTree:  &rtree.RTree{},
-		aofconnM:  make(map[net.Conn]io.Closer),
+		aofconnM:  make(map[net.Conn]*aofConn),
 		started:   time.Now(),
 		conns:     make(map[int]*Client),
 		http:      opts.UseHTTP,
 		pubsub:    newPubsub(),
 		monconns:  make(map[net.Conn]bool),
 		cols:      &btree.Map[string, *collection.Collection]{},
+		tracks:    make(map[string]*keyTracker),
+		moves:     make(map[string]map[string]*movement),
+		defaults:  make(map[string]field.List),
+		dedups:    make(map[string]*geomDedup),
+		indexes:   make(map[string]map[string]bool),
+		preexps:   make(map[string]time.Duration),
+		preexpd:   make(map[string]preExpireCursor),
+		tombs:     make(map[string]map[string]int64),
+		hist:      make(map[string]objectHistory),
+		owrites:   make(map[string]map[string]*objectWrite),
+		deltas:    make(map[string]*deltaSnapshot),
 
 		groupHooks:   btree.NewNonConcurrent(byGroupHook),
 		groupObjects: btree.NewNonConcurrent(byGroupObject),
@@ -250,6 +317,8 @@ func Serve(opts Options) error {
 	if err != nil {
 		return err
 	}
+	s.epc.SetPoolSize(s.config.webhookWorkers(), s.config.webhookMaxInFlight())
+	s.epc.SetClientCerts(s.config.hookClientCerts())
 
 	// Send "500 Internal Server" error instead of "200 OK" for json responses
 	// with `"ok":false`. T38HTTP500ERRORS=1
@@ -320,6 +389,7 @@ func Serve(opts Options) error {
 		s.stopServer.Store(true)
 		log.Warnf("Shutting down...")
 		fstop.Store(true)
+		s.followc.Add(1) // this will force any follow communication to die
 		s.lnmu.Lock()
 		ln := s.ln
 		s.ln = nil
@@ -363,11 +433,14 @@ func Serve(opts Options) error {
 		return err
 	}
 	if opts.AppendOnly {
-		f, err := os.OpenFile(opts.AppendFileName, os.O_CREATE|os.O_RDWR, 0600)
+		f, err := aoffile.Open(opts.AppendFileName, opts.AppendCompress)
 		if err != nil {
 			return err
 		}
 		s.aof = f
+		if opts.AppendCompress && !f.Compressed() {
+			log.Warnf("AOF is not compressed, run AOFSHRINK to compress it")
+		}
 		if err := s.loadAOF(); err != nil {
 			return err
 		}
@@ -384,8 +457,7 @@ func Serve(opts Options) error {
 		bgwg.Add(1)
 		go func() {
 			defer bgwg.Done()
-			s.follow(s.config.followHost(), s.config.followPort(),
-				int(s.followc.Load()))
+			s.followAll(int(s.followc.Load()))
 		}()
 	}
 
@@ -424,7 +496,19 @@ func Serve(opts Options) error {
 	bgwg.Add(1)
 	go s.backgroundSyncAOF(&bgwg)
 	bgwg.Add(1)
+	go s.backgroundFlushAOF(&bgwg)
+	bgwg.Add(1)
 	go s.startPublishQueue(&bgwg)
+	bgwg.Add(1)
+	go s.watchCommandRate(&bgwg)
+	bgwg.Add(1)
+	go s.backgroundPopulations(&bgwg)
+	bgwg.Add(1)
+	go s.backgroundTombstones(&bgwg)
+	bgwg.Add(1)
+	go s.backgroundHistory(&bgwg)
+	bgwg.Add(1)
+	go s.backgroundObjectWrites(&bgwg)
 	defer func() {
 		log.Debug("Stopping background routines")
 		// Stop background routines
@@ -435,6 +519,12 @@ func Serve(opts Options) error {
 			mln.Close() // Stop the metrics server
 		}
 		bgwg.Wait()
+		// write out what's left of the aof buffer
+		s.mu.Lock()
+		if s.aof != nil {
+			s.flushAOF(true)
+		}
+		s.mu.Unlock()
 	}()
 
 	// Server is now loaded and ready. Wait for network error messages.
@@ -456,6 +546,44 @@ func (s *Server) isProtected() bool {
 	return is
 }
 
+// drainConns closes the client connections and waits for them to finish.
+// Commands that are in-flight are allowed to complete and write their
+// response, up to the drain timeout, after which the connections are
+// force-closed.
+func (s *Server) drainConns(wg *sync.WaitGroup) {
+	type readDeadliner interface {
+		SetReadDeadline(t time.Time) error
+	}
+	s.connsmu.RLock()
+	for _, c := range s.conns {
+		if conn, ok := c.closer.(readDeadliner); ok && s.opts.DrainTimeout > 0 {
+			// an idle connection returns from its read right away, and a
+			// busy one does so after its response has been written.
+			conn.SetReadDeadline(time.Now())
+		} else {
+			c.closer.Close()
+		}
+	}
+	s.connsmu.RUnlock()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return
+	case <-time.After(s.opts.DrainTimeout):
+	}
+	s.connsmu.RLock()
+	log.Warnf("Drain timeout, force closing %d connections", len(s.conns))
+	for _, c := range s.conns {
+		c.closer.Close()
+	}
+	s.connsmu.RUnlock()
+	<-done
+}
+
 func (s *Server) netServe() error {
 	var ln net.Listener
 	var err error
@@ -476,12 +604,7 @@ func (s *Server) netServe() error {
 	var wg sync.WaitGroup
 	defer func() {
 		log.Debug("Closing client connections...")
-		s.connsmu.RLock()
-		for _, c := range s.conns {
-			c.closer.Close()
-		}
-		s.connsmu.RUnlock()
-		wg.Wait()
+		s.drainConns(&wg)
 		ln.Close()
 		log.Debug("Client connection closed")
 	}()
@@ -793,6 +916,34 @@ func (s *Server) watchOutOfMemory(wg *sync.WaitGroup) {
 	})
 }
 
+// commandRateWindow is the number of seconds that the recent command rate
+// is averaged over.
+const commandRateWindow = 10
+
+// watchCommandRate samples the total commands processed and the total
+// expirations every second.
+func (s *Server) watchCommandRate(wg *sync.WaitGroup) {
+	defer wg.Done()
+	var samples [commandRateWindow + 1]int64
+	var expired [commandRateWindow + 1]int64
+	var i, n int
+	s.loopUntilServerStops(time.Second, func() {
+		samples[i%len(samples)] = s.statsTotalCommands.Load()
+		expired[i%len(expired)] = s.statsExpired.Load()
+		if n < len(samples) {
+			n++
+		}
+		if n > 1 {
+			j := (i + len(samples) - n + 1) % len(samples)
+			rate := float64(samples[i%len(samples)]-samples[j]) / float64(n-1)
+			s.statsCommandRate.Store(math.Float64bits(rate))
+			rate = float64(expired[i%len(expired)]-expired[j]) / float64(n-1)
+			s.statsExpireRate.Store(math.Float64bits(rate))
+		}
+		i++
+	})
+}
+
 func (s *Server) watchLuaStatePool(wg *sync.WaitGroup) {
 	defer wg.Done()
 	s.loopUntilServerStops(time.Second*10, func() {
@@ -810,6 +961,28 @@ func (s *Server) backgroundSyncAOF(wg *sync.WaitGroup) {
 	})
 }
 
+// backgroundFlushAOF writes the data that a compressed aof has been holding
+// on to for aofFlushDelay, which makes it available to followers. It checks
+// more often than loopUntilServerStops does, which would add up to a fifth
+// of a second to the delay.
+func (s *Server) backgroundFlushAOF(wg *sync.WaitGroup) {
+	defer wg.Done()
+	for !s.stopServer.Load() {
+		s.mu.RLock()
+		if s.aof != nil && s.aof.Compressed() {
+			flushed, err := s.aof.FlushStale(aofFlushDelay)
+			if err != nil {
+				panic(err)
+			}
+			if flushed {
+				s.fcond.Broadcast()
+			}
+		}
+		s.mu.RUnlock()
+		time.Sleep(aofFlushDelay / 5)
+	}
+}
+
 func isReservedFieldName(field string) bool {
 	switch field {
 	case "z", "lat", "lon":
@@ -838,6 +1011,12 @@ func rewriteTimeoutMsg(msg *Message) (err error) {
 	return
 }
 
+// connCommands are the commands that are handled by the connection, before
+// the command reaches the dispatch table.
+var connCommands = []string{
+	"auth", "echo", "hello", "metrics", "ping", "quit", "timeout",
+}
+
 func (s *Server) handleInputCommand(client *Client, msg *Message) error {
 	start := time.Now()
 	serializeOutput := func(res resp.Value) (string, error) {
@@ -862,6 +1041,19 @@ func (s *Server) handleInputCommand(client *Client, msg *Message) error {
 		case WebSocket:
 			return WriteWebSocketMessage(client, []byte(res))
 		case HTTP:
+			if msg.body != nil {
+				_, err := fmt.Fprintf(client, "HTTP/1.1 200 OK\r\n"+
+					"Connection: close\r\n"+
+					"Content-Length: %d\r\n"+
+					"Content-Type: %s\r\n"+
+					"Access-Control-Allow-Origin: *\r\n"+
+					"\r\n", len(msg.body), msg.bodyType)
+				if err != nil {
+					return err
+				}
+				_, err = client.Write(msg.body)
+				return err
+			}
 			status := "200 OK"
 			if (s.http500Errors || msg._command == "healthz") &&
 				!gjson.Get(res, "ok").Bool() {
@@ -898,8 +1090,7 @@ func (s *Server) handleInputCommand(client *Client, msg *Message) error {
 
 	cmd := msg.Command()
 	defer func() {
-		took := time.Since(start).Seconds()
-		cmdDurations.With(prometheus.Labels{"cmd": cmd}).Observe(took)
+		observeCommand(cmd, time.Since(start).Seconds())
 	}()
 
 	// Ping. Just send back the response. No need to put through the pipeline.
@@ -957,6 +1148,11 @@ func (s *Server) handleInputCommand(client *Client, msg *Message) error {
 		}
 	}
 
+	if cmd == "tombstone" {
+		// Tombstones are only written by the server itself.
+		return writeErr("unknown command '" + msg.Args[0] + "'")
+	}
+
 	if cmd == "hello" {
 		// Not Supporting RESP3+, returns an ERR instead.
 		return writeErr("unknown command '" + msg.Args[0] + "'")
@@ -968,7 +1164,7 @@ func (s *Server) handleInputCommand(client *Client, msg *Message) error {
 		}
 	}
 
-	var write bool
+	var write, read bool
 
 	if (!client.authd || cmd == "auth") && cmd != "output" && cmd != "healthz" {
 		if s.config.requirePass() != "" {
@@ -985,7 +1181,8 @@ func (s *Server) handleInputCommand(client *Client, msg *Message) error {
 					password = msg.Args[1]
 				}
 			}
-			if s.config.requirePass() != strings.TrimSpace(password) {
+			if s.config.requirePass() != strings.TrimSpace(password) &&
+				!s.authReplToken(client, strings.TrimSpace(password)) {
 				return writeErr("invalid password")
 			}
 			client.authd = true
@@ -994,10 +1191,39 @@ func (s *Server) handleInputCommand(client *Client, msg *Message) error {
 				return writeOutput(resStr)
 			}
 		} else if msg.Command() == "auth" {
-			return writeErr("invalid password")
+			if len(msg.Args) < 2 ||
+				!s.authReplToken(client, strings.TrimSpace(msg.Args[1])) {
+				return writeErr("invalid password")
+			}
+			client.authd = true
+			resStr, _ := serializeOutput(OKMessage(msg, start))
+			return writeOutput(resStr)
+		}
+	}
+
+	if client.allowed != nil && !client.allowed[msg.Command()] {
+		return writeErr("command '" + msg.Command() +
+			"' is not allowed on this connection")
+	}
+
+	// GET /metrics on the main port
+	if cmd == "metrics" && msg.ConnType == HTTP && s.config.httpMetrics() {
+		return s.writeHTTPMetrics(client)
+	}
+
+	// Heavy reads wait for a slot before taking the lock, so that waiting
+	// doesn't hold up writes.
+	if limit := s.config.heavyReadLimit(); limit > 0 &&
+		heavyReadCommands[msg.Command()] {
+		if !s.heavyReads.acquire(limit, s.config.heavyReadWait()) {
+			return writeErr(errServerBusy.Error())
 		}
+		defer s.heavyReads.release()
 	}
 
+	// registered commands run as scripts
+	s.rewriteUserCommand(msg)
+
 	// choose the locking strategy
 	switch msg.Command() {
 	default:
@@ -1006,43 +1232,83 @@ func (s *Server) handleInputCommand(client *Client, msg *Message) error {
 	case "set", "del", "drop", "fset", "flushdb",
 		"setchan", "pdelchan", "delchan",
 		"sethook", "pdelhook", "delhook",
-		"expire", "persist", "jset", "pdel", "rename", "renamenx":
+		"expire", "pexpire", "persist", "jset", "pdel", "mset", "rename", "renamenx",
+		"copy", "track", "untrack", "keepprev", "tracktrim", "trackappend",
+		"keydefaults", "setdelta", "dedup", "fsetwhere", "commandregister",
+		"commandunregister", "preexpire", "setindex", "delindex":
 		// write operations
 		write = true
 		s.mu.Lock()
 		defer s.mu.Unlock()
-		if s.config.followHost() != "" {
+		if s.readOnlyFollower() {
 			return writeErr("not the leader")
 		}
 		if s.config.readOnly() {
 			return writeErr("read only")
 		}
+		if msg.Command() == "set" {
+			held, err := s.throttleSet(msg)
+			if err != nil {
+				return writeErr(err.Error())
+			}
+			if held {
+				resStr, _ := serializeOutput(OKMessage(msg, start))
+				return writeOutput(resStr)
+			}
+		} else if s.opending > 0 {
+			// apply the throttled writes before anything else touches them
+			s.flushObjectWrites(time.Now(), true)
+		}
 	case "eval", "evalsha":
 		// write operations (potentially) but no AOF for the script command itself
 		s.mu.Lock()
 		defer s.mu.Unlock()
-		if s.config.followHost() != "" {
+		if s.readOnlyFollower() {
 			return writeErr("not the leader")
 		}
 		if s.config.readOnly() {
 			return writeErr("read only")
 		}
+		if s.opending > 0 {
+			s.flushObjectWrites(time.Now(), true)
+		}
 	case "get", "keys", "scan", "nearby", "within", "intersects", "hooks",
-		"chans", "search", "ttl", "bounds", "server", "info", "type", "jget",
-		"evalro", "evalrosha", "healthz", "role", "fget", "exists", "fexists":
+		"chans", "search", "ttl", "pttl", "bounds", "server", "info", "type",
+		"jget", "evalro", "evalrosha", "role", "fget", "exists",
+		"fexists",
+		"capabilities", "movement", "getkeydefaults", "indexes",
+		"density", "intersection", "lengthwithin", "hookvalidate",
+		"buffer":
 		// read operations
+		read = true
 
 		s.mu.RLock()
 		defer s.mu.RUnlock()
 		if s.config.followHost() != "" && !s.fcuponce {
 			return writeErr("catching up to leader")
 		}
-	case "follow", "slaveof", "replconf", "readonly", "config":
+	case "healthz":
+		// read operation that answers while a follower is catching up
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+	case "follow", "slaveof", "replicaof", "replconf", "readonly", "config",
+		"promote", "resync":
 		// system operations
 		// does not write to aof, but requires a write lock.
 		s.mu.Lock()
 		defer s.mu.Unlock()
-	case "output":
+	case "nodestatus":
+		// read operation that is available while catching up
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+	case "fencetest":
+		// read operation, but the fences are evaluated like a write
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.config.followHost() != "" && !s.fcuponce {
+			return writeErr("catching up to leader")
+		}
+	case "output", "restrict", "withversion":
 		// this is local connection operation. Locks not needed.
 	case "echo":
 	case "massinsert":
@@ -1055,7 +1321,7 @@ func (s *Server) handleInputCommand(client *Client, msg *Message) error {
 		// dev operation
 		s.mu.Lock()
 		defer s.mu.Unlock()
-	case "aofshrink":
+	case "aofshrink", "aofrange":
 		s.mu.RLock()
 		defer s.mu.RUnlock()
 	case "client":
@@ -1063,10 +1329,12 @@ func (s *Server) handleInputCommand(client *Client, msg *Message) error {
 		defer s.mu.Unlock()
 	case "evalna", "evalnasha":
 		// No locking for scripts, otherwise writes cannot happen within scripts
-	case "subscribe", "psubscribe", "publish":
+	case "subscribe", "psubscribe", "publish", "pubsub":
 		// No locking for pubsub
-	case "monitor":
+	case "monitor", "logsubscribe":
 		// No locking for monitor
+	case "export":
+		// No locking for export, each batch takes a read lock
 	}
 	res, d, err := func() (res resp.Value, d commandDetails, err error) {
 		if msg.Deadline != nil {
@@ -1103,6 +1371,10 @@ func (s *Server) handleInputCommand(client *Client, msg *Message) error {
 		}
 		return writeErr(err.Error())
 	}
+	if read && client.withVersion {
+		// the read lock is still held, so no write came in since the read
+		res = appendVersion(res, msg.OutputType, s.aofsz)
+	}
 	if write {
 		if err := s.writeAOF(msg.Args, &d); err != nil {
 			if _, ok := err.(errAOFHook); ok {
@@ -1138,172 +1410,256 @@ func randomKey(n int) string {
 func (s *Server) reset() {
 	s.aofsz = 0
 	s.cols.Clear()
+	s.tracks = make(map[string]*keyTracker)
+	s.moves = make(map[string]map[string]*movement)
+	s.defaults = make(map[string]field.List)
+	s.dedups = make(map[string]*geomDedup)
+	s.indexes = make(map[string]map[string]bool)
+	s.preexps = make(map[string]time.Duration)
+	s.preexpd = make(map[string]preExpireCursor)
+	s.ucmds.Store(nil)
+	s.tombs = make(map[string]map[string]int64)
+	s.hist = make(map[string]objectHistory)
+	s.hstart = 0
+	s.expireNext = ""
+	s.expireBacklog = 0
+	s.expireLimit = 0
+	s.owrites = make(map[string]map[string]*objectWrite)
+	s.opending = 0
 }
 
-func (s *Server) command(msg *Message, client *Client) (
-	res resp.Value, d commandDetails, err error,
-) {
-	switch msg.Command() {
-	default:
-		err = fmt.Errorf("unknown command '%s'", msg.Args[0])
-	case "set":
-		res, d, err = s.cmdSET(msg)
-	case "fset":
-		res, d, err = s.cmdFSET(msg)
-	case "del":
-		res, d, err = s.cmdDEL(msg)
-	case "pdel":
-		res, d, err = s.cmdPDEL(msg)
-	case "drop":
-		res, d, err = s.cmdDROP(msg)
-	case "flushdb":
-		res, d, err = s.cmdFLUSHDB(msg)
-	case "rename":
-		res, d, err = s.cmdRENAME(msg)
-	case "renamenx":
-		res, d, err = s.cmdRENAME(msg)
-	case "sethook":
-		res, d, err = s.cmdSetHook(msg)
-	case "delhook":
-		res, d, err = s.cmdDelHook(msg)
-	case "pdelhook":
-		res, d, err = s.cmdPDelHook(msg)
-	case "hooks":
-		res, err = s.cmdHooks(msg)
-	case "setchan":
-		res, d, err = s.cmdSetHook(msg)
-	case "delchan":
-		res, d, err = s.cmdDelHook(msg)
-	case "pdelchan":
-		res, d, err = s.cmdPDelHook(msg)
-	case "chans":
-		res, err = s.cmdHooks(msg)
-	case "expire":
-		res, d, err = s.cmdEXPIRE(msg)
-	case "persist":
-		res, d, err = s.cmdPERSIST(msg)
-	case "ttl":
-		res, err = s.cmdTTL(msg)
-	case "shutdown":
-		if !s.opts.DevMode {
-			err = fmt.Errorf("unknown command '%s'", msg.Args[0])
-			return
-		}
-		log.Fatal("shutdown requested by developer")
-	case "massinsert":
-		if !s.opts.DevMode {
-			err = fmt.Errorf("unknown command '%s'", msg.Args[0])
-			return
-		}
-		res, err = s.cmdMassInsert(msg)
-	case "sleep":
+// commandFunc runs a command. The details are only for commands that write.
+type commandFunc func(s *Server, msg *Message, client *Client) (resp.Value,
+	commandDetails, error)
+
+// commandTable is the dispatch table of the server, by command name. The
+// commands that are handled by the connection, like PING and AUTH, are in
+// connCommands.
+var commandTable map[string]commandFunc
+
+func init() {
+	// It's assigned in init, because some of the commands dispatch again.
+	commandTable = map[string]commandFunc{
+		"set":               withDetails((*Server).cmdSET),
+		"fset":              withDetails((*Server).cmdFSET),
+		"fsetwhere":         withDetails((*Server).cmdFSETWHERE),
+		"del":               withDetails((*Server).cmdDEL),
+		"pdel":              withDetails((*Server).cmdPDEL),
+		"mset":              withDetails((*Server).cmdMSET),
+		"drop":              withDetails((*Server).cmdDROP),
+		"flushdb":           withDetails((*Server).cmdFLUSHDB),
+		"rename":            withDetails((*Server).cmdRENAME),
+		"renamenx":          withDetails((*Server).cmdRENAME),
+		"copy":              withDetails((*Server).cmdCOPY),
+		"sethook":           withDetails((*Server).cmdSetHook),
+		"delhook":           withDetails((*Server).cmdDelHook),
+		"pdelhook":          withDetails((*Server).cmdPDelHook),
+		"hooks":             noDetails((*Server).cmdHooks),
+		"hookvalidate":      noDetails((*Server).cmdHookValidate),
+		"setchan":           withDetails((*Server).cmdSetHook),
+		"delchan":           withDetails((*Server).cmdDelHook),
+		"pdelchan":          withDetails((*Server).cmdPDelHook),
+		"chans":             noDetails((*Server).cmdHooks),
+		"expire":            withDetails((*Server).cmdEXPIRE),
+		"pexpire":           withDetails((*Server).cmdEXPIRE),
+		"persist":           withDetails((*Server).cmdPERSIST),
+		"ttl":               noDetails((*Server).cmdTTL),
+		"pttl":              noDetails((*Server).cmdTTL),
+		"shutdown":          devOnly(cmdShutdown),
+		"massinsert":        devOnly(noDetails((*Server).cmdMassInsert)),
+		"sleep":             devOnly(noDetails((*Server).cmdSleep)),
+		"follow":            noDetails((*Server).cmdFollow),
+		"slaveof":           noDetails((*Server).cmdFollow),
+		"replicaof":         noDetails((*Server).cmdFollow),
+		"replconf":          withClient((*Server).cmdReplConf),
+		"readonly":          noDetails((*Server).cmdREADONLY),
+		"promote":           noDetails((*Server).cmdPROMOTE),
+		"resync":            noDetails((*Server).cmdRESYNC),
+		"nodestatus":        noDetails((*Server).cmdNODESTATUS),
+		"fencetest":         noDetails((*Server).cmdFENCETEST),
+		"track":             withDetails((*Server).cmdTRACK),
+		"untrack":           withDetails((*Server).cmdUNTRACK),
+		"stats":             noDetails((*Server).cmdSTATS),
+		"server":            noDetails((*Server).cmdSERVER),
+		"healthz":           noDetails((*Server).cmdHEALTHZ),
+		"info":              noDetails((*Server).cmdINFO),
+		"role":              noDetails((*Server).cmdROLE),
+		"followers":         noDetails((*Server).cmdFOLLOWERS),
+		"keepprev":          withDetails((*Server).cmdKEEPPREV),
+		"tracktrim":         withDetails((*Server).cmdTRACKTRIM),
+		"trackappend":       withDetails((*Server).cmdTRACKAPPEND),
+		"setdelta":          withDetails((*Server).cmdSETDELTA),
+		"dedup":             withDetails((*Server).cmdDEDUP),
+		"preexpire":         withDetails((*Server).cmdPREEXPIRE),
+		"tombstone":         withDetails((*Server).cmdTOMBSTONE),
+		"commandregister":   withDetails((*Server).cmdCOMMANDREGISTER),
+		"commandunregister": withDetails((*Server).cmdCOMMANDUNREGISTER),
+		"movement":          noDetails((*Server).cmdMOVEMENT),
+		"keydefaults":       withDetails((*Server).cmdKEYDEFAULTS),
+		"getkeydefaults":    noDetails((*Server).cmdGETKEYDEFAULTS),
+		"setindex":          withDetails((*Server).cmdSETINDEX),
+		"delindex":          withDetails((*Server).cmdDELINDEX),
+		"indexes":           noDetails((*Server).cmdINDEXES),
+		"density":           noDetails((*Server).cmdDENSITY),
+		"intersection":      noDetails((*Server).cmdINTERSECTION),
+		"buffer":            noDetails((*Server).cmdBUFFER),
+		"lengthwithin":      noDetails((*Server).cmdLENGTHWITHIN),
+		"capabilities":      noDetails((*Server).cmdCAPABILITIES),
+		"scan":              noDetails((*Server).cmdScan),
+		"nearby":            noDetails((*Server).cmdNearby),
+		"within":            noDetails((*Server).cmdWITHIN),
+		"intersects":        noDetails((*Server).cmdINTERSECTS),
+		"search":            noDetails((*Server).cmdSearch),
+		"bounds":            noDetails((*Server).cmdBOUNDS),
+		"get":               noDetails((*Server).cmdGET),
+		"fget":              noDetails((*Server).cmdFGET),
+		"jget":              noDetails((*Server).cmdJget),
+		"jset":              withDetails((*Server).cmdJset),
+		"jdel":              withDetails((*Server).cmdJdel),
+		"type":              noDetails((*Server).cmdTYPE),
+		"keys":              noDetails((*Server).cmdKEYS),
+		"exists":            noDetails((*Server).cmdEXISTS),
+		"fexists":           noDetails((*Server).cmdFEXISTS),
+		"output":            noDetails((*Server).cmdOUTPUT),
+		"aof":               noDetails((*Server).cmdAOF),
+		"aofmd5":            noDetails((*Server).cmdAOFMD5),
+		"aofrange":          noDetails((*Server).cmdAOFRANGE),
+		"gc":                noDetails((*Server).cmdGC),
+		"aofshrink":         noDetails((*Server).cmdAOFSHRINK),
+		"config get":        noDetails((*Server).cmdConfigGet),
+		"config set":        noDetails((*Server).cmdConfigSet),
+		"config rewrite":    noDetails((*Server).cmdConfigRewrite),
+		"config":            subCommand,
+		"script":            subCommand,
+		"client":            withClient((*Server).cmdCLIENT),
+		"restrict":          withClient((*Server).cmdRESTRICT),
+		"withversion":       withClient((*Server).cmdWITHVERSION),
+		"eval":              noDetails((*Server).cmdEval),
+		"evalro":            noDetails((*Server).cmdEval),
+		"evalna":            noDetails((*Server).cmdEval),
+		"evalsha":           noDetails((*Server).cmdEvalSha),
+		"evalrosha":         noDetails((*Server).cmdEvalSha),
+		"evalnasha":         noDetails((*Server).cmdEvalSha),
+		"script load":       noDetails((*Server).cmdScriptLoad),
+		"script exists":     noDetails((*Server).cmdScriptExists),
+		"script flush":      noDetails((*Server).cmdScriptFlush),
+		"subscribe":         noDetails((*Server).cmdSubscribe),
+		"psubscribe":        noDetails((*Server).cmdPsubscribe),
+		"publish":           noDetails((*Server).cmdPublish),
+		"pubsub":            noDetails((*Server).cmdPubsub),
+		"test":              noDetails((*Server).cmdTEST),
+		"monitor":           noDetails((*Server).cmdMonitor),
+		"logsubscribe":      noDetails((*Server).cmdLOGSUBSCRIBE),
+		"export":            noDetails((*Server).cmdEXPORT),
+	}
+}
+
+func withDetails(fn func(s *Server, msg *Message) (resp.Value, commandDetails,
+	error),
+) commandFunc {
+	return func(s *Server, msg *Message, _ *Client) (resp.Value,
+		commandDetails, error,
+	) {
+		return fn(s, msg)
+	}
+}
+
+func noDetails(fn func(s *Server, msg *Message) (resp.Value, error),
+) commandFunc {
+	return func(s *Server, msg *Message, _ *Client) (resp.Value,
+		commandDetails, error,
+	) {
+		res, err := fn(s, msg)
+		return res, commandDetails{}, err
+	}
+}
+
+func withClient(fn func(s *Server, msg *Message, client *Client) (resp.Value,
+	error),
+) commandFunc {
+	return func(s *Server, msg *Message, client *Client) (resp.Value,
+		commandDetails, error,
+	) {
+		res, err := fn(s, msg, client)
+		return res, commandDetails{}, err
+	}
+}
+
+// devOnly is for the commands that are unknown unless in dev mode.
+func devOnly(fn commandFunc) commandFunc {
+	return func(s *Server, msg *Message, client *Client) (resp.Value,
+		commandDetails, error,
+	) {
 		if !s.opts.DevMode {
-			err = fmt.Errorf("unknown command '%s'", msg.Args[0])
-			return
-		}
-		res, err = s.cmdSleep(msg)
-	case "follow", "slaveof":
-		res, err = s.cmdFollow(msg)
-	case "replconf":
-		res, err = s.cmdReplConf(msg, client)
-	case "readonly":
-		res, err = s.cmdREADONLY(msg)
-	case "stats":
-		res, err = s.cmdSTATS(msg)
-	case "server":
-		res, err = s.cmdSERVER(msg)
-	case "healthz":
-		res, err = s.cmdHEALTHZ(msg)
-	case "info":
-		res, err = s.cmdINFO(msg)
-	case "role":
-		res, err = s.cmdROLE(msg)
-	case "scan":
-		res, err = s.cmdScan(msg)
-	case "nearby":
-		res, err = s.cmdNearby(msg)
-	case "within":
-		res, err = s.cmdWITHIN(msg)
-	case "intersects":
-		res, err = s.cmdINTERSECTS(msg)
-	case "search":
-		res, err = s.cmdSearch(msg)
-	case "bounds":
-		res, err = s.cmdBOUNDS(msg)
-	case "get":
-		res, err = s.cmdGET(msg)
-	case "fget":
-		res, err = s.cmdFGET(msg)
-	case "jget":
-		res, err = s.cmdJget(msg)
-	case "jset":
-		res, d, err = s.cmdJset(msg)
-	case "jdel":
-		res, d, err = s.cmdJdel(msg)
-	case "type":
-		res, err = s.cmdTYPE(msg)
-	case "keys":
-		res, err = s.cmdKEYS(msg)
-	case "exists":
-		res, err = s.cmdEXISTS(msg)
-	case "fexists":
-		res, err = s.cmdFEXISTS(msg)
-	case "output":
-		res, err = s.cmdOUTPUT(msg)
-	case "aof":
-		res, err = s.cmdAOF(msg)
-	case "aofmd5":
-		res, err = s.cmdAOFMD5(msg)
-	case "gc":
-		runtime.GC()
-		debug.FreeOSMemory()
-		res = OKMessage(msg, time.Now())
-	case "aofshrink":
-		go s.aofshrink()
-		res = OKMessage(msg, time.Now())
-	case "config get":
-		res, err = s.cmdConfigGet(msg)
-	case "config set":
-		res, err = s.cmdConfigSet(msg)
-	case "config rewrite":
-		res, err = s.cmdConfigRewrite(msg)
-	case "config", "script":
-		// These get rewritten into "config foo" and "script bar"
-		err = fmt.Errorf("unknown command '%s'", msg.Args[0])
-		if len(msg.Args) > 1 {
-			msg.Args[1] = msg.Args[0] + " " + msg.Args[1]
-			msg.Args = msg.Args[1:]
-			msg._command = ""
-			return s.command(msg, client)
+			return resp.Value{}, commandDetails{}, errUnknownCommand(msg)
 		}
-	case "client":
-		res, err = s.cmdCLIENT(msg, client)
-	case "eval", "evalro", "evalna":
-		res, err = s.cmdEvalUnified(false, msg)
-	case "evalsha", "evalrosha", "evalnasha":
-		res, err = s.cmdEvalUnified(true, msg)
-	case "script load":
-		res, err = s.cmdScriptLoad(msg)
-	case "script exists":
-		res, err = s.cmdScriptExists(msg)
-	case "script flush":
-		res, err = s.cmdScriptFlush(msg)
-	case "subscribe":
-		res, err = s.cmdSubscribe(msg)
-	case "psubscribe":
-		res, err = s.cmdPsubscribe(msg)
-	case "publish":
-		res, err = s.cmdPublish(msg)
-	case "test":
-		res, err = s.cmdTEST(msg)
-	case "monitor":
-		res, err = s.cmdMonitor(msg)
+		return fn(s, msg, client)
+	}
+}
+
+// subCommand runs the sub commands of CONFIG and SCRIPT, like "config get"
+// and "script load".
+func subCommand(s *Server, msg *Message, client *Client) (resp.Value,
+	commandDetails, error,
+) {
+	if len(msg.Args) < 2 {
+		return resp.Value{}, commandDetails{}, errUnknownCommand(msg)
 	}
+	msg.Args[1] = msg.Args[0] + " " + msg.Args[1]
+	msg.Args = msg.Args[1:]
+	msg._command = ""
+	return s.dispatch(msg, client)
+}
+
+func cmdShutdown(s *Server, msg *Message, client *Client) (resp.Value,
+	commandDetails, error,
+) {
+	log.Fatal("shutdown requested by developer")
+	return resp.Value{}, commandDetails{}, nil
+}
+
+func (s *Server) cmdGC(msg *Message) (resp.Value, error) {
+	runtime.GC()
+	debug.FreeOSMemory()
+	return OKMessage(msg, time.Now()), nil
+}
+
+func (s *Server) cmdAOFSHRINK(msg *Message) (resp.Value, error) {
+	go s.aofshrink()
+	return OKMessage(msg, time.Now()), nil
+}
+
+func (s *Server) cmdEval(msg *Message) (resp.Value, error) {
+	return s.cmdEvalUnified(false, msg)
+}
+
+func (s *Server) cmdEvalSha(msg *Message) (resp.Value, error) {
+	return s.cmdEvalUnified(true, msg)
+}
 
+func errUnknownCommand(msg *Message) error {
+	return fmt.Errorf("unknown command '%s'", msg.Args[0])
+}
+
+func (s *Server) command(msg *Message, client *Client) (
+	res resp.Value, d commandDetails, err error,
+) {
+	res, d, err = s.dispatch(msg, client)
 	s.sendMonitor(err, msg, client, false)
 	return
 }
 
+// dispatch runs a command from the dispatch table.
+func (s *Server) dispatch(msg *Message, client *Client) (resp.Value,
+	commandDetails, error,
+) {
+	fn, ok := commandTable[msg.Command()]
+	if !ok {
+		return resp.Value{}, commandDetails{}, errUnknownCommand(msg)
+	}
+	return fn(s, msg, client)
+}
+
 // This phrase is copied nearly verbatim from Redis.
 var deniedMessage = []byte(strings.Replace(strings.TrimSpace(`
 -DENIED Tile38 is running in protected mode because protected mode is enabled,
@@ -1385,6 +1741,8 @@ type Message struct {
 	OutputType Type
 	Auth       string
 	Deadline   *deadline.Deadline
+	body       []byte // binary body of an HTTP response, such as a tile
+	bodyType   string // content type of the body
 }
 
 // Command returns the first argument as a lowercase string
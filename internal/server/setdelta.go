@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/resp"
+	"github.com/tidwall/sjson"
+)
+
+// deltaScale is the size of one unit of a SETDELTA offset, in degrees.
+const deltaScale = 1e7
+
+var errNotPoint = errors.New("object is not a point")
+
+// parseDelta returns the latitude and longitude offsets, in degrees, of an
+// encoded delta. The delta is two integers, "dlat,dlon", in units of one ten
+// millionth of a degree.
+func parseDelta(delta string) (dlat, dlon float64, ok bool) {
+	slat, slon, ok := strings.Cut(delta, ",")
+	if !ok {
+		return 0, 0, false
+	}
+	ilat, err := strconv.ParseInt(slat, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	ilon, err := strconv.ParseInt(slon, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return float64(ilat) / deltaScale, float64(ilon) / deltaScale, true
+}
+
+// SETDELTA key id dlat,dlon
+func (s *Server) cmdSETDELTA(msg *Message) (resp.Value, commandDetails, error) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 4 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	key, id := args[1], args[2]
+	dlat, dlon, ok := parseDelta(args[3])
+	if !ok {
+		return retwerr(errInvalidArgument(args[3]))
+	}
+
+	// >> Operation
+
+	col, _ := s.cols.Get(key)
+	if col == nil {
+		return retwerr(errKeyNotFound)
+	}
+	o := col.Get(id)
+	if o == nil {
+		return retwerr(errIDNotFound)
+	}
+	switch o.Geo().(type) {
+	case *geojson.Point, *geojson.SimplePoint:
+	default:
+		return retwerr(errNotPoint)
+	}
+	// The new position is rounded to the delta units, so that a long run of
+	// deltas doesn't drift.
+	center := o.Geo().Center()
+	lat := math.Round((center.Y+dlat)*deltaScale) / deltaScale
+	lon := math.Round((center.X+dlon)*deltaScale) / deltaScale
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return retwerr(errInvalidArgument(args[3]))
+	}
+	// any elevation and other members of the point are kept
+	json, err := sjson.Delete(o.Geo().JSON(), "bbox")
+	if err != nil {
+		return retwerr(err)
+	}
+	json, _ = sjson.Set(json, "coordinates.0", lon)
+	json, _ = sjson.Set(json, "coordinates.1", lat)
+	d, err := s.setTrack(key, id, o, json)
+	if err != nil {
+		return retwerr(err)
+	}
+	// The followers and the AOF get the new position, because they may not
+	// have the position that the delta applies to.
+	msg.Args = setArgs(&d)
+
+	// >> Response
+
+	return OKMessage(msg, start), d, nil
+}
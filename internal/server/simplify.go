@@ -0,0 +1,220 @@
+package server
+
+import (
+	"math"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/geojson/geometry"
+)
+
+// metersPerDegree is the length of a degree of latitude, and of longitude at
+// the equator.
+const metersPerDegree = 111319.49079327357
+
+// simplifier runs Douglas-Peucker on the lines and polygons of the objects
+// of a SIMPLIFY output. The tolerance is in degrees, or in meters when
+// meters is set.
+type simplifier struct {
+	tolerance float64
+	meters    bool
+	opts      *geometry.IndexOptions
+}
+
+// newSimplifier returns the simplifier for SIMPLIFY, or nil if there's none.
+func (s *Server) newSimplifier(t searchScanBaseTokens) *simplifier {
+	if !t.hassimplify {
+		return nil
+	}
+	return &simplifier{
+		tolerance: t.simplify,
+		meters:    t.simplifym,
+		opts:      &s.geomIndexOpts,
+	}
+}
+
+// simplify returns the simplified geometry of an object, or the object when
+// there's nothing to simplify. The points, rects, and circles are always
+// returned as they are.
+func (s *simplifier) simplify(g geojson.Object) geojson.Object {
+	switch g := g.(type) {
+	case *geojson.LineString:
+		line := g.Base()
+		pts := s.simplifySeries(line, 2)
+		if len(pts) == line.NumPoints() {
+			return g
+		}
+		return geojson.NewLineString(geometry.NewLine(pts, s.opts))
+	case *geojson.Polygon:
+		if poly := s.simplifyPoly(g.Base()); poly != nil {
+			return geojson.NewPolygon(poly)
+		}
+		return g
+	case *geojson.MultiLineString:
+		var lines []*geometry.Line
+		for _, child := range g.Children() {
+			line := child.(*geojson.LineString).Base()
+			pts := s.simplifySeries(line, 2)
+			lines = append(lines, geometry.NewLine(pts, s.opts))
+		}
+		return geojson.NewMultiLineString(lines)
+	case *geojson.MultiPolygon:
+		var polys []*geometry.Poly
+		for _, child := range g.Children() {
+			poly := child.(*geojson.Polygon).Base()
+			if spoly := s.simplifyPoly(poly); spoly != nil {
+				poly = spoly
+			}
+			polys = append(polys, poly)
+		}
+		return geojson.NewMultiPolygon(polys)
+	case *geojson.GeometryCollection:
+		var children []geojson.Object
+		for _, child := range g.Children() {
+			children = append(children, s.simplify(child))
+		}
+		return geojson.NewGeometryCollection(children)
+	case *geojson.FeatureCollection:
+		var children []geojson.Object
+		for _, child := range g.Children() {
+			children = append(children, s.simplify(child))
+		}
+		return geojson.NewFeatureCollection(children)
+	case *geojson.Feature:
+		base := s.simplify(g.Base())
+		if base == g.Base() {
+			return g
+		}
+		return geojson.NewFeature(base, g.Members())
+	}
+	return g
+}
+
+// simplifyPoly simplifies the rings of a polygon. When the simplified rings
+// would cross, the tolerance is halved until they don't. Nil is returned
+// when the polygon stays as it is.
+func (s *simplifier) simplifyPoly(poly *geometry.Poly) *geometry.Poly {
+	ss := *s
+	for i := 0; i < 8; i++ {
+		ext := ss.simplifySeries(poly.Exterior, 4)
+		var holes [][]geometry.Point
+		n := len(ext)
+		for _, hole := range poly.Holes {
+			pts := ss.simplifySeries(hole, 4)
+			holes = append(holes, pts)
+			n += len(pts)
+		}
+		if n == polyNumPoints(poly) {
+			return nil
+		}
+		spoly := geometry.NewPoly(ext, holes, s.opts)
+		if !ringsCross(spoly) {
+			return spoly
+		}
+		ss.tolerance /= 2
+	}
+	return nil
+}
+
+func polyNumPoints(poly *geometry.Poly) int {
+	n := poly.Exterior.NumPoints()
+	for _, hole := range poly.Holes {
+		n += hole.NumPoints()
+	}
+	return n
+}
+
+// simplifySeries returns the points of a series that are kept by
+// Douglas-Peucker, but never fewer than min points. A series that would have
+// fewer is returned whole.
+func (s *simplifier) simplifySeries(series geometry.Series, min int) []geometry.Point {
+	pts := make([]geometry.Point, series.NumPoints())
+	for i := range pts {
+		pts[i] = series.PointAt(i)
+	}
+	if len(pts) <= min {
+		return pts
+	}
+	// measure in a local plane, so that a tolerance in meters is the same
+	// in every direction
+	xs, ys := 1.0, 1.0
+	if s.meters {
+		lat := series.Rect().Center().Y
+		xs = metersPerDegree * math.Cos(lat*math.Pi/180)
+		ys = metersPerDegree
+	}
+	keep := make([]bool, len(pts))
+	keep[0], keep[len(pts)-1] = true, true
+	var stack [][2]int
+	stack = append(stack, [2]int{0, len(pts) - 1})
+	for len(stack) > 0 {
+		span := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		a, b := pts[span[0]], pts[span[1]]
+		var far int
+		var dist float64
+		for i := span[0] + 1; i < span[1]; i++ {
+			d := segmentDistance(pts[i], a, b, xs, ys)
+			if d > dist {
+				far, dist = i, d
+			}
+		}
+		if dist > s.tolerance {
+			keep[far] = true
+			stack = append(stack, [2]int{span[0], far}, [2]int{far, span[1]})
+		}
+	}
+	var out []geometry.Point
+	for i, pt := range pts {
+		if keep[i] {
+			out = append(out, pt)
+		}
+	}
+	if len(out) < min {
+		return pts
+	}
+	return out
+}
+
+// segmentDistance returns the distance from a point to a segment, with the
+// x and y scaled into the plane.
+func segmentDistance(p, a, b geometry.Point, xs, ys float64) float64 {
+	px, py := (p.X-a.X)*xs, (p.Y-a.Y)*ys
+	dx, dy := (b.X-a.X)*xs, (b.Y-a.Y)*ys
+	if l := dx*dx + dy*dy; l > 0 {
+		t := math.Max(0, math.Min(1, (px*dx+py*dy)/l))
+		px, py = px-t*dx, py-t*dy
+	}
+	return math.Hypot(px, py)
+}
+
+// ringsCross returns true when two edges of the rings of a polygon cross or
+// touch, other than the neighbouring edges of a ring at their shared point.
+func ringsCross(poly *geometry.Poly) bool {
+	rings := append([]geometry.Ring{poly.Exterior}, poly.Holes...)
+	for i, ring := range rings {
+		nsegs := ring.NumSegments()
+		for j := 0; j < nsegs; j++ {
+			seg := ring.SegmentAt(j)
+			for k := i; k < len(rings); k++ {
+				other := rings[k]
+				onsegs := other.NumSegments()
+				var crossed bool
+				other.Search(seg.Rect(), func(oseg geometry.Segment, idx int) bool {
+					if k == i && (idx <= j || idx == j+1 ||
+						(j == 0 && idx == onsegs-1)) {
+						return true // itself, or a neighbour
+					}
+					if seg.IntersectsSegment(oseg) {
+						crossed = true
+						return false
+					}
+					return true
+				})
+				if crossed {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
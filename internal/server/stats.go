@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"runtime"
 	"sort"
@@ -69,6 +70,9 @@ func (s *Server) cmdSTATS(msg *Message) (resp.Value, error) {
 			m["in_memory_size"] = col.TotalWeight()
 			m["num_objects"] = col.Count()
 			m["num_strings"] = col.StringCount()
+			if dd := s.dedups[key]; dd != nil {
+				m["num_geometries"] = dd.count
+			}
 			switch msg.OutputType {
 			case JSON:
 				ms = append(ms, m)
@@ -95,6 +99,9 @@ func (s *Server) cmdSTATS(msg *Message) (resp.Value, error) {
 	return resp.ArrayValue(vals), nil
 }
 
+// errSyncing is the HEALTHZ error of a follower that isn't caught up.
+var errSyncing = errors.New("syncing")
+
 // HEALTHZ
 func (s *Server) cmdHEALTHZ(msg *Message) (resp.Value, error) {
 	start := time.Now()
@@ -108,12 +115,10 @@ func (s *Server) cmdHEALTHZ(msg *Message) (resp.Value, error) {
 
 	// >> Operation
 
-	if s.config.followHost() != "" {
-		m := make(map[string]interface{})
-		s.basicStats(m)
-		if fmt.Sprintf("%v", m["caught_up"]) != "true" {
-			return retrerr(errors.New("not caught up"))
-		}
+	// A follower is only ready once it has caught up to the leader, which
+	// it isn't during the initial sync or after losing the leader.
+	if s.config.followHost() != "" && !s.fcup {
+		return retrerr(errSyncing)
 	}
 
 	// >> Response
@@ -125,6 +130,44 @@ func (s *Server) cmdHEALTHZ(msg *Message) (resp.Value, error) {
 	return resp.SimpleStringValue("OK"), nil
 }
 
+// NODESTATUS
+func (s *Server) cmdNODESTATUS(msg *Message) (resp.Value, error) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 1 {
+		return retrerr(errInvalidNumberOfArguments)
+	}
+
+	// >> Operation
+
+	m := make(map[string]interface{})
+	if s.config.followHost() == "" {
+		m["role"] = "leader"
+		m["lag"] = 0
+		m["caught_up"] = true
+	} else {
+		m["role"] = "follower"
+		m["lag"] = s.replLag()
+		m["caught_up"] = s.fcup
+	}
+	s.connsmu.RLock()
+	m["connections"] = len(s.conns)
+	s.connsmu.RUnlock()
+	m["command_rate"] = math.Float64frombits(s.statsCommandRate.Load())
+
+	// >> Response
+
+	if msg.OutputType == JSON {
+		data, _ := json.Marshal(m)
+		return resp.StringValue(`{"ok":true,"status":` + string(data) +
+			`,"elapsed":"` + time.Since(start).String() + "\"}"), nil
+	}
+	return resp.ArrayValue(respValuesSimpleMap(m)), nil
+}
+
 // SERVER [ext]
 func (s *Server) cmdSERVER(msg *Message) (resp.Value, error) {
 	start := time.Now()
@@ -162,6 +205,25 @@ func (s *Server) cmdSERVER(msg *Message) (resp.Value, error) {
 	return resp.ArrayValue(respValuesSimpleMap(m)), nil
 }
 
+// replLag returns the number of bytes of the leader's aof that a follower has
+// yet to apply, measured against the last aof size that the leader reported.
+func (s *Server) replLag() int {
+	if len(s.fups) > 0 {
+		var lag int
+		for _, up := range s.fups {
+			if up.leadsz > up.read {
+				lag += int(up.leadsz - up.read)
+			}
+		}
+		return lag
+	}
+	lag := s.fleadsz - s.faofsz
+	if lag < 0 {
+		lag = 0
+	}
+	return lag
+}
+
 // basicStats populates the passed map with basic system/go/tile38 statistics
 func (s *Server) basicStats(m map[string]interface{}) {
 	m["id"] = s.config.serverID()
@@ -170,6 +232,12 @@ func (s *Server) basicStats(m map[string]interface{}) {
 			s.config.followPort())
 		m["caught_up"] = s.fcup
 		m["caught_up_once"] = s.fcuponce
+		m["repl_lag_bytes"] = s.replLag()
+		m["apply_buffer_bytes"] = s.fapply.Load()
+		m["apply_buffer_limit"] = s.config.followerApplyBuffer()
+		if len(s.fups) > 0 {
+			m["upstreams"] = s.upstreamStats()
+		}
 	}
 	m["http_transport"] = s.http
 	m["pid"] = os.Getpid()
@@ -222,6 +290,16 @@ func (s *Server) basicStats(m map[string]interface{}) {
 		return nil
 	})
 	m["pending_events"] = nevents
+	pool := s.epc.PoolStats()
+	m["webhook_workers"] = pool.Workers
+	m["webhook_max_inflight"] = pool.MaxInFlight
+	m["webhook_inflight"] = pool.InFlight
+	m["webhook_waiting"] = pool.Waiting
+	m["webhook_saturated"] = pool.Saturated
+	m["writes_coalesced"] = s.statsCoalesced.Load()
+	m["writes_pending"] = s.opending
+	m["expire_backlog"] = s.expireBacklog
+	m["expire_rate"] = math.Float64frombits(s.statsExpireRate.Load())
 }
 
 // extStats populates the passed map with extended system/go/tile38 statistics
@@ -340,10 +418,18 @@ func (s *Server) extStats(m map[string]interface{}) {
 	m["tile38_total_commands_processed"] = s.statsTotalCommands.Load()
 	// Number of webhook messages sent by server
 	m["tile38_total_messages_sent"] = s.statsTotalMsgsSent.Load()
+	// Number of webhook messages dropped after running out of retries
+	m["tile38_total_messages_dropped"] = s.statsTotalMsgsDrop.Load()
 	// Number of key expiration events
 	m["tile38_expired_keys"] = s.statsExpired.Load()
+	// Number of expired keys that are waiting to be deleted
+	m["tile38_expire_backlog"] = s.expireBacklog
+	// Recent number of key expirations per second
+	m["tile38_expire_rate"] = math.Float64frombits(s.statsExpireRate.Load())
 	// Number of connected slaves
 	m["tile38_connected_slaves"] = len(s.aofconnM)
+	// Number of followers that were disconnected for lagging behind
+	m["tile38_slow_follower_disconnects"] = s.statsSlowFollowers.Load()
 
 	points := 0
 	objects := 0
@@ -425,6 +511,7 @@ func (s *Server) writeInfoStats(w *bytes.Buffer) {
 	fmt.Fprintf(w, "total_connections_received:%d\r\n", s.statsTotalConns.Load())  // Total number of connections accepted by the server
 	fmt.Fprintf(w, "total_commands_processed:%d\r\n", s.statsTotalCommands.Load()) // Total number of commands processed by the server
 	fmt.Fprintf(w, "total_messages_sent:%d\r\n", s.statsTotalMsgsSent.Load())      // Total number of commands processed by the server
+	fmt.Fprintf(w, "total_messages_dropped:%d\r\n", s.statsTotalMsgsDrop.Load())   // Total number of webhook messages that ran out of retries
 	fmt.Fprintf(w, "expired_keys:%d\r\n", s.statsExpired.Load())                   // Total number of key expiration events
 }
 
@@ -467,7 +554,8 @@ func (s *Server) writeInfoReplication(w *bytes.Buffer) {
 		}
 		s.connsmu.RUnlock()
 	}
-	fmt.Fprintf(w, "connected_slaves:%d\r\n", len(s.aofconnM)) // Number of connected slaves
+	fmt.Fprintf(w, "connected_slaves:%d\r\n", len(s.aofconnM))                      // Number of connected slaves
+	fmt.Fprintf(w, "slow_follower_disconnects:%d\r\n", s.statsSlowFollowers.Load()) // Number of followers disconnected for lagging behind
 }
 
 func (s *Server) writeInfoCluster(w *bytes.Buffer) {
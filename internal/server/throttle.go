@@ -0,0 +1,140 @@
+package server
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tidwall/tile38/internal/log"
+)
+
+// objectWrite tracks the writes to a single object for the
+// object-write-interval config.
+type objectWrite struct {
+	last    time.Time // when the object was last written
+	pending []string  // latest SET that is waiting for the interval to pass
+	exArg   int       // index of the EX or PX argument of the pending SET
+	expires int64     // expiration of the pending SET, set when accepted
+}
+
+// throttleSet holds back a SET command when the same object was written
+// less than object-write-interval ago. Only the latest held back SET is kept,
+// and it's applied once the interval has passed. Returns true when the
+// command was held back. The command is parsed first, so an invalid SET is
+// returned as an error instead of being held back. The caller must hold the
+// server lock.
+//
+// A held back SET is not visible to reads, including reads of the same id,
+// until it's applied, which is at most one interval later. Its EX or PX is
+// counted from when the SET was accepted, not from when it's applied.
+func (s *Server) throttleSet(msg *Message) (bool, error) {
+	ival := s.config.objectWriteInterval()
+	if ival == 0 {
+		return false, nil
+	}
+	a, err := s.parseSetArgs(msg.Args)
+	if err != nil {
+		return false, err
+	}
+	key, id := a.key, a.id
+	now := time.Now()
+	if a.nx || a.xx || a.ifregion != "" {
+		// conditional writes always go through, after the pending write
+		if w := s.owrites[key][id]; w != nil && w.pending != nil {
+			s.applyObjectWrite(key, id, w, now)
+		}
+		return false, nil
+	}
+	writes := s.owrites[key]
+	if writes == nil {
+		writes = make(map[string]*objectWrite)
+		s.owrites[key] = writes
+	}
+	w := writes[id]
+	if w == nil {
+		w = &objectWrite{}
+		writes[id] = w
+	}
+	if now.Sub(w.last) >= ival {
+		// this write replaces any write that is still pending
+		if w.pending != nil {
+			w.pending = nil
+			s.opending--
+			s.statsCoalesced.Add(1)
+		}
+		w.last = now
+		return false, nil
+	}
+	if w.pending != nil {
+		s.statsCoalesced.Add(1)
+	} else {
+		s.opending++
+	}
+	w.pending = append([]string(nil), msg.Args...)
+	w.exArg, w.expires = a.exArg, a.ex
+	return true, nil
+}
+
+// backgroundObjectWrites applies the SET commands that were held back by
+// throttleSet.
+func (s *Server) backgroundObjectWrites(wg *sync.WaitGroup) {
+	defer wg.Done()
+	s.loopUntilServerStops(0, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.flushObjectWrites(time.Now(), false)
+	})
+	// the final state must not be lost
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushObjectWrites(time.Now(), true)
+}
+
+// flushObjectWrites applies the pending writes whose interval has passed, or
+// all of them when force is true. It also forgets the objects that have not
+// been written for an interval.
+func (s *Server) flushObjectWrites(now time.Time, force bool) {
+	ival := s.config.objectWriteInterval()
+	for key, writes := range s.owrites {
+		for id, w := range writes {
+			if now.Sub(w.last) < ival && !force {
+				continue
+			}
+			if w.pending == nil {
+				delete(writes, id)
+				continue
+			}
+			s.applyObjectWrite(key, id, w, now)
+		}
+		if len(writes) == 0 {
+			delete(s.owrites, key)
+		}
+	}
+}
+
+// applyObjectWrite applies the pending write of an object.
+func (s *Server) applyObjectWrite(key, id string, w *objectWrite,
+	now time.Time,
+) {
+	args := w.pending
+	if w.exArg > 0 {
+		// replace the expiration with the time that is left of it
+		left := (w.expires - now.UnixNano() + int64(time.Millisecond) - 1) /
+			int64(time.Millisecond)
+		if left < 1 {
+			left = 1
+		}
+		args[w.exArg] = "px"
+		args[w.exArg+1] = strconv.FormatInt(left, 10)
+	}
+	w.pending = nil
+	w.last = now
+	s.opending--
+	_, d, err := s.command(&Message{Args: args}, nil)
+	if err == nil {
+		err = s.writeAOF(args, &d)
+	}
+	if err != nil {
+		log.Errorf("object write %s %s: %v", key, id, err)
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/tidwall/tile38/internal/field"
+	"github.com/tidwall/tile38/internal/geodesic"
 	lua "github.com/yuin/gopher-lua"
 )
 
@@ -17,8 +21,9 @@ var errInvalidNumberOfArguments = errors.New("invalid number of arguments")
 var errKeyNotFound = errors.New("key not found")
 var errIDNotFound = errors.New("id not found")
 var errIDAlreadyExists = errors.New("id already exists")
+var errOutsideRegion = errors.New("object is outside of region")
+var errInsideRegion = errors.New("object is inside of region")
 var errPathNotFound = errors.New("path not found")
-var errKeyHasHooksSet = errors.New("key has hooks set")
 var errNotRectangle = errors.New("not a rectangle")
 
 func errInvalidArgument(arg string) error {
@@ -64,6 +69,7 @@ func lc(s1, s2 string) bool {
 
 type whereT struct {
 	expr bool
+	json bool // name is a path in the JSON of the object
 	name string
 	minx bool
 	min  field.Value
@@ -202,28 +208,75 @@ func (whereeval whereevalT) match(fieldsWithNames map[string]field.Value) (bool,
 }
 
 type searchScanBaseTokens struct {
-	key        string
-	cursor     uint64
-	output     outputT
-	precision  uint64
-	fence      bool
-	distance   bool
-	nodwell    bool
-	detect     map[string]bool
-	accept     map[string]bool
-	globs      []string
-	wheres     []whereT
-	whereins   []whereinT
-	whereevals []whereevalT
-	nofields   bool
-	ulimit     bool
-	limit      uint64
-	usparse    bool
-	sparse     uint8
-	desc       bool
-	clip       bool
-	buffer     float64
-	hasbuffer  bool
+	key         string
+	cursor      uint64
+	output      outputT
+	precision   uint64
+	hashCover   bool
+	grid        int
+	tile        mvtTile
+	csvfields   []string
+	csvwkt      bool
+	csvnoheader bool
+	fence       bool
+	distance    bool
+	nodwell     bool
+	dwell       time.Duration // how long until an object inside dwells
+	detect      map[string]bool
+	accept      map[string]bool
+	globs       []string
+	regexps     []*regexp.Regexp // MATCH RE patterns
+	wheres      []whereT
+	whereins    []whereinT
+	whereevals  []whereevalT
+	nofields    bool
+	strict      bool
+	ulimit      bool
+	limit       uint64
+	usparse     bool
+	sparse      uint8
+	desc        bool
+	clip        bool
+	buffer      float64
+	hasbuffer   bool
+	simplify    float64 // SIMPLIFY tolerance, in degrees or meters
+	simplifym   bool
+	hassimplify bool
+	eroded      bool // a negative buffer left nothing of the area
+	metric      geodesic.Metric
+	hasmetric   bool
+	heading     float64
+	hasheading  bool
+	maxdist     float64
+	hasmaxdist  bool
+	alongkey    string
+	alongid     string
+	withscore   bool
+	withzone    bool
+	components  float64
+	hascomps    bool
+	delta       string
+	hasdelta    bool
+	since       int64
+	hassince    bool
+	asof        int64
+	hasasof     bool
+	distinct    string
+	ttlmin      float64
+	ttlmax      float64
+	hasttl      bool
+	withetag    bool
+	etag        string
+	hasetag     bool
+	changed     []string
+	deleted     bool
+	population  time.Duration
+	thresholds  []int
+	armkey      string
+	armid       string
+	joinkey     string
+	joinon      string
+	joinfields  []string
 }
 
 func (s *Server) parseSearchScanBaseTokens(
@@ -256,13 +309,105 @@ func (s *Server) parseSearchScanBaseTokens(
 				}
 				var buf float64
 				buf, err = strconv.ParseFloat(sbuf, 64)
-				if err != nil || buf < 0 || math.IsInf(buf, 0) || math.IsNaN(buf) {
+				if err != nil || math.IsInf(buf, 0) || math.IsNaN(buf) {
 					err = errInvalidArgument(sbuf)
 					return
 				}
 				t.buffer = buf
 				t.hasbuffer = true
 				continue
+			case "simplify":
+				vs = nvs
+				if t.hassimplify {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				var stol string
+				if vs, stol, ok = tokenval(vs); !ok || stol == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				t.simplify, err = strconv.ParseFloat(stol, 64)
+				if err != nil || !(t.simplify > 0) || math.IsInf(t.simplify, 0) {
+					err = errInvalidArgument(stol)
+					return
+				}
+				if rvs, unit, ok := tokenval(vs); ok &&
+					strings.ToLower(unit) == "meters" {
+					vs = rvs
+					t.simplifym = true
+				}
+				t.hassimplify = true
+				continue
+			case "metric":
+				vs = nvs
+				if t.hasmetric {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				var smetric string
+				if vs, smetric, ok = tokenval(vs); !ok || smetric == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				if t.metric, ok = geodesic.ParseMetric(smetric); !ok {
+					err = errInvalidArgument(smetric)
+					return
+				}
+				t.hasmetric = true
+				continue
+			case "heading":
+				vs = nvs
+				if t.hasheading {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				var sheading string
+				if vs, sheading, ok = tokenval(vs); !ok || sheading == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				t.heading, err = strconv.ParseFloat(sheading, 64)
+				if err != nil || math.IsInf(t.heading, 0) || math.IsNaN(t.heading) {
+					err = errInvalidArgument(sheading)
+					return
+				}
+				t.hasheading = true
+				continue
+			case "maxdist":
+				vs = nvs
+				if t.hasmaxdist {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				var smaxdist string
+				if vs, smaxdist, ok = tokenval(vs); !ok || smaxdist == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				t.maxdist, err = strconv.ParseFloat(smaxdist, 64)
+				if err != nil || t.maxdist <= 0 || math.IsInf(t.maxdist, 0) ||
+					math.IsNaN(t.maxdist) {
+					err = errInvalidArgument(smaxdist)
+					return
+				}
+				t.hasmaxdist = true
+				continue
+			case "along":
+				vs = nvs
+				if t.alongkey != "" {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				if vs, t.alongkey, ok = tokenval(vs); !ok || t.alongkey == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				if vs, t.alongid, ok = tokenval(vs); !ok || t.alongid == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				continue
 			case "cursor":
 				vs = nvs
 				if scursor != "" {
@@ -329,6 +474,35 @@ func (s *Server) parseSearchScanBaseTokens(
 					})
 					continue
 				}
+			case "wherejson":
+				// WHEREJSON path op value
+				vs = nvs
+				var path, op, val string
+				if vs, path, ok = tokenval(vs); !ok || path == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				if vs, op, ok = tokenval(vs); !ok {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				if vs, val, ok = tokenval(vs); !ok {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				switch op {
+				case "<", "<=", ">", ">=", "==", "!=":
+				default:
+					err = errInvalidArgument(op)
+					return
+				}
+				t.wheres = append(t.wheres, whereT{
+					name: path,
+					json: true,
+					min:  field.ValueOf(op),
+					max:  field.ValueOf(val),
+				})
+				continue
 			case "wherein":
 				vs = nvs
 				var name, nvalsStr, valStr string
@@ -440,6 +614,34 @@ func (s *Server) parseSearchScanBaseTokens(
 				}
 				t.nofields = true
 				continue
+			case "withetag":
+				vs = nvs
+				if t.withetag {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				t.withetag = true
+				continue
+			case "ifnonematch":
+				vs = nvs
+				if t.hasetag {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				if vs, t.etag, ok = tokenval(vs); !ok || t.etag == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				t.hasetag = true
+				continue
+			case "strict":
+				vs = nvs
+				if t.strict {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				t.strict = true
+				continue
 			case "limit":
 				vs = nvs
 				if slimit != "" {
@@ -520,7 +722,7 @@ func (s *Server) parseSearchScanBaseTokens(
 					default:
 						err = errInvalidArgument(peek)
 						return
-					case "inside", "outside", "enter", "exit", "cross":
+					case "inside", "outside", "enter", "exit", "cross", "dwell":
 					}
 					if t.detect[part] {
 						err = errDuplicateArgument(s)
@@ -540,12 +742,32 @@ func (s *Server) parseSearchScanBaseTokens(
 				continue
 			case "nodwell":
 				vs = nvs
-				if t.desc || asc {
+				if t.nodwell {
 					err = errDuplicateArgument(strings.ToUpper(wtok))
 					return
 				}
 				t.nodwell = true
 				continue
+			case "dwell":
+				vs = nvs
+				if t.dwell > 0 {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				var sdwell string
+				if vs, sdwell, ok = tokenval(vs); !ok || sdwell == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				var secs float64
+				secs, err = strconv.ParseFloat(sdwell, 64)
+				if err != nil || secs <= 0 || math.IsInf(secs, 0) ||
+					math.IsNaN(secs) {
+					err = errInvalidArgument(sdwell)
+					return
+				}
+				t.dwell = time.Duration(secs * float64(time.Second))
+				continue
 			case "desc":
 				vs = nvs
 				if t.desc || asc {
@@ -569,8 +791,254 @@ func (s *Server) parseSearchScanBaseTokens(
 					err = errInvalidNumberOfArguments
 					return
 				}
+				if strings.ToLower(glob) == "re" && len(vs) > 0 {
+					// MATCH RE pattern
+					var pattern string
+					if vs, pattern, ok = tokenval(vs); !ok || pattern == "" {
+						err = errInvalidNumberOfArguments
+						return
+					}
+					var rx *regexp.Regexp
+					if rx, err = s.compileMatchRegexp(pattern); err != nil {
+						return
+					}
+					t.regexps = append(t.regexps, rx)
+					continue
+				}
 				t.globs = append(t.globs, glob)
 				continue
+			case "since":
+				vs = nvs
+				if t.hassince {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				var ssince string
+				if vs, ssince, ok = tokenval(vs); !ok || ssince == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				var since float64
+				since, err = strconv.ParseFloat(ssince, 64)
+				if err != nil || math.IsInf(since, 0) || math.IsNaN(since) {
+					err = errInvalidArgument(ssince)
+					return
+				}
+				t.since = int64(since * float64(time.Second))
+				t.hassince = true
+				continue
+			case "asof":
+				vs = nvs
+				if t.hasasof {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				var sasof string
+				if vs, sasof, ok = tokenval(vs); !ok || sasof == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				var asof float64
+				asof, err = strconv.ParseFloat(sasof, 64)
+				if err != nil || math.IsInf(asof, 0) || math.IsNaN(asof) {
+					err = errInvalidArgument(sasof)
+					return
+				}
+				t.asof = int64(asof * float64(time.Second))
+				t.hasasof = true
+				continue
+			case "ttlbetween":
+				vs = nvs
+				if t.hasttl {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				var smin, smax string
+				if vs, smin, ok = tokenval(vs); !ok || smin == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				if vs, smax, ok = tokenval(vs); !ok || smax == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				t.ttlmin, err = strconv.ParseFloat(smin, 64)
+				if err != nil || t.ttlmin < 0 || math.IsInf(t.ttlmin, 0) {
+					err = errInvalidArgument(smin)
+					return
+				}
+				t.ttlmax, err = strconv.ParseFloat(smax, 64)
+				if err != nil || t.ttlmax < t.ttlmin || math.IsNaN(t.ttlmax) {
+					err = errInvalidArgument(smax)
+					return
+				}
+				t.hasttl = true
+				continue
+			case "wherechanged":
+				vs = nvs
+				var name string
+				if vs, name, ok = tokenval(vs); !ok || name == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				t.changed = append(t.changed, name)
+				continue
+			case "population":
+				vs = nvs
+				if t.population > 0 {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				var sinterval string
+				if vs, sinterval, ok = tokenval(vs); !ok || sinterval == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				var interval float64
+				interval, err = strconv.ParseFloat(sinterval, 64)
+				if err != nil || !(interval > 0) || math.IsInf(interval, 0) {
+					err = errInvalidArgument(sinterval)
+					return
+				}
+				t.population = time.Duration(interval * float64(time.Second))
+				if t.population <= 0 {
+					err = errInvalidArgument(sinterval)
+					return
+				}
+				continue
+			case "arm":
+				vs = nvs
+				if t.armkey != "" {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				if vs, t.armkey, ok = tokenval(vs); !ok || t.armkey == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				if vs, t.armid, ok = tokenval(vs); !ok || t.armid == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				continue
+			case "thresholds":
+				vs = nvs
+				if t.thresholds != nil {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				var sthresholds string
+				if vs, sthresholds, ok = tokenval(vs); !ok || sthresholds == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				for _, sn := range strings.Split(sthresholds, ",") {
+					var n uint64
+					n, err = strconv.ParseUint(strings.TrimSpace(sn), 10, 32)
+					if err != nil {
+						err = errInvalidArgument(sthresholds)
+						return
+					}
+					t.thresholds = append(t.thresholds, int(n))
+				}
+				sort.Ints(t.thresholds)
+				continue
+			case "include_deleted":
+				vs = nvs
+				if t.deleted {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				t.deleted = true
+				continue
+			case "withscore":
+				vs = nvs
+				if t.withscore {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				t.withscore = true
+				continue
+			case "withzone":
+				vs = nvs
+				if t.withzone {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				t.withzone = true
+				continue
+			case "components":
+				vs = nvs
+				if t.hascomps {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				var sdist string
+				if vs, sdist, ok = tokenval(vs); !ok || sdist == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				var dist float64
+				dist, err = strconv.ParseFloat(sdist, 64)
+				if err != nil || dist < 0 || math.IsInf(dist, 0) || math.IsNaN(dist) {
+					err = errInvalidArgument(sdist)
+					return
+				}
+				t.components = dist
+				t.hascomps = true
+				continue
+			case "delta":
+				vs = nvs
+				if t.hasdelta {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				if vs, t.delta, ok = tokenval(vs); !ok || t.delta == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				t.hasdelta = true
+				continue
+			case "join":
+				vs = nvs
+				if t.joinkey != "" {
+					err = errDuplicateArgument(strings.ToUpper(wtok))
+					return
+				}
+				if vs, t.joinkey, ok = tokenval(vs); !ok || t.joinkey == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				var on string
+				if vs, on, ok = tokenval(vs); !ok || on == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				if strings.ToLower(on) != "on" {
+					err = errInvalidArgument(on)
+					return
+				}
+				if vs, t.joinon, ok = tokenval(vs); !ok || t.joinon == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				if rvs, tok, ok := tokenval(vs); ok &&
+					strings.ToLower(tok) == "fields" {
+					var sfields string
+					if vs, sfields, ok = tokenval(rvs); !ok || sfields == "" {
+						err = errInvalidNumberOfArguments
+						return
+					}
+					for _, name := range strings.Split(sfields, ",") {
+						name = strings.TrimSpace(name)
+						if name == "" {
+							err = errInvalidArgument(sfields)
+							return
+						}
+						t.joinfields = append(t.joinfields, name)
+					}
+				}
+				continue
 			case "clip":
 				vs = nvs
 				if t.clip {
@@ -616,10 +1084,210 @@ func (s *Server) parseSearchScanBaseTokens(
 		err = errors.New("CURSOR is not allowed when FENCE is specified")
 		return
 	}
+	if (t.hassince || len(t.changed) > 0 || t.deleted) && cmd != "scan" {
+		if t.hassince {
+			err = errors.New("SINCE is not allowed for " + strings.ToUpper(cmd))
+		} else if t.deleted {
+			err = errors.New("INCLUDE_DELETED is not allowed for " + strings.ToUpper(cmd))
+		} else {
+			err = errors.New("WHERECHANGED is not allowed for " + strings.ToUpper(cmd))
+		}
+		return
+	}
+	if t.hassince && len(t.changed) == 0 && !t.deleted {
+		err = errors.New("SINCE requires WHERECHANGED or INCLUDE_DELETED")
+		return
+	}
+	if (len(t.changed) > 0 || t.deleted) && !t.hassince {
+		if t.deleted {
+			err = errors.New("INCLUDE_DELETED requires SINCE")
+		} else {
+			err = errors.New("WHERECHANGED requires SINCE")
+		}
+		return
+	}
+	if t.hasasof && cmd != "within" && cmd != "intersects" {
+		err = errors.New("ASOF is not allowed for " + strings.ToUpper(cmd))
+		return
+	}
+	if t.hasasof && t.fence {
+		err = errors.New("ASOF is not allowed when FENCE is specified")
+		return
+	}
+	if t.hasasof && ssparse != "" {
+		err = errors.New("ASOF is not allowed when SPARSE is specified")
+		return
+	}
+	if t.hasasof && t.hasdelta {
+		err = errors.New("ASOF is not allowed when DELTA is specified")
+		return
+	}
+	if t.hasasof && t.hascomps {
+		err = errors.New("ASOF is not allowed when COMPONENTS is specified")
+		return
+	}
+	if t.strict && t.fence {
+		err = errors.New("STRICT is not allowed when FENCE is specified")
+		return
+	}
+	if t.hasttl && t.fence {
+		err = errors.New("TTLBETWEEN is not allowed when FENCE is specified")
+		return
+	}
+	if t.hasheading {
+		if cmd != "nearby" {
+			err = errors.New("HEADING is not allowed for " + strings.ToUpper(cmd))
+			return
+		}
+		if t.fence {
+			err = errors.New("HEADING is not allowed when FENCE is specified")
+			return
+		}
+	}
+	if t.hasmaxdist && cmd != "nearby" {
+		err = errors.New("MAXDIST is not allowed for " + strings.ToUpper(cmd))
+		return
+	}
+	if t.alongkey != "" {
+		if cmd != "nearby" {
+			err = errors.New("ALONG is not allowed for " + strings.ToUpper(cmd))
+			return
+		}
+		if t.fence {
+			err = errors.New("ALONG is not allowed when FENCE is specified")
+			return
+		}
+	}
+	if t.withscore && cmd != "within" {
+		err = errors.New("WITHSCORE is not allowed for " + strings.ToUpper(cmd))
+		return
+	}
+	if t.withscore && t.fence {
+		err = errors.New("WITHSCORE is not allowed when FENCE is specified")
+		return
+	}
+	if t.withzone {
+		if cmd != "within" {
+			err = errors.New("WITHZONE is not allowed for " + strings.ToUpper(cmd))
+			return
+		}
+		if t.fence {
+			err = errors.New("WITHZONE is not allowed when FENCE is specified")
+			return
+		}
+		if !t.hasbuffer {
+			err = errors.New("WITHZONE requires BUFFER")
+			return
+		}
+		if t.buffer < 0 {
+			err = errors.New("WITHZONE requires a positive BUFFER")
+			return
+		}
+	}
+	if t.hascomps {
+		if cmd != "within" {
+			err = errors.New("COMPONENTS is not allowed for " + strings.ToUpper(cmd))
+			return
+		}
+		if t.fence {
+			err = errors.New("COMPONENTS is not allowed when FENCE is specified")
+			return
+		}
+		if ssparse != "" || scursor != "" || slimit != "" || t.withscore ||
+			t.withzone {
+			err = errors.New("COMPONENTS does not allow SPARSE, CURSOR, LIMIT, " +
+				"WITHSCORE, or WITHZONE")
+			return
+		}
+	}
+	if t.hasdelta {
+		if cmd != "within" && cmd != "intersects" {
+			err = errors.New("DELTA is not allowed for " + strings.ToUpper(cmd))
+			return
+		}
+		if t.fence {
+			err = errors.New("DELTA is not allowed when FENCE is specified")
+			return
+		}
+		if ssparse != "" || scursor != "" || slimit != "" || t.withscore ||
+			t.withzone || t.hascomps {
+			err = errors.New("DELTA does not allow SPARSE, CURSOR, LIMIT, " +
+				"WITHSCORE, WITHZONE, or COMPONENTS")
+			return
+		}
+	}
+	if t.withetag || t.hasetag {
+		tok := "WITHETAG"
+		if !t.withetag {
+			tok = "IFNONEMATCH"
+		}
+		if cmd == "density" {
+			err = errors.New(tok + " is not allowed for DENSITY")
+			return
+		}
+		if t.fence {
+			err = errors.New(tok + " is not allowed when FENCE is specified")
+			return
+		}
+		if t.hasdelta || t.hascomps {
+			err = errors.New(tok + " is not allowed with DELTA or COMPONENTS")
+			return
+		}
+	}
+	if len(t.regexps) > 0 {
+		if cmd == "density" || cmd == "fsetwhere" {
+			err = errors.New("MATCH RE is not allowed for " + strings.ToUpper(cmd))
+			return
+		}
+		if t.fence {
+			err = errors.New("MATCH RE is not allowed when FENCE is specified")
+			return
+		}
+	}
+	if t.joinkey != "" && t.fence {
+		err = errors.New("JOIN is not allowed when FENCE is specified")
+		return
+	}
 	if t.detect != nil && !t.fence {
 		err = errors.New("DETECT is not allowed when FENCE is not specified")
 		return
 	}
+	if t.dwell > 0 {
+		if !t.fence {
+			err = errors.New("DWELL is not allowed when FENCE is not specified")
+			return
+		}
+		if t.nodwell {
+			err = errors.New("DWELL is not allowed with NODWELL")
+			return
+		}
+		if t.population > 0 {
+			err = errors.New("DWELL is not allowed when POPULATION is specified")
+			return
+		}
+	}
+	if t.population > 0 && !fromFence {
+		err = errors.New("POPULATION is only allowed for SETHOOK and SETCHAN")
+		return
+	}
+	if t.thresholds != nil && t.population == 0 {
+		err = errors.New("THRESHOLDS requires POPULATION")
+		return
+	}
+	if t.population > 0 && t.detect != nil {
+		err = errors.New("DETECT is not allowed when POPULATION is specified")
+		return
+	}
+	if t.armkey != "" {
+		if !t.fence {
+			err = errors.New("ARM is not allowed when FENCE is not specified")
+			return
+		}
+		if t.population > 0 {
+			err = errors.New("ARM is not allowed when POPULATION is specified")
+			return
+		}
+	}
 
 	t.output = defaultSearchOutput
 	var nvs []string
@@ -636,6 +1304,12 @@ func (s *Server) parseSearchScanBaseTokens(
 			updline = false
 		case "count":
 			t.output = outputCount
+		case "ndistinct":
+			t.output = outputDistinct
+			if nvs, t.distinct, ok = tokenval(nvs); !ok || t.distinct == "" {
+				err = errInvalidNumberOfArguments
+				return
+			}
 		case "objects":
 			t.output = outputObjects
 		case "points":
@@ -646,15 +1320,142 @@ func (s *Server) parseSearchScanBaseTokens(
 				err = errInvalidNumberOfArguments
 				return
 			}
+			if rvs, cover, ok := tokenval(nvs); ok &&
+				strings.ToLower(cover) == "cover" {
+				nvs = rvs
+				t.hashCover = true
+			}
 		case "bounds":
 			t.output = outputBounds
 		case "ids":
 			t.output = outputIDs
+		case "wkt":
+			t.output = outputWKT
+		case "wkb":
+			t.output = outputWKB
+		case "features":
+			t.output = outputFeatures
+			if rvs, index, ok := tokenval(nvs); ok &&
+				strings.ToLower(index) == "index" {
+				var sgrid string
+				if nvs, sgrid, ok = tokenval(rvs); !ok || sgrid == "" {
+					err = errInvalidNumberOfArguments
+					return
+				}
+				grid, perr := strconv.ParseUint(sgrid, 10, 64)
+				if perr != nil || grid == 0 || grid > maxFeatureGrid {
+					err = errInvalidArgument(sgrid)
+					return
+				}
+				t.grid = int(grid)
+			}
+		case "mvt":
+			t.output = outputMVT
+			var sz, sx, sy string
+			if nvs, sz, ok = tokenval(nvs); ok && sz != "" {
+				if nvs, sx, ok = tokenval(nvs); ok && sx != "" {
+					nvs, sy, ok = tokenval(nvs)
+				}
+			}
+			if !ok || sy == "" {
+				err = errInvalidNumberOfArguments
+				return
+			}
+			if t.tile, err = parseMVTTile(sz, sx, sy); err != nil {
+				return
+			}
+		case "csv":
+			t.output = outputCSV
+			for {
+				rvs, tok, ok := tokenval(nvs)
+				if !ok {
+					break
+				}
+				switch strings.ToLower(tok) {
+				case "fields":
+					if t.csvfields != nil {
+						err = errDuplicateArgument(strings.ToUpper(tok))
+						return
+					}
+					var sfields string
+					if nvs, sfields, ok = tokenval(rvs); !ok || sfields == "" {
+						err = errInvalidNumberOfArguments
+						return
+					}
+					t.csvfields = []string{}
+					for _, name := range strings.Split(sfields, ",") {
+						name = strings.TrimSpace(name)
+						if name == "" {
+							err = errInvalidArgument(sfields)
+							return
+						}
+						t.csvfields = append(t.csvfields, name)
+					}
+					continue
+				case "wkt":
+					if t.csvwkt {
+						err = errDuplicateArgument(strings.ToUpper(tok))
+						return
+					}
+					t.csvwkt = true
+					nvs = rvs
+					continue
+				case "noheader":
+					if t.csvnoheader {
+						err = errDuplicateArgument(strings.ToUpper(tok))
+						return
+					}
+					t.csvnoheader = true
+					nvs = rvs
+					continue
+				}
+				break
+			}
 		}
 		if updline {
 			vs = nvs
 		}
 	}
+	if t.output == outputFeatures {
+		if cmd == "search" {
+			err = errors.New("FEATURES is not allowed for SEARCH")
+			return
+		}
+		if t.fence {
+			err = errors.New("FEATURES is not allowed when FENCE is specified")
+			return
+		}
+	}
+	if t.output == outputCSV {
+		if cmd == "search" {
+			err = errors.New("CSV is not allowed for SEARCH")
+			return
+		}
+		if t.fence {
+			err = errors.New("CSV is not allowed when FENCE is specified")
+			return
+		}
+	}
+	if t.output == outputMVT {
+		if cmd == "search" {
+			err = errors.New("MVT is not allowed for SEARCH")
+			return
+		}
+		if t.fence {
+			err = errors.New("MVT is not allowed when FENCE is specified")
+			return
+		}
+	}
+	if t.output == outputDistinct {
+		if cmd == "density" || cmd == "fsetwhere" {
+			err = errors.New("NDISTINCT is not allowed for " + strings.ToUpper(cmd))
+			return
+		}
+		if t.fence {
+			err = errors.New("NDISTINCT is not allowed when FENCE is specified")
+			return
+		}
+	}
 	if scursor != "" {
 		if t.cursor, err = strconv.ParseUint(scursor, 10, 64); err != nil {
 			err = errInvalidArgument(scursor)
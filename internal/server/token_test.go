@@ -1,6 +1,7 @@
 package server
 
 import (
+	"strconv"
 	"strings"
 	"testing"
 
@@ -223,3 +224,31 @@ func BenchmarkStringsLowerCompare(t *testing.B) {
 // 		}
 // 	}
 // }
+
+func TestCompileMatchRegexp(t *testing.T) {
+	s := &Server{}
+	rx1, err := s.compileMatchRegexp(`^vehicle:\d+$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the pages of a query reuse the compiled regexp
+	rx2, err := s.compileMatchRegexp(`^vehicle:\d+$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rx1 != rx2 {
+		t.Fatal("expected the same regexp")
+	}
+	if _, err := s.compileMatchRegexp(`(vehicle`); err == nil {
+		t.Fatal("expected an error")
+	}
+	for i := 0; i < maxMatchRegexps*2; i++ {
+		if _, err := s.compileMatchRegexp(strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.rxcache) > maxMatchRegexps {
+		t.Fatalf("expected at most %d regexps, got %d", maxMatchRegexps,
+			len(s.rxcache))
+	}
+}
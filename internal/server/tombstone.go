@@ -0,0 +1,197 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/log"
+)
+
+// recordTombstones remembers the ids of deleted objects, for as long as the
+// tombstone-retention config allows, so that SCAN ... SINCE INCLUDE_DELETED
+// can tell clients about removals. Setting an id again clears its tombstone.
+// The leader journals each tombstone as a TOMBSTONE command, which is how the
+// aof and the followers get it back.
+func (s *Server) recordTombstones(d *commandDetails) {
+	if d.parent {
+		for _, d := range d.children {
+			s.recordTombstones(d)
+		}
+		return
+	}
+	switch d.command {
+	case "flushdb":
+		s.tombs = make(map[string]map[string]int64)
+	case "drop":
+		delete(s.tombs, d.key)
+	case "rename":
+		if tombs := s.tombs[d.key]; tombs != nil {
+			delete(s.tombs, d.key)
+			s.tombs[d.newKey] = tombs
+		} else {
+			delete(s.tombs, d.newKey)
+		}
+	case "del":
+		if d.obj == nil || s.config.tombstoneTTL() == 0 ||
+			s.config.followHost() != "" || !s.loadedAndReady.Load() {
+			return
+		}
+		ts := d.timestamp.UnixNano()
+		s.setTombstone(d.key, d.obj.ID(), ts)
+		s.writeAOF([]string{"tombstone", d.key, d.obj.ID(),
+			strconv.FormatInt(ts, 10)}, nil)
+	default:
+		if d.obj == nil {
+			return
+		}
+		if tombs := s.tombs[d.key]; tombs != nil {
+			delete(tombs, d.obj.ID())
+			if len(tombs) == 0 {
+				delete(s.tombs, d.key)
+			}
+		}
+	}
+}
+
+func (s *Server) setTombstone(key, id string, ts int64) {
+	tombs := s.tombs[key]
+	if tombs == nil {
+		tombs = make(map[string]int64)
+		s.tombs[key] = tombs
+	}
+	tombs[id] = ts
+}
+
+// TOMBSTONE key id unixnanos
+func (s *Server) cmdTOMBSTONE(msg *Message) (resp.Value, commandDetails,
+	error,
+) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 4 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	key, id := args[1], args[2]
+	ts, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return retwerr(errInvalidArgument(args[3]))
+	}
+
+	// >> Operation
+
+	// The command is always written so that a follower's aof matches the
+	// leader's, even when the tombstone has already expired.
+	var d commandDetails
+	min := time.Now().Add(-s.config.tombstoneTTL()).UnixNano()
+	if s.config.tombstoneTTL() > 0 && ts > min {
+		s.setTombstone(key, id, ts)
+	}
+	d.updated = true
+	d.timestamp = time.Now()
+
+	// >> Response
+
+	return OKMessage(msg, start), d, nil
+}
+
+// backgroundTombstones removes tombstones that are older than the retention.
+func (s *Server) backgroundTombstones(wg *sync.WaitGroup) {
+	defer wg.Done()
+	s.loopUntilServerStops(time.Second, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		n := s.pruneTombstones(time.Now())
+		if n > 0 {
+			log.Debugf("removed %d tombstones", n)
+		}
+	})
+}
+
+func (s *Server) pruneTombstones(now time.Time) int {
+	min := now.Add(-s.config.tombstoneTTL()).UnixNano()
+	var n int
+	for key, tombs := range s.tombs {
+		for id, ts := range tombs {
+			if ts <= min {
+				delete(tombs, id)
+				n++
+			}
+		}
+		if len(tombs) == 0 {
+			delete(s.tombs, key)
+		}
+	}
+	return n
+}
+
+type tombstone struct {
+	id string
+	ts int64
+}
+
+// writeTombstones appends the objects of a key that were deleted after the
+// since time to a SCAN response.
+func (s *Server) writeTombstones(sw *scanWriter, key string, since int64) {
+	var list []tombstone
+	for id, ts := range s.tombs[key] {
+		if ts <= since {
+			continue
+		}
+		if !sw.globEverything && !sw.matchString(id) {
+			continue
+		}
+		list = append(list, tombstone{id, ts})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].ts != list[j].ts {
+			return list[i].ts < list[j].ts
+		}
+		return list[i].id < list[j].id
+	})
+	switch sw.msg.OutputType {
+	case JSON:
+		var b []byte
+		b = append(b, `,"deleted":[`...)
+		for i, t := range list {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = append(b, '{')
+			b = appendJSONID(b, t.id)
+			b = append(b, `,"time":`...)
+			b = appendUnixSeconds(b, t.ts)
+			b = append(b, '}')
+		}
+		b = append(b, ']')
+		sw.wr.Write(b)
+	case RESP:
+		vals := make([]resp.Value, len(list))
+		for i, t := range list {
+			vals[i] = resp.ArrayValue([]resp.Value{
+				resp.StringValue(t.id),
+				resp.StringValue(string(appendUnixSeconds(nil, t.ts))),
+			})
+		}
+		sw.respOut = resp.ArrayValue(
+			append(sw.respOut.Array(), resp.ArrayValue(vals)))
+	}
+}
+
+// appendUnixSeconds appends unix nanoseconds as fractional seconds, which is
+// the format that SINCE accepts.
+func appendUnixSeconds(b []byte, ts int64) []byte {
+	b = strconv.AppendInt(b, ts/int64(time.Second), 10)
+	if nsec := ts % int64(time.Second); nsec > 0 {
+		frac := strconv.FormatInt(nsec+int64(time.Second), 10)[1:]
+		b = append(b, '.')
+		b = append(b, strings.TrimRight(frac, "0")...)
+	}
+	return b
+}
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/internal/field"
+	"github.com/tidwall/tile38/internal/object"
+)
+
+// maxFieldChanges is the number of changes that are kept for each tracked
+// field of an object. Older changes are discarded.
+const maxFieldChanges = 32
+
+type fieldChange struct {
+	ts   int64       // unix nanoseconds when the change occurred
+	prev field.Value // value prior to the change
+}
+
+type fieldHistory struct {
+	value   field.Value   // current value
+	changes []fieldChange // oldest to newest
+	trimmed bool          // older changes were discarded
+}
+
+// changedSince returns true when the current value is different than the
+// value at the provided time.
+func (h *fieldHistory) changedSince(ts int64) bool {
+	if h.trimmed && (len(h.changes) == 0 || h.changes[0].ts > ts) {
+		// The value at that time is unknown, assume that it changed.
+		return true
+	}
+	for _, c := range h.changes {
+		if c.ts > ts {
+			return !c.prev.Equals(h.value)
+		}
+	}
+	return false
+}
+
+// keyTracker holds the value histories for the tracked fields of a key.
+type keyTracker struct {
+	fields  []string                            // sorted field names
+	objects map[string]map[string]*fieldHistory // id -> field -> history
+}
+
+func (tk *keyTracker) tracking(name string) bool {
+	i := sort.SearchStrings(tk.fields, name)
+	return i < len(tk.fields) && tk.fields[i] == name
+}
+
+// seed sets the current value of a field without recording a change.
+func (tk *keyTracker) seed(o *object.Object, name string) {
+	hists := tk.objects[o.ID()]
+	if hists == nil {
+		hists = make(map[string]*fieldHistory)
+		tk.objects[o.ID()] = hists
+	}
+	hists[name] = &fieldHistory{value: o.Fields().Get(name).Value()}
+}
+
+// update records the changes for all tracked fields of an object.
+func (tk *keyTracker) update(o *object.Object, ts int64) {
+	hists := tk.objects[o.ID()]
+	if hists == nil {
+		hists = make(map[string]*fieldHistory)
+		tk.objects[o.ID()] = hists
+	}
+	for _, name := range tk.fields {
+		value := o.Fields().Get(name).Value()
+		h := hists[name]
+		if h == nil {
+			// new object
+			h = &fieldHistory{value: field.ZeroValue}
+			hists[name] = h
+		}
+		if h.value.Equals(value) {
+			continue
+		}
+		if len(h.changes) == maxFieldChanges {
+			h.changes = append(h.changes[:0], h.changes[1:]...)
+			h.trimmed = true
+		}
+		h.changes = append(h.changes, fieldChange{ts: ts, prev: h.value})
+		h.value = value
+	}
+}
+
+// changedSince returns true when any of the fields for the object have a
+// different value than at the provided time.
+func (tk *keyTracker) changedSince(id string, ts int64, names []string,
+) bool {
+	hists := tk.objects[id]
+	for _, name := range names {
+		if h := hists[name]; h != nil && h.changedSince(ts) {
+			return true
+		}
+	}
+	return false
+}
+
+// trackChanges updates the tracked field histories for a write.
+func (s *Server) trackChanges(d *commandDetails) {
+	if len(s.tracks) == 0 {
+		return
+	}
+	if d.parent {
+		for _, d := range d.children {
+			s.trackChanges(d)
+		}
+		return
+	}
+	switch d.command {
+	case "flushdb":
+		for _, tk := range s.tracks {
+			tk.objects = make(map[string]map[string]*fieldHistory)
+		}
+		return
+	case "rename":
+		// The histories follow the objects into the new key.
+		if tk := s.tracks[d.key]; tk != nil {
+			delete(s.tracks, d.key)
+			s.tracks[d.newKey] = tk
+		} else {
+			delete(s.tracks, d.newKey)
+		}
+		return
+	}
+	tk := s.tracks[d.key]
+	if tk == nil {
+		return
+	}
+	switch d.command {
+	case "drop":
+		tk.objects = make(map[string]map[string]*fieldHistory)
+	case "del":
+		if d.obj != nil {
+			delete(tk.objects, d.obj.ID())
+		}
+	default:
+		if d.obj != nil {
+			tk.update(d.obj, d.timestamp.UnixNano())
+		}
+	}
+}
+
+// seedTracks resets the tracked field histories to the current values.
+func (s *Server) seedTracks() {
+	for key, tk := range s.tracks {
+		tk.objects = make(map[string]map[string]*fieldHistory)
+		col, _ := s.cols.Get(key)
+		if col == nil {
+			continue
+		}
+		col.Scan(false, nil, nil, func(o *object.Object) bool {
+			for _, name := range tk.fields {
+				tk.seed(o, name)
+			}
+			return true
+		})
+	}
+}
+
+// changedFilter limits SCAN results to objects with tracked fields that
+// changed since a point in time.
+type changedFilter struct {
+	tk    *keyTracker
+	since int64
+	names []string
+}
+
+func (f *changedFilter) match(o *object.Object) bool {
+	return f.tk.changedSince(o.ID(), f.since, f.names)
+}
+
+// newChangedFilter returns a filter for the tracked fields of a key.
+func (s *Server) newChangedFilter(key string, since int64, names []string,
+) (*changedFilter, error) {
+	tk := s.tracks[key]
+	for _, name := range names {
+		if tk == nil || !tk.tracking(name) {
+			return nil, errors.New("field '" + name + "' is not tracked")
+		}
+	}
+	return &changedFilter{tk: tk, since: since, names: names}, nil
+}
+
+// TRACK key field [field ...]
+func (s *Server) cmdTRACK(msg *Message) (resp.Value, commandDetails, error) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) < 3 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	key := args[1]
+	names := args[2:]
+
+	// >> Operation
+
+	var d commandDetails
+	tk := s.tracks[key]
+	if tk == nil {
+		tk = &keyTracker{
+			objects: make(map[string]map[string]*fieldHistory),
+		}
+		s.tracks[key] = tk
+	}
+	col, _ := s.cols.Get(key)
+	for _, name := range names {
+		if tk.tracking(name) {
+			continue
+		}
+		tk.fields = append(tk.fields, name)
+		sort.Strings(tk.fields)
+		if col != nil {
+			col.Scan(false, nil, nil, func(o *object.Object) bool {
+				tk.seed(o, name)
+				return true
+			})
+		}
+		d.updated = true
+	}
+	d.timestamp = time.Now()
+
+	// >> Response
+
+	return OKMessage(msg, start), d, nil
+}
+
+// UNTRACK key [field ...]
+func (s *Server) cmdUNTRACK(msg *Message) (resp.Value, commandDetails, error) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) < 2 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	key := args[1]
+
+	// >> Operation
+
+	var d commandDetails
+	if tk := s.tracks[key]; tk != nil {
+		if len(args) == 2 {
+			delete(s.tracks, key)
+			d.updated = true
+		} else {
+			for _, name := range args[2:] {
+				i := sort.SearchStrings(tk.fields, name)
+				if i == len(tk.fields) || tk.fields[i] != name {
+					continue
+				}
+				tk.fields = append(tk.fields[:i], tk.fields[i+1:]...)
+				for _, hists := range tk.objects {
+					delete(hists, name)
+				}
+				d.updated = true
+			}
+			if len(tk.fields) == 0 {
+				delete(s.tracks, key)
+			}
+		}
+	}
+	d.timestamp = time.Now()
+
+	// >> Response
+
+	var res resp.Value
+	switch msg.OutputType {
+	case JSON:
+		res = OKMessage(msg, start)
+	case RESP:
+		if d.updated {
+			res = resp.IntegerValue(1)
+		} else {
+			res = resp.IntegerValue(0)
+		}
+	}
+	return res, d, nil
+}
@@ -0,0 +1,328 @@
+package server
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/tile38/core"
+	"github.com/tidwall/tile38/internal/collection"
+	"github.com/tidwall/tile38/internal/log"
+)
+
+// followUpstream is a leader of a follower that follows more than one. Only
+// the keys that start with the prefix are taken from the leader.
+type followUpstream struct {
+	Host   string `json:"host"`
+	Port   int    `json:"port"`
+	Prefix string `json:"prefix"`
+}
+
+func sameUpstreams(a, b []followUpstream) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// upstream is the state of the follow of one leader, guarded by the server
+// lock.
+type upstream struct {
+	followUpstream
+	leadsz   int64  // last known aof size of the leader
+	read     int64  // bytes of the leader's aof that have been read
+	tail     []byte // the last bytes that were read of the leader's aof
+	caughtUp bool
+}
+
+// upstreamResumePos returns where to continue reading the aof of a leader
+// after a reconnect. That's where the last follow of it stopped, when the
+// leader still has the same bytes up to there, otherwise it's zero.
+func (s *Server) upstreamResumePos(conn *RESPConn, up *upstream) (int64,
+	error,
+) {
+	s.mu.Lock()
+	pos, tail := up.read, up.tail
+	s.mu.Unlock()
+	if pos == 0 || len(tail) == 0 {
+		return 0, nil
+	}
+	sum := fmt.Sprintf("%x", md5.Sum(tail))
+	csum, err := connAOFMD5(conn, pos-int64(len(tail)), int64(len(tail)))
+	if err != nil {
+		if err == io.EOF {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if csum != sum {
+		return 0, nil
+	}
+	return pos, nil
+}
+
+// followRoutes holds the positions of the arguments that are matched with the
+// prefix of a leader, when following more than one. They are the keys of the
+// keys commands, and the names or patterns of hooks and channels. It's built
+// from the core commands, plus TOMBSTONE, which is only written by the server.
+var followRoutes = func() map[string][]int {
+	routes := map[string][]int{"tombstone": {1}}
+	for name, cmd := range core.Commands {
+		var pos []int
+		for i, arg := range cmd.Arguments {
+			names, _ := arg.NameTypes()
+			if arg.Command != "" || arg.Optional || len(names) != 1 {
+				break
+			}
+			switch cmd.Group {
+			case "keys":
+				if names[0] == "key" || names[0] == "newkey" {
+					pos = append(pos, i+1)
+				}
+			case "webhook", "pubsub":
+				if names[0] == "name" || names[0] == "pattern" {
+					pos = append(pos, i+1)
+				}
+			}
+		}
+		if len(pos) > 0 && !strings.Contains(name, " ") {
+			routes[strings.ToLower(name)] = pos
+		}
+	}
+	return routes
+}()
+
+// followKeys returns the keys, or the hook and channel names, of a command
+// from a leader, or nil for commands that have none.
+func followKeys(args []string) []string {
+	var keys []string
+	for _, i := range followRoutes[strings.ToLower(args[0])] {
+		if i >= len(args) {
+			return nil
+		}
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+// multiBulkSize returns the number of bytes of a command in the aof.
+func multiBulkSize(args []string) int64 {
+	n := 3 + len(strconv.Itoa(len(args)))
+	for _, arg := range args {
+		n += 5 + len(strconv.Itoa(len(arg))) + len(arg)
+	}
+	return int64(n)
+}
+
+// followAll follows the leaders until the follow changes.
+func (s *Server) followAll(followc int) {
+	cfgs := s.config.followUpstreams()
+	if len(cfgs) == 0 {
+		s.follow(s.config.followHost(), s.config.followPort(), followc)
+		return
+	}
+	ups := make([]*upstream, len(cfgs))
+	for i, cfg := range cfgs {
+		ups[i] = &upstream{followUpstream: cfg}
+	}
+	s.mu.Lock()
+	if int(s.followc.Load()) != followc {
+		s.mu.Unlock()
+		return
+	}
+	s.fups = ups
+	s.fcup = false
+	s.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, up := range ups {
+		wg.Add(1)
+		go func(up *upstream) {
+			defer wg.Done()
+			for {
+				err := s.followUpstreamStep(up, followc)
+				if err == errNoLongerFollowing {
+					return
+				}
+				if err != nil && err != io.EOF {
+					log.Error("follow: " + err.Error())
+				}
+				time.Sleep(time.Second)
+			}
+		}(up)
+	}
+	wg.Wait()
+}
+
+// setUpstreamCaughtUp marks the follow of a leader as caught up, or not. The
+// follower is caught up once it has caught up with all of its leaders. Must
+// hold the server lock.
+func (s *Server) setUpstreamCaughtUp(up *upstream, caughtUp bool) {
+	up.caughtUp = caughtUp
+	fcup := true
+	for _, up := range s.fups {
+		fcup = fcup && up.caughtUp
+	}
+	if fcup && !s.fcup {
+		s.flushAOF(false)
+		s.fcuponce = true
+		log.Info("caught up")
+	}
+	s.fcup = fcup
+}
+
+// dropPrefixKeys drops the collections that a leader owns, before its aof is
+// read again from the start.
+func (s *Server) dropPrefixKeys(prefix string, followc int) error {
+	var keys []string
+	s.mu.RLock()
+	s.cols.Ascend(prefix, func(key string, _ *collection.Collection) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
+		}
+		keys = append(keys, key)
+		return true
+	})
+	s.mu.RUnlock()
+	for _, key := range keys {
+		if _, err := s.followHandleCommand([]string{"drop", key}, followc,
+			io.Discard); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// followUpstreamStep follows one of many leaders. A reconnect continues from
+// where the last follow of the leader stopped. Otherwise the aof of the leader
+// is read from the start, after its keys are dropped, because the local aof is
+// a mix of all of the leaders and can't be matched with any one. That's also
+// the case after a restart of the follower.
+func (s *Server) followUpstreamStep(up *upstream, followc int) error {
+	if int(s.followc.Load()) != followc {
+		return errNoLongerFollowing
+	}
+	s.mu.Lock()
+	s.setUpstreamCaughtUp(up, false)
+	auth := s.config.leaderAuth()
+	s.mu.Unlock()
+	addr := fmt.Sprintf("%s:%d", up.Host, up.Port)
+	conn, m, err := s.leaderConn(addr, s.followUseTLS(), auth)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	pos, err := s.upstreamResumePos(conn, up)
+	if err != nil {
+		return err
+	}
+	codec, err := s.followReplConf(conn)
+	if err != nil {
+		return err
+	}
+	aofSize, err := strconv.ParseInt(m["aof_size"], 10, 64)
+	if err != nil {
+		return err
+	}
+	if pos == 0 {
+		if err := s.dropPrefixKeys(up.Prefix, followc); err != nil {
+			return err
+		}
+	}
+	v, err := conn.Do("aof", pos)
+	if err != nil {
+		return err
+	}
+	if v.Error() != nil {
+		return v.Error()
+	}
+	if v.String() != "OK" {
+		return fmt.Errorf("invalid response to aof live request")
+	}
+	if codec != "" {
+		if err := conn.decompress(codec); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	up.leadsz, up.read = aofSize, pos
+	if pos == 0 {
+		up.tail = up.tail[:0]
+	}
+	if pos >= aofSize {
+		s.setUpstreamCaughtUp(up, true)
+	}
+	s.mu.Unlock()
+	done := make(chan struct{})
+	defer close(done)
+	go s.probeLeaderSize(addr, auth, done, func(size int64) {
+		s.mu.Lock()
+		if size > up.leadsz {
+			up.leadsz = size
+		}
+		s.mu.Unlock()
+	})
+	return s.applyLeaderStream(conn, func(args []string) error {
+		if strings.ToLower(args[0]) == "ping" {
+			// a heartbeat, which isn't part of the aof
+			return nil
+		}
+		keys := followKeys(args)
+		apply := len(keys) > 0
+		for _, key := range keys {
+			apply = apply && strings.HasPrefix(key, up.Prefix)
+		}
+		var err error
+		switch cmd := strings.ToLower(args[0]); {
+		case apply:
+			_, err = s.followHandleCommand(args, followc, io.Discard)
+		case cmd == "flushdb":
+			err = s.dropPrefixKeys(up.Prefix, followc)
+		case len(keys) == 0 && cmd != "publish":
+			// Commands such as COMMANDREGISTER have nothing to match with
+			// the prefix. Relayed PUBLISH messages are only sent out by a
+			// follower of a single leader.
+			log.Warnf("follow: %s from %s:%d is not applied, because it "+
+				"has no key or name for the prefix", cmd, up.Host, up.Port)
+		}
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		up.read += multiBulkSize(args)
+		up.tail = appendAOFCommand(up.tail, args...)
+		if len(up.tail) > checksumsz*2 {
+			up.tail = append(up.tail[:0], up.tail[len(up.tail)-checksumsz:]...)
+		}
+		if up.read > up.leadsz {
+			up.leadsz = up.read
+		}
+		if !up.caughtUp && up.read >= aofSize {
+			s.setUpstreamCaughtUp(up, true)
+		}
+		s.mu.Unlock()
+		return nil
+	})
+}
+
+// upstreamStats returns the leaders and their follow state, for SERVER.
+// Must hold the server lock.
+func (s *Server) upstreamStats() []map[string]interface{} {
+	stats := make([]map[string]interface{}, len(s.fups))
+	for i, up := range s.fups {
+		stats[i] = map[string]interface{}{
+			"leader":    fmt.Sprintf("%s:%d", up.Host, up.Port),
+			"prefix":    up.Prefix,
+			"caught_up": up.caughtUp,
+		}
+	}
+	return stats
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/tidwall/resp"
+	"github.com/tidwall/tile38/core"
+)
+
+// userCommand is a command that was added with COMMANDREGISTER. It runs its
+// script like EVAL, or like EVALRO when it's read only, with the arguments of
+// the command in ARGV.
+type userCommand struct {
+	script   string
+	readonly bool
+}
+
+// isBuiltinCommand returns true when a name is already taken by a command of
+// the server.
+func isBuiltinCommand(name string) bool {
+	name = strings.ToLower(name)
+	if _, ok := commandTable[name]; ok {
+		return true
+	}
+	for _, cmd := range connCommands {
+		if name == cmd {
+			return true
+		}
+	}
+	for cmd := range core.Commands {
+		if first, _, _ := strings.Cut(cmd, " "); strings.ToLower(first) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validCommandName returns true when a name can be used for a user command.
+func validCommandName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' &&
+			c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// rewriteUserCommand turns a call of a user command into the script command
+// that runs it. Returns false when the message isn't for a user command.
+func (s *Server) rewriteUserCommand(msg *Message) bool {
+	ucmds := s.userCommands()
+	if len(ucmds) == 0 {
+		return false
+	}
+	uc, ok := ucmds[msg.Command()]
+	if !ok {
+		return false
+	}
+	evalcmd := "eval"
+	if uc.readonly {
+		evalcmd = "evalro"
+	}
+	args := make([]string, 0, len(msg.Args)+2)
+	args = append(args, evalcmd, uc.script, "0")
+	msg.Args = append(args, msg.Args[1:]...)
+	msg._command = ""
+	return true
+}
+
+// userCommands returns the registered commands. The map is never changed,
+// a registration replaces it with a copy, so that it's read without locking.
+func (s *Server) userCommands() map[string]*userCommand {
+	if ucmds := s.ucmds.Load(); ucmds != nil {
+		return *ucmds
+	}
+	return nil
+}
+
+// setUserCommand registers a command, or unregisters it when it's nil.
+func (s *Server) setUserCommand(name string, uc *userCommand) {
+	old := s.userCommands()
+	ucmds := make(map[string]*userCommand, len(old)+1)
+	for name, uc := range old {
+		ucmds[name] = uc
+	}
+	if uc == nil {
+		delete(ucmds, name)
+	} else {
+		ucmds[name] = uc
+	}
+	s.ucmds.Store(&ucmds)
+}
+
+// COMMANDREGISTER name script [READONLY]
+func (s *Server) cmdCOMMANDREGISTER(msg *Message) (resp.Value, commandDetails,
+	error,
+) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 3 && len(args) != 4 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	name, script := strings.ToLower(args[1]), args[2]
+	if !validCommandName(name) {
+		return retwerr(errInvalidArgument(args[1]))
+	}
+	if isBuiltinCommand(name) {
+		return retwerr(errors.New("cannot replace the built-in command '" +
+			name + "'"))
+	}
+	var readonly bool
+	if len(args) == 4 {
+		if strings.ToLower(args[3]) != "readonly" {
+			return retwerr(errInvalidArgument(args[3]))
+		}
+		readonly = true
+	}
+
+	// >> Operation
+
+	// the script is compiled now so that a broken script is not registered
+	luaState, err := s.luapool.Get()
+	if err != nil {
+		return retwerr(err)
+	}
+	defer s.luapool.Put(luaState)
+	shaSum := Sha1Sum(script)
+	fn, err := luaState.Load(strings.NewReader(script), "f_"+shaSum)
+	if err != nil {
+		return retwerr(makeSafeErr(err))
+	}
+	s.luascripts.Put(shaSum, fn.Proto)
+	s.setUserCommand(name, &userCommand{script: script, readonly: readonly})
+
+	var d commandDetails
+	d.updated = true
+	d.timestamp = time.Now()
+
+	// >> Response
+
+	return OKMessage(msg, start), d, nil
+}
+
+// COMMANDUNREGISTER name
+func (s *Server) cmdCOMMANDUNREGISTER(msg *Message) (resp.Value,
+	commandDetails, error,
+) {
+	start := time.Now()
+
+	// >> Args
+
+	args := msg.Args
+	if len(args) != 2 {
+		return retwerr(errInvalidNumberOfArguments)
+	}
+	name := strings.ToLower(args[1])
+
+	// >> Operation
+
+	var d commandDetails
+	if _, ok := s.userCommands()[name]; ok {
+		s.setUserCommand(name, nil)
+		d.updated = true
+	}
+	d.timestamp = time.Now()
+
+	// >> Response
+
+	switch msg.OutputType {
+	case JSON:
+		return OKMessage(msg, start), d, nil
+	case RESP:
+		if d.updated {
+			return resp.IntegerValue(1), d, nil
+		}
+		return resp.IntegerValue(0), d, nil
+	}
+	return NOMessage, d, nil
+}
@@ -0,0 +1,485 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/geojson"
+	"github.com/tidwall/geojson/geometry"
+)
+
+// appendWKT appends the Well-Known Text of an object. Features are written
+// as their geometry, and the objects that aren't spatial as nothing.
+func appendWKT(dst []byte, g geojson.Object) []byte {
+	switch g := g.(type) {
+	case *geojson.Point, *geojson.SimplePoint:
+		dst = append(dst, "POINT("...)
+		return append(appendWKTPoint(dst, g.Center()), ')')
+	case *geojson.LineString:
+		dst = append(dst, "LINESTRING"...)
+		return appendWKTSeries(dst, g.Base(), false)
+	case *geojson.Polygon:
+		dst = append(dst, "POLYGON"...)
+		return appendWKTPoly(dst, g.Base())
+	case *geojson.Rect:
+		dst = append(dst, "POLYGON("...)
+		return append(appendWKTSeries(dst, g.Base(), true), ')')
+	case *geojson.Circle:
+		return appendWKT(dst, g.Polygon())
+	case *geojson.Feature:
+		return appendWKT(dst, g.Base())
+	case *geojson.MultiPoint:
+		dst = append(dst, "MULTIPOINT("...)
+		for i, child := range g.Children() {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = append(dst, '(')
+			dst = append(appendWKTPoint(dst, child.Center()), ')')
+		}
+		return append(dst, ')')
+	case *geojson.MultiLineString:
+		dst = append(dst, "MULTILINESTRING("...)
+		for i, child := range g.Children() {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			if line, ok := child.(*geojson.LineString); ok {
+				dst = appendWKTSeries(dst, line.Base(), false)
+			}
+		}
+		return append(dst, ')')
+	case *geojson.MultiPolygon:
+		dst = append(dst, "MULTIPOLYGON("...)
+		for i, child := range g.Children() {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			if poly, ok := child.(*geojson.Polygon); ok {
+				dst = appendWKTPoly(dst, poly.Base())
+			}
+		}
+		return append(dst, ')')
+	case geojson.Collection:
+		dst = append(dst, "GEOMETRYCOLLECTION("...)
+		var n int
+		for _, child := range g.Children() {
+			if !objIsSpatial(child) {
+				continue
+			}
+			if n > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendWKT(dst, child)
+			n++
+		}
+		return append(dst, ')')
+	}
+	return dst
+}
+
+func appendWKTPoint(dst []byte, p geometry.Point) []byte {
+	dst = strconv.AppendFloat(dst, p.X, 'f', -1, 64)
+	dst = append(dst, ' ')
+	return strconv.AppendFloat(dst, p.Y, 'f', -1, 64)
+}
+
+func appendWKTSeries(dst []byte, series geometry.Series, ring bool) []byte {
+	dst = append(dst, '(')
+	for i := 0; i < series.NumPoints(); i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendWKTPoint(dst, series.PointAt(i))
+	}
+	if ring && series.NumPoints() > 0 &&
+		series.PointAt(0) != series.PointAt(series.NumPoints()-1) {
+		// rings in WKT always end where they start
+		dst = append(dst, ',')
+		dst = appendWKTPoint(dst, series.PointAt(0))
+	}
+	return append(dst, ')')
+}
+
+func appendWKTPoly(dst []byte, poly *geometry.Poly) []byte {
+	dst = append(dst, '(')
+	dst = appendWKTSeries(dst, poly.Exterior, true)
+	for _, hole := range poly.Holes {
+		dst = append(dst, ',')
+		dst = appendWKTSeries(dst, hole, true)
+	}
+	return append(dst, ')')
+}
+
+// maxWKTDepth is how deep the geometry collections of WKT may nest while
+// it's being read. The max-geometry-depth config applies after that.
+const maxWKTDepth = 256
+
+// wktTypes are the geometry types of WKT. Only the ones with GeoJSON
+// counterparts can be read.
+var wktTypes = map[string]bool{
+	"POINT": true, "LINESTRING": true, "POLYGON": true, "MULTIPOINT": true,
+	"MULTILINESTRING": true, "MULTIPOLYGON": true, "GEOMETRYCOLLECTION": true,
+	"CIRCULARSTRING": false, "COMPOUNDCURVE": false, "CURVEPOLYGON": false,
+	"MULTICURVE": false, "MULTISURFACE": false, "POLYHEDRALSURFACE": false,
+	"TIN": false, "TRIANGLE": false,
+}
+
+// isWKT returns true when an OBJECT starts like WKT, rather than GeoJSON.
+func isWKT(s string) bool {
+	r := wktReader{s: s}
+	typ := r.word()
+	if typ == "SRID" {
+		return r.peek('=')
+	}
+	_, ok := wktTypes[typ]
+	return ok
+}
+
+// wktToGeoJSON converts Well-Known Text, with an optional SRID=4326 prefix,
+// into GeoJSON. The M values are dropped.
+func wktToGeoJSON(s string) (string, error) {
+	r := wktReader{s: strings.TrimSpace(s)}
+	if len(r.s) > 5 && strings.EqualFold(r.s[:5], "srid=") {
+		srid, rest, ok := strings.Cut(r.s[5:], ";")
+		if !ok {
+			return "", errors.New("invalid WKT")
+		}
+		if strings.TrimSpace(srid) != "4326" {
+			return "", fmt.Errorf("unsupported WKT SRID '%s'", srid)
+		}
+		r.s = rest
+	}
+	dst, err := r.geometry(nil, 0)
+	if err != nil {
+		return "", err
+	}
+	if r.skip(); r.i < len(r.s) {
+		return "", r.errorf()
+	}
+	return string(dst), nil
+}
+
+type wktReader struct {
+	s string
+	i int
+}
+
+func (r *wktReader) errorf() error {
+	return fmt.Errorf("invalid WKT at position %d", r.i)
+}
+
+func (r *wktReader) skip() {
+	for r.i < len(r.s) && (r.s[r.i] == ' ' || r.s[r.i] == '\t' ||
+		r.s[r.i] == '\n' || r.s[r.i] == '\r') {
+		r.i++
+	}
+}
+
+// word reads the next word, in upper case.
+func (r *wktReader) word() string {
+	r.skip()
+	start := r.i
+	for r.i < len(r.s) && (r.s[r.i] >= 'A' && r.s[r.i] <= 'Z' ||
+		r.s[r.i] >= 'a' && r.s[r.i] <= 'z') {
+		r.i++
+	}
+	return strings.ToUpper(r.s[start:r.i])
+}
+
+// peek returns true, and reads the char, when it's next.
+func (r *wktReader) peek(c byte) bool {
+	r.skip()
+	if r.i < len(r.s) && r.s[r.i] == c {
+		r.i++
+		return true
+	}
+	return false
+}
+
+func (r *wktReader) expect(c byte) error {
+	if !r.peek(c) {
+		return r.errorf()
+	}
+	return nil
+}
+
+// empty reads an EMPTY, or the opening paren of the body of a geometry.
+func (r *wktReader) empty() (bool, error) {
+	r.skip()
+	save := r.i
+	if r.word() == "EMPTY" {
+		return true, nil
+	}
+	r.i = save
+	return false, r.expect('(')
+}
+
+func (r *wktReader) geometry(dst []byte, depth int) ([]byte, error) {
+	if depth > maxWKTDepth {
+		return nil, errors.New("invalid WKT, too deeply nested")
+	}
+	typ := r.word()
+	save := r.i
+	dims := r.word()
+	if dims != "Z" && dims != "M" && dims != "ZM" {
+		dims = ""
+		r.i = save
+	}
+	var gtyp string
+	var part func(dst []byte) ([]byte, error)
+	switch typ {
+	default:
+		if _, ok := wktTypes[typ]; !ok {
+			return nil, r.errorf()
+		}
+		return nil, fmt.Errorf("unsupported WKT geometry type '%s'", typ)
+	case "POINT":
+		empty, err := r.empty()
+		if err != nil {
+			return nil, err
+		}
+		if empty {
+			return nil, errors.New("invalid WKT, POINT EMPTY is not supported")
+		}
+		dst = append(dst, `{"type":"Point","coordinates":`...)
+		if dst, err = r.coord(dst, dims); err != nil {
+			return nil, err
+		}
+		if err := r.expect(')'); err != nil {
+			return nil, err
+		}
+		return append(dst, '}'), nil
+	case "LINESTRING":
+		gtyp = "LineString"
+		part = func(dst []byte) ([]byte, error) {
+			return r.coord(dst, dims)
+		}
+	case "POLYGON":
+		gtyp = "Polygon"
+		part = func(dst []byte) ([]byte, error) {
+			return r.coords(dst, dims)
+		}
+	case "MULTIPOINT":
+		gtyp = "MultiPoint"
+		part = func(dst []byte) ([]byte, error) {
+			// the points may be in parens, or not
+			if !r.peek('(') {
+				return r.coord(dst, dims)
+			}
+			dst, err := r.coord(dst, dims)
+			if err != nil {
+				return nil, err
+			}
+			return dst, r.expect(')')
+		}
+	case "MULTILINESTRING":
+		gtyp = "MultiLineString"
+		part = func(dst []byte) ([]byte, error) {
+			return r.coords(dst, dims)
+		}
+	case "MULTIPOLYGON":
+		gtyp = "MultiPolygon"
+		part = func(dst []byte) ([]byte, error) {
+			if err := r.expect('('); err != nil {
+				return nil, err
+			}
+			dst = append(dst, '[')
+			for i := 0; ; i++ {
+				if i > 0 {
+					dst = append(dst, ',')
+				}
+				var err error
+				if dst, err = r.coords(dst, dims); err != nil {
+					return nil, err
+				}
+				if !r.peek(',') {
+					break
+				}
+			}
+			return append(dst, ']'), r.expect(')')
+		}
+	case "GEOMETRYCOLLECTION":
+		empty, err := r.empty()
+		if err != nil {
+			return nil, err
+		}
+		dst = append(dst, `{"type":"GeometryCollection","geometries":[`...)
+		for i := 0; !empty; i++ {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			if dst, err = r.geometry(dst, depth+1); err != nil {
+				return nil, err
+			}
+			if !r.peek(',') {
+				if err := r.expect(')'); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+		return append(dst, "]}"...), nil
+	}
+	empty, err := r.empty()
+	if err != nil {
+		return nil, err
+	}
+	dst = append(dst, `{"type":"`+gtyp+`","coordinates":[`...)
+	for i := 0; !empty; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		if dst, err = part(dst); err != nil {
+			return nil, err
+		}
+		if !r.peek(',') {
+			if err := r.expect(')'); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return append(dst, "]}"...), nil
+}
+
+// coords reads a parenthesized list of positions.
+func (r *wktReader) coords(dst []byte, dims string) ([]byte, error) {
+	if err := r.expect('('); err != nil {
+		return nil, err
+	}
+	dst = append(dst, '[')
+	for i := 0; ; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		var err error
+		if dst, err = r.coord(dst, dims); err != nil {
+			return nil, err
+		}
+		if !r.peek(',') {
+			break
+		}
+	}
+	return append(dst, ']'), r.expect(')')
+}
+
+// coord reads a position of x, y, and the optional z and m. Without a Z, M,
+// or ZM, the third number is a z.
+func (r *wktReader) coord(dst []byte, dims string) ([]byte, error) {
+	var nums [4]float64
+	var n int
+	for n < 4 {
+		r.skip()
+		start := r.i
+		for r.i < len(r.s) && strings.IndexByte("+-.0123456789eE", r.s[r.i]) >= 0 {
+			r.i++
+		}
+		if start == r.i {
+			break
+		}
+		num, err := strconv.ParseFloat(r.s[start:r.i], 64)
+		if err != nil {
+			r.i = start
+			return nil, r.errorf()
+		}
+		nums[n] = num
+		n++
+	}
+	if n < 2 || (dims != "" && n != len(dims)+2) {
+		return nil, r.errorf()
+	}
+	dst = append(dst, '[')
+	dst = strconv.AppendFloat(dst, nums[0], 'f', -1, 64)
+	dst = append(dst, ',')
+	dst = strconv.AppendFloat(dst, nums[1], 'f', -1, 64)
+	if n > 2 && dims != "M" {
+		dst = append(dst, ',')
+		dst = strconv.AppendFloat(dst, nums[2], 'f', -1, 64)
+	}
+	return append(dst, ']'), nil
+}
+
+// appendWKB appends the little-endian Well-Known Binary of an object, like
+// appendWKT does the text.
+func appendWKB(dst []byte, g geojson.Object) []byte {
+	header := func(dst []byte, typ uint32) []byte {
+		dst = append(dst, 1) // little-endian
+		return binary.LittleEndian.AppendUint32(dst, typ)
+	}
+	switch g := g.(type) {
+	case *geojson.Point, *geojson.SimplePoint:
+		return appendWKBPoint(header(dst, 1), g.Center())
+	case *geojson.LineString:
+		return appendWKBSeries(header(dst, 2), g.Base(), false)
+	case *geojson.Polygon:
+		return appendWKBPoly(header(dst, 3), g.Base())
+	case *geojson.Rect:
+		dst = binary.LittleEndian.AppendUint32(header(dst, 3), 1)
+		return appendWKBSeries(dst, g.Base(), true)
+	case *geojson.Circle:
+		return appendWKB(dst, g.Polygon())
+	case *geojson.Feature:
+		return appendWKB(dst, g.Base())
+	case geojson.Collection:
+		var typ uint32
+		switch g.(type) {
+		case *geojson.MultiPoint:
+			typ = 4
+		case *geojson.MultiLineString:
+			typ = 5
+		case *geojson.MultiPolygon:
+			typ = 6
+		default:
+			typ = 7
+		}
+		var children []geojson.Object
+		for _, child := range g.Children() {
+			if objIsSpatial(child) {
+				children = append(children, child)
+			}
+		}
+		dst = header(dst, typ)
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(len(children)))
+		for _, child := range children {
+			dst = appendWKB(dst, child)
+		}
+		return dst
+	}
+	return dst
+}
+
+func appendWKBPoint(dst []byte, p geometry.Point) []byte {
+	dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(p.X))
+	return binary.LittleEndian.AppendUint64(dst, math.Float64bits(p.Y))
+}
+
+func appendWKBSeries(dst []byte, series geometry.Series, ring bool) []byte {
+	n := series.NumPoints()
+	closing := ring && n > 0 && series.PointAt(0) != series.PointAt(n-1)
+	if closing {
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(n+1))
+	} else {
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(n))
+	}
+	for i := 0; i < n; i++ {
+		dst = appendWKBPoint(dst, series.PointAt(i))
+	}
+	if closing {
+		dst = appendWKBPoint(dst, series.PointAt(0))
+	}
+	return dst
+}
+
+func appendWKBPoly(dst []byte, poly *geometry.Poly) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(1+len(poly.Holes)))
+	dst = appendWKBSeries(dst, poly.Exterior, true)
+	for _, hole := range poly.Holes {
+		dst = appendWKBSeries(dst, hole, true)
+	}
+	return dst
+}
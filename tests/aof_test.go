@@ -10,10 +10,12 @@ import (
 	"math/rand"
 	"net"
 	"net/http"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/tidwall/gjson"
 
 	_ "embed"
 )
@@ -23,8 +25,12 @@ func subTestAOF(g *testGroup) {
 	g.regSubTest("migrate", aof_migrate_test)
 	g.regSubTest("AOF", aof_AOF_test)
 	g.regSubTest("AOFMD5", aof_AOFMD5_test)
+	g.regSubTest("AOFRANGE", aof_AOFRANGE_test)
 	g.regSubTest("AOFSHRINK", aof_AOFSHRINK_test)
+	g.regSubTest("compressed", aof_compressed_test)
 	g.regSubTest("READONLY", aof_READONLY_test)
+	g.regSubTest("shutdown", aof_shutdown_test)
+	g.regSubTest("tombstones", aof_tombstones_test)
 }
 
 func loadAOFAndClose(aof any) error {
@@ -240,6 +246,63 @@ func aof_AOF_test(mc *mockServer) error {
 	)
 }
 
+func aof_AOFRANGE_test(mc *mockServer) error {
+	aof, err := mc.readAOF()
+	if err != nil {
+		return err
+	}
+	start := len(aof)
+	err = mc.DoBatch(
+		Do("SET", "fleet", "truck1", "POINT", 10, 10).OK(),
+		Do("SET", "fleet", "truck2", "FIELD", "speed", 90, "POINT", 20, 20).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	if aof, err = mc.readAOF(); err != nil {
+		return err
+	}
+	end := len(aof)
+	err = mc.DoBatch(
+		Do("AOFRANGE", 0).Err("wrong number of arguments for 'aofrange' command"),
+		Do("AOFRANGE", -1, end).Err("invalid argument '-1'"),
+		Do("AOFRANGE", end, start).Err(fmt.Sprintf("invalid argument '%d'", start)),
+		Do("AOFRANGE", start, end+1).Err(fmt.Sprintf("range is outside of the aof, the aof_size is %d", end)),
+		Do("AOFRANGE", start+1, end).Err("start is not at the beginning of a command"),
+		Do("AOFRANGE", start, end-1).Err("end is not at the end of a command"),
+		Do("AOFRANGE", end, end).Str("[]"),
+		Do("AOFRANGE", start, end).Str("[[SET fleet truck1 POINT 10 10] [SET fleet truck2 FIELD speed 90 POINT 20 20]]"),
+		Do("AOFRANGE", start, end).JSON().Str(`{"ok":true,"commands":[["SET","fleet","truck1","POINT","10","10"],["SET","fleet","truck2","FIELD","speed","90","POINT","20","20"]]}`),
+		Do("AOFRANGE", 0, 16*1024*1024+1).Err("range is too big, the limit is 16777216 bytes"),
+	)
+	if err != nil {
+		return err
+	}
+
+	// a range that is read in more than one packet
+	start = end
+	for i := 0; i < 2000; i++ {
+		err := mc.DoBatch(Do("SET", "fleet", fmt.Sprintf("truck%d", i),
+			"FIELD", "name", strings.Repeat("x", 64), "POINT", 10, 10).OK())
+		if err != nil {
+			return err
+		}
+	}
+	if aof, err = mc.readAOF(); err != nil {
+		return err
+	}
+	end = len(aof)
+	return mc.DoBatch(
+		Do("AOFRANGE", start, end).JSON().Func(func(s string) error {
+			cmds := gjson.Get(s, "commands").Array()
+			if len(cmds) != 2000 || cmds[1999].Array()[2].String() != "truck1999" {
+				return fmt.Errorf("expected 2000 commands, got %d", len(cmds))
+			}
+			return nil
+		}),
+	)
+}
+
 func aof_AOFSHRINK_test(mc *mockServer) error {
 	var err error
 	haddr := fmt.Sprintf("localhost:%d", getNextPort())
@@ -279,6 +342,102 @@ func aof_AOFSHRINK_test(mc *mockServer) error {
 	return err
 }
 
+func aof_compressed_test(mc *mockServer) error {
+	mc2, err := mockOpenServer(MockServerOptions{Silent: true, AOFCompress: true})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	var aof []byte
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("truck%d", i)
+		if _, err := mc2.Do("SET", "fleet", id, "POINT", 33, -115); err != nil {
+			return err
+		}
+		aof = append(aof, fmt.Sprintf("*6\r\n$3\r\nSET\r\n$5\r\nfleet\r\n"+
+			"$%d\r\n%s\r\n$5\r\nPOINT\r\n$2\r\n33\r\n$4\r\n-115\r\n",
+			len(id), id)...)
+	}
+	// the aof ends with the commands above
+	var base int
+	err = mc2.DoBatch(
+		Do("SERVER").JSON().Func(func(s string) error {
+			base = int(gjson.Get(s, "stats.aof_size").Int()) - len(aof)
+			if base < 0 {
+				return fmt.Errorf("expected >= %d, got %d", len(aof), base+len(aof))
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	check := func(start, size int) func(s string) error {
+		return func(s string) error {
+			sum := md5.Sum(aof[start : start+size])
+			val := hex.EncodeToString(sum[:])
+			if s != val {
+				return fmt.Errorf("expected '%s', got '%s'", val, s)
+			}
+			return nil
+		}
+	}
+	err = mc2.DoBatch(
+		Do("AOFMD5", base, len(aof)).Func(check(0, len(aof))),
+		Do("AOFMD5", base+1002, 4321).Func(check(1002, 4321)),
+	)
+	if err != nil {
+		return err
+	}
+
+	// followers receive the uncompressed commands, and a single write
+	// without waiting for a sync of the aof
+	conn, err := openFollower(mc2)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := mc2.Do("SET", "fleet", "truck1000", "POINT", 33, -115); err != nil {
+		return err
+	}
+	start := time.Now()
+	for i := 0; i <= 1000; {
+		args, err := redis.Strings(conn.Receive())
+		if err != nil {
+			return err
+		}
+		if len(args) == 6 && args[1] == "fleet" {
+			if args[2] != fmt.Sprintf("truck%d", i) {
+				return fmt.Errorf("expected 'truck%d', got '%s'", i, args[2])
+			}
+			i++
+		}
+	}
+	if time.Since(start) > time.Second/5 {
+		return fmt.Errorf("expected the write within 200ms, got %s",
+			time.Since(start))
+	}
+
+	data, err := mc2.readAOF()
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, []byte("T38AOFZ")) || len(data) >= len(aof) {
+		return fmt.Errorf("expected a compressed aof")
+	}
+
+	// the compressed aof loads without the option
+	mc3, err := loadAOF(data)
+	if err != nil {
+		return err
+	}
+	defer mc3.Close()
+	return mc3.DoBatch(
+		Do("SCAN", "fleet", "COUNT").Str("1001"),
+		Do("GET", "fleet", "truck999", "POINT").Str("[33 -115]"),
+	)
+}
+
 func aof_READONLY_test(mc *mockServer) error {
 	return mc.DoBatch(
 		Do("SET", "mykey", "myid", "POINT", "10", "10").OK(),
@@ -345,3 +504,122 @@ func aof_migrate_test(mc *mockServer) error {
 
 	return nil
 }
+
+func aof_tombstones_test(mc *mockServer) error {
+	mc2, err := mockOpenServer(MockServerOptions{Silent: true})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	err = mc2.DoBatch(
+		Do("CONFIG", "SET", "tombstone-retention", "60").OK(),
+		Do("SET", "fleet", "truck1", "POINT", 33, -115).OK(),
+		Do("SET", "fleet", "truck2", "POINT", 33, -115).OK(),
+		Do("DEL", "fleet", "truck1").Str("1"),
+		Do("TOMBSTONE", "fleet", "truck2", 0).Err("unknown command 'TOMBSTONE'"),
+	)
+	if err != nil {
+		return err
+	}
+	// the tombstone is journaled after the DEL and kept by AOFSHRINK
+	hasTombstone := func() error {
+		data, err := mc2.readAOF()
+		if err != nil {
+			return err
+		}
+		entry := "$9\r\ntombstone\r\n$5\r\nfleet\r\n$6\r\ntruck1\r\n"
+		if !bytes.Contains(data, []byte(entry)) {
+			return fmt.Errorf("expected a tombstone in the aof")
+		}
+		return nil
+	}
+	if err := hasTombstone(); err != nil {
+		return err
+	}
+	if err := mc2.DoBatch(Do("AOFSHRINK").OK()); err != nil {
+		return err
+	}
+	time.Sleep(time.Second)
+	if err := hasTombstone(); err != nil {
+		return err
+	}
+	return mc2.DoBatch(
+		Do("SCAN", "fleet", "SINCE", 0, "INCLUDE_DELETED", "IDS").Func(func(s string) error {
+			if !strings.HasPrefix(s, "[0 [truck2] [[truck1 ") {
+				return fmt.Errorf("unexpected '%s'", s)
+			}
+			return nil
+		}),
+	)
+}
+
+func aof_shutdown_test(mc *mockServer) error {
+	for _, compress := range []bool{false, true} {
+		if err := aofShutdownTest(compress); err != nil {
+			return fmt.Errorf("compress %t: %w", compress, err)
+		}
+	}
+	return aofShutdownDrainTest()
+}
+
+// aofShutdownTest shuts down a server right after a write, and checks that
+// the writes are in the aof when the server is opened again.
+func aofShutdownTest(compress bool) error {
+	mc2, err := mockOpenServer(MockServerOptions{Silent: true,
+		AOFCompress: compress})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	err = mc2.DoBatch(
+		Do("SET", "fleet", "truck1", "POINT", 33, -115).OK(),
+		Sleep(time.Second/5),
+		// the last write is still buffered when the shutdown starts
+		Do("SET", "fleet", "truck2", "POINT", 34, -116).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	if err := mc2.Shutdown(); err != nil {
+		return err
+	}
+	mc3, err := mockOpenServer(MockServerOptions{Silent: true,
+		AOFCompress: compress, Dir: mc2.dir})
+	if err != nil {
+		return err
+	}
+	defer mc3.Close()
+	return mc3.DoBatch(
+		Do("GET", "fleet", "truck1", "POINT").Str("[33 -115]"),
+		Do("GET", "fleet", "truck2", "POINT").Str("[34 -116]"),
+	)
+}
+
+// aofShutdownDrainTest shuts down a server while a command is in-flight, and
+// checks that the command gets its response.
+func aofShutdownDrainTest() error {
+	mc2, err := mockOpenServer(MockServerOptions{Silent: true,
+		Drain: time.Second * 5})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	conn, err := redis.Dial("tcp", fmt.Sprintf(":%d", mc2.port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	slept := make(chan error, 1)
+	go func() {
+		_, err := redis.String(conn.Do("SLEEP", 0.5))
+		slept <- err
+	}()
+	time.Sleep(time.Second / 10)
+	if err := mc2.Shutdown(); err != nil {
+		return err
+	}
+	if err := <-slept; err != nil {
+		return fmt.Errorf("expected the sleep to finish, got '%v'", err)
+	}
+	return nil
+}
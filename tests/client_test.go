@@ -13,6 +13,8 @@ import (
 func subTestClient(g *testGroup) {
 	g.regSubTest("OUTPUT", client_OUTPUT_test)
 	g.regSubTest("CLIENT", client_CLIENT_test)
+	g.regSubTest("RESTRICT", client_RESTRICT_test)
+	g.regSubTest("WITHVERSION", client_WITHVERSION_test)
 }
 
 func client_OUTPUT_test(mc *mockServer) error {
@@ -140,3 +142,119 @@ func client_CLIENT_test(mc *mockServer) error {
 	)
 
 }
+
+func client_RESTRICT_test(mc *mockServer) error {
+	conn, err := redis.Dial("tcp", fmt.Sprintf(":%d", mc.port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := mc.DoBatch(Do("SET", "mykey", "myid", "POINT", 33, -115).OK()); err != nil {
+		return err
+	}
+	expect := func(want string, args ...interface{}) error {
+		res, err := conn.Do(args[0].(string), args[1:]...)
+		got := fmt.Sprint(res)
+		if b, ok := res.([]byte); ok {
+			got = string(b)
+		}
+		if err != nil {
+			got = err.Error()
+		}
+		if got != want {
+			return fmt.Errorf("%v: expected '%s', got '%s'", args, want, got)
+		}
+		return nil
+	}
+	for _, step := range []struct {
+		want string
+		args []interface{}
+	}{
+		{"ERR wrong number of arguments for 'restrict' command", []interface{}{"RESTRICT"}},
+		{"OK", []interface{}{"RESTRICT", "GET", "nearby", "WITHIN", "RESTRICT"}},
+		{`{"type":"Point","coordinates":[-115,33]}`, []interface{}{"GET", "mykey", "myid"}},
+		{"ERR command 'set' is not allowed on this connection", []interface{}{"SET", "mykey", "myid", "POINT", 33, -115}},
+		{"OK", []interface{}{"RESTRICT", "GET", "SET"}},
+		{"ERR command 'set' is not allowed on this connection", []interface{}{"SET", "mykey", "myid", "POINT", 33, -115}},
+		{"ERR command 'nearby' is not allowed on this connection", []interface{}{"NEARBY", "mykey", "POINT", 33, -115}},
+		{"ERR command 'restrict' is not allowed on this connection", []interface{}{"RESTRICT", "GET"}},
+		{"PONG", []interface{}{"PING"}},
+	} {
+		if err := expect(step.want, step.args...); err != nil {
+			return err
+		}
+	}
+	// other connections are not restricted
+	return mc.DoBatch(Do("SET", "mykey", "myid", "POINT", 33, -115).OK())
+}
+
+func client_WITHVERSION_test(mc *mockServer) error {
+	conn, err := redis.Dial("tcp", fmt.Sprintf(":%d", mc.port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := mc.DoBatch(Do("SET", "mykey", "myid", "POINT", 33, -115).OK()); err != nil {
+		return err
+	}
+	aofSize := func() (int64, error) {
+		js, err := redis.String(conn.Do("SERVER"))
+		if err != nil {
+			return 0, err
+		}
+		return gjson.Get(js, "stats.aof_size").Int(), nil
+	}
+	if _, err := conn.Do("WITHVERSION", "maybe"); err == nil ||
+		err.Error() != "ERR invalid argument 'maybe'" {
+		return fmt.Errorf("expected an invalid argument error, got '%v'", err)
+	}
+	if _, err := conn.Do("OUTPUT", "json"); err != nil {
+		return err
+	}
+	if _, err := conn.Do("WITHVERSION", "yes"); err != nil {
+		return err
+	}
+	// the version is the aof size that the read saw
+	js, err := redis.String(conn.Do("GET", "mykey", "myid"))
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Do("SET", "mykey", "myid2", "POINT", 34, -115); err != nil {
+		return err
+	}
+	size, err := aofSize()
+	if err != nil {
+		return err
+	}
+	v1 := gjson.Get(js, "version").Int()
+	if v1 == 0 || v1 >= size {
+		return fmt.Errorf("expected a version below %d, got '%s'", size, js)
+	}
+	if gjson.Get(js, "object.coordinates.0").Int() != -115 {
+		return fmt.Errorf("expected the object, got '%s'", js)
+	}
+	if _, err := conn.Do("OUTPUT", "resp"); err != nil {
+		return err
+	}
+	vals, err := redis.Values(conn.Do("GET", "mykey", "myid"))
+	if err != nil {
+		return err
+	}
+	if len(vals) != 2 {
+		return fmt.Errorf("expected the object and the version, got '%v'", vals)
+	}
+	if v2, _ := redis.Int64(vals[1], nil); v2 != size {
+		return fmt.Errorf("expected version %d, got '%v'", size, vals)
+	}
+	if _, err := conn.Do("WITHVERSION", "no"); err != nil {
+		return err
+	}
+	obj, err := redis.String(conn.Do("GET", "mykey", "myid"))
+	if err != nil {
+		return err
+	}
+	if obj != `{"type":"Point","coordinates":[-115,33]}` {
+		return fmt.Errorf("expected the object only, got '%s'", obj)
+	}
+	return nil
+}
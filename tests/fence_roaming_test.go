@@ -3,12 +3,14 @@ package tests
 import (
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"sync"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/tidwall/gjson"
 	"github.com/tidwall/pretty"
 	"github.com/tidwall/sjson"
 )
@@ -258,6 +260,58 @@ func fence_roaming_channel_test(mc *mockServer) error {
 	return <-finalErr
 }
 
+func fence_roaming_distance_test(mc *mockServer) error {
+	conn, err := redis.Dial("tcp", fmt.Sprintf(":%d", mc.port),
+		redis.DialReadTimeout(time.Second*2))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = mc.DoBatch(
+		Do("SETCHAN", "carschan", "NEARBY", "cars", "DISTANCE", "FENCE",
+			"ROAM", "cars", "*", 1000).Str("1"),
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Do("SUBSCRIBE", "carschan"); err != nil {
+		return err
+	}
+	// car3 is inside of the search rect for car1, but not inside of the
+	// radius, so only car2 is nearby.
+	err = mc.DoBatch(
+		Do("SET", "cars", "car3", "POINT", 33.4218, -111.9259).OK(),
+		Do("SET", "cars", "car2", "POINT", 33.414750027566235, -111.91154479980467).OK(),
+		Do("SET", "cars", "car1", "POINT", 33.414750027566235, -111.91789627075195).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	vals, err := redis.Values(conn.Receive())
+	if err != nil {
+		return err
+	}
+	msg, err := redis.String(vals[2], nil)
+	if err != nil {
+		return err
+	}
+	if gjson.Get(msg, "id").String() != "car1" ||
+		gjson.Get(msg, "nearby.id").String() != "car2" {
+		return fmt.Errorf("expected car1 nearby car2, got %s", msg)
+	}
+	dist := gjson.Get(msg, "nearby.distance")
+	if !dist.Exists() || math.Abs(dist.Float()-589.512) > 0.01 {
+		return fmt.Errorf("expected a distance of about 589.512, got %s", msg)
+	}
+	if _, err := conn.Receive(); err == nil {
+		return fmt.Errorf("expected no more messages")
+	}
+	return mc.DoBatch(
+		Do("DELCHAN", "carschan").Str("1"),
+		Do("DROP", "cars").Str("1"),
+	)
+}
+
 func cleanMessage(body []byte) string {
 	// Remove fields that are non-deterministic or use case specific
 	msg, _ := sjson.Delete(string(body), "group")
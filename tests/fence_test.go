@@ -2,12 +2,20 @@ package tests
 
 import (
 	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/big"
 	"net"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -29,12 +37,32 @@ func subTestFence(g *testGroup) {
 	g.regSubTest("roaming live", fence_roaming_live_test)
 	g.regSubTest("roaming channel", fence_roaming_channel_test)
 	g.regSubTest("roaming webhook", fence_roaming_webhook_test)
+	g.regSubTest("roaming distance", fence_roaming_distance_test)
 
 	// channel meta
 	g.regSubTest("channel meta", fence_channel_meta_test)
 
 	// various
 	g.regSubTest("detect eecio", fence_eecio_test)
+	g.regSubTest("population", fence_population_test)
+	g.regSubTest("fencetest", fence_fencetest_test)
+	g.regSubTest("notify order", fence_notify_order_test)
+	g.regSubTest("pubsub channels", fence_pubsub_channels_test)
+	g.regSubTest("notify sequence", fence_notify_sequence_test)
+	g.regSubTest("arm", fence_arm_test)
+	g.regSubTest("fsetwhere", fence_fsetwhere_test)
+	g.regSubTest("mset", fence_mset_test)
+	g.regSubTest("rename", fence_rename_test)
+	g.regSubTest("debezium", fence_debezium_test)
+	g.regSubTest("preexpire", fence_preexpire_test)
+	g.regSubTest("hookvalidate", fence_hookvalidate_test)
+	g.regSubTest("hook health", fence_hookhealth_test)
+	g.regSubTest("hook retries", fence_hookretries_test)
+	g.regSubTest("hook dead-letter", fence_hookdeadletter_test)
+	g.regSubTest("hook client certs", fence_hookclientcerts_test)
+	g.regSubTest("dwell", fence_dwell_test)
+	g.regSubTest("dwell roam", fence_dwell_roam_test)
+	g.regSubTest("crossed", fence_crossed_test)
 }
 
 type fenceReader struct {
@@ -516,3 +544,941 @@ func fence_eecio_test(mc *mockServer) error {
 
 	return nil
 }
+
+func fence_population_test(mc *mockServer) error {
+	err := mc.DoBatch(
+		Do("SET", "fleet", "truck1", "POINT", 10, 10).OK(),
+		Do("WITHIN", "fleet", "POPULATION", 1, "BOUNDS", 0, 0, 20, 20).Err("POPULATION is only allowed for SETHOOK and SETCHAN"),
+		Do("SETCHAN", "pop", "WITHIN", "fleet", "FENCE", "THRESHOLDS", 2, "BOUNDS", 0, 0, 20, 20).Err("THRESHOLDS requires POPULATION"),
+		Do("SETCHAN", "pop", "WITHIN", "fleet", "FENCE", "DETECT", "enter", "POPULATION", 1, "BOUNDS", 0, 0, 20, 20).Err("DETECT is not allowed when POPULATION is specified"),
+		Do("SETCHAN", "pop", "WITHIN", "fleet", "FENCE", "POPULATION", 0, "BOUNDS", 0, 0, 20, 20).Err("invalid argument '0'"),
+		Do("SETCHAN", "pop", "WITHIN", "fleet", "FENCE", "POPULATION", 1, "THRESHOLDS", "1,x", "BOUNDS", 0, 0, 20, 20).Err("invalid argument '1,x'"),
+	)
+	if err != nil {
+		return err
+	}
+	subscribe := func(args ...interface{}) (redis.Conn, error) {
+		conn, err := dialTile38(mc.port)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := doTile38(conn, "SETCHAN", args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if _, err := conn.Do("SUBSCRIBE", args[0]); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+	receive := func(conn redis.Conn, expect string) error {
+		js, err := redis.String(conn.Receive())
+		if err != nil {
+			return err
+		}
+		if gjson.Get(js, "command").String() != "population" {
+			return fmt.Errorf("expected population message, got '%s'", js)
+		}
+		var vals []string
+		for _, path := range []string{"count", "threshold", "crossed"} {
+			if v := gjson.Get(js, path); v.Exists() {
+				vals = append(vals, v.String())
+			}
+		}
+		got := strings.Join(vals, ",")
+		if got != expect {
+			return fmt.Errorf("expected '%s', got '%s'", expect, got)
+		}
+		return nil
+	}
+
+	// periodic counts
+	conn, err := subscribe("pop1", "WITHIN", "fleet", "FENCE",
+		"POPULATION", 0.1, "BOUNDS", 0, 0, 20, 20)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := receive(conn, "1"); err != nil {
+		return err
+	}
+	if err := receive(conn, "1"); err != nil {
+		return err
+	}
+
+	// threshold crossings
+	conn, err = subscribe("pop2", "WITHIN", "fleet", "FENCE",
+		"POPULATION", 0.1, "THRESHOLDS", 2, "BOUNDS", 0, 0, 20, 20)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	time.Sleep(time.Millisecond * 300)
+	err = mc.DoBatch(
+		Do("SET", "fleet", "truck2", "POINT", 11, 11).OK(),
+		Do("SET", "fleet", "truck3", "POINT", 30, 30).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	if err := receive(conn, "2,2,above"); err != nil {
+		return err
+	}
+	if err := mc.DoBatch(Do("DEL", "fleet", "truck2").Str("1")); err != nil {
+		return err
+	}
+	return receive(conn, "1,2,below")
+}
+
+func fence_fencetest_test(mc *mockServer) error {
+	detects := func(expect string) func(s string) error {
+		return func(s string) error {
+			var vals []string
+			gjson.Get(s, "notifications").ForEach(func(_, v gjson.Result) bool {
+				vals = append(vals, v.Get("hook").String()+":"+
+					v.Get("detect").String())
+				return true
+			})
+			if got := strings.Join(vals, ","); got != expect {
+				return fmt.Errorf("expected '%s', got '%s'", expect, got)
+			}
+			return nil
+		}
+	}
+	return mc.DoBatch(
+		Do("SET", "fleet", "truck1", "FIELD", "speed", 10, "POINT", 30, 30).OK(),
+		Do("SETCHAN", "box", "WITHIN", "fleet", "FENCE", "DETECT", "enter,exit", "BOUNDS", 0, 0, 10, 10).Str("1"),
+		Do("SETCHAN", "slow", "NEARBY", "fleet", "WHERE", "speed", 5, 20, "FENCE", "DETECT", "enter", "POINT", 20, 20, 1000).Str("1"),
+		Do("FENCETEST", "fleet", "truck1", "FROM", "POINT", -5, -5, "TO", "POINT", 5, 5).JSON().Func(detects("box:enter")),
+		Do("FENCETEST", "fleet", "truck1", "FROM", "POINT", 5, 5, "TO", "POINT", 20, 20).JSON().Func(detects("box:exit,slow:enter")),
+		Do("FENCETEST", "fleet", "truck2", "FROM", "POINT", 5, 5, "TO", "POINT", 20, 20).JSON().Func(detects("box:exit")),
+		Do("FENCETEST", "fleet", "truck1", "FROM", "POINT", 40, 40, "TO", "POINT", 50, 50).Str("[]"),
+		Do("FENCETEST", "fleet", "truck1", "POINT", 5, 5, "TO", "POINT", 20, 20).Err("invalid argument 'POINT'"),
+		Do("FENCETEST", "fleet", "truck1", "FROM", "POINT", 5, 5).Err("wrong number of arguments for 'fencetest' command"),
+		Do("GET", "fleet", "truck1", "POINT").Str("[30 30]"),
+		Do("GET", "fleet", "truck2").Str("<nil>"),
+	)
+}
+
+func fence_notify_order_test(mc *mockServer) error {
+	hooks := func(expect string) func(s string) error {
+		return func(s string) error {
+			var vals []string
+			gjson.Get(s, "notifications").ForEach(func(_, v gjson.Result) bool {
+				vals = append(vals, v.Get("hook").String()+":"+
+					v.Get("detect").String())
+				return true
+			})
+			if got := strings.Join(vals, ","); got != expect {
+				return fmt.Errorf("expected '%s', got '%s'", expect, got)
+			}
+			return nil
+		}
+	}
+	defer mc.DoBatch(Do("CONFIG", "SET", "notify-order", "detect").OK())
+	return mc.DoBatch(
+		Do("SETCHAN", "zeta", "WITHIN", "ordered", "FENCE", "DETECT", "exit", "BOUNDS", 0, 0, 10, 10).Str("1"),
+		Do("SETCHAN", "alpha", "WITHIN", "ordered", "FENCE", "DETECT", "enter", "BOUNDS", 15, 15, 25, 25).Str("1"),
+		Do("SETCHAN", "mid", "WITHIN", "ordered", "FENCE", "DETECT", "exit", "BOUNDS", 0, 0, 10, 10).Str("1"),
+		Do("CONFIG", "GET", "notify-order").Str("[notify-order detect]"),
+		Do("FENCETEST", "ordered", "truck1", "FROM", "POINT", 5, 5, "TO", "POINT", 20, 20).JSON().Func(hooks("mid:exit,zeta:exit,alpha:enter")),
+		Do("CONFIG", "SET", "notify-order", "name").OK(),
+		Do("FENCETEST", "ordered", "truck1", "FROM", "POINT", 5, 5, "TO", "POINT", 20, 20).JSON().Func(hooks("alpha:enter,mid:exit,zeta:exit")),
+		Do("CONFIG", "SET", "notify-order", "created").OK(),
+		Do("FENCETEST", "ordered", "truck1", "FROM", "POINT", 5, 5, "TO", "POINT", 20, 20).JSON().Func(hooks("zeta:exit,alpha:enter,mid:exit")),
+		// replacing a hook keeps its place
+		Do("SETCHAN", "zeta", "WITHIN", "ordered", "FENCE", "DETECT", "exit", "BOUNDS", 0, 0, 11, 11).Str("1"),
+		Do("FENCETEST", "ordered", "truck1", "FROM", "POINT", 5, 5, "TO", "POINT", 20, 20).JSON().Func(hooks("zeta:exit,alpha:enter,mid:exit")),
+		Do("CONFIG", "SET", "notify-order", "random").Err("Invalid argument 'random' for CONFIG SET 'notify-order'"),
+		Do("DELCHAN", "zeta").Str("1"),
+		Do("DELCHAN", "alpha").Str("1"),
+		Do("DELCHAN", "mid").Str("1"),
+	)
+}
+
+func fence_pubsub_channels_test(mc *mockServer) error {
+	var conns []redis.Conn
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for _, channels := range [][]interface{}{
+		{"SUBSCRIBE", "news", "sports"},
+		{"SUBSCRIBE", "news"},
+		{"PSUBSCRIBE", "ne*"},
+	} {
+		conn, err := redis.Dial("tcp", fmt.Sprintf(":%d", mc.port))
+		if err != nil {
+			return err
+		}
+		conns = append(conns, conn)
+		if err := conn.Send(channels[0].(string), channels[1:]...); err != nil {
+			return err
+		}
+		if err := conn.Flush(); err != nil {
+			return err
+		}
+		for range channels[1:] {
+			if _, err := conn.Receive(); err != nil {
+				return err
+			}
+		}
+	}
+	return mc.DoBatch(
+		Do("PUBSUB", "CHANNELS").Str("[news sports]"),
+		Do("PUBSUB", "CHANNELS", "sp*").Str("[sports]"),
+		Do("PUBSUB", "CHANNELS", "weather").Str("[]"),
+		Do("PUBSUB", "NUMSUB", "news", "sports", "weather").Str("[news 2 sports 1 weather 0]"),
+		Do("PUBSUB", "NUMSUB", "news", "weather").JSON().Str(`{"ok":true,"numsub":{"news":2,"weather":0}}`),
+		Do("PUBSUB", "NUMPAT").Str("1"),
+		Do("PUBSUB", "CHANNELS").JSON().Str(`{"ok":true,"channels":["news","sports"]}`),
+		Do("PUBSUB", "SHARDCHANNELS").Err("invalid argument 'SHARDCHANNELS'"),
+		Do("PUBSUB").Err("wrong number of arguments for 'pubsub' command"),
+	)
+}
+
+func fence_notify_sequence_test(mc *mockServer) error {
+	if err := mc.DoBatch(
+		Do("CONFIG", "SET", "notify-sequence", "maybe").Err("Invalid argument 'maybe' for CONFIG SET 'notify-sequence'"),
+		Do("CONFIG", "SET", "notify-sequence", "yes").OK(),
+	); err != nil {
+		return err
+	}
+	defer mc.DoBatch(Do("CONFIG", "SET", "notify-sequence", "no").OK())
+	conn, err := net.Dial("tcp", fmt.Sprintf(":%d", mc.port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = fmt.Fprintf(conn, "NEARBY mykey FENCE DETECT inside POINT 33 -115 5000\r\n")
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return err
+	}
+	if res := string(buf[:n]); res != "+OK\r\n" {
+		return fmt.Errorf("expected OK, got '%v'", res)
+	}
+	rd := &fenceReader{conn, bufio.NewReader(conn)}
+	var seqs []int64
+	for _, id := range []string{"myid1", "myid2"} {
+		start := time.Now().UnixNano()
+		if err := mc.DoBatch(Do("SET", "mykey", id, "POINT", 33, -115).OK()); err != nil {
+			return err
+		}
+		msg, err := rd.receive()
+		if err != nil {
+			return err
+		}
+		received := gjson.Get(msg, "received").Int()
+		if received < start || received > time.Now().UnixNano() {
+			return fmt.Errorf("unexpected received time: %s", msg)
+		}
+		seqs = append(seqs, gjson.Get(msg, "seq").Int())
+	}
+	if seqs[0] == 0 || seqs[1] != seqs[0]+1 {
+		return fmt.Errorf("expected consecutive sequences, got %v", seqs)
+	}
+	return nil
+}
+
+func fence_arm_test(mc *mockServer) error {
+	enter := func(s string) error {
+		if got := gjson.Get(s, "notifications.#.detect").Raw; got != `["enter"]` {
+			return fmt.Errorf("expected an enter notification, got '%s'", s)
+		}
+		return nil
+	}
+	return mc.DoBatch(
+		Do("SET", "fleet", "truck1", "POINT", 30, 30).OK(),
+		Do("SETCHAN", "perimeter", "WITHIN", "fleet", "FENCE", "ARM", "vips", "vip1", "DETECT", "enter", "BOUNDS", 0, 0, 10, 10).Str("1"),
+		Do("FENCETEST", "fleet", "truck1", "FROM", "POINT", -5, -5, "TO", "POINT", 5, 5).Str("[]"),
+		Do("SET", "vips", "vip1", "POINT", 50, 50).OK(),
+		Do("FENCETEST", "fleet", "truck1", "FROM", "POINT", -5, -5, "TO", "POINT", 5, 5).Str("[]"),
+		Do("SET", "vips", "vip1", "POINT", 5, 5).OK(),
+		Do("FENCETEST", "fleet", "truck1", "FROM", "POINT", -5, -5, "TO", "POINT", 5, 5).JSON().Func(enter),
+		Do("DEL", "vips", "vip1").Str("1"),
+		Do("FENCETEST", "fleet", "truck1", "FROM", "POINT", -5, -5, "TO", "POINT", 5, 5).Str("[]"),
+		Do("WITHIN", "fleet", "ARM", "vips", "vip1", "BOUNDS", 0, 0, 10, 10).Err("ARM is not allowed when FENCE is not specified"),
+		Do("SETCHAN", "bad", "NEARBY", "fleet", "FENCE", "ARM", "vips", "vip1", "ROAM", "fleet", "*", 100).Err("ARM is not allowed for ROAM"),
+		Do("SETCHAN", "bad", "WITHIN", "fleet", "FENCE", "ARM", "vips").Err("wrong number of arguments for 'setchan' command"),
+		Do("DELCHAN", "perimeter").Str("1"),
+	)
+}
+
+func fence_fsetwhere_test(mc *mockServer) error {
+	err := mc.DoBatch(
+		Do("SET", "fleet", "truck1", "FIELD", "route", 42, "POINT", 33, -115).OK(),
+		Do("SET", "fleet", "truck2", "FIELD", "route", 7, "POINT", 33.01, -115).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	conn, err := net.Dial("tcp", fmt.Sprintf(":%d", mc.port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = fmt.Fprintf(conn, "NEARBY fleet FENCE POINT 33 -115 5000\r\n")
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return err
+	}
+	if res := string(buf[:n]); res != "+OK\r\n" {
+		return fmt.Errorf("expected OK, got '%v'", res)
+	}
+	rd := &fenceReader{conn, bufio.NewReader(conn)}
+	err = mc.DoBatch(
+		Do("FSETWHERE", "fleet", "detour", 1, "WHERE", "route", 42, 42).Str("1"),
+	)
+	if err != nil {
+		return err
+	}
+	// only the updated object is notified
+	return rd.receiveExpect("command", "fset", "detect", "inside",
+		"id", "truck1", "fields.detour", "1")
+}
+
+func fence_mset_test(mc *mockServer) error {
+	conn, err := net.Dial("tcp", fmt.Sprintf(":%d", mc.port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = fmt.Fprintf(conn, "NEARBY fleet FENCE DETECT enter POINT 33 -115 5000\r\n")
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return err
+	}
+	if res := string(buf[:n]); res != "+OK\r\n" {
+		return fmt.Errorf("expected OK, got '%v'", res)
+	}
+	rd := &fenceReader{conn, bufio.NewReader(conn)}
+	err = mc.DoBatch(
+		Do("MSET", "fleet", "truck1", "POINT", 33, -115, "truck2", "POINT", 33.01, -115).Str("2"),
+	)
+	if err != nil {
+		return err
+	}
+	// each object is notified
+	if err := rd.receiveExpect("command", "set", "detect", "enter",
+		"id", "truck1"); err != nil {
+		return err
+	}
+	return rd.receiveExpect("command", "set", "detect", "enter",
+		"id", "truck2")
+}
+
+func fence_rename_test(mc *mockServer) error {
+	err := mc.DoBatch(
+		Do("SET", "fleet", "truck1", "POINT", 10, 10).OK(),
+		Do("SETCHAN", "moved", "META", "team", "ops", "NEARBY", "fleet", "FENCE", "DETECT", "enter", "POINT", 33, -115, 5000).Str("1"),
+		Do("RENAME", "fleet", "fleet2").OK(),
+		Do("CHANS", "moved").JSON().Func(func(s string) error {
+			if gjson.Get(s, "chans.0.key").String() != "fleet2" ||
+				gjson.Get(s, "chans.0.meta.team").String() != "ops" {
+				return fmt.Errorf("unexpected chans '%s'", s)
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	conn, err := dialTile38(mc.port)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Do("SUBSCRIBE", "moved"); err != nil {
+		return err
+	}
+	err = mc.DoBatch(
+		Do("SET", "fleet", "truck2", "POINT", 33, -115).OK(),
+		Do("SET", "fleet2", "truck1", "POINT", 33, -115).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	// only the renamed key is watched
+	js, err := redis.String(conn.Receive())
+	if err != nil {
+		return err
+	}
+	if gjson.Get(js, "key").String() != "fleet2" ||
+		gjson.Get(js, "id").String() != "truck1" {
+		return fmt.Errorf("unexpected message '%s'", js)
+	}
+	return nil
+}
+
+func fence_debezium_test(mc *mockServer) error {
+	err := mc.DoBatch(
+		Do("SETCHAN", "cdc", "FORMAT", "avro", "WITHIN", "fleet", "FENCE", "BOUNDS", 0, 0, 20, 20).Err("invalid argument 'avro'"),
+		Do("SETCHAN", "cdc", "FORMAT").Err("wrong number of arguments for 'setchan' command"),
+		Do("SETCHAN", "cdc", "META", "team", "data", "FORMAT", "debezium", "WITHIN", "fleet", "FENCE", "BOUNDS", 0, 0, 20, 20).Str("1"),
+		Do("SETCHAN", "cdc", "META", "team", "data", "FORMAT", "DEBEZIUM", "WITHIN", "fleet", "FENCE", "BOUNDS", 0, 0, 20, 20).Str("0"),
+		Do("CHANS", "*").JSON().Func(func(s string) error {
+			if gjson.Get(s, "chans.0.format").String() != "debezium" {
+				return fmt.Errorf("expected the debezium format, got '%s'", s)
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	conn, err := dialTile38(mc.port)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Do("SUBSCRIBE", "cdc"); err != nil {
+		return err
+	}
+	receive := func(expect map[string]string) error {
+		js, err := redis.String(conn.Receive())
+		if err != nil {
+			return err
+		}
+		for path, val := range expect {
+			if got := gjson.Get(js, path).Raw; got != val {
+				return fmt.Errorf("expected '%s' for '%s', got '%s' in '%s'",
+					val, path, got, js)
+			}
+		}
+		return nil
+	}
+	err = mc.DoBatch(
+		Do("SET", "fleet", "truck1", "POINT", 5, 5).OK(),
+		Do("SET", "fleet", "truck1", "FIELD", "speed", 30, "POINT", 6, 6).OK(),
+		Do("DEL", "fleet", "truck1").Str("1"),
+	)
+	if err != nil {
+		return err
+	}
+	// one event for each change, even when the fence detects an enter and
+	// an inside
+	if err := receive(map[string]string{
+		"op":                `"c"`,
+		"hook":              `"cdc"`,
+		"meta.team":         `"data"`,
+		"before":            `null`,
+		"after":             `{"id":"truck1","object":{"type":"Point","coordinates":[5,5]}}`,
+		"source.connector":  `"tile38"`,
+		"source.name":       `"cdc"`,
+		"source.collection": `"fleet"`,
+	}); err != nil {
+		return err
+	}
+	if err := receive(map[string]string{
+		"op":     `"u"`,
+		"before": `{"id":"truck1","object":{"type":"Point","coordinates":[5,5]}}`,
+		"after":  `{"id":"truck1","object":{"type":"Point","coordinates":[6,6]},"fields":{"speed":30}}`,
+	}); err != nil {
+		return err
+	}
+	return receive(map[string]string{
+		"op":     `"d"`,
+		"before": `{"id":"truck1","object":{"type":"Point","coordinates":[6,6]},"fields":{"speed":30}}`,
+		"after":  `null`,
+	})
+}
+
+func fence_preexpire_test(mc *mockServer) error {
+	err := mc.DoBatch(
+		Do("PREEXPIRE", "fleet", -1).Err("invalid argument '-1'"),
+		Do("PREEXPIRE", "fleet", "soon").Err("invalid argument 'soon'"),
+		Do("PREEXPIRE", "fleet", 1).OK(),
+		Do("SETCHAN", "warn", "WITHIN", "fleet", "FENCE", "COMMANDS", "preexpire,del", "BOUNDS", 0, 0, 20, 20).Str("1"),
+	)
+	if err != nil {
+		return err
+	}
+	conn, err := dialTile38(mc.port)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Do("SUBSCRIBE", "warn"); err != nil {
+		return err
+	}
+	receive := func(command string) (string, error) {
+		js, err := redis.String(conn.Receive())
+		if err != nil {
+			return "", err
+		}
+		if gjson.Get(js, "command").String() != command ||
+			gjson.Get(js, "id").String() != "truck1" {
+			return "", fmt.Errorf("expected '%s' for truck1, got '%s'", command, js)
+		}
+		return js, nil
+	}
+	start := time.Now()
+	err = mc.DoBatch(
+		Do("SET", "fleet", "truck1", "EX", 2, "POINT", 5, 5).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	// the warning comes a second before the expiration, and only once
+	js, err := receive("preexpire")
+	if err != nil {
+		return err
+	}
+	if el := time.Since(start); el < time.Second/2 || el > time.Second*3/2 {
+		return fmt.Errorf("expected the preexpire after about a second, got %s", el)
+	}
+	expires, err := time.Parse(time.RFC3339Nano, gjson.Get(js, "expires").String())
+	if err != nil {
+		return err
+	}
+	if d := expires.Sub(start); d < time.Second*3/2 || d > time.Second*5/2 {
+		return fmt.Errorf("expected expires in about 2 seconds, got '%s'", js)
+	}
+	if _, err := receive("del"); err != nil {
+		return err
+	}
+	if el := time.Since(start); el < time.Second*3/2 {
+		return fmt.Errorf("expected the del after about two seconds, got %s", el)
+	}
+	// an expiration that comes before one that was warned about already
+	err = mc.DoBatch(
+		Do("PREEXPIRE", "fleet", 10).OK(),
+		Do("SET", "fleet", "truck2", "EX", 5, "POINT", 5, 5).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	js, err = redis.String(conn.Receive())
+	if err != nil {
+		return err
+	}
+	if gjson.Get(js, "id").String() != "truck2" {
+		return fmt.Errorf("expected 'preexpire' for truck2, got '%s'", js)
+	}
+	err = mc.DoBatch(
+		Do("SET", "fleet", "truck1", "EX", 3, "POINT", 5, 5).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	start = time.Now()
+	if _, err := receive("preexpire"); err != nil {
+		return err
+	}
+	if el := time.Since(start); el > time.Second/2 {
+		return fmt.Errorf("expected the preexpire right away, got %s", el)
+	}
+	// no warnings once the lead time is taken away
+	err = mc.DoBatch(
+		Do("PREEXPIRE", "fleet", 0).OK(),
+		Do("SET", "fleet", "truck1", "EX", 1, "POINT", 5, 5).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = receive("del")
+	return err
+}
+
+func fence_hookvalidate_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("HOOKVALIDATE", "h1", "http://localhost:9999/a, http://localhost:9999/b",
+			"META", "z", "1", "META", "a", "2", "EX", "30.5", "FORMAT", "json",
+			"within", "fleet", "FENCE", "DETECT", "enter,exit", "WHERE", "speed", 0, 100,
+			"BOUNDS", 0, 0, 20, 20).
+			Str("[SETHOOK h1 http://localhost:9999/a,http://localhost:9999/b META a 2 META z 1 EX 30.5 WITHIN fleet FENCE DETECT enter,exit WHERE speed 0 100 BOUNDS 0 0 20 20]"),
+		Do("HOOKVALIDATE", "h1", "http://localhost:9999/a", "FORMAT", "debezium",
+			"NEARBY", "fleet", "FENCE", "POINT", 10, 10, 1000).JSON().
+			Str(`{"ok":true,"command":["SETHOOK","h1","http://localhost:9999/a","FORMAT","DEBEZIUM","NEARBY","fleet","FENCE","POINT","10","10","1000"]}`),
+		Do("HOOKS", "*").Str("[]"),
+		Do("HOOKVALIDATE", "h1", "bad://endpoint", "WITHIN", "fleet", "FENCE", "BOUNDS", 0, 0, 20, 20).Err("invalid argument 'bad://endpoint'"),
+		Do("HOOKVALIDATE", "h1", "http://localhost:9999/a", "FORMAT", "xml", "WITHIN", "fleet", "FENCE", "BOUNDS", 0, 0, 20, 20).Err("invalid argument 'xml'"),
+		Do("HOOKVALIDATE", "h1", "http://localhost:9999/a", "WITHIN", "fleet", "FENCE", "DETECT", "nope", "BOUNDS", 0, 0, 20, 20).Err("invalid argument 'nope'"),
+		Do("HOOKVALIDATE", "h1", "http://localhost:9999/a", "WITHIN").Err("wrong number of arguments for 'hookvalidate' command"),
+	)
+}
+
+func fence_hookhealth_test(mc *mockServer) error {
+	// nothing listens at port 1 so the broker is unreachable
+	err := mc.DoBatch(
+		Do("SETHOOK", "h1", "amqp://127.0.0.1:1/tile38?delivery_mode=persistent",
+			"WITHIN", "fleet", "FENCE", "BOUNDS", 0, 0, 20, 20).Str("1"),
+		Do("SETHOOK", "h2", "amqp://127.0.0.1:1/tile38?type=queue",
+			"WITHIN", "fleet", "FENCE", "BOUNDS", 0, 0, 20, 20).
+			Err("invalid argument 'amqp://127.0.0.1:1/tile38?type=queue'"),
+		Do("HOOKS", "*").JSON().Func(func(s string) error {
+			if !gjson.Get(s, "hooks.0.healthy").Bool() {
+				return fmt.Errorf("expected a healthy hook, got %s", s)
+			}
+			return nil
+		}),
+		Do("SET", "fleet", "truck1", "POINT", 5, 5).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	// the send fails in the background and is retried
+	start := time.Now()
+	for {
+		err := mc.DoBatch(Do("HOOKS", "*").JSON().Func(func(s string) error {
+			if gjson.Get(s, "hooks.0.healthy").Bool() {
+				return fmt.Errorf("expected an unhealthy hook, got %s", s)
+			}
+			if gjson.Get(s, "hooks.0.error").String() == "" {
+				return fmt.Errorf("expected an error, got %s", s)
+			}
+			return nil
+		}))
+		if err == nil {
+			break
+		}
+		if time.Since(start) > time.Second*5 {
+			return err
+		}
+		time.Sleep(time.Second / 10)
+	}
+	return mc.DoBatch(Do("DELHOOK", "h1").Str("1"))
+}
+
+func fence_hookretries_test(mc *mockServer) error {
+	// nothing listens at port 1, so both messages are dropped
+	err := mc.DoBatch(
+		Do("SETHOOK", "h1", "http://127.0.0.1:1/hook?retries=2&backoff=10ms",
+			"WITHIN", "fleet", "FENCE", "DETECT", "enter", "BOUNDS", 0, 0, 20, 20).Str("1"),
+		Do("SETHOOK", "h2", "http://127.0.0.1:1/hook?retries=2&backoff=1s&maxbackoff=10ms",
+			"WITHIN", "fleet", "FENCE", "BOUNDS", 0, 0, 20, 20).
+			Err("invalid argument 'http://127.0.0.1:1/hook?retries=2&backoff=1s&maxbackoff=10ms'"),
+		Do("SET", "fleet", "truck1", "POINT", 5, 5).OK(),
+		Do("SET", "fleet", "truck2", "POINT", 6, 6).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	for {
+		err := mc.DoBatch(Do("HOOKS", "*").JSON().Func(func(s string) error {
+			sent := gjson.Get(s, "hooks.0.sent").Int()
+			failed := gjson.Get(s, "hooks.0.failed").Int()
+			if sent != 0 || failed != 2 {
+				return fmt.Errorf("expected two failed messages, got %s", s)
+			}
+			return nil
+		}))
+		if err == nil {
+			break
+		}
+		if time.Since(start) > time.Second*5 {
+			return err
+		}
+		time.Sleep(time.Second / 10)
+	}
+	return mc.DoBatch(
+		Do("INFO", "stats").Func(func(s string) error {
+			if !strings.Contains(s, "total_messages_dropped:") {
+				return fmt.Errorf("expected total_messages_dropped, got %s", s)
+			}
+			return nil
+		}),
+		Do("DELHOOK", "h1").Str("1"),
+	)
+}
+
+func fence_hookdeadletter_test(mc *mockServer) error {
+	conn, err := redis.Dial("tcp", fmt.Sprintf(":%d", mc.port),
+		redis.DialReadTimeout(time.Second*5))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Do("SUBSCRIBE", "dlq"); err != nil {
+		return err
+	}
+	err = mc.DoBatch(
+		Do("CONFIG", "SET", "hook-dead-letter", "bad://dlq").Err("Invalid argument 'bad://dlq' for CONFIG SET 'hook-dead-letter'"),
+		Do("CONFIG", "SET", "hook-dead-letter", "local://dlq").OK(),
+		Do("CONFIG", "GET", "hook-dead-letter").Str("[hook-dead-letter local://dlq]"),
+		// nothing listens at port 1, so the message is dropped right away
+		Do("SETHOOK", "h1", "http://127.0.0.1:1/hook?retries=0",
+			"WITHIN", "fleet", "FENCE", "DETECT", "enter", "BOUNDS", 0, 0, 20, 20).Str("1"),
+		Do("SET", "fleet", "truck1", "POINT", 5, 5).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	vals, err := redis.Values(conn.Receive())
+	if err != nil {
+		return err
+	}
+	if len(vals) != 3 {
+		return fmt.Errorf("expected a message, got %v", vals)
+	}
+	letter, _ := redis.String(vals[2], nil)
+	for path, expect := range map[string]string{
+		"hook":           "h1",
+		"endpoint":       "http://127.0.0.1:1/hook?retries=0",
+		"message.id":     "truck1",
+		"message.detect": "enter",
+	} {
+		if gjson.Get(letter, path).String() != expect {
+			return fmt.Errorf("expected '%s'='%s', got %s", path, expect, letter)
+		}
+	}
+	if gjson.Get(letter, "reason").String() == "" {
+		return fmt.Errorf("expected a reason, got %s", letter)
+	}
+	return mc.DoBatch(
+		Do("DELHOOK", "h1").Str("1"),
+		Do("CONFIG", "SET", "hook-dead-letter", "").OK(),
+	)
+}
+
+func fence_hookclientcerts_test(mc *mockServer) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	certFile := filepath.Join(mc.dir, "client.pem")
+	keyFile := filepath.Join(mc.dir, "client-key.pem")
+	err = os.WriteFile(certFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	if err != nil {
+		return err
+	}
+	certs := "client:" + certFile + ":" + keyFile
+	return mc.DoBatch(
+		Do("SETHOOK", "h1", "https://localhost:9999/hook?cert=client",
+			"WITHIN", "fleet", "FENCE", "BOUNDS", 0, 0, 20, 20).
+			Err("invalid argument 'https://localhost:9999/hook?cert=client'"),
+		Do("CONFIG", "SET", "hook-client-certs", "client:"+certFile+":"+certFile).
+			Err("Invalid argument 'client:"+certFile+":"+certFile+"' for CONFIG SET 'hook-client-certs'"),
+		Do("CONFIG", "SET", "hook-client-certs", certs).OK(),
+		Do("CONFIG", "GET", "hook-client-certs").Str("[hook-client-certs "+certs+"]"),
+		Do("SETHOOK", "h1", "https://localhost:9999/hook?cert=client",
+			"WITHIN", "fleet", "FENCE", "BOUNDS", 0, 0, 20, 20).Str("1"),
+		Do("DELHOOK", "h1").Str("1"),
+		Do("CONFIG", "SET", "hook-client-certs", "").OK(),
+	)
+}
+
+func fence_dwell_test(mc *mockServer) error {
+	conn, err := redis.Dial("tcp", fmt.Sprintf(":%d", mc.port),
+		redis.DialReadTimeout(time.Second*2))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = mc.DoBatch(
+		Do("SETCHAN", "c1", "WITHIN", "fleet", "FENCE", "DWELL", 0,
+			"BOUNDS", 0, 0, 20, 20).Err("invalid argument '0'"),
+		Do("SETCHAN", "c1", "WITHIN", "fleet", "FENCE", "DWELL", 1, "NODWELL",
+			"BOUNDS", 0, 0, 20, 20).Err("DWELL is not allowed with NODWELL"),
+		Do("WITHIN", "fleet", "DWELL", 1, "BOUNDS", 0, 0, 20, 20).
+			Err("DWELL is not allowed when FENCE is not specified"),
+		Do("SETCHAN", "c1", "WITHIN", "fleet", "FENCE", "DETECT", "enter,dwell",
+			"DWELL", 0.5, "BOUNDS", 0, 0, 20, 20).Str("1"),
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Do("SUBSCRIBE", "c1"); err != nil {
+		return err
+	}
+	receive := func(detect string) error {
+		vals, err := redis.Values(conn.Receive())
+		if err != nil {
+			return err
+		}
+		msg, _ := redis.String(vals[2], nil)
+		if gjson.Get(msg, "detect").String() != detect {
+			return fmt.Errorf("expected '%s', got %s", detect, msg)
+		}
+		return nil
+	}
+	for _, step := range []struct {
+		x, y   float64
+		wait   time.Duration
+		detect string
+	}{
+		{5, 5, 0, "enter"},
+		{6, 6, 0, ""},
+		{7, 7, time.Second * 3 / 4, "dwell"},
+		{8, 8, time.Second * 3 / 4, ""},      // only once for each enter
+		{50, 50, 0, ""},                      // exit is not detected
+		{9, 9, time.Second * 3 / 4, "enter"}, // dwell starts over
+		{10, 10, 0, ""},
+	} {
+		time.Sleep(step.wait)
+		err := mc.DoBatch(Do("SET", "fleet", "truck1", "POINT", step.y, step.x).OK())
+		if err != nil {
+			return err
+		}
+		if step.detect != "" {
+			if err := receive(step.detect); err != nil {
+				return err
+			}
+		}
+	}
+	time.Sleep(time.Second * 3 / 4)
+	err = mc.DoBatch(Do("SET", "fleet", "truck1", "POINT", 11, 11).OK())
+	if err != nil {
+		return err
+	}
+	if err := receive("dwell"); err != nil {
+		return err
+	}
+	return mc.DoBatch(Do("DELCHAN", "c1").Str("1"))
+}
+
+func fence_dwell_roam_test(mc *mockServer) error {
+	conn, err := redis.Dial("tcp", fmt.Sprintf(":%d", mc.port),
+		redis.DialReadTimeout(time.Second*2))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = mc.DoBatch(
+		Do("SET", "roamers", "truck1", "POINT", 33, -115).OK(),
+		Do("SETCHAN", "c2", "NEARBY", "roamers", "MATCH", "truck2", "FENCE",
+			"DWELL", 0.5, "ROAM", "roamers", "truck1", 1000).Str("1"),
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Do("SUBSCRIBE", "c2"); err != nil {
+		return err
+	}
+	// receive checks the detect of a message and the pair that it's about
+	receive := func(detect, kind string) error {
+		vals, err := redis.Values(conn.Receive())
+		if err != nil {
+			return err
+		}
+		msg, _ := redis.String(vals[2], nil)
+		if gjson.Get(msg, "detect").String() != detect ||
+			gjson.Get(msg, kind+".id").String() != "truck1" {
+			return fmt.Errorf("expected '%s' %s, got %s", detect, kind, msg)
+		}
+		return nil
+	}
+	type message struct{ detect, kind string }
+	nearby := message{"roam", "nearby"}
+	faraway := message{"roam", "faraway"}
+	dwell := message{"dwell", "nearby"}
+	for _, step := range []struct {
+		lat  float64
+		wait time.Duration
+		msgs []message
+	}{
+		{33.001, 0, []message{nearby}},
+		{33.002, time.Second * 3 / 4, []message{nearby, dwell}},
+		{33.003, time.Second * 3 / 4, []message{nearby}}, // only once
+		{34, 0, []message{faraway}},
+		{33.001, time.Second * 3 / 4, []message{nearby}}, // dwell starts over
+		{33.002, 0, []message{nearby}},
+		{33.003, time.Second * 3 / 4, []message{nearby, dwell}},
+	} {
+		time.Sleep(step.wait)
+		err := mc.DoBatch(
+			Do("SET", "roamers", "truck2", "POINT", step.lat, -115).OK())
+		if err != nil {
+			return err
+		}
+		for _, m := range step.msgs {
+			if err := receive(m.detect, m.kind); err != nil {
+				return err
+			}
+		}
+	}
+	return mc.DoBatch(
+		Do("DELCHAN", "c2").Str("1"),
+		Do("DROP", "roamers").Str("1"),
+	)
+}
+
+func fence_crossed_test(mc *mockServer) error {
+	conn, err := redis.Dial("tcp", fmt.Sprintf(":%d", mc.port),
+		redis.DialReadTimeout(time.Second*2))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = mc.DoBatch(
+		Do("SETCHAN", "c1", "INTERSECTS", "fleet", "FENCE", "DETECT", "enter,cross",
+			"OBJECT", `{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10],[0,0]]]}`).Str("1"),
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Do("SUBSCRIBE", "c1"); err != nil {
+		return err
+	}
+	receive := func() (string, error) {
+		vals, err := redis.Values(conn.Receive())
+		if err != nil {
+			return "", err
+		}
+		return redis.String(vals[2], nil)
+	}
+	err = mc.DoBatch(
+		Do("SET", "fleet", "truck1", "POINT", 5, -5).OK(),
+		Do("SET", "fleet", "truck1", "POINT", 5, 15).OK(),
+		Do("SET", "fleet", "truck1", "POINT", 5, 5).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	msg, err := receive()
+	if err != nil {
+		return err
+	}
+	if gjson.Get(msg, "detect").String() != "cross" {
+		return fmt.Errorf("expected cross, got %s", msg)
+	}
+	crossed := gjson.Get(msg, "crossed").Raw
+	if crossed != `[{"segment":[[0,10],[0,0]],"point":[0,5]},{"segment":[[10,0],[10,10]],"point":[10,5]}]` {
+		return fmt.Errorf("unexpected crossed, got %s", msg)
+	}
+	msg, err = receive()
+	if err != nil {
+		return err
+	}
+	if gjson.Get(msg, "detect").String() != "enter" ||
+		gjson.Get(msg, "crossed").Exists() {
+		return fmt.Errorf("expected enter without crossed, got %s", msg)
+	}
+	return mc.DoBatch(Do("DELCHAN", "c1").Str("1"))
+}
@@ -1,14 +1,53 @@
 package tests
 
-import "time"
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/tidwall/gjson"
+)
 
 func subTestFollower(g *testGroup) {
 	g.regSubTest("follow", follower_follow_test)
+	g.regSubTest("promote", follower_promote_test)
+	g.regSubTest("replicate publish", follower_replicate_publish_test)
+	g.regSubTest("slow follower", follower_slow_follower_test)
+	g.regSubTest("followers", follower_followers_test)
+	g.regSubTest("tls", follower_tls_test)
+	g.regSubTest("upstreams", follower_upstreams_test)
+	g.regSubTest("upstreams reconnect", follower_upstreams_reconnect_test)
+	g.regSubTest("compress", follower_compress_test)
+	g.regSubTest("leader timeout", follower_leader_timeout_test)
+	g.regSubTest("lag", follower_lag_test)
+	g.regSubTest("read only", follower_read_only_test)
+	g.regSubTest("replicaof", follower_replicaof_test)
+	g.regSubTest("resync", follower_resync_test)
+	g.regSubTest("apply buffer", follower_apply_buffer_test)
+	g.regSubTest("replication tokens", follower_replication_tokens_test)
+	g.regSubTest("leader id change", follower_leader_id_change_test)
+	g.regSubTest("healthz", follower_healthz_test)
 }
 
 func follower_follow_test(mc *mockServer) error {
 	mc2, err := mockOpenServer(MockServerOptions{
-		Silent: true, Metrics: false,
+		Silent: true, Metrics: true,
 	})
 	if err != nil {
 		return err
@@ -49,6 +88,8 @@ func follower_follow_test(mc *mockServer) error {
 		Do("SET", "mykey", "truck7", "POINT", 10, 10).OK(),
 		Do("SET", "mykey", "truck8", "POINT", 10, 10).OK(),
 		Do("SET", "mykey", "truck9", "POINT", 10, 10).OK(),
+		Do("SET", "mykey", "truck10", "EX", 100, "POINT", 10, 10).OK(),
+		Do("PERSIST", "mykey", "truck10").Str("1"),
 	)
 	if err != nil {
 		return err
@@ -59,10 +100,1258 @@ func follower_follow_test(mc *mockServer) error {
 		Do("GET", "mykey", "truck7").Str(`{"type":"Point","coordinates":[10,10]}`),
 		Do("GET", "mykey", "truck8").Str(`{"type":"Point","coordinates":[10,10]}`),
 		Do("GET", "mykey", "truck9").Str(`{"type":"Point","coordinates":[10,10]}`),
+		Do("TTL", "mykey", "truck10").Str("-1"),
+		Do("NODESTATUS").JSON().Func(func(s string) error {
+			if gjson.Get(s, "status.role").String() != "follower" {
+				return errors.New("expected follower")
+			}
+			if !gjson.Get(s, "status.caught_up").Bool() {
+				return errors.New("expected caught up")
+			}
+			if gjson.Get(s, "status.lag").Int() != 0 {
+				return errors.New("expected no lag")
+			}
+			return nil
+		}),
+		Do("SERVER").JSON().Func(func(s string) error {
+			if !gjson.Get(s, "stats.caught_up").Bool() {
+				return errors.New("expected caught up")
+			}
+			if lag := gjson.Get(s, "stats.repl_lag_bytes"); !lag.Exists() ||
+				lag.Int() != 0 {
+				return fmt.Errorf("expected no lag, got '%s'", lag.Raw)
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	_, metrics, err := downloadURLWithStatusCode(
+		fmt.Sprintf("http://127.0.0.1:%d/metrics", mc2.metricsPort()))
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(metrics, "\ntile38_replication_lag_bytes 0\n") {
+		return errors.New("expected the replication lag metric")
+	}
+
+	// the leader has no replication lag
+	return mc.DoBatch(
+		Do("SERVER").JSON().Func(func(s string) error {
+			if gjson.Get(s, "stats.repl_lag_bytes").Exists() {
+				return errors.New("expected no replication lag for a leader")
+			}
+			return nil
+		}),
+	)
+}
+
+func follower_promote_test(mc *mockServer) error {
+	mc2, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	err = mc.DoBatch(
+		Do("SET", "mykey", "truck1", "POINT", 10, 10).OK(),
+		Do("SET", "mykey", "truck2", "POINT", 10, 10).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	var id string
+	err = mc2.DoBatch(
+		Do("PROMOTE").Err("not a follower"),
+		Do("SERVER").JSON().Func(func(s string) error {
+			id = gjson.Get(s, "stats.id").String()
+			return nil
+		}),
+		Do("FOLLOW", "localhost", mc.port).OK(),
+		Do("READONLY", "yes").OK(),
+		Do("PROMOTE", "NOW").Err("invalid argument 'NOW'"),
+		Sleep(time.Second/2),
+		Do("GET", "mykey", "truck2").Str(`{"type":"Point","coordinates":[10,10]}`),
+		Do("PROMOTE").JSON().Func(func(s string) error {
+			if !gjson.Get(s, "ok").Bool() {
+				return errors.New("not ok")
+			}
+			if gjson.Get(s, "id").String() == id {
+				return errors.New("expected a new server id")
+			}
+			if gjson.Get(s, "aof_size").Int() == 0 {
+				return errors.New("expected an aof size")
+			}
+			return nil
+		}),
+		Do("NODESTATUS").JSON().Func(func(s string) error {
+			if gjson.Get(s, "status.role").String() != "leader" {
+				return errors.New("expected leader")
+			}
+			return nil
+		}),
+		Do("SET", "mykey", "truck3", "POINT", 10, 10).OK(),
+		Do("PROMOTE").Err("not a follower"),
+	)
+	if err != nil {
+		return err
+	}
+
+	// the old leader's writes are no longer applied
+	err = mc.DoBatch(
+		Do("SET", "mykey", "truck4", "POINT", 10, 10).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	return mc2.DoBatch(
+		Sleep(time.Second/4),
+		Do("GET", "mykey", "truck4").Str("<nil>"),
+	)
+}
+
+func follower_replicate_publish_test(mc *mockServer) error {
+	mc2, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	err = mc.DoBatch(
+		Do("CONFIG", "GET", "replicate-publish").Str("[replicate-publish no]"),
+		Do("CONFIG", "SET", "replicate-publish", "maybe").Err("Invalid argument 'maybe' for CONFIG SET 'replicate-publish'"),
+		Do("PUBLISH", "news", "not relayed").Str("0"),
+		Do("CONFIG", "SET", "replicate-publish", "yes").OK(),
+		Do("PUBLISH", "news", "old").Str("0"),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc2.DoBatch(
+		Do("FOLLOW", "localhost", mc.port).OK(),
+		Sleep(time.Second/2),
+	)
+	if err != nil {
+		return err
+	}
+
+	// subscribe on the follower
+	sc, err := redis.Dial("tcp", fmt.Sprintf(":%d", mc2.port))
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+	psc := redis.PubSubConn{Conn: sc}
+	if err := psc.Subscribe("news"); err != nil {
+		return err
+	}
+	if _, ok := psc.Receive().(redis.Subscription); !ok {
+		return errors.New("expected subscription")
+	}
+	err = mc.DoBatch(
+		Do("PUBLISH", "news", "hello").Str("0"),
+	)
+	if err != nil {
+		return err
+	}
+	switch v := psc.ReceiveWithTimeout(time.Second * 2).(type) {
+	case redis.Message:
+		if string(v.Data) != "hello" {
+			return fmt.Errorf("expected 'hello', got '%s'", v.Data)
+		}
+	case error:
+		return v
+	default:
+		return fmt.Errorf("unexpected '%v'", v)
+	}
+
+	// the message is only sent once
+	if v, ok := psc.ReceiveWithTimeout(time.Second / 4).(redis.Message); ok {
+		return fmt.Errorf("unexpected message '%s'", v.Data)
+	}
+
+	// the follower writes the relayed messages to its aof
+	time.Sleep(time.Second / 4)
+	data, err := mc2.readAOF()
+	if err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(data, []byte("*3\r\n$7\r\nPUBLISH\r\n$4\r\nnews\r\n"+
+		"$3\r\nold\r\n*3\r\n$7\r\nPUBLISH\r\n$4\r\nnews\r\n$5\r\nhello\r\n")) {
+		return fmt.Errorf("expected relayed messages in aof, got %q", data)
+	}
+	if bytes.Contains(data, []byte("not relayed")) {
+		return fmt.Errorf("unexpected message in aof, got %q", data)
+	}
+	return nil
+}
+
+func follower_slow_follower_test(mc *mockServer) error {
+	defer mc.DoBatch(Do("CONFIG", "SET", "follower-max-lag", "").OK())
+	err := mc.DoBatch(
+		Do("CONFIG", "SET", "follower-max-lag", "fast").Err("Invalid argument 'fast' for CONFIG SET 'follower-max-lag'"),
+		Do("CONFIG", "SET", "follower-lag-action", "drop").Err("Invalid argument 'drop' for CONFIG SET 'follower-lag-action'"),
+		Do("CONFIG", "GET", "follower-lag-action").Str("[follower-lag-action disconnect]"),
+		Do("CONFIG", "SET", "follower-max-lag", "1mb").OK(),
+		Do("CONFIG", "GET", "follower-max-lag").Str("[follower-max-lag 1mb]"),
+		Do("SET", "mykey", "truck1", "POINT", 33, -115).OK(),
+	)
+	if err != nil {
+		return err
+	}
+
+	// a follower that never reads from its connection
+	conn, err := net.Dial("tcp", fmt.Sprintf(":%d", mc.port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("AOF 0\r\n")); err != nil {
+		return err
+	}
+	time.Sleep(time.Second / 4)
+	big := strings.Repeat("x", 100*1024)
+	for i := 0; i < 100; i++ {
+		if err := mc.DoBatch(
+			Do("SET", "mykey", fmt.Sprintf("str%d", i), "STRING", big).OK(),
+		); err != nil {
+			return err
+		}
+	}
+	time.Sleep(time.Second / 2)
+	return mc.DoBatch(
+		Do("INFO", "replication").Func(func(s string) error {
+			if !strings.Contains(s, "slow_follower_disconnects:1\r\n") ||
+				!strings.Contains(s, "connected_slaves:0\r\n") {
+				return fmt.Errorf("expected a disconnected follower, got %q", s)
+			}
+			return nil
+		}),
+	)
+}
+
+func follower_followers_test(mc *mockServer) error {
+	mc2, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	err = mc.DoBatch(
+		Do("FOLLOWERS").Str("[]"),
+		Do("FOLLOWERS").JSON().Str(`{"ok":true,"followers":[]}`),
+		Do("FOLLOWERS", "all").Err("wrong number of arguments for 'followers' command"),
+		Do("SET", "mykey", "truck1", "POINT", 33, -115).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc2.DoBatch(
+		Do("FOLLOW", "localhost", mc.port).OK(),
+		Sleep(time.Second/2),
+		Do("FOLLOWERS").JSON().Str(`{"ok":true,"followers":[]}`),
+	)
+	if err != nil {
+		return err
+	}
+	return mc.DoBatch(
+		Do("SET", "mykey", "truck2", "POINT", 33, -115).OK(),
+		Sleep(time.Second/4),
+		Do("FOLLOWERS").JSON().Func(func(s string) error {
+			followers := gjson.Get(s, "followers").Array()
+			if len(followers) != 1 {
+				return fmt.Errorf("expected one follower, got %s", s)
+			}
+			f := followers[0]
+			if f.Get("port").Int() != int64(mc2.port) ||
+				f.Get("state").String() != "online" ||
+				f.Get("offset").Int() == 0 || f.Get("backlog").Int() != 0 ||
+				!f.Get("age").Exists() || f.Get("addr").String() == "" {
+				return fmt.Errorf("unexpected follower %s", f.Raw)
+			}
+			return nil
+		}),
+	)
+}
+
+// tlsProxy accepts tls connections for localhost and forwards them to the
+// server. Returns the port of the proxy and the pem of its certificate.
+func tlsProxy(mc *mockServer) (port int, certPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		DNSNames:              []string{"localhost"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return 0, nil, err
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	go func() {
+		defer ln.Close()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sconn, err := net.Dial("tcp", fmt.Sprintf(":%d", mc.port))
+				if err != nil {
+					return
+				}
+				defer sconn.Close()
+				go io.Copy(sconn, conn)
+				io.Copy(conn, sconn)
+			}()
+		}
+	}()
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return ln.Addr().(*net.TCPAddr).Port, certPEM, nil
+}
+
+func follower_tls_test(mc *mockServer) error {
+	port, certPEM, err := tlsProxy(mc)
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "tile38-tls")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, certPEM, 0600); err != nil {
+		return err
+	}
+	junkFile := filepath.Join(dir, "junk.pem")
+	if err := os.WriteFile(junkFile, []byte("junk"), 0600); err != nil {
+		return err
+	}
+	mc2, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	err = mc.DoBatch(
+		Do("SET", "mykey", "truck1", "POINT", 10, 10).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	handshakeErr := func(s string) error {
+		if !strings.Contains(s, "cannot follow: tls handshake failed") {
+			return fmt.Errorf("expected a tls handshake error, got '%s'", s)
+		}
+		return nil
+	}
+	err = mc2.DoBatch(
+		Do("FOLLOW", "localhost", port, "SSL").Err("invalid argument 'SSL'"),
+		Do("FOLLOW", "no", "one", "TLS").Err("invalid argument 'TLS'"),
+		// the certificate is not trusted without the ca
+		Do("FOLLOW", "localhost", port, "TLS").Func(handshakeErr),
+		Do("CONFIG", "SET", "leader-ca-cert", filepath.Join(dir, "none.pem")).Err(
+			"Invalid argument '"+filepath.Join(dir, "none.pem")+"' for CONFIG SET 'leader-ca-cert'"),
+		Do("CONFIG", "SET", "leader-ca-cert", junkFile).Err("Invalid argument '"+junkFile+"' for CONFIG SET 'leader-ca-cert'"),
+		Do("CONFIG", "SET", "leader-ca-cert", caFile).OK(),
+		// the certificate is not for this host name
+		Do("FOLLOW", "127.0.0.1", port, "TLS").Func(handshakeErr),
+		Do("CONFIG", "GET", "leader-tls").Str("[leader-tls no]"),
+		Do("FOLLOW", "localhost", port, "TLS").OK(),
+		// FOLLOW TLS is kept with the follow host, not as leader-tls
+		Do("CONFIG", "GET", "leader-tls").Str("[leader-tls no]"),
+		Sleep(time.Second/2),
+		Do("GET", "mykey", "truck1").Str(`{"type":"Point","coordinates":[10,10]}`),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc.DoBatch(
+		Do("SET", "mykey", "truck2", "POINT", 20, 20).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc2.DoBatch(
+		Sleep(time.Second/2),
+		Do("GET", "mykey", "truck2").Str(`{"type":"Point","coordinates":[20,20]}`),
+		// without TLS the leader is followed in plaintext
+		Do("FOLLOW", "localhost", mc.port).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc.DoBatch(
+		Do("SET", "mykey", "truck3", "POINT", 30, 30).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	return mc2.DoBatch(
+		Sleep(time.Second/2),
+		Do("GET", "mykey", "truck3").Str(`{"type":"Point","coordinates":[30,30]}`),
+	)
+}
+
+func follower_upstreams_test(mc *mockServer) error {
+	mc2, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	mc3, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc3.Close()
+	defer mc.Do("PDELHOOK", "*")
+	err = mc.DoBatch(
+		Do("SET", "a:fleet", "truck1", "POINT", 10, 10).OK(),
+		Do("SET", "b:fleet", "truck9", "POINT", 10, 10).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc3.DoBatch(
+		Do("SET", "b:fleet", "truck2", "POINT", 20, 20).OK(),
+		Do("SET", "a:fleet", "truck9", "POINT", 20, 20).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc2.DoBatch(
+		Do("SET", "a:fleet", "truck8", "POINT", 30, 30).OK(),
+		Do("FOLLOW", "localhost", mc.port, "localhost", mc3.port).
+			Err("invalid argument 'localhost'"),
+		Do("FOLLOW", "localhost", mc.port, "PREFIX", "a:", "localhost",
+			mc3.port).
+			Err("PREFIX is required for each leader when following more than one"),
+		Do("FOLLOW", "localhost", mc.port, "PREFIX", "a:", "PREFIX", "b:").
+			Err("duplicate argument 'PREFIX'"),
+		Do("FOLLOW", "localhost", mc.port, "PREFIX", "a:", "localhost",
+			mc3.port, "PREFIX", "b:").OK(),
+		Sleep(time.Second/2),
+		Do("GET", "a:fleet", "truck1").Str(`{"type":"Point","coordinates":[10,10]}`),
+		Do("GET", "b:fleet", "truck2").Str(`{"type":"Point","coordinates":[20,20]}`),
+		// only the keys with the prefix of the leader are taken from it
+		Do("GET", "a:fleet", "truck9").Str("<nil>"),
+		Do("GET", "b:fleet", "truck9").Str("<nil>"),
+		// the keys of a leader are dropped before following it
+		Do("GET", "a:fleet", "truck8").Str("<nil>"),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc.DoBatch(
+		Do("SET", "a:fleet", "truck3", "POINT", 11, 11).OK(),
+		Do("SET", "b:fleet", "truck3", "POINT", 11, 11).OK(),
+		Do("SETHOOK", "a:hook", "http://localhost:1", "NEARBY", "a:fleet", "FENCE", "POINT", 10, 10, 100).Str("1"),
+		Do("SETHOOK", "b:hook", "http://localhost:1", "NEARBY", "b:fleet", "FENCE", "POINT", 10, 10, 100).Str("1"),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc3.DoBatch(
+		Do("SET", "b:fleet", "truck4", "POINT", 21, 21).OK(),
+		Do("DROP", "a:fleet").Str("1"),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc2.DoBatch(
+		Sleep(time.Second/2),
+		Do("GET", "a:fleet", "truck3").Str(`{"type":"Point","coordinates":[11,11]}`),
+		Do("GET", "b:fleet", "truck3").Str("<nil>"),
+		Do("GET", "b:fleet", "truck4").Str(`{"type":"Point","coordinates":[21,21]}`),
+		Do("SCAN", "a:fleet", "COUNT").Str("2"),
+		// hooks are taken from the leader when their name has its prefix
+		Do("HOOKS", "*").JSON().Func(func(s string) error {
+			hooks := gjson.Get(s, "hooks.#.name").String()
+			if hooks != `["a:hook"]` {
+				return fmt.Errorf("expected '[\"a:hook\"]', got '%s'", hooks)
+			}
+			return nil
+		}),
+		Do("SET", "a:fleet", "truck5", "POINT", 10, 10).
+			Err("not the leader"),
+		Do("SERVER").JSON().Func(func(s string) error {
+			if !gjson.Get(s, "stats.caught_up").Bool() {
+				return errors.New("expected caught up")
+			}
+			ups := gjson.Get(s, "stats.upstreams").Array()
+			if len(ups) != 2 {
+				return fmt.Errorf("expected 2 upstreams, got '%s'", s)
+			}
+			for i, up := range ups {
+				port := mc.port
+				prefix := "a:"
+				if i == 1 {
+					port, prefix = mc3.port, "b:"
+				}
+				if up.Get("leader").String() != fmt.Sprintf("localhost:%d", port) ||
+					up.Get("prefix").String() != prefix ||
+					!up.Get("caught_up").Bool() {
+					return fmt.Errorf("unexpected upstream '%s'", up.Raw)
+				}
+			}
+			return nil
+		}),
+		Do("FOLLOW", "no", "one").OK(),
+		Do("SERVER").JSON().Func(func(s string) error {
+			if gjson.Get(s, "stats.upstreams").Exists() {
+				return errors.New("expected no upstreams")
+			}
+			return nil
+		}),
+
+		// a promote stops following all of the leaders
+		Do("FOLLOW", "localhost", mc.port, "PREFIX", "a:", "localhost",
+			mc3.port, "PREFIX", "b:").OK(),
+		Sleep(time.Second/2),
+		Do("PROMOTE").JSON().Func(func(s string) error {
+			if !gjson.Get(s, "ok").Bool() {
+				return errors.New("not ok")
+			}
+			return nil
+		}),
+		Do("SERVER").JSON().Func(func(s string) error {
+			if gjson.Get(s, "stats.upstreams").Exists() {
+				return errors.New("expected no upstreams")
+			}
+			return nil
+		}),
+		Do("SET", "a:fleet", "truck5", "POINT", 10, 10).OK(),
 	)
 	if err != nil {
 		return err
 	}
+	config, err := os.ReadFile(filepath.Join(mc2.dir, "config"))
+	if err != nil {
+		return err
+	}
+	if gjson.GetBytes(config, "follow_upstreams").Exists() ||
+		gjson.GetBytes(config, "follow_host").String() != "" {
+		return fmt.Errorf("expected no leaders, got '%s'", config)
+	}
+	return nil
+}
 
+func follower_compress_test(mc *mockServer) error {
+	for i := 0; i < 1000; i++ {
+		_, err := mc.Do("SET", "fleet", fmt.Sprintf("truck%d", i), "POINT", 33, -115)
+		if err != nil {
+			return err
+		}
+	}
+	err := mc.DoBatch(
+		Do("REPLCONF", "compress", "lz4").Err("unsupported compression"),
+	)
+	if err != nil {
+		return err
+	}
+	for i, codec := range []string{"gzip", "snappy"} {
+		mc2, err := mockOpenServer(MockServerOptions{
+			Silent: true, Metrics: false,
+		})
+		if err != nil {
+			return err
+		}
+		defer mc2.Close()
+		err = mc2.DoBatch(
+			Do("CONFIG", "GET", "leader-compress").Str("[leader-compress none]"),
+			Do("CONFIG", "SET", "leader-compress", "lz4").
+				Err("Invalid argument 'lz4' for CONFIG SET 'leader-compress'"),
+			Do("CONFIG", "SET", "leader-compress", codec).OK(),
+			Do("CONFIG", "GET", "leader-compress").Str("[leader-compress "+codec+"]"),
+			Do("FOLLOW", "localhost", mc.port).OK(),
+			Sleep(time.Second/2),
+			Do("SCAN", "fleet", "COUNT").Str(fmt.Sprint(1000+i)),
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", codec, err)
+		}
+		// the stream is flushed as the leader writes to it
+		err = mc.DoBatch(
+			Do("SET", "fleet", codec, "POINT", 34, -116).OK(),
+		)
+		if err != nil {
+			return err
+		}
+		err = mc2.DoBatch(
+			Sleep(time.Second/4),
+			Do("GET", "fleet", codec).Str(`{"type":"Point","coordinates":[-116,34]}`),
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", codec, err)
+		}
+	}
 	return nil
 }
+
+// partitionProxy proxies to a server. The partition func makes the open
+// connections drop all data, without closing them, like a network partition
+// would. New connections work as usual.
+func partitionProxy(mc *mockServer) (port int, partition func(), err error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, nil, err
+	}
+	var mu sync.Mutex
+	var dropping []*atomic.Bool
+	pipe := func(dst, src net.Conn, drop *atomic.Bool) {
+		defer dst.Close()
+		b := make([]byte, 4096)
+		for {
+			n, err := src.Read(b)
+			if err != nil {
+				return
+			}
+			if !drop.Load() {
+				if _, err := dst.Write(b[:n]); err != nil {
+					return
+				}
+			}
+		}
+	}
+	go func() {
+		defer ln.Close()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			sconn, err := net.Dial("tcp", fmt.Sprintf(":%d", mc.port))
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			drop := new(atomic.Bool)
+			mu.Lock()
+			dropping = append(dropping, drop)
+			mu.Unlock()
+			go pipe(sconn, conn, drop)
+			go pipe(conn, sconn, drop)
+		}
+	}()
+	partition = func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, drop := range dropping {
+			drop.Store(true)
+		}
+	}
+	return ln.Addr().(*net.TCPAddr).Port, partition, nil
+}
+
+func follower_upstreams_reconnect_test(mc *mockServer) error {
+	port, partition, err := partitionProxy(mc)
+	if err != nil {
+		return err
+	}
+	mc2, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	mc3, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc3.Close()
+	err = mc.DoBatch(
+		Do("SET", "c:fleet", "truck1", "POINT", 10, 10).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc2.DoBatch(
+		Do("CONFIG", "SET", "leader-timeout", 2).OK(),
+		Do("FOLLOW", "localhost", port, "PREFIX", "c:", "localhost",
+			mc3.port, "PREFIX", "d:").OK(),
+		Sleep(time.Second/2),
+		Do("GET", "c:fleet", "truck1").Str(`{"type":"Point","coordinates":[10,10]}`),
+	)
+	if err != nil {
+		return err
+	}
+	partition()
+	err = mc.DoBatch(
+		Do("SET", "c:fleet", "truck2", "POINT", 20, 20).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	// the follower continues from where it stopped, which keeps the keys of
+	// the leader while it reconnects and its aof from growing
+	err = mc2.DoBatch(
+		Sleep(time.Second*4),
+		Do("GET", "c:fleet", "truck1").Str(`{"type":"Point","coordinates":[10,10]}`),
+		Do("GET", "c:fleet", "truck2").Str(`{"type":"Point","coordinates":[20,20]}`),
+	)
+	if err != nil {
+		return err
+	}
+	aof, err := mc2.readAOF()
+	if err != nil {
+		return err
+	}
+	if n := bytes.Count(aof, []byte("truck1")); n != 1 {
+		return fmt.Errorf("expected truck1 once in the aof, got %d", n)
+	}
+	return nil
+}
+
+func follower_leader_timeout_test(mc *mockServer) error {
+	port, partition, err := partitionProxy(mc)
+	if err != nil {
+		return err
+	}
+	mc2, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	err = mc.DoBatch(
+		Do("SET", "mykey", "truck1", "POINT", 10, 10).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc2.DoBatch(
+		Do("CONFIG", "GET", "leader-timeout").Str("[leader-timeout 30]"),
+		Do("CONFIG", "SET", "leader-timeout", "-1").
+			Err("Invalid argument '-1' for CONFIG SET 'leader-timeout'"),
+		Do("CONFIG", "SET", "leader-timeout", 2).OK(),
+		Do("FOLLOW", "localhost", port).OK(),
+		Sleep(time.Second/2),
+		Do("GET", "mykey", "truck1").Str(`{"type":"Point","coordinates":[10,10]}`),
+		// the heartbeats keep an idle follow going
+		Sleep(time.Second*3),
+		Do("SERVER").JSON().Func(func(s string) error {
+			if !gjson.Get(s, "stats.caught_up").Bool() {
+				return errors.New("expected caught up")
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	partition()
+	err = mc.DoBatch(
+		Do("SET", "mykey", "truck2", "POINT", 20, 20).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	// the follower gives up on the leader and reconnects
+	return mc2.DoBatch(
+		Sleep(time.Second/2),
+		Do("GET", "mykey", "truck2").Str("<nil>"),
+		Sleep(time.Second*4),
+		Do("GET", "mykey", "truck2").Str(`{"type":"Point","coordinates":[20,20]}`),
+	)
+}
+
+func follower_lag_test(mc *mockServer) error {
+	port, partition, err := partitionProxy(mc)
+	if err != nil {
+		return err
+	}
+	mc2, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	lag := func(want bool) func(s string) error {
+		return func(s string) error {
+			if !gjson.Get(s, "status.caught_up").Bool() {
+				return errors.New("expected caught up")
+			}
+			if lag := gjson.Get(s, "status.lag").Int(); (lag > 0) != want {
+				return fmt.Errorf("expected lag %t, got %d", want, lag)
+			}
+			return nil
+		}
+	}
+	err = mc.DoBatch(
+		Do("SET", "mykey", "truck1", "POINT", 10, 10).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc2.DoBatch(
+		Do("FOLLOW", "localhost", port).OK(),
+		Sleep(time.Second/2),
+		Do("NODESTATUS").JSON().Func(lag(false)),
+	)
+	if err != nil {
+		return err
+	}
+	// the aof stream stalls, but the leader keeps writing
+	partition()
+	err = mc.DoBatch(
+		Do("SET", "mykey", "truck2", "POINT", 20, 20).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	return mc2.DoBatch(
+		Sleep(time.Second*4),
+		Do("GET", "mykey", "truck2").Str("<nil>"),
+		Do("NODESTATUS").JSON().Func(lag(true)),
+		Do("SERVER").JSON().Func(func(s string) error {
+			if gjson.Get(s, "stats.repl_lag_bytes").Int() == 0 {
+				return errors.New("expected replication lag")
+			}
+			return nil
+		}),
+	)
+}
+
+func follower_read_only_test(mc *mockServer) error {
+	mc2, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	err = mc.DoBatch(
+		Do("SET", "mykey", "truck1", "POINT", 10, 10).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	notLeader := func(s string) error {
+		if !strings.Contains(s, "not the leader") {
+			return fmt.Errorf("expected 'not the leader', got '%s'", s)
+		}
+		return nil
+	}
+	err = mc2.DoBatch(
+		Do("FOLLOW", "localhost", mc.port).OK(),
+		Sleep(time.Second/2),
+		Do("CONFIG", "GET", "follower-read-only").Str("[follower-read-only yes]"),
+		Do("SET", "mykey", "truck2", "POINT", 20, 20).Err("not the leader"),
+		Do("EVAL", "return tile38.call('SET', 'mykey', 'truck2', 'POINT', 20, 20)", 0).Func(notLeader),
+		Do("CONFIG", "SET", "follower-read-only", "maybe").
+			Err("Invalid argument 'maybe' for CONFIG SET 'follower-read-only'"),
+		// a writable follower
+		Do("CONFIG", "SET", "follower-read-only", "no").OK(),
+		Do("SET", "mykey", "truck2", "POINT", 20, 20).OK(),
+		Do("GET", "mykey", "truck2").Str(`{"type":"Point","coordinates":[20,20]}`),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc.DoBatch(
+		Do("SET", "mykey", "truck3", "POINT", 30, 30).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	return mc2.DoBatch(
+		Sleep(time.Second/2),
+		Do("GET", "mykey", "truck3").Str(`{"type":"Point","coordinates":[30,30]}`),
+		Do("CONFIG", "SET", "follower-read-only", "yes").OK(),
+		Do("SET", "mykey", "truck4", "POINT", 40, 40).Err("not the leader"),
+		// a server that follows no one takes writes
+		Do("FOLLOW", "no", "one").OK(),
+		Do("SET", "mykey", "truck4", "POINT", 40, 40).OK(),
+	)
+}
+
+func follower_replicaof_test(mc *mockServer) error {
+	mc2, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	err = mc.DoBatch(
+		Do("SET", "mykey", "truck1", "POINT", 10, 10).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	updated := func(expect bool) func(s string) error {
+		return func(s string) error {
+			if gjson.Get(s, "updated").Bool() != expect {
+				return fmt.Errorf("expected updated %t, got '%s'", expect, s)
+			}
+			return nil
+		}
+	}
+	return mc2.DoBatch(
+		Do("FOLLOW", "no", "one").Str("OK Already following no one"),
+		Do("FOLLOW", "no", "one").JSON().Func(updated(false)),
+		Do("REPLICAOF", "localhost", mc.port).OK(),
+		Sleep(time.Second/2),
+		Do("GET", "mykey", "truck1").Str(`{"type":"Point","coordinates":[10,10]}`),
+		Do("REPLICAOF", "no", "one").OK(),
+		Do("SLAVEOF", "no", "one").Str("OK Already following no one"),
+		Do("SLAVEOF", "localhost", mc.port).OK(),
+		Do("SLAVEOF", "no", "one").JSON().Func(updated(true)),
+		Do("REPLICAOF", "localhost").Err("wrong number of arguments for 'replicaof' command"),
+	)
+}
+
+func follower_resync_test(mc *mockServer) error {
+	mc2, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	err = mc.DoBatch(
+		Do("SET", "mykey", "truck1", "POINT", 10, 10).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc2.DoBatch(
+		Do("RESYNC", "CONFIRM").Err("not a follower"),
+		Do("FOLLOW", "localhost", mc.port).OK(),
+		Sleep(time.Second/2),
+		Do("RESYNC").Err("resync discards the local dataset, use CONFIRM to proceed"),
+		Do("RESYNC", "NOW").Err("invalid argument 'NOW'"),
+		// diverge the follower from the leader
+		Do("CONFIG", "SET", "follower-read-only", "no").OK(),
+		Do("SET", "mykey", "truck9", "POINT", 90, 90).OK(),
+		Do("SET", "otherkey", "truck9", "POINT", 90, 90).OK(),
+		Do("RESYNC", "CONFIRM").OK(),
+		Sleep(time.Second/2),
+		Do("GET", "mykey", "truck1").Str(`{"type":"Point","coordinates":[10,10]}`),
+		Do("GET", "mykey", "truck9").Str("<nil>"),
+		Do("GET", "otherkey", "truck9").Str("<nil>"),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc.DoBatch(
+		Do("SET", "mykey", "truck2", "POINT", 20, 20).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	return mc2.DoBatch(
+		Sleep(time.Second/2),
+		Do("GET", "mykey", "truck2").Str(`{"type":"Point","coordinates":[20,20]}`),
+	)
+}
+
+func follower_apply_buffer_test(mc *mockServer) error {
+	mc2, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	for i := 0; i < 1000; i++ {
+		_, err := mc.Do("SET", "mykey", fmt.Sprintf("truck%d", i),
+			"FIELD", "speed", i, "POINT", 10, 10)
+		if err != nil {
+			return err
+		}
+	}
+	applyBuffer := func(s string) error {
+		if gjson.Get(s, "stats.apply_buffer_limit").Int() != 1024 {
+			return fmt.Errorf("expected an apply_buffer_limit of 1024, got '%s'", s)
+		}
+		if !gjson.Get(s, "stats.apply_buffer_bytes").Exists() {
+			return fmt.Errorf("expected apply_buffer_bytes, got '%s'", s)
+		}
+		return nil
+	}
+	return mc2.DoBatch(
+		Do("CONFIG", "GET", "follower-apply-buffer").Str("[follower-apply-buffer 32mb]"),
+		Do("CONFIG", "SET", "follower-apply-buffer", 0).
+			Err("Invalid argument '0' for CONFIG SET 'follower-apply-buffer'"),
+		Do("CONFIG", "SET", "follower-apply-buffer", "lots").
+			Err("Invalid argument 'lots' for CONFIG SET 'follower-apply-buffer'"),
+		Do("CONFIG", "SET", "follower-apply-buffer", "1kb").OK(),
+		Do("CONFIG", "GET", "follower-apply-buffer").Str("[follower-apply-buffer 1kb]"),
+		Do("FOLLOW", "localhost", mc.port).OK(),
+		Sleep(time.Second),
+		Do("SCAN", "mykey", "COUNT").Str("1000"),
+		Do("GET", "mykey", "truck999", "WITHFIELDS").Str(`[{"type":"Point","coordinates":[10,10]} [speed 999]]`),
+		Do("SERVER").JSON().Func(applyBuffer),
+	)
+}
+
+func follower_replication_tokens_test(mc *mockServer) error {
+	mc2, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	mc3, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc3.Close()
+	err = mc.DoBatch(
+		Do("CONFIG", "SET", "replication-tokens", "f1:tok1,f1:tok2").Err("Invalid argument 'f1:tok1,f1:tok2' for CONFIG SET 'replication-tokens'"),
+		Do("CONFIG", "SET", "replication-tokens", "f1").Err("Invalid argument 'f1' for CONFIG SET 'replication-tokens'"),
+		Do("CONFIG", "SET", "replication-tokens", "f2:tok2, f1:tok1").OK(),
+		Do("CONFIG", "GET", "replication-tokens").Str("[replication-tokens f1:tok1,f2:tok2]"),
+		Do("CONFIG", "SET", "requirepass", "1234").OK(),
+		Do("AUTH", "1234").OK(),
+		Do("SET", "mykey", "truck1", "POINT", 10, 10).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc2.DoBatch(
+		Do("CONFIG", "SET", "leaderauth", "tok1").OK(),
+		Do("FOLLOW", "localhost", mc.port).OK(),
+		Sleep(time.Second/2),
+		Do("GET", "mykey", "truck1").Str(`{"type":"Point","coordinates":[10,10]}`),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc3.DoBatch(
+		Do("CONFIG", "SET", "leaderauth", "tok2").OK(),
+		Do("FOLLOW", "localhost", mc.port).OK(),
+		Sleep(time.Second/2),
+		Do("GET", "mykey", "truck1").Str(`{"type":"Point","coordinates":[10,10]}`),
+	)
+	if err != nil {
+		return err
+	}
+
+	// revoke the token of the first follower
+	err = mc.DoBatch(
+		Do("CONFIG", "SET", "replication-tokens", "f2:tok2").OK(),
+		Do("SET", "mykey", "truck2", "POINT", 10, 10).OK(),
+		Sleep(time.Second/2),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc3.DoBatch(
+		Do("GET", "mykey", "truck2").Str(`{"type":"Point","coordinates":[10,10]}`),
+	)
+	if err != nil {
+		return err
+	}
+	return mc2.DoBatch(
+		Do("GET", "mykey", "truck2").Str("<nil>"),
+		Do("FOLLOW", "no", "one").OK(),
+		Do("FOLLOW", "localhost", mc.port).Err("cannot follow: auth no ok"),
+	)
+}
+
+// switchProxy forwards connections to a server, until it's switched to
+// another server. Switching closes the open connections, like a leader that
+// restarts would.
+func switchProxy(port int) (proxyPort int, switchTo func(port int), err error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, nil, err
+	}
+	var mu sync.Mutex
+	var conns []net.Conn
+	pipe := func(dst, src net.Conn) {
+		defer dst.Close()
+		io.Copy(dst, src)
+	}
+	go func() {
+		defer ln.Close()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			target := port
+			mu.Unlock()
+			sconn, err := net.Dial("tcp", fmt.Sprintf(":%d", target))
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			mu.Lock()
+			conns = append(conns, conn, sconn)
+			mu.Unlock()
+			go pipe(sconn, conn)
+			go pipe(conn, sconn)
+		}
+	}()
+	switchTo = func(target int) {
+		mu.Lock()
+		defer mu.Unlock()
+		port = target
+		for _, conn := range conns {
+			conn.Close()
+		}
+		conns = nil
+	}
+	return ln.Addr().(*net.TCPAddr).Port, switchTo, nil
+}
+
+func follower_leader_id_change_test(mc *mockServer) error {
+	mc2, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	mc3, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc3.Close()
+	port, switchTo, err := switchProxy(mc.port)
+	if err != nil {
+		return err
+	}
+	err = mc.DoBatch(
+		Do("SET", "mykey", "truck1", "POINT", 10, 10).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc3.DoBatch(
+		Do("SET", "mykey", "truck2", "POINT", 20, 20).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc2.DoBatch(
+		Do("CONFIG", "GET", "leader-id-change").Str("[leader-id-change abort]"),
+		Do("CONFIG", "SET", "leader-id-change", "ignore").
+			Err("Invalid argument 'ignore' for CONFIG SET 'leader-id-change'"),
+		Do("CONFIG", "SET", "leader-id-change", "resync").OK(),
+		Do("FOLLOW", "localhost", port).OK(),
+		Sleep(time.Second/2),
+		Do("GET", "mykey", "truck1").Str(`{"type":"Point","coordinates":[10,10]}`),
+	)
+	if err != nil {
+		return err
+	}
+
+	// the new leader is read from the start
+	switchTo(mc3.port)
+	err = mc2.DoBatch(
+		Sleep(time.Second*2),
+		Do("GET", "mykey", "truck1").Str("<nil>"),
+		Do("GET", "mykey", "truck2").Str(`{"type":"Point","coordinates":[20,20]}`),
+		Do("CONFIG", "SET", "leader-id-change", "abort").OK(),
+	)
+	if err != nil {
+		return err
+	}
+
+	// the follower stops following, until it's resynced
+	switchTo(mc.port)
+	return mc2.DoBatch(
+		Sleep(time.Second*2),
+		Do("GET", "mykey", "truck1").Str("<nil>"),
+		Do("GET", "mykey", "truck2").Str(`{"type":"Point","coordinates":[20,20]}`),
+		Do("RESYNC", "CONFIRM").OK(),
+		Sleep(time.Second),
+		Do("GET", "mykey", "truck1").Str(`{"type":"Point","coordinates":[10,10]}`),
+		Do("GET", "mykey", "truck2").Str("<nil>"),
+	)
+}
+
+func follower_healthz_test(mc *mockServer) error {
+	mc1, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc1.Close()
+	mc2, err := mockOpenServer(MockServerOptions{
+		Silent: true, Metrics: false,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	err = mc1.DoBatch(
+		Do("SET", "mykey", "truck1", "POINT", 10, 10).OK(),
+		Do("HEALTHZ").OK(),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc2.DoBatch(
+		Do("FOLLOW", "localhost", mc1.port).OK(),
+		Sleep(time.Second/2),
+		Do("GET", "mykey", "truck1").Str(`{"type":"Point","coordinates":[10,10]}`),
+		Do("HEALTHZ").OK(),
+		Do("HEALTHZ").JSON().OK(),
+	)
+	if err != nil {
+		return err
+	}
+	// the follower syncs again after losing its leader
+	mc1.Close()
+	err = mc2.DoBatch(
+		Sleep(time.Second/2),
+		Do("HEALTHZ").Err("syncing"),
+		Do("HEALTHZ").JSON().Err("syncing"),
+	)
+	if err != nil {
+		return err
+	}
+	status, body, err := downloadURLWithStatusCode(
+		fmt.Sprintf("http://127.0.0.1:%d/healthz", mc2.port))
+	if err != nil {
+		return err
+	}
+	if status != 500 || !strings.Contains(body, `"err":"syncing"`) {
+		return fmt.Errorf("expected a syncing status, got %d %s", status, body)
+	}
+	return mc2.DoBatch(
+		Do("FOLLOW", "no", "one").OK(),
+		Do("HEALTHZ").OK(),
+	)
+}
@@ -1,11 +1,16 @@
 package tests
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
+	"net/http"
 	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -25,14 +30,42 @@ func subTestSearch(g *testGroup) {
 	g.regSubTest("WITHIN", keys_WITHIN_test)
 	g.regSubTest("WITHIN_CURSOR", keys_WITHIN_CURSOR_test)
 	g.regSubTest("WITHIN_CLIPBY", keys_WITHIN_CLIPBY_test)
+	g.regSubTest("WITHIN_WITHSCORE", keys_WITHIN_WITHSCORE_test)
+	g.regSubTest("WITHIN_WITHZONE", keys_WITHIN_WITHZONE_test)
+	g.regSubTest("WITHIN_COMPONENTS", keys_WITHIN_COMPONENTS_test)
+	g.regSubTest("WITHIN_DELTA", keys_WITHIN_DELTA_test)
+	g.regSubTest("WITHIN_GEOHASH", keys_WITHIN_GEOHASH_test)
+	g.regSubTest("WITHIN_ANTIMERIDIAN", keys_WITHIN_ANTIMERIDIAN_test)
+	g.regSubTest("DENSITY", keys_DENSITY_test)
 	g.regSubTest("INTERSECTS", keys_INTERSECTS_test)
 	g.regSubTest("INTERSECTS_CURSOR", keys_INTERSECTS_CURSOR_test)
 	g.regSubTest("INTERSECTS_CLIPBY", keys_INTERSECTS_CLIPBY_test)
+	g.regSubTest("INTERSECTION", keys_INTERSECTION_test)
+	g.regSubTest("LENGTHWITHIN", keys_LENGTHWITHIN_test)
+	g.regSubTest("BUFFER_COMMAND", keys_BUFFER_test)
 	g.regSubTest("SCAN_CURSOR", keys_SCAN_CURSOR_test)
 	g.regSubTest("SEARCH_CURSOR", keys_SEARCH_CURSOR_test)
 	g.regSubTest("MATCH", keys_MATCH_test)
+	g.regSubTest("MATCH_RE", keys_MATCH_RE_test)
+	g.regSubTest("TTLBETWEEN", keys_TTLBETWEEN_test)
+	g.regSubTest("ETAG", keys_ETAG_test)
 	g.regSubTest("FIELDS", keys_FIELDS_search_test)
 	g.regSubTest("BUFFER", keys_BUFFER_search_test)
+	g.regSubTest("BUFFER_ERODE", keys_BUFFER_ERODE_search_test)
+	g.regSubTest("HASHES", keys_HASHES_search_test)
+	g.regSubTest("FEATURES", keys_FEATURES_search_test)
+	g.regSubTest("MVT", keys_MVT_search_test)
+	g.regSubTest("CSV", keys_CSV_search_test)
+	g.regSubTest("WKT", keys_WKT_search_test)
+	g.regSubTest("SIMPLIFY", keys_SIMPLIFY_search_test)
+	g.regSubTest("NEARBY_METRIC", keys_NEARBY_METRIC_test)
+	g.regSubTest("NEARBY_HEADING", keys_NEARBY_HEADING_test)
+	g.regSubTest("NEARBY_MAXDIST", keys_NEARBY_MAXDIST_test)
+	g.regSubTest("NEARBY_ALONG", keys_NEARBY_ALONG_test)
+	g.regSubTest("STRICT", keys_STRICT_search_test)
+	g.regSubTest("ASOF", keys_ASOF_search_test)
+	g.regSubTest("NDISTINCT", keys_NDISTINCT_search_test)
+	g.regSubTest("JOIN", keys_JOIN_search_test)
 }
 
 func keys_KNN_basic_test(mc *mockServer) error {
@@ -299,6 +332,182 @@ func keys_WITHIN_CLIPBY_test(mc *mockServer) error {
 	})
 }
 
+func keys_WITHIN_WITHSCORE_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "center", "POINT", 34, -115).OK(),
+		Do("SET", "mykey", "inner", "POINT", 33.5, -115).OK(),
+		Do("SET", "mykey", "edge", "POINT", 33, -115).OK(),
+		Do("WITHIN", "mykey", "WITHSCORE", "IDS", "BOUNDS", 33, -116, 35, -114).Str("[0 [[edge 0] [inner 0.6031185498030072] [center 1]]]"),
+		Do("WITHIN", "mykey", "WITHSCORE", "POINTS", "BOUNDS", 33, -116, 35, -114).JSON().Str(`{"ok":true,"points":[`+
+			`{"id":"edge","point":{"lat":33,"lon":-115},"score":0},`+
+			`{"id":"inner","point":{"lat":33.5,"lon":-115},"score":0.6031185498030072},`+
+			`{"id":"center","point":{"lat":34,"lon":-115},"score":1}`+
+			`],"count":3,"cursor":0}`),
+		Do("WITHIN", "mykey", "WITHSCORE", "IDS", "CIRCLE", 34, -115, 200000).Str("[0 [[edge 0.44402536677720555] [inner 0.7220126833886027] [center 1]]]"),
+		Do("INTERSECTS", "mykey", "WITHSCORE", "IDS", "BOUNDS", 33, -116, 35, -114).Err("WITHSCORE is not allowed for INTERSECTS"),
+		Do("WITHIN", "mykey", "WITHSCORE", "FENCE", "BOUNDS", 33, -116, 35, -114).Err("WITHSCORE is not allowed when FENCE is specified"),
+	)
+}
+
+func keys_WITHIN_WITHZONE_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "inside", "POINT", 34, -115).OK(),
+		Do("SET", "mykey", "nearby", "POINT", 34.6, -115).OK(),
+		Do("SET", "mykey", "faraway", "POINT", 36, -115).OK(),
+		Do("WITHIN", "mykey", "BUFFER", 20000, "WITHZONE", "IDS", "CIRCLE", 34, -115, 50000).Str("[0 [[nearby buffer] [inside core]]]"),
+		Do("WITHIN", "mykey", "BUFFER", 20000, "WITHZONE", "IDS", "CIRCLE", 34, -115, 50000).JSON().Str(`{"ok":true,"ids":[{"id":"nearby","zone":"buffer"},{"id":"inside","zone":"core"}],"count":2,"cursor":0}`),
+		Do("WITHIN", "mykey", "BUFFER", 20000, "WITHZONE", "POINTS", "CIRCLE", 34, -115, 50000).JSON().Str(`{"ok":true,"points":[{"id":"nearby","point":{"lat":34.6,"lon":-115},"zone":"buffer"},{"id":"inside","point":{"lat":34,"lon":-115},"zone":"core"}],"count":2,"cursor":0}`),
+		Do("WITHIN", "mykey", "BUFFER", 20000, "WITHZONE", "COUNT", "CIRCLE", 34, -115, 50000).Str("2"),
+		Do("WITHIN", "mykey", "WITHZONE", "IDS", "CIRCLE", 34, -115, 50000).Err("WITHZONE requires BUFFER"),
+		Do("INTERSECTS", "mykey", "BUFFER", 20000, "WITHZONE", "IDS", "CIRCLE", 34, -115, 50000).Err("WITHZONE is not allowed for INTERSECTS"),
+		Do("WITHIN", "mykey", "FENCE", "BUFFER", 20000, "WITHZONE", "CIRCLE", 34, -115, 50000).Err("WITHZONE is not allowed when FENCE is specified"),
+		Do("WITHIN", "mykey", "BUFFER", 20000, "WITHZONE", "WITHZONE", "IDS", "CIRCLE", 34, -115, 50000).Err("duplicate argument 'WITHZONE'"),
+	)
+}
+
+func keys_WITHIN_COMPONENTS_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "a1", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "a2", "POINT", 33, -115.001).OK(),
+		Do("SET", "mykey", "a3", "POINT", 33, -115.002).OK(),
+		Do("SET", "mykey", "b1", "POINT", 33.5, -115).OK(),
+		Do("SET", "mykey", "b2", "POINT", 33.5, -115.001, "FIELD", "speed", 10).OK(),
+		Do("SET", "mykey", "c1", "POINT", 36, -115).OK(),
+		Do("WITHIN", "mykey", "COMPONENTS", 150, "BOUNDS", 32, -116, 35, -114).Str(
+			"[[[a1 a2 a3] [[33 -115.002] [33 -115]]] [[b1 b2] [[33.5 -115.001] [33.5 -115]]]]"),
+		Do("WITHIN", "mykey", "COMPONENTS", 50, "BOUNDS", 32, -116, 34, -114).Str(
+			"[[[a1] [[33 -115] [33 -115]]] [[a2] [[33 -115.001] [33 -115.001]]] [[a3] [[33 -115.002] [33 -115.002]]] [[b1] [[33.5 -115] [33.5 -115]]] [[b2] [[33.5 -115.001] [33.5 -115.001]]]]"),
+		Do("WITHIN", "mykey", "COMPONENTS", 150, "WHERE", "speed", 0, 5, "BOUNDS", 32, -116, 35, -114).JSON().Str(`{"ok":true,"components":[`+
+			`{"ids":["a1","a2","a3"],"bounds":{"sw":{"lat":33,"lon":-115.002},"ne":{"lat":33,"lon":-115}}},`+
+			`{"ids":["b1"],"bounds":{"sw":{"lat":33.5,"lon":-115},"ne":{"lat":33.5,"lon":-115}}}`+
+			`],"count":2}`),
+		Do("WITHIN", "mykey", "COMPONENTS", 150, "BOUNDS", 40, -116, 41, -114).JSON().Str(`{"ok":true,"components":[],"count":0}`),
+		Do("WITHIN", "nokey", "COMPONENTS", 150, "BOUNDS", 40, -116, 41, -114).Str("[]"),
+		Do("WITHIN", "mykey", "COMPONENTS", -1, "BOUNDS", 32, -116, 35, -114).Err("invalid argument '-1'"),
+		Do("WITHIN", "mykey", "COMPONENTS", 150, "LIMIT", 5, "BOUNDS", 32, -116, 35, -114).Err("COMPONENTS does not allow SPARSE, CURSOR, LIMIT, WITHSCORE, or WITHZONE"),
+		Do("INTERSECTS", "mykey", "COMPONENTS", 150, "BOUNDS", 32, -116, 35, -114).Err("COMPONENTS is not allowed for INTERSECTS"),
+		Do("WITHIN", "mykey", "FENCE", "COMPONENTS", 150, "BOUNDS", 32, -116, 35, -114).Err("COMPONENTS is not allowed when FENCE is specified"),
+	)
+}
+
+func keys_WITHIN_GEOHASH_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "a", "POINT", 37.77, -122.41).OK(),
+		Do("SET", "mykey", "b", "POINT", 37.77, -122.36).OK(),
+		Do("SET", "mykey", "c", "POINT", 37.77, -122.30).OK(),
+		Do("SET", "line", "d", "OBJECT", `{"type":"LineString","coordinates":[[-122.41,37.78],[-122.36,37.78]]}`).OK(),
+		Do("WITHIN", "mykey", "IDS", "GEOHASH", "9q8yy").Str("[0 [a]]"),
+		Do("WITHIN", "mykey", "IDS", "GEOHASH", "9q8yy", "9q8yz").Str("[0 [a b]]"),
+		Do("INTERSECTS", "mykey", "IDS", "GEOHASH", "9q8yy", "9q8yz").Str("[0 [a b]]"),
+		Do("INTERSECTS", "mykey", "IDS", "GEOHASH", "9q8yy", "9q8yz", "CLIPBY", "BOUNDS", 37.7, -122.4, 37.8, -122.3).Str("[0 [b]]"),
+		Do("WITHIN", "line", "IDS", "GEOHASH", "9q8yy", "9q8yz").Str("[0 []]"),
+		Do("INTERSECTS", "line", "IDS", "GEOHASH", "9q8yz").Str("[0 [d]]"),
+		Do("WITHIN", "mykey", "IDS", "GEOHASH").Err("wrong number of arguments for 'within' command"),
+		Do("WITHIN", "mykey", "IDS", "GEOHASH", "9q8ya").Err("invalid argument '9q8ya'"),
+	)
+}
+
+func keys_WITHIN_ANTIMERIDIAN_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "fiji", "POINT", -17.7, 178.1).OK(),
+		Do("SET", "mykey", "samoa", "POINT", -13.8, -171.8).OK(),
+		Do("SET", "mykey", "hawaii", "POINT", 21.3, -157.9).OK(),
+		Do("SET", "mykey", "quito", "POINT", -0.2, -78.5).OK(),
+		Do("SET", "mykey", "dateline", "OBJECT", `{"type":"LineString","coordinates":[[179,-10],[-179,-10]]}`).OK(),
+		Do("WITHIN", "mykey", "IDS", "BOUNDS", -20, 170, 0, -170).Str("[0 [fiji samoa]]"),
+		Do("INTERSECTS", "mykey", "IDS", "BOUNDS", -20, 170, 0, -170).Str("[0 [dateline fiji samoa]]"),
+		Do("INTERSECTS", "mykey", "COUNT", "BOUNDS", -20, 170, 30, -150).Str("4"),
+		Do("WITHIN", "mykey", "IDS", "BOUNDS", -20, -170, 0, 170).Str("[0 [quito]]"),
+	)
+}
+
+func keys_DENSITY_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "a", "FIELD", "speed", 10, "POINT", 0.5, 0.5).OK(),
+		Do("SET", "mykey", "b", "FIELD", "speed", 20, "POINT", 0.6, 0.4).OK(),
+		Do("SET", "mykey", "c", "FIELD", "speed", 30, "POINT", 1.5, 2.5).OK(),
+		Do("SET", "mykey", "d", "POINT", 5, 5).OK(),
+		Do("SET", "mykey", "e", "BOUNDS", 1, 0, 2, 1).OK(),
+		Do("DENSITY", "mykey", "BOUNDS", 0, 0, 2, 3, "GRID", 3, 2).Str("[[1 0 1] [2 0 0]]"),
+		Do("DENSITY", "mykey", "BOUNDS", 0, 0, 2, 3, "GRID", 3, 2).JSON().Str(`{"ok":true,"cols":3,"rows":2,"cells":[[1,0,1],[2,0,0]]}`),
+		Do("DENSITY", "mykey", "BOUNDS", 0, 0, 2, 3, "GRID", 3, 2, "WHERE", "speed", 15, "+inf").Str("[[0 0 1] [1 0 0]]"),
+		Do("DENSITY", "mykey", "BOUNDS", 0, 0, 2, 3, "GRID", 1, 1, "MATCH", "a*").Str("[[1]]"),
+		Do("DENSITY", "nokey", "BOUNDS", 0, 0, 2, 3, "GRID", 2, 1).Str("[[0 0]]"),
+		Do("DENSITY", "mykey", "BOUNDS", 0, 0, 2, 3, "GRID", 0, 1).Err("invalid argument '0'"),
+		Do("DENSITY", "mykey", "BOUNDS", 0, 0, 2, 3, "GRID", 2, 2, "IDS").Err("an output type is not allowed for DENSITY"),
+		Do("DENSITY", "mykey", "BOUNDS", 0, 0, 2, 3, "GRID", 2, 2, "WHERE", "speed", 0, 1, "NEARBY").Err("invalid argument 'NEARBY'"),
+		Do("DENSITY", "mykey", "POINT", 0, 0, "GRID", 2, 2).Err("invalid argument 'POINT'"),
+		Do("DENSITY", "mykey", "BOUNDS", 0, 0, 2, 3, "GRID", 2).Err("wrong number of arguments for 'density' command"),
+	)
+}
+
+func keys_WITHIN_DELTA_test(mc *mockServer) error {
+	var token string
+	delta := func(expect string) func(s string) error {
+		return func(s string) error {
+			token = gjson.Get(s, "token").String()
+			if token == "" {
+				return errors.New("missing token")
+			}
+			got := gjson.Get(s, "entered").Raw + " " + gjson.Get(s, "exited").Raw
+			if got != expect {
+				return fmt.Errorf("expected '%s', got '%s'", expect, got)
+			}
+			return nil
+		}
+	}
+	within := func(token string) []interface{} {
+		return []interface{}{"WITHIN", "mykey", "DELTA", token, "BOUNDS", 33, -116, 34, -114}
+	}
+	if err := mc.DoBatch(
+		Do("SET", "mykey", "a", "POINT", 33.5, -115).OK(),
+		Do("SET", "mykey", "b", "POINT", 33.5, -115.5).OK(),
+		Do("SET", "mykey", "c", "POINT", 35, -115).OK(),
+		Do(within("0")...).JSON().Func(delta(`["a","b"] []`)),
+	); err != nil {
+		return err
+	}
+	if err := mc.DoBatch(
+		Do("SET", "mykey", "b", "POINT", 35, -115.5).OK(),
+		Do("SET", "mykey", "c", "POINT", 33.5, -115).OK(),
+		Do(within(token)...).JSON().Func(delta(`["c"] ["b"]`)),
+	); err != nil {
+		return err
+	}
+	prev := token
+	if err := mc.DoBatch(
+		Do(within(token)...).JSON().Func(delta(`[] []`)),
+		Do("WITHIN", "mykey", "DELTA", prev, "BOUNDS", 33, -116, 34, -114).Err("invalid or expired delta token"),
+	); err != nil {
+		return err
+	}
+	// the oldest tokens are evicted when there are too many
+	oldest := token
+	for i := 0; i < 1024; i++ {
+		args := within("0")
+		if _, err := mc.Do(args[0].(string), args[1:]...); err != nil {
+			return err
+		}
+	}
+	if err := mc.DoBatch(
+		Do(within(oldest)...).Err("invalid or expired delta token"),
+		Do(within("0")...).JSON().Func(delta(`["a","c"] []`)),
+	); err != nil {
+		return err
+	}
+	return mc.DoBatch(
+		Do("WITHIN", "mykey", "DELTA", token, "BOUNDS", 33, -116, 35, -114).Err("delta token does not match the query"),
+		Do("WITHIN", "mykey", "DELTA", "0", "LIMIT", 5, "BOUNDS", 33, -116, 34, -114).Err("DELTA does not allow SPARSE, CURSOR, LIMIT, WITHSCORE, WITHZONE, or COMPONENTS"),
+		Do("NEARBY", "mykey", "DELTA", "0", "POINT", 33, -115).Err("DELTA is not allowed for NEARBY"),
+		Do("INTERSECTS", "mykey", "DELTA", "0", "BOUNDS", 33, -116, 34, -114).Func(func(s string) error {
+			if !strings.HasSuffix(s, " [a c] []]") {
+				return fmt.Errorf("unexpected '%s'", s)
+			}
+			return nil
+		}),
+	)
+}
+
 func keys_INTERSECTS_test(mc *mockServer) error {
 	return mc.DoBatch([][]interface{}{
 		{"SET", "mykey", "point1", "POINT", 37.7335, -122.4412}, {"OK"},
@@ -401,6 +610,103 @@ func keys_INTERSECTS_CLIPBY_test(mc *mockServer) error {
 	})
 }
 
+func keys_INTERSECTION_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "area", "OBJECT", `{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10],[0,0]],[[4,4],[6,4],[6,6],[4,6],[4,4]]]}`).OK(),
+		Do("SET", "mykey", "rect", "BOUNDS", -5, 5, 15, 15).OK(),
+		Do("SET", "mykey", "road", "OBJECT", `{"type":"LineString","coordinates":[[-5,5],[15,5]]}`).OK(),
+		Do("SET", "other", "far", "POINT", 50, 50).OK(),
+		Do("SET", "other", "ring", "OBJECT", `{"type":"GeometryCollection","geometries":[]}`).OK(),
+		Do("INTERSECTION", "mykey", "area", "mykey").Err("wrong number of arguments for 'intersection' command"),
+		Do("INTERSECTION", "mykey", "area", "nokey", "rect").Err("key not found"),
+		Do("INTERSECTION", "mykey", "area", "mykey", "noid").Err("id not found"),
+		Do("INTERSECTION", "mykey", "area", "other", "ring").Err("unsupported geometry type"),
+		Do("INTERSECTION", "mykey", "area", "mykey", "rect").Str(`{"type":"Polygon","coordinates":[[[5,0],[10,0],[10,10],[5,10],[5,6],[6,6],[6,4],[5,4],[5,0]]]}`),
+		Do("INTERSECTION", "mykey", "area", "mykey", "rect").JSON().Str(`{"ok":true,"object":{"type":"Polygon","coordinates":[[[5,0],[10,0],[10,10],[5,10],[5,6],[6,6],[6,4],[5,4],[5,0]]]}}`),
+		Do("INTERSECTION", "mykey", "road", "mykey", "area").Str(`{"type":"MultiLineString","coordinates":[[[0,5],[4,5]],[[6,5],[10,5]]]}`),
+		Do("INTERSECTION", "mykey", "area", "other", "far").Str(`<nil>`),
+		Do("INTERSECTION", "mykey", "area", "other", "far").JSON().Str(`{"ok":true,"object":null}`),
+	)
+}
+
+func keys_BUFFER_test(mc *mockServer) error {
+	points := func(expect int) func(s string) error {
+		return func(s string) error {
+			if typ := gjson.Get(s, "type").String(); typ != "Polygon" {
+				return fmt.Errorf("expected a Polygon, got '%s'", s)
+			}
+			n := len(gjson.Get(s, "coordinates.0").Array())
+			if n < expect {
+				return fmt.Errorf("expected at least %d points, got %d", expect, n)
+			}
+			return nil
+		}
+	}
+	return mc.DoBatch(
+		Do("SET", "fleet", "truck1", "POINT", 33, -115).OK(),
+		Do("SET", "fleet", "note", "STRING", "hello").OK(),
+		Do("BUFFER", "fleet", "truck1").Err("wrong number of arguments for 'buffer' command"),
+		Do("BUFFER", "nokey", "truck1", 100).Err("key not found"),
+		Do("BUFFER", "fleet", "noid", 100).Err("id not found"),
+		Do("BUFFER", "fleet", "truck1", "abc").Err("invalid argument 'abc'"),
+		Do("BUFFER", "fleet", "truck1", -1).Err("invalid argument '-1'"),
+		Do("BUFFER", "fleet", "truck1", 100, "STEPS").Err("invalid argument 'STEPS'"),
+		Do("BUFFER", "fleet", "truck1", 100, "STEPS", 2).Err("invalid argument '2'"),
+		Do("BUFFER", "fleet", "truck1", 100, "STEPS", 5000).Err("invalid argument '5000'"),
+		Do("BUFFER", "fleet", "note", 100).Err("cannot buffer  type"),
+		Do("BUFFER", "fleet", "truck1", 0).Str(`{"type":"Point","coordinates":[-115,33]}`),
+		Do("BUFFER", "fleet", "truck1", 100).Func(points(16)),
+		Do("BUFFER", "fleet", "truck1", 100, "STEPS", 64).Func(points(65)),
+		Do("BUFFER", "fleet", "truck1", 100).JSON().Func(func(s string) error {
+			return points(16)(gjson.Get(s, "object").Raw)
+		}),
+		Do("BUFFER", "POINT", 33, -115, 100, "STEPS", 8).Func(points(9)),
+		Do("BUFFER", "OBJECT", `{"type":"Point","coordinates":[-115,33]}`, 100).Func(points(16)),
+		Do("BUFFER", "OBJECT", `{"type":"LineString","coordinates":[[-115,33],[-115,33.01]]}`, 100).Func(func(s string) error {
+			if typ := gjson.Get(s, "type").String(); typ != "GeometryCollection" {
+				return fmt.Errorf("expected a GeometryCollection, got '%s'", s)
+			}
+			return nil
+		}),
+		// the search BUFFER option uses the same buffer
+		Do("SET", "zones", "circle", "POINT", 33, -115).OK(),
+		Do("SET", "fleet", "truck2", "POINT", 33.0005, -115).OK(),
+		Do("WITHIN", "fleet", "BUFFER", 100, "IDS", "GET", "zones", "circle").Str("[0 [truck2 truck1]]"),
+	)
+}
+
+func keys_LENGTHWITHIN_test(mc *mockServer) error {
+	near := func(expect float64) func(s string) error {
+		return func(s string) error {
+			meters, err := strconv.ParseFloat(s, 64)
+			if err != nil || math.Abs(meters-expect) > 1 {
+				return fmt.Errorf("expected about %v meters, got '%s'", expect, s)
+			}
+			return nil
+		}
+	}
+	return mc.DoBatch(
+		Do("SET", "zones", "area", "OBJECT", `{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,1],[0,0]],[[0.4,0.4],[0.6,0.4],[0.6,0.6],[0.4,0.6],[0.4,0.4]]]}`).OK(),
+		Do("SET", "zones", "spot", "POINT", 0.5, 0.5).OK(),
+		Do("SET", "tracks", "truck1", "OBJECT", `{"type":"LineString","coordinates":[[-0.5,0.5],[1.5,0.5]]}`).OK(),
+		Do("SET", "tracks", "truck2", "OBJECT", `{"type":"LineString","coordinates":[[0.2,0.2],[0.2,0.8],[5,5]]}`).OK(),
+		Do("SET", "tracks", "truck3", "OBJECT", `{"type":"LineString","coordinates":[[2,2],[3,3]]}`).OK(),
+		Do("LENGTHWITHIN", "tracks", "truck1", "zones").Err("wrong number of arguments for 'lengthwithin' command"),
+		Do("LENGTHWITHIN", "tracks", "truck1", "nokey", "area").Err("key not found"),
+		Do("LENGTHWITHIN", "tracks", "truck1", "zones", "noid").Err("id not found"),
+		Do("LENGTHWITHIN", "zones", "area", "zones", "area").Err("object is not a linestring"),
+		Do("LENGTHWITHIN", "tracks", "truck1", "zones", "spot").Err("object is not a polygon"),
+		Do("LENGTHWITHIN", "tracks", "truck1", "zones", "area", "METRIC", "flat").Err("invalid argument 'flat'"),
+		Do("LENGTHWITHIN", "tracks", "truck1", "zones", "area", "SPEED", "vincenty").Err("invalid argument 'SPEED'"),
+		// the track leaves through the hole and enters again
+		Do("LENGTHWITHIN", "tracks", "truck1", "zones", "area").Func(near(88952.6)),
+		Do("LENGTHWITHIN", "tracks", "truck1", "zones", "area", "METRIC", "vincenty").Func(near(89052.2)),
+		Do("LENGTHWITHIN", "tracks", "truck2", "zones", "area").Func(near(100486.5)),
+		Do("LENGTHWITHIN", "tracks", "truck3", "zones", "area").Str("0"),
+		Do("LENGTHWITHIN", "tracks", "truck3", "zones", "area").JSON().Str(`{"ok":true,"meters":0}`),
+	)
+}
+
 func keys_INTERSECTS_CURSOR_test(mc *mockServer) error {
 	testArea := `{
 		"type": "Polygon",
@@ -639,6 +945,34 @@ func keys_SEARCH_CURSOR_test(mc *mockServer) error {
 	})
 }
 
+func keys_MATCH_RE_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "fleet", "vehicle:1234:route:56", "POINT", 33.0001, -112.0001).OK(),
+		Do("SET", "fleet", "vehicle:1235:route:7", "POINT", 33.0002, -112.0002).OK(),
+		Do("SET", "fleet", "vehicle:99:route:56", "POINT", 33.0003, -112.0003).OK(),
+		Do("SET", "fleet", "depot:1", "POINT", 33.0004, -112.0004).OK(),
+		// a last RE is a glob
+		Do("SCAN", "fleet", "MATCH", "RE").Str("[0 []]"),
+		Do("SCAN", "fleet", "MATCH", "RE", "(vehicle", "IDS").Err("error parsing regexp: missing closing ): `(vehicle`"),
+		Do("SCAN", "fleet", "MATCH", "RE", `^vehicle:\d{4}:route:56$`, "IDS").Str("[0 [vehicle:1234:route:56]]"),
+		Do("SCAN", "fleet", "MATCH", "re", `:route:56$`, "IDS").Str("[0 [vehicle:1234:route:56 vehicle:99:route:56]]"),
+		Do("SCAN", "fleet", "MATCH", "RE", `^vehicle:\d{4}:`, "DESC", "IDS").Str("[0 [vehicle:1235:route:7 vehicle:1234:route:56]]"),
+		Do("SCAN", "fleet", "MATCH", "RE", `:route:56$`, "COUNT").Str("2"),
+		// the patterns of a query match when any of them match
+		Do("SCAN", "fleet", "MATCH", "depot:*", "MATCH", "RE", `:7$`, "IDS").Str("[0 [depot:1 vehicle:1235:route:7]]"),
+		Do("SCAN", "fleet", "MATCH", "RE", `^vehicle:`, "LIMIT", 2, "IDS").Str("[3 [vehicle:1234:route:56 vehicle:1235:route:7]]"),
+		Do("SCAN", "fleet", "MATCH", "RE", `^vehicle:`, "CURSOR", 3, "LIMIT", 2, "IDS").Str("[0 [vehicle:99:route:56]]"),
+		Do("NEARBY", "fleet", "MATCH", "RE", `:route:56$`, "IDS", "POINT", 33, -112, 100000).Str("[0 [vehicle:1234:route:56 vehicle:99:route:56]]"),
+		Do("WITHIN", "fleet", "MATCH", "RE", `^depot`, "IDS", "BOUNDS", 33, -113, 34, -112).Str("[0 [depot:1]]"),
+		Do("INTERSECTS", "fleet", "MATCH", "RE", `^depot`, "COUNT", "BOUNDS", 33, -113, 34, -112).Str("1"),
+		Do("SET", "names", "a", "STRING", "tile38").OK(),
+		Do("SET", "names", "b", "STRING", "redis").OK(),
+		Do("SEARCH", "names", "MATCH", "RE", `\d+$`, "IDS").Str("[0 [a]]"),
+		Do("NEARBY", "fleet", "MATCH", "RE", `^depot`, "FENCE", "POINT", 33, -112, 100).Err("MATCH RE is not allowed when FENCE is specified"),
+		Do("FSETWHERE", "fleet", "speed", 10, "MATCH", "RE", `^depot`).Err("MATCH RE is not allowed for FSETWHERE"),
+	)
+}
+
 func keys_MATCH_test(mc *mockServer) error {
 	return mc.DoBatch([][]interface{}{
 		{"SET", "fleet", "truck1", "POINT", "33.0001", "-112.0001"}, {"OK"},
@@ -693,6 +1027,85 @@ func keys_MATCH_test(mc *mockServer) error {
 	})
 }
 
+func keys_TTLBETWEEN_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "short", "EX", 30, "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "medium", "EX", 180, "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "long", "EX", 600, "POINT", 50, 50).OK(),
+		Do("SET", "mykey", "forever", "POINT", 33, -115).OK(),
+		Do("SCAN", "mykey", "TTLBETWEEN", 60, 300, "IDS").Str("[0 [medium]]"),
+		Do("SCAN", "mykey", "TTLBETWEEN", 0, 1000, "IDS").Str("[0 [long medium short]]"),
+		Do("SCAN", "mykey", "TTLBETWEEN", 0, 1000, "COUNT").Str("3"),
+		Do("SCAN", "mykey", "TTLBETWEEN", 1000, 2000, "COUNT").Str("0"),
+		Do("WITHIN", "mykey", "TTLBETWEEN", 0, 300, "IDS", "BOUNDS", 30, -120, 35, -110).Str("[0 [medium short]]"),
+		Do("NEARBY", "mykey", "TTLBETWEEN", 100, 1000, "IDS", "POINT", 33, -115).Str("[0 [medium long]]"),
+		Do("SCAN", "mykey", "TTLBETWEEN", 60).Err("wrong number of arguments for 'scan' command"),
+		Do("SCAN", "mykey", "TTLBETWEEN", -1, 60, "IDS").Err("invalid argument '-1'"),
+		Do("SCAN", "mykey", "TTLBETWEEN", 60, 30, "IDS").Err("invalid argument '30'"),
+		Do("SCAN", "mykey", "TTLBETWEEN", 0, 60, "TTLBETWEEN", 0, 60, "IDS").Err("duplicate argument 'TTLBETWEEN'"),
+		Do("WITHIN", "mykey", "FENCE", "TTLBETWEEN", 0, 60, "BOUNDS", 30, -120, 35, -110).Err("TTLBETWEEN is not allowed when FENCE is specified"),
+	)
+}
+
+func keys_ETAG_test(mc *mockServer) error {
+	var etag, respETag string
+	if err := mc.DoBatch(
+		Do("SET", "mykey", "truck1", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "truck2", "POINT", 34, -116).OK(),
+		Do("SET", "mykey", "truck3", "POINT", 50, 50).OK(),
+		Do("WITHIN", "mykey", "WITHETAG", "IDS", "BOUNDS", 30, -120, 35, -110).JSON().Func(func(s string) error {
+			etag = gjson.Get(s, "etag").String()
+			if etag == "" {
+				return fmt.Errorf("missing etag: %s", s)
+			}
+			return nil
+		}),
+		Do("SCAN", "mykey", "WITHETAG", "COUNT").Func(func(s string) error {
+			parts := strings.Fields(strings.Trim(s, "[]"))
+			if len(parts) != 2 || parts[1] != "3" {
+				return fmt.Errorf("unexpected result: %s", s)
+			}
+			respETag = parts[0]
+			return nil
+		}),
+	); err != nil {
+		return err
+	}
+	notModified := func(s string) error {
+		if !gjson.Get(s, "notmodified").Bool() || gjson.Get(s, "etag").String() != etag {
+			return fmt.Errorf("expected not modified, got %s", s)
+		}
+		return nil
+	}
+	return mc.DoBatch(
+		Do("WITHIN", "mykey", "IFNONEMATCH", etag, "IDS", "BOUNDS", 30, -120, 35, -110).JSON().Func(notModified),
+		Do("SCAN", "mykey", "IFNONEMATCH", respETag, "COUNT").Str("NOTMODIFIED"),
+		// changes outside of the area leave the result as is
+		Do("SET", "mykey", "truck3", "POINT", 51, 51).OK(),
+		Do("WITHIN", "mykey", "IFNONEMATCH", etag, "IDS", "BOUNDS", 30, -120, 35, -110).JSON().Func(notModified),
+		Do("FSET", "mykey", "truck1", "speed", 10).Str("1"),
+		Do("WITHIN", "mykey", "IFNONEMATCH", etag, "IDS", "BOUNDS", 30, -120, 35, -110).JSON().Func(notModified),
+		Do("WITHIN", "mykey", "IFNONEMATCH", etag, "BOUNDS", 30, -120, 35, -110).JSON().Func(func(s string) error {
+			if gjson.Get(s, "notmodified").Bool() || gjson.Get(s, "count").Int() != 2 ||
+				gjson.Get(s, "etag").String() == etag {
+				return fmt.Errorf("expected a new result, got %s", s)
+			}
+			return nil
+		}),
+		Do("SET", "mykey", "truck4", "POINT", 50, 50).OK(),
+		Do("SCAN", "mykey", "IFNONEMATCH", respETag, "COUNT").Func(func(s string) error {
+			if s == "NOTMODIFIED" || !strings.HasSuffix(s, " 4]") {
+				return fmt.Errorf("expected a new result, got %s", s)
+			}
+			return nil
+		}),
+		Do("SCAN", "mykey", "IFNONEMATCH").Err("wrong number of arguments for 'scan' command"),
+		Do("SCAN", "mykey", "WITHETAG", "WITHETAG", "COUNT").Err("duplicate argument 'WITHETAG'"),
+		Do("WITHIN", "mykey", "FENCE", "WITHETAG", "BOUNDS", 30, -120, 35, -110).Err("WITHETAG is not allowed when FENCE is specified"),
+		Do("WITHIN", "mykey", "IFNONEMATCH", "abc", "DELTA", 0, "BOUNDS", 30, -120, 35, -110).Err("IFNONEMATCH is not allowed with DELTA or COMPONENTS"),
+	)
+}
+
 func keys_FIELDS_search_test(mc *mockServer) error {
 	return mc.DoBatch([][]interface{}{
 		{"SET", "mykey", "1", "FIELD", "field1", 10, "FIELD", "field2", 11 /* field3 undefined */, "OBJECT", `{"type":"Point","coordinates":[-112.2791,33.5220]}`}, {"OK"},
@@ -789,6 +1202,443 @@ func keys_BUFFER_search_test(mc *mockServer) error {
 	})
 }
 
+func keys_BUFFER_ERODE_search_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "center", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "near", "POINT", 33.05, -115).OK(),
+		Do("SET", "mykey", "far", "POINT", 33.2, -115).OK(),
+		Do("WITHIN", "mykey", "IDS", "CIRCLE", 33, -115, 10000).Str("[0 [near center]]"),
+		Do("WITHIN", "mykey", "BUFFER", -6000, "IDS", "CIRCLE", 33, -115, 10000).Str("[0 [center]]"),
+		Do("INTERSECTS", "mykey", "BUFFER", -6000, "IDS", "CIRCLE", 33, -115, 10000).Str("[0 [center]]"),
+		Do("WITHIN", "mykey", "BUFFER", -20000, "IDS", "CIRCLE", 33, -115, 10000).Str("[0 []]"),
+		Do("INTERSECTS", "mykey", "BUFFER", -20000, "COUNT", "CIRCLE", 33, -115, 10000).JSON().Str(`{"ok":true,"count":0,"cursor":0}`),
+		Do("WITHIN", "mykey", "BUFFER", -1000, "IDS", "BOUNDS", 32, -116, 34, -114).Err("negative BUFFER is only supported for CIRCLE areas"),
+		Do("WITHIN", "mykey", "BUFFER", -1000, "WITHZONE", "IDS", "CIRCLE", 33, -115, 10000).Err("WITHZONE requires a positive BUFFER"),
+		Do("WITHIN", "mykey", "FENCE", "BUFFER", -20000, "CIRCLE", 33, -115, 10000).Err("BUFFER erodes the whole area of the FENCE"),
+	)
+}
+
+func keys_HASHES_search_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "point", "POINT", 33.5, -115.5).OK(),
+		Do("SET", "mykey", "rect", "BOUNDS", 33.49, -115.51, 33.52, -115.45).OK(),
+		Do("SCAN", "mykey", "HASHES", 5).Str("[0 [[point 9mvye] [rect 9mvys]]]"),
+		Do("SCAN", "mykey", "HASHES", 5).JSON().Str(`{"ok":true,"hashes":[`+
+			`{"id":"point","hash":"9mvye"},`+
+			`{"id":"rect","hash":"9mvys"}`+
+			`],"count":2,"cursor":0}`),
+		Do("SCAN", "mykey", "HASHES", 5, "COVER").Str("[0 [[point [9mvye]] [rect [9mvye 9mvys]]]]"),
+		Do("SCAN", "mykey", "HASHES", 5, "COVER").JSON().Str(`{"ok":true,"hashes":[`+
+			`{"id":"point","hashes":["9mvye"]},`+
+			`{"id":"rect","hashes":["9mvye","9mvys"]}`+
+			`],"count":2,"cursor":0}`),
+		Do("SCAN", "mykey", "HASHES", 0).Err("invalid argument '0'"),
+		Do("SCAN", "mykey", "HASHES", 9, "COVER").Err("too many geohashes to cover 'rect' at precision 9, the limit is 16"),
+		Do("SCAN", "mykey", "MATCH", "point", "HASHES", 9, "COVER").Str("[0 [[point [9mvyedrrw]]]]"),
+		Do("WITHIN", "mykey", "HASHES", 5, "COVER", "BOUNDS", 33, -116, 34, -115).Str("[0 [[rect [9mvye 9mvys]] [point [9mvye]]]]"),
+		Do("SCAN", "mykey", "MATCH", "point", "HASHES", 12).Str("[0 [[point 9mvyedrrwutg]]]"),
+	)
+}
+
+func keys_FEATURES_search_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "a", "FIELD", "speed", 10, "POINT", 10, 10).OK(),
+		Do("SET", "mykey", "b", "OBJECT", `{"type":"Feature","geometry":{"type":"Point","coordinates":[20,20]},"properties":{"speed":"fast"}}`).OK(),
+		Do("SET", "mykey", "c", "FIELD", "speed", 30, "BOUNDS", 10, 10, 20, 20).OK(),
+		Do("SCAN", "mykey", "FEATURES").JSON().Str(`{"ok":true,"features":{"type":"FeatureCollection","features":[`+
+			`{"type":"Feature","id":"a","geometry":{"type":"Point","coordinates":[10,10]},"properties":{"speed":10}},`+
+			`{"type":"Feature","id":"b","geometry":{"type":"Point","coordinates":[20,20]},"properties":{"speed":"fast"}},`+
+			`{"type":"Feature","id":"c","geometry":{"type":"Polygon","coordinates":[[[10,10],[20,10],[20,20],[10,20],[10,10]]]},"properties":{"speed":30}}`+
+			`]},"count":3,"cursor":0}`),
+		Do("SCAN", "mykey", "NOFIELDS", "FEATURES", "INDEX", 2).JSON().Str(`{"ok":true,"features":{"type":"FeatureCollection","features":[`+
+			`{"type":"Feature","id":"a","geometry":{"type":"Point","coordinates":[10,10]},"properties":{}},`+
+			`{"type":"Feature","id":"b","geometry":{"type":"Point","coordinates":[20,20]},"properties":{"speed":"fast"}},`+
+			`{"type":"Feature","id":"c","geometry":{"type":"Polygon","coordinates":[[[10,10],[20,10],[20,20],[10,20],[10,10]]]},"properties":{}}`+
+			`]},"index":{"bbox":[10,10,20,20],"grid":2,"cells":[2,1,1,2]},"count":3,"cursor":0}`),
+		Do("WITHIN", "mykey", "LIMIT", 1, "FEATURES", "INDEX", 4, "BOUNDS", 9, 9, 11, 11).Str(`[2 {"type":"FeatureCollection","features":[`+
+			`{"type":"Feature","id":"a","geometry":{"type":"Point","coordinates":[10,10]},"properties":{"speed":10}}`+
+			`]} {"bbox":[10,10,10,10],"grid":4,"cells":[1,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0]}]`),
+		Do("NEARBY", "mykey", "MATCH", "a", "DISTANCE", "FEATURES", "POINT", 10, 10).JSON().Str(`{"ok":true,"features":{"type":"FeatureCollection","features":[`+
+			`{"type":"Feature","id":"a","geometry":{"type":"Point","coordinates":[10,10]},"properties":{"speed":10},"distance":0}`+
+			`]},"count":1,"cursor":0}`),
+		Do("WITHIN", "nada", "FEATURES", "INDEX", 2, "BOUNDS", 9, 9, 11, 11).JSON().Str(`{"ok":true,"features":{"type":"FeatureCollection","features":[]},"index":{"bbox":null,"grid":2,"cells":[]},"count":0,"cursor":0}`),
+		Do("SCAN", "mykey", "FEATURES", "INDEX", 0).Err("invalid argument '0'"),
+		Do("SCAN", "mykey", "FEATURES", "INDEX", 65).Err("invalid argument '65'"),
+		Do("SCAN", "mykey", "FEATURES", "INDEX").Err("wrong number of arguments for 'scan' command"),
+		Do("SEARCH", "mykey", "FEATURES").Err("FEATURES is not allowed for SEARCH"),
+	)
+}
+
+func keys_MVT_search_test(mc *mockServer) error {
+	// the tile 1/1/0 with the layer "mykey", and a point feature at (228,3867)
+	// with the properties id "a" and speed 10
+	const tile = "GjF4AgoFbXlrZXkSDxIEAAABARgBIgUJyAO2PBoCaWQaBXNwZWVkIgMKAWEiAjAUKIAg"
+	err := mc.DoBatch(
+		Do("SET", "mykey", "a", "FIELD", "speed", 10, "POINT", 10, 10).OK(),
+		Do("SET", "mykey", "b", "POINT", -10, -10).OK(),
+		Do("SCAN", "mykey", "MVT", 0, 0, 0).JSON().Func(func(s string) error {
+			if gjson.Get(s, "mvt").String() == "" ||
+				gjson.Get(s, "count").Int() != 2 {
+				return fmt.Errorf("expected a tile with two objects, got %s", s)
+			}
+			return nil
+		}),
+		Do("INTERSECTS", "mykey", "MVT", 1, 1, 0, "TILE", 1, 0, 1).JSON().Func(func(s string) error {
+			if gjson.Get(s, "mvt").String() != tile ||
+				gjson.Get(s, "count").Int() != 1 {
+				return fmt.Errorf("expected %s, got %s", tile, s)
+			}
+			return nil
+		}),
+		Do("SCAN", "mykey", "MVT", 1, 1, 0).Func(func(s string) error {
+			if !strings.HasPrefix(s, "[0 ") {
+				return fmt.Errorf("expected a cursor and a tile, got %s", s)
+			}
+			return nil
+		}),
+		Do("SCAN", "mykey", "MVT", 0, 0).Err("wrong number of arguments for 'scan' command"),
+		Do("SCAN", "mykey", "MVT", 31, 0, 0).Err("invalid argument '31'"),
+		Do("SCAN", "mykey", "MVT", 1, 2, 0).Err("invalid argument '2'"),
+		Do("SEARCH", "mykey", "MVT", 0, 0, 0).Err("MVT is not allowed for SEARCH"),
+	)
+	if err != nil {
+		return err
+	}
+	// over HTTP the response is the tile itself
+	res, err := http.Get(fmt.Sprintf("http://localhost:%d/WITHIN+mykey+MVT+1+1+0+TILE+1+0+1", mc.port))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "application/vnd.mapbox-vector-tile" {
+		return fmt.Errorf("expected the tile content type, got %s", ct)
+	}
+	if base64.StdEncoding.EncodeToString(body) != tile {
+		return fmt.Errorf("expected %s, got %x", tile, body)
+	}
+	return nil
+}
+
+func keys_CSV_search_test(mc *mockServer) error {
+	err := mc.DoBatch(
+		Do("SET", "mykey", "a", "FIELD", "speed", 10, "POINT", 10, 20).OK(),
+		Do("SET", "mykey", "b", "FIELD", "name", `Smith, "J"`, "BOUNDS", 0, 0, 2, 2).OK(),
+		Do("SCAN", "mykey", "CSV").JSON().Str(`{"ok":true,"csv":"id,lon,lat,name,speed\r\na,20,10,0,10\r\nb,1,1,\"Smith, \"\"J\"\"\",0\r\n","count":2,"cursor":0}`),
+		Do("SCAN", "mykey", "CSV", "WKT", "FIELDS", "speed", "NOHEADER").JSON().Str(`{"ok":true,"csv":"a,POINT(20 10),10\r\nb,\"POLYGON((0 0,2 0,2 2,0 2,0 0))\",0\r\n","count":2,"cursor":0}`),
+		Do("NEARBY", "mykey", "LIMIT", 1, "DISTANCE", "CSV", "FIELDS", "speed", "POINT", 10, 20).Str("[1 id,lon,lat,distance,speed\r\na,20,10,0,10\r\n]"),
+		Do("WITHIN", "nada", "NOFIELDS", "CSV", "BOUNDS", 0, 0, 1, 1).JSON().Str(`{"ok":true,"csv":"id,lon,lat\r\n","count":0,"cursor":0}`),
+		Do("SCAN", "mykey", "CSV", "FIELDS").Err("wrong number of arguments for 'scan' command"),
+		Do("SCAN", "mykey", "CSV", "WKT", "WKT").Err("duplicate argument 'WKT'"),
+		Do("SEARCH", "mykey", "CSV").Err("CSV is not allowed for SEARCH"),
+	)
+	if err != nil {
+		return err
+	}
+	// over HTTP the response is the rows themselves
+	res, err := http.Get(fmt.Sprintf("http://localhost:%d/SCAN+mykey+CSV+FIELDS+speed", mc.port))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		return fmt.Errorf("expected the csv content type, got %s", ct)
+	}
+	if string(body) != "id,lon,lat,speed\r\na,20,10,10\r\nb,1,1,0\r\n" {
+		return fmt.Errorf("unexpected csv %q", body)
+	}
+	return nil
+}
+
+func keys_WKT_search_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "a", "FIELD", "speed", 10, "OBJECT", "POINT(1 2)").OK(),
+		Do("SET", "mykey", "b", "OBJECT", "LINESTRING(20 20,30 30)").OK(),
+		Do("SCAN", "mykey", "WKT").JSON().Str(`{"ok":true,"fields":["speed"],"wkt":[{"id":"a","wkt":"POINT(1 2)","fields":[10]},{"id":"b","wkt":"LINESTRING(20 20,30 30)","fields":[0]}],"count":2,"cursor":0}`),
+		Do("SCAN", "mykey", "NOFIELDS", "WKT").Str(`[0 [[a POINT(1 2)] [b LINESTRING(20 20,30 30)]]]`),
+		Do("WITHIN", "mykey", "NOFIELDS", "WKB", "OBJECT", "POLYGON((0 0,5 0,5 5,0 5,0 0))").JSON().Str(`{"ok":true,"wkb":[{"id":"a","wkb":"0101000000000000000000f03f0000000000000040"}],"count":1,"cursor":0}`),
+		Do("INTERSECTS", "mykey", "IDS", "OBJECT", "LINESTRING(25 0,25 50)").Str(`[0 [b]]`),
+	)
+}
+
+func keys_SIMPLIFY_search_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "line", "OBJECT", `{"type":"LineString","coordinates":[[0,0],[1,0.001],[2,0],[3,0.001],[4,0]]}`).OK(),
+		Do("SET", "mykey", "point", "POINT", 1, 1).OK(),
+		Do("SCAN", "mykey", "SIMPLIFY", 0.01, "OBJECTS").JSON().Str(`{"ok":true,"objects":[`+
+			`{"id":"line","object":{"type":"LineString","coordinates":[[0,0],[4,0]]}},`+
+			`{"id":"point","object":{"type":"Point","coordinates":[1,1]}}],"count":2,"cursor":0}`),
+		Do("SCAN", "mykey", "SIMPLIFY", 50, "METERS", "WKT").Str(`[0 [[line LINESTRING(0 0,1 0.001,2 0,3 0.001,4 0)] [point POINT(1 1)]]]`),
+		Do("SCAN", "mykey", "SIMPLIFY", 200, "METERS", "WKT").Str(`[0 [[line LINESTRING(0 0,4 0)] [point POINT(1 1)]]]`),
+		Do("DROP", "mykey").Str("1"),
+
+		// the bump on the top edge goes, unless the simplified edge would
+		// cross the hole
+		Do("SET", "mykey", "a", "OBJECT", "POLYGON((0 0,10 0,10 10,5 11,0 10,0 0))").OK(),
+		Do("SET", "mykey", "b", "OBJECT", "POLYGON((20 0,30 0,30 10,25 11,20 10,20 0),(24.5 9.5,25.5 9.5,25.5 10.5,24.5 10.5,24.5 9.5))").OK(),
+		Do("SCAN", "mykey", "SIMPLIFY", 1.5, "WKT").Str(`[0 [[a POLYGON((0 0,10 0,10 10,0 10,0 0))] [b POLYGON((20 0,30 0,30 10,25 11,20 10,20 0),(24.5 9.5,25.5 9.5,25.5 10.5,24.5 10.5,24.5 9.5))]]]`),
+		Do("INTERSECTS", "mykey", "SIMPLIFY", 1.5, "FEATURES", "BOUNDS", 0, 0, 10, 10).JSON().Str(`{"ok":true,"features":{"type":"FeatureCollection","features":[`+
+			`{"type":"Feature","id":"a","geometry":{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10],[0,0]]]},"properties":{}}]},"count":1,"cursor":0}`),
+		Do("SCAN", "mykey", "SIMPLIFY", 0, "IDS").Err("invalid argument '0'"),
+		Do("SCAN", "mykey", "SIMPLIFY").Err("wrong number of arguments for 'scan' command"),
+		Do("SCAN", "mykey", "SIMPLIFY", 1, "SIMPLIFY", 1, "IDS").Err("duplicate argument 'SIMPLIFY'"),
+	)
+}
+
+func keys_NEARBY_METRIC_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "1", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "2", "POINT", 34, -115).OK(),
+		Do("NEARBY", "mykey", "DISTANCE", "IDS", "POINT", 33, -115).JSON().Str(
+			`{"ok":true,"ids":[{"id":"1","distance":0},{"id":"2","distance":111194.92664455889}],"count":2,"cursor":0}`),
+		Do("NEARBY", "mykey", "METRIC", "HAVERSINE", "DISTANCE", "IDS", "POINT", 33, -115).JSON().Str(
+			`{"ok":true,"ids":[{"id":"1","distance":0},{"id":"2","distance":111194.92664455889}],"count":2,"cursor":0}`),
+		Do("NEARBY", "mykey", "METRIC", "VINCENTY", "DISTANCE", "IDS", "POINT", 33, -115).JSON().Str(
+			`{"ok":true,"ids":[{"id":"1","distance":0},{"id":"2","distance":110913.39899507178}],"count":2,"cursor":0}`),
+		Do("NEARBY", "mykey", "METRIC", "HAVERSINE", "IDS", "POINT", 33, -115, 111000).Str("[0 [1]]"),
+		Do("NEARBY", "mykey", "METRIC", "VINCENTY", "IDS", "POINT", 33, -115, 111000).Str("[0 [1 2]]"),
+		Do("NEARBY", "mykey", "METRIC", "EUCLID", "IDS", "POINT", 33, -115).Err("invalid argument 'EUCLID'"),
+		Do("NEARBY", "mykey", "METRIC", "IDS").Err("invalid argument 'IDS'"),
+		Do("DROP", "mykey").Str("1"),
+
+		// east is nearer on the sphere, north is nearer on the ellipsoid
+		Do("SET", "mykey", "east", "POINT", 0, 1).OK(),
+		Do("SET", "mykey", "north", "POINT", 1.0015, 0).OK(),
+		Do("NEARBY", "mykey", "LIMIT", 1, "IDS", "POINT", 0, 0).Str("[1 [east]]"),
+		Do("NEARBY", "mykey", "LIMIT", 1, "METRIC", "VINCENTY", "IDS", "POINT", 0, 0).Str("[1 [north]]"),
+		Do("NEARBY", "mykey", "LIMIT", 1, "CURSOR", 1, "METRIC", "VINCENTY", "IDS", "POINT", 0, 0).Str("[2 [east]]"),
+		Do("NEARBY", "mykey", "METRIC", "VINCENTY", "DISTANCE", "IDS", "POINT", 0, 0).JSON().Func(func(s string) error {
+			ids := gjson.Get(s, "ids.#.id").String()
+			if ids != `["north","east"]` {
+				return fmt.Errorf("expected north then east, got %s", ids)
+			}
+			if d0, d1 := gjson.Get(s, "ids.0.distance").Float(), gjson.Get(s, "ids.1.distance").Float(); d0 > d1 {
+				return fmt.Errorf("expected ascending distances, got %v then %v", d0, d1)
+			}
+			return nil
+		}),
+		Do("CONFIG", "SET", "distance-metric", "vincenty").OK(),
+		Do("CONFIG", "GET", "distance-metric").Str("[distance-metric vincenty]"),
+		Do("NEARBY", "mykey", "LIMIT", 1, "IDS", "POINT", 0, 0).Str("[1 [north]]"),
+		Do("NEARBY", "mykey", "LIMIT", 1, "METRIC", "HAVERSINE", "IDS", "POINT", 0, 0).Str("[1 [east]]"),
+		Do("CONFIG", "SET", "distance-metric", "euclid").Err("Invalid argument 'euclid' for CONFIG SET 'distance-metric'"),
+		Do("CONFIG", "SET", "distance-metric", "haversine").OK(),
+	)
+}
+
+func keys_NEARBY_ALONG_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "routes", "r1", "OBJECT", `{"type":"LineString","coordinates":[[0,0],[1,0],[1,1]]}`).OK(),
+		Do("SET", "routes", "p1", "POINT", 0, 0).OK(),
+		Do("SET", "fleet", "truck1", "POINT", 0.001, 0.5).OK(),
+		Do("SET", "fleet", "truck2", "POINT", 0.5, 1.001).OK(),
+		Do("SET", "fleet", "truck3", "POINT", -1, -1).OK(),
+		Do("NEARBY", "fleet", "ALONG", "routes", "r1", "IDS", "POINT", 0, 0).JSON().Func(func(s string) error {
+			expect := map[string]float64{
+				"truck1": 55597,
+				"truck2": 166793,
+				"truck3": 0,
+			}
+			if n := len(gjson.Get(s, "ids").Array()); n != len(expect) {
+				return fmt.Errorf("expected %d ids, got '%s'", len(expect), s)
+			}
+			for _, v := range gjson.Get(s, "ids").Array() {
+				along := v.Get("along").Float()
+				if math.Abs(along-expect[v.Get("id").String()]) > 1 {
+					return fmt.Errorf("unexpected along distance: %s", v.Raw)
+				}
+			}
+			return nil
+		}),
+		Do("NEARBY", "fleet", "ALONG", "routes", "r1", "LIMIT", 1, "IDS", "POINT", 0, 0.5).Str("[1 [[truck1 111.19492664455875 55597.46332227937]]]"),
+		Do("NEARBY", "fleet", "ALONG", "routes", "p1", "POINT", 0, 0).Err("object is not a linestring"),
+		Do("NEARBY", "fleet", "ALONG", "routes", "r2", "POINT", 0, 0).Err("id not found"),
+		Do("NEARBY", "fleet", "ALONG", "roads", "r1", "POINT", 0, 0).Err("key not found"),
+		Do("WITHIN", "fleet", "ALONG", "routes", "r1", "BOUNDS", 0, 0, 1, 1).Err("ALONG is not allowed for WITHIN"),
+		Do("NEARBY", "fleet", "FENCE", "ALONG", "routes", "r1", "POINT", 0, 0, 100).Err("ALONG is not allowed when FENCE is specified"),
+	)
+}
+
+func keys_NEARBY_MAXDIST_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "a", "POINT", 33.01, -115).OK(),
+		Do("SET", "mykey", "b", "POINT", 33.05, -115).OK(),
+		Do("SET", "mykey", "c", "POINT", 35, -115).OK(),
+		Do("NEARBY", "mykey", "LIMIT", 4, "IDS", "POINT", 33, -115).Str("[0 [a b c]]"),
+		Do("NEARBY", "mykey", "LIMIT", 4, "MAXDIST", 10000, "IDS", "POINT", 33, -115).Str("[0 [a b]]"),
+		Do("NEARBY", "mykey", "MAXDIST", 2000, "IDS", "POINT", 33, -115).Str("[0 [a]]"),
+		Do("NEARBY", "mykey", "MAXDIST", 100, "COUNT", "POINT", 33, -115).Str("0"),
+		// the closer of MAXDIST and the radius is used
+		Do("NEARBY", "mykey", "MAXDIST", 10000, "IDS", "POINT", 33, -115, 2000).Str("[0 [a]]"),
+		Do("NEARBY", "mykey", "MAXDIST", 2000, "IDS", "POINT", 33, -115, 10000).Str("[0 [a]]"),
+		Do("NEARBY", "mykey", "MAXDIST", 0, "IDS", "POINT", 33, -115).Err("invalid argument '0'"),
+		Do("NEARBY", "mykey", "MAXDIST", 10, "MAXDIST", 10, "IDS", "POINT", 33, -115).Err("duplicate argument 'MAXDIST'"),
+		Do("WITHIN", "mykey", "MAXDIST", 10, "IDS", "CIRCLE", 33, -115, 100).Err("MAXDIST is not allowed for WITHIN"),
+	)
+}
+
+func keys_NEARBY_HEADING_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "north", "POINT", 34, -115).OK(),
+		Do("SET", "mykey", "south", "POINT", 31, -115).OK(),
+		Do("NEARBY", "mykey", "HEADING", 90, "IDS", "POINT", 33, -115).JSON().Str(
+			`{"ok":true,"ids":[{"id":"north","distance":111194.92664455889,"bearing":-90},{"id":"south","distance":222389.85328911777,"bearing":90}],"count":2,"cursor":0}`),
+		Do("NEARBY", "mykey", "HEADING", 0, "DISTANCE", "IDS", "POINT", 33, -115).Str(
+			"[0 [[north 111194.92664455889 0] [south 222389.85328911777 180]]]"),
+		Do("NEARBY", "mykey", "HEADING", -170, "POINTS", "POINT", 33, -115).Str(
+			"[0 [[north [34 -115] 111194.92664455889 170] [south [31 -115] 222389.85328911777 -10]]]"),
+		// the bearing is measured with the metric
+		Do("SET", "other", "east", "POINT", 33, -114).OK(),
+		Do("NEARBY", "other", "HEADING", 0, "IDS", "POINT", 33, -115).Str("[0 [[east 93255.56116920573 89.72767562018521]]]"),
+		Do("NEARBY", "other", "METRIC", "VINCENTY", "HEADING", 0, "IDS", "POINT", 33, -115).Str("[0 [[east 93452.86288863025 89.72767559714237]]]"),
+		Do("NEARBY", "mykey", "HEADING", "left", "IDS", "POINT", 33, -115).Err("invalid argument 'left'"),
+		Do("WITHIN", "mykey", "HEADING", 90, "IDS", "BOUNDS", 30, -116, 35, -114).Err("HEADING is not allowed for WITHIN"),
+		Do("NEARBY", "mykey", "HEADING", 90, "FENCE", "POINT", 33, -115, 1000).Err("HEADING is not allowed when FENCE is specified"),
+	)
+}
+
+func keys_STRICT_search_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "fleet", "truck1", "POINT", 33, -115).OK(),
+		Do("SCAN", "fleeet", "IDS").Str("[0 []]"),
+		Do("SCAN", "fleeet", "STRICT", "IDS").Err("key not found"),
+		Do("SCAN", "fleet", "STRICT", "IDS").Str("[0 [truck1]]"),
+		Do("SEARCH", "fleeet", "STRICT", "IDS").Err("key not found"),
+		Do("NEARBY", "fleeet", "STRICT", "IDS", "POINT", 33, -115).Err("key not found"),
+		Do("WITHIN", "fleeet", "STRICT", "IDS", "BOUNDS", 30, -120, 35, -110).Err("key not found"),
+		Do("INTERSECTS", "fleeet", "STRICT", "IDS", "BOUNDS", 30, -120, 35, -110).Err("key not found"),
+		Do("NEARBY", "fleeet", "STRICT", "FENCE", "POINT", 33, -115, 100).Err("STRICT is not allowed when FENCE is specified"),
+		Do("CONFIG", "GET", "strict-keys").Str("[strict-keys no]"),
+		Do("CONFIG", "SET", "strict-keys", "yes").OK(),
+		Do("SCAN", "fleeet", "IDS").Err("key not found"),
+		Do("WITHIN", "fleet", "IDS", "BOUNDS", 30, -120, 35, -110).Str("[0 [truck1]]"),
+		Do("CONFIG", "SET", "strict-keys", "maybe").Err("Invalid argument 'maybe' for CONFIG SET 'strict-keys'"),
+		Do("CONFIG", "SET", "strict-keys", "no").OK(),
+		Do("SCAN", "fleeet", "IDS").Str("[0 []]"),
+	)
+}
+
+func keys_ASOF_search_test(mc *mockServer) error {
+	unixSeconds := func() string {
+		ts := float64(time.Now().UnixNano()) / float64(time.Second)
+		return strconv.FormatFloat(ts, 'f', -1, 64)
+	}
+	err := mc.DoBatch(
+		Do("WITHIN", "fleet", "ASOF", unixSeconds(), "IDS", "BOUNDS", 0, 0, 20, 20).
+			Err("history is disabled, set history-retention to enable it"),
+		Do("CONFIG", "SET", "history-retention", 60).OK(),
+		Do("CONFIG", "GET", "history-retention").Str("[history-retention 60]"),
+		Do("SET", "fleet", "truck1", "POINT", 10, 10).OK(),
+		Do("SET", "fleet", "truck2", "POINT", 10, 11).OK(),
+		Sleep(time.Second/20),
+	)
+	if err != nil {
+		return err
+	}
+	t1 := unixSeconds()
+	err = mc.DoBatch(
+		Sleep(time.Second/20),
+		Do("SET", "fleet", "truck1", "POINT", 50, 50).OK(),
+		Do("DEL", "fleet", "truck2").Str("1"),
+		Do("SET", "fleet", "truck3", "POINT", 10, 12).OK(),
+		Sleep(time.Second/20),
+	)
+	if err != nil {
+		return err
+	}
+	t2 := unixSeconds()
+	err = mc.DoBatch(
+		Sleep(time.Second/20),
+		Do("DROP", "fleet").Str("1"),
+		Sleep(time.Second/20),
+	)
+	if err != nil {
+		return err
+	}
+	err = mc.DoBatch(
+		Do("WITHIN", "fleet", "ASOF", unixSeconds(), "IDS", "BOUNDS", 0, 0, 60, 60).Str("[0 []]"),
+		Do("WITHIN", "fleet", "ASOF", t1, "IDS", "BOUNDS", 0, 0, 20, 20).Str("[0 [truck1 truck2]]"),
+		Do("WITHIN", "fleet", "ASOF", t1, "LIMIT", 1, "IDS", "BOUNDS", 0, 0, 20, 20).Str("[1 [truck1]]"),
+		Do("WITHIN", "fleet", "ASOF", t1, "CURSOR", 1, "IDS", "BOUNDS", 0, 0, 20, 20).Str("[0 [truck2]]"),
+		Do("WITHIN", "fleet", "ASOF", t2, "IDS", "BOUNDS", 0, 0, 20, 20).Str("[0 [truck3]]"),
+		Do("INTERSECTS", "fleet", "ASOF", t2, "IDS", "BOUNDS", 0, 0, 60, 60).Str("[0 [truck1 truck3]]"),
+		Do("INTERSECTS", "fleet", "ASOF", t2, "POINTS", "BOUNDS", 40, 40, 60, 60).Str("[0 [[truck1 [50 50]]]]"),
+		Do("WITHIN", "fleet", "ASOF", 1, "IDS", "BOUNDS", 0, 0, 20, 20).
+			Err("timestamp is outside the history retention window"),
+		Do("WITHIN", "fleet", "ASOF", "yesterday", "IDS", "BOUNDS", 0, 0, 20, 20).
+			Err("invalid argument 'yesterday'"),
+		Do("NEARBY", "fleet", "ASOF", t1, "IDS", "POINT", 10, 10).Err("ASOF is not allowed for NEARBY"),
+		Do("SCAN", "fleet", "ASOF", t1, "IDS").Err("ASOF is not allowed for SCAN"),
+		Do("WITHIN", "fleet", "ASOF", t1, "SPARSE", 1, "IDS", "BOUNDS", 0, 0, 20, 20).
+			Err("ASOF is not allowed when SPARSE is specified"),
+		Do("CONFIG", "SET", "history-retention", "forever").
+			Err("Invalid argument 'forever' for CONFIG SET 'history-retention'"),
+		Do("CONFIG", "SET", "history-retention", 0).OK(),
+		Do("WITHIN", "fleet", "ASOF", t1, "IDS", "BOUNDS", 0, 0, 20, 20).
+			Err("history is disabled, set history-retention to enable it"),
+	)
+	return err
+}
+
+func keys_NDISTINCT_search_test(mc *mockServer) error {
+	err := mc.DoBatch(
+		Do("SET", "fleet", "truck1", "FIELD", "route", "a", "FIELD", "speed", 10, "POINT", 10, 10).OK(),
+		Do("SET", "fleet", "truck2", "FIELD", "route", "a", "FIELD", "speed", 20, "POINT", 10, 11).OK(),
+		Do("SET", "fleet", "truck3", "FIELD", "route", "b", "FIELD", "speed", 30, "POINT", 10, 12).OK(),
+		Do("SET", "fleet", "truck4", "FIELD", "route", "c", "FIELD", "speed", 40, "POINT", 50, 50).OK(),
+		Do("SET", "fleet", "truck5", "FIELD", "speed", 50, "POINT", 10, 13).OK(),
+		Do("SET", "fleet", "truck6", "FIELD", "route", 1, "POINT", 10, 14).OK(),
+		Do("WITHIN", "fleet", "NDISTINCT", "route", "BOUNDS", 0, 0, 20, 20).Str("3"),
+		Do("WITHIN", "fleet", "WHERE", "speed", 5, 25, "NDISTINCT", "route", "BOUNDS", 0, 0, 20, 20).Str("1"),
+		Do("INTERSECTS", "fleet", "NDISTINCT", "route", "BOUNDS", 0, 0, 60, 60).Str("4"),
+		Do("SCAN", "fleet", "NDISTINCT", "route").Str("4"),
+		Do("NEARBY", "fleet", "NDISTINCT", "route", "POINT", 10, 10, 500000).Str("3"),
+		Do("WITHIN", "fleet", "NDISTINCT", "route", "BOUNDS", 0, 0, 20, 20).JSON().
+			Str(`{"ok":true,"ndistinct":3,"approximate":false,"count":5,"cursor":0}`),
+		Do("WITHIN", "fleet", "NDISTINCT", "BOUNDS", 0, 0, 20, 20).Err("invalid argument '0'"),
+		Do("WITHIN", "fleet", "NDISTINCT").Err("wrong number of arguments for 'within' command"),
+		Do("WITHIN", "fleet", "FENCE", "NDISTINCT", "route", "BOUNDS", 0, 0, 20, 20).
+			Err("NDISTINCT is not allowed when FENCE is specified"),
+		Do("CONFIG", "GET", "distinct-exact-limit").Str("[distinct-exact-limit 10000]"),
+		Do("CONFIG", "SET", "distinct-exact-limit", "few").
+			Err("Invalid argument 'few' for CONFIG SET 'distinct-exact-limit'"),
+		Do("CONFIG", "SET", "distinct-exact-limit", 2).OK(),
+		Do("WITHIN", "fleet", "NDISTINCT", "route", "BOUNDS", 0, 0, 20, 20).JSON().
+			Str(`{"ok":true,"ndistinct":3,"approximate":true,"count":5,"cursor":0}`),
+		Do("CONFIG", "SET", "distinct-exact-limit", 10000).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	// many distinct values are estimated
+	for i := 0; i < 20000; i++ {
+		_, err := mc.Do("SET", "routes", fmt.Sprintf("truck%d", i),
+			"FIELD", "route", fmt.Sprintf("route%d", i%15000), "POINT", 10, 10)
+		if err != nil {
+			return err
+		}
+	}
+	return mc.DoBatch(
+		Do("WITHIN", "routes", "NDISTINCT", "route", "BOUNDS", 0, 0, 20, 20).JSON().
+			Func(func(s string) error {
+				n := gjson.Get(s, "ndistinct").Float()
+				if !gjson.Get(s, "approximate").Bool() || math.Abs(n-15000)/15000 > 0.03 {
+					return fmt.Errorf("expected about 15000 approximate, got '%s'", s)
+				}
+				return nil
+			}),
+		Do("DROP", "routes").Str("1"),
+		Do("DROP", "fleet").Str("1"),
+	)
+}
+
 // match sorts the response and compares to the expected input
 func match(expectIn string) func(org, v interface{}) (resp, expect interface{}) {
 	return func(v, org interface{}) (resp, expect interface{}) {
@@ -815,3 +1665,32 @@ func keys_KNN_bench(mc *mockServer) error {
 		"POINT", lat, lon)
 	return err
 }
+
+func keys_JOIN_search_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "drivers", "d1", "FIELD", "name", "alice", "FIELD", "rating", 4.5, "STRING", "").OK(),
+		Do("SET", "drivers", "d2", "FIELD", "rating", 3, "STRING", "").OK(),
+		Do("SET", "fleet", "truck1", "FIELD", "driverid", "d1", "POINT", 10, 10).OK(),
+		Do("SET", "fleet", "truck2", "FIELD", "driverid", "d2", "POINT", 10, 11).OK(),
+		Do("SET", "fleet", "truck3", "FIELD", "driverid", "d3", "POINT", 10, 12).OK(),
+		Do("SET", "fleet", "truck4", "FIELD", "speed", 10, "POINT", 10, 13).OK(),
+		Do("SCAN", "fleet", "JOIN", "drivers", "ON", "driverid", "FIELDS", "name,rating", "POINTS").JSON().
+			Str(`{"ok":true,"fields":["driverid","drivers.name","drivers.rating","speed"],"points":[`+
+				`{"id":"truck1","point":{"lat":10,"lon":10},"fields":["d1","alice",4.5,0]},`+
+				`{"id":"truck2","point":{"lat":10,"lon":11},"fields":["d2",0,3,0]},`+
+				`{"id":"truck3","point":{"lat":10,"lon":12},"fields":["d3",0,0,0]},`+
+				`{"id":"truck4","point":{"lat":10,"lon":13},"fields":[0,0,0,10]}],"count":4,"cursor":0}`),
+		Do("WITHIN", "fleet", "LIMIT", 1, "JOIN", "drivers", "ON", "driverid", "FIELDS", "name", "POINTS", "BOUNDS", 0, 0, 20, 20).
+			Str(`[1 [[truck1 [10 10] [driverid d1 drivers.name alice]]]]`),
+		Do("NEARBY", "fleet", "LIMIT", 1, "JOIN", "drivers", "ON", "driverid", "POINTS", "POINT", 10, 10).
+			Str(`[1 [[truck1 [10 10] [driverid d1 drivers.name alice drivers.rating 4.5]]]]`),
+		Do("INTERSECTS", "fleet", "LIMIT", 1, "JOIN", "nobody", "ON", "driverid", "POINTS", "BOUNDS", 0, 0, 20, 20).
+			Str(`[1 [[truck1 [10 10] [driverid d1]]]]`),
+		Do("SCAN", "fleet", "JOIN", "drivers", "driverid", "IDS").Err("invalid argument 'driverid'"),
+		Do("SCAN", "fleet", "JOIN", "drivers", "ON").Err("wrong number of arguments for 'scan' command"),
+		Do("SCAN", "fleet", "JOIN", "drivers", "ON", "driverid", "FIELDS", "name,,rating", "IDS").Err("invalid argument 'name,,rating'"),
+		Do("SCAN", "fleet", "JOIN", "drivers", "ON", "driverid", "JOIN", "drivers", "ON", "driverid", "IDS").Err("duplicate argument 'JOIN'"),
+		Do("WITHIN", "fleet", "FENCE", "JOIN", "drivers", "ON", "driverid", "BOUNDS", 0, 0, 20, 20).
+			Err("JOIN is not allowed when FENCE is specified"),
+	)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,26 +18,53 @@ func subTestKeys(g *testGroup) {
 	g.regSubTest("DROP", keys_DROP_test)
 	g.regSubTest("RENAME", keys_RENAME_test)
 	g.regSubTest("RENAMENX", keys_RENAMENX_test)
+	g.regSubTest("COPY", keys_COPY_test)
 	g.regSubTest("EXPIRE", keys_EXPIRE_test)
+	g.regSubTest("EXPIRE effort", keys_EXPIRE_effort_test)
+	g.regSubTest("EXPIRE backlog", keys_EXPIRE_backlog_test)
+	g.regSubTest("PEXPIRE", keys_PEXPIRE_test)
 	g.regSubTest("FSET", keys_FSET_test)
 	g.regSubTest("FGET", keys_FGET_test)
+	g.regSubTest("FSETWHERE", keys_FSETWHERE_test)
 	g.regSubTest("GET", keys_GET_test)
+	g.regSubTest("GET polyline", keys_GET_polyline_test)
+	g.regSubTest("SET WKT", keys_SET_WKT_test)
 	g.regSubTest("KEYS", keys_KEYS_test)
 	g.regSubTest("PERSIST", keys_PERSIST_test)
 	g.regSubTest("SET", keys_SET_test)
 	g.regSubTest("STATS", keys_STATS_test)
 	g.regSubTest("TTL", keys_TTL_test)
+	g.regSubTest("PTTL", keys_PTTL_test)
+	g.regSubTest("TRACK", keys_TRACK_test)
+	g.regSubTest("MOVEMENT", keys_MOVEMENT_test)
+	g.regSubTest("TRACKTRIM", keys_TRACKTRIM_test)
+	g.regSubTest("TRACKAPPEND", keys_TRACKAPPEND_test)
+	g.regSubTest("SETDELTA", keys_SETDELTA_test)
+	g.regSubTest("DEDUP", keys_DEDUP_test)
+	g.regSubTest("KEYDEFAULTS", keys_KEYDEFAULTS_test)
+	g.regSubTest("SETINDEX", keys_SETINDEX_test)
+	g.regSubTest("SETINDEX_RANGE", keys_SETINDEX_RANGE_test)
+	g.regSubTest("TOMBSTONES", keys_TOMBSTONES_test)
+	g.regSubTest("EXPORT", keys_EXPORT_test)
 	g.regSubTest("EXIST", keys_EXISTS_test)
 	g.regSubTest("FEXIST", keys_FEXISTS_test)
 	g.regSubTest("SET EX", keys_SET_EX_test)
+	g.regSubTest("SET IFWITHIN", keys_SET_IFWITHIN_test)
+	g.regSubTest("SET throttle", keys_SET_throttle_test)
+	g.regSubTest("SET depth", keys_SET_depth_test)
 	g.regSubTest("PDEL", keys_PDEL_test)
+	g.regSubTest("MSET", keys_MSET_test)
+	g.regSubTest("binary ids", keys_binary_ids_test)
 	g.regSubTest("FIELDS", keys_FIELDS_test)
 	g.regSubTest("WHEREIN", keys_WHEREIN_test)
 	g.regSubTest("WHEREEVAL", keys_WHEREEVAL_test)
+	g.regSubTest("WHEREJSON", keys_WHEREJSON_test)
 	g.regSubTest("TYPE", keys_TYPE_test)
 	g.regSubTest("FLUSHDB", keys_FLUSHDB_test)
 	g.regSubTest("HEALTHZ", keys_HEALTHZ_test)
+	g.regSubTest("NODESTATUS", keys_NODESTATUS_test)
 	g.regSubTest("SERVER", keys_SERVER_test)
+	g.regSubTest("CAPABILITIES", keys_CAPABILITIES_test)
 	g.regSubTest("INFO", keys_INFO_test)
 }
 
@@ -98,6 +126,15 @@ func keys_DROP_test(mc *mockServer) error {
 	)
 }
 func keys_RENAME_test(mc *mockServer) error {
+	// the hooks of a key move with it
+	chanKey := func(key string) func(s string) error {
+		return func(s string) error {
+			if gjson.Get(s, "chans.0.key").String() != key {
+				return fmt.Errorf("expected key '%s', got '%s'", key, s)
+			}
+			return nil
+		}
+	}
 	return mc.DoBatch(
 		Do("SET", "mykey", "myid1", "HASH", "9my5xp7").OK(),
 		Do("SET", "mykey", "myid2", "HASH", "9my5xp8").OK(),
@@ -113,8 +150,11 @@ func keys_RENAME_test(mc *mockServer) error {
 		Do("RENAME", "foo", "mynewkey").Err("key not found"),
 		Do("SCAN", "mynewkey", "COUNT").Str("1"),
 		Do("SETCHAN", "mychan", "INTERSECTS", "mynewkey", "BOUNDS", 10, 10, 20, 20).Str("1"),
-		Do("RENAME", "mynewkey", "foo2").Err("key has hooks set"),
-		Do("RENAMENX", "mynewkey", "foo2").Err("key has hooks set"),
+		Do("RENAME", "mynewkey", "foo2").OK(),
+		Do("CHANS", "mychan").JSON().Func(chanKey("foo2")),
+		Do("RENAMENX", "foo2", "mynewkey").Str("1"),
+		Do("CHANS", "mychan").JSON().Func(chanKey("mynewkey")),
+		Do("SCAN", "mynewkey", "COUNT").Str("1"),
 		Do("SET", "mykey", "myid1", "HASH", "9my5xp7").OK(),
 		Do("RENAME", "mykey", "foo2").OK(),
 		Do("RENAMENX", "foo2", "foo3").Str("1"),
@@ -143,6 +183,132 @@ func keys_RENAMENX_test(mc *mockServer) error {
 		Do("SCAN", "mynewkey", "COUNT").Str("2"),
 	)
 }
+
+func keys_COPY_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "fleet", "truck1", "FIELD", "speed", 10, "POINT", 33, -115).OK(),
+		Do("SET", "fleet", "truck2", "EX", 100, "POINT", 34, -116).OK(),
+		Do("SET", "zones", "zone1", "POINT", 1, 1).OK(),
+		Do("COPY", "fleet").Err("wrong number of arguments for 'copy' command"),
+		Do("COPY", "fleet", "fleet2", "OVERWRITE").Err("invalid argument 'OVERWRITE'"),
+		Do("COPY", "fleet", "fleet").Err("invalid argument 'fleet'"),
+		Do("COPY", "nokey", "fleet2").Err("key not found"),
+		Do("COPY", "fleet", "fleet2").Str("1"),
+		Do("SCAN", "fleet2", "IDS").Str("[0 [truck1 truck2]]"),
+		Do("FGET", "fleet2", "truck1", "speed").Str("10"),
+		Do("TTL", "fleet2", "truck1").Str("-1"),
+		Do("TTL", "fleet2", "truck2").Func(func(s string) error {
+			if ttl, err := strconv.Atoi(s); err != nil || ttl < 90 || ttl > 100 {
+				return fmt.Errorf("expected a ttl of about 100, got '%s'", s)
+			}
+			return nil
+		}),
+		// the copy doesn't change with the source
+		Do("FSET", "fleet2", "truck1", "speed", 20).Str("1"),
+		Do("DEL", "fleet", "truck2").Str("1"),
+		Do("FGET", "fleet", "truck1", "speed").Str("10"),
+		Do("EXISTS", "fleet2", "truck2").Str("1"),
+		Do("COPY", "zones", "fleet2").Str("0"),
+		Do("COPY", "zones", "fleet2").JSON().Err("key already exists"),
+		Do("SCAN", "fleet2", "IDS").Str("[0 [truck1 truck2]]"),
+		Do("COPY", "zones", "fleet2", "REPLACE").Str("1"),
+		Do("SCAN", "fleet2", "IDS").Str("[0 [zone1]]"),
+		Do("COPY", "fleet", "fleet3").JSON().OK(),
+		Do("SCAN", "fleet3", "IDS").Str("[0 [truck1]]"),
+	)
+}
+func keys_EXPIRE_effort_test(mc *mockServer) error {
+	err := mc.DoBatch(
+		Do("CONFIG", "GET", "active-expire-effort").Str("[active-expire-effort 1]"),
+		Do("CONFIG", "SET", "active-expire-effort", 0).Err("Invalid argument '0' for CONFIG SET 'active-expire-effort'"),
+		Do("CONFIG", "SET", "active-expire-effort", 11).Err("Invalid argument '11' for CONFIG SET 'active-expire-effort'"),
+	)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 3000; i++ {
+		err := mc.DoBatch(Do("SET", fmt.Sprintf("mykey%d", i%2), i, "EX", 0.2,
+			"POINT", 33, -115).OK())
+		if err != nil {
+			return err
+		}
+	}
+	return mc.DoBatch(
+		Sleep(time.Second*2),
+		Do("SCAN", "mykey0", "COUNT").Str("0"),
+		Do("SCAN", "mykey1", "COUNT").Str("0"),
+		Do("SERVER").JSON().Func(func(s string) error {
+			if gjson.Get(s, "stats.expire_backlog").Int() != 0 {
+				return fmt.Errorf("expected no backlog, got '%s'", s)
+			}
+			if gjson.Get(s, "stats.expire_rate").Float() == 0 {
+				return fmt.Errorf("expected an expire rate, got '%s'", s)
+			}
+			return nil
+		}),
+	)
+}
+
+func keys_EXPIRE_backlog_test(mc *mockServer) error {
+	// all of the objects expire at about the same time, which leaves a
+	// backlog that takes a few ticks to delete
+	const n = 20000
+	deadline := time.Now().Add(time.Second * 3)
+	var cmds [][]interface{}
+	for i := 0; i < n; i++ {
+		px := time.Until(deadline) / time.Millisecond
+		cmds = append(cmds, []interface{}{"SET", "backlog", fmt.Sprintf("obj%d", i),
+			"PX", int64(px), "POINT", 33, -115})
+		if len(cmds) == 1000 {
+			if _, err := mc.DoPipeline(cmds); err != nil {
+				return err
+			}
+			cmds = nil
+		}
+	}
+	if time.Until(deadline) < time.Second/2 {
+		return errors.New("too slow to set up the backlog")
+	}
+	err := mc.DoBatch(
+		Do("SCAN", "backlog", "COUNT").Str(fmt.Sprint(n)),
+		Sleep(time.Until(deadline)),
+	)
+	if err != nil {
+		return err
+	}
+	// wait for the first tick that leaves a backlog
+	errNoBacklog := errors.New("expected a backlog")
+	for start := time.Now(); ; time.Sleep(time.Millisecond * 5) {
+		err := mc.DoBatch(Do("SERVER").JSON().Func(func(s string) error {
+			if gjson.Get(s, "stats.expire_backlog").Int() == 0 {
+				return errNoBacklog
+			}
+			return nil
+		}))
+		if err == nil {
+			break
+		}
+		if !strings.Contains(err.Error(), errNoBacklog.Error()) ||
+			time.Since(start) > time.Second {
+			return err
+		}
+	}
+	return mc.DoBatch(
+		Do("GET", "backlog", fmt.Sprintf("obj%d", n-1)).Str("<nil>"),
+		Do("SCAN", "backlog", "COUNT").Str("0"),
+		Do("SCAN", "backlog", "WHERE", "z", "-inf", "+inf", "COUNT").Str("0"),
+		Do("NEARBY", "backlog", "COUNT", "POINT", 33, -115, 1000).Str("0"),
+		Do("WITHIN", "backlog", "IDS", "CIRCLE", 33, -115, 1000).Str("[0 []]"),
+		Sleep(time.Second*2),
+		Do("SERVER").JSON().Func(func(s string) error {
+			if gjson.Get(s, "stats.expire_backlog").Int() != 0 {
+				return fmt.Errorf("expected no backlog, got '%s'", s)
+			}
+			return nil
+		}),
+	)
+}
+
 func keys_EXPIRE_test(mc *mockServer) error {
 	return mc.DoBatch(
 		Do("SET", "mykey", "myid", "STRING", "value").OK(),
@@ -165,6 +331,28 @@ func keys_EXPIRE_test(mc *mockServer) error {
 		Do("EXPIRE", "mykey", "myid1", 1).JSON().Err("id not found"),
 	)
 }
+func keys_PEXPIRE_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "myid", "STRING", "value").OK(),
+		Do("PEXPIRE", "mykey", "myid").Err("wrong number of arguments for 'pexpire' command"),
+		Do("PEXPIRE", "mykey", "myid", "0.5").Err("invalid argument '0.5'"),
+		Do("PEXPIRE", "mykey", "myid", 250).Str("1"),
+		Sleep(time.Millisecond*100),
+		Do("GET", "mykey", "myid").Str("value"),
+		Sleep(time.Millisecond*250),
+		Do("GET", "mykey", "myid").Str("<nil>"),
+		Do("PEXPIRE", "mykey", "myid", 250).JSON().Err("key not found"),
+		Do("SET", "mykey", "myid1", "STRING", "value1", "PX", 250).OK(),
+		Do("SET", "mykey", "myid2", "STRING", "value2", "PX", "x").Err("invalid argument 'x'"),
+		Do("SET", "mykey", "myid2", "STRING", "value2", "PX").Err("wrong number of arguments for 'set' command"),
+		Do("SET", "mykey", "myid2", "STRING", "value2").OK(),
+		Sleep(time.Millisecond*100),
+		Do("GET", "mykey", "myid1").Str("value1"),
+		Sleep(time.Millisecond*250),
+		Do("GET", "mykey", "myid1").Str("<nil>"),
+		Do("PEXPIRE", "mykey", "myid1", 250).JSON().Err("id not found"),
+	)
+}
 func keys_FSET_test(mc *mockServer) error {
 	return mc.DoBatch(
 		Do("SET", "mykey", "myid", "HASH", "9my5xp7").OK(),
@@ -245,6 +433,75 @@ func keys_FGET_test(mc *mockServer) error {
 		Do("FGET", "mykey", "myid2", "a", "b").Err("id not found"),
 	)
 }
+func keys_FSETWHERE_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "fleet", "truck1", "FIELD", "route", 42, "POINT", 33, -115).OK(),
+		Do("SET", "fleet", "truck2", "FIELD", "route", 42, "POINT", 33, -116).OK(),
+		Do("SET", "fleet", "truck3", "FIELD", "route", 7, "POINT", 34, -115).OK(),
+		Do("SET", "fleet", "bus1", "FIELD", "route", 42, "POINT", 34, -116).OK(),
+		Do("FSETWHERE", "fleet", "detour", 1, "WHERE", "route", 42, 42).Str("3"),
+		Do("FGET", "fleet", "truck1", "detour").Str("1"),
+		Do("FGET", "fleet", "truck2", "detour").Str("1"),
+		Do("FGET", "fleet", "truck3", "detour").Str("0"),
+		Do("FGET", "fleet", "bus1", "detour").Str("1"),
+		Do("FSETWHERE", "fleet", "detour", 1, "WHERE", "route", 42, 42).Str("0"),
+		Do("FSETWHERE", "fleet", "detour", 2, "MATCH", "truck*", "WHERE", "route", 42, 42).JSON().Str(`{"ok":true,"count":2}`),
+		Do("FGET", "fleet", "bus1", "detour").Str("1"),
+		Do("FGET", "fleet", "truck2", "detour").Str("2"),
+		Do("FSETWHERE", "fleet", "detour", 0).Str("3"),
+		Do("SCAN", "fleet", "WHERE", "detour", 1, 2, "COUNT").Str("0"),
+		Do("FSETWHERE", "fleet", "route", 9, "WHEREIN", "route", 1, 7).Str("1"),
+		Do("FGET", "fleet", "truck3", "route").Str("9"),
+		Do("FSETWHERE", "fleet", "detour").Err("wrong number of arguments for 'fsetwhere' command"),
+		Do("FSETWHERE", "nokey", "detour", 1).Err("key not found"),
+		Do("FSETWHERE", "fleet", "z", 1).Err("invalid argument 'z'"),
+		Do("FSETWHERE", "fleet", "detour", 1, "IDS").Err("only MATCH, WHERE, and WHEREIN are allowed for FSETWHERE"),
+		Do("FSETWHERE", "fleet", "detour", 1, "WHEREEVAL", "return true", 0).Err("WHEREEVAL is not allowed for FSETWHERE"),
+	)
+}
+
+func keys_GET_polyline_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "track", "OBJECT", `{"type":"LineString","coordinates":[[-120.2,38.5],[-120.95,40.7],[-126.453,43.252]]}`).OK(),
+		Do("SET", "mykey", "truck", "POINT", 33, -112).OK(),
+		Do("GET", "mykey", "track", "FORMAT", "polyline").Str("_p~iF~ps|U_ulLnnqC_mqNvxq`@"),
+		Do("GET", "mykey", "track", "FORMAT", "polyline").JSON().Str(`{"ok":true,"polyline":"_p~iF~ps|U_ulLnnqC_mqNvxq`+"`"+`@"}`),
+		Do("GET", "mykey", "track", "FORMAT", "polyline", "PRECISION", 6).Str("_izlhA~rlgdF_{geC~ywl@_kwzCn`{nI"),
+		Do("GET", "mykey", "track", "FORMAT", "polyline", "PRECISION", 0).Err("invalid argument '0'"),
+		Do("GET", "mykey", "track", "FORMAT", "geojson").Err("invalid argument 'geojson'"),
+		Do("GET", "mykey", "truck", "FORMAT", "polyline").Err("object is not a linestring"),
+	)
+}
+
+func keys_SET_WKT_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "p", "OBJECT", "POINT(1 2)").OK(),
+		Do("GET", "mykey", "p").Str(`{"type":"Point","coordinates":[1,2]}`),
+		Do("GET", "mykey", "p", "FORMAT", "wkt").Str("POINT(1 2)"),
+		Do("GET", "mykey", "p", "FORMAT", "wkb").JSON().Str(`{"ok":true,"wkb":"0101000000000000000000f03f0000000000000040"}`),
+		Do("SET", "mykey", "z", "OBJECT", "SRID=4326;POINT Z (1 2 3)").OK(),
+		Do("GET", "mykey", "z").Str(`{"type":"Point","coordinates":[1,2,3]}`),
+		Do("SET", "mykey", "m", "OBJECT", "point m (1 2 3)").OK(),
+		Do("GET", "mykey", "m").Str(`{"type":"Point","coordinates":[1,2]}`),
+		Do("SET", "mykey", "poly", "OBJECT", "POLYGON((0 0,10 0,10 10,0 10,0 0),(2 2,4 2,4 4,2 4,2 2))").OK(),
+		Do("GET", "mykey", "poly").Str(`{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10],[0,0]],[[2,2],[4,2],[4,4],[2,4],[2,2]]]}`),
+		Do("GET", "mykey", "poly", "FORMAT", "wkt").Str("POLYGON((0 0,10 0,10 10,0 10,0 0),(2 2,4 2,4 4,2 4,2 2))"),
+		Do("SET", "mykey", "mp", "OBJECT", "MULTIPOINT(1 2,(3 4))").OK(),
+		Do("GET", "mykey", "mp", "FORMAT", "wkt").Str("MULTIPOINT((1 2),(3 4))"),
+		Do("SET", "mykey", "gc", "OBJECT", "GEOMETRYCOLLECTION(LINESTRING(0 0,1 1),MULTIPOLYGON(((0 0,1 0,1 1,0 0))))").OK(),
+		Do("GET", "mykey", "gc").Str(`{"type":"GeometryCollection","geometries":[{"type":"LineString","coordinates":[[0,0],[1,1]]},{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,0]]]]}]}`),
+		Do("GET", "mykey", "gc", "FORMAT", "wkt").Str("GEOMETRYCOLLECTION(LINESTRING(0 0,1 1),MULTIPOLYGON(((0 0,1 0,1 1,0 0))))"),
+		Do("SET", "mykey", "b", "BOUNDS", 0, 0, 1, 1).OK(),
+		Do("GET", "mykey", "b", "FORMAT", "wkt").Str("POLYGON((0 0,1 0,1 1,0 1,0 0))"),
+		Do("SET", "mykey", "c", "OBJECT", "CIRCULARSTRING(0 0,1 1,2 0)").Err("unsupported WKT geometry type 'CIRCULARSTRING'"),
+		Do("SET", "mykey", "c", "OBJECT", "POINT(1)").Err("invalid WKT at position 7"),
+		Do("SET", "mykey", "c", "OBJECT", "POINT Z (1 2)").Err("invalid WKT at position 12"),
+		Do("SET", "mykey", "c", "OBJECT", "POINT(1 2) x").Err("invalid WKT at position 11"),
+		Do("SET", "mykey", "c", "OBJECT", "SRID=3857;POINT(1 2)").Err("unsupported WKT SRID '3857'"),
+		Do("SET", "mykey", "c", "OBJECT", "POINT EMPTY").Err("invalid WKT, POINT EMPTY is not supported"),
+	)
+}
+
 func keys_GET_test(mc *mockServer) error {
 	return mc.DoBatch(
 		Do("SET", "mykey", "myid", "STRING", "value").OK(),
@@ -311,11 +568,12 @@ func keys_PERSIST_test(mc *mockServer) error {
 		Do("SET", "mykey", "myid", "STRING", "value").OK(),
 		Do("EXPIRE", "mykey", "myid", 2).Str("1"),
 		Do("PERSIST", "mykey", "myid").Str("1"),
+		Do("TTL", "mykey", "myid").Str("-1"),
 		Do("PERSIST", "mykey", "myid").Str("0"),
 		Do("PERSIST", "mykey").Err("wrong number of arguments for 'persist' command"),
-		Do("PERSIST", "mykey2", "myid").Str("0"),
+		Do("PERSIST", "mykey2", "myid").Err("key not found"),
 		Do("PERSIST", "mykey2", "myid").JSON().Err("key not found"),
-		Do("PERSIST", "mykey", "myid2").Str("0"),
+		Do("PERSIST", "mykey", "myid2").Err("id not found"),
 		Do("PERSIST", "mykey", "myid2").JSON().Err("id not found"),
 		Do("EXPIRE", "mykey", "myid", 2).Str("1"),
 		Do("PERSIST", "mykey", "myid").JSON().OK(),
@@ -433,6 +691,445 @@ func keys_STATS_test(mc *mockServer) error {
 		Do("STATS").Err(`wrong number of arguments for 'stats' command`),
 	)
 }
+func keys_TOMBSTONES_test(mc *mockServer) error {
+	deleted := func(expect string) func(s string) error {
+		return func(s string) error {
+			got := gjson.Get(s, "ids").Raw + " " + gjson.Get(s, "deleted.#.id").Raw
+			if got != expect {
+				return fmt.Errorf("expected '%s', got '%s'", expect, got)
+			}
+			return nil
+		}
+	}
+	err := mc.DoBatch(
+		Do("SET", "mykey", "truck1", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "truck2", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "truck3", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "car1", "POINT", 33, -115).OK(),
+
+		// tombstones are off by default
+		Do("DEL", "mykey", "truck1").Str("1"),
+		Do("SCAN", "mykey", "SINCE", 0, "INCLUDE_DELETED", "IDS").Str("[0 [car1 truck2 truck3] []]"),
+
+		Do("CONFIG", "SET", "tombstone-retention", "60").OK(),
+		Do("DEL", "mykey", "truck2").Str("1"),
+		Do("PDEL", "mykey", "car*").Str("1"),
+		Do("SCAN", "mykey", "IDS").Str("[0 [truck3]]"),
+		Do("SCAN", "mykey", "SINCE", 0, "INCLUDE_DELETED", "IDS").JSON().Func(deleted(`["truck3"] ["truck2","car1"]`)),
+		Do("SCAN", "mykey", "MATCH", "truck*", "SINCE", 0, "INCLUDE_DELETED", "IDS").JSON().Func(deleted(`["truck3"] ["truck2"]`)),
+		Do("SCAN", "mykey", "SINCE", time.Now().Add(time.Hour).Unix(), "INCLUDE_DELETED", "IDS").JSON().Func(deleted(`["truck3"] []`)),
+		Do("SCAN", "mykey", "SINCE", 0, "INCLUDE_DELETED", "IDS").Func(func(s string) error {
+			if !strings.HasPrefix(s, "[0 [truck3] [[truck2 ") {
+				return fmt.Errorf("unexpected '%s'", s)
+			}
+			return nil
+		}),
+
+		// setting the id again removes the tombstone
+		Do("SET", "mykey", "truck2", "POINT", 33, -115).OK(),
+		Do("SCAN", "mykey", "SINCE", 0, "INCLUDE_DELETED", "IDS").JSON().Func(deleted(`["truck2","truck3"] ["car1"]`)),
+
+		Do("SCAN", "mykey", "INCLUDE_DELETED", "IDS").Err("INCLUDE_DELETED requires SINCE"),
+		Do("SCAN", "mykey", "SINCE", 0, "INCLUDE_DELETED", "COUNT").Err("INCLUDE_DELETED is not allowed for COUNT"),
+		Do("NEARBY", "mykey", "INCLUDE_DELETED", "IDS", "POINT", 33, -115).Err("INCLUDE_DELETED is not allowed for NEARBY"),
+
+		// tombstones are removed after the retention
+		Do("CONFIG", "SET", "tombstone-retention", "1").OK(),
+		Sleep(time.Millisecond*2500),
+		Do("SCAN", "mykey", "SINCE", 0, "INCLUDE_DELETED", "IDS").JSON().Func(deleted(`["truck2","truck3"] []`)),
+	)
+	return err
+}
+
+func keys_EXPORT_test(mc *mockServer) error {
+	for i := 0; i < 5; i++ {
+		if _, err := mc.Do("SET", "fleet", fmt.Sprintf("truck%d", i),
+			"FIELD", "speed", i+1, "POINT", 33, -115); err != nil {
+			return err
+		}
+	}
+	// export returns the messages of an export, up to and including the
+	// first checkpoint or the end.
+	export := func(args ...interface{}) ([]string, error) {
+		conn, err := redis.Dial("tcp", fmt.Sprintf(":%d", mc.port),
+			redis.DialReadTimeout(time.Second))
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		if _, err := conn.Do("OUTPUT", "JSON"); err != nil {
+			return nil, err
+		}
+		if err := conn.Send("EXPORT", args...); err != nil {
+			return nil, err
+		}
+		if err := conn.Flush(); err != nil {
+			return nil, err
+		}
+		var msgs []string
+		for {
+			msg, err := redis.String(conn.Receive())
+			if err != nil {
+				return nil, err
+			}
+			if gjson.Get(msg, "live").Bool() {
+				continue
+			}
+			msgs = append(msgs, msg)
+			if gjson.Get(msg, "checkpoint").Exists() ||
+				gjson.Get(msg, "done").Bool() {
+				return msgs, nil
+			}
+		}
+	}
+	msgs, err := export("fleet", "CHECKPOINT", 3)
+	if err != nil {
+		return err
+	}
+	if len(msgs) != 4 {
+		return fmt.Errorf("expected 4 messages, got %d", len(msgs))
+	}
+	if msgs[0] != `{"id":"truck0","object":{"type":"Point","coordinates":[-115,33]},"fields":{"speed":1}}` {
+		return fmt.Errorf("unexpected object '%s'", msgs[0])
+	}
+	token := gjson.Get(msgs[3], "checkpoint").String()
+	msgs, err = export("fleet", "CHECKPOINT", 3, "RESUME", token)
+	if err != nil {
+		return err
+	}
+	if len(msgs) != 3 || gjson.Get(msgs[0], "id").String() != "truck3" ||
+		gjson.Get(msgs[1], "id").String() != "truck4" ||
+		msgs[2] != `{"done":true,"count":2}` {
+		return fmt.Errorf("unexpected resume '%s'", strings.Join(msgs, " "))
+	}
+	return mc.DoBatch(
+		Do("EXPORT").Err("wrong number of arguments for 'export' command"),
+		Do("EXPORT", "fleet", "CHECKPOINT").Err("wrong number of arguments for 'export' command"),
+		Do("EXPORT", "fleet", "CHECKPOINT", 0).Err("invalid argument '0'"),
+		Do("EXPORT", "fleet", "RESUME", "!!").Err("invalid argument '!!'"),
+		Do("EXPORT", "fleet", "FROM", 1).Err("invalid argument 'FROM'"),
+	)
+}
+
+func keys_TRACK_test(mc *mockServer) error {
+	err := mc.DoBatch(
+		Do("SET", "mykey", "truck1", "FIELD", "status", "ok", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "truck2", "FIELD", "status", "ok", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "truck3", "FIELD", "status", "alarm", "POINT", 33, -115).OK(),
+		Do("TRACK", "mykey", "status").OK(),
+		Do("SCAN", "mykey", "SINCE", 0, "WHERECHANGED", "speed", "IDS").Err("field 'speed' is not tracked"),
+		Do("SCAN", "mykey", "SINCE", 0, "IDS").Err("SINCE requires WHERECHANGED or INCLUDE_DELETED"),
+		Do("SCAN", "mykey", "WHERECHANGED", "status", "IDS").Err("WHERECHANGED requires SINCE"),
+		Do("NEARBY", "mykey", "SINCE", 0, "WHERECHANGED", "status", "IDS", "POINT", 33, -115).Err("SINCE is not allowed for NEARBY"),
+	)
+	if err != nil {
+		return err
+	}
+	time.Sleep(time.Millisecond * 10)
+	since := fmt.Sprintf("%f", float64(time.Now().UnixNano())/1e9)
+	time.Sleep(time.Millisecond * 10)
+	return mc.DoBatch(
+		Do("SCAN", "mykey", "SINCE", since, "WHERECHANGED", "status", "IDS").Str("[0 []]"),
+		Do("FSET", "mykey", "truck1", "status", "alarm").Str("1"),
+		Do("SET", "mykey", "truck2", "FIELD", "status", "alarm", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "truck2", "FIELD", "status", "ok", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "truck4", "FIELD", "status", "alarm", "POINT", 33, -115).OK(),
+		Do("SCAN", "mykey", "SINCE", since, "WHERECHANGED", "status", "IDS").Str("[0 [truck1 truck4]]"),
+		Do("SCAN", "mykey", "SINCE", since, "WHERECHANGED", "status", "WHEREIN", "status", 1, "alarm", "IDS").Str("[0 [truck1 truck4]]"),
+		Do("SCAN", "mykey", "SINCE", since, "WHERECHANGED", "status", "COUNT").Str("2"),
+		Do("DEL", "mykey", "truck4").Str("1"),
+		Do("SCAN", "mykey", "SINCE", since, "WHERECHANGED", "status", "IDS").Str("[0 [truck1]]"),
+		Do("UNTRACK", "mykey", "status").Str("1"),
+		Do("UNTRACK", "mykey").Str("0"),
+		Do("SCAN", "mykey", "SINCE", since, "WHERECHANGED", "status", "IDS").Err("field 'status' is not tracked"),
+	)
+}
+
+func keys_MOVEMENT_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "truck1", "POINT", 33, -115).OK(),
+		Do("MOVEMENT", "mykey", "truck1").Err("previous geometries are not kept for key 'mykey'"),
+		Do("KEEPPREV", "mykey", "yes").OK(),
+		Do("KEEPPREV", "mykey", "maybe").Err("invalid argument 'maybe'"),
+		Do("MOVEMENT", "mykey", "truck2").Err("id not found"),
+		Do("MOVEMENT", "mykey", "truck1").Str(`[nil {"type":"Point","coordinates":[-115,33]}]`),
+		Do("SET", "mykey", "truck1", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "truck1", "POINT", 33.01, -115).OK(),
+		Do("MOVEMENT", "mykey", "truck1").JSON().Func(func(s string) error {
+			if gjson.Get(s, "previous.coordinates").Raw != "[-115,33]" ||
+				gjson.Get(s, "current.coordinates").Raw != "[-115,33.01]" {
+				return fmt.Errorf("unexpected geometries: %s", s)
+			}
+			if d := gjson.Get(s, "distance").Float(); d < 1100 || d > 1120 {
+				return fmt.Errorf("unexpected distance: %s", s)
+			}
+			if b := gjson.Get(s, "bearing").Float(); b != 0 {
+				return fmt.Errorf("unexpected bearing: %s", s)
+			}
+			if !gjson.Get(s, "seconds").Exists() {
+				return fmt.Errorf("missing seconds: %s", s)
+			}
+			return nil
+		}),
+		Do("FSET", "mykey", "truck1", "speed", 10).Str("1"),
+		Do("MOVEMENT", "mykey", "truck1").JSON().Func(func(s string) error {
+			if gjson.Get(s, "previous.coordinates").Raw != "[-115,33]" {
+				return fmt.Errorf("unexpected previous: %s", s)
+			}
+			return nil
+		}),
+		Do("DEL", "mykey", "truck1").Str("1"),
+		Do("SET", "mykey", "truck1", "POINT", 34, -115).OK(),
+		Do("MOVEMENT", "mykey", "truck1").JSON().Func(func(s string) error {
+			if gjson.Get(s, "previous").Raw != "null" || gjson.Get(s, "distance").Exists() {
+				return fmt.Errorf("expected partial result: %s", s)
+			}
+			return nil
+		}),
+		Do("KEEPPREV", "mykey", "no").OK(),
+		Do("MOVEMENT", "mykey", "truck1").Err("previous geometries are not kept for key 'mykey'"),
+	)
+}
+
+func keys_TRACKTRIM_test(mc *mockServer) error {
+	now := time.Now().Unix()
+	track := fmt.Sprintf(`{"type":"LineString","coordinates":[[1,1,0,%d],[2,2,0,%d],[3,3,0,%d],[4,4,0,%d]]}`,
+		now-300, now-200, now-100, now)
+	err := mc.DoBatch(
+		Do("SET", "mykey", "line", "FIELD", "speed", 10, "OBJECT", `{"type":"LineString","coordinates":[[1,1],[2,2],[3,3],[4,4]]}`).OK(),
+		Do("TRACKTRIM", "mykey", "line", "MAXPOINTS", 5).Str("0"),
+		Do("TRACKTRIM", "mykey", "line", "MAXPOINTS", 3).Str("1"),
+		Do("GET", "mykey", "line", "WITHFIELDS").Str(`[{"type":"LineString","coordinates":[[2,2],[3,3],[4,4]]} [speed 10]]`),
+		Do("BOUNDS", "mykey").Str("[[2 2] [4 4]]"),
+		Do("TRACKTRIM", "mykey", "line", "MAXAGE", 60).Err("MAXAGE requires a unix timestamp as the fourth value of each vertex"),
+		Do("TRACKTRIM", "mykey", "line", "MAXPOINTS", 1).JSON().Str(`{"ok":true,"removed":2}`),
+		Do("GET", "mykey", "line").Str(`{"type":"Point","coordinates":[4,4]}`),
+		Do("TRACKTRIM", "mykey", "line", "MAXPOINTS", 1).Err("object is not a linestring"),
+		Do("SET", "mykey", "line", "OBJECT", track).OK(),
+		Do("TRACKTRIM", "mykey", "line", "MAXAGE", 150).Str("2"),
+		Do("GET", "mykey", "line").Str(fmt.Sprintf(`{"type":"LineString","coordinates":[[3,3,0,%d],[4,4,0,%d]]}`, now-100, now)),
+		Do("TRACKTRIM", "mykey", "line", "MAXAGE", 0).Str("1"),
+		Do("GET", "mykey", "line").Str(fmt.Sprintf(`{"type":"Point","coordinates":[4,4,0,%d]}`, now)),
+		Do("TRACKTRIM", "mykey", "line", "MAXPOINTS", 0).Err("invalid argument '0'"),
+		Do("TRACKTRIM", "mykey", "line", "MAXLEN", 3).Err("invalid argument 'MAXLEN'"),
+		Do("TRACKTRIM", "mykey", "line").Err("wrong number of arguments for 'tracktrim' command"),
+		Do("TRACKTRIM", "mykey", "none", "MAXPOINTS", 3).Err("id not found"),
+	)
+	if err != nil {
+		return err
+	}
+	// the trim is written to the AOF as the resulting geometry
+	conn, err := openFollower(mc)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var last []string
+	for {
+		args, err := redis.Strings(conn.Receive())
+		if err != nil {
+			break
+		}
+		last = args
+	}
+	expect := fmt.Sprintf(`[SET mykey line OBJECT {"type":"Point","coordinates":[4,4,0,%d]}]`, now)
+	if got := fmt.Sprint(last); got != expect {
+		return fmt.Errorf("expected '%s', got '%s'", expect, got)
+	}
+	return nil
+}
+
+func keys_TRACKAPPEND_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("TRACKAPPEND", "mykey", "truck1", "POINT", 33, -115).Str("1"),
+		Do("GET", "mykey", "truck1").Str(`{"type":"Point","coordinates":[-115,33]}`),
+		Do("FSET", "mykey", "truck1", "speed", 10).Str("1"),
+		Do("TRACKAPPEND", "mykey", "truck1", "POINT", 34, -116).Str("2"),
+		Do("TRACKAPPEND", "mykey", "truck1", "POINT", 35, -117).JSON().Str(`{"ok":true,"points":3}`),
+		Do("GET", "mykey", "truck1", "WITHFIELDS").Str(`[{"type":"LineString","coordinates":[[-115,33],[-116,34],[-117,35]]} [speed 10]]`),
+		Do("BOUNDS", "mykey").Str("[[-117 33] [-115 35]]"),
+		Do("TRACKAPPEND", "mykey", "truck2", "POINT", 33, -115, 0, 1700000000).Str("1"),
+		Do("TRACKAPPEND", "mykey", "truck2", "POINT", 34, -115, 0, 1700000060).Str("2"),
+		Do("GET", "mykey", "truck2").Str(`{"type":"LineString","coordinates":[[-115,33,0,1700000000],[-115,34,0,1700000060]]}`),
+		Do("TRACKTRIM", "mykey", "truck2", "MAXAGE", 60).Str("1"),
+		Do("SET", "mykey", "poly", "BOUNDS", 0, 0, 1, 1).OK(),
+		Do("TRACKAPPEND", "mykey", "poly", "POINT", 33, -115).Err("object is not a linestring"),
+		Do("TRACKAPPEND", "mykey", "truck1", "BOUNDS", 33, -115).Err("invalid argument 'BOUNDS'"),
+		Do("TRACKAPPEND", "mykey", "truck1", "POINT", "north", -115).Err("invalid argument 'north'"),
+		Do("TRACKAPPEND", "mykey", "truck1", "POINT", 33).Err("wrong number of arguments for 'trackappend' command"),
+	)
+}
+
+func keys_SETDELTA_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "truck1", "FIELD", "speed", 10, "EX", 100, "POINT", 33, -115).OK(),
+		Do("SETDELTA", "mykey", "truck1", "15,-2500").OK(),
+		Do("GET", "mykey", "truck1", "WITHFIELDS").Str(`[{"type":"Point","coordinates":[-115.00025,33.0000015]} [speed 10]]`),
+		Do("SETDELTA", "mykey", "truck1", "-15,2500").JSON().OK(),
+		Do("GET", "mykey", "truck1", "POINT").Str(`[33 -115]`),
+		Do("TTL", "mykey", "truck1").Func(func(s string) error {
+			if s == "-1" {
+				return errors.New("expected the expiration to be kept")
+			}
+			return nil
+		}),
+		Do("SET", "mykey", "truck2", "POINT", 33, -115, 12).OK(),
+		Do("SETDELTA", "mykey", "truck2", "10000000,0").OK(),
+		Do("GET", "mykey", "truck2").Str(`{"type":"Point","coordinates":[-115,34,12]}`),
+		Do("SETDELTA", "mykey", "truck2", "1000000000,0").Err("invalid argument '1000000000,0'"),
+		Do("SETDELTA", "mykey", "truck2", "1.5,0").Err("invalid argument '1.5,0'"),
+		Do("SETDELTA", "mykey", "truck2", "15").Err("invalid argument '15'"),
+		Do("SETDELTA", "mykey", "truck3", "15,15").Err("id not found"),
+		Do("SETDELTA", "nokey", "truck3", "15,15").Err("key not found"),
+		Do("SETDELTA", "mykey", "truck2").Err("wrong number of arguments for 'setdelta' command"),
+		Do("SET", "mykey", "area", "BOUNDS", 0, 0, 1, 1).OK(),
+		Do("SETDELTA", "mykey", "area", "15,15").Err("object is not a point"),
+	)
+}
+
+func keys_DEDUP_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "unit1", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "unit2", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "other", "OBJECT", `{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}`).OK(),
+		Do("STATS", "mykey").JSON().Func(func(s string) error {
+			if gjson.Get(s, "stats.0.num_geometries").Exists() {
+				return fmt.Errorf("unexpected geometries: %s", s)
+			}
+			return nil
+		}),
+		Do("DEDUP", "mykey", "yes").OK(),
+		Do("DEDUP", "mykey", "maybe").Err("invalid argument 'maybe'"),
+		Do("STATS", "mykey").JSON().Func(func(s string) error {
+			if n := gjson.Get(s, "stats.0.num_geometries").Int(); n != 2 {
+				return fmt.Errorf("expected 2 geometries, got %d", n)
+			}
+			return nil
+		}),
+		Do("SET", "mykey", "unit3", "FIELD", "floor", 3, "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "other2", "OBJECT", `{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}`).OK(),
+		Do("STATS", "mykey").JSON().Func(func(s string) error {
+			if n := gjson.Get(s, "stats.0.num_geometries").Int(); n != 2 {
+				return fmt.Errorf("expected 2 geometries, got %d", n)
+			}
+			return nil
+		}),
+		// moving one object leaves the others where they are
+		Do("SET", "mykey", "unit2", "POINT", 34, -116).OK(),
+		Do("GET", "mykey", "unit1", "POINT").Str("[33 -115]"),
+		Do("GET", "mykey", "unit2", "POINT").Str("[34 -116]"),
+		Do("GET", "mykey", "unit3", "WITHFIELDS", "POINT").Str("[[33 -115] [floor 3]]"),
+		Do("WITHIN", "mykey", "COUNT", "BOUNDS", 32.5, -115.5, 33.5, -114.5).Str("2"),
+		Do("RENAME", "mykey", "mykey2").OK(),
+		Do("STATS", "mykey2").JSON().Func(func(s string) error {
+			if n := gjson.Get(s, "stats.0.num_geometries").Int(); n != 3 {
+				return fmt.Errorf("expected 3 geometries, got %d", n)
+			}
+			return nil
+		}),
+		Do("DEDUP", "mykey2", "no").OK(),
+		Do("STATS", "mykey2").JSON().Func(func(s string) error {
+			if gjson.Get(s, "stats.0.num_geometries").Exists() {
+				return fmt.Errorf("unexpected geometries: %s", s)
+			}
+			return nil
+		}),
+		Do("DEDUP", "mykey2").Err("wrong number of arguments for 'dedup' command"),
+		Do("DROP", "mykey2").Str("1"),
+	)
+}
+
+func keys_KEYDEFAULTS_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "truck1", "POINT", 33, -115).OK(),
+		Do("GETKEYDEFAULTS", "mykey").Str(`[]`),
+		Do("KEYDEFAULTS", "mykey", "active", 1, "fleet", "north").OK(),
+		Do("GETKEYDEFAULTS", "mykey").Str(`[active 1 fleet north]`),
+		Do("GETKEYDEFAULTS", "mykey").JSON().Str(`{"ok":true,"defaults":{"active":1,"fleet":"north"}}`),
+		Do("SET", "mykey", "truck2", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "truck3", "FIELD", "active", 2, "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "truck1", "POINT", 34, -115).OK(),
+		Do("GET", "mykey", "truck1", "WITHFIELDS").Str(`[{"type":"Point","coordinates":[-115,34]}]`),
+		Do("GET", "mykey", "truck2", "WITHFIELDS").Str(`[{"type":"Point","coordinates":[-115,33]} [active 1 fleet north]]`),
+		Do("GET", "mykey", "truck3", "WITHFIELDS").Str(`[{"type":"Point","coordinates":[-115,33]} [active 2 fleet north]]`),
+		Do("RENAME", "mykey", "mykey2").OK(),
+		Do("GETKEYDEFAULTS", "mykey").Str(`[]`),
+		Do("GETKEYDEFAULTS", "mykey2").Str(`[active 1 fleet north]`),
+		Do("KEYDEFAULTS", "mykey2", "z", 1).Err("invalid argument 'z'"),
+		Do("KEYDEFAULTS", "mykey2", "active").Err("wrong number of arguments for 'keydefaults' command"),
+		Do("KEYDEFAULTS", "mykey2").OK(),
+		Do("GETKEYDEFAULTS", "mykey2").JSON().Str(`{"ok":true,"defaults":{}}`),
+	)
+}
+
+func keys_SETINDEX_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "truck1", "FIELD", "status", "active", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "truck2", "FIELD", "status", "parked", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "truck3", "FIELD", "status", "active", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "truck4", "POINT", 33, -115).OK(),
+		Do("INDEXES", "mykey").Str("[]"),
+		Do("SETINDEX", "mykey", "status").OK(),
+		Do("SETINDEX", "mykey", "status").OK(),
+		Do("INDEXES", "mykey").Str("[status]"),
+		Do("INDEXES", "mykey").JSON().Str(`{"ok":true,"indexes":["status"]}`),
+		Do("SCAN", "mykey", "WHERE", "status", "==", "active", "IDS").Str("[0 [truck1 truck3]]"),
+		Do("SCAN", "mykey", "DESC", "WHERE", "status", "==", "ACTIVE", "IDS").Str("[0 [truck3 truck1]]"),
+		Do("SCAN", "mykey", "WHERE", "status", "!=", "active", "IDS").Str("[0 [truck2 truck4]]"),
+		Do("SCAN", "mykey", "WHERE", "status", "==", "active", "WHERE", "status", "==", "parked", "IDS").Str("[0 []]"),
+		Do("SCAN", "mykey", "WHERE", "status", "==", "active", "LIMIT", 1, "IDS").Str("[1 [truck1]]"),
+		Do("SCAN", "mykey", "CURSOR", 1, "WHERE", "status", "==", "active", "IDS").Str("[0 [truck3]]"),
+		Do("SCAN", "mykey", "WHERE", "status", "==", "active", "COUNT").Str("2"),
+		// the index follows the writes
+		Do("FSET", "mykey", "truck2", "status", "active").Str("1"),
+		Do("DEL", "mykey", "truck1").Str("1"),
+		Do("SET", "mykey", "truck5", "FIELD", "status", "active", "POINT", 33, -115).OK(),
+		Do("SCAN", "mykey", "WHERE", "status", "==", "active", "IDS").Str("[0 [truck2 truck3 truck5]]"),
+		Do("SCAN", "mykey", "WHERE", "status", "==", 0, "IDS").Str("[0 [truck4]]"),
+		// new collections of the key and renamed keys keep the index
+		Do("RENAME", "mykey", "mykey2").OK(),
+		Do("INDEXES", "mykey").Str("[]"),
+		Do("INDEXES", "mykey2").Str("[status]"),
+		Do("DROP", "mykey2").Str("1"),
+		Do("SET", "mykey2", "truck6", "FIELD", "status", "active", "POINT", 33, -115).OK(),
+		Do("SCAN", "mykey2", "WHERE", "status", "==", "active", "IDS").Str("[0 [truck6]]"),
+		Do("DELINDEX", "mykey2", "status").Str("1"),
+		Do("DELINDEX", "mykey2", "status").Str("0"),
+		Do("DELINDEX", "mykey2", "status").JSON().OK(),
+		Do("INDEXES", "mykey2").Str("[]"),
+		Do("SCAN", "mykey2", "WHERE", "status", "==", "active", "IDS").Str("[0 [truck6]]"),
+		Do("SETINDEX", "mykey2", "z").Err("invalid argument 'z'"),
+		Do("SETINDEX", "mykey2", "properties.name").Err("invalid argument 'properties.name'"),
+		Do("SETINDEX", "mykey2").Err("wrong number of arguments for 'setindex' command"),
+	)
+}
+
+func keys_SETINDEX_RANGE_test(mc *mockServer) error {
+	var cmds []any
+	for i := 0; i < 20; i++ {
+		// the odd ones are far away
+		lat := 33 + float64(i%2)*10
+		cmds = append(cmds, Do("SET", "fleet", fmt.Sprintf("truck%02d", i),
+			"FIELD", "speed", i, "POINT", lat, -115).OK())
+	}
+	cmds = append(cmds,
+		Do("SETINDEX", "fleet", "speed").OK(),
+		Do("SCAN", "fleet", "WHERE", "speed", ">", 16, "IDS").Str("[0 [truck17 truck18 truck19]]"),
+		Do("SCAN", "fleet", "DESC", "WHERE", "speed", "<=", 2, "IDS").Str("[0 [truck02 truck01 truck00]]"),
+		Do("SCAN", "fleet", "WHERE", "speed", 3, "(5", "IDS").Str("[0 [truck03 truck04]]"),
+		Do("SCAN", "fleet", "WHERE", "speed", "-inf", "+inf", "COUNT").Str("20"),
+		// few matches are searched through the field index
+		Do("WITHIN", "fleet", "WHERE", "speed", ">=", 17, "IDS", "BOUNDS", 32, -116, 34, -114).Str("[0 [truck18]]"),
+		Do("INTERSECTS", "fleet", "WHERE", "speed", "<", 1, "IDS", "BOUNDS", 32, -116, 34, -114).Str("[0 [truck00]]"),
+		Do("INTERSECTS", "fleet", "WHERE", "speed", "<", 2, "IDS", "BOUNDS", 42, -116, 44, -114).Str("[0 [truck01]]"),
+		// many matches are searched through the spatial index
+		Do("WITHIN", "fleet", "WHERE", "speed", ">=", 10, "COUNT", "BOUNDS", 32, -116, 34, -114).Str("5"),
+		Do("DELINDEX", "fleet", "speed").Str("1"),
+		Do("WITHIN", "fleet", "WHERE", "speed", ">=", 17, "IDS", "BOUNDS", 32, -116, 34, -114).Str("[0 [truck18]]"),
+	)
+	return mc.DoBatch(cmds...)
+}
+
 func keys_TTL_test(mc *mockServer) error {
 	return mc.DoBatch(
 		Do("SET", "mykey", "myid", "STRING", "value").OK(),
@@ -453,6 +1150,33 @@ func keys_TTL_test(mc *mockServer) error {
 		Do("TTL", "mykey", "myid2").JSON().Err("id not found"),
 	)
 }
+func keys_PTTL_test(mc *mockServer) error {
+	pttl := func(min, max int) func(s string) error {
+		return func(s string) error {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < min || n > max {
+				return fmt.Errorf("expected %d..%d, got '%s'", min, max, s)
+			}
+			return nil
+		}
+	}
+	return mc.DoBatch(
+		Do("SET", "mykey", "myid", "STRING", "value", "PX", 1500).OK(),
+		Do("PTTL", "mykey", "myid").Func(pttl(1000, 1500)),
+		Do("TTL", "mykey", "myid").Str("1"),
+		Do("PEXPIRE", "mykey", "myid", 300).Str("1"),
+		Do("PTTL", "mykey", "myid").Func(pttl(200, 300)),
+		Do("TTL", "mykey", "myid").Str("0"),
+		Do("PTTL", "mykey2", "myid").Str("-2"),
+		Do("PTTL", "mykey", "myid2").Str("-2"),
+		Do("PTTL", "mykey").Err("wrong number of arguments for 'pttl' command"),
+		Do("SET", "mykey", "myid", "STRING", "value").OK(),
+		Do("PTTL", "mykey", "myid").Str("-1"),
+		Do("PTTL", "mykey", "myid").JSON().Str(`{"ok":true,"pttl":-1}`),
+		Do("PTTL", "mykey2", "myid").JSON().Err("key not found"),
+		Do("PTTL", "mykey", "myid2").JSON().Err("id not found"),
+	)
+}
 func keys_EXISTS_test(mc *mockServer) error {
 	return mc.DoBatch(
 		Do("SET", "mykey", "myid", "STRING", "value").OK(),
@@ -477,6 +1201,129 @@ func keys_FEXISTS_test(mc *mockServer) error {
 	)
 }
 
+func keys_SET_IFWITHIN_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "zones", "allowed", "BOUNDS", 33, -116, 34, -115).OK(),
+		Do("SET", "fleet", "truck1", "POINT", 33.5, -115.5, "IFWITHIN", "zones", "allowed").OK(),
+		Do("SET", "fleet", "truck1", "POINT", 35, -115.5, "IFWITHIN", "zones", "allowed").Str("<nil>"),
+		Do("SET", "fleet", "truck1", "POINT", 35, -115.5, "IFWITHIN", "zones", "allowed").JSON().Err("object is outside of region"),
+		Do("GET", "fleet", "truck1", "POINT").Str("[33.5 -115.5]"),
+		Do("SET", "fleet", "truck2", "POINT", 35, -115.5, "IFWITHIN", "zones", "allowed").Str("<nil>"),
+		Do("EXISTS", "fleet", "truck2").Str("0"),
+		Do("SET", "fleet", "truck2", "POINT", 35, -115.5, "IFOUTSIDE", "zones", "allowed").OK(),
+		Do("SET", "fleet", "truck2", "POINT", 33.5, -115.5, "IFOUTSIDE", "zones", "allowed").JSON().Err("object is inside of region"),
+		Do("GET", "fleet", "truck2", "POINT").Str("[35 -115.5]"),
+		Do("SET", "other", "truck3", "POINT", 33.5, -115.5, "IFWITHIN", "zones", "allowed").OK(),
+		Do("SET", "other2", "truck3", "POINT", 35, -115.5, "IFWITHIN", "zones", "allowed").Str("<nil>"),
+		Do("TYPE", "other2").Str("none"),
+		Do("SET", "fleet", "truck1", "POINT", 33.5, -115.5, "IFWITHIN", "nozones", "allowed").Err("key not found"),
+		Do("SET", "fleet", "truck1", "POINT", 33.5, -115.5, "IFWITHIN", "zones", "nozone").Err("id not found"),
+		Do("SET", "fleet", "truck1", "POINT", 33.5, -115.5, "IFWITHIN", "zones").Err("wrong number of arguments for 'set' command"),
+		Do("SET", "fleet", "truck1", "IFWITHIN", "zones", "allowed", "IFOUTSIDE", "zones", "allowed", "POINT", 33.5, -115.5).Err("invalid argument 'IFOUTSIDE'"),
+	)
+}
+
+func keys_SET_depth_test(mc *mockServer) error {
+	nested := func(depth int) string {
+		return strings.Repeat(`{"type":"GeometryCollection","geometries":[`, depth) +
+			`{"type":"Point","coordinates":[1,2]}` + strings.Repeat(`]}`, depth)
+	}
+	err := mc.DoBatch(
+		Do("CONFIG", "GET", "max-geometry-depth").Str("[max-geometry-depth 128]"),
+		Do("SET", "mykey", "myid", "OBJECT", nested(10)).OK(),
+		Do("SET", "mykey", "myid", "OBJECT", nested(100000)).Err("geometry exceeds the max-geometry-depth of 128"),
+		Do("CONFIG", "SET", "max-geometry-depth", 10).OK(),
+		Do("SET", "mykey", "myid", "OBJECT", nested(10)).Err("geometry exceeds the max-geometry-depth of 10"),
+		Do("WITHIN", "mykey", "IDS", "OBJECT", nested(10)).Err("geometry exceeds the max-geometry-depth of 10"),
+		Do("SET", "mykey", "myid", "OBJECT", nested(4)).OK(),
+		Do("CONFIG", "SET", "max-geometry-depth", 0).Err("Invalid argument '0' for CONFIG SET 'max-geometry-depth'"),
+		Do("CONFIG", "SET", "max-geometry-depth", "").OK(),
+		Do("CONFIG", "GET", "max-geometry-depth").Str("[max-geometry-depth 128]"),
+	)
+	if err != nil {
+		return err
+	}
+
+	// geometries in the aof load under a lower limit
+	aof, err := mc.readAOF()
+	if err != nil {
+		return err
+	}
+	mc2, err := mockOpenServer(MockServerOptions{
+		Silent:  true,
+		AOFData: aof,
+		Config:  `{"max-geometry-depth":"3"}`,
+	})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	return mc2.DoBatch(
+		Do("GET", "mykey", "myid").Str(nested(4)),
+		Do("SET", "mykey", "myid", "OBJECT", nested(4)).Err("geometry exceeds the max-geometry-depth of 3"),
+	)
+}
+
+func keys_SET_throttle_test(mc *mockServer) error {
+	stats := func(pending, coalesced int) func(s string) error {
+		return func(s string) error {
+			p := gjson.Get(s, "stats.writes_pending").Int()
+			c := gjson.Get(s, "stats.writes_coalesced").Int()
+			if int(p) != pending || int(c) != coalesced {
+				return fmt.Errorf("expected %d pending and %d coalesced, got '%d' and '%d'",
+					pending, coalesced, p, c)
+			}
+			return nil
+		}
+	}
+	return mc.DoBatch(
+		Do("CONFIG", "GET", "object-write-interval").Str("[object-write-interval 0]"),
+		Do("CONFIG", "SET", "object-write-interval", "fast").Err("Invalid argument 'fast' for CONFIG SET 'object-write-interval'"),
+		Do("CONFIG", "SET", "object-write-interval", 500).OK(),
+		Do("SET", "mykey", "truck1", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "truck1", "POINT", 34, -115).OK(),
+		Do("SET", "mykey", "truck1", "POINT", 35, -115).JSON().OK(),
+		Do("SET", "mykey", "truck2", "POINT", 33, -115).OK(),
+		Do("GET", "mykey", "truck1", "POINT").Str("[33 -115]"),
+		Do("SERVER").JSON().Func(stats(1, 1)),
+		Sleep(time.Second),
+		Do("GET", "mykey", "truck1", "POINT").Str("[35 -115]"),
+		Do("SERVER").JSON().Func(stats(0, 1)),
+
+		// other writes apply the pending writes first
+		Do("SET", "mykey", "truck2", "POINT", 36, -115).OK(),
+		Do("SET", "mykey", "truck2", "POINT", 37, -115).OK(),
+		Do("DEL", "mykey", "truck2").Str("1"),
+		Do("GET", "mykey", "truck2").Str("<nil>"),
+		Do("SET", "mykey", "truck1", "POINT", 38, -115).OK(),
+		Do("SET", "mykey", "truck1", "XX", "POINT", 39, -115).OK(),
+		Do("GET", "mykey", "truck1", "POINT").Str("[39 -115]"),
+		Sleep(time.Second),
+		Do("GET", "mykey", "truck1", "POINT").Str("[39 -115]"),
+		Do("SERVER").JSON().Func(stats(0, 1)),
+
+		// invalid writes are never held back
+		Do("SET", "mykey", "truck1", "POINT", 40, -115).OK(),
+		Do("SET", "mykey", "truck1", "OBJECT", "{bad").Err("invalid data"),
+		Do("SET", "mykey", "truck1", "FIELD", "z", 1, "POINT", 41, -115).Err("invalid argument 'z'"),
+		Do("SERVER").JSON().Func(stats(0, 1)),
+
+		// only the options of the SET are conditional, not the field names
+		Do("SET", "mykey", "truck1", "FIELD", "nx", "xx", "POINT", 41, -115).OK(),
+		Do("GET", "mykey", "truck1", "POINT").Str("[40 -115]"),
+		Do("SERVER").JSON().Func(stats(1, 1)),
+		Sleep(time.Second),
+		Do("GET", "mykey", "truck1", "WITHFIELDS", "POINT").Str("[[41 -115] [nx xx]]"),
+
+		// the expiration of a held back write counts from when it was sent
+		Do("SET", "mykey", "truck3", "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "truck3", "EX", 0.8, "POINT", 34, -115).OK(),
+		Do("GET", "mykey", "truck3", "POINT").Str("[33 -115]"),
+		Sleep(time.Second),
+		Do("GET", "mykey", "truck3").Str("<nil>"),
+	)
+}
+
 func keys_SET_EX_test(mc *mockServer) (err error) {
 	rand.Seed(time.Now().UnixNano())
 
@@ -631,6 +1478,44 @@ func keys_PDEL_test(mc *mockServer) error {
 	)
 }
 
+func keys_MSET_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("MSET", "mykey").Err("wrong number of arguments for 'mset' command"),
+		Do("MSET", "mykey", "myid1", "POINT", 33).Err("wrong number of arguments for 'mset' command"),
+		Do("MSET", "mykey", "myid1", "POINT", 33, -115, "myid2", "POINT", "a", -116).Err("invalid point at index 1"),
+		Do("MSET", "mykey", "myid1", "POINT", 33, -115, "myid2", "BOUNDS", 34, -116).Err("invalid point at index 1"),
+		Do("EXISTS", "mykey", "myid1").Err("key not found"),
+		Do("SET", "mykey", "myid1", "FIELD", "speed", 10, "EX", 100, "POINT", 30, -110).OK(),
+		Do("MSET", "mykey", "myid1", "POINT", 33, -115, "myid2", "POINT", 34, -116).Str("2"),
+		Do("GET", "mykey", "myid1", "POINT").Str("[33 -115]"),
+		Do("GET", "mykey", "myid2", "POINT").Str("[34 -116]"),
+		Do("FGET", "mykey", "myid1", "speed").Str("10"),
+		Do("TTL", "mykey", "myid1").Str("-1"),
+		Do("MSET", "mykey", "SKIPINVALID", "myid3", "POINT", 35, -117, "myid4", "POINT", 36, "x").Str("1"),
+		Do("EXISTS", "mykey", "myid4").Str("0"),
+		Do("MSET", "mykey", "SKIPINVALID", "myid4", "POINT", "x", -118, "myid5", "POINT", 37, -119, "myid6", "POINT").Err("wrong number of arguments for 'mset' command"),
+		Do("MSET", "mykey", "SKIPINVALID", "myid4", "POINT", "x", -118, "myid5", "POINT", 37, -119).JSON().Str(`{"ok":true,"count":1,"skipped":[0]}`),
+		Do("MSET", "mykey", "SKIPINVALID", "myid4", "POINT", "x", -118).Str("0"),
+		Do("SCAN", "mykey", "IDS").Str("[0 [myid1 myid2 myid3 myid5]]"),
+	)
+}
+
+func keys_binary_ids_test(mc *mockServer) error {
+	id := "\xff\x00\x9e"
+	return mc.DoBatch(
+		Do("SET", "mykey", id, "POINT", 33, -115).OK(),
+		Do("SET", "mykey", "text", "POINT", 34, -116).OK(),
+		Do("GET", "mykey", id, "POINT").Str("[33 -115]"),
+		Do("GET", "mykey", "\xff\x00", "POINT").Str("<nil>"),
+		Do("SCAN", "mykey", "IDS").Str("[0 [text "+id+"]]"),
+		Do("SCAN", "mykey", "IDS").JSON().Str(`{"ok":true,"ids":["text",{"id":"/wCe","id_encoding":"base64"}],"count":2,"cursor":0}`),
+		Do("SCAN", "mykey", "POINTS").JSON().Str(`{"ok":true,"points":[{"id":"text","point":{"lat":34,"lon":-116}},{"id":"/wCe","id_encoding":"base64","point":{"lat":33,"lon":-115}}],"count":2,"cursor":0}`),
+		Do("NEARBY", "mykey", "IDS", "POINT", 33, -115, 1000).Str("[0 ["+id+"]]"),
+		Do("DEL", "mykey", id).Str("1"),
+		Do("SCAN", "mykey", "IDS").Str("[0 [text]]"),
+	)
+}
+
 func keys_WHEREIN_test(mc *mockServer) error {
 	return mc.DoBatch(
 		Do("SET", "mykey", "myid_a1", "FIELD", "a", 1, "POINT", 33, -115).OK(),
@@ -660,6 +1545,24 @@ func keys_WHEREEVAL_test(mc *mockServer) error {
 	)
 }
 
+func keys_WHEREJSON_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("SET", "mykey", "a", "OBJECT", `{"type":"Feature","geometry":{"type":"Point","coordinates":[-115,33]},"properties":{"owner":{"id":42,"name":"tom"}}}`).OK(),
+		Do("SET", "mykey", "b", "OBJECT", `{"type":"Feature","geometry":{"type":"Point","coordinates":[-115,33.01]},"properties":{"owner":{"id":7,"name":"ann"}}}`).OK(),
+		Do("SET", "mykey", "c", "POINT", 33.02, -115).OK(),
+		Do("SCAN", "mykey", "WHEREJSON", "properties.owner.id", "==", 42, "IDS").Str("[0 [a]]"),
+		Do("SCAN", "mykey", "WHEREJSON", "properties.owner.id", "!=", 42, "IDS").Str("[0 [b]]"),
+		Do("SCAN", "mykey", "WHEREJSON", "properties.owner.id", ">=", 7, "IDS").Str("[0 [a b]]"),
+		Do("SCAN", "mykey", "WHEREJSON", "properties.owner.id", "<", 42, "IDS").Str("[0 [b]]"),
+		Do("SCAN", "mykey", "WHEREJSON", "properties.owner.name", "==", "ann", "IDS").Str("[0 [b]]"),
+		Do("SCAN", "mykey", "WHEREJSON", "coordinates.1", ">", 33.01, "IDS").Str("[0 [c]]"),
+		Do("SCAN", "mykey", "WHEREJSON", "properties.owner.id", ">", 0, "WHEREJSON", "properties.owner.id", "<", 10, "IDS").Str("[0 [b]]"),
+		Do("WITHIN", "mykey", "WHEREJSON", "properties.owner.id", "==", 42, "IDS", "BOUNDS", 32.8, -115.2, 33.2, -114.8).Str("[0 [a]]"),
+		Do("SCAN", "mykey", "WHEREJSON", "properties.owner.id", "=", 42, "IDS").Err("invalid argument '='"),
+		Do("SCAN", "mykey", "WHEREJSON", "properties.owner.id", "==").Err("wrong number of arguments for 'scan' command"),
+	)
+}
+
 func keys_TYPE_test(mc *mockServer) error {
 	return mc.DoBatch(
 		Do("SET", "mykey", "myid1", "POINT", 33, -115).OK(),
@@ -702,6 +1605,66 @@ func keys_HEALTHZ_test(mc *mockServer) error {
 	)
 }
 
+func keys_CAPABILITIES_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("CAPABILITIES").JSON().Func(func(s string) error {
+			caps := gjson.Get(s, "capabilities")
+			if caps.Get("protocol").Int() != 1 {
+				return fmt.Errorf("expected protocol 1, got '%s'", caps.Get("protocol"))
+			}
+			if caps.Get("outputs").String() != `["json","resp"]` {
+				return fmt.Errorf("unexpected outputs '%s'", caps.Get("outputs"))
+			}
+			for _, path := range []string{
+				`endpoints.#(=="kafka")`, `searches.#(=="nearby")`,
+				`modifiers.#(=="components")`, `commands.#(=="CAPABILITIES")`,
+			} {
+				if !caps.Get(path).Exists() {
+					return fmt.Errorf("expected '%s' in '%s'", path, caps)
+				}
+			}
+			return nil
+		}),
+		Do("CAPABILITIES").Func(func(s string) error {
+			if !strings.HasPrefix(s, "[version ") {
+				return fmt.Errorf("unexpected response '%s'", s)
+			}
+			return nil
+		}),
+		Do("CAPABILITIES", "arg").Err(`wrong number of arguments for 'capabilities' command`),
+	)
+}
+
+func keys_NODESTATUS_test(mc *mockServer) error {
+	return mc.DoBatch(
+		Do("NODESTATUS").JSON().Func(func(s string) error {
+			if gjson.Get(s, "status.role").String() != "leader" {
+				return errors.New("expected leader")
+			}
+			if !gjson.Get(s, "status.caught_up").Bool() {
+				return errors.New("expected caught up")
+			}
+			if gjson.Get(s, "status.lag").Int() != 0 {
+				return errors.New("expected no lag")
+			}
+			if gjson.Get(s, "status.connections").Int() < 1 {
+				return errors.New("expected connections")
+			}
+			if !gjson.Get(s, "status.command_rate").Exists() {
+				return errors.New("expected command rate")
+			}
+			return nil
+		}),
+		Do("NODESTATUS").Func(func(s string) error {
+			if !strings.Contains(s, "role leader") {
+				return errors.New("expected leader")
+			}
+			return nil
+		}),
+		Do("NODESTATUS", "arg").Err(`wrong number of arguments for 'nodestatus' command`),
+	)
+}
+
 func keys_SERVER_test(mc *mockServer) error {
 	return mc.DoBatch(
 		Do("SERVER").Func(func(s string) error {
@@ -723,6 +1686,19 @@ func keys_SERVER_test(mc *mockServer) error {
 			}
 			return nil
 		}),
+		Do("CONFIG", "GET", "webhook-*").Str("[webhook-max-inflight 0 webhook-workers 0]"),
+		Do("CONFIG", "SET", "webhook-workers", "16").OK(),
+		Do("CONFIG", "SET", "webhook-max-inflight", "x").Err("Invalid argument 'x' for CONFIG SET 'webhook-max-inflight'"),
+		Do("CONFIG", "GET", "webhook-*").Str("[webhook-max-inflight 0 webhook-workers 16]"),
+		Do("SERVER").JSON().Func(func(s string) error {
+			if gjson.Get(s, "stats.webhook_workers").Int() != 16 ||
+				gjson.Get(s, "stats.webhook_max_inflight").Int() != 0 ||
+				!gjson.Get(s, "stats.webhook_saturated").Exists() {
+				return errors.New("looks invalid")
+			}
+			return nil
+		}),
+		Do("CONFIG", "SET", "webhook-workers", "").OK(),
 		Do("SERVER", "ext").Func(func(s string) error {
 			valid := strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") &&
 				strings.Contains(s, "sys_cpus") &&
@@ -9,6 +9,7 @@ import (
 
 func subTestMetrics(g *testGroup) {
 	g.regSubTest("basic", metrics_basic_test)
+	g.regSubTest("http", metrics_http_test)
 }
 
 func downloadURLWithStatusCode(u string) (int, string, error) {
@@ -54,6 +55,8 @@ func metrics_basic_test(mc *mockServer) error {
 	for _, want := range []string{
 		`tile38_connected_clients`,
 		`tile38_cmd_duration_seconds_count{cmd="set"}`,
+		`tile38_cmd_latency_seconds_bucket{cmd="set",le="1e-05"}`,
+		`tile38_commands_processed_total{cmd="set"}`,
 		`go_build_info`,
 		`go_threads`,
 		`tile38_collection_objects{col="metrics_test_1"} 1`,
@@ -68,3 +71,81 @@ func metrics_basic_test(mc *mockServer) error {
 	}
 	return nil
 }
+
+func metrics_http_test(mc *mockServer) error {
+	mc2, err := mockOpenServer(MockServerOptions{Silent: true})
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	get := func(auth string) (int, string, error) {
+		req, err := http.NewRequest("GET",
+			fmt.Sprintf("http://127.0.0.1:%d/metrics", mc2.port), nil)
+		if err != nil {
+			return 0, "", err
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return 0, "", err
+		}
+		return resp.StatusCode, string(body), nil
+	}
+	// off by default
+	if _, body, err := get(""); err != nil {
+		return err
+	} else if !strings.Contains(body, "unknown command") {
+		return fmt.Errorf("expected an unknown command, got: %s", body)
+	}
+	err = mc2.DoBatch(
+		Do("CONFIG", "GET", "http-metrics").Str("[http-metrics no]"),
+		Do("CONFIG", "SET", "http-metrics", "maybe").Err("Invalid argument 'maybe' for CONFIG SET 'http-metrics'"),
+		Do("CONFIG", "SET", "http-metrics", "yes").OK(),
+		Do("SET", "fleet", "truck1", "POINT", 33, -115).OK(),
+	)
+	if err != nil {
+		return err
+	}
+	status, body, err := get("")
+	if err != nil {
+		return err
+	}
+	if status != 200 {
+		return fmt.Errorf("expected status code 200, got: %d", status)
+	}
+	for _, want := range []string{
+		`tile38_commands_processed_total{cmd="set"}`,
+		`tile38_cmd_latency_seconds_count{cmd="set"}`,
+		`tile38_collection_objects{col="fleet"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			return fmt.Errorf("wanted metric: %s, got: %s", want, body)
+		}
+	}
+	// protected like the other http requests
+	err = mc2.DoBatch(
+		Do("CONFIG", "SET", "requirepass", "1234").OK(),
+		Do("AUTH", "1234").OK(),
+	)
+	if err != nil {
+		return err
+	}
+	if _, body, err := get(""); err != nil {
+		return err
+	} else if !strings.Contains(body, "authentication required") {
+		return fmt.Errorf("expected authentication required, got: %s", body)
+	}
+	if _, body, err := get("1234"); err != nil {
+		return err
+	} else if !strings.Contains(body, "tile38_collection_objects") {
+		return fmt.Errorf("expected metrics, got: %s", body)
+	}
+	return nil
+}
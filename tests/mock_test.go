@@ -43,6 +43,7 @@ type mockServer struct {
 	ioJSON   bool
 	dir      string
 	shutdown chan bool
+	done     chan struct{} // closed when the server has stopped
 }
 
 func (mc *mockServer) readAOF() ([]byte, error) {
@@ -56,6 +57,10 @@ func (mc *mockServer) metricsPort() int {
 type MockServerOptions struct {
 	AOFFileName string
 	AOFData     []byte
+	AOFCompress bool
+	Config      string        // contents of the config file
+	Dir         string        // data directory of a server that was shut down
+	Drain       time.Duration // how long a shutdown waits for the conns
 	Silent      bool
 	Metrics     bool
 }
@@ -86,6 +91,9 @@ func mockOpenServer(opts MockServerOptions) (*mockServer, error) {
 	rand.Seed(time.Now().UnixNano())
 	port := getNextPort()
 	dir := fmt.Sprintf("data-mock-%d", port)
+	if opts.Dir != "" {
+		dir = opts.Dir
+	}
 	if !opts.Silent {
 		fmt.Printf("Starting test server at port %d\n", port)
 	}
@@ -103,8 +111,20 @@ func mockOpenServer(opts MockServerOptions) (*mockServer, error) {
 		}
 	}
 
+	if opts.Config != "" {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return nil, err
+		}
+		err := os.WriteFile(filepath.Join(dir, "config"),
+			[]byte(opts.Config), 0666)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	shutdown := make(chan bool)
-	s := &mockServer{port: port, dir: dir, shutdown: shutdown}
+	s := &mockServer{port: port, dir: dir, shutdown: shutdown,
+		done: make(chan struct{})}
 	if opts.Metrics {
 		s.mport = getNextPort()
 	}
@@ -117,7 +137,9 @@ func mockOpenServer(opts MockServerOptions) (*mockServer, error) {
 			UseHTTP:           true,
 			DevMode:           true,
 			AppendOnly:        true,
+			AppendCompress:    opts.AOFCompress,
 			Shutdown:          shutdown,
+			DrainTimeout:      opts.Drain,
 			ShowDebugMessages: true,
 		}
 		if opts.Metrics {
@@ -127,6 +149,7 @@ func mockOpenServer(opts MockServerOptions) (*mockServer, error) {
 		if err != nil {
 			ferr.CompareAndSwap(nil, &err)
 		}
+		close(s.done)
 	}()
 	if err := s.waitForStartup(&ferr); err != nil {
 		s.Close()
@@ -181,6 +204,25 @@ func (mc *mockServer) Close() {
 	}
 }
 
+// Shutdown stops the server like a signal does, and waits for it to stop.
+// The data directory is kept, for opening the server again.
+func (mc *mockServer) Shutdown() error {
+	if mc.closed {
+		return nil
+	}
+	mc.closed = true
+	mc.shutdown <- true
+	if mc.conn != nil {
+		mc.conn.Close()
+	}
+	select {
+	case <-mc.done:
+		return nil
+	case <-time.After(time.Second * 10):
+		return errTimeout
+	}
+}
+
 func (mc *mockServer) ResetConn() {
 	if mc.conn != nil {
 		mc.conn.Close()
@@ -2,14 +2,18 @@ package tests
 
 import (
 	"fmt"
+	"net"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/tidwall/gjson"
 )
 
 func subTestMonitor(g *testGroup) {
 	g.regSubTest("monitor", follower_monitor_test)
+	g.regSubTest("logsubscribe", monitor_logsubscribe_test)
 }
 
 func follower_monitor_test(mc *mockServer) error {
@@ -75,3 +79,53 @@ func follower_monitor_test(mc *mockServer) error {
 
 	return err
 }
+
+func monitor_logsubscribe_test(mc *mockServer) error {
+	err := mc.DoBatch(
+		Do("LOGSUBSCRIBE", "info", "warn").Err("wrong number of arguments for 'logsubscribe' command"),
+		Do("LOGSUBSCRIBE", "fatal").Err("invalid argument 'fatal'"),
+		Do("LOGSUBSCRIBE", "loud").Err("invalid argument 'loud'"),
+	)
+	if err != nil {
+		return err
+	}
+	conn, err := redis.Dial("tcp", fmt.Sprintf("localhost:%d", mc.port),
+		redis.DialReadTimeout(time.Second*5))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	s, err := redis.String(conn.Do("LOGSUBSCRIBE", "info"))
+	if err != nil {
+		return err
+	}
+	if s != "OK" {
+		return fmt.Errorf("expected '%s', got '%s'", "OK", s)
+	}
+
+	// another connection that goes live is logged
+	conn2, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", mc.port))
+	if err != nil {
+		return err
+	}
+	defer conn2.Close()
+	if _, err := conn2.Write([]byte("MONITOR\r\n")); err != nil {
+		return err
+	}
+	expect := "live " + conn2.LocalAddr().String()
+	for {
+		// other servers of the tests may log too
+		s, err := redis.String(conn.Receive())
+		if err != nil {
+			return err
+		}
+		if gjson.Get(s, "message").String() != expect {
+			continue
+		}
+		if gjson.Get(s, "level").String() != "info" ||
+			!gjson.Get(s, "time").Exists() {
+			return fmt.Errorf("unexpected entry '%s'", s)
+		}
+		return nil
+	}
+}
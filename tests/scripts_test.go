@@ -3,6 +3,7 @@ package tests
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 func subTestScripts(g *testGroup) {
@@ -11,6 +12,7 @@ func subTestScripts(g *testGroup) {
 	g.regSubTest("READONLY", scripts_READONLY_test)
 	g.regSubTest("NONATOMIC", scripts_NONATOMIC_test)
 	g.regSubTest("VULN", scripts_VULN_test)
+	g.regSubTest("COMMANDREGISTER", scripts_COMMANDREGISTER_test)
 }
 
 func scripts_BASIC_test(mc *mockServer) error {
@@ -75,3 +77,59 @@ func scripts_VULN_test(mc *mockServer) error {
 		{"EVAL", "return package", "0"}, {nil},
 	})
 }
+
+func scripts_COMMANDREGISTER_test(mc *mockServer) error {
+	err := mc.DoBatch(
+		Do("COMMANDREGISTER", "parktruck", "return tile38.call('set', 'fleet', ARGV[1], 'field', 'parked', 1, 'point', ARGV[2], ARGV[3])").OK(),
+		Do("COMMANDREGISTER", "truckpoint", "return tile38.call('get', 'fleet', ARGV[1], 'point')", "READONLY").OK(),
+		Do("COMMANDREGISTER", "badtruck", "return tile38.call('set', 'fleet', ARGV[1], 'point', 1, 1)", "readonly").OK(),
+		Do("PARKTRUCK", "truck1", 33, -115).OK(),
+		Do("FGET", "fleet", "truck1", "parked").Str("1"),
+		Do("truckpoint", "truck1").Str("[33 -115]"),
+		Do("truckpoint", "truck1").JSON().Str(`{"ok":true,"result":["33","-115"]}`),
+		Do("badtruck", "truck2").Func(func(s string) error {
+			if !strings.Contains(s, "ERR read only") {
+				return fmt.Errorf("expected a read only error, got '%s'", s)
+			}
+			return nil
+		}),
+		Do("COMMANDREGISTER", "get", "return 1").Err("cannot replace the built-in command 'get'"),
+		Do("COMMANDREGISTER", "config", "return 1").Err("cannot replace the built-in command 'config'"),
+		Do("COMMANDREGISTER", "tombstone", "return 1").Err("cannot replace the built-in command 'tombstone'"),
+		Do("COMMANDREGISTER", "hello", "return 1").Err("cannot replace the built-in command 'hello'"),
+		Do("COMMANDREGISTER", "my truck", "return 1").Err("invalid argument 'my truck'"),
+		Do("COMMANDREGISTER", "broken", "return (").Func(func(s string) error {
+			if !strings.Contains(s, "f_") {
+				return fmt.Errorf("expected a compile error, got '%s'", s)
+			}
+			return nil
+		}),
+		Do("COMMANDREGISTER", "broken", "return 1", "FAST").Err("invalid argument 'FAST'"),
+		Do("COMMANDREGISTER", "broken").Err("wrong number of arguments for 'commandregister' command"),
+		Do("broken").Err("unknown command 'broken'"),
+		Do("COMMANDUNREGISTER", "badtruck").Str("1"),
+		Do("COMMANDUNREGISTER", "badtruck").Str("0"),
+		Do("badtruck", "truck2").Err("unknown command 'badtruck'"),
+		Do("AOFSHRINK").OK(),
+		Sleep(time.Second/2),
+	)
+	if err != nil {
+		return err
+	}
+
+	// the commands are kept in the aof
+	aof, err := mc.readAOF()
+	if err != nil {
+		return err
+	}
+	mc2, err := loadAOF(aof)
+	if err != nil {
+		return err
+	}
+	defer mc2.Close()
+	return mc2.DoBatch(
+		Do("parktruck", "truck2", 34, -116).OK(),
+		Do("truckpoint", "truck2").Str("[34 -116]"),
+		Do("badtruck", "truck3").Err("unknown command 'badtruck'"),
+	)
+}
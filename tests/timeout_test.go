@@ -16,6 +16,7 @@ func subTestTimeout(g *testGroup) {
 	g.regSubTest("no writes", timeout_no_writes_test)
 	g.regSubTest("within scripts", timeout_within_scripts_test)
 	g.regSubTest("no writes within scripts", timeout_no_writes_within_scripts_test)
+	g.regSubTest("heavy read limit", timeout_heavy_read_limit_test)
 }
 
 func setup(mc *mockServer, count int, points bool) (err error) {
@@ -169,3 +170,74 @@ func timeout_no_writes_within_scripts_test(mc *mockServer) (err error) {
 		{"EVALSHA", sha2, 0, "foo"}, {scriptTimeoutNotSupportedErr},
 	})
 }
+
+func timeout_heavy_read_limit_test(mc *mockServer) (err error) {
+	defer mc.DoBatch(
+		Do("CONFIG", "SET", "heavy-read-limit", "0").OK(),
+		Do("CONFIG", "SET", "heavy-read-wait", "0").OK(),
+	)
+	err = mc.DoBatch(
+		Do("SET", "mykey", "myid", "POINT", 33, -115).OK(),
+		Do("CONFIG", "SET", "heavy-read-limit", "one").Err("Invalid argument 'one' for CONFIG SET 'heavy-read-limit'"),
+		Do("CONFIG", "SET", "heavy-read-limit", "1").OK(),
+		Do("CONFIG", "GET", "heavy-read-limit").Str("[heavy-read-limit 1]"),
+		Do("CONFIG", "GET", "heavy-read-wait").Str("[heavy-read-wait 0]"),
+	)
+	if err != nil {
+		return err
+	}
+
+	// slowScan holds the only slot for a while
+	slowScan := func() chan error {
+		done := make(chan error, 1)
+		go func() {
+			conn, err := redis.Dial("tcp", fmt.Sprintf(":%d", mc.port))
+			if err != nil {
+				done <- err
+				return
+			}
+			defer conn.Close()
+			_, err = conn.Do("SCAN", "mykey", "WHEREEVAL",
+				"local i = 0 while i < 20000000 do i = i + 1 end return true",
+				0, "COUNT")
+			done <- err
+		}()
+		time.Sleep(time.Second / 4)
+		return done
+	}
+
+	done := slowScan()
+	err = mc.DoBatch(
+		Do("SCAN", "mykey", "COUNT").Err("server busy"),
+		Do("NEARBY", "mykey", "COUNT", "POINT", 33, -115, 1000).Err("server busy"),
+		Do("GET", "mykey", "myid", "POINT").Str("[33 -115]"),
+		Do("PING").Str("PONG"),
+	)
+	if err2 := <-done; err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+
+	// with a wait, the scan gets the slot once it frees up
+	if err := mc.DoBatch(
+		Do("CONFIG", "SET", "heavy-read-wait", "30000").OK(),
+	); err != nil {
+		return err
+	}
+	done = slowScan()
+	err = mc.DoBatch(
+		Do("SCAN", "mykey", "COUNT").Str("1"),
+	)
+	if err2 := <-done; err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+	return mc.DoBatch(
+		Do("CONFIG", "SET", "heavy-read-limit", "0").OK(),
+		Do("SCAN", "mykey", "COUNT").Str("1"),
+	)
+}